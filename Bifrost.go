@@ -74,6 +74,7 @@ var BifrostDaemon bool
 func usage() {
 	fmt.Fprintf(os.Stderr, `Bifrost version: `+config.VERSION+`
 Usage: Bifrost [-hv] [-config ./etc/Bifrost.ini] [-pid Bifrost.pid] [-data_dir dir]
+       Bifrost apply|diff -f pipeline.yaml [-server http://127.0.0.1:21036] [-user user -password password] [-prune] [-y]
 
 Options:
 `)
@@ -81,6 +82,9 @@ Options:
 }
 
 func main() {
+	if isPipelineCmd(os.Args) {
+		os.Exit(pipelineCmd(os.Args[1], os.Args[2:]))
+	}
 	var BifrostPid string
 	var BifrostDataDir string
 	var Version bool
@@ -237,6 +241,11 @@ func doSaveDbInfo() {
 }
 
 func doRecovery() {
+	// 开启 ha 的情况下,只有抢到租约的 leader 节点才恢复数据源并启动同步
+	if config.HA {
+		server.StartHA()
+		return
+	}
 	server.DoRecoverySnapshotData()
 }
 
@@ -67,6 +67,20 @@ func (This *BinlogDump) SetNextEventID(id uint64) bool {
 	return false
 }
 
+// 设置 离线表结构历史，需要在 StartDumpBinlog 之前设置
+// 设置之后 row 事件的表结构 不再直接查询源端当前的表结构，而是使用 当前位点 生效的表结构
+func (This *BinlogDump) SetSchemaHistory(schemaHistory *SchemaHistory) {
+	This.Lock()
+	defer This.Unlock()
+	This.parser.schemaHistory = schemaHistory
+}
+
+func (This *BinlogDump) GetSchemaHistory() *SchemaHistory {
+	This.RLock()
+	defer This.RUnlock()
+	return This.parser.schemaHistory
+}
+
 func (This *BinlogDump) GetBinlog() (string, uint32, uint32, string, uint64) {
 	This.RLock()
 	defer This.RUnlock()
@@ -213,6 +227,11 @@ func (This *BinlogDump) startConnAndDumpBinlog() {
 			log.Println(string(debug.Stack()))
 		}
 	}()
+	// 开启 离线表结构历史 并且 历史为空 的时候, 先记录 开始位点 的表结构快照
+	if err := This.parser.initSchemaHistorySnapshot(); err != nil {
+		This.parser.callbackErrChan <- err
+		return
+	}
 	dbopen := &mysqlDriver{}
 	conn, err := dbopen.Open(This.DataSource)
 	if err != nil {
@@ -0,0 +1,400 @@
+package mysql
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+/*
+离线解析本地 binlog 文件,比如 从备份中恢复出来的 mysql-bin.000001 或者 从库的 relay log
+和主从连接共用 eventParser 及 dumpBinlogPackets, 表结构从 表结构快照 中获取,不会查询 information_schema
+*/
+
+// 本地 binlog 文件已经全部读取完成
+var errBinlogFileEnd = errors.New("binlog file end")
+
+// binlog 文件开头的 magic number
+var binlogFileMagic = []byte{0xfe, 'b', 'i', 'n'}
+
+const (
+	binlogChecksumAlgCRC32    = 1
+	binlogFileFirstEventStart = 4
+)
+
+// 获取本地 binlog 文件列表
+// path 为文件的时候 只解析这一个文件; 为目录的时候 解析目录下所有 后缀为数字 的文件,按后缀从小到大排序
+func GetBinlogFileList(path string) (fileList []string, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var prefix string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		i := strings.LastIndex(name, ".")
+		if i <= 0 {
+			continue
+		}
+		if _, err = strconv.ParseUint(name[i+1:], 10, 64); err != nil {
+			continue
+		}
+		// mysql-bin.000001 和 relay-bin.000001 不能混在一起解析
+		if prefix == "" {
+			prefix = name[:i]
+		} else if prefix != name[:i] {
+			return nil, fmt.Errorf("binlog file prefix %s and %s in the same dir:%s", prefix, name[:i], path)
+		}
+		fileList = append(fileList, filepath.Join(path, name))
+	}
+	if len(fileList) == 0 {
+		return nil, fmt.Errorf("no binlog file in dir:%s", path)
+	}
+	sort.Slice(fileList, func(i, j int) bool {
+		return compareBinlogPosition(filepath.Base(fileList[i]), 0, filepath.Base(fileList[j]), 0) < 0
+	})
+	return fileList, nil
+}
+
+type binlogFileReader struct {
+	parser          *eventParser
+	fileList        []string
+	fileIndex       int
+	file            *os.File
+	bufReader       *bufio.Reader
+	fileName        string // 当前文件名,不包含目录
+	filePosition    uint32 // 下一个事件在当前文件中的位置
+	seekPosition    uint32 // 第一个文件 FORMAT_DESCRIPTION_EVENT 之后 直接跳到这个位置开始解析
+	eventFileName   string // 事件所属的 binlog 文件名, relay log 中是 主库的文件名
+	skipFileName    string // 开始位点的文件不在本地文件列表中的时候(比如 relay log),跳过这个位点之前的事件
+	skipPosition    uint32
+	gtidSet         *MySQLGtidSet // 不为 nil 的时候,只解析这个 GTID 集合中的事务
+	skipTransaction bool          // 当前事务不在 gtidSet 中
+}
+
+func newBinlogFileReader(parser *eventParser, fileList []string, fileName string, position uint32, gtid string) (*binlogFileReader, error) {
+	if len(fileList) == 0 {
+		return nil, fmt.Errorf("binlog file list is empty")
+	}
+	r := &binlogFileReader{
+		parser:   parser,
+		fileList: fileList,
+	}
+	if fileName != "" {
+		r.fileIndex = -1
+		for i, v := range fileList {
+			if filepath.Base(v) == fileName {
+				r.fileIndex = i
+				break
+			}
+		}
+		if r.fileIndex < 0 {
+			// relay log 中的位点是主库的位点,只能从第一个文件开始,跳过这个位点之前的事件
+			log.Println("binlog file:", fileName, " not in local file list, start from:", fileList[0], " and skip events before position:", position)
+			r.fileIndex = 0
+			r.skipFileName, r.skipPosition = fileName, position
+		} else if position > binlogFileFirstEventStart {
+			r.seekPosition = position
+		}
+	}
+	if gtid != "" {
+		gtidSet, dbType, err := NewGTIDSet(gtid)
+		if err != nil {
+			return nil, err
+		}
+		if dbType != DB_TYPE_MYSQL {
+			return nil, fmt.Errorf("binlog file dump only supported mysql gtid:%s", gtid)
+		}
+		r.gtidSet = gtidSet.(*MySQLGtidSet)
+	}
+	return r, nil
+}
+
+func (r *binlogFileReader) readPacket() ([]byte, error) {
+	for {
+		r.parser.binlogDump.RLock()
+		status := r.parser.dumpBinLogStatus
+		r.parser.binlogDump.RUnlock()
+		if status == STATUS_KILLED {
+			return nil, fmt.Errorf("binlog file dump killed")
+		}
+		if r.file == nil {
+			if r.fileIndex >= len(r.fileList) {
+				return nil, errBinlogFileEnd
+			}
+			if err := r.openFile(); err != nil {
+				return nil, err
+			}
+			// 和主从连接一样,每个文件开始之前 先返回一个 ROTATE_EVENT,parser 根据这个事件 切换当前文件名
+			return append([]byte{0}, r.rotateEvent()...), nil
+		}
+		data, err := r.readEvent()
+		if err == io.EOF {
+			r.close()
+			r.fileIndex++
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if r.skipEvent(data) {
+			continue
+		}
+		return append([]byte{0}, data...), nil
+	}
+}
+
+func (r *binlogFileReader) openFile() (err error) {
+	r.file, err = os.Open(r.fileList[r.fileIndex])
+	if err != nil {
+		return err
+	}
+	r.bufReader = bufio.NewReaderSize(r.file, 1024*1024)
+	magic := make([]byte, len(binlogFileMagic))
+	if _, err = io.ReadFull(r.bufReader, magic); err != nil || !bytes.Equal(magic, binlogFileMagic) {
+		r.close()
+		return fmt.Errorf("%s is not a binlog file", r.fileList[r.fileIndex])
+	}
+	r.fileName = filepath.Base(r.fileList[r.fileIndex])
+	r.eventFileName = r.fileName
+	r.filePosition = binlogFileFirstEventStart
+	return nil
+}
+
+func (r *binlogFileReader) close() {
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+}
+
+// 构造 ROTATE_EVENT, 格式和 主从连接开始的时候 主库发送的 ROTATE_EVENT 一致
+func (r *binlogFileReader) rotateEvent() []byte {
+	header := EventHeader{
+		EventType: ROTATE_EVENT,
+		EventSize: uint32(eventHeaderSize + 8 + len(r.fileName)),
+		Flags:     LOG_EVENT_ARTIFICIAL_F,
+	}
+	if r.parser.binlog_checksum {
+		header.EventSize += 4
+	}
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, header)
+	binary.Write(buf, binary.LittleEndian, uint64(binlogFileFirstEventStart))
+	buf.WriteString(r.fileName)
+	if r.parser.binlog_checksum {
+		binary.Write(buf, binary.LittleEndian, crc32.ChecksumIEEE(buf.Bytes()))
+	}
+	return buf.Bytes()
+}
+
+// 读取一个完整的事件,当前文件读完的时候 返回 io.EOF
+func (r *binlogFileReader) readEvent() (data []byte, err error) {
+	header := make([]byte, eventHeaderSize)
+	if _, err = io.ReadFull(r.bufReader, header); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, fmt.Errorf("binlog file:%s position:%d read event header err:%s", r.fileName, r.filePosition, err)
+	}
+	eventSize := binary.LittleEndian.Uint32(header[9:13])
+	if eventSize < eventHeaderSize {
+		return nil, fmt.Errorf("binlog file:%s position:%d event size:%d error", r.fileName, r.filePosition, eventSize)
+	}
+	data = make([]byte, eventSize)
+	copy(data, header)
+	if _, err = io.ReadFull(r.bufReader, data[eventHeaderSize:]); err != nil {
+		return nil, fmt.Errorf("binlog file:%s position:%d read event body err:%s", r.fileName, r.filePosition, err)
+	}
+	position := r.filePosition
+	r.filePosition += eventSize
+	if EventType(data[4]) == FORMAT_DESCRIPTION_EVENT {
+		// 每个文件的 checksum 配置都可能不一样,以当前文件的 FORMAT_DESCRIPTION_EVENT 为准
+		r.parser.binlog_checksum = getFormatDescriptionChecksum(data)
+	}
+	if r.parser.binlog_checksum && !checkEventChecksum(data) {
+		return nil, fmt.Errorf("binlog file:%s position:%d event checksum error", r.fileName, position)
+	}
+	if EventType(data[4]) == FORMAT_DESCRIPTION_EVENT && r.seekPosition > r.filePosition {
+		if _, err = r.file.Seek(int64(r.seekPosition), io.SeekStart); err != nil {
+			return nil, err
+		}
+		r.bufReader.Reset(r.file)
+		r.filePosition = r.seekPosition
+		r.seekPosition = 0
+	}
+	return data, nil
+}
+
+// 返回 true 表示这个事件不需要解析
+func (r *binlogFileReader) skipEvent(data []byte) bool {
+	eventType := EventType(data[4])
+	switch eventType {
+	case FORMAT_DESCRIPTION_EVENT, PREVIOUS_GTIDS_EVENT, STOP_EVENT:
+		return false
+	case ROTATE_EVENT:
+		end := len(data)
+		if r.parser.binlog_checksum {
+			end -= 4
+		}
+		if end > eventHeaderSize+8 {
+			r.eventFileName = string(data[eventHeaderSize+8 : end])
+		}
+		return false
+	}
+	if r.skipFileName != "" {
+		logPos := binary.LittleEndian.Uint32(data[13:17])
+		if logPos == 0 || compareBinlogPosition(r.eventFileName, logPos, r.skipFileName, r.skipPosition) <= 0 {
+			return true
+		}
+		r.skipFileName = ""
+	}
+	if r.gtidSet == nil {
+		return false
+	}
+	switch eventType {
+	case GTID_EVENT:
+		sid, _ := uuid.FromBytes(data[eventHeaderSize+1 : eventHeaderSize+17])
+		gno := int64(binary.LittleEndian.Uint64(data[eventHeaderSize+17 : eventHeaderSize+25]))
+		r.skipTransaction = !r.gtidSet.Contain(sid.String(), gno)
+	case ANONYMOUS_GTID_EVENT:
+		r.skipTransaction = true
+	}
+	if !r.skipTransaction {
+		return false
+	}
+	// 不在 GTID 集合中的事务 也需要更新表结构历史,否则之后的事务 表结构可能对不上
+	if eventType == QUERY_EVENT && r.parser.schemaHistory != nil {
+		event, _, err := r.parser.parseEvent(data)
+		if err == nil && event != nil && event.Query != "" && event.Query[0:1] != "#" {
+			r.parser.saveSchemaHistoryByDDL(event)
+		}
+	}
+	return true
+}
+
+// MySQL 5.6.1 之后 FORMAT_DESCRIPTION_EVENT 最后是 1 byte checksum 算法 + 4 byte checksum
+func getFormatDescriptionChecksum(data []byte) bool {
+	// header + binlog version + server version + create timestamp + header length + checksum alg + checksum
+	if len(data) < eventHeaderSize+2+50+4+1+5 {
+		return false
+	}
+	version := strings.TrimRight(string(data[eventHeaderSize+2:eventHeaderSize+52]), "\x00")
+	var versionNumber int
+	for _, v := range strings.SplitN(strings.SplitN(version, "-", 2)[0], ".", 3) {
+		n, _ := strconv.Atoi(v)
+		versionNumber = versionNumber*100 + n
+	}
+	if versionNumber < 50601 {
+		return false
+	}
+	return data[len(data)-5] == binlogChecksumAlgCRC32
+}
+
+func checkEventChecksum(data []byte) bool {
+	if len(data) < eventHeaderSize+4 {
+		return false
+	}
+	body := data[:len(data)-4]
+	// binlog 文件关闭的时候 只修改了 FORMAT_DESCRIPTION_EVENT 的 LOG_EVENT_BINLOG_IN_USE_F 标识,没有重新计算 checksum
+	if EventType(data[4]) == FORMAT_DESCRIPTION_EVENT && data[17]&byte(LOG_EVENT_BINLOG_IN_USE_F) != 0 {
+		body = append([]byte{}, body...)
+		body[17] &^= byte(LOG_EVENT_BINLOG_IN_USE_F)
+	}
+	return crc32.ChecksumIEEE(body) == binary.LittleEndian.Uint32(data[len(data)-4:])
+}
+
+// 离线解析本地 binlog 文件,需要在这之前 通过 SetSchemaHistory 设置表结构快照
+// filename,position 为开始位点,filename 为空的时候 从第一个文件开始解析; gtid 不为空的时候,只解析这个 GTID 集合中的事务
+// 所有文件解析完成,或者 到达 maxFileName,maxPosition 之后 状态变成 close
+func (This *BinlogDump) StartDumpBinlogFile(fileList []string, filename string, position uint32, gtid string, result chan error, maxFileName string, maxPosition uint32) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Println("StartDumpBinlogFile err:", err)
+			log.Println(string(debug.Stack()))
+			result <- fmt.Errorf("%v", err)
+		}
+	}()
+	if This.parser == nil {
+		This.parser = newEventParser(This)
+	}
+	This.parser.offline = true
+	This.parser.maxBinlogFileName = maxFileName
+	This.parser.maxBinlogPosition = maxPosition
+	This.parser.binlogFileName = filename
+	This.parser.binlogPosition = position
+	This.parser.callbackErrChan = result
+	This.parser.dataSource = &This.DataSource
+	if This.parser.schemaHistory == nil {
+		result <- fmt.Errorf("binlog file dump schema snapshot is nil")
+		return
+	}
+	reader, err := newBinlogFileReader(This.parser, fileList, filename, position, gtid)
+	if err != nil {
+		result <- err
+		return
+	}
+	defer reader.close()
+	This.Lock()
+	This.parser.dumpBinLogStatus = STATUS_RUNNING
+	This.Unlock()
+	for _, val := range This.OnlyEvent {
+		This.parser.eventDo[int(val)] = true
+	}
+	log.Println(This.DataSource+" start dump binlog file... binlogFileName:", filename, " binlogPosition:", position, " gtid:", gtid)
+	result <- fmt.Errorf("%s", StatusFlagName(STATUS_RUNNING))
+	dumpBinlogPackets(reader, This.parser, This.CallbackFun)
+	This.Lock()
+	This.Status = This.parser.dumpBinLogStatus
+	This.Unlock()
+	if This.Status == STATUS_CLOSED {
+		log.Println(This.DataSource+" dump binlog file finished, binlogFileName:", This.parser.binlogFileName, " binlogPosition:", This.parser.binlogPosition)
+		result <- fmt.Errorf("%s", StatusFlagName(STATUS_CLOSED))
+	}
+}
+
+// 从 binlog 文件的 FORMAT_DESCRIPTION_EVENT 中获取 数据库版本
+func GetBinlogFileVersion(fileName string) (version string, err error) {
+	r := &binlogFileReader{
+		parser:   newEventParser(nil),
+		fileList: []string{fileName},
+	}
+	if err = r.openFile(); err != nil {
+		return
+	}
+	defer r.close()
+	data, err := r.readEvent()
+	if err == io.EOF {
+		return "", fmt.Errorf("%s no event", fileName)
+	}
+	if err != nil {
+		return
+	}
+	if EventType(data[4]) != FORMAT_DESCRIPTION_EVENT {
+		return "", fmt.Errorf("%s first event is not FORMAT_DESCRIPTION_EVENT", fileName)
+	}
+	return strings.TrimRight(string(data[eventHeaderSize+2:eventHeaderSize+52]), "\x00"), nil
+}
@@ -0,0 +1,271 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+const testBinlogFileSid = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+const testBinlogFileSchema = "/*!40101 SET NAMES utf8mb4 */;\n" +
+	"-- Current Database: `test`\n" +
+	"USE `test`;\n" +
+	"DROP TABLE IF EXISTS `t1`;\n" +
+	"CREATE TABLE `t1` (\n" +
+	"  `id` int NOT NULL,\n" +
+	"  `name` varchar(20) DEFAULT NULL COMMENT 'a;b',\n" +
+	"  PRIMARY KEY (`id`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\n"
+
+// 按 binlog 文件格式 写事件, 带 checksum
+type testBinlogFileWriter struct {
+	buf bytes.Buffer
+}
+
+func newTestBinlogFileWriter() *testBinlogFileWriter {
+	w := &testBinlogFileWriter{}
+	w.buf.Write(binlogFileMagic)
+	body := new(bytes.Buffer)
+	binary.Write(body, binary.LittleEndian, uint16(4))
+	version := make([]byte, 50)
+	copy(version, "8.0.32")
+	body.Write(version)
+	binary.Write(body, binary.LittleEndian, uint32(0))
+	body.WriteByte(eventHeaderSize)
+	eventTypeHeaderLengths := make([]byte, 40)
+	eventTypeHeaderLengths[TABLE_MAP_EVENT-1] = 8
+	eventTypeHeaderLengths[WRITE_ROWS_EVENTv2-1] = 10
+	body.Write(eventTypeHeaderLengths)
+	body.WriteByte(binlogChecksumAlgCRC32)
+	start := w.buf.Len()
+	w.writeEvent(FORMAT_DESCRIPTION_EVENT, body.Bytes())
+	// 没有正常关闭的 binlog 文件, LOG_EVENT_BINLOG_IN_USE_F 不参与 checksum 计算
+	w.buf.Bytes()[start+17] |= byte(LOG_EVENT_BINLOG_IN_USE_F)
+	return w
+}
+
+func (w *testBinlogFileWriter) writeEvent(eventType EventType, body []byte) uint32 {
+	eventSize := uint32(eventHeaderSize + len(body) + 4)
+	header := EventHeader{
+		Timestamp: 1700000000,
+		EventType: eventType,
+		ServerId:  1,
+		EventSize: eventSize,
+		LogPos:    uint32(w.buf.Len()) + eventSize,
+	}
+	data := new(bytes.Buffer)
+	binary.Write(data, binary.LittleEndian, header)
+	data.Write(body)
+	binary.Write(data, binary.LittleEndian, crc32.ChecksumIEEE(data.Bytes()))
+	w.buf.Write(data.Bytes())
+	return header.LogPos
+}
+
+// GTID, BEGIN, ROWS_QUERY, TABLE_MAP, WRITE_ROWS, XID 返回 XID 事件的位点
+func (w *testBinlogFileWriter) writeInsertTransaction(gno int64, id int32, name string) uint32 {
+	w.writeBegin(gno)
+	query := fmt.Sprintf("INSERT INTO t1 VALUES (%d,'%s')", id, name)
+	w.writeEvent(ROWS_QUERY_EVENT, append([]byte{byte(len(query))}, query...))
+	w.writeInsertRows(100, "test", "t1", id, name)
+	return w.writeXid(gno)
+}
+
+// GTID, BEGIN
+func (w *testBinlogFileWriter) writeBegin(gno int64) {
+	body := new(bytes.Buffer)
+	body.WriteByte(0)
+	body.Write(uuid.FromStringOrNil(testBinlogFileSid).Bytes())
+	binary.Write(body, binary.LittleEndian, gno)
+	w.writeEvent(GTID_EVENT, body.Bytes())
+
+	body.Reset()
+	binary.Write(body, binary.LittleEndian, uint32(1))
+	binary.Write(body, binary.LittleEndian, uint32(0))
+	body.WriteByte(byte(len("test")))
+	binary.Write(body, binary.LittleEndian, uint16(0))
+	binary.Write(body, binary.LittleEndian, uint16(0))
+	body.WriteString("test")
+	body.WriteByte(0)
+	body.WriteString("BEGIN")
+	w.writeEvent(QUERY_EVENT, body.Bytes())
+}
+
+// TABLE_MAP, WRITE_ROWS, 表结构为 (int, varchar(20))
+func (w *testBinlogFileWriter) writeInsertRows(tableId byte, schemaName, tableName string, id int32, name string) {
+	tableIdData := []byte{tableId, 0, 0, 0, 0, 0}
+	body := new(bytes.Buffer)
+	body.Write(tableIdData)
+	binary.Write(body, binary.LittleEndian, uint16(1))
+	for _, name := range []string{schemaName, tableName} {
+		body.WriteByte(byte(len(name)))
+		body.WriteString(name)
+		body.WriteByte(0)
+	}
+	body.WriteByte(2)
+	body.Write([]byte{byte(FIELD_TYPE_LONG), byte(FIELD_TYPE_VARCHAR)})
+	body.WriteByte(2)
+	binary.Write(body, binary.LittleEndian, uint16(80))
+	body.WriteByte(0x02)
+	w.writeEvent(TABLE_MAP_EVENT, body.Bytes())
+
+	body.Reset()
+	body.Write(tableIdData)
+	binary.Write(body, binary.LittleEndian, uint16(0))
+	binary.Write(body, binary.LittleEndian, uint16(2))
+	body.WriteByte(2)
+	body.WriteByte(0x03)
+	body.WriteByte(0x00)
+	binary.Write(body, binary.LittleEndian, id)
+	body.WriteByte(byte(len(name)))
+	body.WriteString(name)
+	w.writeEvent(WRITE_ROWS_EVENTv2, body.Bytes())
+}
+
+func (w *testBinlogFileWriter) writeXid(gno int64) uint32 {
+	body := new(bytes.Buffer)
+	binary.Write(body, binary.LittleEndian, uint64(gno))
+	return w.writeEvent(XID_EVENT, body.Bytes())
+}
+
+func (w *testBinlogFileWriter) writeRotate(fileName string) {
+	body := new(bytes.Buffer)
+	binary.Write(body, binary.LittleEndian, uint64(4))
+	body.WriteString(fileName)
+	w.writeEvent(ROTATE_EVENT, body.Bytes())
+}
+
+// mysql-bin.000001: gno 1 id 1, mysql-bin.000002: gno 2 id 2
+func newTestBinlogFiles(t *testing.T) (dir string, firstXidPos uint32) {
+	dir = t.TempDir()
+	w := newTestBinlogFileWriter()
+	firstXidPos = w.writeInsertTransaction(1, 1, "a")
+	w.writeRotate("mysql-bin.000002")
+	if err := os.WriteFile(filepath.Join(dir, "mysql-bin.000001"), w.buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w = newTestBinlogFileWriter()
+	w.writeInsertTransaction(2, 2, "b")
+	if err := os.WriteFile(filepath.Join(dir, "mysql-bin.000002"), w.buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "mysql-bin.index"), []byte("./mysql-bin.000001\n./mysql-bin.000002\n"), 0644)
+	return
+}
+
+func testDumpBinlogFile(t *testing.T, fileList []string, fileName string, position uint32, gtid string, maxFileName string, maxPosition uint32) (ids []int32) {
+	schemaHistory := NewSchemaHistory()
+	if err := schemaHistory.ImportSQL(testBinlogFileSchema); err != nil {
+		t.Fatal(err)
+	}
+	callback := func(data *EventReslut) {
+		if data.Header.EventType != WRITE_ROWS_EVENTv2 {
+			return
+		}
+		if data.SchemaName != "test" || data.TableName != "t1" || len(data.Pri) != 1 {
+			t.Fatal("rows event table error:", data.SchemaName, data.TableName, data.Pri)
+		}
+		id := data.Rows[0]["id"].(int32)
+		if data.RowsQuery != fmt.Sprintf("INSERT INTO t1 VALUES (%d,'%s')", id, data.Rows[0]["name"]) {
+			t.Fatal("rows query error:", data.RowsQuery)
+		}
+		ids = append(ids, id)
+	}
+	binlogDump := NewBinlogDump("binlog_file_test", callback, []EventType{WRITE_ROWS_EVENTv2, QUERY_EVENT, XID_EVENT}, nil, nil)
+	binlogDump.SetSchemaHistory(schemaHistory)
+	result := make(chan error, 100)
+	binlogDump.StartDumpBinlogFile(fileList, fileName, position, gtid, result, maxFileName, maxPosition)
+	close(result)
+	var lastStatus string
+	for err := range result {
+		lastStatus = err.Error()
+	}
+	if lastStatus != StatusFlagName(STATUS_CLOSED) {
+		t.Fatal("last status:", lastStatus)
+	}
+	return
+}
+
+func TestGetBinlogFileList(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"mysql-bin.000010", "mysql-bin.000009", "mysql-bin.index"} {
+		os.WriteFile(filepath.Join(dir, name), []byte{}, 0644)
+	}
+	fileList, err := GetBinlogFileList(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fileList) != 2 || filepath.Base(fileList[0]) != "mysql-bin.000009" || filepath.Base(fileList[1]) != "mysql-bin.000010" {
+		t.Fatal("file list error:", fileList)
+	}
+	os.WriteFile(filepath.Join(dir, "relay-bin.000001"), []byte{}, 0644)
+	if _, err = GetBinlogFileList(dir); err == nil {
+		t.Fatal("mysql-bin and relay-bin in the same dir must be error")
+	}
+	fileList, err = GetBinlogFileList(filepath.Join(dir, "relay-bin.000001"))
+	if err != nil || len(fileList) != 1 {
+		t.Fatal("single file error:", fileList, err)
+	}
+}
+
+func TestBinlogDump_StartDumpBinlogFile(t *testing.T) {
+	dir, firstXidPos := newTestBinlogFiles(t)
+	fileList, err := GetBinlogFileList(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := GetBinlogFileVersion(fileList[0])
+	if err != nil || version != "8.0.32" {
+		t.Fatal("binlog file version error:", version, err)
+	}
+
+	if ids := testDumpBinlogFile(t, fileList, "", 0, "", "", 0); len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Fatal("dump all files error:", ids)
+	}
+	// 从第一个事务之后开始
+	if ids := testDumpBinlogFile(t, fileList, "mysql-bin.000001", firstXidPos, "", "", 0); len(ids) != 1 || ids[0] != 2 {
+		t.Fatal("dump from position error:", ids)
+	}
+	// 到第二个文件开始
+	if ids := testDumpBinlogFile(t, fileList, "", 0, "", "mysql-bin.000002", 4); len(ids) != 1 || ids[0] != 1 {
+		t.Fatal("dump to max position error:", ids)
+	}
+	// 只解析 GTID 集合中的事务
+	if ids := testDumpBinlogFile(t, fileList, "", 0, testBinlogFileSid+":2-10", "", 0); len(ids) != 1 || ids[0] != 2 {
+		t.Fatal("dump gtid range error:", ids)
+	}
+	// 开始位点的文件不在本地, 比如 relay log, 跳过这个位点之前的事件
+	if ids := testDumpBinlogFile(t, fileList[1:], "mysql-bin.000001", firstXidPos, "", "", 0); len(ids) != 1 || ids[0] != 2 {
+		t.Fatal("dump skip position error:", ids)
+	}
+}
+
+func TestBinlogFileReader_Checksum(t *testing.T) {
+	dir, _ := newTestBinlogFiles(t)
+	fileName := filepath.Join(dir, "mysql-bin.000001")
+	data, _ := os.ReadFile(fileName)
+	// 修改 BEGIN 中的一个字节
+	i := bytes.Index(data, []byte("BEGIN"))
+	data[i] = 'b'
+	os.WriteFile(fileName, data, 0644)
+
+	r, err := newBinlogFileReader(newEventParser(NewBinlogDump("binlog_file_test", nil, nil, nil, nil)), []string{fileName}, "", 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.close()
+	for {
+		if _, err = r.readPacket(); err != nil {
+			break
+		}
+	}
+	if err == errBinlogFileEnd {
+		t.Fatal("checksum error not found")
+	}
+}
@@ -0,0 +1,45 @@
+package mysql
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+双向同步 防回环
+A→B, B→A 同时同步的时候, 写入目标库的数据 会被反方向的数据源 再次解析出来 同步回去
+
+写入方(plugin mysql) 配置了 标记表 的时候, 每个事务 开始之后 先更新一次 标记表, DDL 语句 带上 LoopMarkerQueryComment 注释
+数据源 设置了 相同的标记表 之后
+
+	解析到 标记表 的 TABLE_MAP_EVENT, 当前事务中 剩下的 row 事件 全部丢弃
+	带有 LoopMarkerQueryComment 注释的 DDL 丢弃, 表结构历史 和 表结构缓存 照常更新
+
+只支持 binlog_format = ROW
+*/
+
+// Bifrost 写入的 DDL 中带的注释
+const LoopMarkerQueryComment = "/*bifrost_loop_marker*/"
+
+// 设置 标记表, 格式为 schema.table, 为空的时候 不过滤, 需要在 StartDumpBinlog 之前设置
+func (This *BinlogDump) SetLoopMarkerTable(loopMarkerTable string) error {
+	loopMarkerTable = strings.TrimSpace(loopMarkerTable)
+	if loopMarkerTable != "" {
+		i := strings.Index(loopMarkerTable, ".")
+		if i <= 0 || i == len(loopMarkerTable)-1 {
+			return fmt.Errorf("loop marker table:%s must be schema.table", loopMarkerTable)
+		}
+	}
+	This.Lock()
+	defer This.Unlock()
+	This.parser.loopMarkerTable = loopMarkerTable
+	return nil
+}
+
+func (parser *eventParser) isLoopMarkerTable(schemaName, tableName string) bool {
+	return parser.loopMarkerTable != "" && schemaName+"."+tableName == parser.loopMarkerTable
+}
+
+func (parser *eventParser) isLoopMarkerQuery(query string) bool {
+	return parser.loopMarkerTable != "" && strings.Contains(query, LoopMarkerQueryComment)
+}
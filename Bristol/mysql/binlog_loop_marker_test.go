@@ -0,0 +1,114 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testLoopMarkerSchema = testBinlogFileSchema +
+	"USE `bifrost`;\n" +
+	"CREATE TABLE `bifrost_loop_marker` (\n" +
+	"  `id` int NOT NULL,\n" +
+	"  `name` varchar(20) DEFAULT NULL,\n" +
+	"  PRIMARY KEY (`id`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\n"
+
+func (w *testBinlogFileWriter) writeQuery(query string) {
+	body := new(bytes.Buffer)
+	binary.Write(body, binary.LittleEndian, uint32(1))
+	binary.Write(body, binary.LittleEndian, uint32(0))
+	body.WriteByte(byte(len("test")))
+	binary.Write(body, binary.LittleEndian, uint16(0))
+	binary.Write(body, binary.LittleEndian, uint16(0))
+	body.WriteString("test")
+	body.WriteByte(0)
+	body.WriteString(query)
+	w.writeEvent(QUERY_EVENT, body.Bytes())
+}
+
+// gno 1 id 1 正常写入, gno 2 id 2 Bifrost 写入, gno 3 id 3 正常写入, gno 4 Bifrost 写入的 DDL
+func newTestLoopMarkerBinlogFile(t *testing.T) []string {
+	w := newTestBinlogFileWriter()
+	w.writeInsertTransaction(1, 1, "a")
+
+	w.writeBegin(2)
+	w.writeInsertRows(101, "bifrost", "bifrost_loop_marker", 1, "")
+	w.writeInsertRows(100, "test", "t1", 2, "b")
+	w.writeXid(2)
+
+	w.writeBegin(3)
+	w.writeInsertRows(100, "test", "t1", 3, "c")
+	w.writeXid(3)
+
+	w.writeBegin(4)
+	w.writeQuery("ALTER TABLE t1 ADD COLUMN c int " + LoopMarkerQueryComment)
+
+	fileName := filepath.Join(t.TempDir(), "mysql-bin.000001")
+	if err := os.WriteFile(fileName, w.buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return []string{fileName}
+}
+
+func testDumpLoopMarkerBinlogFile(t *testing.T, loopMarkerTable string) (ids []int32, queryList []string, schemaHistory *SchemaHistory) {
+	schemaHistory = NewSchemaHistory()
+	if err := schemaHistory.ImportSQL(testLoopMarkerSchema); err != nil {
+		t.Fatal(err)
+	}
+	callback := func(data *EventReslut) {
+		switch data.Header.EventType {
+		case WRITE_ROWS_EVENTv2:
+			if data.TableName == "t1" {
+				ids = append(ids, data.Rows[0]["id"].(int32))
+			}
+		case QUERY_EVENT:
+			if data.Query != "BEGIN" && data.Query != "COMMIT" {
+				queryList = append(queryList, data.Query)
+			}
+		}
+	}
+	binlogDump := NewBinlogDump("binlog_loop_marker_test", callback, []EventType{WRITE_ROWS_EVENTv2, QUERY_EVENT, XID_EVENT}, nil, nil)
+	binlogDump.SetSchemaHistory(schemaHistory)
+	if err := binlogDump.SetLoopMarkerTable(loopMarkerTable); err != nil {
+		t.Fatal(err)
+	}
+	result := make(chan error, 100)
+	binlogDump.StartDumpBinlogFile(newTestLoopMarkerBinlogFile(t), "", 0, "", result, "", 0)
+	close(result)
+	return
+}
+
+func TestBinlogDump_SetLoopMarkerTable(t *testing.T) {
+	binlogDump := NewBinlogDump("binlog_loop_marker_test", nil, nil, nil, nil)
+	for _, loopMarkerTable := range []string{"bifrost_loop_marker", ".bifrost_loop_marker", "bifrost."} {
+		if binlogDump.SetLoopMarkerTable(loopMarkerTable) == nil {
+			t.Fatal("loop marker table:", loopMarkerTable, "must be error")
+		}
+	}
+	if err := binlogDump.SetLoopMarkerTable(""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBinlogDump_LoopMarker(t *testing.T) {
+	ids, queryList, _ := testDumpLoopMarkerBinlogFile(t, "")
+	if len(ids) != 3 || len(queryList) != 1 {
+		t.Fatal("without loop marker table error:", ids, queryList)
+	}
+
+	ids, queryList, schemaHistory := testDumpLoopMarkerBinlogFile(t, "bifrost.bifrost_loop_marker")
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 3 {
+		t.Fatal("loop transaction not skipped:", ids)
+	}
+	if len(queryList) != 0 {
+		t.Fatal("loop ddl not skipped:", queryList)
+	}
+	// 丢弃的 DDL 也要更新表结构历史
+	columnList, _ := schemaHistory.GetLastTableColumns("test", "t1")
+	if len(columnList) != 3 {
+		t.Fatal("schema history not updated:", len(columnList))
+	}
+}
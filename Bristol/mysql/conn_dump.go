@@ -21,6 +21,10 @@ func (mc *mysqlConn) DumpBinlog(parser *eventParser, callbackFun callback) (driv
 	}()
 	ServerId := uint32(parser.ServerId) // Must be non-zero to avoid getting EOF packet
 	flags := uint16(0)
+	// 解析过 FORMAT_DESCRIPTION_EVENT 之后才知道是不是 MariaDB, 第一次连接的时候 不会下发 ANNOTATE_ROWS_EVENT
+	if parser.dbType == DB_TYPE_MARIADB {
+		flags |= BINLOG_SEND_ANNOTATE_ROWS_EVENT
+	}
 	e := mc.writeCommandPacket(COM_BINLOG_DUMP, parser.binlogPosition, flags, ServerId, parser.binlogFileName)
 	if e != nil {
 		parser.callbackErrChan <- e
@@ -85,7 +89,8 @@ func (mc *mysqlConn) DumpBinlogMariaDBGtid(parser *eventParser, callbackFun call
 		return nil, fmt.Errorf("failed to set @slave_gtid_strict_mode=1: %v", err)
 	}
 	ServerId := uint32(parser.ServerId)
-	flags := uint16(0)
+	// 需要 MariaDB 下发 ANNOTATE_ROWS_EVENT, 主库没有开启 binlog_annotate_row_events 的时候 也不会有
+	flags := uint16(BINLOG_SEND_ANNOTATE_ROWS_EVENT)
 	err = mc.writeCommandPacket(COM_BINLOG_DUMP, uint32(0), flags, ServerId, "")
 	if err != nil {
 		parser.callbackErrChan <- err
@@ -95,8 +100,20 @@ func (mc *mysqlConn) DumpBinlogMariaDBGtid(parser *eventParser, callbackFun call
 }
 
 func (mc *mysqlConn) DumpBinlog0(parser *eventParser, callbackFun callback) (driver.Rows, error) {
+	return dumpBinlogPackets(mc, parser, callbackFun)
+}
+
+// binlog 事件的来源, 主从连接 或者 本地 binlog 文件
+// 返回的数据 和 主从连接的包格式一致, 第一个字节为 0 表示后面是一个完整的事件
+type binlogPacketReader interface {
+	readPacket() ([]byte, error)
+}
+
+func dumpBinlogPackets(reader binlogPacketReader, parser *eventParser, callbackFun callback) (driver.Rows, error) {
 	var isDDL bool
 	var commitEventOk bool
+	// 重连之后 从外层事件的边界重新开始解析,上一次连接没有解析完的压缩事务事件 丢弃
+	parser.payloadEventList = nil
 	for {
 		parser.binlogDump.RLock()
 		if parser.dumpBinLogStatus != STATUS_RUNNING {
@@ -113,14 +130,29 @@ func (mc *mysqlConn) DumpBinlog0(parser *eventParser, callbackFun callback) (dri
 			}
 		}
 		parser.binlogDump.RUnlock()
-		pkt, e := mc.readPacket()
-		if e != nil {
-			parser.callbackErrChan <- e
-			return nil, e
-		} else if pkt[0] == 254 { // EOF packet
-			parser.callbackErrChan <- fmt.Errorf("EOF packet")
-			break
-			//continue
+		var pkt []byte
+		var e error
+		// 压缩事务中解压出来的事件,解析完之后 再读取下一个包
+		payloadEventData := parser.nextPayloadEvent()
+		if payloadEventData != nil {
+			pkt = append([]byte{0}, payloadEventData...)
+		} else {
+			pkt, e = reader.readPacket()
+			if e == errBinlogFileEnd {
+				// 本地 binlog 文件 已经全部解析完成
+				parser.binlogDump.Lock()
+				parser.dumpBinLogStatus = STATUS_CLOSED
+				parser.binlogDump.Unlock()
+				break
+			}
+			if e != nil {
+				parser.callbackErrChan <- e
+				return nil, e
+			} else if pkt[0] == 254 { // EOF packet
+				parser.callbackErrChan <- fmt.Errorf("EOF packet")
+				break
+				//continue
+			}
 		}
 		if pkt[0] == 0 {
 			isDDL = false
@@ -132,7 +164,11 @@ func (mc *mysqlConn) DumpBinlog0(parser *eventParser, callbackFun callback) (dri
 						log.Println(string(debug.Stack()))
 					}
 				}()
-				event, _, e = parser.parseEvent(pkt[1:])
+				if payloadEventData != nil {
+					event, _, e = parser.parseEventWithoutChecksum(pkt[1:])
+				} else {
+					event, _, e = parser.parseEvent(pkt[1:])
+				}
 			}()
 			if e != nil {
 				//假如解析异常 ,就直接close掉
@@ -158,7 +194,7 @@ func (mc *mysqlConn) DumpBinlog0(parser *eventParser, callbackFun callback) (dri
 			//这里要判断一下如果是row事件
 			//在map event的时候已经判断过了是否要过滤，所以判断一下 parser.filterNextRowEvent 是否为true
 			case WRITE_ROWS_EVENTv0, WRITE_ROWS_EVENTv1, WRITE_ROWS_EVENTv2, UPDATE_ROWS_EVENTv0, UPDATE_ROWS_EVENTv1, UPDATE_ROWS_EVENTv2, DELETE_ROWS_EVENTv0, DELETE_ROWS_EVENTv1, DELETE_ROWS_EVENTv2:
-				if parser.filterNextRowEvent == true {
+				if parser.filterNextRowEvent == true || parser.skipLoopTransaction {
 					continue
 				}
 				break
@@ -179,6 +215,11 @@ func (mc *mysqlConn) DumpBinlog0(parser *eventParser, callbackFun callback) (dri
 					continue
 				}
 
+				// DDL 对应的表结构变更，需要在过滤之前处理，未同步的表 也需要记录表结构历史
+				if parser.schemaHistory != nil {
+					parser.saveSchemaHistoryByDDL(event)
+				}
+
 				//only return replicateDoDb, any sql may be use db.table query
 				var SchemaName, tableName string
 				var noReloadTableInfo bool
@@ -196,11 +237,15 @@ func (mc *mysqlConn) DumpBinlog0(parser *eventParser, callbackFun callback) (dri
 					if noReloadTableInfo {
 						// 假如 是rename,drop table 等操作 操作的 ddl,需要将 SchemaName,TableName 对应的缓存数据删除，因为表名变了，TableId 也变了
 						parser.delTableId(event.SchemaName, event.TableName)
-					} else {
+					} else if parser.schemaHistory == nil {
 						if tableId, err := parser.GetTableId(event.SchemaName, event.TableName); err == nil {
 							parser.GetTableSchema(tableId, event.SchemaName, event.TableName)
 						}
 					}
+					// Bifrost 自己写入的 DDL, 表结构已经更新, 不再返回给上一层
+					if parser.isLoopMarkerQuery(event.Query) {
+						continue
+					}
 					break
 				}
 				// 假如 drop database schemaName 这样的语句，只有 SchemaName，而没有 TableName的，则匹配是否要过滤整个库
@@ -210,6 +255,9 @@ func (mc *mysqlConn) DumpBinlog0(parser *eventParser, callbackFun callback) (dri
 						continue
 					}
 				}
+				if parser.isLoopMarkerQuery(event.Query) {
+					continue
+				}
 				commitEventOk = true
 				break
 			case XID_EVENT:
@@ -177,8 +177,17 @@ const (
 	TRANSACTION_CONTEXT_EVENT                  // 36
 	VIEW_CHANGE_EVENT                          // 37
 	XA_PREPARE_LOG_EVENT                       // 38
+	PARTIAL_UPDATE_ROWS_EVENT                  // 39
+	TRANSACTION_PAYLOAD_EVENT                  // 40
+	HEARTBEAT_LOG_EVENT_V2                     // 41
 )
 
+// PARTIAL_UPDATE_ROWS_EVENT after 数据中的 value_options
+const PARTIAL_JSON_UPDATES = 1
+
+// MariaDB COM_BINLOG_DUMP flags, 设置了才会下发 MARIADB_ANNOTATE_ROWS_EVENT
+const BINLOG_SEND_ANNOTATE_ROWS_EVENT = 2
+
 const (
 	// MariaDB event starts from 160
 	MARIADB_ANNOTATE_ROWS_EVENT EventType = 160 + iota
@@ -94,6 +94,18 @@ func (header *EventHeader) EventName() string {
 		return "ANONYMOUS_GTID_EVENT"
 	case PREVIOUS_GTIDS_EVENT:
 		return "PREVIOUS_GTIDS_EVENT"
+	case TRANSACTION_CONTEXT_EVENT:
+		return "TRANSACTION_CONTEXT_EVENT"
+	case VIEW_CHANGE_EVENT:
+		return "VIEW_CHANGE_EVENT"
+	case XA_PREPARE_LOG_EVENT:
+		return "XA_PREPARE_LOG_EVENT"
+	case PARTIAL_UPDATE_ROWS_EVENT:
+		return "PARTIAL_UPDATE_ROWS_EVENT"
+	case TRANSACTION_PAYLOAD_EVENT:
+		return "TRANSACTION_PAYLOAD_EVENT"
+	case HEARTBEAT_LOG_EVENT_V2:
+		return "HEARTBEAT_LOG_EVENT_V2"
 	}
 	return fmt.Sprintf("%d", header.EventType)
 }
@@ -21,6 +21,8 @@ type RowsEvent struct {
 	columnsPresentBitmap1 Bitfield
 	columnsPresentBitmap2 Bitfield
 	rows                  []map[string]interface{}
+	presentColumns        [][]string               // 和 rows 一一对应, binlog_row_image = MINIMAL/NOBLOB 时每行实际存在的字段; 所有字段都存在时为 nil
+	jsonDiffs             []map[string][]*JsonDiff // 和 rows 一一对应, PARTIAL_UPDATE_ROWS_EVENT 中 json 字段的修改操作; 没有的时候为 nil
 }
 
 func (parser *eventParser) parseRowsEvent(buf *bytes.Buffer) (event *RowsEvent, err error) {
@@ -39,7 +41,7 @@ func (parser *eventParser) parseRowsEvent(buf *bytes.Buffer) (event *RowsEvent,
 	event.tableId, err = readFixedLengthInteger(buf, tableIdSize)
 	err = binary.Read(buf, binary.LittleEndian, &event.flags)
 	switch event.header.EventType {
-	case UPDATE_ROWS_EVENTv2, WRITE_ROWS_EVENTv2, DELETE_ROWS_EVENTv2:
+	case UPDATE_ROWS_EVENTv2, WRITE_ROWS_EVENTv2, DELETE_ROWS_EVENTv2, PARTIAL_UPDATE_ROWS_EVENT:
 		//err = binary.Read(buf, binary.LittleEndian, &event.flags)
 		extraDataLength, _ := readFixedLengthInteger(buf, 2)
 		buf.Next(int(extraDataLength) - 2)
@@ -50,38 +52,197 @@ func (parser *eventParser) parseRowsEvent(buf *bytes.Buffer) (event *RowsEvent,
 
 	event.columnsPresentBitmap1 = Bitfield(buf.Next(int((columnCount + 7) / 8)))
 	switch event.header.EventType {
-	case UPDATE_ROWS_EVENTv1, UPDATE_ROWS_EVENTv2:
+	case UPDATE_ROWS_EVENTv1, UPDATE_ROWS_EVENTv2, PARTIAL_UPDATE_ROWS_EVENT:
 		event.columnsPresentBitmap2 = Bitfield(buf.Next(int((columnCount + 7) / 8)))
 	}
 	//假如 map event 已经过滤了当前库，则直接不再解析
-	if parser.filterNextRowEvent == true {
+	if parser.filterNextRowEvent == true || parser.skipLoopTransaction {
 		return
 	}
-	for buf.Len() > 0 {
+	tableInfo, ok := parser.tableSchemaMap[event.tableId]
+	if !ok {
+		if tableMap, ok := parser.tableMap[event.tableId]; ok {
+			err = fmt.Errorf("table schema not found, tableId:%d table:%s.%s", event.tableId, tableMap.schemaName, tableMap.tableName)
+		} else {
+			err = fmt.Errorf("table schema not found, tableId:%d", event.tableId)
+		}
+		return
+	}
+	tableSchemaMap := tableInfo.ColumnSchemaTypeList
+	// update 事件 before 数据对应 columnsPresentBitmap1, after 数据对应 columnsPresentBitmap2
+	// binlog_row_image = FULL 的时候 所有字段都存在, presentColumns 为 nil
+	presentColumns1 := getPresentColumns(event.columnsPresentBitmap1, int(columnCount), tableSchemaMap)
+	var presentColumns2 []string
+	if event.columnsPresentBitmap2 != nil {
+		presentColumns2 = getPresentColumns(event.columnsPresentBitmap2, int(columnCount), tableSchemaMap)
+	}
+	isPartial := presentColumns1 != nil || presentColumns2 != nil
+	// before 数据中没有 json 字段, diff 无法合并的 after 数据, 这些 json 字段只能当作缺失的字段
+	absentJsonColumns := make(map[int][]string, 0)
+	for i := 0; buf.Len() > 0; i++ {
 		var row map[string]interface{}
-		row, err = parser.parseEventRow(buf, parser.tableMap[event.tableId], parser.tableSchemaMap[event.tableId].ColumnSchemaTypeList)
+		var partialJsonColumns map[int]bool
+		columnsPresentBitmap, presentColumns := event.columnsPresentBitmap1, presentColumns1
+		if event.columnsPresentBitmap2 != nil && i%2 == 1 {
+			columnsPresentBitmap, presentColumns = event.columnsPresentBitmap2, presentColumns2
+			if event.header.EventType == PARTIAL_UPDATE_ROWS_EVENT {
+				if partialJsonColumns, err = readPartialJsonColumns(buf, parser.tableMap[event.tableId]); err != nil {
+					log.Println("event row parser partial json err:", err)
+					return
+				}
+			}
+		}
+		row, err = parser.parseEventRow(buf, parser.tableMap[event.tableId], tableSchemaMap, columnsPresentBitmap, partialJsonColumns)
 		if err != nil {
 			log.Println("event row parser err:", err)
 			return
 		}
+		if len(partialJsonColumns) > 0 {
+			var absentColumns []string
+			if absentColumns, err = event.applyJsonDiffs(row, partialJsonColumns, tableSchemaMap); err != nil {
+				log.Println("event row apply json diff err:", err)
+				return
+			}
+			if len(absentColumns) > 0 {
+				absentJsonColumns[i] = absentColumns
+			}
+		} else if event.jsonDiffs != nil {
+			event.jsonDiffs = append(event.jsonDiffs, nil)
+		}
 		event.rows = append(event.rows, row)
+		if isPartial {
+			event.presentColumns = append(event.presentColumns, presentColumns)
+		}
 	}
+	if len(absentJsonColumns) > 0 {
+		event.removePresentColumns(absentJsonColumns, int(columnCount), tableSchemaMap)
+	}
+	return
+}
 
+/*
+PARTIAL_UPDATE_ROWS_EVENT 的 after 数据前面有
+
+	length encoded int value_options
+	value_options & PARTIAL_JSON_UPDATES 的时候, 表中每个 json 字段占 1 bit, 为 1 表示这个字段只记录了 diff
+
+返回 只记录了 diff 的 json 字段下标
+*/
+func readPartialJsonColumns(buf *bytes.Buffer, tableMap *TableMapEvent) (partialJsonColumns map[int]bool, err error) {
+	var valueOptions uint64
+	if valueOptions, _, err = readLengthEncodedInt(buf); err != nil {
+		return
+	}
+	if valueOptions&PARTIAL_JSON_UPDATES == 0 {
+		return
+	}
+	jsonColumns := make([]int, 0)
+	for i, columnType := range tableMap.columnTypes {
+		if columnType == FIELD_TYPE_JSON {
+			jsonColumns = append(jsonColumns, i)
+		}
+	}
+	partialBitmap := Bitfield(buf.Next((len(jsonColumns) + 7) / 8))
+	partialJsonColumns = make(map[int]bool, 0)
+	for n, i := range jsonColumns {
+		if partialBitmap.isSet(uint(n)) {
+			partialJsonColumns[i] = true
+		}
+	}
 	return
 }
 
-func (parser *eventParser) parseEventRow(buf *bytes.Buffer, tableMap *TableMapEvent, tableSchemaMap []*ColumnInfo) (row map[string]interface{}, e error) {
+// 将 after 数据中 json 字段的 diff 应用到 before 数据上, 得到完整的 after 数据
+// before 数据中没有这个 json 字段的时候(binlog_row_image = MINIMAL), after 数据中删除这个字段, 只保留 diff
+func (event *RowsEvent) applyJsonDiffs(row map[string]interface{}, partialJsonColumns map[int]bool, tableSchemaMap []*ColumnInfo) (absentColumns []string, err error) {
+	before := event.rows[len(event.rows)-1]
+	if event.jsonDiffs == nil {
+		event.jsonDiffs = make([]map[string][]*JsonDiff, len(event.rows))
+	}
+	rowJsonDiffs := make(map[string][]*JsonDiff, 0)
+	for i := range partialJsonColumns {
+		columnName := tableSchemaMap[i].COLUMN_NAME
+		diffs, ok := row[columnName].([]*JsonDiff)
+		if !ok {
+			continue
+		}
+		rowJsonDiffs[columnName] = diffs
+		beforeVal, ok := before[columnName]
+		if !ok {
+			delete(row, columnName)
+			absentColumns = append(absentColumns, columnName)
+			continue
+		}
+		if row[columnName], err = apply_json_diffs(beforeVal, diffs); err != nil {
+			return nil, fmt.Errorf("columnName:%s %s", columnName, err)
+		}
+	}
+	event.jsonDiffs = append(event.jsonDiffs, rowJsonDiffs)
+	return
+}
+
+// 将 json 字段从对应行 的 presentColumns 中删除
+func (event *RowsEvent) removePresentColumns(absentColumnsMap map[int][]string, columnsCount int, tableSchemaMap []*ColumnInfo) {
+	if event.presentColumns == nil {
+		allColumns := make([]string, 0, columnsCount)
+		for i := 0; i < columnsCount && i < len(tableSchemaMap); i++ {
+			allColumns = append(allColumns, tableSchemaMap[i].COLUMN_NAME)
+		}
+		event.presentColumns = make([][]string, len(event.rows))
+		for i := range event.presentColumns {
+			event.presentColumns[i] = allColumns
+		}
+	}
+	for i, absentColumns := range absentColumnsMap {
+		presentColumns := make([]string, 0, len(event.presentColumns[i]))
+	LOOP:
+		for _, name := range event.presentColumns[i] {
+			for _, absentName := range absentColumns {
+				if name == absentName {
+					continue LOOP
+				}
+			}
+			presentColumns = append(presentColumns, name)
+		}
+		event.presentColumns[i] = presentColumns
+	}
+}
+
+// 获取 columnsPresentBitmap 中存在的字段列表, 所有字段都存在的时候返回 nil
+func getPresentColumns(columnsPresentBitmap Bitfield, columnsCount int, tableSchemaMap []*ColumnInfo) (presentColumns []string) {
+	if columnsPresentBitmap.count(columnsCount) == columnsCount {
+		return nil
+	}
+	presentColumns = make([]string, 0)
+	for i := 0; i < columnsCount && i < len(tableSchemaMap); i++ {
+		if columnsPresentBitmap.isSet(uint(i)) {
+			presentColumns = append(presentColumns, tableSchemaMap[i].COLUMN_NAME)
+		}
+	}
+	return
+}
+
+// binlog_row_image = MINIMAL/NOBLOB 的时候, 不在 columnsPresentBitmap 中的字段 binlog 里没有数据, 也不会写入 row 中, 以便和 NULL 值区分开
+// partialJsonColumns 中的 json 字段, 解析出来的是 []*JsonDiff
+func (parser *eventParser) parseEventRow(buf *bytes.Buffer, tableMap *TableMapEvent, tableSchemaMap []*ColumnInfo, columnsPresentBitmap Bitfield, partialJsonColumns map[int]bool) (row map[string]interface{}, e error) {
 	columnsCount := len(tableMap.columnTypes)
 	row = make(map[string]interface{})
-	bitfieldSize := (columnsCount + 7) / 8
+	// null bitmap 只包含存在的字段
+	bitfieldSize := (columnsPresentBitmap.count(columnsCount) + 7) / 8
 	nullBitMap := Bitfield(buf.Next(bitfieldSize))
 	if columnsCount > len(tableSchemaMap) {
 		log.Println("parseEventRow len(tableSchemaMap)=", len(tableSchemaMap), " < ", "columnsCount:", columnsCount, " tableMap:", *tableMap)
 	}
+	var nullIndex uint
 	for i := 0; i < columnsCount; i++ {
+		if !columnsPresentBitmap.isSet(uint(i)) {
+			continue
+		}
 		column_name := tableSchemaMap[i].COLUMN_NAME
 		//log.Println("column_name:",column_name,tableSchemaMap[i].DATA_TYPE)
-		if nullBitMap.isSet(uint(i)) {
+		isNull := nullBitMap.isSet(nullIndex)
+		nullIndex++
+		if isNull {
 			row[column_name] = nil
 			continue
 		}
@@ -585,7 +746,11 @@ func (parser *eventParser) parseEventRow(buf *bytes.Buffer, tableMap *TableMapEv
 			var length uint64
 			length, e = readFixedLengthInteger(buf, int(tableMap.columnMetaData[i].length_size))
 			data := buf.Next(int(length))
-			row[column_name], e = get_field_json_data(data, int64(length))
+			if partialJsonColumns[i] {
+				row[column_name], e = get_field_json_diff(data)
+			} else {
+				row[column_name], e = get_field_json_data(data, int64(length))
+			}
 			break
 		default:
 			return nil, fmt.Errorf("schemaName:%s tableName:%s columnName:%s Unknown FieldType %d", tableMap.schemaName, tableMap.tableName, column_name, tableMap.columnTypes[i])
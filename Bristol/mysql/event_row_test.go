@@ -0,0 +1,63 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// binlog_row_image = MINIMAL 的 update 事件, before 只有主键, after 只有修改的字段
+func TestEventParser_parseEventRow_Minimal(t *testing.T) {
+	parser := newEventParser(nil)
+	tableMap := &TableMapEvent{
+		columnTypes: []FieldType{FIELD_TYPE_LONG, FIELD_TYPE_VARCHAR, FIELD_TYPE_LONG},
+		columnMetaData: []*ColumnType{
+			{column_type: FIELD_TYPE_LONG},
+			{column_type: FIELD_TYPE_VARCHAR, max_length: 20},
+			{column_type: FIELD_TYPE_LONG},
+		},
+	}
+	tableSchemaMap := []*ColumnInfo{
+		{COLUMN_NAME: "id"},
+		{COLUMN_NAME: "name"},
+		{COLUMN_NAME: "age"},
+	}
+	beforeBitmap := Bitfield{0x01}
+	afterBitmap := Bitfield{0x06}
+
+	buf := new(bytes.Buffer)
+	// before: null bitmap 只有 1 个字段
+	buf.WriteByte(0x00)
+	binary.Write(buf, binary.LittleEndian, int32(1))
+	// after: name 为 NULL, age = 10
+	buf.WriteByte(0x01)
+	binary.Write(buf, binary.LittleEndian, int32(10))
+
+	before, err := parser.parseEventRow(buf, tableMap, tableSchemaMap, beforeBitmap, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := parser.parseEventRow(buf, tableMap, tableSchemaMap, afterBitmap, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("buf.Len():%d != 0", buf.Len())
+	}
+	if len(before) != 1 || before["id"] != int32(1) {
+		t.Fatalf("before:%+v", before)
+	}
+	if v, ok := after["name"]; !ok || v != nil {
+		t.Fatalf("after name:%+v", after)
+	}
+	if _, ok := after["id"]; ok || after["age"] != int32(10) {
+		t.Fatalf("after:%+v", after)
+	}
+
+	if presentColumns := getPresentColumns(afterBitmap, 3, tableSchemaMap); len(presentColumns) != 2 || presentColumns[0] != "name" || presentColumns[1] != "age" {
+		t.Fatalf("presentColumns:%+v", presentColumns)
+	}
+	if presentColumns := getPresentColumns(Bitfield{0x07}, 3, tableSchemaMap); presentColumns != nil {
+		t.Fatalf("full row image presentColumns:%+v != nil", presentColumns)
+	}
+}
@@ -0,0 +1,27 @@
+// documentation:
+// https://dev.mysql.com/doc/dev/mysql-server/latest/classmysql_1_1binlog_1_1event_1_1Rows__query__event.html
+// https://mariadb.com/kb/en/annotate_rows_event/
+package mysql
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// binlog_rows_query_log_events = ON 时, 每个 DML 语句的 row event 之前 记录原始 SQL
+type RowsQueryEvent struct {
+	header EventHeader
+	query  string
+}
+
+func (parser *eventParser) parseRowsQueryEvent(buf *bytes.Buffer) (event *RowsQueryEvent, err error) {
+	event = new(RowsQueryEvent)
+	err = binary.Read(buf, binary.LittleEndian, &event.header)
+	// MySQL 第一个字节为 SQL 长度, 超过 255 的时候 只保留了低 8 位, 所以直接取剩下的全部内容
+	// MariaDB ANNOTATE_ROWS_EVENT 整个 body 都是 SQL
+	if event.header.EventType == ROWS_QUERY_EVENT {
+		buf.Next(1)
+	}
+	event.query = buf.String()
+	return
+}
@@ -0,0 +1,37 @@
+package mysql
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestEventParser_RowsQueryEvent(t *testing.T) {
+	dataSource := "rows_query_test"
+	parser := newEventParser(NewBinlogDump(dataSource, nil, nil, nil, nil))
+	parser.dataSource = &dataSource
+	parser.gtidSetInfo = NewMySQLGtidSet("")
+
+	query := "UPDATE t1 SET name='a' WHERE id IN (1,2)"
+	// MySQL 第一个字节为长度
+	event, _, err := parser.parseEventWithoutChecksum(newTestEventData(ROWS_QUERY_EVENT, 100, append([]byte{byte(len(query))}, query...)))
+	if err != nil || event.Query != query || parser.rowsQuery != query {
+		t.Fatal("rows query event error:", event.Query, err)
+	}
+	xid := make([]byte, 8)
+	binary.LittleEndian.PutUint64(xid, 1)
+	if _, _, err = parser.parseEventWithoutChecksum(newTestEventData(XID_EVENT, 200, xid)); err != nil || parser.rowsQuery != "" {
+		t.Fatal("rows query must be reset after xid event")
+	}
+
+	// MariaDB 整个 body 都是 SQL
+	event, _, err = parser.parseEventWithoutChecksum(newTestEventData(MARIADB_ANNOTATE_ROWS_EVENT, 300, []byte(query)))
+	if err != nil || event.Query != query || parser.rowsQuery != query {
+		t.Fatal("mariadb annotate rows event error:", event.Query, err)
+	}
+
+	// header 不完整, 跳过这个事件
+	event, _, err = parser.parseEventWithoutChecksum(newTestEventData(ROWS_QUERY_EVENT, 400, nil)[:10])
+	if err != nil || event != nil || parser.rowsQuery != "" {
+		t.Fatal("bad rows query event must be skipped:", event, err)
+	}
+}
@@ -15,6 +15,16 @@ func (bits Bitfield) isSet(index uint) bool {
 	return bits[index/8]&(1<<(index%8)) != 0
 }
 
+// 前 n 位中被设置的位数
+func (bits Bitfield) count(n int) (c int) {
+	for i := 0; i < n; i++ {
+		if bits.isSet(uint(i)) {
+			c++
+		}
+	}
+	return
+}
+
 type ColumnType struct {
 	column_type FieldType
 	name        string
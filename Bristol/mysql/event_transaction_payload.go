@@ -0,0 +1,129 @@
+// documentation:
+// https://dev.mysql.com/doc/dev/mysql-server/latest/classbinary__log_1_1Transaction__payload__event.html
+package mysql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+)
+
+// binlog_transaction_compression=ON (MySQL 8.0.20+) 的时候,整个 DML 事务的事件被压缩在一个 TRANSACTION_PAYLOAD_EVENT 里
+// payload 之前是 type,length,value 格式的字段,都是 length encoded int , type = 0 表示字段结束
+
+const (
+	OTW_PAYLOAD_HEADER_END_MARK         = 0
+	OTW_PAYLOAD_SIZE_FIELD              = 1
+	OTW_PAYLOAD_COMPRESSION_TYPE_FIELD  = 2
+	OTW_PAYLOAD_UNCOMPRESSED_SIZE_FIELD = 3
+)
+
+const (
+	PAYLOAD_COMPRESSION_ZSTD = 0
+	PAYLOAD_COMPRESSION_NONE = 255
+)
+
+const eventHeaderSize = 19
+
+type TransactionPayloadEvent struct {
+	header           EventHeader
+	payloadSize      uint64
+	compressionType  uint64
+	uncompressedSize uint64
+	payload          []byte
+}
+
+func (parser *eventParser) parseTransactionPayloadEvent(buf *bytes.Buffer) (event *TransactionPayloadEvent, err error) {
+	event = new(TransactionPayloadEvent)
+	if err = binary.Read(buf, binary.LittleEndian, &event.header); err != nil {
+		return
+	}
+	for {
+		var fieldType, fieldLength uint64
+		if fieldType, _, err = readLengthEncodedInt(buf); err != nil {
+			return
+		}
+		if fieldType == OTW_PAYLOAD_HEADER_END_MARK {
+			break
+		}
+		if fieldLength, _, err = readLengthEncodedInt(buf); err != nil {
+			return
+		}
+		if uint64(buf.Len()) < fieldLength {
+			return nil, fmt.Errorf("transaction payload field:%d length:%d > %d", fieldType, fieldLength, buf.Len())
+		}
+		fieldBuf := bytes.NewBuffer(buf.Next(int(fieldLength)))
+		var val uint64
+		switch fieldType {
+		case OTW_PAYLOAD_SIZE_FIELD, OTW_PAYLOAD_COMPRESSION_TYPE_FIELD, OTW_PAYLOAD_UNCOMPRESSED_SIZE_FIELD:
+			if val, _, err = readLengthEncodedInt(fieldBuf); err != nil {
+				return
+			}
+		default:
+			// 未知字段 跳过
+			continue
+		}
+		switch fieldType {
+		case OTW_PAYLOAD_SIZE_FIELD:
+			event.payloadSize = val
+		case OTW_PAYLOAD_COMPRESSION_TYPE_FIELD:
+			event.compressionType = val
+		case OTW_PAYLOAD_UNCOMPRESSED_SIZE_FIELD:
+			event.uncompressedSize = val
+		}
+	}
+	event.payload = buf.Bytes()
+	if event.payloadSize > 0 && uint64(len(event.payload)) > event.payloadSize {
+		event.payload = event.payload[:event.payloadSize]
+	}
+	return
+}
+
+func (event *TransactionPayloadEvent) decompress() ([]byte, error) {
+	switch event.compressionType {
+	case PAYLOAD_COMPRESSION_NONE:
+		return event.payload, nil
+	case PAYLOAD_COMPRESSION_ZSTD:
+		decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+		return decoder.DecodeAll(event.payload, make([]byte, 0, event.uncompressedSize))
+	default:
+		return nil, fmt.Errorf("transaction payload compression type:%d not supported", event.compressionType)
+	}
+}
+
+// 解压并拆分成一个个事件,压缩事务里的事件 没有 checksum
+// 事件的位点 统一改成外层事件的位点,最后一个事件(XID)为外层事件的结束位点,其他事件为外层事件的开始位点
+// 这样不管在哪个事件中断,都可以从外层事件的边界 重新开始解析
+func (event *TransactionPayloadEvent) splitEvents() (list [][]byte, err error) {
+	data, err := event.decompress()
+	if err != nil {
+		return nil, err
+	}
+	if event.uncompressedSize > 0 && uint64(len(data)) != event.uncompressedSize {
+		return nil, fmt.Errorf("transaction payload uncompressed size:%d != %d", len(data), event.uncompressedSize)
+	}
+	startPos := event.header.LogPos - event.header.EventSize
+	for offset := 0; offset < len(data); {
+		if len(data)-offset < eventHeaderSize {
+			return nil, fmt.Errorf("transaction payload event header out of range, offset:%d", offset)
+		}
+		eventSize := int(binary.LittleEndian.Uint32(data[offset+9 : offset+13]))
+		if eventSize < eventHeaderSize || offset+eventSize > len(data) {
+			return nil, fmt.Errorf("transaction payload event size:%d out of range, offset:%d", eventSize, offset)
+		}
+		eventData := make([]byte, eventSize)
+		copy(eventData, data[offset:offset+eventSize])
+		binary.LittleEndian.PutUint32(eventData[13:17], startPos)
+		list = append(list, eventData)
+		offset += eventSize
+	}
+	if len(list) > 0 {
+		binary.LittleEndian.PutUint32(list[len(list)-1][13:17], event.header.LogPos)
+	}
+	return list, nil
+}
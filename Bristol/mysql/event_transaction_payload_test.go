@@ -0,0 +1,104 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/klauspost/compress/zstd"
+	"testing"
+)
+
+func newTestEventData(eventType EventType, logPos uint32, body []byte) []byte {
+	header := EventHeader{
+		Timestamp: 1700000000,
+		EventType: eventType,
+		ServerId:  1,
+		EventSize: uint32(eventHeaderSize + len(body)),
+		LogPos:    logPos,
+	}
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, header)
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+func newTestPayloadEventData(t *testing.T, logPos uint32, compressionType uint64, events ...[]byte) []byte {
+	uncompressed := bytes.Join(events, nil)
+	payload := uncompressed
+	if compressionType == PAYLOAD_COMPRESSION_ZSTD {
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload = encoder.EncodeAll(uncompressed, nil)
+		encoder.Close()
+	}
+	body := new(bytes.Buffer)
+	for _, field := range [][2]uint64{
+		{OTW_PAYLOAD_COMPRESSION_TYPE_FIELD, compressionType},
+		{OTW_PAYLOAD_UNCOMPRESSED_SIZE_FIELD, uint64(len(uncompressed))},
+		{OTW_PAYLOAD_SIZE_FIELD, uint64(len(payload))},
+	} {
+		val := lengthCodedBinaryToBytes(field[1])
+		body.Write(lengthCodedBinaryToBytes(field[0]))
+		body.Write(lengthCodedBinaryToBytes(uint64(len(val))))
+		body.Write(val)
+	}
+	body.WriteByte(OTW_PAYLOAD_HEADER_END_MARK)
+	body.Write(payload)
+	return newTestEventData(TRANSACTION_PAYLOAD_EVENT, logPos, body.Bytes())
+}
+
+func TestTransactionPayloadEvent_SplitEvents(t *testing.T) {
+	// 压缩事务里的事件 位点为 0
+	queryEvent := newTestEventData(QUERY_EVENT, 0, []byte("BEGIN"))
+	xid := make([]byte, 8)
+	binary.LittleEndian.PutUint64(xid, 100)
+	xidEvent := newTestEventData(XID_EVENT, 0, xid)
+
+	for _, compressionType := range []uint64{PAYLOAD_COMPRESSION_ZSTD, PAYLOAD_COMPRESSION_NONE} {
+		data := newTestPayloadEventData(t, 1000, compressionType, queryEvent, xidEvent)
+		// 外层事件有 checksum
+		data = append(data, 0, 0, 0, 0)
+		startPos := 1000 - uint32(len(data)-4)
+
+		parser := newEventParser(nil)
+		parser.binlog_checksum = true
+		parser.gtidSetInfo = NewMySQLGtidSet("")
+		event, _, err := parser.parseEvent(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event != nil || len(parser.payloadEventList) != 2 {
+			t.Fatal("payload events count error", len(parser.payloadEventList))
+		}
+		var header EventHeader
+		header.Read(parser.payloadEventList[0])
+		if header.EventType != QUERY_EVENT || header.LogPos != startPos {
+			t.Fatal("first event position must be start of payload event", header)
+		}
+		parser.nextPayloadEvent()
+		event, _, err = parser.parseEventWithoutChecksum(parser.nextPayloadEvent())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.Header.EventType != XID_EVENT || event.BinlogPosition != 1000 {
+			t.Fatal("last event position must be end of payload event", event.Header)
+		}
+		if parser.nextPayloadEvent() != nil {
+			t.Fatal("payload event list must be empty")
+		}
+	}
+}
+
+func TestTransactionPayloadEvent_Err(t *testing.T) {
+	data := newTestPayloadEventData(t, 1000, 1, newTestEventData(XID_EVENT, 0, make([]byte, 8)))
+	parser := newEventParser(nil)
+	if _, _, err := parser.parseEvent(data); err == nil {
+		t.Fatal("compression type 1 must be not supported")
+	}
+	// 解压之后的事件 长度不对
+	data = newTestPayloadEventData(t, 1000, PAYLOAD_COMPRESSION_NONE, newTestEventData(XID_EVENT, 0, make([]byte, 8))[:20])
+	if _, _, err := parser.parseEvent(data); err == nil {
+		t.Fatal("event size out of range must be error")
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -330,3 +332,230 @@ func read_binary_json_type_inlined(buf *bytes.Buffer, z uint8, large bool) (data
 
 	panic("Json type " + fmt.Sprint(z) + " is not handled")
 }
+
+/*
+binlog_row_value_options = PARTIAL_JSON 的时候, PARTIAL_UPDATE_ROWS_EVENT 中 json 字段只记录修改操作
+格式参考 mysql-server sql/json_diff.cc Json_diff_vector::read_binary
+每个修改操作:
+
+	1 byte 操作类型
+	length encoded int path 长度, path
+	REMOVE 之外的操作: length encoded int value 长度, value (二进制 json)
+*/
+const (
+	JSON_DIFF_OPERATION_REPLACE = 0x0
+	JSON_DIFF_OPERATION_INSERT  = 0x1
+	JSON_DIFF_OPERATION_REMOVE  = 0x2
+)
+
+type JsonDiff struct {
+	Op    string      // REPLACE, INSERT, REMOVE
+	Path  string      // 修改的 json path, 比如 $.a[1].b
+	Value interface{} // REMOVE 的时候为 nil
+}
+
+func jsonDiffOperationName(op byte) string {
+	switch op {
+	case JSON_DIFF_OPERATION_REPLACE:
+		return "REPLACE"
+	case JSON_DIFF_OPERATION_INSERT:
+		return "INSERT"
+	case JSON_DIFF_OPERATION_REMOVE:
+		return "REMOVE"
+	default:
+		return ""
+	}
+}
+
+func get_field_json_diff(data []byte) (diffs []*JsonDiff, err error) {
+	buf := bytes.NewBuffer(data)
+	diffs = make([]*JsonDiff, 0)
+	for buf.Len() > 0 {
+		op, _ := buf.ReadByte()
+		diff := &JsonDiff{Op: jsonDiffOperationName(op)}
+		if diff.Op == "" {
+			return nil, fmt.Errorf("Json diff operation %d is not handled", op)
+		}
+		var pathLength, valueLength uint64
+		if pathLength, _, err = readLengthEncodedInt(buf); err != nil {
+			return nil, err
+		}
+		if uint64(buf.Len()) < pathLength {
+			return nil, fmt.Errorf("Json diff path length: %d is larger than data length %d", pathLength, buf.Len())
+		}
+		diff.Path = string(buf.Next(int(pathLength)))
+		if op != JSON_DIFF_OPERATION_REMOVE {
+			if valueLength, _, err = readLengthEncodedInt(buf); err != nil {
+				return nil, err
+			}
+			if uint64(buf.Len()) < valueLength {
+				return nil, fmt.Errorf("Json diff value length: %d is larger than data length %d", valueLength, buf.Len())
+			}
+			if diff.Value, err = get_field_json_data(buf.Next(int(valueLength)), int64(valueLength)); err != nil {
+				return nil, fmt.Errorf("Json diff path:%s value err:%s", diff.Path, err)
+			}
+		}
+		diffs = append(diffs, diff)
+	}
+	return
+}
+
+// 将 diff 应用到 before 数据上, 得到完整的 after 数据, before 数据不会被修改
+func apply_json_diffs(before interface{}, diffs []*JsonDiff) (after interface{}, err error) {
+	after = copy_json_value(before)
+	for _, diff := range diffs {
+		var legs []interface{}
+		if legs, err = parse_json_path(diff.Path); err != nil {
+			return nil, err
+		}
+		if after, err = apply_json_diff(after, legs, diff); err != nil {
+			return nil, fmt.Errorf("Json diff %s path:%s err:%s", diff.Op, diff.Path, err)
+		}
+	}
+	return
+}
+
+func apply_json_diff(doc interface{}, legs []interface{}, diff *JsonDiff) (interface{}, error) {
+	if len(legs) == 0 {
+		if diff.Op != "REPLACE" {
+			return nil, fmt.Errorf("only REPLACE can be applied to the whole document")
+		}
+		return copy_json_value(diff.Value), nil
+	}
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		key, ok := legs[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("array index %v on object", legs[0])
+		}
+		if len(legs) > 1 {
+			child, ok := v[key]
+			if !ok {
+				return nil, fmt.Errorf("member %s not exist", key)
+			}
+			var err error
+			v[key], err = apply_json_diff(child, legs[1:], diff)
+			return v, err
+		}
+		switch diff.Op {
+		case "REMOVE":
+			delete(v, key)
+		default:
+			v[key] = copy_json_value(diff.Value)
+		}
+		return v, nil
+	case []interface{}:
+		index, ok := legs[0].(int)
+		if !ok {
+			return nil, fmt.Errorf("member %v on array", legs[0])
+		}
+		if len(legs) > 1 {
+			if index >= len(v) {
+				return nil, fmt.Errorf("array index %d out of range", index)
+			}
+			var err error
+			v[index], err = apply_json_diff(v[index], legs[1:], diff)
+			return v, err
+		}
+		switch diff.Op {
+		case "INSERT":
+			// 和 JSON_ARRAY_INSERT 一样, 超出数组长度的时候 追加到最后
+			if index >= len(v) {
+				return append(v, copy_json_value(diff.Value)), nil
+			}
+			v = append(v[:index+1], v[index:]...)
+			v[index] = copy_json_value(diff.Value)
+			return v, nil
+		case "REMOVE":
+			if index >= len(v) {
+				return nil, fmt.Errorf("array index %d out of range", index)
+			}
+			return append(v[:index], v[index+1:]...), nil
+		default:
+			if index >= len(v) {
+				return nil, fmt.Errorf("array index %d out of range", index)
+			}
+			v[index] = copy_json_value(diff.Value)
+			return v, nil
+		}
+	default:
+		return nil, fmt.Errorf("path leg %v on scalar value", legs[0])
+	}
+}
+
+// 解析 json path, 对象成员名 为 string, 数组下标 为 int
+// $.a."b c"[1]  => ["a", "b c", 1]
+func parse_json_path(path string) (legs []interface{}, err error) {
+	path = strings.TrimSpace(path)
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("Json path:%s must start with $", path)
+	}
+	legs = make([]interface{}, 0)
+	for i := 1; i < len(path); {
+		switch path[i] {
+		case ' ':
+			i++
+		case '.':
+			i++
+			if i < len(path) && path[i] == '"' {
+				j := i + 1
+				for ; j < len(path) && path[j] != '"'; j++ {
+					if path[j] == '\\' {
+						j++
+					}
+				}
+				if j >= len(path) {
+					return nil, fmt.Errorf("Json path:%s quoted member not closed", path)
+				}
+				var key string
+				if key, err = strconv.Unquote(path[i : j+1]); err != nil {
+					return nil, fmt.Errorf("Json path:%s err:%s", path, err)
+				}
+				legs = append(legs, key)
+				i = j + 1
+			} else {
+				j := i
+				for ; j < len(path) && path[j] != '.' && path[j] != '['; j++ {
+				}
+				if j == i {
+					return nil, fmt.Errorf("Json path:%s empty member", path)
+				}
+				legs = append(legs, path[i:j])
+				i = j
+			}
+		case '[':
+			j := strings.IndexByte(path[i:], ']')
+			if j < 0 {
+				return nil, fmt.Errorf("Json path:%s array index not closed", path)
+			}
+			var index int
+			if index, err = strconv.Atoi(strings.TrimSpace(path[i+1 : i+j])); err != nil || index < 0 {
+				return nil, fmt.Errorf("Json path:%s array index err", path)
+			}
+			legs = append(legs, index)
+			i += j + 1
+		default:
+			return nil, fmt.Errorf("Json path:%s unexpected char %c", path, path[i])
+		}
+	}
+	return legs, nil
+}
+
+func copy_json_value(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, v0 := range val {
+			m[k] = copy_json_value(v0)
+		}
+		return m
+	case []interface{}:
+		arr := make([]interface{}, len(val))
+		for i, v0 := range val {
+			arr[i] = copy_json_value(v0)
+		}
+		return arr
+	default:
+		return v
+	}
+}
@@ -0,0 +1,164 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func writeJsonDiff(buf *bytes.Buffer, op byte, path string, value []byte) {
+	buf.WriteByte(op)
+	buf.WriteByte(byte(len(path)))
+	buf.WriteString(path)
+	if op != JSON_DIFF_OPERATION_REMOVE {
+		buf.WriteByte(byte(len(value)))
+		buf.Write(value)
+	}
+}
+
+func getTestJsonDiffData() []byte {
+	buf := new(bytes.Buffer)
+	writeJsonDiff(buf, JSON_DIFF_OPERATION_REPLACE, "$.a", []byte{JSONB_TYPE_INT16, 0x05, 0x00})
+	writeJsonDiff(buf, JSON_DIFF_OPERATION_INSERT, "$.b[1]", []byte{JSONB_TYPE_STRING, 0x01, 'y'})
+	writeJsonDiff(buf, JSON_DIFF_OPERATION_REMOVE, "$.c.d", nil)
+	writeJsonDiff(buf, JSON_DIFF_OPERATION_INSERT, `$."e f"`, []byte{JSONB_TYPE_LITERAL, JSONB_LITERAL_TRUE})
+	return buf.Bytes()
+}
+
+func getTestJsonBefore() map[string]interface{} {
+	return map[string]interface{}{
+		"a": int16(1),
+		"b": []interface{}{int16(1), int16(2)},
+		"c": map[string]interface{}{"d": "x"},
+	}
+}
+
+func TestGetFieldJsonDiff(t *testing.T) {
+	diffs, err := get_field_json_diff(getTestJsonDiffData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 4 {
+		t.Fatalf("len(diffs):%d != 4", len(diffs))
+	}
+	if diffs[0].Op != "REPLACE" || diffs[0].Path != "$.a" || diffs[0].Value != int16(5) {
+		t.Fatalf("diffs[0]:%+v", diffs[0])
+	}
+	if diffs[2].Op != "REMOVE" || diffs[2].Value != nil {
+		t.Fatalf("diffs[2]:%+v", diffs[2])
+	}
+
+	before := getTestJsonBefore()
+	after, err := apply_json_diffs(before, diffs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"a":   int16(5),
+		"b":   []interface{}{int16(1), "y", int16(2)},
+		"c":   map[string]interface{}{},
+		"e f": true,
+	}
+	if !reflect.DeepEqual(after, expected) {
+		t.Fatalf("after:%+v != %+v", after, expected)
+	}
+	// before 数据不能被修改
+	if !reflect.DeepEqual(before, getTestJsonBefore()) {
+		t.Fatalf("before changed:%+v", before)
+	}
+
+	_, err = apply_json_diffs(before, []*JsonDiff{{Op: "REPLACE", Path: "$.b[5]", Value: 1}})
+	if err == nil {
+		t.Fatal("array index out of range must be err")
+	}
+	if _, err = get_field_json_diff([]byte{0x09}); err == nil {
+		t.Fatal("unknown operation must be err")
+	}
+}
+
+func TestParseJsonPath(t *testing.T) {
+	legs, err := parse_json_path(`$.a."b.c"[2].d`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(legs, []interface{}{"a", "b.c", 2, "d"}) {
+		t.Fatalf("legs:%+v", legs)
+	}
+	for _, path := range []string{"a.b", "$.", "$[a]", `$."a`} {
+		if _, err = parse_json_path(path); err == nil {
+			t.Fatalf("path:%s must be err", path)
+		}
+	}
+}
+
+// PARTIAL_UPDATE_ROWS_EVENT after 数据中 json 字段只有 diff
+func TestRowsEvent_applyJsonDiffs(t *testing.T) {
+	parser := newEventParser(nil)
+	tableMap := &TableMapEvent{
+		columnTypes: []FieldType{FIELD_TYPE_LONG, FIELD_TYPE_JSON},
+		columnMetaData: []*ColumnType{
+			{column_type: FIELD_TYPE_LONG},
+			{column_type: FIELD_TYPE_JSON, length_size: 4},
+		},
+	}
+	tableSchemaMap := []*ColumnInfo{{COLUMN_NAME: "id"}, {COLUMN_NAME: "data"}}
+	event := &RowsEvent{
+		rows: []map[string]interface{}{{"id": int32(1), "data": getTestJsonBefore()}},
+	}
+
+	diffData := getTestJsonDiffData()
+	buf := new(bytes.Buffer)
+	// value_options, partial bitmap
+	buf.WriteByte(PARTIAL_JSON_UPDATES)
+	buf.WriteByte(0x01)
+	// null bitmap
+	buf.WriteByte(0x00)
+	binary.Write(buf, binary.LittleEndian, int32(1))
+	binary.Write(buf, binary.LittleEndian, uint32(len(diffData)))
+	buf.Write(diffData)
+
+	partialJsonColumns, err := readPartialJsonColumns(buf, tableMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !partialJsonColumns[1] || len(partialJsonColumns) != 1 {
+		t.Fatalf("partialJsonColumns:%+v", partialJsonColumns)
+	}
+	row, err := parser.parseEventRow(buf, tableMap, tableSchemaMap, Bitfield{0x03}, partialJsonColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	absentColumns, err := event.applyJsonDiffs(row, partialJsonColumns, tableSchemaMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(absentColumns) != 0 {
+		t.Fatalf("absentColumns:%+v", absentColumns)
+	}
+	if row["data"].(map[string]interface{})["a"] != int16(5) {
+		t.Fatalf("after data:%+v", row["data"])
+	}
+	if len(event.jsonDiffs) != 2 || event.jsonDiffs[0] != nil || len(event.jsonDiffs[1]["data"]) != 4 {
+		t.Fatalf("jsonDiffs:%+v", event.jsonDiffs)
+	}
+
+	// before 数据中没有 json 字段, 只能当作缺失的字段
+	event = &RowsEvent{
+		rows: []map[string]interface{}{{"id": int32(1)}},
+	}
+	diffs, _ := get_field_json_diff(diffData)
+	row = map[string]interface{}{"data": diffs}
+	absentColumns, err = event.applyJsonDiffs(row, partialJsonColumns, tableSchemaMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := row["data"]; ok || len(absentColumns) != 1 {
+		t.Fatalf("row:%+v absentColumns:%+v", row, absentColumns)
+	}
+	event.rows = append(event.rows, row)
+	event.removePresentColumns(map[int][]string{1: absentColumns}, 2, tableSchemaMap)
+	if !reflect.DeepEqual(event.presentColumns, [][]string{{"id", "data"}, {"id"}}) {
+		t.Fatalf("presentColumns:%+v", event.presentColumns)
+	}
+}
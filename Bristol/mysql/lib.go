@@ -3,6 +3,7 @@ package mysql
 import (
 	"database/sql/driver"
 	"fmt"
+	"strings"
 )
 
 type tableStruct struct {
@@ -31,6 +32,30 @@ type ColumnInfo struct {
 	COLUMN_DEFAULT         string
 	DATA_TYPE              string
 	CHARACTER_OCTET_LENGTH uint64
+	IsNullable             bool
+}
+
+func (t *tableStruct) addColumn(columnInfo *ColumnInfo, isNullable bool) {
+	columnInfo.IsNullable = isNullable
+	t.ColumnSchemaTypeList = append(t.ColumnSchemaTypeList, columnInfo)
+	if strings.ToUpper(columnInfo.COLUMN_KEY) == "PRI" {
+		t.Pri = append(t.Pri, columnInfo.COLUMN_NAME)
+	}
+	if t.ColumnMapping == nil {
+		t.ColumnMapping = make(map[string]string, 0)
+	}
+	t.ColumnMapping[columnInfo.COLUMN_NAME] = getColumnMappingType(columnInfo, isNullable)
+}
+
+// 字段列表有变更后，重新生成 主键 及 ColumnMapping
+func (t *tableStruct) rebuild() {
+	columnList := t.ColumnSchemaTypeList
+	t.Pri = make([]string, 0)
+	t.ColumnSchemaTypeList = make([]*ColumnInfo, 0, len(columnList))
+	t.ColumnMapping = make(map[string]string, len(columnList))
+	for _, columnInfo := range columnList {
+		t.addColumn(columnInfo, columnInfo.IsNullable)
+	}
 }
 
 type MysqlConnection interface {
@@ -54,7 +79,10 @@ type EventReslut struct {
 	Gtid           string
 	Pri            []string
 	ColumnMapping  map[string]string
-	EventID        uint64 // 事件ID
+	EventID        uint64                   // 事件ID
+	PresentColumns [][]string               // 和 Rows 一一对应, binlog_row_image = MINIMAL/NOBLOB 时每行实际存在的字段; 为 nil 表示所有字段都存在
+	JsonDiffs      []map[string][]*JsonDiff // 和 Rows 一一对应, PARTIAL_UPDATE_ROWS_EVENT 中 json 字段的修改操作, Rows 中已经是合并之后完整的数据
+	RowsQuery      string                   // 产生这个 row event 的原始 SQL, binlog_rows_query_log_events = ON 或者 MariaDB binlog_annotate_row_events = ON 时才有
 }
 
 type callback func(data *EventReslut)
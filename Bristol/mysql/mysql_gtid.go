@@ -170,3 +170,19 @@ func (This *MySQLGtidSet) Update(gtid string) error {
 	This.Unlock()
 	return nil
 }
+
+// sid:gno 这个事务 是否在 GTID 集合中
+func (This *MySQLGtidSet) Contain(sid string, gno int64) bool {
+	This.RLock()
+	defer This.RUnlock()
+	gtidInfo, ok := This.gtids[sid]
+	if !ok {
+		return false
+	}
+	for _, v := range gtidInfo.intervals {
+		if gno >= v.Start && gno < v.Stop {
+			return true
+		}
+	}
+	return false
+}
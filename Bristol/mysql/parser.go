@@ -38,6 +38,12 @@ type eventParser struct {
 	lastPrevtiousGTIDSMap map[string]Intervals // 当前解析的 binlog 文件的 PrevtiousGTIDS 对应关系
 	gtidSetInfo           GTIDSet
 	dbType                DBType
+	schemaHistory         *SchemaHistory // 不为 nil 的时候，表结构从 离线表结构历史 中获取
+	payloadEventList      [][]byte       // TRANSACTION_PAYLOAD_EVENT 解压出来 还没有解析的事件
+	offline               bool           // 离线解析本地 binlog 文件,没有源端可以查询表结构
+	rowsQuery             string         // 最近一个 ROWS_QUERY_EVENT / MARIADB_ANNOTATE_ROWS_EVENT 中的原始 SQL, 附加到接下来的 row event 上
+	loopMarkerTable       string         // 双向同步 防回环 的标记表, schema.table
+	skipLoopTransaction   bool           // 当前事务中 更新过 标记表, 是 Bifrost 自己写入的数据, row 事件 全部丢弃
 }
 
 func newEventParser(binlogDump *BinlogDump) (parser *eventParser) {
@@ -97,6 +103,16 @@ func (parser *eventParser) saveBinlog(event *EventReslut) {
 	}
 }
 
+// 取出下一个 压缩事务中的事件
+func (parser *eventParser) nextPayloadEvent() []byte {
+	if len(parser.payloadEventList) == 0 {
+		return nil
+	}
+	data := parser.payloadEventList[0]
+	parser.payloadEventList = parser.payloadEventList[1:]
+	return data
+}
+
 func (parser *eventParser) getGtid() string {
 	if parser.gtidSetInfo == nil {
 		return ""
@@ -105,15 +121,27 @@ func (parser *eventParser) getGtid() string {
 }
 
 func (parser *eventParser) parseEvent(data []byte) (event *EventReslut, filename string, err error) {
-	var buf *bytes.Buffer
 	if parser.binlog_checksum {
-		buf = bytes.NewBuffer(data[0 : len(data)-4])
-	} else {
-		buf = bytes.NewBuffer(data)
+		data = data[0 : len(data)-4]
 	}
+	return parser.parseEventWithoutChecksum(data)
+}
+
+// 压缩事务中的事件 没有 checksum ,直接调用这个方法解析
+func (parser *eventParser) parseEventWithoutChecksum(data []byte) (event *EventReslut, filename string, err error) {
+	buf := bytes.NewBuffer(data)
 	//log.Println("data[4]:",data[4])
 	switch EventType(data[4]) {
-	case HEARTBEAT_EVENT, IGNORABLE_EVENT:
+	case HEARTBEAT_EVENT, HEARTBEAT_LOG_EVENT_V2, IGNORABLE_EVENT:
+		return
+	case TRANSACTION_PAYLOAD_EVENT:
+		// 解压出来的事件 放到 payloadEventList 中,由 DumpBinlog0 逐个解析,和普通事件走同样的处理逻辑
+		var payloadEvent *TransactionPayloadEvent
+		payloadEvent, err = parser.parseTransactionPayloadEvent(buf)
+		if err != nil {
+			return
+		}
+		parser.payloadEventList, err = payloadEvent.splitEvents()
 		return
 	case PREVIOUS_GTIDS_EVENT:
 		var PreviousGTIDSEvent *PreviousGTIDSEvent
@@ -129,6 +157,7 @@ func (parser *eventParser) parseEvent(data []byte) (event *EventReslut, filename
 		GtidEvent, err = parser.parseGTIDEvent(buf)
 		gtid := fmt.Sprintf("%s:%d-%d", GtidEvent.SID36, parser.getGTIDSIDStart(GtidEvent.SID36), GtidEvent.GNO)
 		parser.gtidSetInfo.Update(gtid)
+		parser.skipLoopTransaction = false
 		event = &EventReslut{
 			Header:         GtidEvent.header,
 			BinlogFileName: parser.currentBinlogFileName,
@@ -150,6 +179,7 @@ func (parser *eventParser) parseEvent(data []byte) (event *EventReslut, filename
 		GtidEvent, err = parser.MariadbGTIDEvent(buf)
 		gtid := fmt.Sprintf("%d-%d-%d", GtidEvent.GTID.DomainID, GtidEvent.GTID.ServerID, GtidEvent.GTID.SequenceNumber)
 		parser.gtidSetInfo.Update(gtid)
+		parser.skipLoopTransaction = false
 		event = &EventReslut{
 			Header:         GtidEvent.header,
 			BinlogFileName: parser.currentBinlogFileName,
@@ -195,6 +225,7 @@ func (parser *eventParser) parseEvent(data []byte) (event *EventReslut, filename
 		}
 		return
 	case QUERY_EVENT:
+		parser.rowsQuery = ""
 		var queryEvent *QueryEvent
 		queryEvent, err = parser.parseQueryEvent(buf)
 		event = &EventReslut{
@@ -208,6 +239,9 @@ func (parser *eventParser) parseEvent(data []byte) (event *EventReslut, filename
 		switch queryEvent.query {
 		case "COMMIT":
 			event.Gtid = parser.getGtid()
+			parser.skipLoopTransaction = false
+		case "BEGIN":
+			parser.skipLoopTransaction = false
 		default:
 			break
 		}
@@ -233,12 +267,19 @@ func (parser *eventParser) parseEvent(data []byte) (event *EventReslut, filename
 		parser.tableMap[table_map_event.tableId] = table_map_event
 		parser.lastMapEvent = table_map_event
 		//log.Println("table_map_event:",*table_map_event,"tableId:",table_map_event.tableId," schemaName:",table_map_event.schemaName," tableName:",table_map_event.tableName)
-		if parser.binlogDump.CheckReplicateDb(table_map_event.schemaName, table_map_event.tableName) == false {
+		if parser.isLoopMarkerTable(table_map_event.schemaName, table_map_event.tableName) {
+			parser.skipLoopTransaction = true
+			parser.filterNextRowEvent = true
+		} else if parser.binlogDump.CheckReplicateDb(table_map_event.schemaName, table_map_event.tableName) == false {
 			parser.filterNextRowEvent = true
 		} else {
 			parser.filterNextRowEvent = false
 			_, ok := parser.tableSchemaMap[table_map_event.tableId]
-			if !ok || (parser.tableSchemaMap[table_map_event.tableId].needReload == true) {
+			if parser.schemaHistory != nil {
+				if err = parser.GetTableSchemaFromHistory(table_map_event); err != nil {
+					log.Println("binlog schema history err:", err, " binlogFileName:", parser.currentBinlogFileName, " binlogPosition:", table_map_event.header.LogPos)
+				}
+			} else if !ok || (parser.tableSchemaMap[table_map_event.tableId].needReload == true) {
 				parser.GetTableSchema(table_map_event.tableId, table_map_event.schemaName, table_map_event.tableName)
 			}
 		}
@@ -251,12 +292,16 @@ func (parser *eventParser) parseEvent(data []byte) (event *EventReslut, filename
 		}
 
 		break
-	case WRITE_ROWS_EVENTv0, WRITE_ROWS_EVENTv1, WRITE_ROWS_EVENTv2, UPDATE_ROWS_EVENTv0, UPDATE_ROWS_EVENTv1, UPDATE_ROWS_EVENTv2, DELETE_ROWS_EVENTv0, DELETE_ROWS_EVENTv1, DELETE_ROWS_EVENTv2:
+	case WRITE_ROWS_EVENTv0, WRITE_ROWS_EVENTv1, WRITE_ROWS_EVENTv2, UPDATE_ROWS_EVENTv0, UPDATE_ROWS_EVENTv1, UPDATE_ROWS_EVENTv2, DELETE_ROWS_EVENTv0, DELETE_ROWS_EVENTv1, DELETE_ROWS_EVENTv2, PARTIAL_UPDATE_ROWS_EVENT:
 		var rowsEvent *RowsEvent
 		rowsEvent, err = parser.parseRowsEvent(buf)
 		if err != nil {
 			log.Println("row event err:", err)
 		}
+		// json diff 已经合并到 after 数据中, 后续当作 UPDATE_ROWS_EVENTv2 处理
+		if rowsEvent.header.EventType == PARTIAL_UPDATE_ROWS_EVENT {
+			rowsEvent.header.EventType = UPDATE_ROWS_EVENTv2
+		}
 		if tableInfo, ok := parser.tableSchemaMap[rowsEvent.tableId]; ok {
 			event = &EventReslut{
 				Header:         rowsEvent.header,
@@ -267,6 +312,9 @@ func (parser *eventParser) parseEvent(data []byte) (event *EventReslut, filename
 				Rows:           rowsEvent.rows,
 				Pri:            tableInfo.Pri,
 				ColumnMapping:  tableInfo.ColumnMapping,
+				PresentColumns: rowsEvent.presentColumns,
+				JsonDiffs:      rowsEvent.jsonDiffs,
+				RowsQuery:      parser.rowsQuery,
 			}
 		} else {
 			event = &EventReslut{
@@ -276,10 +324,32 @@ func (parser *eventParser) parseEvent(data []byte) (event *EventReslut, filename
 				SchemaName:     parser.lastMapEvent.schemaName,
 				TableName:      parser.lastMapEvent.tableName,
 				Rows:           rowsEvent.rows,
+				PresentColumns: rowsEvent.presentColumns,
+				JsonDiffs:      rowsEvent.jsonDiffs,
+				RowsQuery:      parser.rowsQuery,
 			}
 		}
 		break
+	case ROWS_QUERY_EVENT, MARIADB_ANNOTATE_ROWS_EVENT:
+		var rowsQueryEvent *RowsQueryEvent
+		rowsQueryEvent, err = parser.parseRowsQueryEvent(buf)
+		// 原始 SQL 只是附加信息, 解析失败 跳过这个事件, 不影响后面 row event 的解析
+		if err != nil {
+			log.Println("rows query event err:", err)
+			parser.rowsQuery = ""
+			return nil, "", nil
+		}
+		parser.rowsQuery = rowsQueryEvent.query
+		event = &EventReslut{
+			Header:         rowsQueryEvent.header,
+			BinlogFileName: parser.currentBinlogFileName,
+			BinlogPosition: rowsQueryEvent.header.LogPos,
+			Query:          rowsQueryEvent.query,
+		}
+		break
 	case XID_EVENT:
+		parser.rowsQuery = ""
+		parser.skipLoopTransaction = false
 		var xidEvent *XIdEvent
 		xidEvent, err = parser.parseXidEvent(buf)
 		if err != nil {
@@ -352,10 +422,31 @@ func (parser *eventParser) GetTableSchema(tableId uint64, database string, table
 				lastErr = err.Error()
 			}
 		}
+		// 离线解析 不会有源端恢复的情况,不再重试
+		if parser.offline {
+			break
+		}
 	}
 }
 
 func (parser *eventParser) GetTableSchemaByName(tableId uint64, database string, tablename string) (errs error) {
+	tableInfo, errs := parser.loadTableSchema(database, tablename)
+	if errs != nil {
+		return
+	}
+	parser.binlogDump.Lock()
+	//set dbAndTable Name tableId
+	parser.tableNameMap[database+"."+tablename] = tableId
+	parser.tableSchemaMap[tableId] = tableInfo
+	parser.binlogDump.Unlock()
+	return nil
+}
+
+// 从 information_schema 中查询 当前 的表结构
+func (parser *eventParser) loadTableSchema(database string, tablename string) (tableInfo *tableStruct, errs error) {
+	if parser.offline {
+		return nil, fmt.Errorf("offline binlog file dump, table schema must be in schema snapshot")
+	}
 	parser.binlogDump.Lock()
 	defer parser.binlogDump.Unlock()
 	errs = fmt.Errorf("unknow error")
@@ -368,8 +459,6 @@ func (parser *eventParser) GetTableSchemaByName(tableId uint64, database string,
 	if parser.connStatus == STATUS_CLOSED {
 		parser.initConn()
 	}
-	//set dbAndTable Name tableId
-	parser.tableNameMap[database+"."+tablename] = tableId
 	sql := "SELECT COLUMN_NAME,COLUMN_KEY,COLUMN_TYPE,CHARACTER_SET_NAME,COLLATION_NAME,NUMERIC_SCALE,EXTRA,COLUMN_DEFAULT,DATA_TYPE,CHARACTER_OCTET_LENGTH,IS_NULLABLE FROM information_schema.columns WHERE table_schema='" + database + "' AND table_name='" + tablename + "' ORDER BY `ORDINAL_POSITION` ASC"
 	stmt, err := parser.conn.Prepare(sql)
 	if err != nil {
@@ -386,14 +475,13 @@ func (parser *eventParser) GetTableSchemaByName(tableId uint64, database string,
 		return
 	}
 	defer rows.Close()
-	//columeArr := make([]*tableStruct column_schema_type,0)
-	tableInfo := &tableStruct{
+	tableInfo = &tableStruct{
 		SchemaName:           database,
 		TableName:            tablename,
 		Pri:                  make([]string, 0),
 		ColumnSchemaTypeList: make([]*ColumnInfo, 0),
+		ColumnMapping:        make(map[string]string, 0),
 	}
-	ColumnMapping := make(map[string]string, 0)
 	for {
 		dest := make([]driver.Value, 11, 11)
 		err := rows.Next(dest)
@@ -402,11 +490,6 @@ func (parser *eventParser) GetTableSchemaByName(tableId uint64, database string,
 		}
 		var COLUMN_NAME, COLUMN_KEY, COLUMN_TYPE string
 		var CHARACTER_SET_NAME, COLLATION_NAME, NUMERIC_SCALE, EXTRA string
-		var isBool bool = false
-		var unsigned bool = false
-		var is_primary bool = false
-		var auto_increment bool = false
-		var enum_values, set_values []string
 		var COLUMN_DEFAULT string
 		var DATA_TYPE string
 		var CHARACTER_OCTET_LENGTH uint64
@@ -446,37 +529,6 @@ func (parser *eventParser) GetTableSchemaByName(tableId uint64, database string,
 			}
 		}
 
-		if COLUMN_TYPE == "tinyint(1)" {
-			isBool = true
-		}
-		if EXTRA == "auto_increment" {
-			auto_increment = true
-		}
-		if strings.Contains(COLUMN_TYPE, "unsigned") {
-			unsigned = true
-		}
-		if COLUMN_KEY != "" {
-			is_primary = true
-		}
-
-		if DATA_TYPE == "enum" {
-			d := strings.Replace(COLUMN_TYPE, "enum(", "", -1)
-			d = strings.Replace(d, ")", "", -1)
-			d = strings.Replace(d, "'", "", -1)
-			enum_values = strings.Split(d, ",")
-		} else {
-			enum_values = make([]string, 0)
-		}
-
-		if DATA_TYPE == "set" {
-			d := strings.Replace(COLUMN_TYPE, "set(", "", -1)
-			d = strings.Replace(d, ")", "", -1)
-			d = strings.Replace(d, "'", "", -1)
-			set_values = strings.Split(d, ",")
-		} else {
-			set_values = make([]string, 0)
-		}
-
 		if dest[9] == nil {
 			CHARACTER_OCTET_LENGTH = 0
 		} else {
@@ -500,84 +552,143 @@ func (parser *eventParser) GetTableSchemaByName(tableId uint64, database string,
 			IS_NULLABLE = dest[10].(string)
 		}
 
-		tableInfo.ColumnSchemaTypeList = append(tableInfo.ColumnSchemaTypeList, &ColumnInfo{
-			COLUMN_NAME:            COLUMN_NAME,
-			COLUMN_KEY:             COLUMN_KEY,
-			COLUMN_TYPE:            COLUMN_TYPE,
-			EnumValues:             enum_values,
-			SetValues:              set_values,
-			IsBool:                 isBool,
-			Unsigned:               unsigned,
-			IsPrimary:              is_primary,
-			AutoIncrement:          auto_increment,
-			CHARACTER_SET_NAME:     CHARACTER_SET_NAME,
-			COLLATION_NAME:         COLLATION_NAME,
-			NUMERIC_SCALE:          NUMERIC_SCALE,
-			COLUMN_DEFAULT:         COLUMN_DEFAULT,
-			DATA_TYPE:              DATA_TYPE,
-			CHARACTER_OCTET_LENGTH: CHARACTER_OCTET_LENGTH,
-		})
-
-		if strings.ToUpper(COLUMN_KEY) == "PRI" {
-			tableInfo.Pri = append(tableInfo.Pri, COLUMN_NAME)
-		}
-
-		var columnMappingType string
-		switch DATA_TYPE {
-		case "tinyint":
-			if unsigned {
-				columnMappingType = "uint8"
-			} else {
-				if COLUMN_TYPE == "tinyint(1)" {
-					columnMappingType = "bool"
-				} else {
-					columnMappingType = "int8"
-				}
-			}
-		case "smallint":
-			if unsigned {
-				columnMappingType = "uint16"
-			} else {
-				columnMappingType = "int16"
-			}
-		case "mediumint":
-			if unsigned {
-				columnMappingType = "uint24"
-			} else {
-				columnMappingType = "int24"
-			}
-		case "int":
-			if unsigned {
-				columnMappingType = "uint32"
-			} else {
-				columnMappingType = "int32"
-			}
-		case "bigint":
-			if unsigned {
-				columnMappingType = "uint64"
+		columnInfo := newColumnInfo(COLUMN_NAME, COLUMN_KEY, COLUMN_TYPE, DATA_TYPE, EXTRA)
+		columnInfo.CHARACTER_SET_NAME = CHARACTER_SET_NAME
+		columnInfo.COLLATION_NAME = COLLATION_NAME
+		columnInfo.NUMERIC_SCALE = NUMERIC_SCALE
+		columnInfo.COLUMN_DEFAULT = COLUMN_DEFAULT
+		columnInfo.CHARACTER_OCTET_LENGTH = CHARACTER_OCTET_LENGTH
+		tableInfo.addColumn(columnInfo, IS_NULLABLE == "YES")
+	}
+	if len(tableInfo.ColumnSchemaTypeList) == 0 {
+		return nil, fmt.Errorf("column len is 0 db:%s table:%s may be no privilege", database, tablename)
+	}
+	tableInfo.needReload = false
+	errs = nil
+	return
+}
+
+// 从 information_schema 中查询 所有的表, 不包括 系统库, schemaName => tableName list
+func (parser *eventParser) loadTableList() (tableList map[string][]string, errs error) {
+	parser.binlogDump.Lock()
+	defer parser.binlogDump.Unlock()
+	errs = fmt.Errorf("unknow error")
+	defer func() {
+		if err := recover(); err != nil {
+			parser.ParserConnClose(false)
+			errs = fmt.Errorf("%s", debug.Stack())
+		}
+	}()
+	if parser.connStatus == STATUS_CLOSED {
+		parser.initConn()
+	}
+	sql := "SELECT TABLE_SCHEMA,TABLE_NAME FROM information_schema.tables WHERE TABLE_TYPE='BASE TABLE' AND TABLE_SCHEMA NOT IN ('information_schema','performance_schema','mysql','sys')"
+	stmt, err := parser.conn.Prepare(sql)
+	if err != nil {
+		errs = err
+		parser.ParserConnClose(false)
+		return
+	}
+	defer stmt.Close()
+	rows, err := stmt.Query(make([]driver.Value, 0))
+	if err != nil {
+		errs = err
+		parser.ParserConnClose(false)
+		return
+	}
+	defer rows.Close()
+	tableList = make(map[string][]string, 0)
+	for {
+		dest := make([]driver.Value, 2, 2)
+		if rows.Next(dest) != nil {
+			break
+		}
+		schemaName, tableName := fmt.Sprint(dest[0]), fmt.Sprint(dest[1])
+		tableList[schemaName] = append(tableList[schemaName], tableName)
+	}
+	return tableList, nil
+}
+
+func newColumnInfo(COLUMN_NAME, COLUMN_KEY, COLUMN_TYPE, DATA_TYPE, EXTRA string) *ColumnInfo {
+	var enum_values, set_values []string
+	if DATA_TYPE == "enum" {
+		d := strings.Replace(COLUMN_TYPE, "enum(", "", -1)
+		d = strings.Replace(d, ")", "", -1)
+		d = strings.Replace(d, "'", "", -1)
+		enum_values = strings.Split(d, ",")
+	} else {
+		enum_values = make([]string, 0)
+	}
+
+	if DATA_TYPE == "set" {
+		d := strings.Replace(COLUMN_TYPE, "set(", "", -1)
+		d = strings.Replace(d, ")", "", -1)
+		d = strings.Replace(d, "'", "", -1)
+		set_values = strings.Split(d, ",")
+	} else {
+		set_values = make([]string, 0)
+	}
+	return &ColumnInfo{
+		COLUMN_NAME:   COLUMN_NAME,
+		COLUMN_KEY:    COLUMN_KEY,
+		COLUMN_TYPE:   COLUMN_TYPE,
+		EnumValues:    enum_values,
+		SetValues:     set_values,
+		IsBool:        COLUMN_TYPE == "tinyint(1)",
+		Unsigned:      strings.Contains(COLUMN_TYPE, "unsigned"),
+		IsPrimary:     COLUMN_KEY != "",
+		AutoIncrement: EXTRA == "auto_increment",
+		DATA_TYPE:     DATA_TYPE,
+	}
+}
+
+func getColumnMappingType(columnInfo *ColumnInfo, isNullable bool) (columnMappingType string) {
+	switch columnInfo.DATA_TYPE {
+	case "tinyint":
+		if columnInfo.Unsigned {
+			columnMappingType = "uint8"
+		} else {
+			if columnInfo.COLUMN_TYPE == "tinyint(1)" {
+				columnMappingType = "bool"
 			} else {
-				columnMappingType = "int64"
+				columnMappingType = "int8"
 			}
-		case "numeric":
-			columnMappingType = strings.Replace(COLUMN_TYPE, "numeric", "decimal", 1)
-		case "real":
-			columnMappingType = strings.Replace(COLUMN_TYPE, "real", "double", 1)
-		default:
-			columnMappingType = COLUMN_TYPE
-			break
 		}
-		if IS_NULLABLE == "YES" {
-			columnMappingType = "Nullable(" + columnMappingType + ")"
+	case "smallint":
+		if columnInfo.Unsigned {
+			columnMappingType = "uint16"
+		} else {
+			columnMappingType = "int16"
+		}
+	case "mediumint":
+		if columnInfo.Unsigned {
+			columnMappingType = "uint24"
+		} else {
+			columnMappingType = "int24"
+		}
+	case "int":
+		if columnInfo.Unsigned {
+			columnMappingType = "uint32"
+		} else {
+			columnMappingType = "int32"
+		}
+	case "bigint":
+		if columnInfo.Unsigned {
+			columnMappingType = "uint64"
+		} else {
+			columnMappingType = "int64"
 		}
-		ColumnMapping[COLUMN_NAME] = columnMappingType
+	case "numeric":
+		columnMappingType = strings.Replace(columnInfo.COLUMN_TYPE, "numeric", "decimal", 1)
+	case "real":
+		columnMappingType = strings.Replace(columnInfo.COLUMN_TYPE, "real", "double", 1)
+	default:
+		columnMappingType = columnInfo.COLUMN_TYPE
+		break
 	}
-	if len(tableInfo.ColumnSchemaTypeList) == 0 {
-		return fmt.Errorf("column len is 0 " + "db:" + database + " table:" + tablename + " tableId:" + fmt.Sprint(tableId) + " may be no privilege")
+	if isNullable {
+		columnMappingType = "Nullable(" + columnMappingType + ")"
 	}
-	tableInfo.needReload = false
-	tableInfo.ColumnMapping = ColumnMapping
-	parser.tableSchemaMap[tableId] = tableInfo
-	errs = nil
 	return
 }
 
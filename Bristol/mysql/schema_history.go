@@ -0,0 +1,406 @@
+package mysql
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 表结构历史中的一个版本，从 BinlogFileName,BinlogPosition 这个位点开始生效
+// Table 为 nil 的时候，表示这个表在这个位点被删除了, Unknown 为 true 的时候 表示这个位点的 DDL 不能离线解析, 之后的表结构未知
+type SchemaHistoryVersion struct {
+	BinlogFileName string
+	BinlogPosition uint32
+	Charset        string // 表默认字符集，用于 ALTER 新增字段未指定字符集的时候计算字段长度
+	Table          *tableStruct
+	Unknown        bool `json:",omitempty"`
+}
+
+// 离线表结构历史
+// 历史为空的时候, 在开始解析的位点 以 information_schema 中 同步的表 的表结构作为快照，之后根据 binlog 中的 DDL 语句生成新的版本
+// 解析任意历史位点的 row 事件的时候，都使用当时生效的那个版本的表结构，而不是直接查询源端当前的表结构
+type SchemaHistory struct {
+	sync.RWMutex
+	Tables  map[string][]*SchemaHistoryVersion // schema.table 做为key,版本按位点从小到大排序
+	version uint64                             // 每次有变更都会 +1，用于上层判断是否需要重新持久化
+}
+
+func NewSchemaHistory() *SchemaHistory {
+	return &SchemaHistory{
+		Tables: make(map[string][]*SchemaHistoryVersion, 0),
+	}
+}
+
+func getSchemaHistoryKey(schemaName, tableName string) string {
+	return schemaName + "." + tableName
+}
+
+// binlog 文件名 按后缀数字进行比较，相等的情况下再比较 position
+func compareBinlogPosition(fileName1 string, position1 uint32, fileName2 string, position2 uint32) int {
+	if fileName1 != fileName2 {
+		if fileName1 == "" {
+			return -1
+		}
+		if fileName2 == "" {
+			return 1
+		}
+		num1, err1 := strconv.ParseUint(fileName1[strings.LastIndex(fileName1, ".")+1:], 10, 64)
+		num2, err2 := strconv.ParseUint(fileName2[strings.LastIndex(fileName2, ".")+1:], 10, 64)
+		if err1 != nil || err2 != nil {
+			return strings.Compare(fileName1, fileName2)
+		}
+		if num1 < num2 {
+			return -1
+		}
+		if num1 > num2 {
+			return 1
+		}
+	}
+	if position1 < position2 {
+		return -1
+	}
+	if position1 > position2 {
+		return 1
+	}
+	return 0
+}
+
+// 版本号,每次变更都会增加
+func (This *SchemaHistory) Version() uint64 {
+	This.RLock()
+	defer This.RUnlock()
+	return This.version
+}
+
+func (This *SchemaHistory) Encode() ([]byte, error) {
+	This.RLock()
+	defer This.RUnlock()
+	return json.Marshal(This.Tables)
+}
+
+func (This *SchemaHistory) Decode(data []byte) error {
+	tables := make(map[string][]*SchemaHistoryVersion, 0)
+	if err := json.Unmarshal(data, &tables); err != nil {
+		return err
+	}
+	This.Lock()
+	defer This.Unlock()
+	This.Tables = tables
+	This.version++
+	return nil
+}
+
+// 获取 在 指定位点 生效的版本
+// 假如指定的位点比第一个版本还要小，则返回第一个版本，因为第一个版本是启动时候的快照，没有更早的表结构信息了
+// before 为 true 的时候，只获取 指定位点之前 的版本，不包括 指定位点 的版本，用于重复解析同一个 DDL 的时候，基于 DDL 之前的表结构进行修改
+func (This *SchemaHistory) getVersion(key string, fileName string, position uint32, before bool) *SchemaHistoryVersion {
+	versionList := This.Tables[key]
+	if len(versionList) == 0 {
+		return nil
+	}
+	i := sort.Search(len(versionList), func(i int) bool {
+		c := compareBinlogPosition(versionList[i].BinlogFileName, versionList[i].BinlogPosition, fileName, position)
+		if before {
+			return c >= 0
+		}
+		return c > 0
+	})
+	if i == 0 {
+		if before {
+			return nil
+		}
+		return versionList[0]
+	}
+	return versionList[i-1]
+}
+
+// 获取 指定位点 生效的表结构，表不存在或者已经被删除，则返回 false
+func (This *SchemaHistory) GetTable(schemaName, tableName string, fileName string, position uint32) (*tableStruct, bool) {
+	This.RLock()
+	defer This.RUnlock()
+	v := This.getVersion(getSchemaHistoryKey(schemaName, tableName), fileName, position, false)
+	if v == nil || v.Table == nil {
+		return nil, false
+	}
+	return v.Table, true
+}
+
+// 指定位点 表结构 是否未知, 未知则返回 DDL 所在的版本
+func (This *SchemaHistory) GetUnknownVersion(schemaName, tableName string, fileName string, position uint32) *SchemaHistoryVersion {
+	This.RLock()
+	defer This.RUnlock()
+	v := This.getVersion(getSchemaHistoryKey(schemaName, tableName), fileName, position, false)
+	if v == nil || !v.Unknown {
+		return nil
+	}
+	return v
+}
+
+// 是否 没有任何表的历史记录
+func (This *SchemaHistory) IsEmpty() bool {
+	This.RLock()
+	defer This.RUnlock()
+	return len(This.Tables) == 0
+}
+
+// 是否有这个表的历史记录,包括被删除的
+func (This *SchemaHistory) HasTable(schemaName, tableName string) bool {
+	This.RLock()
+	defer This.RUnlock()
+	return len(This.Tables[getSchemaHistoryKey(schemaName, tableName)]) > 0
+}
+
+// 新增一个版本，位点相同的版本会被覆盖，主要是重新从旧的位点开始解析的时候，同一个DDL会被重复解析
+func (This *SchemaHistory) addVersion(key string, v *SchemaHistoryVersion) {
+	versionList := This.Tables[key]
+	i := sort.Search(len(versionList), func(i int) bool {
+		return compareBinlogPosition(versionList[i].BinlogFileName, versionList[i].BinlogPosition, v.BinlogFileName, v.BinlogPosition) >= 0
+	})
+	if i < len(versionList) && compareBinlogPosition(versionList[i].BinlogFileName, versionList[i].BinlogPosition, v.BinlogFileName, v.BinlogPosition) == 0 {
+		versionList[i] = v
+	} else {
+		versionList = append(versionList, nil)
+		copy(versionList[i+1:], versionList[i:])
+		versionList[i] = v
+	}
+	This.Tables[key] = versionList
+	This.version++
+}
+
+func (This *SchemaHistory) AddTable(schemaName, tableName string, fileName string, position uint32, table *tableStruct, charset string) {
+	This.Lock()
+	defer This.Unlock()
+	This.addVersion(getSchemaHistoryKey(schemaName, tableName), &SchemaHistoryVersion{
+		BinlogFileName: fileName,
+		BinlogPosition: position,
+		Charset:        charset,
+		Table:          table,
+	})
+}
+
+// 标记 表结构 从这个位点开始 未知
+func (This *SchemaHistory) AddUnknownTable(schemaName, tableName string, fileName string, position uint32) {
+	This.Lock()
+	defer This.Unlock()
+	This.addVersion(getSchemaHistoryKey(schemaName, tableName), &SchemaHistoryVersion{
+		BinlogFileName: fileName,
+		BinlogPosition: position,
+		Unknown:        true,
+	})
+}
+
+// 深拷贝，历史版本中的表结构是不能被修改的
+func (t *tableStruct) copy() *tableStruct {
+	newTable := &tableStruct{
+		SchemaName:           t.SchemaName,
+		TableName:            t.TableName,
+		ColumnSchemaTypeList: make([]*ColumnInfo, 0, len(t.ColumnSchemaTypeList)),
+	}
+	for _, columnInfo := range t.ColumnSchemaTypeList {
+		newColumnInfo := *columnInfo
+		newColumnInfo.EnumValues = append([]string{}, columnInfo.EnumValues...)
+		newColumnInfo.SetValues = append([]string{}, columnInfo.SetValues...)
+		newTable.ColumnSchemaTypeList = append(newTable.ColumnSchemaTypeList, &newColumnInfo)
+	}
+	newTable.rebuild()
+	return newTable
+}
+
+// 表的默认字符集，从源端查询的表结构中没有表的字符集，取第一个字符串字段的字符集
+func getTableCharset(t *tableStruct) string {
+	for _, columnInfo := range t.ColumnSchemaTypeList {
+		if columnInfo.CHARACTER_SET_NAME != "" {
+			return columnInfo.CHARACTER_SET_NAME
+		}
+	}
+	return ""
+}
+
+// 从表结构历史中获取 当前位点 生效的表结构
+// 历史中没有这个表的时候，查询源端当前的表结构做为这个位点的版本, 比如 快照之后 新加入同步的表
+// 表结构未知, 或者 字段数和 TABLE_MAP_EVENT 中的字段数不一致 的时候 返回 error, 不能使用 源端当前的表结构 解析历史数据
+// 查询源端表结构失败的时候返回 error，不能记录到历史中，否则会被当作这个位点 表被删除了
+func (parser *eventParser) GetTableSchemaFromHistory(tableMapEvent *TableMapEvent) error {
+	database, tablename, position := tableMapEvent.schemaName, tableMapEvent.tableName, tableMapEvent.header.LogPos
+	if v := parser.schemaHistory.GetUnknownVersion(database, tablename, parser.currentBinlogFileName, position); v != nil {
+		return fmt.Errorf("table %s.%s schema unknown, ddl can't be parsed at binlogFileName:%s binlogPosition:%d", database, tablename, v.BinlogFileName, v.BinlogPosition)
+	}
+	tableInfo, ok := parser.schemaHistory.GetTable(database, tablename, parser.currentBinlogFileName, position)
+	if ok && len(tableInfo.ColumnSchemaTypeList) == len(tableMapEvent.columnTypes) {
+		parser.binlogDump.Lock()
+		parser.tableNameMap[database+"."+tablename] = tableMapEvent.tableId
+		parser.tableSchemaMap[tableMapEvent.tableId] = tableInfo
+		parser.binlogDump.Unlock()
+		return nil
+	}
+	if ok {
+		return fmt.Errorf("table %s.%s schema history column count:%d != table map column count:%d", database, tablename, len(tableInfo.ColumnSchemaTypeList), len(tableMapEvent.columnTypes))
+	}
+	// 离线解析本地 binlog 文件,不能查询源端,由 row 事件解析的时候报错
+	if parser.offline {
+		log.Println("binlog schema history not found table:", database+"."+tablename, " binlogFileName:", parser.currentBinlogFileName, " binlogPosition:", position)
+		parser.binlogDump.Lock()
+		delete(parser.tableSchemaMap, tableMapEvent.tableId)
+		parser.binlogDump.Unlock()
+		return nil
+	}
+	parser.GetTableSchema(tableMapEvent.tableId, database, tablename)
+	parser.binlogDump.Lock()
+	tableInfo = parser.tableSchemaMap[tableMapEvent.tableId]
+	parser.binlogDump.Unlock()
+	if tableInfo == nil {
+		return fmt.Errorf("load table schema failed, database:%s tablename:%s", database, tablename)
+	}
+	parser.schemaHistory.AddTable(database, tablename, parser.currentBinlogFileName, position, tableInfo, getTableCharset(tableInfo))
+	return nil
+}
+
+// 根据 DDL 更新表结构历史，不能离线解析的 DDL 则标记 表结构未知, 不使用 源端当前的表结构
+func (parser *eventParser) saveSchemaHistoryByDDL(event *EventReslut) {
+	schemaName, tableName, err := parser.schemaHistory.ApplyDDL(event.SchemaName, event.Query, event.BinlogFileName, event.Header.LogPos)
+	if err == nil {
+		return
+	}
+	log.Println("binlog schema history apply ddl err:", err, " query:", event.Query, " binlogFileName:", event.BinlogFileName, " binlogPosition:", event.Header.LogPos)
+	if tableName == "" {
+		return
+	}
+	parser.schemaHistory.AddUnknownTable(schemaName, tableName, event.BinlogFileName, event.Header.LogPos)
+}
+
+// 表结构历史 为空的时候, 在开始解析的位点 记录 所有同步的表 当前的表结构 做为快照
+// 之后 DDL 的版本 都基于这个快照, 不会在 第一次解析到 row 事件 的时候 才使用 源端当前的表结构
+func (parser *eventParser) initSchemaHistorySnapshot() error {
+	if parser.schemaHistory == nil || parser.offline || !parser.schemaHistory.IsEmpty() {
+		return nil
+	}
+	tableList, err := parser.loadTableList()
+	if err != nil {
+		return fmt.Errorf("schema history snapshot load table list err:%s", err)
+	}
+	for schemaName, tableNameList := range tableList {
+		for _, tableName := range tableNameList {
+			if !parser.binlogDump.CheckReplicateDb(schemaName, tableName) {
+				continue
+			}
+			tableInfo, err := parser.loadTableSchema(schemaName, tableName)
+			if err != nil {
+				return fmt.Errorf("schema history snapshot load table %s.%s schema err:%s", schemaName, tableName, err)
+			}
+			parser.schemaHistory.AddTable(schemaName, tableName, parser.binlogFileName, parser.binlogPosition, tableInfo, getTableCharset(tableInfo))
+		}
+	}
+	log.Println("binlog schema history snapshot at binlogFileName:", parser.binlogFileName, " binlogPosition:", parser.binlogPosition)
+	return nil
+}
+
+// 导入 表结构快照,比如 mysqldump --no-data 导出的 CREATE TABLE 语句
+// 快照中的表结构做为 所有位点之前 的版本, USE db 语句用于指定之后的语句默认的库
+func (This *SchemaHistory) ImportSQL(sql string) error {
+	var defaultSchema string
+	for _, query := range splitSqlStatements(sql) {
+		tokens, err := ddlTokenize(query)
+		if err != nil {
+			return err
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+		if tokens[0].is("USE") {
+			p := &ddlParser{tokens: tokens[1:]}
+			if defaultSchema, err = p.ident(); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, _, err = This.ApplyDDL(defaultSchema, query, "", 0); err != nil {
+			return fmt.Errorf("%s ; query:%s", err, query)
+		}
+	}
+	return nil
+}
+
+// 最新版本中存在的表, schemaName => tableName list
+func (This *SchemaHistory) GetTableList() map[string][]string {
+	This.RLock()
+	defer This.RUnlock()
+	tableList := make(map[string][]string, 0)
+	for _, versionList := range This.Tables {
+		if len(versionList) == 0 || versionList[len(versionList)-1].Table == nil {
+			continue
+		}
+		table := versionList[len(versionList)-1].Table
+		tableList[table.SchemaName] = append(tableList[table.SchemaName], table.TableName)
+	}
+	for schemaName := range tableList {
+		sort.Strings(tableList[schemaName])
+	}
+	return tableList
+}
+
+// 最新版本的表字段列表,表不存在或者已经被删除,则返回 false
+func (This *SchemaHistory) GetLastTableColumns(schemaName, tableName string) ([]*ColumnInfo, bool) {
+	This.RLock()
+	defer This.RUnlock()
+	versionList := This.Tables[getSchemaHistoryKey(schemaName, tableName)]
+	if len(versionList) == 0 || versionList[len(versionList)-1].Table == nil {
+		return nil, false
+	}
+	return versionList[len(versionList)-1].Table.ColumnSchemaTypeList, true
+}
+
+// 按 ; 拆分多个 SQL 语句,引号及注释中的 ; 不拆分, 支持 mysqldump 中的 DELIMITER 语句
+func splitSqlStatements(sql string) (list []string) {
+	delimiter := ";"
+	var start int
+	appendStatement := func(end int) {
+		if query := strings.TrimSpace(sql[start:end]); query != "" {
+			list = append(list, query)
+		}
+	}
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			for i++; i < len(sql) && sql[i] != c; i++ {
+				if sql[i] == '\\' && c != '`' {
+					i++
+				}
+			}
+			i++
+		case c == '#' || strings.HasPrefix(sql[i:], "-- "):
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(sql[i:], "/*"):
+			if end := strings.Index(sql[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(sql)
+			}
+		case (i == 0 || sql[i-1] == '\n') && len(sql)-i > 10 && strings.EqualFold(sql[i:i+10], "DELIMITER "):
+			appendStatement(i)
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql) - i
+			}
+			if delimiter = strings.TrimSpace(sql[i+10 : i+end]); delimiter == "" {
+				delimiter = ";"
+			}
+			i += end
+			start = i
+		case strings.HasPrefix(sql[i:], delimiter):
+			appendStatement(i)
+			i += len(delimiter)
+			start = i
+		default:
+			i++
+		}
+	}
+	appendStatement(len(sql))
+	return
+}
@@ -0,0 +1,1137 @@
+package mysql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 不能离线解析的 DDL，比如 CREATE TABLE ... SELECT，需要上层查询源端的表结构
+var ErrSchemaHistoryDDLNotSupported = fmt.Errorf("ddl not supported by schema history")
+
+const (
+	ddlTokenIdent = iota
+	ddlTokenQuotedIdent
+	ddlTokenString
+	ddlTokenNumber
+	ddlTokenSymbol
+)
+
+type ddlToken struct {
+	typ int
+	val string
+}
+
+// 是否为指定的关键字，反引号括起来的不是关键字
+func (t ddlToken) is(keyword string) bool {
+	return t.typ == ddlTokenIdent && strings.EqualFold(t.val, keyword)
+}
+
+func ddlTokenize(sql string) (tokens []ddlToken, err error) {
+	tokens = make([]ddlToken, 0)
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '#' || (c == '-' && strings.HasPrefix(sql[i:], "-- ")):
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			// /*!50100 ... */ 这类注释里一般是分区等表选项，对字段结构没有影响，直接跳过
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("comment not closed")
+			}
+			i += end + 4
+		case c == '`':
+			var val strings.Builder
+			i++
+			for {
+				if i >= len(sql) {
+					return nil, fmt.Errorf("identifier not closed")
+				}
+				if sql[i] == '`' {
+					if i+1 < len(sql) && sql[i+1] == '`' {
+						val.WriteByte('`')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				val.WriteByte(sql[i])
+				i++
+			}
+			tokens = append(tokens, ddlToken{typ: ddlTokenQuotedIdent, val: val.String()})
+		case c == '\'' || c == '"':
+			var val strings.Builder
+			i++
+			for {
+				if i >= len(sql) {
+					return nil, fmt.Errorf("string not closed")
+				}
+				if sql[i] == '\\' && i+1 < len(sql) {
+					val.WriteByte(sql[i+1])
+					i += 2
+					continue
+				}
+				if sql[i] == c {
+					if i+1 < len(sql) && sql[i+1] == c {
+						val.WriteByte(c)
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				val.WriteByte(sql[i])
+				i++
+			}
+			tokens = append(tokens, ddlToken{typ: ddlTokenString, val: val.String()})
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(sql) && ((sql[i] >= '0' && sql[i] <= '9') || sql[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, ddlToken{typ: ddlTokenNumber, val: sql[start:i]})
+		case c == '_' || c == '$' || c >= 0x80 || (c|0x20 >= 'a' && c|0x20 <= 'z'):
+			start := i
+			for i < len(sql) {
+				c = sql[i]
+				if c == '_' || c == '$' || c >= 0x80 || (c|0x20 >= 'a' && c|0x20 <= 'z') || (c >= '0' && c <= '9') {
+					i++
+					continue
+				}
+				break
+			}
+			tokens = append(tokens, ddlToken{typ: ddlTokenIdent, val: sql[start:i]})
+		default:
+			tokens = append(tokens, ddlToken{typ: ddlTokenSymbol, val: string(c)})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+type ddlParser struct {
+	tokens []ddlToken
+	pos    int
+}
+
+func (p *ddlParser) eof() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *ddlParser) peek() ddlToken {
+	if p.eof() {
+		return ddlToken{typ: ddlTokenSymbol, val: ""}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *ddlParser) next() ddlToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *ddlParser) isKeyword(keywords ...string) bool {
+	t := p.peek()
+	for _, keyword := range keywords {
+		if t.is(keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *ddlParser) acceptKeyword(keywords ...string) bool {
+	if p.isKeyword(keywords...) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *ddlParser) isSymbol(symbol string) bool {
+	t := p.peek()
+	return t.typ == ddlTokenSymbol && t.val == symbol
+}
+
+func (p *ddlParser) acceptSymbol(symbol string) bool {
+	if p.isSymbol(symbol) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *ddlParser) ident() (string, error) {
+	t := p.next()
+	switch t.typ {
+	case ddlTokenIdent, ddlTokenQuotedIdent, ddlTokenString:
+		return t.val, nil
+	default:
+		return "", fmt.Errorf("expect identifier but got %q", t.val)
+	}
+}
+
+// schema.table 或者 table
+func (p *ddlParser) tableName(defaultSchema string) (schemaName, tableName string, err error) {
+	if tableName, err = p.ident(); err != nil {
+		return
+	}
+	if p.acceptSymbol(".") {
+		schemaName = tableName
+		tableName, err = p.ident()
+		return
+	}
+	return defaultSchema, tableName, nil
+}
+
+// 跳过 括号 里的所有内容，当前位置必须是 (
+func (p *ddlParser) skipParens() {
+	depth := 0
+	for !p.eof() {
+		t := p.next()
+		if t.typ != ddlTokenSymbol {
+			continue
+		}
+		switch t.val {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth <= 0 {
+				return
+			}
+		}
+	}
+}
+
+// 跳到 当前层级 下一个 , 或者 ) 的位置，不消费 , 和 )
+func (p *ddlParser) skipToNextDefinition() {
+	for !p.eof() {
+		if p.isSymbol(",") || p.isSymbol(")") || p.isSymbol(";") {
+			return
+		}
+		if p.isSymbol("(") {
+			p.skipParens()
+			continue
+		}
+		p.pos++
+	}
+}
+
+// 索引字段列表 (a,b(10) DESC,...)
+func (p *ddlParser) keyPartList() (columns []string, err error) {
+	if !p.acceptSymbol("(") {
+		return nil, fmt.Errorf("expect ( for key part list")
+	}
+	for {
+		if p.isSymbol("(") {
+			// 函数索引，没有具体字段
+			p.skipParens()
+		} else {
+			var name string
+			if name, err = p.ident(); err != nil {
+				return
+			}
+			columns = append(columns, name)
+			if p.isSymbol("(") {
+				p.skipParens()
+			}
+			p.acceptKeyword("ASC", "DESC")
+		}
+		if p.acceptSymbol(",") {
+			continue
+		}
+		if p.acceptSymbol(")") {
+			return
+		}
+		return nil, fmt.Errorf("unexpected %q in key part list", p.peek().val)
+	}
+}
+
+// 字符集 最大占用字节数,和 information_schema.CHARACTER_SETS 中的 MAXLEN 一致
+func getCharsetMaxLen(charset string) uint64 {
+	switch strings.ToLower(charset) {
+	case "latin1", "latin2", "latin5", "latin7", "ascii", "binary", "cp1250", "cp1251", "cp1256", "cp1257", "cp850", "cp852", "cp866", "dec8", "greek", "hebrew", "hp8", "keybcs2", "koi8r", "koi8u", "macce", "macroman", "swe7", "tis620", "armscii8", "geostd8":
+		return 1
+	case "gbk", "gb2312", "big5", "cp932", "sjis", "euckr", "ucs2":
+		return 2
+	case "utf8", "utf8mb3", "ujis", "eucjpms":
+		return 3
+	default:
+		return 4
+	}
+}
+
+// 从 COLLATE 中获取字符集名称, utf8mb4_general_ci => utf8mb4
+func getCharsetByCollation(collation string) string {
+	if i := strings.Index(collation, "_"); i > 0 {
+		return strings.ToLower(collation[:i])
+	}
+	return strings.ToLower(collation)
+}
+
+// [DEFAULT] CHARACTER SET [=] x , [DEFAULT] CHARSET [=] x , [DEFAULT] COLLATE [=] x
+// isCollate 为 true 的时候，返回的是 COLLATE 名称
+func (p *ddlParser) charsetOption() (charset string, isCollate bool, ok bool) {
+	start := p.pos
+	p.acceptKeyword("DEFAULT")
+	switch {
+	case p.acceptKeyword("CHARSET"):
+	case p.isKeyword("CHARACTER") && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].is("SET"):
+		p.pos += 2
+	case p.acceptKeyword("COLLATE"):
+		isCollate = true
+	default:
+		p.pos = start
+		return "", false, false
+	}
+	p.acceptSymbol("=")
+	name, err := p.ident()
+	if err != nil {
+		p.pos = start
+		return "", false, false
+	}
+	return strings.ToLower(name), isCollate, true
+}
+
+// 字段定义解析, 结果和 information_schema.columns 中的数据保持一致
+func (p *ddlParser) columnDefinition(tableCharset string) (columnInfo *ColumnInfo, err error) {
+	var name string
+	if name, err = p.ident(); err != nil {
+		return
+	}
+	var typeToken = p.next()
+	if typeToken.typ != ddlTokenIdent {
+		return nil, fmt.Errorf("column %s expect data type but got %q", name, typeToken.val)
+	}
+	dataType := strings.ToLower(typeToken.val)
+	var charset, collation string
+	var isNullable = true
+	var unsigned, zerofill, autoIncrement, isBool bool
+	var columnKey, columnDefault string
+	switch dataType {
+	case "double":
+		p.acceptKeyword("PRECISION")
+	case "character":
+		if p.acceptKeyword("VARYING") {
+			dataType = "varchar"
+		} else {
+			dataType = "char"
+		}
+	case "national":
+		charset = "utf8"
+		if p.acceptKeyword("VARCHAR") || p.isKeyword("CHAR", "CHARACTER") && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].is("VARYING") {
+			p.acceptKeyword("CHAR", "CHARACTER")
+			p.acceptKeyword("VARYING")
+			dataType = "varchar"
+		} else {
+			p.acceptKeyword("CHAR", "CHARACTER")
+			dataType = "char"
+		}
+	case "nchar":
+		charset = "utf8"
+		if p.acceptKeyword("VARCHAR", "VARYING") {
+			dataType = "varchar"
+		} else {
+			dataType = "char"
+		}
+	case "nvarchar":
+		charset = "utf8"
+		dataType = "varchar"
+	case "long":
+		if p.acceptKeyword("VARBINARY") {
+			dataType = "mediumblob"
+		} else {
+			p.acceptKeyword("VARCHAR")
+			dataType = "mediumtext"
+		}
+	}
+	switch dataType {
+	case "bool", "boolean":
+		dataType, isBool = "tinyint", true
+	case "integer", "int4":
+		dataType = "int"
+	case "int1":
+		dataType = "tinyint"
+	case "int2":
+		dataType = "smallint"
+	case "int3", "middleint":
+		dataType = "mediumint"
+	case "int8":
+		dataType = "bigint"
+	case "dec", "numeric", "fixed":
+		dataType = "decimal"
+	case "real", "float8":
+		dataType = "double"
+	case "float4":
+		dataType = "float"
+	case "serial":
+		dataType, unsigned, autoIncrement, isNullable = "bigint", true, true, false
+	}
+	var args []string
+	if p.acceptSymbol("(") {
+		for !p.eof() && !p.acceptSymbol(")") {
+			t := p.next()
+			if t.typ == ddlTokenSymbol && t.val == "," {
+				continue
+			}
+			args = append(args, t.val)
+		}
+	}
+	// 类型修饰
+	for isModifier := true; isModifier; {
+		switch {
+		case p.acceptKeyword("UNSIGNED"):
+			unsigned = true
+		case p.acceptKeyword("ZEROFILL"):
+			zerofill, unsigned = true, true
+		case p.acceptKeyword("SIGNED", "BINARY", "ASCII", "UNICODE", "BYTE"):
+		default:
+			name, isCollate, ok := p.charsetOption()
+			if !ok {
+				isModifier = false
+				break
+			}
+			if !isCollate {
+				charset = name
+				break
+			}
+			collation = name
+			if charset == "" {
+				charset = getCharsetByCollation(name)
+			}
+		}
+	}
+	// 字段属性, 遇到 , ) FIRST AFTER 的时候结束
+	for !p.eof() && !p.isSymbol(",") && !p.isSymbol(")") && !p.isSymbol(";") && !p.isKeyword("FIRST", "AFTER") {
+		switch {
+		case p.acceptKeyword("NOT"):
+			if p.acceptKeyword("NULL") {
+				isNullable = false
+			}
+		case p.acceptKeyword("NULL"):
+			isNullable = true
+		case p.acceptKeyword("AUTO_INCREMENT"):
+			autoIncrement = true
+		case p.acceptKeyword("PRIMARY"):
+			p.acceptKeyword("KEY")
+			columnKey, isNullable = "PRI", false
+		case p.acceptKeyword("UNIQUE"):
+			p.acceptKeyword("KEY")
+		case p.acceptKeyword("KEY"):
+			columnKey, isNullable = "PRI", false
+		case p.acceptKeyword("DEFAULT"):
+			columnDefault = p.defaultValue()
+		case p.acceptKeyword("ON"):
+			// ON UPDATE CURRENT_TIMESTAMP
+			p.acceptKeyword("UPDATE")
+			p.defaultValue()
+		case p.isSymbol("("):
+			p.skipParens()
+		default:
+			p.pos++
+		}
+	}
+	columnType := ddlFormatColumnType(dataType, args, unsigned, zerofill, isBool)
+	columnInfo = newColumnInfo(name, columnKey, columnType, dataType, "")
+	columnInfo.AutoIncrement = autoIncrement
+	columnInfo.IsNullable = isNullable
+	columnInfo.COLUMN_DEFAULT = columnDefault
+	columnInfo.NUMERIC_SCALE = ddlNumericScale(dataType, args)
+	if ddlIsStringType(dataType) {
+		if charset == "" {
+			charset = tableCharset
+		}
+		if charset == "" {
+			charset = "utf8mb4"
+		}
+		columnInfo.CHARACTER_SET_NAME = charset
+		columnInfo.COLLATION_NAME = collation
+	}
+	columnInfo.CHARACTER_OCTET_LENGTH = ddlCharacterOctetLength(columnInfo)
+	return
+}
+
+// DEFAULT 值, 字符串及数字返回对应的值，NULL 返回空, 函数返回函数名
+func (p *ddlParser) defaultValue() string {
+	t := p.next()
+	switch t.typ {
+	case ddlTokenString, ddlTokenNumber:
+		return t.val
+	case ddlTokenSymbol:
+		switch t.val {
+		case "(":
+			p.pos--
+			p.skipParens()
+		case "-", "+":
+			n := p.next()
+			if t.val == "-" {
+				return "-" + n.val
+			}
+			return n.val
+		}
+		return ""
+	default:
+		if t.is("NULL") {
+			return ""
+		}
+		// b'0101' , x'0A' , _utf8mb4'xxx'
+		if p.peek().typ == ddlTokenString {
+			return p.next().val
+		}
+		if p.isSymbol("(") {
+			p.skipParens()
+		}
+		return strings.ToUpper(t.val)
+	}
+}
+
+func ddlIsStringType(dataType string) bool {
+	switch dataType {
+	case "char", "varchar", "tinytext", "text", "mediumtext", "longtext", "enum", "set":
+		return true
+	}
+	return false
+}
+
+func ddlFormatColumnType(dataType string, args []string, unsigned, zerofill, isBool bool) (columnType string) {
+	switch dataType {
+	case "tinyint", "smallint", "mediumint", "int", "bigint":
+		if isBool {
+			return "tinyint(1)"
+		}
+		columnType = dataType
+		if len(args) > 0 {
+			columnType += "(" + args[0] + ")"
+		}
+	case "decimal":
+		switch len(args) {
+		case 0:
+			columnType = "decimal(10,0)"
+		case 1:
+			columnType = "decimal(" + args[0] + ",0)"
+		default:
+			columnType = "decimal(" + args[0] + "," + args[1] + ")"
+		}
+	case "float", "double":
+		columnType = dataType
+		if len(args) >= 2 {
+			columnType += "(" + args[0] + "," + args[1] + ")"
+		}
+	case "char", "binary", "bit":
+		if len(args) == 0 {
+			args = []string{"1"}
+		}
+		columnType = dataType + "(" + args[0] + ")"
+	case "varchar", "varbinary", "datetime", "timestamp", "time":
+		columnType = dataType
+		if len(args) > 0 && args[0] != "0" {
+			columnType += "(" + args[0] + ")"
+		}
+	case "enum", "set":
+		values := make([]string, len(args))
+		for i, v := range args {
+			values[i] = "'" + strings.Replace(v, "'", "''", -1) + "'"
+		}
+		columnType = dataType + "(" + strings.Join(values, ",") + ")"
+	default:
+		columnType = dataType
+	}
+	if unsigned {
+		switch dataType {
+		case "tinyint", "smallint", "mediumint", "int", "bigint", "decimal", "float", "double":
+			columnType += " unsigned"
+			if zerofill {
+				columnType += " zerofill"
+			}
+		}
+	}
+	return
+}
+
+func ddlNumericScale(dataType string, args []string) string {
+	switch dataType {
+	case "tinyint", "smallint", "mediumint", "int", "bigint":
+		return "0"
+	case "decimal":
+		if len(args) >= 2 {
+			return args[1]
+		}
+		return "0"
+	case "float", "double":
+		if len(args) >= 2 {
+			return args[1]
+		}
+	}
+	return ""
+}
+
+func ddlCharacterOctetLength(columnInfo *ColumnInfo) uint64 {
+	var length uint64
+	switch columnInfo.DATA_TYPE {
+	case "char", "varchar", "binary", "varbinary":
+		if i := strings.Index(columnInfo.COLUMN_TYPE, "("); i > 0 {
+			length, _ = strconv.ParseUint(strings.TrimRight(columnInfo.COLUMN_TYPE[i+1:], ")"), 10, 64)
+		}
+		if columnInfo.DATA_TYPE == "binary" || columnInfo.DATA_TYPE == "varbinary" {
+			return length
+		}
+	case "tinytext", "tinyblob":
+		return 255
+	case "text", "blob":
+		return 65535
+	case "mediumtext", "mediumblob":
+		return 16777215
+	case "longtext", "longblob":
+		return 4294967295
+	case "enum":
+		for _, v := range columnInfo.EnumValues {
+			if uint64(len(v)) > length {
+				length = uint64(len(v))
+			}
+		}
+	case "set":
+		for i, v := range columnInfo.SetValues {
+			if i > 0 {
+				length++
+			}
+			length += uint64(len(v))
+		}
+	default:
+		return 0
+	}
+	return length * getCharsetMaxLen(columnInfo.CHARACTER_SET_NAME)
+}
+
+// 一个 DDL 语句 对表结构历史的修改，在整个语句解析完成之后才一起提交
+// 同一个语句中可能对同一个表修改多次，比如 RENAME TABLE a TO tmp, b TO a, tmp TO b
+type schemaHistoryDDL struct {
+	history       *SchemaHistory
+	defaultSchema string
+	fileName      string
+	position      uint32
+	changes       map[string]*SchemaHistoryVersion
+	changeKeys    []string
+}
+
+func (d *schemaHistoryDDL) getVersion(schemaName, tableName string) *SchemaHistoryVersion {
+	key := getSchemaHistoryKey(schemaName, tableName)
+	if v, ok := d.changes[key]; ok {
+		return v
+	}
+	d.history.RLock()
+	defer d.history.RUnlock()
+	return d.history.getVersion(key, d.fileName, d.position, true)
+}
+
+func (d *schemaHistoryDDL) setTable(schemaName, tableName string, table *tableStruct, charset string) {
+	key := getSchemaHistoryKey(schemaName, tableName)
+	if _, ok := d.changes[key]; !ok {
+		d.changeKeys = append(d.changeKeys, key)
+	}
+	if table != nil {
+		table.SchemaName = schemaName
+		table.TableName = tableName
+		table.rebuild()
+	}
+	d.changes[key] = &SchemaHistoryVersion{
+		BinlogFileName: d.fileName,
+		BinlogPosition: d.position,
+		Charset:        charset,
+		Table:          table,
+	}
+}
+
+func (d *schemaHistoryDDL) dropTable(schemaName, tableName string) {
+	if v := d.getVersion(schemaName, tableName); v == nil || v.Table == nil {
+		return
+	}
+	d.setTable(schemaName, tableName, nil, "")
+}
+
+func (d *schemaHistoryDDL) commit() {
+	if len(d.changeKeys) == 0 {
+		return
+	}
+	d.history.Lock()
+	defer d.history.Unlock()
+	for _, key := range d.changeKeys {
+		d.history.addVersion(key, d.changes[key])
+	}
+}
+
+// 解析 DDL 语句，并且更新表结构历史
+// 只离线解析以下语句，其他修改表结构的语句 返回 ErrSchemaHistoryDDLNotSupported
+//
+//	CREATE TABLE [IF NOT EXISTS] t (字段定义, PRIMARY KEY, UNIQUE KEY, KEY ...) 表选项
+//	CREATE TABLE t LIKE t2
+//	ALTER TABLE t ADD [COLUMN] 单个字段 [FIRST | AFTER x] , DROP [COLUMN] x , MODIFY [COLUMN] , CHANGE [COLUMN] , RENAME COLUMN x TO y , RENAME [TO] t2
+//	ALTER TABLE t ADD/DROP 普通索引 , ALGORITHM= , LOCK= , 不影响字段，忽略
+//	RENAME TABLE t TO t2 [, ...]
+//	DROP TABLE [IF EXISTS] t [, ...]
+//	DROP DATABASE [IF EXISTS] db
+//
+// 非 DDL 语句 或者 表结构历史中没有记录的表的 ALTER 等，直接忽略
+// 返回 ErrSchemaHistoryDDLNotSupported 或者 解析出错的时候, schemaName,tableName 为 DDL 对应的表，由上层标记 这个表 表结构未知
+func (This *SchemaHistory) ApplyDDL(defaultSchema, query string, fileName string, position uint32) (schemaName, tableName string, err error) {
+	tokens, err := ddlTokenize(query)
+	if err != nil {
+		return
+	}
+	p := &ddlParser{tokens: tokens}
+	d := &schemaHistoryDDL{
+		history:       This,
+		defaultSchema: defaultSchema,
+		fileName:      fileName,
+		position:      position,
+		changes:       make(map[string]*SchemaHistoryVersion, 0),
+	}
+	switch {
+	case p.acceptKeyword("CREATE"):
+		p.acceptKeyword("OR")
+		p.acceptKeyword("REPLACE")
+		if p.acceptKeyword("TEMPORARY") || !p.acceptKeyword("TABLE") {
+			return
+		}
+		schemaName, tableName, err = d.createTable(p)
+	case p.acceptKeyword("ALTER"):
+		p.acceptKeyword("ONLINE", "OFFLINE")
+		p.acceptKeyword("IGNORE")
+		if !p.acceptKeyword("TABLE") {
+			return
+		}
+		schemaName, tableName, err = d.alterTable(p)
+	case p.acceptKeyword("RENAME"):
+		if !p.acceptKeyword("TABLE", "TABLES") {
+			return
+		}
+		schemaName, tableName, err = d.renameTable(p)
+	case p.acceptKeyword("DROP"):
+		if p.acceptKeyword("DATABASE", "SCHEMA") {
+			p.acceptKeyword("IF")
+			p.acceptKeyword("EXISTS")
+			if schemaName, err = p.ident(); err == nil {
+				d.dropSchema(schemaName)
+			}
+			break
+		}
+		if p.acceptKeyword("TEMPORARY") || !p.acceptKeyword("TABLE", "TABLES") {
+			return
+		}
+		schemaName, tableName, err = d.dropTables(p)
+	default:
+		return
+	}
+	if err != nil {
+		return
+	}
+	d.commit()
+	return
+}
+
+func (d *schemaHistoryDDL) createTable(p *ddlParser) (schemaName, tableName string, err error) {
+	var ifNotExists bool
+	if p.acceptKeyword("IF") {
+		p.acceptKeyword("NOT")
+		p.acceptKeyword("EXISTS")
+		ifNotExists = true
+	}
+	if schemaName, tableName, err = p.tableName(d.defaultSchema); err != nil {
+		return
+	}
+	if v := d.getVersion(schemaName, tableName); ifNotExists && v != nil && v.Table != nil {
+		return
+	}
+	// CREATE TABLE a LIKE b , CREATE TABLE a (LIKE b)
+	hasParen := p.acceptSymbol("(")
+	if p.acceptKeyword("LIKE") {
+		var likeSchemaName, likeTableName string
+		if likeSchemaName, likeTableName, err = p.tableName(d.defaultSchema); err != nil {
+			return
+		}
+		v := d.getVersion(likeSchemaName, likeTableName)
+		if v == nil || v.Table == nil {
+			err = ErrSchemaHistoryDDLNotSupported
+			return
+		}
+		d.setTable(schemaName, tableName, v.Table.copy(), v.Charset)
+		return
+	}
+	if !hasParen {
+		// CREATE TABLE a SELECT ...
+		err = ErrSchemaHistoryDDLNotSupported
+		return
+	}
+	// 先把字段定义部分跳过，解析表选项中的字符集，字段未指定字符集的时候需要使用表的默认字符集
+	definitionStart := p.pos
+	p.pos--
+	p.skipParens()
+	var charset string
+	for !p.eof() {
+		if p.isKeyword("SELECT", "AS", "IGNORE", "REPLACE") {
+			err = ErrSchemaHistoryDDLNotSupported
+			return
+		}
+		if name, isCollate, ok := p.charsetOption(); ok {
+			if !isCollate {
+				charset = name
+			} else if charset == "" {
+				charset = getCharsetByCollation(name)
+			}
+			continue
+		}
+		if p.isSymbol("(") {
+			p.skipParens()
+			continue
+		}
+		p.pos++
+	}
+	p.pos = definitionStart
+	table := &tableStruct{
+		SchemaName:           schemaName,
+		TableName:            tableName,
+		ColumnSchemaTypeList: make([]*ColumnInfo, 0),
+	}
+	var primaryKey []string
+	var uniqueKeys [][]string
+	for {
+		switch {
+		case p.acceptKeyword("CONSTRAINT"):
+			if !p.isKeyword("PRIMARY", "UNIQUE", "FOREIGN", "CHECK") {
+				p.pos++
+			}
+			continue
+		case p.acceptKeyword("PRIMARY"):
+			p.acceptKeyword("KEY")
+			p.skipIndexName()
+			if primaryKey, err = p.keyPartList(); err != nil {
+				return
+			}
+		case p.acceptKeyword("UNIQUE"):
+			p.acceptKeyword("KEY", "INDEX")
+			p.skipIndexName()
+			var columns []string
+			if columns, err = p.keyPartList(); err != nil {
+				return
+			}
+			uniqueKeys = append(uniqueKeys, columns)
+		case p.isKeyword("KEY", "INDEX", "FULLTEXT", "SPATIAL", "FOREIGN", "CHECK"):
+		default:
+			var columnInfo *ColumnInfo
+			if columnInfo, err = p.columnDefinition(charset); err != nil {
+				return
+			}
+			table.ColumnSchemaTypeList = append(table.ColumnSchemaTypeList, columnInfo)
+		}
+		p.skipToNextDefinition()
+		if p.acceptSymbol(",") {
+			continue
+		}
+		if p.acceptSymbol(")") {
+			break
+		}
+		err = fmt.Errorf("unexpected %q in create table definition", p.peek().val)
+		return
+	}
+	// 没有主键的情况下，第一个 字段都是 NOT NULL 的唯一索引 在 information_schema 中会被当作主键
+	if primaryKey == nil && table.getPriColumnCount() == 0 {
+		for _, columns := range uniqueKeys {
+			if table.isNotNullColumns(columns) {
+				primaryKey = columns
+				break
+			}
+		}
+	}
+	table.setPrimaryKey(primaryKey)
+	d.setTable(schemaName, tableName, table, charset)
+	return
+}
+
+// 索引名称, 以及 USING BTREE
+func (p *ddlParser) skipIndexName() {
+	for !p.eof() && !p.isSymbol("(") {
+		p.pos++
+	}
+}
+
+func (t *tableStruct) getColumnIndex(columnName string) int {
+	for i, columnInfo := range t.ColumnSchemaTypeList {
+		if strings.EqualFold(columnInfo.COLUMN_NAME, columnName) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *tableStruct) getPriColumnCount() (n int) {
+	for _, columnInfo := range t.ColumnSchemaTypeList {
+		if columnInfo.COLUMN_KEY == "PRI" {
+			n++
+		}
+	}
+	return
+}
+
+func (t *tableStruct) isNotNullColumns(columns []string) bool {
+	for _, name := range columns {
+		i := t.getColumnIndex(name)
+		if i < 0 || t.ColumnSchemaTypeList[i].IsNullable {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *tableStruct) setPrimaryKey(columns []string) {
+	for _, name := range columns {
+		if i := t.getColumnIndex(name); i >= 0 {
+			t.ColumnSchemaTypeList[i].COLUMN_KEY = "PRI"
+			t.ColumnSchemaTypeList[i].IsPrimary = true
+			t.ColumnSchemaTypeList[i].IsNullable = false
+		}
+	}
+}
+
+// FIRST , AFTER x
+func (t *tableStruct) addColumnByPosition(p *ddlParser, columnInfo *ColumnInfo) error {
+	var index = len(t.ColumnSchemaTypeList)
+	if p.acceptKeyword("FIRST") {
+		index = 0
+	} else if p.acceptKeyword("AFTER") {
+		name, err := p.ident()
+		if err != nil {
+			return err
+		}
+		if index = t.getColumnIndex(name); index < 0 {
+			return fmt.Errorf("after column %s not exist", name)
+		}
+		index++
+	}
+	t.ColumnSchemaTypeList = append(t.ColumnSchemaTypeList, nil)
+	copy(t.ColumnSchemaTypeList[index+1:], t.ColumnSchemaTypeList[index:])
+	t.ColumnSchemaTypeList[index] = columnInfo
+	return nil
+}
+
+func (t *tableStruct) removeColumn(columnName string) *ColumnInfo {
+	i := t.getColumnIndex(columnName)
+	if i < 0 {
+		return nil
+	}
+	columnInfo := t.ColumnSchemaTypeList[i]
+	t.ColumnSchemaTypeList = append(t.ColumnSchemaTypeList[:i], t.ColumnSchemaTypeList[i+1:]...)
+	return columnInfo
+}
+
+func (d *schemaHistoryDDL) alterTable(p *ddlParser) (schemaName, tableName string, err error) {
+	if schemaName, tableName, err = p.tableName(d.defaultSchema); err != nil {
+		return
+	}
+	v := d.getVersion(schemaName, tableName)
+	if v == nil || v.Table == nil {
+		// 没有这个表的历史记录，不需要处理，在 TABLE_MAP_EVENT 的时候再从源端获取
+		return
+	}
+	table := v.Table.copy()
+	newSchemaName, newTableName := schemaName, tableName
+	for !p.eof() {
+		switch {
+		case p.acceptKeyword("ADD"):
+			err = d.alterAdd(p, table, v.Charset)
+		case p.acceptKeyword("DROP"):
+			err = d.alterDrop(p, table)
+		case p.acceptKeyword("MODIFY"):
+			p.acceptKeyword("COLUMN")
+			err = d.alterChange(p, table, v.Charset, false)
+		case p.acceptKeyword("CHANGE"):
+			p.acceptKeyword("COLUMN")
+			err = d.alterChange(p, table, v.Charset, true)
+		case p.acceptKeyword("RENAME"):
+			if p.acceptKeyword("COLUMN") {
+				err = d.alterRenameColumn(p, table)
+			} else if !p.isKeyword("INDEX", "KEY") {
+				p.acceptKeyword("TO", "AS")
+				newSchemaName, newTableName, err = p.tableName(schemaName)
+			}
+		case p.isKeyword("ALGORITHM", "LOCK"):
+		default:
+			// ALTER COLUMN , CONVERT TO CHARACTER SET , 表选项 等 不离线解析
+			err = ErrSchemaHistoryDDLNotSupported
+		}
+		if err != nil {
+			return
+		}
+		p.skipToNextDefinition()
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if newSchemaName != schemaName || newTableName != tableName {
+		d.setTable(schemaName, tableName, nil, "")
+	}
+	d.setTable(newSchemaName, newTableName, table, v.Charset)
+	return
+}
+
+// ADD PRIMARY KEY , ADD UNIQUE 会影响主键, 以及 一次添加多个字段 的 ADD COLUMN (a int, b int) 不离线解析
+func (d *schemaHistoryDDL) alterAdd(p *ddlParser, table *tableStruct, charset string) (err error) {
+	if p.isKeyword("INDEX", "KEY", "FULLTEXT", "SPATIAL") {
+		return
+	}
+	if p.isKeyword("CONSTRAINT", "PRIMARY", "UNIQUE", "FOREIGN", "CHECK", "PARTITION") || p.isSymbol("(") {
+		return ErrSchemaHistoryDDLNotSupported
+	}
+	p.acceptKeyword("COLUMN")
+	if p.isKeyword("IF") || p.isSymbol("(") {
+		return ErrSchemaHistoryDDLNotSupported
+	}
+	var columnInfo *ColumnInfo
+	if columnInfo, err = p.columnDefinition(charset); err != nil {
+		return
+	}
+	if columnInfo.COLUMN_KEY != "" || table.getColumnIndex(columnInfo.COLUMN_NAME) >= 0 {
+		return ErrSchemaHistoryDDLNotSupported
+	}
+	return table.addColumnByPosition(p, columnInfo)
+}
+
+func (d *schemaHistoryDDL) alterDrop(p *ddlParser, table *tableStruct) (err error) {
+	if p.isKeyword("INDEX", "KEY", "FOREIGN") {
+		return
+	}
+	if p.isKeyword("PRIMARY", "CHECK", "CONSTRAINT", "PARTITION", "DEFAULT", "IF") {
+		return ErrSchemaHistoryDDLNotSupported
+	}
+	p.acceptKeyword("COLUMN")
+	var name string
+	if name, err = p.ident(); err != nil {
+		return
+	}
+	if table.removeColumn(name) == nil {
+		return fmt.Errorf("column %s not exist", name)
+	}
+	return
+}
+
+// MODIFY 及 CHANGE , 原字段是主键的，修改后还是主键
+func (d *schemaHistoryDDL) alterChange(p *ddlParser, table *tableStruct, charset string, isChange bool) (err error) {
+	var oldName string
+	if isChange {
+		if oldName, err = p.ident(); err != nil {
+			return
+		}
+	} else {
+		oldName = p.peek().val
+	}
+	var columnInfo *ColumnInfo
+	if columnInfo, err = p.columnDefinition(charset); err != nil {
+		return
+	}
+	i := table.getColumnIndex(oldName)
+	if i < 0 {
+		return fmt.Errorf("column %s not exist", oldName)
+	}
+	if columnInfo.COLUMN_KEY != "" && table.ColumnSchemaTypeList[i].COLUMN_KEY != "PRI" {
+		return ErrSchemaHistoryDDLNotSupported
+	}
+	if table.ColumnSchemaTypeList[i].COLUMN_KEY == "PRI" {
+		columnInfo.COLUMN_KEY = "PRI"
+		columnInfo.IsPrimary = true
+		columnInfo.IsNullable = false
+	}
+	if p.isKeyword("FIRST", "AFTER") {
+		table.removeColumn(oldName)
+		return table.addColumnByPosition(p, columnInfo)
+	}
+	table.ColumnSchemaTypeList[i] = columnInfo
+	return
+}
+
+func (d *schemaHistoryDDL) alterRenameColumn(p *ddlParser, table *tableStruct) (err error) {
+	var oldName, newName string
+	if oldName, err = p.ident(); err != nil {
+		return
+	}
+	if !p.acceptKeyword("TO") {
+		return fmt.Errorf("rename column expect TO")
+	}
+	if newName, err = p.ident(); err != nil {
+		return
+	}
+	i := table.getColumnIndex(oldName)
+	if i < 0 {
+		return fmt.Errorf("column %s not exist", oldName)
+	}
+	table.ColumnSchemaTypeList[i].COLUMN_NAME = newName
+	return
+}
+
+func (d *schemaHistoryDDL) renameTable(p *ddlParser) (schemaName, tableName string, err error) {
+	for {
+		var newSchemaName, newTableName string
+		if schemaName, tableName, err = p.tableName(d.defaultSchema); err != nil {
+			return
+		}
+		if !p.acceptKeyword("TO") {
+			err = fmt.Errorf("rename table expect TO")
+			return
+		}
+		if newSchemaName, newTableName, err = p.tableName(d.defaultSchema); err != nil {
+			return
+		}
+		if v := d.getVersion(schemaName, tableName); v != nil && v.Table != nil {
+			d.setTable(newSchemaName, newTableName, v.Table.copy(), v.Charset)
+			d.setTable(schemaName, tableName, nil, "")
+		} else if v != nil && v.Unknown {
+			// 表结构未知的表 改名之后 新的表名 表结构 也是未知的
+			d.setTable(newSchemaName, newTableName, nil, "")
+			d.changes[getSchemaHistoryKey(newSchemaName, newTableName)].Unknown = true
+			d.setTable(schemaName, tableName, nil, "")
+		}
+		if !p.acceptSymbol(",") {
+			return
+		}
+	}
+}
+
+func (d *schemaHistoryDDL) dropTables(p *ddlParser) (schemaName, tableName string, err error) {
+	if p.acceptKeyword("IF") {
+		p.acceptKeyword("EXISTS")
+	}
+	for {
+		if schemaName, tableName, err = p.tableName(d.defaultSchema); err != nil {
+			return
+		}
+		d.dropTable(schemaName, tableName)
+		if !p.acceptSymbol(",") {
+			return
+		}
+	}
+}
+
+func (d *schemaHistoryDDL) dropSchema(schemaName string) {
+	prefix := schemaName + "."
+	d.history.RLock()
+	keys := make([]string, 0)
+	for key := range d.history.Tables {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	d.history.RUnlock()
+	for key := range d.changes {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		d.dropTable(schemaName, key[len(prefix):])
+	}
+}
@@ -0,0 +1,300 @@
+package mysql
+
+import (
+	"strings"
+	"testing"
+)
+
+func getSchemaHistoryColumnNames(table *tableStruct) string {
+	names := make([]string, 0)
+	for _, columnInfo := range table.ColumnSchemaTypeList {
+		names = append(names, columnInfo.COLUMN_NAME)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestCompareBinlogPosition(t *testing.T) {
+	if compareBinlogPosition("mysql-bin.000009", 100, "mysql-bin.000010", 4) != -1 {
+		t.Fatal("mysql-bin.000009:100 must be less than mysql-bin.000010:4")
+	}
+	if compareBinlogPosition("mysql-bin.000010", 100, "mysql-bin.000010", 4) != 1 {
+		t.Fatal("mysql-bin.000010:100 must be greater than mysql-bin.000010:4")
+	}
+	if compareBinlogPosition("mysql-bin.000010", 4, "mysql-bin.000010", 4) != 0 {
+		t.Fatal("mysql-bin.000010:4 must be equal")
+	}
+	if compareBinlogPosition("", 0, "mysql-bin.000001", 4) != -1 {
+		t.Fatal("empty binlog file name must be less")
+	}
+}
+
+func TestSchemaHistory_ApplyDDL(t *testing.T) {
+	h := NewSchemaHistory()
+	var err error
+	_, _, err = h.ApplyDDL("bifrost_test", "CREATE TABLE `t1` (\n"+
+		"`id` int(11) unsigned NOT NULL AUTO_INCREMENT,\n"+
+		"`name` varchar(20) NOT NULL DEFAULT '' COMMENT 'name,()',\n"+
+		"`status` enum('a','b','c') DEFAULT 'a',\n"+
+		"`flag` tinyint(1) DEFAULT NULL,\n"+
+		"`price` decimal(10,2) DEFAULT '0.00',\n"+
+		"PRIMARY KEY (`id`),\n"+
+		"KEY `idx_name` (`name`(10))\n"+
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8", "mysql-bin.000001", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, ok := h.GetTable("bifrost_test", "t1", "mysql-bin.000001", 200)
+	if !ok {
+		t.Fatal("t1 not found after create table")
+	}
+	if getSchemaHistoryColumnNames(table) != "id,name,status,flag,price" {
+		t.Fatal("create table columns error:", getSchemaHistoryColumnNames(table))
+	}
+	if len(table.Pri) != 1 || table.Pri[0] != "id" {
+		t.Fatal("create table pri error:", table.Pri)
+	}
+	if table.ColumnMapping["id"] != "uint32" || table.ColumnMapping["flag"] != "Nullable(bool)" || table.ColumnMapping["price"] != "Nullable(decimal(10,2))" {
+		t.Fatal("create table column mapping error:", table.ColumnMapping)
+	}
+	if table.ColumnSchemaTypeList[1].CHARACTER_OCTET_LENGTH != 60 || table.ColumnSchemaTypeList[1].CHARACTER_SET_NAME != "utf8" {
+		t.Fatal("varchar(20) utf8 character octet length error:", table.ColumnSchemaTypeList[1].CHARACTER_OCTET_LENGTH)
+	}
+	if strings.Join(table.ColumnSchemaTypeList[2].EnumValues, ",") != "a,b,c" {
+		t.Fatal("enum values error:", table.ColumnSchemaTypeList[2].EnumValues)
+	}
+
+	_, _, err = h.ApplyDDL("bifrost_test", "ALTER TABLE bifrost_test.t1 ADD COLUMN `c1` char(64) CHARACTER SET utf8mb4 AFTER `id`, DROP COLUMN `flag`, CHANGE `name` `name2` varchar(50) NOT NULL, MODIFY price double FIRST", "mysql-bin.000002", 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, _ = h.GetTable("bifrost_test", "t1", "mysql-bin.000002", 400)
+	if getSchemaHistoryColumnNames(table) != "price,id,c1,name2,status" {
+		t.Fatal("alter table columns error:", getSchemaHistoryColumnNames(table))
+	}
+	if table.ColumnSchemaTypeList[2].CHARACTER_OCTET_LENGTH != 256 {
+		t.Fatal("char(64) utf8mb4 character octet length error:", table.ColumnSchemaTypeList[2].CHARACTER_OCTET_LENGTH)
+	}
+	if len(table.Pri) != 1 || table.Pri[0] != "id" {
+		t.Fatal("alter table pri error:", table.Pri)
+	}
+
+	// 历史位点 还是使用 alter 之前的表结构
+	table, _ = h.GetTable("bifrost_test", "t1", "mysql-bin.000001", 200)
+	if getSchemaHistoryColumnNames(table) != "id,name,status,flag,price" {
+		t.Fatal("old position columns error:", getSchemaHistoryColumnNames(table))
+	}
+
+	// 重复解析同一个 DDL ，结果不变
+	_, _, err = h.ApplyDDL("bifrost_test", "ALTER TABLE bifrost_test.t1 ADD COLUMN `c1` char(64) CHARACTER SET utf8mb4 AFTER `id`, DROP COLUMN `flag`, CHANGE `name` `name2` varchar(50) NOT NULL, MODIFY price double FIRST", "mysql-bin.000002", 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, _ = h.GetTable("bifrost_test", "t1", "mysql-bin.000002", 400)
+	if getSchemaHistoryColumnNames(table) != "price,id,c1,name2,status" {
+		t.Fatal("replay alter table columns error:", getSchemaHistoryColumnNames(table))
+	}
+
+	_, _, err = h.ApplyDDL("bifrost_test", "RENAME TABLE t1 TO tmp, t2 TO t1, tmp TO t2", "mysql-bin.000002", 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok = h.GetTable("bifrost_test", "t1", "mysql-bin.000002", 600); ok {
+		t.Fatal("t1 must not exist after rename")
+	}
+	table, ok = h.GetTable("bifrost_test", "t2", "mysql-bin.000002", 600)
+	if !ok || table.TableName != "t2" || getSchemaHistoryColumnNames(table) != "price,id,c1,name2,status" {
+		t.Fatal("t2 error after rename")
+	}
+
+	_, _, err = h.ApplyDDL("bifrost_test", "DROP TABLE IF EXISTS `t2`", "mysql-bin.000003", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok = h.GetTable("bifrost_test", "t2", "mysql-bin.000003", 200); ok {
+		t.Fatal("t2 must not exist after drop")
+	}
+	if _, ok = h.GetTable("bifrost_test", "t2", "mysql-bin.000002", 600); !ok {
+		t.Fatal("t2 must exist before drop")
+	}
+
+	var tableName string
+	_, tableName, err = h.ApplyDDL("bifrost_test", "CREATE TABLE t3 SELECT * FROM t4", "mysql-bin.000003", 300)
+	if err != ErrSchemaHistoryDDLNotSupported || tableName != "t3" {
+		t.Fatal("create table select must be not supported")
+	}
+}
+
+func TestSchemaHistory_Encode(t *testing.T) {
+	h := NewSchemaHistory()
+	_, _, err := h.ApplyDDL("bifrost_test", "CREATE TABLE t1 (id bigint NOT NULL, name text, PRIMARY KEY(id))", "mysql-bin.000001", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := h.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2 := NewSchemaHistory()
+	if err = h2.Decode(data); err != nil {
+		t.Fatal(err)
+	}
+	table, ok := h2.GetTable("bifrost_test", "t1", "mysql-bin.000001", 200)
+	if !ok || getSchemaHistoryColumnNames(table) != "id,name" || table.Pri[0] != "id" || table.ColumnMapping["name"] != "Nullable(text)" {
+		t.Fatal("decode schema history error")
+	}
+}
+
+func TestSchemaHistory_ImportSQL(t *testing.T) {
+	sql := "-- MySQL dump 10.13\n" +
+		"/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */;\n" +
+		"USE `bifrost_test`;\n" +
+		"DROP TABLE IF EXISTS `t1`;\n" +
+		"# comment;\n" +
+		"CREATE TABLE `t1` (\n" +
+		"  `id` int NOT NULL,\n" +
+		"  `name` varchar(20) DEFAULT NULL COMMENT 'a;b',\n" +
+		"  PRIMARY KEY (`id`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\n" +
+		"DELIMITER ;;\n" +
+		"/*!50003 CREATE TRIGGER tr1 BEFORE INSERT ON t1 FOR EACH ROW BEGIN SET NEW.id = 1; END */;;\n" +
+		"DELIMITER ;\n" +
+		"CREATE TABLE bifrost_test2.t2 (id bigint, PRIMARY KEY(id));"
+	statements := splitSqlStatements(sql)
+	if len(statements) != 6 {
+		t.Fatal("split sql statements error:", len(statements), statements)
+	}
+	h := NewSchemaHistory()
+	if err := h.ImportSQL(sql); err != nil {
+		t.Fatal(err)
+	}
+	tableList := h.GetTableList()
+	if len(tableList["bifrost_test"]) != 1 || tableList["bifrost_test"][0] != "t1" || len(tableList["bifrost_test2"]) != 1 {
+		t.Fatal("table list error:", tableList)
+	}
+	columns, ok := h.GetLastTableColumns("bifrost_test", "t1")
+	if !ok || len(columns) != 2 || columns[1].COLUMN_NAME != "name" {
+		t.Fatal("table columns error:", len(columns))
+	}
+}
+
+// 每一种 离线解析 的 DDL 语句, 以及 不离线解析 需要查询源端的语句
+func TestSchemaHistory_ApplyDDLForms(t *testing.T) {
+	newHistory := func() *SchemaHistory {
+		h := NewSchemaHistory()
+		if _, _, err := h.ApplyDDL("db1", "CREATE TABLE t1 (id int NOT NULL, name varchar(20), doc text, PRIMARY KEY(id)) DEFAULT CHARSET=utf8mb4", "mysql-bin.000001", 100); err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	type caseStruct struct {
+		query   string
+		table   string // 执行之后 检查的表
+		columns string
+		dropT1  bool // 执行之后 t1 不存在
+		err     error
+	}
+	caseList := []caseStruct{
+		{query: "CREATE TABLE IF NOT EXISTS t1 (a int)", table: "t1", columns: "id,name,doc"},
+		{query: "CREATE TABLE t2 (a int NOT NULL, b int, UNIQUE KEY uk (a))", table: "t2", columns: "a,b"},
+		{query: "CREATE TABLE t2 LIKE t1", table: "t2", columns: "id,name,doc"},
+		{query: "CREATE TABLE t2 AS SELECT * FROM t1", table: "t2", err: ErrSchemaHistoryDDLNotSupported},
+		{query: "ALTER TABLE t1 ADD c1 int", table: "t1", columns: "id,name,doc,c1"},
+		{query: "ALTER TABLE t1 ADD COLUMN c1 int FIRST", table: "t1", columns: "c1,id,name,doc"},
+		{query: "ALTER TABLE t1 ADD COLUMN c1 int AFTER id", table: "t1", columns: "id,c1,name,doc"},
+		{query: "ALTER TABLE t1 DROP COLUMN doc", table: "t1", columns: "id,name"},
+		{query: "ALTER TABLE t1 DROP doc", table: "t1", columns: "id,name"},
+		{query: "ALTER TABLE t1 MODIFY COLUMN name varchar(50) AFTER doc", table: "t1", columns: "id,doc,name"},
+		{query: "ALTER TABLE t1 CHANGE name name2 varchar(50)", table: "t1", columns: "id,name2,doc"},
+		{query: "ALTER TABLE t1 RENAME COLUMN name TO name2", table: "t1", columns: "id,name2,doc"},
+		{query: "ALTER TABLE t1 RENAME TO t2", table: "t2", columns: "id,name,doc", dropT1: true},
+		{query: "ALTER TABLE t1 ADD INDEX idx_name (name), ALGORITHM=INPLACE, LOCK=NONE", table: "t1", columns: "id,name,doc"},
+		{query: "ALTER TABLE t1 DROP INDEX idx_name", table: "t1", columns: "id,name,doc"},
+		{query: "ALTER TABLE t1 ADD PRIMARY KEY (name)", table: "t1", err: ErrSchemaHistoryDDLNotSupported},
+		{query: "ALTER TABLE t1 DROP PRIMARY KEY", table: "t1", err: ErrSchemaHistoryDDLNotSupported},
+		{query: "ALTER TABLE t1 ADD UNIQUE KEY uk (name)", table: "t1", err: ErrSchemaHistoryDDLNotSupported},
+		{query: "ALTER TABLE t1 ADD COLUMN (c1 int, c2 int)", table: "t1", err: ErrSchemaHistoryDDLNotSupported},
+		{query: "ALTER TABLE t1 CONVERT TO CHARACTER SET utf8", table: "t1", err: ErrSchemaHistoryDDLNotSupported},
+		{query: "ALTER TABLE t1 ALTER COLUMN name SET DEFAULT 'a'", table: "t1", err: ErrSchemaHistoryDDLNotSupported},
+		{query: "RENAME TABLE t1 TO t2", table: "t2", columns: "id,name,doc", dropT1: true},
+		{query: "DROP TABLE IF EXISTS t1, t3", dropT1: true},
+		{query: "DROP DATABASE db1", dropT1: true},
+	}
+	for _, c := range caseList {
+		h := newHistory()
+		_, tableName, err := h.ApplyDDL("db1", c.query, "mysql-bin.000002", 100)
+		if c.err != nil {
+			if err != c.err || tableName != "t1" && tableName != "t2" {
+				t.Fatal(c.query, " err:", err, " tableName:", tableName)
+			}
+			// 不支持的语句 不能修改 表结构历史
+			if table, _ := h.GetTable("db1", "t1", "mysql-bin.000002", 200); getSchemaHistoryColumnNames(table) != "id,name,doc" {
+				t.Fatal(c.query, " must not change schema history")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(c.query, " err:", err)
+		}
+		if _, ok := h.GetTable("db1", "t1", "mysql-bin.000002", 200); ok == c.dropT1 {
+			t.Fatal(c.query, " t1 exist:", ok)
+		}
+		if c.table == "" {
+			continue
+		}
+		table, ok := h.GetTable("db1", c.table, "mysql-bin.000002", 200)
+		if !ok || getSchemaHistoryColumnNames(table) != c.columns {
+			t.Fatal(c.query, " columns error:", ok, table)
+		}
+	}
+}
+
+func TestEventParser_SaveSchemaHistoryByDDL_Unknown(t *testing.T) {
+	parser := newEventParser(NewBinlogDump("schema_history_test", nil, nil, nil, nil))
+	parser.schemaHistory = NewSchemaHistory()
+	parser.offline = true
+	if _, _, err := parser.schemaHistory.ApplyDDL("bifrost_test", "CREATE TABLE t1 (id int NOT NULL, name varchar(20), PRIMARY KEY (id))", "mysql-bin.000001", 100); err != nil {
+		t.Fatal(err)
+	}
+	// 不能离线解析的 DDL, 之后的表结构 未知, 不能使用 源端当前的表结构
+	parser.saveSchemaHistoryByDDL(&EventReslut{
+		SchemaName:     "bifrost_test",
+		Query:          "ALTER TABLE t1 ADD PRIMARY KEY (name)",
+		BinlogFileName: "mysql-bin.000001",
+		Header:         EventHeader{LogPos: 200},
+	})
+	if parser.schemaHistory.GetUnknownVersion("bifrost_test", "t1", "mysql-bin.000001", 150) != nil {
+		t.Fatal("t1 schema must be known before unknown ddl")
+	}
+	if parser.schemaHistory.GetUnknownVersion("bifrost_test", "t1", "mysql-bin.000001", 300) == nil {
+		t.Fatal("t1 schema must be unknown after unknown ddl")
+	}
+
+	parser.currentBinlogFileName = "mysql-bin.000001"
+	tableMapEvent := &TableMapEvent{header: EventHeader{LogPos: 300}, tableId: 1, schemaName: "bifrost_test", tableName: "t1", columnTypes: make([]FieldType, 2)}
+	if err := parser.GetTableSchemaFromHistory(tableMapEvent); err == nil {
+		t.Fatal("unknown table schema must be error")
+	}
+	tableMapEvent.header.LogPos = 150
+	if err := parser.GetTableSchemaFromHistory(tableMapEvent); err != nil {
+		t.Fatal(err)
+	}
+	// 字段数 和 TABLE_MAP_EVENT 不一致
+	tableMapEvent.columnTypes = make([]FieldType, 3)
+	if err := parser.GetTableSchemaFromHistory(tableMapEvent); err == nil {
+		t.Fatal("column count not match must be error")
+	}
+
+	// 改名之后 新的表 表结构 也是未知的, CREATE TABLE 之后 表结构 又是已知的
+	if _, _, err := parser.schemaHistory.ApplyDDL("bifrost_test", "RENAME TABLE t1 TO t2", "mysql-bin.000001", 400); err != nil {
+		t.Fatal(err)
+	}
+	if parser.schemaHistory.GetUnknownVersion("bifrost_test", "t2", "mysql-bin.000001", 500) == nil {
+		t.Fatal("t2 schema must be unknown after rename")
+	}
+	if _, _, err := parser.schemaHistory.ApplyDDL("bifrost_test", "CREATE TABLE t2 (id int NOT NULL, PRIMARY KEY (id))", "mysql-bin.000001", 600); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := parser.schemaHistory.GetTable("bifrost_test", "t2", "mysql-bin.000001", 700); !ok || parser.schemaHistory.GetUnknownVersion("bifrost_test", "t2", "mysql-bin.000001", 700) != nil {
+		t.Fatal("t2 schema must be known after create table")
+	}
+}
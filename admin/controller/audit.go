@@ -0,0 +1,250 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	pluginStorage "github.com/brokercap/Bifrost/plugin/storage"
+	"github.com/brokercap/Bifrost/server"
+	"github.com/brokercap/Bifrost/server/audit"
+	"github.com/brokercap/Bifrost/server/history"
+	"github.com/brokercap/Bifrost/server/secret"
+	"github.com/brokercap/Bifrost/server/user"
+	"github.com/brokercap/Bifrost/server/warning"
+)
+
+type AuditController struct {
+	CommonController
+}
+
+// 写操作 开始之前 记录请求参数 及 操作对象 当前的配置
+func (c *CommonController) startAudit(userInfo *user.UserInfo) {
+	mayXRealIP, _ := c.GetRemoteIp()
+	c.auditLog = &audit.AuditLog{
+		UserName: userInfo.Name,
+		Ip:       mayXRealIP,
+		Uri:      c.Ctx.Request.URL.Path,
+	}
+	var param map[string]interface{}
+	if c.auditLog.Uri == "/backup/import" {
+		// 导入的配置 太大并且包含了密码, 只记录 文件名 及 大小, 前后 只记录 数据源 及 ToServer 列表
+		param = make(map[string]interface{}, 0)
+		c.Ctx.Request.ParseMultipartForm(32 << 20)
+		if _, fileHeader, err := c.Ctx.Request.FormFile("backup_file"); err == nil {
+			param["FileName"] = fileHeader.Filename
+			param["Size"] = fileHeader.Size
+		}
+	} else if strings.HasPrefix(c.Ctx.Request.Header.Get("Content-Type"), "multipart/") {
+		return
+	} else if body := c.getRequestBody(); len(body) > 0 {
+		if json.Unmarshal(body, &param) != nil {
+			param = nil
+		}
+	}
+	if param == nil {
+		param = make(map[string]interface{}, 0)
+		for key := range c.Ctx.Request.Form {
+			param[key] = c.Ctx.Request.Form.Get(key)
+		}
+	}
+	c.auditParam = param
+	c.auditLog.DbName = getAuditParamString(param, "DbName")
+	c.auditLog.Param = audit.Marshal(param)
+	c.auditLog.Before = audit.Marshal(getAuditObject(c.auditLog.Uri, param))
+}
+
+// 写操作 结束之后 记录 操作对象 最新的配置 及 结果
+func (c *CommonController) finishAudit() {
+	auditLog := c.auditLog
+	c.auditLog = nil
+	if c.auditParam != nil {
+		auditLog.After = audit.Marshal(getAuditObject(auditLog.Uri, c.auditParam))
+	}
+	switch result := c.Data["json"].(type) {
+	case ResultDataStruct:
+		auditLog.Status, auditLog.Msg = int(result.Status), result.Msg
+	case *ResultDataStruct:
+		auditLog.Status, auditLog.Msg = int(result.Status), result.Msg
+	default:
+		auditLog.Status = 1
+	}
+	audit.Add(auditLog)
+}
+
+func getAuditParamString(param map[string]interface{}, key string) string {
+	if val, ok := param[key]; ok && val != nil {
+		return fmt.Sprint(val)
+	}
+	return ""
+}
+
+func getAuditParamInt(param map[string]interface{}, key string) int {
+	n, _ := strconv.Atoi(getAuditParamString(param, key))
+	return n
+}
+
+// 根据 uri 及 请求参数 获取 被操作的对象
+func getAuditObject(uri string, param map[string]interface{}) interface{} {
+	DbName := getAuditParamString(param, "DbName")
+	SchemaName := tansferSchemaName(getAuditParamString(param, "SchemaName"))
+	TableName := tansferTableName(getAuditParamString(param, "TableName"))
+	switch {
+	case strings.HasPrefix(uri, "/db/"):
+		if dbInfo := server.GetDbInfo(DbName); dbInfo.Name != "" {
+			return dbInfo
+		}
+	case strings.HasPrefix(uri, "/channel/"):
+		if channel := server.GetChannel(DbName, getAuditParamInt(param, "ChannelId")); channel != nil {
+			return channel
+		}
+	case strings.HasPrefix(uri, "/table/"):
+		dbObj := server.GetDBObj(DbName)
+		if dbObj == nil {
+			return nil
+		}
+		table := dbObj.GetTable(SchemaName, TableName)
+		if table == nil {
+			return nil
+		}
+		if !strings.HasPrefix(uri, "/table/toserver/") {
+			return table
+		}
+		ToServerId := getAuditParamInt(param, "ToServerId")
+		for _, toServerInfo := range table.ToServerList {
+			if toServerInfo.ToServerID == ToServerId {
+				return toServerInfo
+			}
+		}
+		if ToServerId == 0 {
+			return table.ToServerList
+		}
+	case strings.HasPrefix(uri, "/toserver/"):
+		if toServerInfo := pluginStorage.GetToServerInfo(getAuditParamString(param, "ToServerKey")); toServerInfo != nil {
+			return toServerInfo
+		}
+	case strings.HasPrefix(uri, "/history/"):
+		Id := getAuditParamInt(param, "Id")
+		historyList := history.GetHistoryList(DbName, "", "", history.HISTORY_STATUS_ALL)
+		for i := range historyList {
+			if historyList[i].ID == Id {
+				return &historyList[i]
+			}
+		}
+	case strings.HasPrefix(uri, "/warning/"):
+		if v, ok := warning.GetWarningConfigList()[getAuditParamString(param, "Id")]; ok {
+			return v
+		}
+	case strings.HasPrefix(uri, "/user/role/"):
+		return user.GetRoleInfo(getAuditParamString(param, "Name"))
+	case strings.HasPrefix(uri, "/user/update"), strings.HasPrefix(uri, "/user/del"):
+		if userInfo := user.GetUserInfo(getAuditParamString(param, "UserName")); userInfo.Name != "" {
+			return userInfo
+		}
+	case strings.HasPrefix(uri, "/pipeline/apply"):
+		return server.GetPipelineSpec()
+	case uri == "/backup/import":
+		return getAuditBackupSummary()
+	}
+	return nil
+}
+
+// 导入配置 前后 的 数据源 及 ToServer 列表, 不包含 连接地址
+func getAuditBackupSummary() map[string][]string {
+	DbNameList := make([]string, 0)
+	for DbName := range server.GetListDb() {
+		DbNameList = append(DbNameList, DbName)
+	}
+	ToServerKeyList := make([]string, 0)
+	for ToServerKey := range pluginStorage.GetToServerMapByUri(secret.MaskUri) {
+		ToServerKeyList = append(ToServerKeyList, ToServerKey)
+	}
+	sort.Strings(DbNameList)
+	sort.Strings(ToServerKeyList)
+	return map[string][]string{"DbName": DbNameList, "ToServerKey": ToServerKeyList}
+}
+
+func (c *AuditController) getQuery() audit.Query {
+	q := audit.Query{
+		UserName: c.Ctx.Request.Form.Get("UserName"),
+		Uri:      c.Ctx.Request.Form.Get("Uri"),
+		DbName:   c.Ctx.Request.Form.Get("DbName"),
+	}
+	q.StartTime, _ = strconv.ParseInt(c.Ctx.Request.Form.Get("StartTime"), 10, 64)
+	q.EndTime, _ = strconv.ParseInt(c.Ctx.Request.Form.Get("EndTime"), 10, 64)
+	q.Limit, _ = strconv.Atoi(c.Ctx.Request.Form.Get("Limit"))
+	return q
+}
+
+// 审计日志 只有 administrator 可以查看
+func (c *AuditController) checkAdministrator() {
+	if c.loginUser == nil || c.loginUser.Group != "administrator" {
+		c.SetJsonData(ResultDataStruct{Status: -1, Msg: "no authority", Data: nil})
+		c.StopServeJSON()
+	}
+}
+
+func (c *AuditController) List() {
+	c.checkAdministrator()
+	q := c.getQuery()
+	if q.Limit <= 0 {
+		q.Limit = 500
+	}
+	c.SetJsonData(ResultDataStruct{Status: 1, Msg: "success", Data: audit.GetList(q)})
+	c.StopServeJSON()
+}
+
+// 导出 csv 或者 json 文件
+func (c *AuditController) Export() {
+	c.checkAdministrator()
+	list := audit.GetList(c.getQuery())
+	c.SetOutputByUser()
+	fileName := "bifrost_audit_" + time.Now().Format("2006-01-02_15-04-05")
+	w := c.Ctx.ResponseWriter
+	if c.Ctx.Request.Form.Get("Type") == "json" {
+		w.Header().Add("Content-Type", "application/octet-stream")
+		w.Header().Add("content-disposition", "attachment; filename=\""+fileName+".json\"")
+		b, _ := json.Marshal(list)
+		w.Write(b)
+		return
+	}
+	w.Header().Add("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Add("content-disposition", "attachment; filename=\""+fileName+".csv\"")
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"ID", "Time", "UserName", "Ip", "Uri", "DbName", "Param", "Before", "After", "Status", "Msg"})
+	for _, v := range list {
+		writer.Write([]string{
+			v.ID,
+			time.Unix(v.Time, 0).Format("2006-01-02 15:04:05"),
+			v.UserName,
+			v.Ip,
+			v.Uri,
+			v.DbName,
+			string(v.Param),
+			string(v.Before),
+			string(v.After),
+			strconv.Itoa(v.Status),
+			v.Msg,
+		})
+	}
+	writer.Flush()
+}
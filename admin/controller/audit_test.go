@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/brokercap/Bifrost/admin/xgo"
+	"github.com/brokercap/Bifrost/config"
+	"github.com/brokercap/Bifrost/server/audit"
+	"github.com/brokercap/Bifrost/server/storage"
+	"github.com/brokercap/Bifrost/server/user"
+)
+
+func initAuditTest(t *testing.T) {
+	config.DataDir = t.TempDir()
+	storage.InitStorage()
+	if err := user.AddUser("auditTest", "auditTestPwd", "administrator", "%", nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDBController_Add_Audit(t *testing.T) {
+	initAuditTest(t)
+	xgo.Router("/db/add", &DBController{}, "POST:Add")
+
+	body := `{"DbName":"auditTest","InputType":"mysql","Uri":"root:auditTestPwd@tcp(127.0.0.1:3306)/test"}`
+	req := httptest.NewRequest("POST", "/db/add", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth("auditTest", "auditTestPwd")
+	http.DefaultServeMux.ServeHTTP(httptest.NewRecorder(), req)
+
+	list := audit.GetList(audit.Query{Uri: "/db/add"})
+	if len(list) != 1 {
+		t.Fatal("audit log count:", len(list), "!= 1")
+	}
+	if list[0].UserName != "auditTest" || list[0].DbName != "auditTest" || list[0].Status != 0 {
+		t.Fatal("audit log error:", list[0])
+	}
+	if strings.Contains(string(list[0].Param), "auditTestPwd") {
+		t.Fatal("audit log param not masked:", string(list[0].Param))
+	}
+}
+
+func TestBackupController_Import_Audit(t *testing.T) {
+	initAuditTest(t)
+	xgo.Router("/backup/import", &BackupController{}, "POST:Import")
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	f, _ := w.CreateFormFile("backup_file", "bifrost.json")
+	f.Write([]byte(`{"DbInfo":{"password":"auditTestPwd"}`))
+	w.Close()
+	req := httptest.NewRequest("POST", "/backup/import", &buf)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.SetBasicAuth("auditTest", "auditTestPwd")
+	http.DefaultServeMux.ServeHTTP(httptest.NewRecorder(), req)
+
+	list := audit.GetList(audit.Query{Uri: "/backup/import"})
+	if len(list) != 1 {
+		t.Fatal("audit log count:", len(list), "!= 1")
+	}
+	if !strings.Contains(string(list[0].Param), "bifrost.json") || list[0].Before == nil || list[0].After == nil || list[0].Status != 1 {
+		t.Fatal("audit log error:", list[0])
+	}
+	if strings.Contains(string(list[0].Param), "auditTestPwd") {
+		t.Fatal("audit log param contains backup content:", string(list[0].Param))
+	}
+}
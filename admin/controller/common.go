@@ -16,23 +16,65 @@ limitations under the License.
 package controller
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
 	"net/http"
 	"strings"
 
 	"github.com/brokercap/Bifrost/admin/xgo"
 	"github.com/brokercap/Bifrost/config"
+	"github.com/brokercap/Bifrost/server"
+	"github.com/brokercap/Bifrost/server/audit"
+	"github.com/brokercap/Bifrost/server/secret"
 	"github.com/brokercap/Bifrost/server/user"
 )
 
 type CommonController struct {
 	xgo.Controller
+	loginUser   *user.UserInfo
+	requestBody []byte
+	auditLog    *audit.AuditLog
+	auditParam  map[string]interface{}
+}
+
+var writeRequestOp = []string{"/add", "/del", "/start", "/stop", "/close", "/deal", "/update", "/export", "/import", "kill", "/replay", "/purge", "/apply"}
+
+// 非 administrator 用户 通过角色 可以进行的写操作
+var roleActionUriMap = map[string]user.RoleAction{
+	"/db/start":                         user.ROLE_ACTION_START_STOP,
+	"/db/stop":                          user.ROLE_ACTION_START_STOP,
+	"/db/close":                         user.ROLE_ACTION_START_STOP,
+	"/channel/start":                    user.ROLE_ACTION_START_STOP,
+	"/channel/stop":                     user.ROLE_ACTION_START_STOP,
+	"/channel/close":                    user.ROLE_ACTION_START_STOP,
+	"/table/toserver/start":             user.ROLE_ACTION_START_STOP,
+	"/table/toserver/stop":              user.ROLE_ACTION_START_STOP,
+	"/channel/add":                      user.ROLE_ACTION_TOSERVER,
+	"/channel/del":                      user.ROLE_ACTION_TOSERVER,
+	"/table/add":                        user.ROLE_ACTION_TOSERVER,
+	"/table/update":                     user.ROLE_ACTION_TOSERVER,
+	"/table/del":                        user.ROLE_ACTION_TOSERVER,
+	"/table/toserver/add":               user.ROLE_ACTION_TOSERVER,
+	"/table/toserver/deal":              user.ROLE_ACTION_TOSERVER,
+	"/table/toserver/del":               user.ROLE_ACTION_TOSERVER,
+	"/table/toserver/filequeue/update":  user.ROLE_ACTION_TOSERVER,
+	"/table/toserver/deadletter/replay": user.ROLE_ACTION_TOSERVER,
+	"/table/toserver/deadletter/purge":  user.ROLE_ACTION_TOSERVER,
+	"/history/add":                      user.ROLE_ACTION_HISTORY,
+	"/history/del":                      user.ROLE_ACTION_HISTORY,
+	"/history/start":                    user.ROLE_ACTION_HISTORY,
+	"/history/stop":                     user.ROLE_ACTION_HISTORY,
+	"/history/kill":                     user.ROLE_ACTION_HISTORY,
 }
 
-var writeRequestOp = []string{"/add", "/del", "/start", "/stop", "/close", "/deal", "/update", "/export", "/import", "kill"}
 var skipCheckAuthUriMap = map[string]bool{
-	"/login/index": true,
-	"/dologin":     true,
-	"/logout":      true,
+	"/login/index":        true,
+	"/dologin":            true,
+	"/logout":             true,
+	"/login/sso":          true,
+	"/login/sso/callback": true,
 }
 
 // 判断是否为写操作
@@ -47,7 +89,9 @@ func (c *CommonController) checkWriteRequest(uri string) bool {
 
 func (c *CommonController) Prepare() {
 	var ok bool
-	if c.Ctx.Request.Header.Get("Authorization") != "" {
+	if strings.HasPrefix(c.Ctx.Request.Header.Get("Authorization"), "Bearer ") {
+		ok = c.tokenAuthor()
+	} else if c.Ctx.Request.Header.Get("Authorization") != "" {
 		ok = c.basicAuthor()
 	} else {
 		ok = c.normalAuthor()
@@ -55,16 +99,74 @@ func (c *CommonController) Prepare() {
 	}
 	if !ok {
 		c.authErrExit()
+		return
 	}
+	c.checkHALeaderWriteRequest()
 }
 
-func (c *CommonController) checkAdminWriteRequest(group string) bool {
-	if group != "administrator" && c.checkWriteRequest(c.Ctx.Request.RequestURI) {
-		c.SetJsonData(ResultDataStruct{Status: -1, Msg: "user group : [ " + group + " ] no authority", Data: nil})
-		c.StopServeJSON()
-		return false
+// 开启 ha 的情况下, follower 节点不允许写操作, 返回 leader 节点的地址
+func (c *CommonController) checkHALeaderWriteRequest() {
+	if server.IsHALeader() || !c.checkWriteRequest(c.Ctx.Request.RequestURI) {
+		return
+	}
+	leaderAddr := server.GetHALeaderAddr()
+	c.SetJsonData(ResultDataStruct{Status: -1, Msg: "current node is not leader, please request leader: " + leaderAddr, Data: leaderAddr})
+	c.StopServeJSON()
+}
+
+// 非 administrator 用户 只有 角色 中指定的 数据源 及 操作 才有写权限
+func (c *CommonController) checkAdminWriteRequest(userInfo *user.UserInfo) bool {
+	c.loginUser = userInfo
+	if !c.checkWriteRequest(c.Ctx.Request.RequestURI) {
+		return true
+	}
+	// 所有的写操作 包括没有权限的 都记录审计日志
+	c.startAudit(userInfo)
+	if userInfo.Group == "administrator" {
+		return true
+	}
+	if action, ok := roleActionUriMap[c.Ctx.Request.URL.Path]; ok {
+		if user.CheckUserPermission(userInfo, c.getRequestDbName(), action) {
+			return true
+		}
+	}
+	c.SetJsonData(ResultDataStruct{Status: -1, Msg: "user group : [ " + userInfo.Group + " ] no authority", Data: nil})
+	c.StopServeJSON()
+	return false
+}
+
+// 写操作 的 DbName 一般在 json body 中, 死信队列 及 文件队列 的接口在 url 参数中
+// 两个地方的 DbName 不一致的时候 返回空, 没有权限, 防止用有权限的 DbName 通过校验, 实际操作的是另外一个 DbName
+func (c *CommonController) getRequestDbName() string {
+	var data struct {
+		DbName string
+	}
+	_ = json.Unmarshal(c.getRequestBody(), &data)
+	FormDbName := c.Ctx.Request.Form.Get("DbName")
+	if data.DbName == "" {
+		return FormDbName
+	}
+	if FormDbName != "" && FormDbName != data.DbName {
+		return ""
+	}
+	return data.DbName
+}
+
+// 读取 body 之后 需要重新放回去 给具体的 controller 使用
+func (c *CommonController) getRequestBody() []byte {
+	if c.requestBody != nil || c.Ctx.Request.Body == nil {
+		return c.requestBody
+	}
+	body, _ := ioutil.ReadAll(c.Ctx.Request.Body)
+	c.Ctx.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	c.requestBody = body
+	return body
+}
+
+func (c *CommonController) Finish() {
+	if c.auditLog != nil {
+		c.finishAudit()
 	}
-	return true
 }
 
 func (c *CommonController) authErrExit() {
@@ -85,16 +187,45 @@ func (c *CommonController) basicAuthor() bool {
 		c.StopServeJSON()
 		return false
 	}
-	return c.checkAdminWriteRequest(userInfo.Group)
+	return c.checkAdminWriteRequest(userInfo)
+}
+
+func (c *CommonController) tokenAuthor() bool {
+	token := strings.TrimSpace(strings.TrimPrefix(c.Ctx.Request.Header.Get("Authorization"), "Bearer "))
+	mayXRealIP, remoteAddrIp := c.GetRemoteIp()
+	userInfo, err := user.CheckTokenWithIP(token, mayXRealIP, remoteAddrIp)
+	if err != nil {
+		c.SetJsonData(ResultDataStruct{Status: -1, Msg: err.Error(), Data: nil})
+		c.StopServeJSON()
+		return false
+	}
+	return c.checkAdminWriteRequest(userInfo)
 }
 
 func (c *CommonController) normalAuthor() bool {
 	var sessionID = c.Ctx.Session.CheckCookieValid(c.Ctx.ResponseWriter, c.Ctx.Request)
 	if sessionID != "" {
-		if _, ok := c.Ctx.Session.GetSessionVal(sessionID, "UserName"); ok {
-			//非administrator用户 用户，没有写操作权限
-			Group, _ := c.Ctx.Session.GetSessionVal(sessionID, "Group")
-			return c.checkAdminWriteRequest(Group.(string))
+		if UserNameVal, ok := c.Ctx.Session.GetSessionVal(sessionID, "UserName"); ok {
+			UserName, ok := UserNameVal.(string)
+			if !ok {
+				goto toLogin
+			}
+			//非administrator用户 用户，只有角色中指定的写操作权限
+			//角色可能被修改, 这里每次重新获取用户信息
+			// 用户被删除之后, 已经登入的 session 也不能再访问, ldap 及 sso 登入的用户 登入的时候 都已经保存到了存储中
+			userInfo := user.GetUserInfo(UserName)
+			if userInfo.Name == "" {
+				c.Ctx.Session.EndSession(c.Ctx.ResponseWriter, c.Ctx.Request)
+				goto toLogin
+			}
+			if userInfo.Group == "" {
+				userInfo.Group = "monitor"
+			}
+			if !c.checkCSRFToken(sessionID) {
+				return false
+			}
+			c.SetData("CSRFToken", c.Ctx.Session.GetCSRFToken(sessionID))
+			return c.checkAdminWriteRequest(userInfo)
 		} else {
 			goto toLogin
 		}
@@ -103,7 +234,7 @@ func (c *CommonController) normalAuthor() bool {
 	}
 
 toLogin:
-	if _, ok := skipCheckAuthUriMap[c.Ctx.Request.RequestURI]; !ok {
+	if _, ok := skipCheckAuthUriMap[c.Ctx.Request.URL.Path]; !ok {
 		if c.IsHtmlOutput() {
 			http.Redirect(c.Ctx.ResponseWriter, c.Ctx.Request, "/login/index", http.StatusFound)
 			return false
@@ -115,6 +246,27 @@ toLogin:
 	return true
 }
 
+// cookie 登录的 POST 请求 需要带上 session 中的 csrf token, 防止 跨站请求伪造
+// 页面中 通过 X-CSRF-Token 请求头 提交, basic auth 及 token 认证的请求 不需要
+func (c *CommonController) checkCSRFToken(sessionID string) bool {
+	if c.Ctx.Request.Method != http.MethodPost {
+		return true
+	}
+	if _, ok := skipCheckAuthUriMap[c.Ctx.Request.URL.Path]; ok {
+		return true
+	}
+	token := c.Ctx.Request.Header.Get("X-CSRF-Token")
+	if token == "" {
+		token = c.Ctx.Request.Form.Get("csrf_token")
+	}
+	if c.Ctx.Session.CheckCSRFToken(sessionID, token) {
+		return true
+	}
+	c.SetJsonData(ResultDataStruct{Status: -1, Msg: "csrf token error, please refresh the page", Data: nil})
+	c.StopServeJSON()
+	return false
+}
+
 func (c *CommonController) SetTitle(title string) {
 	c.SetData("Title", title+" - Bifrost")
 }
@@ -142,3 +294,12 @@ func (c *CommonController) GetRemoteIp() (mayXRealIP, remoteAddrIp string) {
 	}
 	return mayXRealIP, remoteAddrIp
 }
+
+// 接口返回的连接地址 密码已经脱敏, 提交的时候没有修改 则使用原来的连接地址
+func unmaskUri(uri, oldUri string) (string, error) {
+	uri = secret.UnmaskUri(uri, oldUri)
+	if secret.IsMasked(uri) {
+		return uri, errors.New("the password in uri is masked, please input the password again")
+	}
+	return uri, nil
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"github.com/brokercap/Bifrost/admin/xgo"
+	"github.com/brokercap/Bifrost/server/user"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCommonController_getRequestDbName(t *testing.T) {
+	caseList := []struct {
+		uri    string
+		body   string
+		dbName string
+	}{
+		{"/table/toserver/del", `{"DbName":"mysqlTest"}`, "mysqlTest"},
+		{"/table/toserver/deadletter/purge?DbName=mysqlTest", "", "mysqlTest"},
+		{"/table/toserver/del?DbName=mysqlTest", `{"DbName":"mysqlTest"}`, "mysqlTest"},
+		// url 中的 DbName 有权限, body 中的 DbName 才是实际操作的, 不一致的时候 不能通过校验
+		{"/table/toserver/del?DbName=mysqlTest", `{"DbName":"mysqlTest2"}`, ""},
+	}
+	for _, v := range caseList {
+		req := httptest.NewRequest("POST", v.uri, strings.NewReader(v.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.ParseForm()
+		c := &CommonController{}
+		c.Ctx = &xgo.Context{Request: req}
+		if DbName := c.getRequestDbName(); DbName != v.dbName {
+			t.Fatal("getRequestDbName error, uri:", v.uri, " body:", v.body, " DbName:", DbName, "!=", v.dbName)
+		}
+	}
+}
+
+func TestCommonController_normalAuthor_DeletedUser(t *testing.T) {
+	initAuditTest(t)
+	sessionMgr := xgo.NewSessionMgr("bifrost_test", 3600)
+	w := httptest.NewRecorder()
+	sessionID := sessionMgr.StartSession(w, httptest.NewRequest("GET", "/login/index", nil))
+	sessionMgr.SetSessionVal(sessionID, "UserName", "auditTest")
+	sessionMgr.SetSessionVal(sessionID, "Group", "administrator")
+
+	newController := func() *CommonController {
+		req := httptest.NewRequest("GET", "/db/list", nil)
+		req.AddCookie(w.Result().Cookies()[0])
+		c := &CommonController{}
+		c.Init(&xgo.Context{Request: req, ResponseWriter: httptest.NewRecorder(), Session: sessionMgr}, "db", "list")
+		return c
+	}
+	if !newController().normalAuthor() {
+		t.Fatal("user exist, normalAuthor must be true")
+	}
+	// 用户被删除之后, session 中有 Group 也不能访问, session 被销毁
+	if err := user.DelUser("auditTest"); err != nil {
+		t.Fatal(err)
+	}
+	if newController().normalAuthor() {
+		t.Fatal("user deleted, normalAuthor must be false")
+	}
+	if _, ok := sessionMgr.GetSessionVal(sessionID, "UserName"); ok {
+		t.Fatal("session must be destroyed after user deleted")
+	}
+}
@@ -25,6 +25,7 @@ import (
 
 	"github.com/brokercap/Bifrost/Bristol/mysql"
 	"github.com/brokercap/Bifrost/server"
+	"github.com/brokercap/Bifrost/server/secret"
 
 	inputDriver "github.com/brokercap/Bifrost/input/driver"
 )
@@ -47,6 +48,7 @@ type DbUpdateParam struct {
 	UpdateToServer    int8
 	CheckPrivilege    bool
 	Gtid              string
+	LoopMarkerTable   string
 }
 
 func (c *DBController) getParam() *DbUpdateParam {
@@ -111,6 +113,11 @@ func (c *DBController) Add() {
 			return
 		}
 	}
+	var err error
+	if data.Uri, err = unmaskUri(data.Uri, ""); err != nil {
+		result.Msg = err.Error()
+		return
+	}
 	defer server.SaveDBConfigInfo()
 	inputInfo := inputDriver.InputInfo{
 		DbName:         data.DbName,
@@ -121,6 +128,8 @@ func (c *DBController) Add() {
 		ServerId:       data.ServerId,
 		MaxFileName:    data.MaxBinlogFileName,
 		MaxPosition:    data.MaxBinlogPosition,
+
+		LoopMarkerTable: data.LoopMarkerTable,
 	}
 	server.AddNewDB(data.DbName, data.InputType, inputInfo, time.Now().Unix())
 	channel, _ := server.GetDBObj(data.DbName).AddChannel("default", 1)
@@ -149,6 +158,16 @@ func (c *DBController) Update() {
 			return
 		}
 	}
+	var err error
+	if dbObj := server.GetDBObj(data.DbName); dbObj != nil {
+		data.Uri, err = unmaskUri(data.Uri, dbObj.ConnectUri)
+	} else {
+		data.Uri, err = unmaskUri(data.Uri, "")
+	}
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
 	inputInfo := inputDriver.InputInfo{
 		DbName:         data.DbName,
 		ConnectUri:     data.Uri,
@@ -158,8 +177,10 @@ func (c *DBController) Update() {
 		ServerId:       data.ServerId,
 		MaxFileName:    data.MaxBinlogFileName,
 		MaxPosition:    data.MaxBinlogPosition,
+
+		LoopMarkerTable: data.LoopMarkerTable,
 	}
-	err := server.UpdateDB(data.DbName, data.InputType, inputInfo, time.Now().Unix(), data.UpdateToServer)
+	err = server.UpdateDB(data.DbName, data.InputType, inputInfo, time.Now().Unix(), data.UpdateToServer)
 	if err != nil {
 		result.Msg = err.Error()
 	} else {
@@ -262,10 +283,15 @@ func (c *DBController) CheckUri() {
 		result.Msg = " Uri not be empty!"
 		return
 	}
+	// 修改数据源的时候 验证, 提交的是 脱敏之后的连接地址
+	Uri := data.Uri
+	if dbObj := server.GetDBObj(data.DbName); dbObj != nil {
+		Uri = secret.UnmaskUri(Uri, dbObj.ConnectUri)
+	}
 	inputInfo := inputDriver.InputInfo{
 		DbName:         data.DbName,
 		IsGTID:         false,
-		ConnectUri:     data.Uri,
+		ConnectUri:     secret.ResolveUri(Uri),
 		GTID:           "",
 		BinlogFileName: "",
 		BinlogPostion:  0,
@@ -344,7 +370,7 @@ func (c *DBController) GetVersion() {
 		c.StopServeJSON()
 	}()
 	DbName := c.Ctx.Request.Form.Get("DbName")
-	dbObj := server.GetDbInfo(DbName)
+	dbObj := server.GetDBObj(DbName)
 	if dbObj == nil {
 		result.Msg = DbName + " no exsit"
 		return
@@ -352,7 +378,7 @@ func (c *DBController) GetVersion() {
 	inputInfo := inputDriver.InputInfo{
 		DbName:         DbName,
 		IsGTID:         false,
-		ConnectUri:     dbObj.ConnectUri,
+		ConnectUri:     secret.ResolveUri(dbObj.ConnectUri),
 		GTID:           "",
 		BinlogFileName: "",
 		BinlogPostion:  0,
@@ -19,19 +19,20 @@ import (
 	inputDriver "github.com/brokercap/Bifrost/input/driver"
 	toserver "github.com/brokercap/Bifrost/plugin/storage"
 	"github.com/brokercap/Bifrost/server"
+	"github.com/brokercap/Bifrost/server/secret"
 	"strings"
 )
 
 func (c *DBController) Detail() {
 	DbName := c.Ctx.Request.Form.Get("DbName")
 	dbInfo := server.GetDBObj(DbName)
-	o := inputDriver.Open(dbInfo.InputType, inputDriver.InputInfo{ConnectUri: dbInfo.ConnectUri})
+	o := inputDriver.Open(dbInfo.InputType, inputDriver.InputInfo{ConnectUri: secret.ResolveUri(dbInfo.ConnectUri)})
 	DataBaseList, _ := o.GetSchemaList()
 	DataBaseList = append(DataBaseList, "AllDataBases")
 
 	c.SetData("DbName", DbName)
 	c.SetData("DataBaseList", DataBaseList)
-	c.SetData("ToServerList", toserver.GetToServerMap())
+	c.SetData("ToServerList", toserver.GetToServerMapByUri(secret.MaskUri))
 	c.SetData("ChannelList:", dbInfo.ListChannel())
 	c.SetData("Title", DbName+" - Detail")
 	c.AddAdminTemplate("db.detail.html", "header.html", "db.detail.table.add.html", "db.detail.history.add.html", "footer.html")
@@ -46,7 +47,7 @@ func (c *DBController) GetTableFields() {
 	TableName = tansferTableName(TableName)
 
 	dbInfo := server.GetDBObj(DbName)
-	o := inputDriver.Open(dbInfo.InputType, inputDriver.InputInfo{ConnectUri: dbInfo.ConnectUri})
+	o := inputDriver.Open(dbInfo.InputType, inputDriver.InputInfo{ConnectUri: secret.ResolveUri(dbInfo.ConnectUri)})
 	TableFieldsList, _ := o.GetSchemaTableFieldList(SchemaName, TableName)
 	c.SetJsonData(TableFieldsList)
 	c.StopServeJSON()
@@ -56,7 +57,7 @@ func (c *DBController) TableList() {
 	DbName := c.Ctx.Request.Form.Get("DbName")
 	SchemaName := c.Ctx.Request.Form.Get("SchemaName")
 	DBObj := server.GetDBObj(DbName)
-	o := inputDriver.Open(DBObj.InputType, inputDriver.InputInfo{ConnectUri: DBObj.ConnectUri})
+	o := inputDriver.Open(DBObj.InputType, inputDriver.InputInfo{ConnectUri: secret.ResolveUri(DBObj.ConnectUri)})
 	type ResultType struct {
 		TableName   string
 		ChannelName string
@@ -0,0 +1,168 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/brokercap/Bifrost/server"
+	"io/ioutil"
+)
+
+type DeadLetterController struct {
+	CommonController
+}
+
+type TableDeadLetterParam struct {
+	DbName     string
+	SchemaName string
+	TableName  string
+	ToServerId int
+	Index      int
+	Count      int // 重放数量，<= 0 则重放所有
+}
+
+func (c *DeadLetterController) getParam() *TableDeadLetterParam {
+	body, err := ioutil.ReadAll(c.Ctx.Request.Body)
+	if err != nil {
+		result := ResultDataStruct{Status: 0, Msg: err.Error(), Data: nil}
+		c.SetJsonData(result)
+		c.StopServeJSON()
+		return nil
+	}
+	var data TableDeadLetterParam
+	if err = json.Unmarshal(body, &data); err != nil {
+		result := ResultDataStruct{Status: 0, Msg: err.Error(), Data: nil}
+		c.SetJsonData(result)
+		c.StopServeJSON()
+		return nil
+	}
+	return &data
+}
+
+func (c *DeadLetterController) getToServer(DbName, SchemaName, TableName string, Index, ToServerId int) (*server.ToServer, error) {
+	if DbName == "" || SchemaName == "" || TableName == "" || ToServerId < 0 {
+		return nil, fmt.Errorf("param error!")
+	}
+	SchemaName = tansferSchemaName(SchemaName)
+	TableName = tansferTableName(TableName)
+	dbObj := server.GetDBObj(DbName)
+	if dbObj == nil {
+		return nil, fmt.Errorf("DbName:%s not exsit", DbName)
+	}
+	t := dbObj.GetTable(SchemaName, TableName)
+	if t == nil || Index < 0 || Index >= len(t.ToServerList) {
+		return nil, fmt.Errorf("ToServer not exsit")
+	}
+	ToServerInfo := t.ToServerList[Index]
+	if ToServerInfo.ToServerID != ToServerId {
+		return nil, fmt.Errorf("ToServerID error")
+	}
+	return ToServerInfo.InitDeadLetterQueue(DbName, SchemaName, TableName), nil
+}
+
+func (c *DeadLetterController) getToServerByForm() (*server.ToServer, error) {
+	Index, _ := c.Ctx.GetParamInt64("Index", 0)
+	ToServerId, _ := c.Ctx.GetParamInt64("ToServerId", -1)
+	return c.getToServer(c.Ctx.Get("DbName"), c.Ctx.Get("SchemaName"), c.Ctx.Get("TableName"), int(Index), int(ToServerId))
+}
+
+func (c *DeadLetterController) List() {
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	ToServerInfo, err := c.getToServerByForm()
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	Offset, _ := c.Ctx.GetParamInt64("Offset", 0)
+	Limit, _ := c.Ctx.GetParamInt64("Limit", 20)
+	list, total, err := ToServerInfo.ListDeadLetter(int(Offset), int(Limit))
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	result = ResultDataStruct{Status: 1, Msg: "success", Data: map[string]interface{}{"Total": total, "List": list}}
+}
+
+func (c *DeadLetterController) Get() {
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	ToServerInfo, err := c.getToServerByForm()
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	ID, _ := c.Ctx.GetParamInt64("ID", 0)
+	data, err := ToServerInfo.GetDeadLetter(ID)
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	result = ResultDataStruct{Status: 1, Msg: "success", Data: data}
+}
+
+func (c *DeadLetterController) Replay() {
+	param := c.getParam()
+	if param == nil {
+		return
+	}
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	ToServerInfo, err := c.getToServer(param.DbName, param.SchemaName, param.TableName, param.Index, param.ToServerId)
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	count, err := ToServerInfo.ReplayDeadLetter(param.Count)
+	if err != nil {
+		result = ResultDataStruct{Status: 0, Msg: err.Error(), Data: count}
+		return
+	}
+	result = ResultDataStruct{Status: 1, Msg: "success", Data: count}
+}
+
+func (c *DeadLetterController) Purge() {
+	param := c.getParam()
+	if param == nil {
+		return
+	}
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	ToServerInfo, err := c.getToServer(param.DbName, param.SchemaName, param.TableName, param.Index, param.ToServerId)
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	count, err := ToServerInfo.PurgeDeadLetter()
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	result = ResultDataStruct{Status: 1, Msg: "success", Data: count}
+}
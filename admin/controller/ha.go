@@ -0,0 +1,30 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"github.com/brokercap/Bifrost/server"
+)
+
+type HAController struct {
+	CommonController
+}
+
+// 当前节点是否为 leader 及 leader 节点的地址
+func (c *HAController) Status() {
+	c.SetJsonData(ResultDataStruct{Status: 1, Msg: "success", Data: server.GetHAStatus()})
+	c.StopServeJSON()
+}
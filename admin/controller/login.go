@@ -16,6 +16,8 @@ limitations under the License.
 package controller
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"net/http"
 
 	"github.com/brokercap/Bifrost/server/user"
@@ -27,6 +29,7 @@ type LoginController struct {
 
 func (c *LoginController) Index() {
 	c.SetTitle("Login")
+	c.SetData("SSOProviderList", user.GetRedirectAuthProviderNameList())
 	c.AddAdminTemplate("login.html")
 }
 
@@ -54,6 +57,55 @@ func (c *LoginController) Login() {
 	return
 }
 
+// 跳转到第三方登入, state 保存在 session 中, 回调的时候 校验
+func (c *LoginController) SSO() {
+	provider := user.GetRedirectAuthProvider(c.Ctx.Request.Form.Get("provider"))
+	if provider == nil {
+		c.SetJsonData(ResultDataStruct{Status: 0, Msg: "auth provider not exist", Data: nil})
+		c.StopServeJSON()
+		return
+	}
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	state := hex.EncodeToString(b)
+	authUrl, err := provider.AuthCodeURL(state)
+	if err != nil {
+		c.SetJsonData(ResultDataStruct{Status: 0, Msg: err.Error(), Data: nil})
+		c.StopServeJSON()
+		return
+	}
+	var sessionID = c.Ctx.Session.StartSession(c.Ctx.ResponseWriter, c.Ctx.Request)
+	c.Ctx.Session.SetSessionVal(sessionID, "SSOState", state)
+	c.Ctx.Session.SetSessionVal(sessionID, "SSOProvider", provider.Name())
+	c.SetOutputByUser()
+	http.Redirect(c.Ctx.ResponseWriter, c.Ctx.Request, authUrl, http.StatusFound)
+}
+
+func (c *LoginController) SSOCallback() {
+	var sessionID = c.Ctx.Session.CheckCookieValid(c.Ctx.ResponseWriter, c.Ctx.Request)
+	state, _ := c.Ctx.Session.GetSessionVal(sessionID, "SSOState")
+	providerName, _ := c.Ctx.Session.GetSessionVal(sessionID, "SSOProvider")
+	if state == nil || providerName == nil || state.(string) == "" || state.(string) != c.Ctx.Request.Form.Get("state") {
+		c.SetJsonData(ResultDataStruct{Status: 0, Msg: "state error", Data: nil})
+		c.StopServeJSON()
+		return
+	}
+	c.Ctx.Session.SetSessionVal(sessionID, "SSOState", "")
+	mayXRealIP, remoteAddrIp := c.GetRemoteIp()
+	UserInfo, err := user.CheckAuthCodeWithIP(providerName.(string), c.Ctx.Request.Form.Get("code"), mayXRealIP, remoteAddrIp)
+	if err != nil {
+		c.SetJsonData(ResultDataStruct{Status: 0, Msg: err.Error(), Data: nil})
+		c.StopServeJSON()
+		return
+	}
+	// 登入成功 使用新的 session
+	sessionID = c.Ctx.Session.StartSession(c.Ctx.ResponseWriter, c.Ctx.Request)
+	c.Ctx.Session.SetSessionVal(sessionID, "UserName", UserInfo.Name)
+	c.Ctx.Session.SetSessionVal(sessionID, "Group", UserInfo.Group)
+	c.SetOutputByUser()
+	http.Redirect(c.Ctx.ResponseWriter, c.Ctx.Request, "/", http.StatusFound)
+}
+
 func (c *LoginController) Logout() {
 	c.Ctx.Session.EndSession(c.Ctx.ResponseWriter, c.Ctx.Request)
 	if c.IsHtmlOutput() {
@@ -0,0 +1,35 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"github.com/brokercap/Bifrost/server"
+	"github.com/brokercap/Bifrost/server/metrics"
+	"log"
+)
+
+type MetricsController struct {
+	CommonController
+}
+
+// Prometheus 拉取监控指标，需要配置 basic_auth
+func (c *MetricsController) Index() {
+	c.SetOutputByUser()
+	c.Ctx.ResponseWriter.Header().Set("Content-Type", metrics.ContentType)
+	if err := server.WriteMetrics(c.Ctx.ResponseWriter); err != nil {
+		log.Println("write metrics err:", err)
+	}
+}
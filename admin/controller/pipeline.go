@@ -0,0 +1,112 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"encoding/json"
+	"github.com/brokercap/Bifrost/server"
+	"github.com/brokercap/Bifrost/server/pipeline"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+type PipelineController struct {
+	CommonController
+}
+
+type PipelinePlanResult struct {
+	Plan    string
+	Changes []*pipeline.Change
+}
+
+func (c *PipelineController) getParam() *pipeline.Spec {
+	body, err := ioutil.ReadAll(c.Ctx.Request.Body)
+	if err != nil {
+		c.SetJsonData(ResultDataStruct{Status: 0, Msg: err.Error(), Data: nil})
+		c.StopServeJSON()
+		return nil
+	}
+	spec, err := pipeline.Parse(body)
+	if err == nil {
+		// 导出的配置 密码是脱敏的
+		err = spec.UnmaskUri(server.GetPipelineSpec())
+	}
+	if err != nil {
+		c.SetJsonData(ResultDataStruct{Status: 0, Msg: err.Error(), Data: nil})
+		c.StopServeJSON()
+		return nil
+	}
+	return spec
+}
+
+// Prune=true 的时候,配置文件中没有的配置会被删除
+func (c *PipelineController) getPrune() bool {
+	return strings.ToLower(c.Ctx.Get("Prune")) == "true"
+}
+
+// 对比配置文件和当前运行中的配置,返回变更计划,不做修改
+func (c *PipelineController) Plan() {
+	spec := c.getParam()
+	plan := server.PlanPipeline(spec, c.getPrune())
+	spec.MaskUri()
+	c.SetJsonData(ResultDataStruct{Status: 1, Msg: "success", Data: PipelinePlanResult{Plan: plan.String(), Changes: plan.Changes}})
+	c.StopServeJSON()
+}
+
+// 按变更计划执行,出错的情况下,Data 中返回完整的变更计划,出错之前的变更已经生效
+func (c *PipelineController) Apply() {
+	spec := c.getParam()
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	plan, err := server.ApplyPipeline(spec, c.getPrune())
+	spec.MaskUri()
+	result.Data = PipelinePlanResult{Plan: plan.String(), Changes: plan.Changes}
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	result.Status = 1
+	result.Msg = "success"
+}
+
+// 导出当前运行中的配置,Format=json 导出 JSON 格式,默认 YAML 格式
+func (c *PipelineController) Export() {
+	spec := server.GetPipelineSpec()
+	spec.MaskUri()
+	var b []byte
+	var err error
+	var fileName string
+	if strings.ToLower(c.Ctx.Get("Format")) == "json" {
+		b, err = json.MarshalIndent(spec, "", "  ")
+		fileName = "bifrost_pipeline_" + time.Now().Format("2006-01-02 15:04:05") + ".json"
+	} else {
+		b, err = spec.ToYaml()
+		fileName = "bifrost_pipeline_" + time.Now().Format("2006-01-02 15:04:05") + ".yaml"
+	}
+	if err != nil {
+		c.SetJsonData(ResultDataStruct{Status: 0, Msg: err.Error(), Data: nil})
+		c.StopServeJSON()
+		return
+	}
+	c.SetOutputByUser()
+	c.Ctx.ResponseWriter.Header().Add("Content-Type", "application/octet-stream")
+	c.Ctx.ResponseWriter.Header().Add("content-disposition", "attachment; filename=\""+fileName+"\"")
+	c.Ctx.ResponseWriter.Write(b)
+}
@@ -18,6 +18,7 @@ package controller
 import (
 	pluginStorage "github.com/brokercap/Bifrost/plugin/storage"
 	"github.com/brokercap/Bifrost/server"
+	"github.com/brokercap/Bifrost/server/secret"
 )
 
 type TableSyncController struct {
@@ -171,7 +172,7 @@ func (c *TableSyncController) getList() syncListResult {
 		SyncList:        syncList,
 		ChannelID:       ChannelID,
 		DbList:          server.GetListDb(),
-		ToServerKeyList: pluginStorage.ToServerMap,
+		ToServerKeyList: pluginStorage.GetToServerMapByUri(secret.MaskUri),
 		ChannelList:     ChannelList,
 	}
 	return data
@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	pluginStorage "github.com/brokercap/Bifrost/plugin/storage"
 	"github.com/brokercap/Bifrost/server"
+	"github.com/brokercap/Bifrost/server/transform"
 	"io/ioutil"
 )
 
@@ -33,12 +34,19 @@ type TableToServerParam struct {
 	ToServerKey   string
 	PluginName    string
 	FieldList     []string
+	Transforms    []*transform.Config
 	MustBeSuccess bool
 	FilterQuery   bool
 	FilterUpdate  bool
 	PluginParam   map[string]interface{}
 	ToServerId    int
 	Index         int
+
+	ErrorPolicy     server.ErrorPolicy
+	ErrorRetryCount int
+	DeadLetter      *server.DeadLetterConfig
+	Transaction     bool
+	InitialSnapshot bool
 }
 
 func (c *TableToServerController) getParam() *TableToServerParam {
@@ -83,18 +91,60 @@ func (c *TableToServerController) Add() {
 		result.Msg = param.ToServerKey + "not exsit"
 		return
 	}
-	toServer := &server.ToServer{
-		MustBeSuccess: param.MustBeSuccess,
-		FilterQuery:   param.FilterQuery,
-		FilterUpdate:  param.FilterUpdate,
-		ToServerKey:   param.ToServerKey,
-		PluginName:    param.PluginName,
-		FieldList:     param.FieldList,
-		PluginParam:   param.PluginParam,
+	if _, err := transform.NewPipeline(param.Transforms); err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	switch param.ErrorPolicy {
+	case server.ERRORPOLICYBLOCK, server.ERRORPOLICYSKIP:
+		break
+	case server.ERRORPOLICYDEADLETTER:
+		if param.DeadLetter != nil && param.DeadLetter.ToServerKey != "" && pluginStorage.GetToServerInfo(param.DeadLetter.ToServerKey) == nil {
+			result.Msg = "DeadLetter " + param.DeadLetter.ToServerKey + "not exsit"
+			return
+		}
+		break
+	case "block":
+		param.ErrorPolicy = server.ERRORPOLICYBLOCK
+		break
+	default:
+		result.Msg = "ErrorPolicy:" + string(param.ErrorPolicy) + " not supported"
+		return
+	}
+	if param.Transaction {
+		if err := server.CheckTransactionSupported(param.ToServerKey); err != nil {
+			result.Msg = err.Error()
+			return
+		}
 	}
 	SchemaName := tansferSchemaName(param.SchemaName)
 	TableName := tansferTableName(param.TableName)
 	dbObj := server.GetDBObj(param.DbName)
+	if param.InitialSnapshot {
+		if err := server.CheckInitialSnapshotSupported(dbObj, SchemaName, TableName); err != nil {
+			result.Msg = err.Error()
+			return
+		}
+	}
+	// skip,deadletter 策略下，插件需要将错误返回，才能进行跳过处理
+	if param.ErrorPolicy != server.ERRORPOLICYBLOCK {
+		param.MustBeSuccess = true
+	}
+	toServer := &server.ToServer{
+		MustBeSuccess:   param.MustBeSuccess,
+		FilterQuery:     param.FilterQuery,
+		FilterUpdate:    param.FilterUpdate,
+		ToServerKey:     param.ToServerKey,
+		PluginName:      param.PluginName,
+		FieldList:       param.FieldList,
+		Transforms:      param.Transforms,
+		ErrorPolicy:     param.ErrorPolicy,
+		ErrorRetryCount: param.ErrorRetryCount,
+		DeadLetter:      param.DeadLetter,
+		Transaction:     param.Transaction,
+		InitialSnapshot: param.InitialSnapshot,
+		PluginParam:     param.PluginParam,
+	}
 	r, ToServerId := dbObj.AddTableToServer(SchemaName, TableName, toServer)
 	if r == true {
 		defer server.SaveDBConfigInfo()
@@ -20,6 +20,7 @@ import (
 	"github.com/brokercap/Bifrost/plugin/driver"
 	ToServerStorage "github.com/brokercap/Bifrost/plugin/storage"
 	"github.com/brokercap/Bifrost/server"
+	"github.com/brokercap/Bifrost/server/secret"
 	"io/ioutil"
 )
 
@@ -55,14 +56,14 @@ func (c *ToServerController) getParam() *ToServerParam {
 }
 
 func (c *ToServerController) Index() {
-	c.SetData("ToServerList", ToServerStorage.ToServerMap)
+	c.SetData("ToServerList", ToServerStorage.GetToServerMapByUri(secret.MaskUri))
 	c.SetData("Drivers", driver.Drivers())
 	c.SetTitle("ToServer List")
 	c.AddAdminTemplate("toserver.list.html", "header.html", "footer.html")
 }
 
 func (c *ToServerController) List() {
-	c.SetData("ToServerList", ToServerStorage.ToServerMap)
+	c.SetData("ToServerList", ToServerStorage.GetToServerMapByUri(secret.MaskUri))
 	c.SetData("Drivers", driver.Drivers())
 	c.StopServeJSON()
 }
@@ -78,7 +79,14 @@ func (c *ToServerController) CheckUri() {
 		result.Msg = "PluginName,connuri muest be not empty"
 		return
 	}
-	err := driver.CheckUri(param.PluginName, &param.ConnUri)
+	// 修改的时候 验证, 提交的是 脱敏之后的连接地址
+	if param.ToServerKey != "" {
+		if toServerInfo := ToServerStorage.GetToServerInfo(param.ToServerKey); toServerInfo != nil {
+			param.ConnUri = secret.UnmaskUri(param.ConnUri, toServerInfo.ConnUri)
+		}
+	}
+	ConnUri := secret.ResolveUri(param.ConnUri)
+	err := driver.CheckUri(param.PluginName, &ConnUri)
 	if err != nil {
 		result.Msg = err.Error()
 		return
@@ -97,6 +105,11 @@ func (c *ToServerController) Add() {
 		result.Msg = "toserverkey,PluginName,connuri muest be not empty"
 		return
 	}
+	var err error
+	if param.ConnUri, err = unmaskUri(param.ConnUri, ""); err != nil {
+		result.Msg = err.Error()
+		return
+	}
 	ToServerStorage.SetToServerInfo(
 		param.ToServerKey,
 		ToServerStorage.ToServer{
@@ -121,6 +134,15 @@ func (c *ToServerController) Update() {
 		result.Msg = "toserverkey,PluginName,connuri muest be not empty"
 		return
 	}
+	var oldConnUri string
+	if toServerInfo := ToServerStorage.GetToServerInfo(param.ToServerKey); toServerInfo != nil {
+		oldConnUri = toServerInfo.ConnUri
+	}
+	var err error
+	if param.ConnUri, err = unmaskUri(param.ConnUri, oldConnUri); err != nil {
+		result.Msg = err.Error()
+		return
+	}
 	ToServerStorage.UpdateToServerInfo(
 		param.ToServerKey,
 		ToServerStorage.ToServer{
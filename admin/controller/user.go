@@ -31,6 +31,7 @@ type UserParam struct {
 	Password string
 	Group    string
 	Host     string
+	Roles    []string
 }
 
 func (c *UserController) getParam() *UserParam {
@@ -79,7 +80,8 @@ func (c *UserController) Update() {
 		c.SetJsonData(result)
 		c.StopServeJSON()
 	}()
-	if param.UserName == "" || param.Password == "" {
+	// 修改已存在的用户 密码可以为空, 为空则不修改密码
+	if param.UserName == "" || (param.Password == "" && user.GetUserInfo(param.UserName).Name == "") {
 		result.Msg = " user_name and password not empty!"
 		return
 	}
@@ -89,7 +91,7 @@ func (c *UserController) Update() {
 			return
 		}
 	}
-	err := user.UpdateUser(param.UserName, param.Password, param.Group, param.Host)
+	err := user.UpdateUser(param.UserName, param.Password, param.Group, param.Host, param.Roles)
 	if err != nil {
 		result.Msg = err.Error()
 	} else {
@@ -131,3 +133,133 @@ func (c *UserController) LastLoginLog() {
 		result.Data = logInfo
 	}
 }
+
+type RoleParam struct {
+	Name    string
+	DbNames []string
+	Actions []user.RoleAction
+}
+
+func (c *UserController) RoleList() {
+	c.SetJsonData(ResultDataStruct{Status: 1, Msg: "success", Data: map[string]interface{}{"RoleList": user.GetRoleList(), "ActionList": user.GetRoleActionList()}})
+	c.StopServeJSON()
+}
+
+func (c *UserController) RoleUpdate() {
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	var param RoleParam
+	body, _ := ioutil.ReadAll(c.Ctx.Request.Body)
+	if err := json.Unmarshal(body, &param); err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	err := user.UpdateRole(param.Name, param.DbNames, param.Actions)
+	if err != nil {
+		result.Msg = err.Error()
+	} else {
+		result = ResultDataStruct{Status: 1, Msg: "success", Data: nil}
+	}
+}
+
+func (c *UserController) RoleDelete() {
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	var param RoleParam
+	body, _ := ioutil.ReadAll(c.Ctx.Request.Body)
+	if err := json.Unmarshal(body, &param); err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	if param.Name == "" {
+		result.Msg = " Name not empty!"
+		return
+	}
+	for _, User := range user.GetUserList() {
+		for _, RoleName := range User.Roles {
+			if RoleName == param.Name {
+				result.Msg = "role is used by user:" + User.Name
+				return
+			}
+		}
+	}
+	err := user.DelRole(param.Name)
+	if err != nil {
+		result.Msg = err.Error()
+	} else {
+		result = ResultDataStruct{Status: 1, Msg: "success", Data: nil}
+	}
+}
+
+type TokenParam struct {
+	ID         string
+	UserName   string
+	Notes      string
+	ExpireTime int64
+}
+
+func (c *UserController) getTokenParam() *TokenParam {
+	body, err := ioutil.ReadAll(c.Ctx.Request.Body)
+	if err != nil {
+		c.SetJsonData(ResultDataStruct{Status: 0, Msg: err.Error(), Data: nil})
+		c.StopServeJSON()
+		return nil
+	}
+	var data TokenParam
+	if err = json.Unmarshal(body, &data); err != nil {
+		c.SetJsonData(ResultDataStruct{Status: 0, Msg: err.Error(), Data: nil})
+		c.StopServeJSON()
+		return nil
+	}
+	return &data
+}
+
+func (c *UserController) TokenList() {
+	c.SetJsonData(ResultDataStruct{Status: 1, Msg: "success", Data: user.GetTokenList(c.Ctx.Request.Form.Get("UserName"))})
+	c.StopServeJSON()
+}
+
+// token 只在添加的时候 返回一次, 之后不能再查看
+func (c *UserController) TokenAdd() {
+	param := c.getTokenParam()
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	if param.UserName == "" {
+		result.Msg = " UserName not empty!"
+		return
+	}
+	token, err := user.AddToken(param.UserName, param.Notes, param.ExpireTime)
+	if err != nil {
+		result.Msg = err.Error()
+	} else {
+		result = ResultDataStruct{Status: 1, Msg: "success", Data: token}
+	}
+}
+
+func (c *UserController) TokenDelete() {
+	param := c.getTokenParam()
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	if param.ID == "" {
+		result.Msg = " ID not empty!"
+		return
+	}
+	err := user.DelToken(param.ID)
+	if err != nil {
+		result.Msg = err.Error()
+	} else {
+		result = ResultDataStruct{Status: 1, Msg: "success", Data: nil}
+	}
+}
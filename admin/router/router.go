@@ -25,6 +25,11 @@ func init() {
 	xgo.Router("/overview", &controller.IndexController{}, "*:Overview")
 	xgo.Router("/serverMonitor", &controller.IndexController{}, "*:ServerMonitor")
 	xgo.Router("/freeOSMemory", &controller.IndexController{}, "*:FreeOSMemory")
+	xgo.Router("/metrics", &controller.MetricsController{}, "GET:Index")
+	xgo.Router("/ha/status", &controller.HAController{}, "GET:Status")
+	xgo.Router("/pipeline/plan", &controller.PipelineController{}, "POST:Plan")
+	xgo.Router("/pipeline/apply", &controller.PipelineController{}, "POST:Apply")
+	xgo.Router("/pipeline/export", &controller.PipelineController{}, "GET:Export")
 
 	// pprof
 	xgo.Router("/debug/pprof/", &controller.PprofController{}, "*:Default")
@@ -98,10 +103,22 @@ func init() {
 	xgo.Router("/user/update", &controller.UserController{}, "POST:Update")
 	xgo.Router("/user/del", &controller.UserController{}, "POST,DELETE:Delete")
 	xgo.Router("/user/login/log", &controller.UserController{}, "*:LastLoginLog")
+	xgo.Router("/user/role/list", &controller.UserController{}, "*:RoleList")
+	xgo.Router("/user/role/update", &controller.UserController{}, "POST:RoleUpdate")
+	xgo.Router("/user/role/del", &controller.UserController{}, "POST,DELETE:RoleDelete")
+	xgo.Router("/user/token/list", &controller.UserController{}, "*:TokenList")
+	xgo.Router("/user/token/add", &controller.UserController{}, "POST:TokenAdd")
+	xgo.Router("/user/token/del", &controller.UserController{}, "POST,DELETE:TokenDelete")
+
+	//audit
+	xgo.Router("/audit/list", &controller.AuditController{}, "GET:List")
+	xgo.Router("/audit/export", &controller.AuditController{}, "GET:Export")
 
 	//login
 	xgo.Router("/login/index", &controller.LoginController{}, "*:Index")
 	xgo.Router("/dologin", &controller.LoginController{}, "POST:Login")
+	xgo.Router("/login/sso", &controller.LoginController{}, "GET:SSO")
+	xgo.Router("/login/sso/callback", &controller.LoginController{}, "GET:SSOCallback")
 	xgo.Router("/logout", &controller.LoginController{}, "*:Logout")
 
 	//table
@@ -141,6 +158,12 @@ func init() {
 	xgo.Router("/table/toserver/filequeue/update", &controller.FileQueueController{}, "POST:Update")
 	xgo.Router("/table/toserver/filequeue/getinfo", &controller.FileQueueController{}, "*:GetInfo")
 
+	//dead letter
+	xgo.Router("/table/toserver/deadletter/list", &controller.DeadLetterController{}, "*:List")
+	xgo.Router("/table/toserver/deadletter/get", &controller.DeadLetterController{}, "*:Get")
+	xgo.Router("/table/toserver/deadletter/replay", &controller.DeadLetterController{}, "POST:Replay")
+	xgo.Router("/table/toserver/deadletter/purge", &controller.DeadLetterController{}, "POST,DELETE:Purge")
+
 	//plugin
 	xgo.Router("/plugin/index", &controller.PluginController{}, "*:Index")
 	xgo.Router("/plugin/list", &controller.PluginController{}, "*:List")
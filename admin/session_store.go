@@ -0,0 +1,72 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package admin
+
+import (
+	"encoding/json"
+
+	"github.com/brokercap/Bifrost/admin/xgo"
+	"github.com/brokercap/Bifrost/server/storage"
+)
+
+const SESSION_PREFIX string = "bifrost_Session_"
+
+// session 保存在 meta_storage_type 对应的 leveldb 或者 redis 中, 重启之后 不需要重新登录
+// 多个节点 使用 同一个 redis 的情况下, 负载均衡 后面的 节点 可以共享 session
+type xdbSessionStore struct{}
+
+func newXdbSessionStore() *xdbSessionStore {
+	return &xdbSessionStore{}
+}
+
+func (store *xdbSessionStore) Get(sessionID string) (*xgo.Session, error) {
+	b, err := storage.GetKeyVal([]byte(SESSION_PREFIX + sessionID))
+	if err != nil || len(b) == 0 {
+		return nil, err
+	}
+	var session xgo.Session
+	if err = json.Unmarshal(b, &session); err != nil {
+		return nil, err
+	}
+	if session.Values == nil {
+		session.Values = make(map[string]interface{})
+	}
+	return &session, nil
+}
+
+func (store *xdbSessionStore) Save(session *xgo.Session) error {
+	b, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return storage.PutKeyVal([]byte(SESSION_PREFIX+session.ID), b)
+}
+
+func (store *xdbSessionStore) Delete(sessionID string) error {
+	return storage.DelKeyVal([]byte(SESSION_PREFIX + sessionID))
+}
+
+func (store *xdbSessionStore) List() ([]*xgo.Session, error) {
+	sessionList := make([]*xgo.Session, 0)
+	for _, v := range storage.GetListByPrefix([]byte(SESSION_PREFIX)) {
+		var session xgo.Session
+		if err := json.Unmarshal([]byte(v.Value), &session); err != nil {
+			continue
+		}
+		sessionList = append(sessionList, &session)
+	}
+	return sessionList, nil
+}
@@ -21,16 +21,53 @@ import (
 	"github.com/brokercap/Bifrost/admin/xgo"
 	"github.com/brokercap/Bifrost/config"
 	"log"
+	"net/http"
 	"runtime/debug"
 )
 
+func getSessionOption() xgo.SessionOption {
+	option := xgo.SessionOption{
+		IdleTimeout:     config.SessionIdleTimeout,
+		AbsoluteTimeout: config.SessionAbsoluteTimeout,
+		Secure:          config.TLS,
+		HttpOnly:        config.SessionCookieHttpOnly,
+	}
+	switch config.SessionCookieSecure {
+	case "true":
+		option.Secure = true
+	case "false":
+		option.Secure = false
+	}
+	switch config.SessionCookieSameSite {
+	case "strict":
+		option.SameSite = http.SameSiteStrictMode
+	case "none":
+		// SameSite=None 浏览器要求 必须是 Secure
+		option.SameSite = http.SameSiteNoneMode
+		if !option.Secure {
+			log.Println("Bifrost.ini Bifrostd.session_cookie_samesite=none but session cookie is not secure, browsers may reject the cookie")
+		}
+	default:
+		option.SameSite = http.SameSiteLaxMode
+	}
+	return option
+}
+
+func startSession() {
+	var store xgo.SessionStore
+	if config.SessionStore == "xdb" {
+		store = newXdbSessionStore()
+	}
+	xgo.StartSessionWithStore("xgo_cookie", store, getSessionOption())
+}
+
 func Start() {
 	defer func() {
 		if err := recover(); err != nil {
 			debug.PrintStack()
 		}
 	}()
-	xgo.StartSession()
+	startSession()
 	xgo.AddStaticRoute("/css/", controller.AdminTemplatePath("/public/"))
 	xgo.AddStaticRoute("/js/", controller.AdminTemplatePath("/public/"))
 	xgo.AddStaticRoute("/fonts/", controller.AdminTemplatePath("/public/"))
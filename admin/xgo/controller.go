@@ -122,7 +122,6 @@ func (c *Controller) StopRun() {
 }
 
 func (c *Controller) NormalStop() {
-	c.Finish()
 	if c.Format == HTML_TYPE {
 		switch strings.ToLower(c.Ctx.Request.Form.Get("format")) {
 		case "json":
@@ -17,8 +17,10 @@ package xgo
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -26,18 +28,39 @@ import (
 	"time"
 )
 
+// 最后访问时间 超过这个间隔 才重新保存, 减少 持久化存储 的写入
+const sessionTouchInterval int64 = 60
+
+type SessionOption struct {
+	IdleTimeout     int64 // 秒, 超过这个时间没有访问 session 失效
+	AbsoluteTimeout int64 // 秒, 创建之后 超过这个时间 session 失效, 0 为不限制
+	Secure          bool  // cookie 只通过 https 发送
+	HttpOnly        bool  // cookie 不能被 js 读取
+	SameSite        http.SameSite
+}
+
 /*Session会话管理*/
 type SessionMgr struct {
-	mCookieName  string       //客户端cookie名称
-	mLock        sync.RWMutex //互斥(保证线程安全)
-	mMaxLifeTime int64        //垃圾回收时间
-
-	mSessions map[string]*Session //保存session的指针[sessionID] = session
+	mCookieName string        //客户端cookie名称
+	mLock       sync.RWMutex  //互斥(保证线程安全)
+	mOption     SessionOption //超时时间 及 cookie 属性
+	mStore      SessionStore  //session 存储, 默认 保存在 进程内存中
 }
 
 // 创建会话管理器(cookieName:在浏览器中cookie的名字;maxLifeTime:最长生命周期)
 func NewSessionMgr(cookieName string, maxLifeTime int64) *SessionMgr {
-	mgr := &SessionMgr{mCookieName: cookieName, mMaxLifeTime: maxLifeTime, mSessions: make(map[string]*Session)}
+	return NewSessionMgrWithStore(cookieName, NewMemorySessionStore(), SessionOption{IdleTimeout: maxLifeTime, HttpOnly: true, SameSite: http.SameSiteLaxMode})
+}
+
+// 创建会话管理器, store 为 nil 的时候 保存在 进程内存中
+func NewSessionMgrWithStore(cookieName string, store SessionStore, option SessionOption) *SessionMgr {
+	if store == nil {
+		store = NewMemorySessionStore()
+	}
+	if option.IdleTimeout <= 0 {
+		option.IdleTimeout = 3600
+	}
+	mgr := &SessionMgr{mCookieName: cookieName, mOption: option, mStore: store}
 
 	//启动定时回收
 	go mgr.GC()
@@ -45,24 +68,54 @@ func NewSessionMgr(cookieName string, maxLifeTime int64) *SessionMgr {
 	return mgr
 }
 
+func (mgr *SessionMgr) newCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     mgr.mCookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   mgr.mOption.Secure,
+		HttpOnly: mgr.mOption.HttpOnly,
+		SameSite: mgr.mOption.SameSite,
+	}
+}
+
 // 在开始页面登陆页面，开始Session
 func (mgr *SessionMgr) StartSession(w http.ResponseWriter, r *http.Request) string {
 	mgr.mLock.Lock()
 	defer mgr.mLock.Unlock()
 
-	//无论原来有没有，都重新创建一个新的session
+	//无论原来有没有，都重新创建一个新的session, 原来的 删除, 防止 session 固定攻击
+	if cookie, err := r.Cookie(mgr.mCookieName); err == nil && cookie.Value != "" {
+		mgr.deleteSession(cookie.Value)
+	}
 	newSessionID := url.QueryEscape(mgr.NewSessionID())
 
-	//存指针
-	var session *Session = &Session{mSessionID: newSessionID, mLastTimeAccessed: time.Now(), mValues: make(map[interface{}]interface{})}
-	mgr.mSessions[newSessionID] = session
+	now := time.Now()
+	session := &Session{
+		ID:             newSessionID,
+		CSRFToken:      mgr.NewSessionID(),
+		CreateTime:     now,
+		LastAccessTime: now,
+		Values:         make(map[string]interface{}),
+	}
+	if err := mgr.mStore.Save(session); err != nil {
+		log.Println("session save err:", err)
+	}
 	//让浏览器cookie设置过期时间
-	cookie := http.Cookie{Name: mgr.mCookieName, Value: newSessionID, Path: "/", HttpOnly: true, MaxAge: int(mgr.mMaxLifeTime)}
-	http.SetCookie(w, &cookie)
+	http.SetCookie(w, mgr.newCookie(newSessionID, int(mgr.getCookieMaxAge())))
 
 	return newSessionID
 }
 
+// 有绝对超时时间的情况下, cookie 过期时间 不超过 绝对超时时间
+func (mgr *SessionMgr) getCookieMaxAge() int64 {
+	if mgr.mOption.AbsoluteTimeout > 0 && mgr.mOption.AbsoluteTimeout < mgr.mOption.IdleTimeout {
+		return mgr.mOption.AbsoluteTimeout
+	}
+	return mgr.mOption.IdleTimeout
+}
+
 // 结束Session
 func (mgr *SessionMgr) EndSession(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie(mgr.mCookieName)
@@ -72,12 +125,12 @@ func (mgr *SessionMgr) EndSession(w http.ResponseWriter, r *http.Request) {
 		mgr.mLock.Lock()
 		defer mgr.mLock.Unlock()
 
-		delete(mgr.mSessions, cookie.Value)
+		mgr.deleteSession(cookie.Value)
 
 		//让浏览器cookie立刻过期
-		expiration := time.Now()
-		cookie := http.Cookie{Name: mgr.mCookieName, Path: "/", HttpOnly: true, Expires: expiration, MaxAge: -1}
-		http.SetCookie(w, &cookie)
+		expiredCookie := mgr.newCookie("", -1)
+		expiredCookie.Expires = time.Now()
+		http.SetCookie(w, expiredCookie)
 	}
 }
 
@@ -86,26 +139,62 @@ func (mgr *SessionMgr) EndSessionBy(sessionID string) {
 	mgr.mLock.Lock()
 	defer mgr.mLock.Unlock()
 
-	delete(mgr.mSessions, sessionID)
+	mgr.deleteSession(sessionID)
+}
+
+func (mgr *SessionMgr) deleteSession(sessionID string) {
+	if err := mgr.mStore.Delete(sessionID); err != nil {
+		log.Println("session delete err:", err)
+	}
+}
+
+// 获取 没有过期的 session, 过期的 直接删除
+func (mgr *SessionMgr) getSession(sessionID string) *Session {
+	session, err := mgr.mStore.Get(sessionID)
+	if err != nil {
+		log.Println("session get err:", err)
+		return nil
+	}
+	if session == nil {
+		return nil
+	}
+	if mgr.isExpired(session, time.Now()) {
+		mgr.deleteSession(sessionID)
+		return nil
+	}
+	return session
 }
 
-// 设置session里面的值
-func (mgr *SessionMgr) SetSessionVal(sessionID string, key interface{}, value interface{}) {
+func (mgr *SessionMgr) isExpired(session *Session, now time.Time) bool {
+	if session.LastAccessTime.Unix()+mgr.mOption.IdleTimeout < now.Unix() {
+		return true
+	}
+	if mgr.mOption.AbsoluteTimeout > 0 && session.CreateTime.Unix()+mgr.mOption.AbsoluteTimeout < now.Unix() {
+		return true
+	}
+	return false
+}
+
+// 设置session里面的值, 值 需要可以 json 序列化, 持久化存储 读取出来之后 为 json 反序列化之后的类型
+func (mgr *SessionMgr) SetSessionVal(sessionID string, key string, value interface{}) {
 	mgr.mLock.Lock()
 	defer mgr.mLock.Unlock()
 
-	if session, ok := mgr.mSessions[sessionID]; ok {
-		session.mValues[key] = value
+	if session := mgr.getSession(sessionID); session != nil {
+		session.Values[key] = value
+		if err := mgr.mStore.Save(session); err != nil {
+			log.Println("session save err:", err)
+		}
 	}
 }
 
 // 得到session里面的值
-func (mgr *SessionMgr) GetSessionVal(sessionID string, key interface{}) (interface{}, bool) {
+func (mgr *SessionMgr) GetSessionVal(sessionID string, key string) (interface{}, bool) {
 	mgr.mLock.RLock()
 	defer mgr.mLock.RUnlock()
 
-	if session, ok := mgr.mSessions[sessionID]; ok {
-		if val, ok := session.mValues[key]; ok {
+	if session, _ := mgr.mStore.Get(sessionID); session != nil && !mgr.isExpired(session, time.Now()) {
+		if val, ok := session.Values[key]; ok {
 			return val, ok
 		}
 	}
@@ -120,8 +209,9 @@ func (mgr *SessionMgr) GetSessionIDList() []string {
 
 	sessionIDList := make([]string, 0)
 
-	for k, _ := range mgr.mSessions {
-		sessionIDList = append(sessionIDList, k)
+	sessionList, _ := mgr.mStore.List()
+	for _, session := range sessionList {
+		sessionIDList = append(sessionIDList, session.ID)
 	}
 
 	return sessionIDList[0:len(sessionIDList)]
@@ -141,21 +231,47 @@ func (mgr *SessionMgr) CheckCookieValid(w http.ResponseWriter, r *http.Request)
 
 	sessionID := cookie.Value
 
-	if session, ok := mgr.mSessions[sessionID]; ok {
-		session.mLastTimeAccessed = time.Now() //判断合法性的同时，更新最后的访问时间
+	if session := mgr.getSession(sessionID); session != nil {
+		//判断合法性的同时，更新最后的访问时间
+		now := time.Now()
+		if now.Unix()-session.LastAccessTime.Unix() >= sessionTouchInterval {
+			session.LastAccessTime = now
+			if err := mgr.mStore.Save(session); err != nil {
+				log.Println("session save err:", err)
+			}
+		}
 		return sessionID
 	}
 
 	return ""
 }
 
+// 获取 session 的 csrf token, 页面中 POST 请求的时候 通过 X-CSRF-Token 请求头 提交
+func (mgr *SessionMgr) GetCSRFToken(sessionID string) string {
+	mgr.mLock.RLock()
+	defer mgr.mLock.RUnlock()
+
+	if session, _ := mgr.mStore.Get(sessionID); session != nil {
+		return session.CSRFToken
+	}
+	return ""
+}
+
+func (mgr *SessionMgr) CheckCSRFToken(sessionID string, token string) bool {
+	csrfToken := mgr.GetCSRFToken(sessionID)
+	if csrfToken == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(csrfToken), []byte(token)) == 1
+}
+
 // 更新最后访问时间
 func (mgr *SessionMgr) GetLastAccessTime(sessionID string) time.Time {
 	mgr.mLock.RLock()
 	defer mgr.mLock.RUnlock()
 
-	if session, ok := mgr.mSessions[sessionID]; ok {
-		return session.mLastTimeAccessed
+	if session, _ := mgr.mStore.Get(sessionID); session != nil {
+		return session.LastAccessTime
 	}
 
 	return time.Now()
@@ -163,18 +279,27 @@ func (mgr *SessionMgr) GetLastAccessTime(sessionID string) time.Time {
 
 // GC回收
 func (mgr *SessionMgr) GC() {
+	mgr.gc(time.Now())
+
+	//定时回收
+	time.AfterFunc(time.Duration(mgr.mOption.IdleTimeout)*time.Second, func() { mgr.GC() })
+}
+
+func (mgr *SessionMgr) gc(now time.Time) {
 	mgr.mLock.Lock()
 	defer mgr.mLock.Unlock()
 
-	for sessionID, session := range mgr.mSessions {
+	sessionList, err := mgr.mStore.List()
+	if err != nil {
+		log.Println("session list err:", err)
+		return
+	}
+	for _, session := range sessionList {
 		//删除超过时限的session
-		if session.mLastTimeAccessed.Unix()+mgr.mMaxLifeTime < time.Now().Unix() {
-			delete(mgr.mSessions, sessionID)
+		if mgr.isExpired(session, now) {
+			mgr.deleteSession(session.ID)
 		}
 	}
-
-	//定时回收
-	time.AfterFunc(time.Duration(mgr.mMaxLifeTime)*time.Second, func() { mgr.GC() })
 }
 
 // 创建唯一ID
@@ -190,7 +315,9 @@ func (mgr *SessionMgr) NewSessionID() string {
 //——————————————————————————
 /*会话*/
 type Session struct {
-	mSessionID        string                      //唯一id
-	mLastTimeAccessed time.Time                   //最后访问时间
-	mValues           map[interface{}]interface{} //其它对应值(保存用户所对应的一些值，比如用户权限之类)
+	ID             string                 //唯一id
+	CSRFToken      string                 //防止 跨站请求伪造
+	CreateTime     time.Time              //创建时间
+	LastAccessTime time.Time              //最后访问时间
+	Values         map[string]interface{} //其它对应值(保存用户所对应的一些值，比如用户权限之类)
 }
@@ -24,3 +24,8 @@ func StartSession(cookieName ...string) {
 		sessionMgr = NewSessionMgr(cookieName[0], 3600)
 	}
 }
+
+// 指定 session 存储 及 超时时间,cookie 属性
+func StartSessionWithStore(cookieName string, store SessionStore, option SessionOption) {
+	sessionMgr = NewSessionMgrWithStore(cookieName, store, option)
+}
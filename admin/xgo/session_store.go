@@ -0,0 +1,72 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package xgo
+
+import "sync"
+
+/*
+session 存储
+默认保存在 进程内存中, 重启之后 需要重新登录
+多个节点 共享 session 的情况下, 需要 实现 SessionStore 保存到 leveldb,redis 等存储中
+并发 由 SessionMgr 加锁控制
+*/
+type SessionStore interface {
+	// 不存在的情况下 返回 nil,nil
+	Get(sessionID string) (*Session, error)
+	Save(session *Session) error
+	Delete(sessionID string) error
+	// 用于 定时回收 过期的 session
+	List() ([]*Session, error)
+}
+
+type MemorySessionStore struct {
+	sync.RWMutex
+	sessions map[string]*Session //保存session的指针[sessionID] = session
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]*Session)}
+}
+
+func (store *MemorySessionStore) Get(sessionID string) (*Session, error) {
+	store.RLock()
+	defer store.RUnlock()
+	return store.sessions[sessionID], nil
+}
+
+func (store *MemorySessionStore) Save(session *Session) error {
+	store.Lock()
+	defer store.Unlock()
+	store.sessions[session.ID] = session
+	return nil
+}
+
+func (store *MemorySessionStore) Delete(sessionID string) error {
+	store.Lock()
+	defer store.Unlock()
+	delete(store.sessions, sessionID)
+	return nil
+}
+
+func (store *MemorySessionStore) List() ([]*Session, error) {
+	store.RLock()
+	defer store.RUnlock()
+	sessionList := make([]*Session, 0, len(store.sessions))
+	for _, session := range store.sessions {
+		sessionList = append(sessionList, session)
+	}
+	return sessionList, nil
+}
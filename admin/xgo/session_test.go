@@ -0,0 +1,43 @@
+package xgo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSessionMgr_isExpired(t *testing.T) {
+	mgr := &SessionMgr{mOption: SessionOption{IdleTimeout: 60, AbsoluteTimeout: 600}, mStore: NewMemorySessionStore()}
+	now := time.Now()
+	if mgr.isExpired(&Session{CreateTime: now.Add(-100 * time.Second), LastAccessTime: now.Add(-10 * time.Second)}, now) {
+		t.Fatal("session must not be expired")
+	}
+	if !mgr.isExpired(&Session{CreateTime: now.Add(-100 * time.Second), LastAccessTime: now.Add(-61 * time.Second)}, now) {
+		t.Fatal("session must be idle expired")
+	}
+	if !mgr.isExpired(&Session{CreateTime: now.Add(-601 * time.Second), LastAccessTime: now}, now) {
+		t.Fatal("session must be absolute expired")
+	}
+}
+
+func TestSessionMgr_CSRFToken(t *testing.T) {
+	mgr := &SessionMgr{mCookieName: "xgo_cookie", mOption: SessionOption{IdleTimeout: 60, HttpOnly: true, SameSite: http.SameSiteStrictMode}, mStore: NewMemorySessionStore()}
+	w := httptest.NewRecorder()
+	sessionID := mgr.StartSession(w, httptest.NewRequest("GET", "/", nil))
+	cookie := w.Result().Cookies()[0]
+	if cookie.Value != sessionID || !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode {
+		t.Fatal("cookie error:", cookie)
+	}
+	token := mgr.GetCSRFToken(sessionID)
+	if token == "" || !mgr.CheckCSRFToken(sessionID, token) {
+		t.Fatal("csrf token check must be true")
+	}
+	if mgr.CheckCSRFToken(sessionID, "") || mgr.CheckCSRFToken(sessionID, token+"1") || mgr.CheckCSRFToken("other", token) {
+		t.Fatal("csrf token check must be false")
+	}
+	mgr.EndSessionBy(sessionID)
+	if mgr.CheckCSRFToken(sessionID, token) {
+		t.Fatal("csrf token check must be false after session end")
+	}
+}
@@ -80,6 +80,8 @@ func (route *routeController) DoController0(w http.ResponseWriter, req *http.Req
 	vc := reflect.New(route.controllerType)
 	execController := vc.Interface().(ControllerInterface)
 	execController.Init(&Context{Request: req, ResponseWriter: w, Session: sessionMgr}, route.controllerName, route.funName)
+	// 通过接口调用, 才会执行 具体 controller 的 Finish, StopServeJSON 等 panic 退出的时候 也要执行
+	defer execController.Finish()
 	execController.Prepare()
 	t := reflect.ValueOf(execController)
 	t.MethodByName(route.funName).Call(nil)
@@ -0,0 +1,138 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Bifrost apply -f pipeline.yaml 及 Bifrost diff -f pipeline.yaml
+// 通过管理接口 /pipeline/plan , /pipeline/apply 对运行中的 Bifrost 进行声明式配置
+
+type pipelineResult struct {
+	Status int
+	Msg    string
+	Data   struct {
+		Plan string
+	}
+}
+
+func isPipelineCmd(args []string) bool {
+	return len(args) > 1 && (args[1] == "apply" || args[1] == "diff")
+}
+
+func pipelineCmd(cmd string, args []string) int {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	var file, server, user, password string
+	var prune, autoApprove, insecure bool
+	fs.StringVar(&file, "f", "", "pipeline yaml or json file")
+	fs.StringVar(&server, "server", "http://127.0.0.1:21036", "Bifrost admin address")
+	fs.StringVar(&user, "user", os.Getenv("BIFROST_USER"), "Bifrost admin user, default env BIFROST_USER")
+	fs.StringVar(&password, "password", os.Getenv("BIFROST_PASSWORD"), "Bifrost admin password, default env BIFROST_PASSWORD")
+	fs.BoolVar(&prune, "prune", false, "delete config not in file")
+	fs.BoolVar(&autoApprove, "y", false, "apply without confirm")
+	fs.BoolVar(&insecure, "insecure", false, "skip tls certificate verify")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: Bifrost %s -f pipeline.yaml [-server http://127.0.0.1:21036] [-user Bifrost -password Bifrost123] [-prune] [-y]\n\nOptions:\n", cmd)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if file == "" {
+		fs.Usage()
+		return 2
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	client := &http.Client{Timeout: 5 * time.Minute}
+	if insecure {
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	server = strings.TrimRight(server, "/")
+	if !strings.HasPrefix(server, "http://") && !strings.HasPrefix(server, "https://") {
+		server = "http://" + server
+	}
+	pipelinePost := func(uri string) (*pipelineResult, error) {
+		url := fmt.Sprintf("%s%s?Prune=%t", server, uri, prune)
+		req, err := http.NewRequest("POST", url, bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-yaml")
+		req.SetBasicAuth(user, password)
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		var result pipelineResult
+		if err = json.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("http code:%d body:%s", resp.StatusCode, string(body))
+		}
+		return &result, nil
+	}
+
+	result, err := pipelinePost("/pipeline/plan")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if result.Status != 1 {
+		fmt.Println(result.Msg)
+		return 1
+	}
+	fmt.Println(result.Data.Plan)
+	if cmd == "diff" || result.Data.Plan == "No changes." {
+		return 0
+	}
+	if !autoApprove {
+		fmt.Print("\nDo you want to perform these actions? Only 'yes' will be accepted to approve.\n  Enter a value: ")
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(line) != "yes" {
+			fmt.Println("Apply cancelled.")
+			return 1
+		}
+	}
+	// apply 的时候服务端重新对比,执行的是服务端当时的变更计划
+	result, err = pipelinePost("/pipeline/apply")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if result.Status != 1 {
+		fmt.Println("Apply failed:", result.Msg)
+		return 1
+	}
+	fmt.Println("Apply complete!")
+	return 0
+}
@@ -24,6 +24,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 )
 
 func LoadConf(BifrostConfigFile string) {
@@ -185,6 +186,11 @@ func InitParam() {
 	}
 	DelConfig("Bifrostd", "file_queue_usable_count_time_diff")
 
+	if GetConfigVal("Bifrostd", "mysql_schema_history") == "true" {
+		MySQLSchemaHistory = true
+	}
+	DelConfig("Bifrostd", "mysql_schema_history")
+
 	tmp = GetConfigVal("Bifrostd", "plugin_commit_timeout")
 	if tmp != "" {
 		intA, err := strconv.Atoi(tmp)
@@ -207,6 +213,17 @@ func InitParam() {
 	}
 	DelConfig("Bifrostd", "plugin_sync_retry_time")
 
+	tmp = GetConfigVal("Bifrostd", "toserver_transaction_max_size")
+	if tmp != "" {
+		intA, err := strconv.Atoi(tmp)
+		if err == nil && intA > 0 {
+			ToServerTransactionMaxSize = intA
+		} else {
+			log.Println("Bifrost.ini Bifrostd.toserver_transaction_max_size type conversion to int err:", err)
+		}
+	}
+	DelConfig("Bifrostd", "toserver_transaction_max_size")
+
 	tmp = GetConfigVal("Bifrostd", "refuse_ip_login_failed_count")
 	if tmp != "" {
 		intA, err := strconv.Atoi(tmp)
@@ -229,9 +246,107 @@ func InitParam() {
 	}
 	DelConfig("Bifrostd", "refuse_ip_timeout")
 
+	if GetConfigVal("Bifrostd", "ha") == "true" {
+		HA = true
+	}
+	DelConfig("Bifrostd", "ha")
+
+	HANodeAddr = GetConfigVal("Bifrostd", "ha_node_addr")
+	if HANodeAddr == "" {
+		HANodeAddr = Listen
+	}
+	DelConfig("Bifrostd", "ha_node_addr")
+
+	tmp = GetConfigVal("Bifrostd", "ha_lease_timeout")
+	if tmp != "" {
+		intA, err := strconv.Atoi(tmp)
+		if err == nil && intA >= 3 {
+			HALeaseTimeout = intA
+		} else {
+			log.Println("Bifrost.ini Bifrostd.ha_lease_timeout type conversion to int err or less than 3:", err)
+		}
+	}
+	DelConfig("Bifrostd", "ha_lease_timeout")
+
+	tmp = GetConfigVal("Bifrostd", "audit_log_retention_days")
+	if tmp != "" {
+		intA, err := strconv.Atoi(tmp)
+		if err == nil && intA >= 0 {
+			AuditLogRetentionDays = intA
+		} else {
+			log.Println("Bifrost.ini Bifrostd.audit_log_retention_days type conversion to int err:", err)
+		}
+	}
+	DelConfig("Bifrostd", "audit_log_retention_days")
+
+	SecretMasterKeyFile = GetConfigVal("Bifrostd", "secret_master_key_file")
+	DelConfig("Bifrostd", "secret_master_key_file")
+
+	SecretFileDir = GetConfigVal("Bifrostd", "secret_file_dir")
+	DelConfig("Bifrostd", "secret_file_dir")
+
+	BinlogFileDir = GetConfigVal("Bifrostd", "binlog_file_dir")
+	DelConfig("Bifrostd", "binlog_file_dir")
+
+	initSessionParam()
+
 	initTLSParam()
 }
 
+func initSessionParam() {
+	tmp := strings.ToLower(GetConfigVal("Bifrostd", "session_store"))
+	switch tmp {
+	case "":
+		break
+	case "memory", "xdb":
+		SessionStore = tmp
+	default:
+		log.Println("Bifrost.ini Bifrostd.session_store:", tmp, " not supported, must be memory or xdb")
+	}
+	DelConfig("Bifrostd", "session_store")
+
+	tmp = GetConfigVal("Bifrostd", "session_idle_timeout")
+	if tmp != "" {
+		intA, err := strconv.ParseInt(tmp, 10, 64)
+		if err == nil && intA > 0 {
+			SessionIdleTimeout = intA
+		} else {
+			log.Println("Bifrost.ini Bifrostd.session_idle_timeout type conversion to int64 err:", err)
+		}
+	}
+	DelConfig("Bifrostd", "session_idle_timeout")
+
+	tmp = GetConfigVal("Bifrostd", "session_absolute_timeout")
+	if tmp != "" {
+		intA, err := strconv.ParseInt(tmp, 10, 64)
+		if err == nil && intA >= 0 {
+			SessionAbsoluteTimeout = intA
+		} else {
+			log.Println("Bifrost.ini Bifrostd.session_absolute_timeout type conversion to int64 err:", err)
+		}
+	}
+	DelConfig("Bifrostd", "session_absolute_timeout")
+
+	SessionCookieSecure = strings.ToLower(GetConfigVal("Bifrostd", "session_cookie_secure"))
+	DelConfig("Bifrostd", "session_cookie_secure")
+
+	if GetConfigVal("Bifrostd", "session_cookie_httponly") == "false" {
+		SessionCookieHttpOnly = false
+	}
+	DelConfig("Bifrostd", "session_cookie_httponly")
+
+	tmp = strings.ToLower(GetConfigVal("Bifrostd", "session_cookie_samesite"))
+	switch tmp {
+	case "":
+		break
+	case "lax", "strict", "none":
+		SessionCookieSameSite = tmp
+	default:
+		log.Println("Bifrost.ini Bifrostd.session_cookie_samesite:", tmp, " not supported, must be lax,strict or none")
+	}
+	DelConfig("Bifrostd", "session_cookie_samesite")
+}
+
 func initTLSParam() {
 	var path string
 	var tlsKeyFile string = GetConfigVal("Bifrostd", "tls_key_file")
@@ -21,12 +21,18 @@ var FileQueueUsableCountTimeDiff int64 = 5000
 // 配置 FileQueueUsableCountTimeDiff 参数 使用
 var FileQueueUsableCount uint32 = 10
 
+// 是否开启 MySQL 源端 离线表结构历史, 开启后 解析历史位点的 binlog 的时候，使用当时生效的表结构，而不是源端当前的表结构
+var MySQLSchemaHistory bool = false
+
 // 在没有数据的情况下,间隔多久提交一次插件,单位 秒
 var PluginCommitTimeOut int = 5
 
 // 在同步出错的情况下,每2次重试之后 间隔多久再重试 ,单位 秒
 var PluginSyncRetrycTime int = 5
 
+// ToServer 开启 Transaction 的时候,一个事务最多在内存中缓存多少条数据,超过之后 改为逐条提交
+var ToServerTransactionMaxSize int = 10000
+
 // Bifrost 根目录文件夹绝对路径
 var BifrostDir string = ""
 
@@ -52,3 +58,41 @@ var RefuseIpTimeOut int64 = 14400
 
 // 间隔多久计算一次最小的位点值并且提交给Input插件层,单位ms
 var CronCalcMinPositionTimeout = 3500
+
+// 是否开启多节点高可用,开启后只有抢到租约的 leader 节点才会启动数据源及同步,需要 meta_storage_type=redis
+var HA bool = false
+
+// 当前节点管理后台的访问地址,follower 节点拒绝写操作的时候,会返回 leader 节点的这个地址
+var HANodeAddr string = ""
+
+// leader 租约超时时间,单位 秒
+var HALeaseTimeout int = 10
+
+// 审计日志保留天数, 0 为永久保留
+var AuditLogRetentionDays int = 365
+
+// 加密 连接地址 的 master key 文件, 环境变量 BIFROST_MASTER_KEY 优先
+var SecretMasterKeyFile string = ""
+
+// 连接地址中 ${file:/path} 引用的文件 只能在这个目录下, 为空则 不允许 ${file:} 引用
+var SecretFileDir string = ""
+
+// mysql_binlog_file 数据源 离线解析的 binlog 文件 及 表结构快照文件 只能在这个目录下, 为空则 不允许使用 mysql_binlog_file 数据源
+var BinlogFileDir string = ""
+
+// 管理后台 session 存储, memory 保存在进程内存中, xdb 保存在 meta_storage_type 对应的 leveldb 或者 redis 中
+var SessionStore string = "memory"
+
+// session 多久没有访问 失效, 单位 秒
+var SessionIdleTimeout int64 = 3600
+
+// session 创建之后 多久 失效, 单位 秒, 0 为不限制
+var SessionAbsoluteTimeout int64 = 0
+
+// session cookie 是否只通过 https 发送, 为空则 开启 tls 的时候为 true
+var SessionCookieSecure string = ""
+
+var SessionCookieHttpOnly bool = true
+
+// session cookie 的 SameSite 属性, lax | strict | none
+var SessionCookieSameSite string = "lax"
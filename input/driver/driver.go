@@ -42,6 +42,15 @@ type Driver interface {
 	IsSupported(supportType SupportType) bool // 是否支持指定功能
 }
 
+// 需要 server 层 持久化 额外状态 的插件 实现这个接口, 比如 mysql 的 离线表结构历史
+// server 层 在 保存位点 之前 先保存状态, 保证 位点 之前的状态 都已经被保存了
+// 重新初始化插件的时候, 在 Start 之前 通过 SetState 将 之前保存的状态 交给插件
+type StateSupporter interface {
+	StateVersion() uint64 // 状态 每次变更 都会增加, 没有变化的情况下 server 层 不重复保存
+	GetState() ([]byte, error)
+	SetState(data []byte) error
+}
+
 type DriverStructure struct {
 	Version        string // 插件版本
 	BifrostVersion string // 插件开发所使用的Bifrost的版本
@@ -10,6 +10,8 @@ type InputInfo struct {
 	ServerId       uint32
 	MaxFileName    string
 	MaxPosition    uint32
+
+	LoopMarkerTable string // 双向同步 防回环 的标记表, schema.table, 更新过这个表的事务 不再同步
 }
 
 type PluginStatus struct {
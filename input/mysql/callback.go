@@ -65,6 +65,28 @@ func (c *MysqlInput) MySQLCallback(data *mysql.EventReslut) {
 		Pri:             data.Pri,
 		ColumnMapping:   data.ColumnMapping,
 		EventID:         data.EventID,
+		PresentColumns:  data.PresentColumns,
+		JsonDiffs:       transferJsonDiffs(data.JsonDiffs),
+		RowsQuery:       data.RowsQuery,
 	}
 	c.callback(data0)
 }
+
+func transferJsonDiffs(jsonDiffs []map[string][]*mysql.JsonDiff) []map[string][]*pluginDriver.JsonDiff {
+	if jsonDiffs == nil {
+		return nil
+	}
+	result := make([]map[string][]*pluginDriver.JsonDiff, len(jsonDiffs))
+	for i, columnDiffs := range jsonDiffs {
+		if columnDiffs == nil {
+			continue
+		}
+		result[i] = make(map[string][]*pluginDriver.JsonDiff, len(columnDiffs))
+		for columnName, diffs := range columnDiffs {
+			for _, diff := range diffs {
+				result[i][columnName] = append(result[i][columnName], (*pluginDriver.JsonDiff)(diff))
+			}
+		}
+	}
+	return result
+}
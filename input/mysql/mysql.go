@@ -9,6 +9,15 @@ import (
 
 var MySQLBinlogDump string
 
+// 需要回调给上层的 binlog 事件
+var binlogDumpEventTypes = []mysqlDriver.EventType{
+	mysqlDriver.WRITE_ROWS_EVENTv2, mysqlDriver.UPDATE_ROWS_EVENTv2, mysqlDriver.DELETE_ROWS_EVENTv2,
+	mysqlDriver.QUERY_EVENT,
+	mysqlDriver.XID_EVENT,
+	mysqlDriver.WRITE_ROWS_EVENTv1, mysqlDriver.UPDATE_ROWS_EVENTv1, mysqlDriver.DELETE_ROWS_EVENTv1,
+	mysqlDriver.WRITE_ROWS_EVENTv0, mysqlDriver.UPDATE_ROWS_EVENTv0, mysqlDriver.DELETE_ROWS_EVENTv0,
+}
+
 type MysqlInput struct {
 	sync.RWMutex
 	inputDriver.PluginDriverInterface
@@ -22,6 +31,9 @@ type MysqlInput struct {
 	callback         inputDriver.Callback
 
 	replicateDoDb map[string]map[string]bool
+
+	schemaHistory *mysqlDriver.SchemaHistory // 离线表结构历史
+	stateData     []byte                     // server 层 保存的 插件状态, 即 表结构历史
 }
 
 func NewInputPlugin() inputDriver.Driver {
@@ -58,16 +70,14 @@ func (c *MysqlInput) Start0() error {
 	c.binlogDump = mysqlDriver.NewBinlogDump(
 		c.inputInfo.ConnectUri,
 		c.MySQLCallback,
-		[]mysqlDriver.EventType{
-			mysqlDriver.WRITE_ROWS_EVENTv2, mysqlDriver.UPDATE_ROWS_EVENTv2, mysqlDriver.DELETE_ROWS_EVENTv2,
-			mysqlDriver.QUERY_EVENT,
-			mysqlDriver.XID_EVENT,
-			mysqlDriver.WRITE_ROWS_EVENTv1, mysqlDriver.UPDATE_ROWS_EVENTv1, mysqlDriver.DELETE_ROWS_EVENTv1,
-			mysqlDriver.WRITE_ROWS_EVENTv0, mysqlDriver.UPDATE_ROWS_EVENTv0, mysqlDriver.DELETE_ROWS_EVENTv0,
-		},
+		binlogDumpEventTypes,
 		nil, nil)
+	if err := c.binlogDump.SetLoopMarkerTable(c.inputInfo.LoopMarkerTable); err != nil {
+		return err
+	}
 	c.binlogDump.SetNextEventID(c.eventID)
 	c.InitBinlogDumpReplicateDoDb()
+	c.initSchemaHistory()
 	if !c.inputInfo.IsGTID || c.inputInfo.GTID == "" {
 		go c.binlogDump.StartDumpBinlog(c.inputInfo.BinlogFileName, c.inputInfo.BinlogPostion, c.inputInfo.ServerId, c.reslut, c.inputInfo.MaxFileName, c.inputInfo.MaxPosition)
 	} else {
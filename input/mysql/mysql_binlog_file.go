@@ -0,0 +1,337 @@
+package mysql
+
+import (
+	"bytes"
+	"fmt"
+	mysqlDriver "github.com/brokercap/Bifrost/Bristol/mysql"
+	"github.com/brokercap/Bifrost/config"
+	inputDriver "github.com/brokercap/Bifrost/input/driver"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+离线解析本地 binlog 文件 / relay log, 不需要连接 MySQL
+用于 基于备份的 binlog 做时间点恢复 回放到目标库, 以及 不依赖 MySQL 复现 binlog 解析问题
+
+/data/mysql/binlog?schema=/data/mysql/schema.sql&gtid=3E11FA47-71CA-11E1-9E33-C80AA9429562:1-100
+
+	路径 为 binlog 文件 或者 目录, 目录的时候 按文件名后缀顺序解析目录下所有 binlog 文件
+	schema 表结构快照文件, mysqldump --no-data 导出的 CREATE TABLE 语句, 或者 表结构历史导出的 json
+	gtid 可选, 只解析这个 GTID 集合中的事务
+	开始位点 为添加数据源时候的 BinlogFileName,BinlogPosition, 结束位点 为 MaxFileName,MaxPosition
+	binlog 文件 及 schema 文件 都只能在 Bifrost.ini 中 binlog_file_dir 配置的目录下
+*/
+
+func init() {
+	inputDriver.Register("mysql_binlog_file", NewMysqlBinlogFileInputPlugin, VERSION, BIFROST_VERSION)
+}
+
+type BinlogFileConfig struct {
+	Path       string
+	SchemaFile string
+	Gtid       string
+}
+
+func NewBinlogFileConfig(uri string) (*BinlogFileConfig, error) {
+	uri = strings.TrimPrefix(strings.TrimSpace(uri), "file://")
+	path, rawQuery := uri, ""
+	if i := strings.Index(uri, "?"); i >= 0 {
+		path, rawQuery = uri[:i], uri[i+1:]
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+	c := &BinlogFileConfig{
+		Path:       path,
+		SchemaFile: query.Get("schema"),
+		Gtid:       query.Get("gtid"),
+	}
+	if c.Path == "" {
+		return nil, fmt.Errorf("binlog file path is empty")
+	}
+	if c.SchemaFile == "" {
+		return nil, fmt.Errorf("schema snapshot file is empty")
+	}
+	if c.Path, err = checkBinlogFilePath(c.Path); err != nil {
+		return nil, err
+	}
+	if c.SchemaFile, err = checkBinlogFilePath(c.SchemaFile); err != nil {
+		return nil, err
+	}
+	if c.Gtid != "" {
+		if err = mysqlDriver.CheckGtid(c.Gtid); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// 加载 表结构快照, json 为表结构历史, 其他的当作 CREATE TABLE 语句
+func LoadSchemaSnapshot(fileName string) (*mysqlDriver.SchemaHistory, error) {
+	fileName, err := checkBinlogFilePath(fileName)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	schemaHistory := mysqlDriver.NewSchemaHistory()
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		err = schemaHistory.Decode(data)
+	} else {
+		err = schemaHistory.ImportSQL(string(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load schema snapshot %s err:%s", fileName, err)
+	}
+	return schemaHistory, nil
+}
+
+// 管理后台的用户 可以修改连接地址, 不能读取 binlog_file_dir 以外的文件
+// 软链接 替换成 实际的路径 再判断
+func checkBinlogFilePath(path string) (string, error) {
+	if config.BinlogFileDir == "" {
+		return "", fmt.Errorf("binlog_file_dir not be config")
+	}
+	dir, err := filepath.EvalSymlinks(config.BinlogFileDir)
+	if err != nil {
+		return "", err
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	realPath, err = filepath.Abs(realPath)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(dir, realPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s not in binlog_file_dir", path)
+	}
+	return realPath, nil
+}
+
+type MysqlBinlogFileInput struct {
+	MysqlInput
+}
+
+func NewMysqlBinlogFileInputPlugin() inputDriver.Driver {
+	return &MysqlBinlogFileInput{}
+}
+
+func (c *MysqlBinlogFileInput) GetUriExample() (string, string) {
+	notesHtml := `
+		<p><span class="help-block m-b-none">离线解析本地 binlog 文件 或者 relay log, 路径为 binlog 文件 或者 目录(按文件名后缀顺序解析目录下所有文件)</span></p>
+		<p><span class="help-block m-b-none">schema: 表结构快照文件, mysqldump --no-data 导出的 CREATE TABLE 语句; gtid: 可选, 只解析这个 GTID 集合中的事务</span></p>
+		<p><span class="help-block m-b-none">从 BinlogFileName,BinlogPosition 开始解析, 到 MaxFileName,MaxPosition 或者 最后一个文件结束</span></p>
+		<p><span class="help-block m-b-none">binlog 文件 及 schema 文件 都只能在 Bifrost.ini 中 binlog_file_dir 配置的目录下</span></p>
+	`
+	return "/data/mysql/binlog?schema=/data/mysql/schema.sql", notesHtml
+}
+
+func (c *MysqlBinlogFileInput) IsSupported(supportType inputDriver.SupportType) bool {
+	switch supportType {
+	case inputDriver.SupportIncre:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *MysqlBinlogFileInput) Start(ch chan *inputDriver.PluginStatus) error {
+	switch c.status {
+	case inputDriver.STOPPING, inputDriver.STOPPED:
+		return c.Start1()
+	default:
+		c.PluginStatusChan = ch
+		return c.startDumpBinlogFile()
+	}
+}
+
+func (c *MysqlBinlogFileInput) startDumpBinlogFile() error {
+	config, err := NewBinlogFileConfig(c.inputInfo.ConnectUri)
+	if err != nil {
+		return err
+	}
+	fileList, err := mysqlDriver.GetBinlogFileList(config.Path)
+	if err != nil {
+		return err
+	}
+	schemaHistory, err := c.loadSchemaHistory(config)
+	if err != nil {
+		return err
+	}
+	c.reslut = make(chan error, 1)
+	c.binlogDump = mysqlDriver.NewBinlogDump(c.inputInfo.ConnectUri, c.MySQLCallback, binlogDumpEventTypes, nil, nil)
+	if err = c.binlogDump.SetLoopMarkerTable(c.inputInfo.LoopMarkerTable); err != nil {
+		return err
+	}
+	c.binlogDump.SetNextEventID(c.eventID)
+	c.InitBinlogDumpReplicateDoDb()
+	c.setSchemaHistory(schemaHistory)
+	go c.binlogDump.StartDumpBinlogFile(fileList, c.inputInfo.BinlogFileName, c.inputInfo.BinlogPostion, config.Gtid, c.reslut, c.inputInfo.MaxFileName, c.inputInfo.MaxPosition)
+	go c.monitorDump()
+	return nil
+}
+
+// 优先使用 内存中 及 server 层保存的表结构历史, 包含了 快照之后 已经解析过的 DDL
+func (c *MysqlBinlogFileInput) loadSchemaHistory(config *BinlogFileConfig) (*mysqlDriver.SchemaHistory, error) {
+	if schemaHistory := c.getCurrentSchemaHistory(); schemaHistory != nil {
+		return schemaHistory, nil
+	}
+	if data := c.getStateData(); len(data) > 0 {
+		schemaHistory := mysqlDriver.NewSchemaHistory()
+		err := schemaHistory.Decode(data)
+		if err == nil {
+			return schemaHistory, nil
+		}
+		log.Printf("[ERROR] input[%s] %s decode schema history err:%s \n", "mysql_binlog_file", c.inputInfo.DbName, err)
+	}
+	return LoadSchemaSnapshot(config.SchemaFile)
+}
+
+// 没有启动的时候, 直接从 表结构快照 中获取
+func (c *MysqlBinlogFileInput) getSchemaHistory() (*mysqlDriver.SchemaHistory, error) {
+	if c.binlogDump != nil {
+		if schemaHistory := c.binlogDump.GetSchemaHistory(); schemaHistory != nil {
+			return schemaHistory, nil
+		}
+	}
+	config, err := NewBinlogFileConfig(c.inputInfo.ConnectUri)
+	if err != nil {
+		return nil, err
+	}
+	return LoadSchemaSnapshot(config.SchemaFile)
+}
+
+func (c *MysqlBinlogFileInput) GetSchemaList() ([]string, error) {
+	schemaHistory, err := c.getSchemaHistory()
+	if err != nil {
+		return nil, err
+	}
+	databaseList := make([]string, 0)
+	for schemaName := range schemaHistory.GetTableList() {
+		databaseList = append(databaseList, schemaName)
+	}
+	sort.Strings(databaseList)
+	return databaseList, nil
+}
+
+func (c *MysqlBinlogFileInput) GetSchemaTableList(schema string) (tableList []inputDriver.TableList, err error) {
+	schemaHistory, err := c.getSchemaHistory()
+	if err != nil {
+		return nil, err
+	}
+	tableList = make([]inputDriver.TableList, 0)
+	for _, tableName := range schemaHistory.GetTableList()[schema] {
+		tableList = append(tableList, inputDriver.TableList{TableName: tableName, TableType: "BASE TABLE"})
+	}
+	return
+}
+
+func (c *MysqlBinlogFileInput) GetSchemaTableFieldList(schema string, table string) (FieldList []inputDriver.TableFieldInfo, err error) {
+	schemaHistory, err := c.getSchemaHistory()
+	if err != nil {
+		return nil, err
+	}
+	FieldList = make([]inputDriver.TableFieldInfo, 0)
+	columnList, _ := schemaHistory.GetLastTableColumns(schema, table)
+	for _, v := range columnList {
+		columnInfo := *v
+		var columnDefault *string
+		if columnInfo.COLUMN_DEFAULT != "" {
+			columnDefault = &columnInfo.COLUMN_DEFAULT
+		}
+		var numericScale *uint64
+		if n, err := strconv.ParseUint(columnInfo.NUMERIC_SCALE, 10, 64); err == nil {
+			numericScale = &n
+		}
+		FieldList = append(FieldList, inputDriver.TableFieldInfo{
+			ColumnName:      &columnInfo.COLUMN_NAME,
+			ColumnDefault:   columnDefault,
+			IsNullable:      columnInfo.IsNullable,
+			ColumnType:      &columnInfo.COLUMN_TYPE,
+			IsAutoIncrement: columnInfo.AutoIncrement,
+			Comment:         &columnInfo.COLUMN_COMMENT,
+			DataType:        &columnInfo.DATA_TYPE,
+			NumericScale:    numericScale,
+			ColumnKey:       &columnInfo.COLUMN_KEY,
+		})
+	}
+	return
+}
+
+func (c *MysqlBinlogFileInput) CheckPrivilege() (err error) {
+	_, err = c.CheckUri(false)
+	return
+}
+
+func (c *MysqlBinlogFileInput) CheckUri(CheckPrivilege bool) (CheckUriResult inputDriver.CheckUriResult, err error) {
+	config, err := NewBinlogFileConfig(c.inputInfo.ConnectUri)
+	if err != nil {
+		return
+	}
+	fileList, err := mysqlDriver.GetBinlogFileList(config.Path)
+	if err != nil {
+		return
+	}
+	if _, err = mysqlDriver.GetBinlogFileVersion(fileList[0]); err != nil {
+		return
+	}
+	if _, err = LoadSchemaSnapshot(config.SchemaFile); err != nil {
+		return
+	}
+	CheckUriResult.BinlogFile = filepath.Base(fileList[0])
+	CheckUriResult.BinlogPosition = 4
+	CheckUriResult.Gtid = config.Gtid
+	CheckUriResult.Msg = []string{fmt.Sprintf("binlog file count:%d, %s ~ %s", len(fileList), filepath.Base(fileList[0]), filepath.Base(fileList[len(fileList)-1]))}
+	return
+}
+
+// 最后一个文件的结束位置
+func (c *MysqlBinlogFileInput) GetCurrentPosition() (p *inputDriver.PluginPosition, err error) {
+	config, err := NewBinlogFileConfig(c.inputInfo.ConnectUri)
+	if err != nil {
+		return
+	}
+	fileList, err := mysqlDriver.GetBinlogFileList(config.Path)
+	if err != nil {
+		return
+	}
+	info, err := os.Stat(fileList[len(fileList)-1])
+	if err != nil {
+		return
+	}
+	p = &inputDriver.PluginPosition{
+		BinlogFileName: filepath.Base(fileList[len(fileList)-1]),
+		BinlogPostion:  uint32(info.Size()),
+		Timestamp:      uint32(time.Now().Unix()),
+	}
+	return
+}
+
+func (c *MysqlBinlogFileInput) GetVersion() (string, error) {
+	config, err := NewBinlogFileConfig(c.inputInfo.ConnectUri)
+	if err != nil {
+		return "", err
+	}
+	fileList, err := mysqlDriver.GetBinlogFileList(config.Path)
+	if err != nil {
+		return "", err
+	}
+	return mysqlDriver.GetBinlogFileVersion(fileList[0])
+}
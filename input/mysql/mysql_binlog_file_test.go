@@ -0,0 +1,57 @@
+package mysql
+
+import (
+	"github.com/brokercap/Bifrost/config"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewBinlogFileConfig_BinlogFileDir(t *testing.T) {
+	dir := t.TempDir()
+	outDir := t.TempDir()
+	schemaFile := filepath.Join(dir, "schema.sql")
+	if err := os.WriteFile(schemaFile, []byte("CREATE TABLE `test`.`t1` (`id` int NOT NULL, PRIMARY KEY (`id`));"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	outFile := filepath.Join(outDir, "schema.sql")
+	if err := os.WriteFile(outFile, []byte(""), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// 软链接 指向 binlog_file_dir 以外的文件
+	linkFile := filepath.Join(dir, "link.sql")
+	if err := os.Symlink(outFile, linkFile); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { config.BinlogFileDir = "" }()
+
+	// 没有配置 binlog_file_dir 的时候 不允许使用
+	config.BinlogFileDir = ""
+	if _, err := NewBinlogFileConfig(dir + "?schema=" + schemaFile); err == nil {
+		t.Fatal("binlog_file_dir not config, must be error")
+	}
+	if _, err := LoadSchemaSnapshot(schemaFile); err == nil {
+		t.Fatal("binlog_file_dir not config, must be error")
+	}
+
+	config.BinlogFileDir = dir
+	if _, err := NewBinlogFileConfig(dir + "?schema=" + schemaFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSchemaSnapshot(schemaFile); err != nil {
+		t.Fatal(err)
+	}
+	for _, uri := range []string{
+		outDir + "?schema=" + schemaFile,
+		dir + "?schema=" + outFile,
+		dir + "?schema=" + linkFile,
+		dir + "?schema=" + filepath.Join(dir, "..", filepath.Base(outDir), "schema.sql"),
+	} {
+		if _, err := NewBinlogFileConfig(uri); err == nil {
+			t.Fatal("uri:", uri, " not in binlog_file_dir, must be error")
+		}
+	}
+	if _, err := LoadSchemaSnapshot(linkFile); err == nil {
+		t.Fatal("schema file not in binlog_file_dir, must be error")
+	}
+}
@@ -250,10 +250,11 @@ func (c *MysqlInput) CheckUri(CheckPrivilege bool) (CheckUriResult inputDriver.C
 		}
 		if binlogRowImage, ok := BinlogRowImageMap["binlog_row_image"]; ok {
 			switch strings.ToLower(binlogRowImage) {
-			case "full":
+			// minimal,noblob 的时候 没有变更的字段 不会在 binlog 中, 数据中只包含部分字段
+			case "full", "minimal", "noblob":
 				break
 			default:
-				Msg = append(Msg, fmt.Sprintf("binlog_row_image(%s) != full", binlogRowImage))
+				Msg = append(Msg, fmt.Sprintf("binlog_row_image(%s) not in (full,minimal,noblob)", binlogRowImage))
 			}
 			CheckUriResult.BinlogRowImage = binlogRowImage
 		}
@@ -0,0 +1,68 @@
+package mysql
+
+import (
+	mysqlDriver "github.com/brokercap/Bifrost/Bristol/mysql"
+	"github.com/brokercap/Bifrost/config"
+	"log"
+)
+
+// 离线表结构历史 做为插件状态 由 server 层 持久化
+// server 层 在保存位点之前 保存, 重新初始化插件的时候 通过 SetState 交回给插件
+
+func (c *MysqlInput) SetState(data []byte) error {
+	c.Lock()
+	defer c.Unlock()
+	c.stateData = data
+	return nil
+}
+
+func (c *MysqlInput) getStateData() []byte {
+	c.RLock()
+	defer c.RUnlock()
+	return c.stateData
+}
+
+func (c *MysqlInput) StateVersion() uint64 {
+	if schemaHistory := c.getCurrentSchemaHistory(); schemaHistory != nil {
+		return schemaHistory.Version()
+	}
+	return 0
+}
+
+func (c *MysqlInput) GetState() ([]byte, error) {
+	if schemaHistory := c.getCurrentSchemaHistory(); schemaHistory != nil {
+		return schemaHistory.Encode()
+	}
+	return nil, nil
+}
+
+func (c *MysqlInput) getCurrentSchemaHistory() *mysqlDriver.SchemaHistory {
+	c.RLock()
+	defer c.RUnlock()
+	return c.schemaHistory
+}
+
+func (c *MysqlInput) setSchemaHistory(schemaHistory *mysqlDriver.SchemaHistory) {
+	c.Lock()
+	c.schemaHistory = schemaHistory
+	c.Unlock()
+	c.binlogDump.SetSchemaHistory(schemaHistory)
+}
+
+// 开启 离线表结构历史 的情况下, 优先使用 内存中的表结构历史, 没有则从 server 层 保存的状态中 加载
+// 都没有的时候 由 BinlogDump 在开始解析之前 记录 同步的表 在开始位点 的表结构快照
+func (c *MysqlInput) initSchemaHistory() {
+	if !config.MySQLSchemaHistory {
+		return
+	}
+	schemaHistory := c.getCurrentSchemaHistory()
+	if schemaHistory == nil {
+		schemaHistory = mysqlDriver.NewSchemaHistory()
+		if data := c.getStateData(); len(data) > 0 {
+			if err := schemaHistory.Decode(data); err != nil {
+				log.Printf("[ERROR] input[%s] %s decode schema history err:%s \n", "mysql", c.inputInfo.DbName, err)
+			}
+		}
+	}
+	c.setSchemaHistory(schemaHistory)
+}
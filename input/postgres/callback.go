@@ -0,0 +1,402 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package postgres
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	outputDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgtype"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (c *PostgresInput) ParseWALData(walData []byte) error {
+	logicalMsg, err := pglogrepl.Parse(walData)
+	if err != nil {
+		return err
+	}
+	switch msg := logicalMsg.(type) {
+	case *pglogrepl.RelationMessage:
+		c.relations[msg.RelationID] = msg
+	case *pglogrepl.BeginMessage:
+		c.currentTx = &transaction{
+			finalLSN:   msg.FinalLSN,
+			commitTime: uint32(msg.CommitTime.Unix()),
+		}
+	case *pglogrepl.CommitMessage:
+		c.DoCommit(msg)
+	case *pglogrepl.InsertMessage:
+		return c.ToInputCallback(msg.RelationID, "insert", nil, msg.Tuple)
+	case *pglogrepl.UpdateMessage:
+		return c.ToInputCallback(msg.RelationID, "update", msg.OldTuple, msg.NewTuple)
+	case *pglogrepl.DeleteMessage:
+		return c.ToInputCallback(msg.RelationID, "delete", msg.OldTuple, nil)
+	case *pglogrepl.TruncateMessage:
+		for _, relationID := range msg.RelationIDs {
+			c.TruncateCallback(relationID)
+		}
+	default:
+		// TypeMessage, OriginMessage 等不需要处理
+		break
+	}
+	return nil
+}
+
+func (c *PostgresInput) DoCommit(msg *pglogrepl.CommitMessage) {
+	c.Lock()
+	c.lastCommitLSN = msg.TransactionEndLSN
+	c.Unlock()
+	tx := c.currentTx
+	c.currentTx = nil
+	if tx == nil || !tx.hadRowEvent || c.callback == nil {
+		return
+	}
+	c.callback(&outputDriver.PluginDataType{
+		Timestamp:      uint32(msg.CommitTime.Unix()),
+		EventSize:      5,
+		EventType:      "commit",
+		Rows:           nil,
+		Query:          "",
+		BinlogFileNum:  1,
+		BinlogPosition: DefaultBinlogPosition,
+		Gtid:           c.LSN2GTID(msg.TransactionEndLSN),
+		Pri:            nil,
+		EventID:        c.getNextEventID(),
+	})
+}
+
+// 事务中间的数据,位点都是上一个事务结束的位点,只有 commit 事件才是当前事务结束的位点
+// 这样 server 层计算出来的最小位点,永远都在事务边界上
+
+func (c *PostgresInput) getTxInfo() (timestamp uint32, gtid string) {
+	c.RLock()
+	gtid = c.LSN2GTID(c.lastCommitLSN)
+	c.RUnlock()
+	if c.currentTx != nil {
+		timestamp = c.currentTx.commitTime
+	} else {
+		timestamp = uint32(time.Now().Unix())
+	}
+	return
+}
+
+func (c *PostgresInput) ToInputCallback(relationID uint32, eventType string, oldTuple, newTuple *pglogrepl.TupleData) error {
+	if c.callback == nil {
+		return nil
+	}
+	rel, ok := c.relations[relationID]
+	if !ok {
+		return fmt.Errorf("unknown relation id:%d", relationID)
+	}
+	if !c.CheckReplicateDb(rel.Namespace, rel.RelationName) {
+		return nil
+	}
+	data := c.BuildRowEvent(rel, eventType, oldTuple, newTuple)
+	if data == nil {
+		return nil
+	}
+	if c.currentTx != nil {
+		c.currentTx.hadRowEvent = true
+	}
+	c.callback(data)
+	return nil
+}
+
+func (c *PostgresInput) BuildRowEvent(rel *pglogrepl.RelationMessage, eventType string, oldTuple, newTuple *pglogrepl.TupleData) *outputDriver.PluginDataType {
+	var rows []map[string]interface{}
+	var presentColumns [][]string
+	oldRow, oldPresentColumns := c.TupleToRow(rel, oldTuple, nil)
+	switch eventType {
+	case "insert":
+		newRow, newPresentColumns := c.TupleToRow(rel, newTuple, nil)
+		rows = []map[string]interface{}{newRow}
+		if newPresentColumns != nil {
+			presentColumns = [][]string{newPresentColumns}
+		}
+	case "update":
+		newRow, newPresentColumns := c.TupleToRow(rel, newTuple, oldRow)
+		// 没有设置 REPLICA IDENTITY FULL 并且主键没有被修改的情况下,是没有旧数据的,这里和 mongo 一样,旧数据采用新数据
+		// 需要复制一份, 不能和新数据是同一个 map, 否则 ToServer 中修改其中一行 会影响另外一行
+		if oldRow == nil {
+			oldRow = make(map[string]interface{}, len(newRow))
+			for key, val := range newRow {
+				oldRow[key] = val
+			}
+			oldPresentColumns = newPresentColumns
+		}
+		rows = []map[string]interface{}{oldRow, newRow}
+		if oldPresentColumns != nil || newPresentColumns != nil {
+			presentColumns = [][]string{oldPresentColumns, newPresentColumns}
+		}
+	case "delete":
+		if oldRow == nil {
+			log.Printf("[WARN] input[%s] %s.%s delete event old tuple is nil \n", "postgres", rel.Namespace, rel.RelationName)
+			return nil
+		}
+		rows = []map[string]interface{}{oldRow}
+		if oldPresentColumns != nil {
+			presentColumns = [][]string{oldPresentColumns}
+		}
+	default:
+		return nil
+	}
+	timestamp, gtid := c.getTxInfo()
+	pri, columnMapping := c.GetPriAndColumnMapping(rel)
+	return &outputDriver.PluginDataType{
+		Timestamp:       timestamp,
+		EventSize:       0,
+		EventType:       eventType,
+		Rows:            rows,
+		SchemaName:      rel.Namespace,
+		TableName:       rel.RelationName,
+		AliasSchemaName: rel.Namespace,
+		AliasTableName:  rel.RelationName,
+		BinlogFileNum:   1,
+		BinlogPosition:  DefaultBinlogPosition,
+		Gtid:            gtid,
+		Pri:             pri,
+		EventID:         c.getNextEventID(),
+		ColumnMapping:   columnMapping,
+		PresentColumns:  presentColumns,
+	}
+}
+
+func (c *PostgresInput) TruncateCallback(relationID uint32) {
+	if c.callback == nil {
+		return
+	}
+	rel, ok := c.relations[relationID]
+	if !ok {
+		return
+	}
+	if !c.CheckReplicateDb(rel.Namespace, rel.RelationName) {
+		return
+	}
+	sql := fmt.Sprintf("TRUNCATE TABLE %s.%s", quoteIdentifier(rel.Namespace), quoteIdentifier(rel.RelationName))
+	timestamp, gtid := c.getTxInfo()
+	if c.currentTx != nil {
+		c.currentTx.hadRowEvent = true
+	}
+	c.callback(&outputDriver.PluginDataType{
+		Timestamp:       timestamp,
+		EventSize:       uint32(len(sql)),
+		EventType:       "sql",
+		Rows:            nil,
+		Query:           sql,
+		SchemaName:      rel.Namespace,
+		TableName:       rel.RelationName,
+		AliasSchemaName: rel.Namespace,
+		AliasTableName:  rel.RelationName,
+		BinlogFileNum:   1,
+		BinlogPosition:  DefaultBinlogPosition,
+		Gtid:            gtid,
+		Pri:             nil,
+		EventID:         c.getNextEventID(),
+	})
+}
+
+// unchangedRow 用于 TOAST 字段没有变更的情况下('u'),从旧数据中取值
+// 没有旧数据的情况下, 这个字段不放到 row 中, 和 binlog_row_image = MINIMAL 一样通过 presentColumns 标记为缺失的字段, 防止目标库被更新为 NULL
+// 所有字段都存在的时候 presentColumns 为 nil
+
+func (c *PostgresInput) TupleToRow(rel *pglogrepl.RelationMessage, tuple *pglogrepl.TupleData, unchangedRow map[string]interface{}) (row map[string]interface{}, presentColumns []string) {
+	if tuple == nil {
+		return nil, nil
+	}
+	row = make(map[string]interface{}, len(rel.Columns))
+	var hadAbsentColumn bool
+	for i, col := range tuple.Columns {
+		if i >= len(rel.Columns) {
+			break
+		}
+		relCol := rel.Columns[i]
+		switch col.DataType {
+		case pglogrepl.TupleDataTypeNull:
+			row[relCol.Name] = nil
+		case pglogrepl.TupleDataTypeToast:
+			if val, ok := unchangedRow[relCol.Name]; ok {
+				row[relCol.Name] = val
+			} else {
+				hadAbsentColumn = true
+			}
+		case pglogrepl.TupleDataTypeText:
+			row[relCol.Name] = TransferValue(relCol.DataType, string(col.Data))
+		default:
+			row[relCol.Name] = string(col.Data)
+		}
+	}
+	if !hadAbsentColumn {
+		return row, nil
+	}
+	presentColumns = make([]string, 0, len(row))
+	for i := range tuple.Columns {
+		if i >= len(rel.Columns) {
+			break
+		}
+		if _, ok := row[rel.Columns[i].Name]; ok {
+			presentColumns = append(presentColumns, rel.Columns[i].Name)
+		}
+	}
+	return row, presentColumns
+}
+
+// 将 pgoutput text 格式的值转换成和 mysql 源一致的 go 类型
+
+func TransferValue(dataType uint32, val string) interface{} {
+	switch dataType {
+	case pgtype.BoolOID:
+		return val == "t"
+	case pgtype.Int2OID:
+		v, err := strconv.ParseInt(val, 10, 16)
+		if err != nil {
+			return val
+		}
+		return int16(v)
+	case pgtype.Int4OID:
+		v, err := strconv.ParseInt(val, 10, 32)
+		if err != nil {
+			return val
+		}
+		return int32(v)
+	case pgtype.Int8OID:
+		v, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return val
+		}
+		return v
+	case pgtype.OIDOID:
+		v, err := strconv.ParseUint(val, 10, 32)
+		if err != nil {
+			return val
+		}
+		return uint32(v)
+	case pgtype.Float4OID:
+		v, err := strconv.ParseFloat(val, 32)
+		if err != nil {
+			return val
+		}
+		return float32(v)
+	case pgtype.Float8OID:
+		v, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return val
+		}
+		return v
+	case pgtype.JSONOID, pgtype.JSONBOID:
+		var v interface{}
+		if err := json.Unmarshal([]byte(val), &v); err != nil {
+			return val
+		}
+		return v
+	case pgtype.ByteaOID:
+		if strings.HasPrefix(val, `\x`) {
+			v, err := hex.DecodeString(val[2:])
+			if err != nil {
+				return val
+			}
+			return string(v)
+		}
+		return val
+	case pgtype.TimestamptzOID:
+		// 带时区的时间,统一转成本地时间 2006-01-02 15:04:05 格式,和 mysql timestamp 保持一致
+		t, err := time.Parse("2006-01-02 15:04:05.999999999Z07", val)
+		if err != nil {
+			t, err = time.Parse("2006-01-02 15:04:05.999999999Z07:00", val)
+			if err != nil {
+				return val
+			}
+		}
+		return t.Local().Format("2006-01-02 15:04:05.999999")
+	default:
+		return val
+	}
+}
+
+func (c *PostgresInput) GetPriAndColumnMapping(rel *pglogrepl.RelationMessage) (pri []string, columnMapping map[string]string) {
+	pri = make([]string, 0)
+	columnMapping = make(map[string]string, len(rel.Columns))
+	for _, col := range rel.Columns {
+		columnType := TransferColumnType(col.DataType, col.TypeModifier)
+		// Flags == 1 代表是 REPLICA IDENTITY 中的字段, 默认情况下就是主键
+		if col.Flags&1 == 1 {
+			pri = append(pri, col.Name)
+			columnMapping[col.Name] = columnType
+		} else {
+			columnMapping[col.Name] = "Nullable(" + columnType + ")"
+		}
+	}
+	return
+}
+
+func TransferColumnType(dataType uint32, typeModifier int32) string {
+	switch dataType {
+	case pgtype.BoolOID:
+		return "bool"
+	case pgtype.Int2OID:
+		return "int16"
+	case pgtype.Int4OID:
+		return "int32"
+	case pgtype.Int8OID:
+		return "int64"
+	case pgtype.OIDOID:
+		return "uint32"
+	case pgtype.Float4OID:
+		return "float"
+	case pgtype.Float8OID:
+		return "double"
+	case pgtype.NumericOID:
+		if typeModifier < 4 {
+			return "decimal(38,10)"
+		}
+		precision := ((typeModifier - 4) >> 16) & 0xffff
+		scale := (typeModifier - 4) & 0xffff
+		return fmt.Sprintf("decimal(%d,%d)", precision, scale)
+	case pgtype.VarcharOID:
+		if typeModifier < 4 {
+			return "text"
+		}
+		return fmt.Sprintf("varchar(%d)", typeModifier-4)
+	case pgtype.BPCharOID:
+		if typeModifier < 4 {
+			return "char(1)"
+		}
+		return fmt.Sprintf("char(%d)", typeModifier-4)
+	case pgtype.TextOID:
+		return "text"
+	case pgtype.UUIDOID:
+		return "varchar(36)"
+	case pgtype.JSONOID, pgtype.JSONBOID:
+		return "json"
+	case pgtype.ByteaOID:
+		return "blob"
+	case pgtype.DateOID:
+		return "date"
+	case pgtype.TimeOID:
+		return "time"
+	case pgtype.TimestampOID:
+		return "datetime"
+	case pgtype.TimestamptzOID:
+		return "timestamp"
+	default:
+		return "text"
+	}
+}
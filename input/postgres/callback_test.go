@@ -0,0 +1,183 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	outputDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newTestRelation() *pglogrepl.RelationMessage {
+	return &pglogrepl.RelationMessage{
+		RelationID:   1,
+		Namespace:    "public",
+		RelationName: "t1",
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Flags: 1, Name: "id", DataType: pgtype.Int8OID, TypeModifier: -1},
+			{Flags: 0, Name: "name", DataType: pgtype.VarcharOID, TypeModifier: 20 + 4},
+			{Flags: 0, Name: "amount", DataType: pgtype.NumericOID, TypeModifier: (10 << 16) + 2 + 4},
+			{Flags: 0, Name: "doc", DataType: pgtype.TextOID, TypeModifier: -1},
+		},
+	}
+}
+
+func newTestTuple(values ...interface{}) *pglogrepl.TupleData {
+	tuple := &pglogrepl.TupleData{}
+	for _, v := range values {
+		switch v {
+		case nil:
+			tuple.Columns = append(tuple.Columns, &pglogrepl.TupleDataColumn{DataType: pglogrepl.TupleDataTypeNull})
+		case "__toast__":
+			tuple.Columns = append(tuple.Columns, &pglogrepl.TupleDataColumn{DataType: pglogrepl.TupleDataTypeToast})
+		default:
+			data := []byte(v.(string))
+			tuple.Columns = append(tuple.Columns, &pglogrepl.TupleDataColumn{DataType: pglogrepl.TupleDataTypeText, Length: uint32(len(data)), Data: data})
+		}
+	}
+	tuple.ColumnNum = uint16(len(tuple.Columns))
+	return tuple
+}
+
+func newTestInput() (*PostgresInput, *[]*outputDriver.PluginDataType) {
+	c := &PostgresInput{}
+	c.relations = map[uint32]*pglogrepl.RelationMessage{1: newTestRelation()}
+	var list []*outputDriver.PluginDataType
+	c.SetCallback(func(data *outputDriver.PluginDataType) {
+		list = append(list, data)
+	})
+	return c, &list
+}
+
+func TestPostgresInput_ToInputCallback(t *testing.T) {
+	Convey("insert", t, func() {
+		c, list := newTestInput()
+		c.lastCommitLSN = pglogrepl.LSN(100)
+		c.currentTx = &transaction{commitTime: 1700000000}
+		err := c.ToInputCallback(1, "insert", nil, newTestTuple("1", "bifrost", "10.20", nil))
+		So(err, ShouldBeNil)
+		So(len(*list), ShouldEqual, 1)
+		data := (*list)[0]
+		So(data.EventType, ShouldEqual, "insert")
+		So(data.SchemaName, ShouldEqual, "public")
+		So(data.TableName, ShouldEqual, "t1")
+		So(data.Timestamp, ShouldEqual, 1700000000)
+		So(data.Gtid, ShouldEqual, pglogrepl.LSN(100).String())
+		So(data.Pri, ShouldResemble, []string{"id"})
+		So(data.ColumnMapping["id"], ShouldEqual, "int64")
+		So(data.ColumnMapping["name"], ShouldEqual, "Nullable(varchar(20))")
+		So(data.ColumnMapping["amount"], ShouldEqual, "Nullable(decimal(10,2))")
+		So(data.Rows[0]["id"], ShouldEqual, int64(1))
+		So(data.Rows[0]["name"], ShouldEqual, "bifrost")
+		So(data.Rows[0]["amount"], ShouldEqual, "10.20")
+		So(data.Rows[0]["doc"], ShouldBeNil)
+		So(c.currentTx.hadRowEvent, ShouldBeTrue)
+	})
+
+	Convey("update without old tuple, unchanged toast", t, func() {
+		c, list := newTestInput()
+		err := c.ToInputCallback(1, "update", nil, newTestTuple("1", "bifrost", "10.20", "__toast__"))
+		So(err, ShouldBeNil)
+		data := (*list)[0]
+		So(len(data.Rows), ShouldEqual, 2)
+		So(data.Rows[0], ShouldResemble, data.Rows[1])
+		_, ok := data.Rows[1]["doc"]
+		So(ok, ShouldBeFalse)
+		So(data.IsColumnAbsent(1, "doc"), ShouldBeTrue)
+		So(data.IsColumnAbsent(0, "doc"), ShouldBeTrue)
+		So(data.IsColumnAbsent(1, "name"), ShouldBeFalse)
+		data.Rows[0]["name"] = "old"
+		So(data.Rows[1]["name"], ShouldEqual, "bifrost")
+	})
+
+	Convey("update with old tuple", t, func() {
+		c, list := newTestInput()
+		err := c.ToInputCallback(1, "update", newTestTuple("1", "old", "1.00", "long text"), newTestTuple("1", "new", "2.00", "__toast__"))
+		So(err, ShouldBeNil)
+		data := (*list)[0]
+		So(data.Rows[0]["name"], ShouldEqual, "old")
+		So(data.Rows[1]["name"], ShouldEqual, "new")
+		So(data.Rows[1]["doc"], ShouldEqual, "long text")
+		So(data.PresentColumns, ShouldBeNil)
+	})
+
+	Convey("delete", t, func() {
+		c, list := newTestInput()
+		err := c.ToInputCallback(1, "delete", newTestTuple("1", nil, nil, nil), nil)
+		So(err, ShouldBeNil)
+		data := (*list)[0]
+		So(data.EventType, ShouldEqual, "delete")
+		So(data.Rows[0]["id"], ShouldEqual, int64(1))
+	})
+
+	Convey("unknown relation", t, func() {
+		c, _ := newTestInput()
+		err := c.ToInputCallback(2, "insert", nil, newTestTuple("1"))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("table not replicate", t, func() {
+		c, list := newTestInput()
+		c.AddReplicateDoDb("public", "t2")
+		err := c.ToInputCallback(1, "insert", nil, newTestTuple("1", "bifrost", "10.20", nil))
+		So(err, ShouldBeNil)
+		So(len(*list), ShouldEqual, 0)
+	})
+}
+
+func TestPostgresInput_DoCommit(t *testing.T) {
+	Convey("transaction without row event", t, func() {
+		c, list := newTestInput()
+		c.currentTx = &transaction{}
+		c.DoCommit(&pglogrepl.CommitMessage{TransactionEndLSN: pglogrepl.LSN(200), CommitTime: time.Now()})
+		So(len(*list), ShouldEqual, 0)
+		So(c.lastCommitLSN, ShouldEqual, pglogrepl.LSN(200))
+		So(c.currentTx, ShouldBeNil)
+	})
+
+	Convey("transaction with row event", t, func() {
+		c, list := newTestInput()
+		c.currentTx = &transaction{hadRowEvent: true}
+		c.DoCommit(&pglogrepl.CommitMessage{TransactionEndLSN: pglogrepl.LSN(200), CommitTime: time.Now()})
+		So(len(*list), ShouldEqual, 1)
+		So((*list)[0].EventType, ShouldEqual, "commit")
+		So((*list)[0].Gtid, ShouldEqual, pglogrepl.LSN(200).String())
+	})
+}
+
+func TestPostgresInput_TruncateCallback(t *testing.T) {
+	Convey("normal", t, func() {
+		c, list := newTestInput()
+		c.TruncateCallback(1)
+		So(len(*list), ShouldEqual, 1)
+		So((*list)[0].EventType, ShouldEqual, "sql")
+		So((*list)[0].Query, ShouldEqual, `TRUNCATE TABLE "public"."t1"`)
+	})
+}
+
+func TestTransferValue(t *testing.T) {
+	Convey("normal", t, func() {
+		So(TransferValue(pgtype.BoolOID, "t"), ShouldEqual, true)
+		So(TransferValue(pgtype.BoolOID, "f"), ShouldEqual, false)
+		So(TransferValue(pgtype.Int2OID, "-12"), ShouldEqual, int16(-12))
+		So(TransferValue(pgtype.Int4OID, "12"), ShouldEqual, int32(12))
+		So(TransferValue(pgtype.Float8OID, "1.5"), ShouldEqual, float64(1.5))
+		So(TransferValue(pgtype.ByteaOID, `\x6869`), ShouldEqual, "hi")
+		So(TransferValue(pgtype.JSONBOID, `{"a":1}`), ShouldResemble, map[string]interface{}{"a": float64(1)})
+		So(TransferValue(pgtype.Int4OID, "abc"), ShouldEqual, "abc")
+		So(TransferValue(pgtype.TimestamptzOID, "2024-01-02 03:04:05+00"), ShouldEqual, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).Local().Format("2006-01-02 15:04:05.999999"))
+	})
+}
+
+func TestTransferColumnType(t *testing.T) {
+	Convey("normal", t, func() {
+		So(TransferColumnType(pgtype.NumericOID, -1), ShouldEqual, "decimal(38,10)")
+		So(TransferColumnType(pgtype.VarcharOID, -1), ShouldEqual, "text")
+		So(TransferColumnType(pgtype.BPCharOID, 10+4), ShouldEqual, "char(10)")
+		So(TransferColumnType(pgtype.TimestampOID, -1), ShouldEqual, "datetime")
+		So(TransferColumnType(pgtype.UUIDOID, -1), ShouldEqual, "varchar(36)")
+	})
+}
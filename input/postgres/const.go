@@ -0,0 +1,30 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package postgres
+
+const DefaultBinlogFileName = "bifrost.000001"
+
+const DefaultBinlogPosition = 0
+
+const OutputPlugin = "pgoutput"
+
+const defaultSlotNamePrefix = "bifrost_"
+
+const defaultPublicationNamePrefix = "bifrost_pub_"
+
+// 多久向 PostgreSQL 发送一次 Standby Status Update, 同时也用于维持连接心跳
+const standbyMessageTimeout = 10
@@ -0,0 +1,30 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	inputDriver "github.com/brokercap/Bifrost/input/driver"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPostgresInput_Stop(t *testing.T) {
+	Convey("status chan closed", t, func() {
+		c := &PostgresInput{PluginStatusChan: make(chan *inputDriver.PluginStatus, 1)}
+		c.ctx, c.ctxCancleFun = context.WithCancel(context.Background())
+		close(c.PluginStatusChan)
+		So(func() { c.Stop() }, ShouldNotPanic)
+		So(c.ctx.Err(), ShouldEqual, context.Canceled)
+	})
+
+	Convey("status chan full", t, func() {
+		c := &PostgresInput{PluginStatusChan: make(chan *inputDriver.PluginStatus, 1)}
+		c.ctx, c.ctxCancleFun = context.WithCancel(context.Background())
+		c.setStatus(inputDriver.RUNNING)
+		// 没有读取方, 不能阻塞
+		c.Stop()
+		So(c.ctx.Err(), ShouldEqual, context.Canceled)
+		So((<-c.PluginStatusChan).Status, ShouldEqual, inputDriver.RUNNING)
+	})
+}
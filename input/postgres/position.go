@@ -0,0 +1,43 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package postgres
+
+import (
+	"github.com/jackc/pglogrepl"
+	"log"
+)
+
+// 位点 GTID 里保存的是 LSN 字符串, 例如 0/16B3748
+
+func (c *PostgresInput) LSN2GTID(lsn pglogrepl.LSN) string {
+	if lsn == 0 {
+		return ""
+	}
+	return lsn.String()
+}
+
+func (c *PostgresInput) GTID2LSN(GTID string) pglogrepl.LSN {
+	if GTID == "" {
+		return 0
+	}
+	lsn, err := pglogrepl.ParseLSN(GTID)
+	if err != nil {
+		log.Printf("[ERROR] %s GTID:%s GTID2LSN err:%+v", c.inputInfo.DbName, GTID, err)
+		return 0
+	}
+	return lsn
+}
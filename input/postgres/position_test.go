@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"testing"
+
+	inputDriver "github.com/brokercap/Bifrost/input/driver"
+	"github.com/jackc/pglogrepl"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPostgresInput_LSN2GTID(t *testing.T) {
+	c := &PostgresInput{}
+	Convey("zero", t, func() {
+		So(c.LSN2GTID(0), ShouldEqual, "")
+	})
+
+	Convey("normal", t, func() {
+		lsn := pglogrepl.LSN(0x16B3748)
+		So(c.LSN2GTID(lsn), ShouldEqual, "0/16B3748")
+		So(c.GTID2LSN(c.LSN2GTID(lsn)), ShouldEqual, lsn)
+	})
+}
+
+func TestPostgresInput_GTID2LSN(t *testing.T) {
+	c := &PostgresInput{}
+	Convey("empty", t, func() {
+		So(c.GTID2LSN(""), ShouldEqual, 0)
+	})
+
+	Convey("error", t, func() {
+		So(c.GTID2LSN("sssss"), ShouldEqual, 0)
+	})
+}
+
+func TestPostgresInput_DoneMinPosition(t *testing.T) {
+	Convey("nil or empty gtid", t, func() {
+		c := &PostgresInput{}
+		So(c.DoneMinPosition(nil), ShouldBeNil)
+		So(c.DoneMinPosition(&inputDriver.PluginPosition{}), ShouldBeNil)
+		So(c.GetLastPosition(), ShouldBeNil)
+		So(c.getFlushLSN(), ShouldEqual, 0)
+	})
+
+	Convey("normal", t, func() {
+		c := &PostgresInput{}
+		p := &inputDriver.PluginPosition{GTID: "0/16B3748", EventID: 10}
+		So(c.DoneMinPosition(p), ShouldBeNil)
+		So(c.getFlushLSN(), ShouldEqual, pglogrepl.LSN(0x16B3748))
+		So(c.GetLastPosition().BinlogFileName, ShouldEqual, DefaultBinlogFileName)
+		So(c.GetLastPosition().EventID, ShouldEqual, 10)
+		So(p.BinlogFileName, ShouldEqual, "")
+	})
+
+	Convey("start lsn", t, func() {
+		c := &PostgresInput{}
+		c.inputInfo.GTID = "0/10"
+		So(c.getStartLSN(), ShouldEqual, pglogrepl.LSN(0x10))
+		c.lastCommitLSN = pglogrepl.LSN(0x20)
+		So(c.getStartLSN(), ShouldEqual, pglogrepl.LSN(0x20))
+	})
+}
@@ -0,0 +1,207 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package postgres
+
+import (
+	"context"
+	"fmt"
+	inputDriver "github.com/brokercap/Bifrost/input/driver"
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"log"
+	"strings"
+	"time"
+)
+
+func CreatePostgresConn(ctx context.Context, connString string) (*pgconn.PgConn, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timeOutCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	return pgconn.Connect(timeOutCtx, connString)
+}
+
+func (c *PostgresInput) StartReplicate0() error {
+	conn, err := CreatePostgresConn(c.ctx, c.config.ReplicationConnString())
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	if err = c.InitPublication(conn); err != nil {
+		return err
+	}
+	if err = c.InitReplicationSlot(conn); err != nil {
+		return err
+	}
+	startLSN := c.getStartLSN()
+	err = pglogrepl.StartReplication(c.ctx, conn, c.config.SlotName, startLSN, pglogrepl.StartReplicationOptions{
+		PluginArgs: []string{
+			"proto_version '1'",
+			fmt.Sprintf("publication_names '%s'", c.config.PublicationName),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("[INFO] input[%s] %s start replication slot:%s publication:%s startLSN:%s \n", "postgres", c.inputInfo.DbName, c.config.SlotName, c.config.PublicationName, startLSN)
+	c.relations = make(map[uint32]*pglogrepl.RelationMessage, 0)
+	c.currentTx = nil
+	c.err = nil
+	c.setStatus(inputDriver.RUNNING)
+	return c.ConsumeReplication(conn)
+}
+
+func (c *PostgresInput) InitPublication(conn *pgconn.PgConn) error {
+	rows, err := c.queryRows(conn, "SELECT pubname FROM pg_publication WHERE pubname = "+quoteLiteral(c.config.PublicationName))
+	if err != nil {
+		return err
+	}
+	if len(rows) > 0 {
+		return nil
+	}
+	if !c.config.CreatePublication {
+		return fmt.Errorf("publication %s not exist", c.config.PublicationName)
+	}
+	sql := fmt.Sprintf("CREATE PUBLICATION %s FOR ALL TABLES", quoteIdentifier(c.config.PublicationName))
+	_, err = conn.Exec(c.ctx, sql).ReadAll()
+	return err
+}
+
+func (c *PostgresInput) InitReplicationSlot(conn *pgconn.PgConn) error {
+	rows, err := c.queryRows(conn, "SELECT slot_name,plugin FROM pg_replication_slots WHERE slot_name = "+quoteLiteral(c.config.SlotName))
+	if err != nil {
+		return err
+	}
+	if len(rows) > 0 {
+		if rows[0][1] == nil || *rows[0][1] != OutputPlugin {
+			return fmt.Errorf("replication slot %s plugin is not %s", c.config.SlotName, OutputPlugin)
+		}
+		return nil
+	}
+	_, err = pglogrepl.CreateReplicationSlot(c.ctx, conn, c.config.SlotName, OutputPlugin, pglogrepl.CreateReplicationSlotOptions{})
+	if err == nil {
+		log.Printf("[INFO] input[%s] %s create replication slot:%s \n", "postgres", c.inputInfo.DbName, c.config.SlotName)
+	}
+	return err
+}
+
+func (c *PostgresInput) ConsumeReplication(conn *pgconn.PgConn) error {
+	standbyMessageTimeoutDuration := time.Duration(standbyMessageTimeout) * time.Second
+	nextStandbyMessageDeadline := time.Now().Add(standbyMessageTimeoutDuration)
+	for {
+		if time.Now().After(nextStandbyMessageDeadline) {
+			err := c.SendStandbyStatusUpdate(conn)
+			if err != nil {
+				return err
+			}
+			nextStandbyMessageDeadline = time.Now().Add(standbyMessageTimeoutDuration)
+		}
+		ctx, cancel := context.WithDeadline(c.ctx, nextStandbyMessageDeadline)
+		rawMsg, err := conn.ReceiveMessage(ctx)
+		cancel()
+		if err != nil {
+			if c.ctx.Err() != nil {
+				// Stop 触发的退出, 退出之前把最后确认的位点提交一次
+				c.SendStandbyStatusUpdate(conn)
+				return nil
+			}
+			if pgconn.Timeout(err) {
+				continue
+			}
+			return err
+		}
+		switch msg := rawMsg.(type) {
+		case *pgproto3.ErrorResponse:
+			return fmt.Errorf("received postgres wal error: %+v", *msg)
+		case *pgproto3.CopyData:
+			if len(msg.Data) == 0 {
+				break
+			}
+			switch msg.Data[0] {
+			case pglogrepl.PrimaryKeepaliveMessageByteID:
+				pkm, err := pglogrepl.ParsePrimaryKeepaliveMessage(msg.Data[1:])
+				if err != nil {
+					return err
+				}
+				if pkm.ReplyRequested {
+					nextStandbyMessageDeadline = time.Time{}
+				}
+			case pglogrepl.XLogDataByteID:
+				xld, err := pglogrepl.ParseXLogData(msg.Data[1:])
+				if err != nil {
+					return err
+				}
+				if err = c.ParseWALData(xld.WALData); err != nil {
+					return err
+				}
+			}
+		default:
+			log.Printf("[WARN] input[%s] %s received unexpected message: %T \n", "postgres", c.inputInfo.DbName, rawMsg)
+		}
+	}
+}
+
+// 只确认 server 层同步成功的最小位点,保证重启之后不丢数据
+
+func (c *PostgresInput) SendStandbyStatusUpdate(conn *pgconn.PgConn) error {
+	flushLSN := c.getFlushLSN()
+	return pglogrepl.SendStandbyStatusUpdate(context.Background(), conn, pglogrepl.StandbyStatusUpdate{
+		WALWritePosition: flushLSN,
+		WALFlushPosition: flushLSN,
+		WALApplyPosition: flushLSN,
+	})
+}
+
+// 执行 SQL 并以字符串的格式返回最后一个结果集的所有数据,NULL 返回 nil
+// 复制连接(replication=database)只支持 simple query 协议,所以这里不使用 ExecParams, 参数需要调用方通过 quoteLiteral 拼接
+
+func (c *PostgresInput) queryRows(conn *pgconn.PgConn, sql string) (rows [][]*string, err error) {
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	results, err := conn.Exec(ctx, sql).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	rows = make([][]*string, 0)
+	if len(results) == 0 {
+		return rows, nil
+	}
+	for _, row := range results[len(results)-1].Rows {
+		values := make([]*string, len(row))
+		for i, v := range row {
+			if v == nil {
+				continue
+			}
+			s := string(v)
+			values[i] = &s
+		}
+		rows = append(rows, values)
+	}
+	return rows, nil
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func quoteIdentifier(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
@@ -0,0 +1,231 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package postgres
+
+import (
+	"context"
+	"fmt"
+	inputDriver "github.com/brokercap/Bifrost/input/driver"
+	"github.com/jackc/pgx/v5/pgconn"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (c *PostgresInput) GetConn() (*pgconn.PgConn, error) {
+	if c.config == nil {
+		if c.err != nil {
+			return nil, c.err
+		}
+		return nil, fmt.Errorf("postgres config init err")
+	}
+	return CreatePostgresConn(context.Background(), c.config.ConnString)
+}
+
+func (c *PostgresInput) GetSchemaList() (data []string, err error) {
+	conn, err := c.GetConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(context.Background())
+	sql := "SELECT schema_name FROM information_schema.schemata WHERE schema_name NOT IN ('information_schema','pg_catalog','pg_toast') AND schema_name NOT LIKE 'pg_temp_%' AND schema_name NOT LIKE 'pg_toast_temp_%' ORDER BY schema_name"
+	rows, err := c.queryRows(conn, sql)
+	if err != nil {
+		return nil, err
+	}
+	data = make([]string, 0, len(rows))
+	for _, row := range rows {
+		data = append(data, *row[0])
+	}
+	return
+}
+
+func (c *PostgresInput) GetSchemaTableList(schema string) (tableList []inputDriver.TableList, err error) {
+	conn, err := c.GetConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(context.Background())
+	sql := "SELECT table_name,table_type FROM information_schema.tables WHERE table_schema = " + quoteLiteral(schema) + " ORDER BY table_name"
+	rows, err := c.queryRows(conn, sql)
+	if err != nil {
+		return nil, err
+	}
+	tableList = make([]inputDriver.TableList, 0, len(rows))
+	for _, row := range rows {
+		tableList = append(tableList, inputDriver.TableList{
+			TableName: *row[0],
+			TableType: *row[1],
+		})
+	}
+	return
+}
+
+func (c *PostgresInput) GetSchemaTableFieldList(schema string, table string) (FieldList []inputDriver.TableFieldInfo, err error) {
+	conn, err := c.GetConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(context.Background())
+	sql := `SELECT c.column_name,c.column_default,c.is_nullable,c.udt_name,c.data_type,c.numeric_precision,c.numeric_scale,c.character_maximum_length,c.is_identity,
+	CASE WHEN k.column_name IS NULL THEN '' ELSE 'PRI' END AS column_key,
+	col_description(format('%I.%I', c.table_schema, c.table_name)::regclass, c.ordinal_position::int) AS column_comment
+	FROM information_schema.columns c
+	LEFT JOIN (
+		SELECT kcu.column_name FROM information_schema.table_constraints tc
+		JOIN information_schema.key_column_usage kcu ON tc.constraint_name = kcu.constraint_name AND tc.table_schema = kcu.table_schema AND tc.table_name = kcu.table_name
+		WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = ` + quoteLiteral(schema) + ` AND tc.table_name = ` + quoteLiteral(table) + `
+	) k ON c.column_name = k.column_name
+	WHERE c.table_schema = ` + quoteLiteral(schema) + ` AND c.table_name = ` + quoteLiteral(table) + ` ORDER BY c.ordinal_position`
+	rows, err := c.queryRows(conn, sql)
+	if err != nil {
+		return nil, err
+	}
+	FieldList = make([]inputDriver.TableFieldInfo, 0, len(rows))
+	for _, row := range rows {
+		FieldList = append(FieldList, c.TransferTableFieldInfo(row))
+	}
+	return
+}
+
+func (c *PostgresInput) TransferTableFieldInfo(row []*string) inputDriver.TableFieldInfo {
+	var parseUint = func(s *string) *uint64 {
+		if s == nil {
+			return nil
+		}
+		v, err := strconv.ParseUint(*s, 10, 64)
+		if err != nil {
+			return nil
+		}
+		return &v
+	}
+	columnName := *row[0]
+	udtName := *row[3]
+	dataType := *row[4]
+	numericPrecision := parseUint(row[5])
+	numericScale := parseUint(row[6])
+	charMaxLength := parseUint(row[7])
+	columnKey := *row[9]
+
+	var columnType string
+	switch {
+	case charMaxLength != nil:
+		columnType = fmt.Sprintf("%s(%d)", dataType, *charMaxLength)
+	case udtName == "numeric" && numericPrecision != nil && numericScale != nil:
+		columnType = fmt.Sprintf("numeric(%d,%d)", *numericPrecision, *numericScale)
+	default:
+		columnType = dataType
+	}
+	var isAutoIncrement bool
+	if (row[1] != nil && strings.HasPrefix(*row[1], "nextval(")) || (row[8] != nil && *row[8] == "YES") {
+		isAutoIncrement = true
+	}
+	return inputDriver.TableFieldInfo{
+		ColumnName:       &columnName,
+		ColumnDefault:    row[1],
+		IsNullable:       row[2] != nil && strings.ToUpper(*row[2]) == "YES",
+		ColumnType:       &columnType,
+		IsAutoIncrement:  isAutoIncrement,
+		Comment:          row[10],
+		DataType:         &udtName,
+		NumericPrecision: numericPrecision,
+		NumericScale:     numericScale,
+		ColumnKey:        &columnKey,
+	}
+}
+
+func (c *PostgresInput) CheckPrivilege() (err error) {
+	conn, err := c.GetConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	rows, err := c.queryRows(conn, "SELECT rolsuper OR rolreplication FROM pg_roles WHERE rolname = current_user")
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 || rows[0][0] == nil || *rows[0][0] != "t" {
+		return fmt.Errorf("current user need REPLICATION privilege")
+	}
+	return nil
+}
+
+func (c *PostgresInput) CheckUri(CheckPrivilege bool) (result inputDriver.CheckUriResult, err error) {
+	conn, err := c.GetConn()
+	if err != nil {
+		return
+	}
+	defer conn.Close(context.Background())
+	rows, err := c.queryRows(conn, "SHOW wal_level")
+	if err != nil {
+		return
+	}
+	if len(rows) == 0 || rows[0][0] == nil || *rows[0][0] != "logical" {
+		err = fmt.Errorf("wal_level must be logical")
+		return
+	}
+	if CheckPrivilege {
+		if err = c.CheckPrivilege(); err != nil {
+			return
+		}
+	}
+	p, err := c.GetCurrentPosition()
+	if err != nil {
+		return
+	}
+	result = inputDriver.CheckUriResult{
+		BinlogFile:     DefaultBinlogFileName,
+		BinlogPosition: DefaultBinlogPosition,
+		BinlogFormat:   "row",
+		BinlogRowImage: "full",
+		Gtid:           p.GTID,
+		ServerId:       1,
+	}
+	return
+}
+
+func (c *PostgresInput) GetCurrentPosition() (p *inputDriver.PluginPosition, err error) {
+	conn, err := c.GetConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(context.Background())
+	rows, err := c.queryRows(conn, "SELECT pg_current_wal_lsn()::text")
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 || rows[0][0] == nil {
+		return nil, fmt.Errorf("get pg_current_wal_lsn empty")
+	}
+	p = &inputDriver.PluginPosition{
+		GTID:           *rows[0][0],
+		BinlogFileName: DefaultBinlogFileName,
+		BinlogPostion:  DefaultBinlogPosition,
+		Timestamp:      uint32(time.Now().Unix()),
+		EventID:        c.eventID,
+	}
+	return p, nil
+}
+
+func (c *PostgresInput) GetVersion() (version string, err error) {
+	conn, err := c.GetConn()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close(context.Background())
+	return conn.ParameterStatus("server_version"), nil
+}
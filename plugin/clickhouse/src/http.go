@@ -4,6 +4,7 @@ import (
 	"github.com/brokercap/Bifrost/admin/controller"
 	"github.com/brokercap/Bifrost/admin/xgo"
 	pluginStorage "github.com/brokercap/Bifrost/plugin/storage"
+	"github.com/brokercap/Bifrost/server/secret"
 )
 
 func init() {
@@ -29,7 +30,7 @@ func (c *PluginClickHouseController) getToServerInfo() *pluginStorage.ToServer {
 
 func (c *PluginClickHouseController) GetClickHouseSchemaList() {
 	toServerInfo := c.getToServerInfo()
-	conn := NewClickHouseDBConn(toServerInfo.ConnUri)
+	conn := NewClickHouseDBConn(secret.ResolveUri(toServerInfo.ConnUri))
 	defer conn.Close()
 	SchemaList := conn.GetSchemaList()
 	c.SetJsonData(SchemaList)
@@ -40,7 +41,7 @@ func (c *PluginClickHouseController) GetClickHouseSchemaList() {
 func (c *PluginClickHouseController) GetClickHouseSchemaTableList() {
 	toServerInfo := c.getToServerInfo()
 	SchemaName := c.Ctx.Get("SchemaName")
-	conn := NewClickHouseDBConn(toServerInfo.ConnUri)
+	conn := NewClickHouseDBConn(secret.ResolveUri(toServerInfo.ConnUri))
 	defer conn.Close()
 	TableList := conn.GetSchemaTableList(SchemaName)
 	c.SetJsonData(TableList)
@@ -52,7 +53,7 @@ func (c *PluginClickHouseController) GetClickHouseTableFields() {
 	toServerInfo := c.getToServerInfo()
 	SchemaName := c.Ctx.Get("SchemaName")
 	TableName := c.Ctx.Get("TableName")
-	conn := NewClickHouseDBConn(toServerInfo.ConnUri)
+	conn := NewClickHouseDBConn(secret.ResolveUri(toServerInfo.ConnUri))
 	defer conn.Close()
 	TableFieldMap := conn.GetTableFields(SchemaName, TableName)
 	c.SetJsonData(TableFieldMap)
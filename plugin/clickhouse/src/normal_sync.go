@@ -18,6 +18,10 @@ import (
 func (This *Conn) CommitNormal(list []*pluginDriver.PluginDataType, n int) (errData *pluginDriver.PluginDataType) {
 	deleteDataMap := make(map[interface{}]pluginDriver.PluginDataType, 0)
 	insertDataMap := make(map[interface{}]pluginDriver.PluginDataType, 0)
+	// binlog_row_image = MINIMAL/NOBLOB 时, 只包含部分字段的 update 数据, 和 ck 中当前的数据合并之后 delete + insert
+	updateDataMap := make(map[interface{}]*pluginDriver.PluginDataType, 0)
+	// ck 中 updateDataMap 中数据 当前的整行数据
+	partialCurrentMap := make(map[interface{}][]dbDriver.Value, 0)
 	var ok bool
 	var normalFun = func(v *pluginDriver.PluginDataType) {
 		switch v.EventType {
@@ -29,7 +33,7 @@ func (This *Conn) CommitNormal(list []*pluginDriver.PluginDataType, n int) (errD
 						insertDataMap[key] = pluginDriver.PluginDataType{
 							Timestamp:      v.Timestamp,
 							EventType:      v.EventType,
-							Rows:           []map[string]interface{}{row},
+							Rows:           []map[string]interface{}{mergePartialUpdateRow(updateDataMap, key, row)},
 							Query:          v.Query,
 							SchemaName:     v.SchemaName,
 							TableName:      v.TableName,
@@ -46,6 +50,20 @@ func (This *Conn) CommitNormal(list []*pluginDriver.PluginDataType, n int) (errD
 				row := v.Rows[k]
 				//key := row[This.p.mysqlPriKey]
 				key := This.getMySQLData(v, k, This.p.mysqlPriKey)
+				if k%2 == 1 && v.IsPartialRow(k) {
+					// after 只包含部分字段的时候, 主键取 before 中的值, before 数据不需要再删除
+					key = This.getMySQLData(v, k-1, This.p.mysqlPriKey)
+					if _, ok = deleteDataMap[key]; !ok {
+						if _, ok = insertDataMap[key]; !ok {
+							if This.err = This.addPartialUpdateData(updateDataMap, key, v, k); This.err != nil {
+								errData = v
+								return
+							}
+						}
+					}
+					k--
+					continue
+				}
 				if k%2 == 0 {
 					if _, ok := deleteDataMap[key]; !ok {
 						deleteDataMap[key] = pluginDriver.PluginDataType{
@@ -66,7 +84,7 @@ func (This *Conn) CommitNormal(list []*pluginDriver.PluginDataType, n int) (errD
 							insertDataMap[key] = pluginDriver.PluginDataType{
 								Timestamp:      v.Timestamp,
 								EventType:      v.EventType,
-								Rows:           []map[string]interface{}{row},
+								Rows:           []map[string]interface{}{mergePartialUpdateRow(updateDataMap, key, row)},
 								Query:          v.Query,
 								SchemaName:     v.SchemaName,
 								TableName:      v.TableName,
@@ -127,14 +145,40 @@ func (This *Conn) CommitNormal(list []*pluginDriver.PluginDataType, n int) (errD
 	for i := n - 1; i >= 0; i-- {
 		v := list[i]
 		normalFun(v)
+		if errData != nil {
+			if !This.p.BifrostMustBeSuccess || This.CheckDataSkip(errData) {
+				log.Println("plugin clickhouse skip data err:", This.err)
+				This.err = nil
+				errData = nil
+				continue
+			}
+			return
+		}
 	}
 	var stmt dbDriver.Stmt
+	// 要在 delete 之前 查询, ck 在事务中 prepare insert 之后也不能再执行其他语句
+	for key, data := range updateDataMap {
+		current, err := This.getPartialUpdateCurrentRow(key)
+		if err != nil {
+			log.Println("plugin clickhouse select partial update row err:", err, " key:", key)
+			if This.CheckDataSkip(data) {
+				continue
+			}
+			This.err = err
+			errData = data
+			goto errLoop
+		}
+		partialCurrentMap[key] = current
+	}
 	// delete 的话，将多条数据，where id in (1,2) 方式合并
-	if len(deleteDataMap) > 0 {
+	if len(deleteDataMap) > 0 || len(partialCurrentMap) > 0 {
 		keys := make([]dbDriver.Value, 0)
 		for key, _ := range deleteDataMap {
 			keys = append(keys, key)
 		}
+		for key, _ := range partialCurrentMap {
+			keys = append(keys, key)
+		}
 		if len(keys) > 0 {
 			var where string
 			//假如字段是int的话，就 in ()
@@ -161,7 +205,7 @@ func (This *Conn) CommitNormal(list []*pluginDriver.PluginDataType, n int) (errD
 		}
 	}
 
-	if len(insertDataMap) > 0 {
+	if len(insertDataMap) > 0 || len(partialCurrentMap) > 0 {
 		stmt = This.getStmt("insert")
 		if stmt == nil {
 			goto errLoop
@@ -195,6 +239,24 @@ func (This *Conn) CommitNormal(list []*pluginDriver.PluginDataType, n int) (errD
 				goto errLoop
 			}
 		}
+		for key, current := range partialCurrentMap {
+			data := updateDataMap[key]
+			var val []dbDriver.Value
+			val, This.err = This.getPartialUpdateInsertVal(data, current)
+			if This.err == nil {
+				_, This.err = stmt.Exec(val)
+			}
+			if This.err != nil {
+				if This.CheckDataSkip(data) {
+					This.err = nil
+					continue
+				}
+				errData = data
+				log.Println("plugin clickhouse partial update insert exec err:", This.err, " data:", val)
+				stmt.Close()
+				goto errLoop
+			}
+		}
 		stmt.Close()
 	}
 
@@ -0,0 +1,120 @@
+package src
+
+import (
+	dbDriver "database/sql/driver"
+	"fmt"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"io"
+	"reflect"
+)
+
+/*
+binlog_row_image = MINIMAL/NOBLOB 的时候, update 的 after 数据只包含部分字段
+不能直接用 after 数据 insert, 先从 ck 中查出当前的整行数据, 合并 binlog 中存在的字段之后, 再和其他 update 一样 delete + insert
+alter table update 是异步的 mutation, 每行数据都执行一次 代价太大, 所以不使用
+CommitNormal 是从最后一条数据开始遍历的, 同一条数据多次变更的时候, 后面变更的字段值优先
+*/
+
+// 将第 index 行(after) 数据合并到 updateDataMap 中
+func (This *Conn) addPartialUpdateData(updateDataMap map[interface{}]*pluginDriver.PluginDataType, key interface{}, v *pluginDriver.PluginDataType, index int) error {
+	row := v.Rows[index]
+	// ck 不支持修改主键字段
+	if afterKey, ok := row[This.p.mysqlPriKey]; ok && !reflect.DeepEqual(afterKey, key) {
+		return fmt.Errorf("%s PriKey:%s %v => %v changed, binlog_row_image:MINIMAL/NOBLOB update can't be sync", This.p.ckDatakey, This.p.mysqlPriKey, key, afterKey)
+	}
+	data, ok := updateDataMap[key]
+	if !ok {
+		data = &pluginDriver.PluginDataType{
+			Timestamp:      v.Timestamp,
+			EventType:      v.EventType,
+			Rows:           []map[string]interface{}{make(map[string]interface{}, len(row))},
+			SchemaName:     v.SchemaName,
+			TableName:      v.TableName,
+			BinlogFileNum:  v.BinlogFileNum,
+			BinlogPosition: v.BinlogPosition,
+			Pri:            v.Pri,
+			ColumnMapping:  v.ColumnMapping,
+			PresentColumns: [][]string{make([]string, 0, len(row))},
+		}
+		updateDataMap[key] = data
+	}
+	for _, name := range v.PresentColumns[index] {
+		if _, ok = data.Rows[0][name]; ok {
+			continue
+		}
+		data.Rows[0][name] = row[name]
+		data.PresentColumns[0] = append(data.PresentColumns[0], name)
+	}
+	return nil
+}
+
+// 同一条数据 insert 之后又有部分字段的 update, 将 update 的字段合并到 insert 的数据中
+func mergePartialUpdateRow(updateDataMap map[interface{}]*pluginDriver.PluginDataType, key interface{}, row map[string]interface{}) map[string]interface{} {
+	data, ok := updateDataMap[key]
+	if !ok {
+		return row
+	}
+	delete(updateDataMap, key)
+	newRow := make(map[string]interface{}, len(row))
+	for name, val := range row {
+		newRow[name] = val
+	}
+	for _, name := range data.PresentColumns[0] {
+		newRow[name] = data.Rows[0][name]
+	}
+	return newRow
+}
+
+// 查询 ck 中 key 当前的整行数据, 返回的数据和 This.p.Field 顺序一致
+// 有版本字段的时候 取版本号最大的一条, 否则用 FINAL 取合并之后的数据
+func (This *Conn) getPartialUpdateCurrentRow(key interface{}) (current []dbDriver.Value, err error) {
+	var fields string
+	for _, v := range This.p.Field {
+		if fields != "" {
+			fields += ","
+		}
+		fields += v.CK
+	}
+	sql := "SELECT " + fields + " FROM " + This.p.ckDatakey
+	if This.p.bifrostDataVersionField != "" {
+		sql += " WHERE " + This.p.ckPriKey + "=? ORDER BY " + This.p.bifrostDataVersionField + " DESC LIMIT 1"
+	} else {
+		sql += " FINAL WHERE " + This.p.ckPriKey + "=? LIMIT 1"
+	}
+	stmt, err := This.conn.conn.Prepare(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	rows, err := stmt.Query([]dbDriver.Value{key})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	current = make([]dbDriver.Value, len(This.p.Field))
+	if err = rows.Next(current); err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s %s=%v not exist, binlog_row_image:MINIMAL/NOBLOB update can't be merged", This.p.ckDatakey, This.p.ckPriKey, key)
+		}
+		return nil, err
+	}
+	return current, nil
+}
+
+// binlog 中存在的字段 覆盖 ck 中当前的数据, 返回整行 insert 的数据
+func (This *Conn) getPartialUpdateInsertVal(data *pluginDriver.PluginDataType, current []dbDriver.Value) (val []dbDriver.Value, err error) {
+	val = make([]dbDriver.Value, 0, len(This.p.Field))
+	for i, v := range This.p.Field {
+		if v.MySQL == "" || data.IsColumnAbsent(0, v.MySQL) {
+			val = append(val, current[i])
+			continue
+		}
+		var toV interface{}
+		toV, err = CkDataTypeTransfer(This.getMySQLData(data, 0, v.MySQL), v.CK, v.CkType, This.p.NullNotTransferDefault)
+		if err != nil {
+			return nil, err
+		}
+		val = append(val, toV)
+	}
+	return
+}
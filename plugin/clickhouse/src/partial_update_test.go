@@ -0,0 +1,68 @@
+package src
+
+import (
+	dbDriver "database/sql/driver"
+	"testing"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConn_PartialUpdate(t *testing.T) {
+	conn := &Conn{
+		p: &PluginParam{
+			Field: []fieldStruct{
+				{CK: "id", MySQL: "id", CkType: "Int32"},
+				{CK: "name", MySQL: "name", CkType: "Nullable(String)"},
+				{CK: "age", MySQL: "age", CkType: "Int32"},
+				{CK: "binlog_event_type", MySQL: "{$EventType}", CkType: "String"},
+			},
+			ckDatakey:   "test.binlog_minimal",
+			ckPriKey:    "id",
+			mysqlPriKey: "id",
+			// 不把 null 转成默认值
+			NullNotTransferDefault: true,
+		},
+	}
+	columnMapping := map[string]string{"id": "int32", "name": "Nullable(string)", "age": "int32"}
+	newUpdateData := func(before, after map[string]interface{}, present []string) *pluginDriver.PluginDataType {
+		return &pluginDriver.PluginDataType{
+			EventType:      "update",
+			Rows:           []map[string]interface{}{before, after},
+			ColumnMapping:  columnMapping,
+			PresentColumns: [][]string{{"id"}, present},
+		}
+	}
+
+	Convey("later update columns first", t, func() {
+		updateDataMap := make(map[interface{}]*pluginDriver.PluginDataType, 0)
+		key := int32(1)
+		// CommitNormal 从最后一条数据开始遍历
+		err := conn.addPartialUpdateData(updateDataMap, key, newUpdateData(map[string]interface{}{"id": key}, map[string]interface{}{"name": nil}, []string{"name"}), 1)
+		So(err, ShouldBeNil)
+		err = conn.addPartialUpdateData(updateDataMap, key, newUpdateData(map[string]interface{}{"id": key}, map[string]interface{}{"name": "old", "age": int32(10)}, []string{"name", "age"}), 1)
+		So(err, ShouldBeNil)
+
+		// 和 ck 中当前的整行数据合并, binlog 中不存在的字段 使用 ck 中的值
+		current := []dbDriver.Value{key, "ck", int32(5), "insert"}
+		val, err := conn.getPartialUpdateInsertVal(updateDataMap[key], current)
+		So(err, ShouldBeNil)
+		So(len(val), ShouldEqual, 4)
+		So(val[0], ShouldEqual, key)
+		So(val[1], ShouldBeNil)
+		So(val[2], ShouldEqual, int32(10))
+		So(val[3], ShouldEqual, "update")
+
+		// insert 之后的 update 合并到 insert 中
+		row := mergePartialUpdateRow(updateDataMap, key, map[string]interface{}{"id": key, "name": "insert", "age": int32(1)})
+		So(row["name"], ShouldBeNil)
+		So(row["age"], ShouldEqual, int32(10))
+		So(len(updateDataMap), ShouldEqual, 0)
+	})
+
+	Convey("pri key changed", t, func() {
+		updateDataMap := make(map[interface{}]*pluginDriver.PluginDataType, 0)
+		err := conn.addPartialUpdateData(updateDataMap, int32(1), newUpdateData(map[string]interface{}{"id": int32(1)}, map[string]interface{}{"id": int32(2)}, []string{"id"}), 1)
+		So(err, ShouldNotBeNil)
+	})
+}
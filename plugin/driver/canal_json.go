@@ -27,16 +27,27 @@ func NewPluginDataCanal(content []byte) (*PluginDataCanal, error) {
 }
 
 func (c *PluginDataCanal) ToBifrostOutputPluginData() (data *PluginDataType) {
-	if c.Sql != "" {
+	if c.Sql != "" && !c.IsDML() {
 		data = c.ToBifrostOutputPluginDataWithSql()
 	} else {
 		data = c.ToBifrostOutputPluginDataWithRow()
+		// DML 事件中的 sql 为产生这条数据的原始 SQL
+		data.RowsQuery = c.Sql
 	}
 	data.SchemaName = c.Database
 	data.TableName = c.Table
 	return
 }
 
+func (c *PluginDataCanal) IsDML() bool {
+	switch c.Type {
+	case "INSERT", "UPDATE", "DELETE":
+		return true
+	default:
+		return false
+	}
+}
+
 func (c *PluginDataCanal) ToBifrostOutputPluginDataWithSql() *PluginDataType {
 	data := &PluginDataType{
 		EventType: "sql",
@@ -66,7 +66,7 @@ type DebeziumValuePayload struct {
 	//Transaction *string `json:"transaction"`  //当前计算中不需要这个字段
 }
 
-// 因为source里的字段 取决于 debezium 中不同connector的插件信息，我们只用到通用的 name,db,table三个字段
+// 因为source里的字段 取决于 debezium 中不同connector的插件信息，我们只用到通用的 name,db,table三个字段, 以及 mysql connector 开启 include.query 时的 query
 type DebeziumValuePayloadSource struct {
 	/*
 	   "source": {
@@ -90,6 +90,7 @@ type DebeziumValuePayloadSource struct {
 	Name     string `json:"name"`   // 同步的名字，并不是插件名
 	Database string `json:"db"`     // 数据库名
 	Table    string `json:"table""` // 表名
+	Query    string `json:"query"`  // 产生这条数据的原始 SQL, 没开启 include.query 的时候为 null
 }
 
 type Debezium struct {
@@ -179,6 +180,7 @@ func (c *Debezium) ToBifrostOutputPluginDataWithRow() *PluginDataType {
 		ColumnMapping: columnMap,
 		SchemaName:    c.Value.Payload.Source.Database,
 		TableName:     c.Value.Payload.Source.Table,
+		RowsQuery:     c.Value.Payload.Source.Query,
 	}
 	return data
 }
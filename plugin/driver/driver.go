@@ -42,6 +42,16 @@ type PluginDataType struct {
 	Pri             []string
 	EventID         uint64
 	ColumnMapping   map[string]string
+	PresentColumns  [][]string               `json:",omitempty"` // 和 Rows 一一对应, binlog_row_image = MINIMAL/NOBLOB 时每行实际存在的字段; 为 nil 表示所有字段都存在
+	JsonDiffs       []map[string][]*JsonDiff `json:",omitempty"` // 和 Rows 一一对应, binlog_row_value_options = PARTIAL_JSON 时 json 字段的修改操作, Rows 中已经是完整的数据
+	RowsQuery       string                   `json:",omitempty"` // 产生这条数据的原始 SQL, 源端 binlog_rows_query_log_events = ON 时才有
+}
+
+// json 字段的修改操作, 像 MongoDB 这种可以直接按 path 修改的目标端 可以直接使用
+type JsonDiff struct {
+	Op    string      // REPLACE, INSERT, REMOVE
+	Path  string      // 修改的 json path, 比如 $.a[1].b
+	Value interface{} // REMOVE 的时候为 nil
 }
 
 func GetApiVersion() string {
@@ -66,6 +76,27 @@ type Driver interface {
 	Skip(*PluginDataType) error
 }
 
+// 按源端事务提交, 只有能在目标端一个事务中 执行整个源端事务的插件 才需要实现
+// ToServer 开启 Transaction 的时候, 同一个源端事务中的 insert,update,delete 数据按顺序放在 list 中, 最后一条为 commit
+// 返回值和 Commit 一样, 成功的时候 LastSuccessCommitData 为最后的 commit
+type TransactionDriver interface {
+	Transaction(list []*PluginDataType, retry bool) (*PluginDataType, *PluginDataType, error)
+}
+
+// 冲突类型
+const (
+	CONFLICT_INSERT_EXISTS   = "InsertExists"   // insert 的数据 在目标表中已经存在
+	CONFLICT_UPDATE_MISSING  = "UpdateMissing"  // update 的数据 在目标表中不存在
+	CONFLICT_DELETE_MISSING  = "DeleteMissing"  // delete 的数据 在目标表中不存在
+	CONFLICT_BEFORE_MISMATCH = "BeforeMismatch" // update,delete 的 before 数据 和目标表中的数据不一致
+)
+
+// 冲突检测, 支持冲突检测的插件 实现, 按冲突类型 累计 当前参数(SetParam)下检测到的冲突数量
+// ToServer 在每次提交之后调用, 返回上一次调用之后新增的数量
+type ConflictDriver interface {
+	GetConflictCount() map[string]uint64
+}
+
 type DriverStructure struct {
 	Version        string // 插件版本
 	BifrostVersion string // 插件开发所使用的Bifrost的版本
@@ -116,6 +147,17 @@ func Drivers() map[string]DriverStructure {
 	return data
 }
 
+// 插件是否实现了 TransactionDriver, 支持按源端事务提交
+func SupportTransaction(name string) bool {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	if _, ok := drivers[name]; !ok {
+		return false
+	}
+	_, ok := drivers[name].driver().(TransactionDriver)
+	return ok
+}
+
 func Open(name string, uri *string) Driver {
 	driversMu.RLock()
 	defer driversMu.RUnlock()
@@ -144,6 +186,18 @@ func TransfeResult(val string, data *PluginDataType, rowIndex int, noTagsReturnN
 	if data == nil {
 		return nil
 	}
+	// expr: 开头的 为表达式, 比如 expr:EventType == "delete" ? "topic_delete" : "topic_" + TableName
+	// 表达式编译失败的情况下, 按原来的 标签替换 逻辑处理
+	if strings.HasPrefix(val, "expr:") {
+		if e, err := GetExpr(val[5:]); err == nil {
+			r, err := e.Eval(data, rowIndex)
+			if err != nil {
+				log.Println("TransfeResult expr:", e.String(), " err:", err)
+				return nil
+			}
+			return r
+		}
+	}
 	p := reqTagAll.FindAllStringSubmatch(val, -1)
 	// 假如不存在 {$json} 标签，则直接返回nil
 	// 这个改动,在极端情况下,可能会导致以下版本升级至此合并之后的版本在下面场景使用情况下,出现不一致的结果
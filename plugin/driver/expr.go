@@ -0,0 +1,690 @@
+package driver
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+表达式，用于插件里 条件key，topic 名称 及 server 里的数据路由判断
+
+	EventType == "update" && after.amount > before.amount * 2
+	{$TableName} in ["t1","t2"] ? "topic_a" : "topic_" + SchemaName
+
+数据元信息: EventType, SchemaName, TableName, AliasSchemaName, AliasTableName, Query, Gtid(GTID),
+BinlogTimestamp, BinlogFileNum, BinlogPosition, EventID, EventSize, Timestamp(当前时间)
+
+行数据: row.字段名 当前行, before.字段名 更新前的数据, after.字段名 更新后的数据
+不在元信息里的 标识符 当作 当前行 的字段名, 字段名有特殊字符的情况下用 `字段名` 或者 row["字段名"]
+
+字符串 和 数字 比较的时候，字符串会被转成数字比较，decimal 类型 的字段值是字符串，也可以直接计算
+任何值 和 null 进行 大小比较 和 计算 结果都是 null (和 SQL 一样)
+*/
+
+type exprType int8
+
+const (
+	exprTypeAny exprType = iota
+	exprTypeBool
+	exprTypeNumber
+	exprTypeString
+	exprTypeNull
+	exprTypeRow
+	exprTypeList
+)
+
+func (t exprType) String() string {
+	switch t {
+	case exprTypeBool:
+		return "bool"
+	case exprTypeNumber:
+		return "number"
+	case exprTypeString:
+		return "string"
+	case exprTypeNull:
+		return "null"
+	case exprTypeRow:
+		return "row"
+	case exprTypeList:
+		return "list"
+	default:
+		return "any"
+	}
+}
+
+var exprMetaTypes = map[string]exprType{
+	"EventType":       exprTypeString,
+	"SchemaName":      exprTypeString,
+	"TableName":       exprTypeString,
+	"AliasSchemaName": exprTypeString,
+	"AliasTableName":  exprTypeString,
+	"Query":           exprTypeString,
+	"Gtid":            exprTypeString,
+	"GTID":            exprTypeString,
+	"BinlogTimestamp": exprTypeNumber,
+	"BinlogFileNum":   exprTypeNumber,
+	"BinlogPosition":  exprTypeNumber,
+	"EventID":         exprTypeNumber,
+	"EventSize":       exprTypeNumber,
+	"Timestamp":       exprTypeNumber,
+}
+
+const (
+	exprRowCurrent int8 = iota
+	exprRowBefore
+	exprRowAfter
+)
+
+type exprTokenKind int8
+
+const (
+	exprTokenEOF exprTokenKind = iota
+	exprTokenNumber
+	exprTokenString
+	exprTokenIdent
+	exprTokenQuotedIdent // `字段名`
+	exprTokenTag         // {$TableName}
+	exprTokenOp
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	val  string
+	pos  int
+}
+
+func exprTokenize(s string) ([]exprToken, error) {
+	tokens := make([]exprToken, 0)
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			start := i
+			for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+				i++
+			}
+			if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+				i++
+				if i < len(s) && (s[i] == '+' || s[i] == '-') {
+					i++
+				}
+				for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+					i++
+				}
+			}
+			tokens = append(tokens, exprToken{kind: exprTokenNumber, val: s[start:i], pos: start})
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			start := i
+			for i < len(s) && (s[i] == '_' || s[i] >= 'a' && s[i] <= 'z' || s[i] >= 'A' && s[i] <= 'Z' || s[i] >= '0' && s[i] <= '9') {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: exprTokenIdent, val: s[start:i], pos: start})
+		case c == '"' || c == '\'':
+			start := i
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(s) {
+					return nil, fmt.Errorf("unterminated string at %d", start)
+				}
+				if s[i] == c {
+					i++
+					break
+				}
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+					switch s[i] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					case 'r':
+						b.WriteByte('\r')
+					default:
+						b.WriteByte(s[i])
+					}
+					i++
+					continue
+				}
+				b.WriteByte(s[i])
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: exprTokenString, val: b.String(), pos: start})
+		case c == '`':
+			end := strings.IndexByte(s[i+1:], '`')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated ` at %d", i)
+			}
+			tokens = append(tokens, exprToken{kind: exprTokenQuotedIdent, val: s[i+1 : i+1+end], pos: i})
+			i += end + 2
+		case c == '{' && i+1 < len(s) && s[i+1] == '$':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated {$ at %d", i)
+			}
+			tokens = append(tokens, exprToken{kind: exprTokenTag, val: s[i+2 : i+end], pos: i})
+			i += end + 1
+		default:
+			if i+1 < len(s) {
+				switch s[i : i+2] {
+				case "&&", "||", "==", "!=", "<=", ">=", "<>":
+					tokens = append(tokens, exprToken{kind: exprTokenOp, val: s[i : i+2], pos: i})
+					i += 2
+					continue
+				}
+			}
+			if strings.IndexByte("()[],.!<>+-*/%?:=", c) < 0 {
+				return nil, fmt.Errorf("unexpected char %q at %d", c, i)
+			}
+			tokens = append(tokens, exprToken{kind: exprTokenOp, val: string(c), pos: i})
+			i++
+		}
+	}
+	tokens = append(tokens, exprToken{kind: exprTokenEOF, pos: len(s)})
+	return tokens, nil
+}
+
+type exprNode interface {
+	eval(ctx *exprContext) (interface{}, error)
+	// 编译时 推导出来的类型，推导不出来的为 exprTypeAny
+	getType() exprType
+}
+
+type exprLiteralNode struct {
+	val interface{}
+}
+
+type exprMetaNode struct {
+	name string
+}
+
+type exprRowNode struct {
+	which int8
+}
+
+type exprColumnNode struct {
+	name string
+}
+
+type exprIndexNode struct {
+	x   exprNode
+	key exprNode
+}
+
+type exprUnaryNode struct {
+	op string
+	x  exprNode
+}
+
+type exprBinaryNode struct {
+	op   string
+	l, r exprNode
+}
+
+type exprCondNode struct {
+	cond, yes, no exprNode
+}
+
+type exprInNode struct {
+	x    exprNode
+	list exprNode
+	not  bool
+}
+
+type exprListNode struct {
+	items []exprNode
+}
+
+type exprCallNode struct {
+	name string
+	fn   *exprFunc
+	args []exprNode
+	re   *regexp.Regexp // matches 第二个参数为常量的情况下，编译时就生成正则
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.pos]
+	if t.kind != exprTokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) isOp(ops ...string) bool {
+	t := p.peek()
+	if t.kind != exprTokenOp {
+		return false
+	}
+	for _, op := range ops {
+		if t.val == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *exprParser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == exprTokenIdent && strings.EqualFold(t.val, keyword)
+}
+
+func (p *exprParser) expectOp(op string) error {
+	if !p.isOp(op) {
+		return p.errorf("expected %s", op)
+	}
+	p.next()
+	return nil
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	if t.kind == exprTokenEOF {
+		return fmt.Errorf(format+" at end of expression", args...)
+	}
+	return fmt.Errorf(format+" at %d near %q", append(args, t.pos, t.val)...)
+}
+
+func (p *exprParser) parseExpr() (exprNode, error) {
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOp("?") {
+		return cond, nil
+	}
+	p.next()
+	if err = checkExprType(cond, exprTypeBool); err != nil {
+		return nil, err
+	}
+	yes, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expectOp(":"); err != nil {
+		return nil, err
+	}
+	no, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return &exprCondNode{cond: cond, yes: yes, no: no}, nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") || p.isKeyword("or") {
+		p.next()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if l, err = newExprBinaryNode("||", l, r); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	l, err := p.parseCompare()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") || p.isKeyword("and") {
+		p.next()
+		r, err := p.parseCompare()
+		if err != nil {
+			return nil, err
+		}
+		if l, err = newExprBinaryNode("&&", l, r); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func (p *exprParser) parseCompare() (exprNode, error) {
+	l, err := p.parseAdd()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.isOp("==", "=", "!=", "<>", "<", "<=", ">", ">="):
+		op := p.next().val
+		switch op {
+		case "=":
+			op = "=="
+		case "<>":
+			op = "!="
+		}
+		r, err := p.parseAdd()
+		if err != nil {
+			return nil, err
+		}
+		return newExprBinaryNode(op, l, r)
+	case p.isKeyword("in"), p.isKeyword("not") && p.tokens[p.pos+1].kind == exprTokenIdent && strings.EqualFold(p.tokens[p.pos+1].val, "in"):
+		not := p.isKeyword("not")
+		if not {
+			p.next()
+		}
+		p.next()
+		list, err := p.parseAdd()
+		if err != nil {
+			return nil, err
+		}
+		if t := list.getType(); t != exprTypeAny && t != exprTypeList {
+			return nil, fmt.Errorf("in must be followed by a list, but it is %s", t)
+		}
+		return &exprInNode{x: l, list: list, not: not}, nil
+	}
+	return l, nil
+}
+
+func (p *exprParser) parseAdd() (exprNode, error) {
+	l, err := p.parseMul()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+", "-") {
+		op := p.next().val
+		r, err := p.parseMul()
+		if err != nil {
+			return nil, err
+		}
+		if l, err = newExprBinaryNode(op, l, r); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func (p *exprParser) parseMul() (exprNode, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("*", "/", "%") {
+		op := p.next().val
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if l, err = newExprBinaryNode(op, l, r); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.isOp("!", "-") || p.isKeyword("not") {
+		op := p.next().val
+		if op != "-" {
+			op = "!"
+		}
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if op == "!" {
+			err = checkExprType(x, exprTypeBool)
+		} else {
+			err = checkExprType(x, exprTypeNumber, exprTypeString)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &exprUnaryNode{op: op, x: x}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *exprParser) parsePostfix() (exprNode, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.isOp("."):
+			p.next()
+			t := p.next()
+			if t.kind != exprTokenIdent && t.kind != exprTokenQuotedIdent && t.kind != exprTokenNumber {
+				p.pos--
+				return nil, p.errorf("expected field name")
+			}
+			x = &exprIndexNode{x: x, key: &exprLiteralNode{val: t.val}}
+		case p.isOp("["):
+			p.next()
+			key, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expectOp("]"); err != nil {
+				return nil, err
+			}
+			x = &exprIndexNode{x: x, key: key}
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.peek()
+	switch t.kind {
+	case exprTokenNumber:
+		p.next()
+		if i, err := strconv.ParseInt(t.val, 10, 64); err == nil {
+			return &exprLiteralNode{val: i}, nil
+		}
+		f, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", t.val, t.pos)
+		}
+		return &exprLiteralNode{val: f}, nil
+	case exprTokenString:
+		p.next()
+		return &exprLiteralNode{val: t.val}, nil
+	case exprTokenQuotedIdent:
+		p.next()
+		return &exprColumnNode{name: t.val}, nil
+	case exprTokenTag:
+		p.next()
+		if _, ok := exprMetaTypes[t.val]; ok {
+			return &exprMetaNode{name: t.val}, nil
+		}
+		return &exprColumnNode{name: t.val}, nil
+	case exprTokenIdent:
+		p.next()
+		if p.isOp("(") {
+			return p.parseCall(t)
+		}
+		switch strings.ToLower(t.val) {
+		case "true":
+			return &exprLiteralNode{val: true}, nil
+		case "false":
+			return &exprLiteralNode{val: false}, nil
+		case "null", "nil":
+			return &exprLiteralNode{val: nil}, nil
+		}
+		switch t.val {
+		case "row":
+			return &exprRowNode{which: exprRowCurrent}, nil
+		case "before":
+			return &exprRowNode{which: exprRowBefore}, nil
+		case "after":
+			return &exprRowNode{which: exprRowAfter}, nil
+		}
+		if _, ok := exprMetaTypes[t.val]; ok {
+			return &exprMetaNode{name: t.val}, nil
+		}
+		return &exprColumnNode{name: t.val}, nil
+	case exprTokenOp:
+		switch t.val {
+		case "(":
+			p.next()
+			x, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		case "[":
+			p.next()
+			list := &exprListNode{}
+			for !p.isOp("]") {
+				item, err := p.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+				if !p.isOp(",") {
+					break
+				}
+				p.next()
+			}
+			if err := p.expectOp("]"); err != nil {
+				return nil, err
+			}
+			return list, nil
+		}
+	}
+	return nil, p.errorf("unexpected token")
+}
+
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	fn, ok := exprFuncs[name.val]
+	if !ok {
+		return nil, fmt.Errorf("function %s not exist at %d", name.val, name.pos)
+	}
+	p.next()
+	call := &exprCallNode{name: name.val, fn: fn}
+	for !p.isOp(")") {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		if !p.isOp(",") {
+			break
+		}
+		p.next()
+	}
+	if err := p.expectOp(")"); err != nil {
+		return nil, err
+	}
+	if len(call.args) < fn.minArgs || (fn.maxArgs >= 0 && len(call.args) > fn.maxArgs) {
+		return nil, fmt.Errorf("function %s args count error at %d", name.val, name.pos)
+	}
+	if name.val == "matches" {
+		if l, ok := call.args[1].(*exprLiteralNode); ok {
+			re, err := regexp.Compile(fmt.Sprint(l.val))
+			if err != nil {
+				return nil, fmt.Errorf("function matches regexp err:%s", err)
+			}
+			call.re = re
+		}
+	}
+	return call, nil
+}
+
+// 编译时就能确定类型的情况下，检查类型是否正确
+func checkExprType(x exprNode, types ...exprType) error {
+	t := x.getType()
+	if t == exprTypeAny || t == exprTypeNull {
+		return nil
+	}
+	for _, t0 := range types {
+		if t == t0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s can't be used as %s", t, types[0])
+}
+
+func newExprBinaryNode(op string, l, r exprNode) (exprNode, error) {
+	var err error
+	switch op {
+	case "&&", "||":
+		if err = checkExprType(l, exprTypeBool); err == nil {
+			err = checkExprType(r, exprTypeBool)
+		}
+	case "-", "*", "/", "%":
+		if err = checkExprType(l, exprTypeNumber, exprTypeString); err == nil {
+			err = checkExprType(r, exprTypeNumber, exprTypeString)
+		}
+	case "+", "<", "<=", ">", ">=":
+		if err = checkExprType(l, exprTypeNumber, exprTypeString); err == nil {
+			err = checkExprType(r, exprTypeNumber, exprTypeString)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("operator %s: %s", op, err)
+	}
+	return &exprBinaryNode{op: op, l: l, r: r}, nil
+}
+
+type Expr struct {
+	source string
+	root   exprNode
+}
+
+// 编译表达式, 同一个表达式 建议使用 GetExpr 从缓存里获取
+func CompileExpr(source string) (*Expr, error) {
+	tokens, err := exprTokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	if p.peek().kind == exprTokenEOF {
+		return nil, fmt.Errorf("expression is empty")
+	}
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != exprTokenEOF {
+		return nil, p.errorf("unexpected token")
+	}
+	return &Expr{source: source, root: root}, nil
+}
+
+var exprCache sync.Map
+
+// 从缓存中获取编译好的表达式，不存在则编译
+func GetExpr(source string) (*Expr, error) {
+	if e, ok := exprCache.Load(source); ok {
+		return e.(*Expr), nil
+	}
+	e, err := CompileExpr(source)
+	if err != nil {
+		return nil, err
+	}
+	exprCache.Store(source, e)
+	return e, nil
+}
+
+func (e *Expr) String() string {
+	return e.source
+}
@@ -0,0 +1,761 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type exprContext struct {
+	data   *PluginDataType
+	row    map[string]interface{}
+	before map[string]interface{}
+	after  map[string]interface{}
+}
+
+// update 事件 Rows 是 [before,after,before,after...] 这样的结构
+// rowIndex 指向 before 或者 after 都可以
+func newExprContext(data *PluginDataType, rowIndex int) *exprContext {
+	ctx := &exprContext{data: data}
+	if data == nil || rowIndex < 0 || rowIndex >= len(data.Rows) {
+		return ctx
+	}
+	ctx.row = data.Rows[rowIndex]
+	switch data.EventType {
+	case "update":
+		if rowIndex%2 == 0 {
+			ctx.before = data.Rows[rowIndex]
+			if rowIndex+1 < len(data.Rows) {
+				ctx.after = data.Rows[rowIndex+1]
+			}
+		} else {
+			ctx.before = data.Rows[rowIndex-1]
+			ctx.after = data.Rows[rowIndex]
+		}
+	case "delete":
+		ctx.before = ctx.row
+	default:
+		ctx.after = ctx.row
+	}
+	return ctx
+}
+
+// 计算表达式, rowIndex 为 data.Rows 的下标
+func (e *Expr) Eval(data *PluginDataType, rowIndex int) (interface{}, error) {
+	return e.root.eval(newExprContext(data, rowIndex))
+}
+
+// 结果为 null 的时候 返回 false
+func (e *Expr) EvalBool(data *PluginDataType, rowIndex int) (bool, error) {
+	v, err := e.Eval(data, rowIndex)
+	if err != nil {
+		return false, err
+	}
+	return exprToBool(v)
+}
+
+// 结果为 null 的时候 返回 空字符串
+func (e *Expr) EvalString(data *PluginDataType, rowIndex int) (string, error) {
+	v, err := e.Eval(data, rowIndex)
+	if err != nil || v == nil {
+		return "", err
+	}
+	return exprToString(v), nil
+}
+
+func (n *exprLiteralNode) getType() exprType {
+	switch n.val.(type) {
+	case nil:
+		return exprTypeNull
+	case bool:
+		return exprTypeBool
+	case string:
+		return exprTypeString
+	default:
+		return exprTypeNumber
+	}
+}
+
+func (n *exprLiteralNode) eval(ctx *exprContext) (interface{}, error) {
+	return n.val, nil
+}
+
+func (n *exprMetaNode) getType() exprType {
+	return exprMetaTypes[n.name]
+}
+
+func (n *exprMetaNode) eval(ctx *exprContext) (interface{}, error) {
+	data := ctx.data
+	if n.name == "Timestamp" {
+		return time.Now().Unix(), nil
+	}
+	if data == nil {
+		return nil, nil
+	}
+	switch n.name {
+	case "EventType":
+		return data.EventType, nil
+	case "SchemaName":
+		return data.SchemaName, nil
+	case "TableName":
+		return data.TableName, nil
+	case "AliasSchemaName":
+		return data.AliasSchemaName, nil
+	case "AliasTableName":
+		return data.AliasTableName, nil
+	case "Query":
+		return data.Query, nil
+	case "Gtid", "GTID":
+		return data.Gtid, nil
+	case "BinlogTimestamp":
+		return int64(data.Timestamp), nil
+	case "BinlogFileNum":
+		return int64(data.BinlogFileNum), nil
+	case "BinlogPosition":
+		return int64(data.BinlogPosition), nil
+	case "EventID":
+		return exprNormalize(data.EventID), nil
+	case "EventSize":
+		return int64(data.EventSize), nil
+	}
+	return nil, nil
+}
+
+func (n *exprRowNode) getType() exprType {
+	return exprTypeRow
+}
+
+func (n *exprRowNode) eval(ctx *exprContext) (interface{}, error) {
+	var row map[string]interface{}
+	switch n.which {
+	case exprRowBefore:
+		row = ctx.before
+	case exprRowAfter:
+		row = ctx.after
+	default:
+		row = ctx.row
+	}
+	if row == nil {
+		return nil, nil
+	}
+	return row, nil
+}
+
+func (n *exprColumnNode) getType() exprType {
+	return exprTypeAny
+}
+
+func (n *exprColumnNode) eval(ctx *exprContext) (interface{}, error) {
+	if ctx.row == nil {
+		return nil, nil
+	}
+	return exprNormalize(ctx.row[n.name]), nil
+}
+
+func (n *exprIndexNode) getType() exprType {
+	return exprTypeAny
+}
+
+func (n *exprIndexNode) eval(ctx *exprContext) (interface{}, error) {
+	x, err := n.x.eval(ctx)
+	if err != nil || x == nil {
+		return nil, err
+	}
+	key, err := n.key.eval(ctx)
+	if err != nil || key == nil {
+		return nil, err
+	}
+	switch x.(type) {
+	case map[string]interface{}:
+		return exprNormalize(x.(map[string]interface{})[exprToString(key)]), nil
+	case []interface{}:
+		list := x.([]interface{})
+		i, err := exprToInt(key)
+		if err != nil || i < 0 || i >= int64(len(list)) {
+			return nil, nil
+		}
+		return exprNormalize(list[i]), nil
+	case string:
+		// json 字段 在部分输入源里 是字符串
+		var v interface{}
+		if err := json.Unmarshal([]byte(x.(string)), &v); err != nil {
+			return nil, nil
+		}
+		return (&exprIndexNode{x: &exprLiteralNode{val: v}, key: &exprLiteralNode{val: key}}).eval(ctx)
+	}
+	d := reflect.ValueOf(x)
+	switch d.Kind() {
+	case reflect.Map:
+		d = d.MapIndex(reflect.ValueOf(exprToString(key)))
+	case reflect.Array, reflect.Slice:
+		i, err := exprToInt(key)
+		if err != nil || i < 0 || i >= int64(d.Len()) {
+			return nil, nil
+		}
+		d = d.Index(int(i))
+	default:
+		return nil, nil
+	}
+	if !d.IsValid() {
+		return nil, nil
+	}
+	return exprNormalize(d.Interface()), nil
+}
+
+func (n *exprUnaryNode) getType() exprType {
+	if n.op == "!" {
+		return exprTypeBool
+	}
+	return exprTypeNumber
+}
+
+func (n *exprUnaryNode) eval(ctx *exprContext) (interface{}, error) {
+	x, err := n.x.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		b, err := exprToBool(x)
+		return !b, err
+	}
+	if x == nil {
+		return nil, nil
+	}
+	x, err = exprToNumber(x)
+	if err != nil {
+		return nil, err
+	}
+	if i, ok := x.(int64); ok {
+		return -i, nil
+	}
+	return -x.(float64), nil
+}
+
+func (n *exprCondNode) getType() exprType {
+	t1, t2 := n.yes.getType(), n.no.getType()
+	if t1 == t2 {
+		return t1
+	}
+	return exprTypeAny
+}
+
+func (n *exprCondNode) eval(ctx *exprContext) (interface{}, error) {
+	v, err := n.cond.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b, err := exprToBool(v)
+	if err != nil {
+		return nil, err
+	}
+	if b {
+		return n.yes.eval(ctx)
+	}
+	return n.no.eval(ctx)
+}
+
+func (n *exprInNode) getType() exprType {
+	return exprTypeBool
+}
+
+func (n *exprInNode) eval(ctx *exprContext) (interface{}, error) {
+	x, err := n.x.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list, err := n.list.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var in bool
+	switch list.(type) {
+	case []interface{}:
+		for _, v := range list.([]interface{}) {
+			if exprEqual(x, exprNormalize(v)) {
+				in = true
+				break
+			}
+		}
+	case nil:
+	default:
+		d := reflect.ValueOf(list)
+		if d.Kind() != reflect.Array && d.Kind() != reflect.Slice {
+			return nil, fmt.Errorf("in must be followed by a list, but it is %T", list)
+		}
+		for i := 0; i < d.Len(); i++ {
+			if exprEqual(x, exprNormalize(d.Index(i).Interface())) {
+				in = true
+				break
+			}
+		}
+	}
+	return in != n.not, nil
+}
+
+func (n *exprListNode) getType() exprType {
+	return exprTypeList
+}
+
+func (n *exprListNode) eval(ctx *exprContext) (interface{}, error) {
+	list := make([]interface{}, len(n.items))
+	for i, item := range n.items {
+		v, err := item.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = v
+	}
+	return list, nil
+}
+
+func (n *exprBinaryNode) getType() exprType {
+	switch n.op {
+	case "&&", "||", "==", "!=", "<", "<=", ">", ">=":
+		return exprTypeBool
+	case "+":
+		if n.l.getType() == exprTypeString && n.r.getType() == exprTypeString {
+			return exprTypeString
+		}
+		return exprTypeAny
+	default:
+		return exprTypeNumber
+	}
+}
+
+func (n *exprBinaryNode) eval(ctx *exprContext) (interface{}, error) {
+	l, err := n.l.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "&&", "||":
+		b, err := exprToBool(l)
+		if err != nil {
+			return nil, err
+		}
+		if b == (n.op == "||") {
+			return b, nil
+		}
+		r, err := n.r.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return exprToBool(r)
+	}
+	r, err := n.r.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return exprEqual(l, r), nil
+	case "!=":
+		return !exprEqual(l, r), nil
+	case "<", "<=", ">", ">=":
+		if l == nil || r == nil {
+			return false, nil
+		}
+		c, err := exprCompare(l, r)
+		if err != nil {
+			return nil, err
+		}
+		switch n.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+	if n.op == "+" && (exprIsNotNumberString(l) || exprIsNotNumberString(r)) {
+		return exprToString(l) + exprToString(r), nil
+	}
+	return exprArithmetic(n.op, l, r)
+}
+
+func (n *exprCallNode) getType() exprType {
+	return n.fn.returnType
+}
+
+func (n *exprCallNode) eval(ctx *exprContext) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	if n.re != nil {
+		if args[0] == nil {
+			return false, nil
+		}
+		return n.re.MatchString(exprToString(args[0])), nil
+	}
+	return n.fn.call(ctx, args)
+}
+
+type exprFunc struct {
+	minArgs    int
+	maxArgs    int // -1 不限制
+	returnType exprType
+	call       func(ctx *exprContext, args []interface{}) (interface{}, error)
+}
+
+var exprFuncs = map[string]*exprFunc{
+	"len": {1, 1, exprTypeNumber, func(ctx *exprContext, args []interface{}) (interface{}, error) {
+		switch args[0].(type) {
+		case nil:
+			return int64(0), nil
+		case string:
+			return int64(len([]rune(args[0].(string)))), nil
+		}
+		d := reflect.ValueOf(args[0])
+		switch d.Kind() {
+		case reflect.Map, reflect.Array, reflect.Slice:
+			return int64(d.Len()), nil
+		}
+		return int64(len([]rune(exprToString(args[0])))), nil
+	}},
+	"lower": {1, 1, exprTypeString, exprStringFunc(strings.ToLower)},
+	"upper": {1, 1, exprTypeString, exprStringFunc(strings.ToUpper)},
+	"trim":  {1, 1, exprTypeString, exprStringFunc(strings.TrimSpace)},
+	"contains": {2, 2, exprTypeBool, func(ctx *exprContext, args []interface{}) (interface{}, error) {
+		if args[0] == nil || args[1] == nil {
+			return false, nil
+		}
+		return strings.Contains(exprToString(args[0]), exprToString(args[1])), nil
+	}},
+	"startsWith": {2, 2, exprTypeBool, func(ctx *exprContext, args []interface{}) (interface{}, error) {
+		if args[0] == nil || args[1] == nil {
+			return false, nil
+		}
+		return strings.HasPrefix(exprToString(args[0]), exprToString(args[1])), nil
+	}},
+	"endsWith": {2, 2, exprTypeBool, func(ctx *exprContext, args []interface{}) (interface{}, error) {
+		if args[0] == nil || args[1] == nil {
+			return false, nil
+		}
+		return strings.HasSuffix(exprToString(args[0]), exprToString(args[1])), nil
+	}},
+	"matches": {2, 2, exprTypeBool, func(ctx *exprContext, args []interface{}) (interface{}, error) {
+		if args[0] == nil || args[1] == nil {
+			return false, nil
+		}
+		return regexp.MatchString(exprToString(args[1]), exprToString(args[0]))
+	}},
+	"int": {1, 1, exprTypeNumber, func(ctx *exprContext, args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		return exprToInt(args[0])
+	}},
+	"float": {1, 1, exprTypeNumber, func(ctx *exprContext, args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		return exprToFloat(args[0])
+	}},
+	"string": {1, 1, exprTypeString, func(ctx *exprContext, args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		return exprToString(args[0]), nil
+	}},
+	"abs": {1, 1, exprTypeNumber, func(ctx *exprContext, args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		v, err := exprToNumber(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if i, ok := v.(int64); ok {
+			if i < 0 {
+				return -i, nil
+			}
+			return i, nil
+		}
+		return math.Abs(v.(float64)), nil
+	}},
+	"isNull": {1, 1, exprTypeBool, func(ctx *exprContext, args []interface{}) (interface{}, error) {
+		return args[0] == nil, nil
+	}},
+	// 返回第一个不为 null 的值
+	"coalesce": {1, -1, exprTypeAny, func(ctx *exprContext, args []interface{}) (interface{}, error) {
+		for _, v := range args {
+			if v != nil {
+				return v, nil
+			}
+		}
+		return nil, nil
+	}},
+	// update 事件 指定字段是否有修改, 其他事件 返回 false
+	"changed": {1, 1, exprTypeBool, func(ctx *exprContext, args []interface{}) (interface{}, error) {
+		if ctx.before == nil || ctx.after == nil || ctx.data.EventType != "update" {
+			return false, nil
+		}
+		name := exprToString(args[0])
+		return !reflect.DeepEqual(ctx.before[name], ctx.after[name]), nil
+	}},
+}
+
+func exprStringFunc(f func(string) string) func(ctx *exprContext, args []interface{}) (interface{}, error) {
+	return func(ctx *exprContext, args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		return f(exprToString(args[0])), nil
+	}
+}
+
+// 所有整数 统一转成 int64 ,浮点数 转成 float64, []byte 转成 string
+func exprNormalize(v interface{}) interface{} {
+	switch v.(type) {
+	case int:
+		return int64(v.(int))
+	case int8:
+		return int64(v.(int8))
+	case int16:
+		return int64(v.(int16))
+	case int32:
+		return int64(v.(int32))
+	case uint:
+		return exprNormalize(uint64(v.(uint)))
+	case uint8:
+		return int64(v.(uint8))
+	case uint16:
+		return int64(v.(uint16))
+	case uint32:
+		return int64(v.(uint32))
+	case uint64:
+		if v.(uint64) > math.MaxInt64 {
+			return float64(v.(uint64))
+		}
+		return int64(v.(uint64))
+	case float32:
+		return float64(v.(float32))
+	case []byte:
+		return string(v.([]byte))
+	case json.Number:
+		if i, err := v.(json.Number).Int64(); err == nil {
+			return i
+		}
+		f, _ := v.(json.Number).Float64()
+		return f
+	}
+	return v
+}
+
+func exprToBool(v interface{}) (bool, error) {
+	switch v.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v.(bool), nil
+	default:
+		return false, fmt.Errorf("%v(%T) is not a bool", v, v)
+	}
+}
+
+func exprToString(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v.(string)
+	case []byte:
+		return string(v.([]byte))
+	case float64:
+		return strconv.FormatFloat(v.(float64), 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v.(float32)), 'f', -1, 32)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// 返回 int64 或者 float64
+func exprToNumber(v interface{}) (interface{}, error) {
+	v = exprNormalize(v)
+	switch v.(type) {
+	case int64, float64:
+		return v, nil
+	case bool:
+		if v.(bool) {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case string:
+		s := strings.TrimSpace(v.(string))
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("%v(%T) is not a number", v, v)
+}
+
+func exprToInt(v interface{}) (int64, error) {
+	n, err := exprToNumber(v)
+	if err != nil {
+		return 0, err
+	}
+	if i, ok := n.(int64); ok {
+		return i, nil
+	}
+	return int64(n.(float64)), nil
+}
+
+func exprToFloat(v interface{}) (float64, error) {
+	n, err := exprToNumber(v)
+	if err != nil {
+		return 0, err
+	}
+	if i, ok := n.(int64); ok {
+		return float64(i), nil
+	}
+	return n.(float64), nil
+}
+
+func exprIsNotNumberString(v interface{}) bool {
+	if s, ok := v.(string); ok {
+		_, err := exprToNumber(s)
+		return err != nil
+	}
+	return false
+}
+
+func exprIsNumber(v interface{}) bool {
+	switch v.(type) {
+	case int64, float64:
+		return true
+	}
+	return false
+}
+
+func exprEqual(l, r interface{}) bool {
+	if l == nil || r == nil {
+		return l == nil && r == nil
+	}
+	// 数字 和 字符串 比较的时候，字符串 转成数字 再比较
+	if exprIsNumber(l) || exprIsNumber(r) {
+		c, err := exprCompare(l, r)
+		return err == nil && c == 0
+	}
+	switch l.(type) {
+	case string, bool:
+		return l == r
+	}
+	return reflect.DeepEqual(l, r)
+}
+
+func exprCompare(l, r interface{}) (int, error) {
+	s1, ok1 := l.(string)
+	s2, ok2 := r.(string)
+	if ok1 && ok2 {
+		// 两个都是数字字符串，则按数字比较 ，比如 decimal 类型
+		f1, err1 := strconv.ParseFloat(strings.TrimSpace(s1), 64)
+		f2, err2 := strconv.ParseFloat(strings.TrimSpace(s2), 64)
+		if err1 != nil || err2 != nil {
+			return strings.Compare(s1, s2), nil
+		}
+		return exprCompareFloat(f1, f2), nil
+	}
+	n1, err := exprToNumber(l)
+	if err != nil {
+		return 0, err
+	}
+	n2, err := exprToNumber(r)
+	if err != nil {
+		return 0, err
+	}
+	i1, ok1 := n1.(int64)
+	i2, ok2 := n2.(int64)
+	if ok1 && ok2 {
+		switch {
+		case i1 < i2:
+			return -1, nil
+		case i1 > i2:
+			return 1, nil
+		default:
+			return 0, nil
+		}
+	}
+	f1, _ := exprToFloat(n1)
+	f2, _ := exprToFloat(n2)
+	return exprCompareFloat(f1, f2), nil
+}
+
+func exprCompareFloat(f1, f2 float64) int {
+	switch {
+	case f1 < f2:
+		return -1
+	case f1 > f2:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func exprArithmetic(op string, l, r interface{}) (interface{}, error) {
+	n1, err := exprToNumber(l)
+	if err != nil {
+		return nil, err
+	}
+	n2, err := exprToNumber(r)
+	if err != nil {
+		return nil, err
+	}
+	i1, ok1 := n1.(int64)
+	i2, ok2 := n2.(int64)
+	if ok1 && ok2 {
+		switch op {
+		case "+":
+			return i1 + i2, nil
+		case "-":
+			return i1 - i2, nil
+		case "*":
+			return i1 * i2, nil
+		case "%":
+			if i2 == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			return i1 % i2, nil
+		}
+	}
+	f1, _ := exprToFloat(n1)
+	f2, _ := exprToFloat(n2)
+	switch op {
+	case "+":
+		return f1 + f2, nil
+	case "-":
+		return f1 - f2, nil
+	case "*":
+		return f1 * f2, nil
+	case "/":
+		if f2 == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return f1 / f2, nil
+	case "%":
+		if f2 == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return math.Mod(f1, f2), nil
+	}
+	return nil, fmt.Errorf("operator %s not supported", op)
+}
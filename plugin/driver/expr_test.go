@@ -0,0 +1,148 @@
+package driver
+
+import (
+	"github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func getExprTestUpdateData() *PluginDataType {
+	return &PluginDataType{
+		Timestamp:      1600000000,
+		EventType:      "update",
+		SchemaName:     "bifrost_test",
+		TableName:      "order",
+		BinlogFileNum:  3,
+		BinlogPosition: 1000,
+		Gtid:           "gtidTest",
+		EventID:        10,
+		Pri:            []string{"id"},
+		Rows: []map[string]interface{}{
+			{"id": uint32(1), "amount": "10.50", "status": int8(1), "name": "a", "user name": nil, "json": map[string]interface{}{"k": []interface{}{"v0", "v1"}}},
+			{"id": uint32(1), "amount": "30.00", "status": int8(2), "name": "a", "user name": "bifrost", "json": `{"k":["v0","v2"]}`},
+		},
+	}
+}
+
+func TestCompileExpr(t *testing.T) {
+	convey.Convey("syntax error", t, func() {
+		for _, s := range []string{
+			"",
+			"EventType ==",
+			"(1 + 2",
+			"after.amount > 'a",
+			"notExistFunc(1)",
+			"len(1, 2)",
+			"EventType == \"update\" &&",
+			"1 2",
+			"matches(name, '[')",
+		} {
+			_, err := CompileExpr(s)
+			convey.So(err, convey.ShouldNotBeNil)
+		}
+	})
+	convey.Convey("type error", t, func() {
+		for _, s := range []string{
+			"EventType && true",
+			"!TableName",
+			"true + 1",
+			"BinlogPosition > 1 ? 1 : 2 || true",
+			"1 in 2",
+		} {
+			_, err := CompileExpr(s)
+			convey.So(err, convey.ShouldNotBeNil)
+		}
+	})
+	convey.Convey("cache", t, func() {
+		e1, err := GetExpr("EventType == 'insert'")
+		convey.So(err, convey.ShouldBeNil)
+		e2, err := GetExpr("EventType == 'insert'")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(e1, convey.ShouldEqual, e2)
+		convey.So(e1.String(), convey.ShouldEqual, "EventType == 'insert'")
+	})
+}
+
+func TestExpr_Eval(t *testing.T) {
+	data := getExprTestUpdateData()
+	evalBool := func(s string, rowIndex int) bool {
+		e, err := CompileExpr(s)
+		convey.So(err, convey.ShouldBeNil)
+		b, err := e.EvalBool(data, rowIndex)
+		convey.So(err, convey.ShouldBeNil)
+		return b
+	}
+	eval := func(s string, rowIndex int) interface{} {
+		e, err := CompileExpr(s)
+		convey.So(err, convey.ShouldBeNil)
+		v, err := e.Eval(data, rowIndex)
+		convey.So(err, convey.ShouldBeNil)
+		return v
+	}
+	convey.Convey("before and after", t, func() {
+		convey.So(evalBool(`EventType == "update" && after.amount > before.amount * 2`, 1), convey.ShouldBeTrue)
+		convey.So(evalBool(`EventType == "update" && after.amount > before.amount * 2`, 0), convey.ShouldBeTrue)
+		convey.So(evalBool(`after.amount > before.amount * 3`, 1), convey.ShouldBeFalse)
+		convey.So(evalBool(`after.status - before.status == 1`, 1), convey.ShouldBeTrue)
+		convey.So(evalBool(`changed("status") and not changed("name")`, 1), convey.ShouldBeTrue)
+		convey.So(eval(`amount`, 0), convey.ShouldEqual, "10.50")
+		convey.So(eval(`amount`, 1), convey.ShouldEqual, "30.00")
+	})
+	convey.Convey("meta", t, func() {
+		convey.So(evalBool(`{$TableName} == "order" && SchemaName in ["bifrost_test", "x"]`, 1), convey.ShouldBeTrue)
+		convey.So(evalBool(`BinlogFileNum == 3 && BinlogPosition >= 1000 && BinlogTimestamp == 1600000000 && EventID == 10 && GTID == "gtidTest"`, 1), convey.ShouldBeTrue)
+		convey.So(eval(`EventType == "delete" ? "topic_delete" : "topic_" + TableName`, 1), convey.ShouldEqual, "topic_order")
+		convey.So(evalBool(`TableName not in ["order"]`, 1), convey.ShouldBeFalse)
+	})
+	convey.Convey("null", t, func() {
+		convey.So(evalBool("before.`user name` == null && isNull(before[\"user name\"])", 1), convey.ShouldBeTrue)
+		convey.So(evalBool("before.`user name` > 1", 1), convey.ShouldBeFalse)
+		convey.So(eval("before.`user name` + 1", 1), convey.ShouldBeNil)
+		convey.So(eval("coalesce(before.`user name`, after.`user name`)", 1), convey.ShouldEqual, "bifrost")
+		convey.So(eval("not_exist_column", 1), convey.ShouldBeNil)
+	})
+	convey.Convey("nested", t, func() {
+		convey.So(eval(`before.json.k[1]`, 1), convey.ShouldEqual, "v1")
+		convey.So(eval(`after.json["k"][1]`, 1), convey.ShouldEqual, "v2")
+		convey.So(eval(`after.json.k[5]`, 1), convey.ShouldBeNil)
+	})
+	convey.Convey("functions", t, func() {
+		convey.So(eval(`upper(name) + len(after.json)`, 1), convey.ShouldEqual, "A17")
+		convey.So(evalBool(`matches(TableName, "^ord") && startsWith(TableName, "or") && endsWith(TableName, "er") && contains(TableName, "rd")`, 1), convey.ShouldBeTrue)
+		convey.So(eval(`int(amount) % 7`, 1), convey.ShouldEqual, int64(2))
+		convey.So(eval(`abs(-float(amount) / 4)`, 1), convey.ShouldEqual, 7.5)
+		convey.So(eval(`string(id) + "-" + lower("A")`, 1), convey.ShouldEqual, "1-a")
+	})
+	convey.Convey("runtime error", t, func() {
+		e, err := CompileExpr(`name && true`)
+		convey.So(err, convey.ShouldBeNil)
+		_, err = e.EvalBool(data, 1)
+		convey.So(err, convey.ShouldNotBeNil)
+
+		e, err = CompileExpr(`id / 0`)
+		convey.So(err, convey.ShouldBeNil)
+		_, err = e.Eval(data, 1)
+		convey.So(err, convey.ShouldNotBeNil)
+	})
+	convey.Convey("insert and delete", t, func() {
+		insertData := &PluginDataType{EventType: "insert", Rows: []map[string]interface{}{{"id": 1}}}
+		e, _ := CompileExpr(`after.id == 1 && before == null`)
+		b, err := e.EvalBool(insertData, 0)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(b, convey.ShouldBeTrue)
+
+		insertData.EventType = "delete"
+		e, _ = CompileExpr(`before.id == 1 && after.id == null`)
+		b, err = e.EvalBool(insertData, 0)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(b, convey.ShouldBeTrue)
+	})
+}
+
+func TestTransfeResult_Expr(t *testing.T) {
+	data := getExprTestUpdateData()
+	convey.Convey("expr", t, func() {
+		convey.So(TransfeResult(`expr:after.amount > before.amount ? "topic_up" : "topic_" + TableName`, data, 1), convey.ShouldEqual, "topic_up")
+		// 编译失败，按原来的逻辑处理
+		convey.So(TransfeResult(`expr:{$TableName} ==`, data, 1), convey.ShouldEqual, "expr:order ==")
+	})
+}
@@ -0,0 +1,61 @@
+package driver
+
+import "strings"
+
+/*
+binlog_row_image = MINIMAL/NOBLOB 的时候, binlog 中只包含部分字段
+没有在 binlog 中的字段, 不会出现在 Rows 的 map 中, 和值为 NULL 的字段区分开
+每一行实际存在的字段, 记录在 PresentColumns 中
+*/
+
+// 第 index 行数据是否只包含部分字段
+func (c *PluginDataType) IsPartialRow(index int) bool {
+	if index < 0 || index >= len(c.PresentColumns) {
+		return false
+	}
+	return c.PresentColumns[index] != nil
+}
+
+// 第 index 行数据中 key 字段是否为 binlog 中缺失的字段
+// 非源表字段(比如 {$EventType} 等标签) 不认为是缺失的字段
+func (c *PluginDataType) IsColumnAbsent(index int, key string) bool {
+	if !c.IsPartialRow(index) {
+		return false
+	}
+	for _, name := range c.PresentColumns[index] {
+		if name == key {
+			return false
+		}
+	}
+	if c.ColumnMapping != nil {
+		_, ok := c.ColumnMapping[key]
+		return ok
+	}
+	return key != "" && !strings.HasPrefix(key, "{$")
+}
+
+// 数据列表中是否有只包含部分字段的数据
+func HasPartialRows(list []*PluginDataType) bool {
+	for _, data := range list {
+		if data != nil && data.PresentColumns != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// 取出从第 start 行开始的 n 行数据 对应的 PresentColumns, 用于拆分多行数据
+func (c *PluginDataType) GetPresentColumns(start, n int) [][]string {
+	if c.PresentColumns == nil || start < 0 || start+n > len(c.PresentColumns) {
+		return nil
+	}
+	return c.PresentColumns[start : start+n]
+}
+
+// 取出从第 start 行开始的 n 行数据 对应的 JsonDiffs, 用于拆分多行数据
+func (c *PluginDataType) GetJsonDiffs(start, n int) []map[string][]*JsonDiff {
+	if c.JsonDiffs == nil || start < 0 || start+n > len(c.JsonDiffs) {
+		return nil
+	}
+	return c.JsonDiffs[start : start+n]
+}
@@ -0,0 +1,45 @@
+package driver
+
+import (
+	"testing"
+)
+
+func TestPluginDataType_IsColumnAbsent(t *testing.T) {
+	data := &PluginDataType{
+		EventType: "update",
+		Rows: []map[string]interface{}{
+			{"id": uint64(1)},
+			{"name": nil},
+		},
+		ColumnMapping: map[string]string{
+			"id":   "uint64",
+			"name": "Nullable(string)",
+			"blob": "Nullable(string)",
+		},
+		PresentColumns: [][]string{{"id"}, {"name"}},
+	}
+	if !data.IsPartialRow(0) || !data.IsPartialRow(1) || data.IsPartialRow(2) {
+		t.Fatal("IsPartialRow error")
+	}
+	if data.IsColumnAbsent(0, "id") || !data.IsColumnAbsent(0, "name") {
+		t.Fatal("row 0 IsColumnAbsent error")
+	}
+	// 值为 NULL 的字段 不是缺失的字段
+	if data.IsColumnAbsent(1, "name") || !data.IsColumnAbsent(1, "blob") {
+		t.Fatal("row 1 IsColumnAbsent error")
+	}
+	if data.IsColumnAbsent(1, "{$EventType}") {
+		t.Fatal("{$EventType} can't be absent")
+	}
+	if !HasPartialRows([]*PluginDataType{{}, data}) {
+		t.Fatal("HasPartialRows error")
+	}
+
+	data.PresentColumns = nil
+	if data.IsColumnAbsent(0, "name") {
+		t.Fatal("full row image can't be absent")
+	}
+	if HasPartialRows([]*PluginDataType{data}) {
+		t.Fatal("HasPartialRows error")
+	}
+}
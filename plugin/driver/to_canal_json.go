@@ -42,6 +42,8 @@ func (c *PluginDataType) ToCanalJsonObject() (canal *PluginDataCanal, err error)
 		canal.Data = c.Rows
 		break
 	}
+	// 和 canal 一样, 开启了 binlog_rows_query_log_events 的时候 DML 的 sql 为原始 SQL
+	canal.Sql = c.RowsQuery
 	canal.MysqlType, canal.SqlType = c.ToCanalJsonMysqlAndSqlType()
 	return
 }
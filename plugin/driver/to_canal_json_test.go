@@ -16,3 +16,26 @@ func TestPluginDataType_ToCanalJsonObject(t *testing.T) {
 		So(canalData.SqlType["id"], ShouldEqual, -5)
 	})
 }
+
+func TestPluginDataType_ToCanalJsonObject_RowsQuery(t *testing.T) {
+	Convey("DML 原始 SQL", t, func() {
+		data := &PluginDataType{
+			EventType:     "insert",
+			SchemaName:    "bifrost_test",
+			TableName:     "t1",
+			Rows:          []map[string]interface{}{{"id": int32(1)}},
+			Pri:           []string{"id"},
+			ColumnMapping: map[string]string{"id": "int32"},
+			RowsQuery:     "INSERT INTO t1 (id) VALUES (1)",
+		}
+		canalData, err := data.ToCanalJsonObject()
+		So(err, ShouldEqual, nil)
+		So(canalData.IsDDL, ShouldEqual, false)
+		So(canalData.Sql, ShouldEqual, data.RowsQuery)
+
+		newData := canalData.ToBifrostOutputPluginData()
+		So(newData.EventType, ShouldEqual, "insert")
+		So(newData.RowsQuery, ShouldEqual, data.RowsQuery)
+		So(len(newData.Rows), ShouldEqual, 1)
+	})
+}
@@ -55,8 +55,17 @@ type PluginParam struct {
 	BifrostFilterQuery   bool // bifrost server 保留,是否过滤sql事件
 	BifrostMustBeSuccess bool // bifrost server 保留,数据是否能丢
 
+	Idempotent             bool   // 幂等生产者
+	Transactional          bool   // 事务模式, Exactly-once
+	TransactionalId        string // 事务ID, 每个同步配置 必须唯一
+	TransactionOffsetTopic string // 事务模式下 保存位点的 topic
+
 	dataList         []*sarama.ProducerMessage
 	commitBinlogList []*pluginDriver.PluginDataType
+
+	txnProducer    *txnProducer
+	txnCommitIndex int                          // dataList 中 最后一个 commit 事件 之前的数据条数
+	txnCommitData  *pluginDriver.PluginDataType // dataList 中 最后一个 commit 事件
 }
 
 func NewConn() pluginDriver.Driver {
@@ -104,6 +113,11 @@ func (This *Conn) newProducer() bool {
 	config.ConnectConfig.Producer.Return.Errors = true
 	config.ConnectConfig.Producer.RequiredAcks = This.p.RequiredAcks
 	config.ConnectConfig.Producer.Timeout = time.Duration(This.p.Timeout) * time.Second
+	if This.p.Idempotent {
+		config.ConnectConfig.Producer.Idempotent = true
+		config.ConnectConfig.Producer.RequiredAcks = sarama.WaitForAll
+		config.ConnectConfig.Net.MaxOpenRequests = 1
+	}
 	//config.ConnectConfig.Producer.Partitioner = sarama.NewRandomPartitioner
 	This.producer, This.err = sarama.NewSyncProducer(config.BrokerServerList, config.ConnectConfig)
 	if This.err == nil {
@@ -147,6 +161,16 @@ func (This *Conn) GetParam(p interface{}) (interface{}, error) {
 		param.RequiredAcks = sarama.WaitForAll
 		break
 	}
+	if param.Transactional {
+		if param.TransactionalId == "" {
+			return nil, fmt.Errorf("TransactionalId can't be empty when Transactional is true")
+		}
+		if param.TransactionOffsetTopic == "" {
+			param.TransactionOffsetTopic = defaultTransactionOffsetTopic
+		}
+		param.Idempotent = true
+		param.RequiredAcks = sarama.WaitForAll
+	}
 	if len(param.dataList) == 0 {
 		param.dataList = make([]*sarama.ProducerMessage, 0)
 		param.commitBinlogList = make([]*pluginDriver.PluginDataType, 0)
@@ -241,6 +265,9 @@ func (This *Conn) getMsg(data *pluginDriver.PluginDataType) (*sarama.ProducerMes
 }
 
 func (This *Conn) sendToList(data *pluginDriver.PluginDataType, retry bool, isCommit bool) (LastSuccessCommitData *pluginDriver.PluginDataType, Errdata *pluginDriver.PluginDataType, err error) {
+	if This.p.Transactional {
+		return This.sendToListByTxn(data, retry, isCommit)
+	}
 	if data == nil && retry == true {
 		LastSuccessCommitData, err = This.sendToKafkaByBatch()
 		goto endErr
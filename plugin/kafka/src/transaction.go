@@ -0,0 +1,537 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package src
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Shopify/sarama"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"log"
+	"time"
+)
+
+/*
+事务模式 (Exactly-once)
+
+当前使用的 sarama 版本 没有提供 事务生产者 的接口，这里直接使用 kafka 事务协议实现
+1. InitProducerID 带上 TransactionalId ,kafka 会 中止 同一个 TransactionalId 之前未完成的事务，并且 fence 掉旧的生产者
+2. 每一批数据 和 这一批数据最后一个 commit 事件的位点 在同一个事务里写入，位点写入到 TransactionOffsetTopic 里, key 为 TransactionalId
+3. 重启的时候 从 TransactionOffsetTopic 读取最后一个已提交的位点，小于等于这个位点的数据 直接跳过，防止 Bifrost 位点没来得及保存 而重复写入
+
+下游消费者 需要设置 isolation.level=read_committed
+*/
+
+const defaultTransactionOffsetTopic = "bifrost_kafka_offsets"
+
+// 分区 和 sarama 默认的 hash 分区 计算方式一样，保证 事务模式 和 普通模式 同一个 key 写到同一个分区
+type txnPartitionKey struct {
+	topic     string
+	partition int32
+}
+
+type txnPosition struct {
+	BinlogFileNum  int
+	BinlogPosition uint32
+	Gtid           string
+	EventID        uint64
+	Timestamp      uint32
+}
+
+func newTxnPosition(data *pluginDriver.PluginDataType) *txnPosition {
+	return &txnPosition{
+		BinlogFileNum:  data.BinlogFileNum,
+		BinlogPosition: data.BinlogPosition,
+		Gtid:           data.Gtid,
+		EventID:        data.EventID,
+		Timestamp:      data.Timestamp,
+	}
+}
+
+// data 是否在 已经提交的位点 之前(包括相等)
+// mysql 有 binlog 位点的情况下 按 binlog 位点比较，否则按 EventID 比较
+// postgres, mongo, kafka 等数据源 BinlogFileNum 固定为 1, BinlogPosition 为 0, 不是递增的位点, 不能用来比较
+// EventID 和 位点 一起保存, 重启之后 从保存的位点 重新解析的数据 EventID 和 之前的一样
+func (p *txnPosition) isCommitted(data *pluginDriver.PluginDataType) bool {
+	if p == nil || data == nil {
+		return false
+	}
+	if p.BinlogPosition > 0 && data.BinlogPosition > 0 {
+		if data.BinlogFileNum != p.BinlogFileNum {
+			return data.BinlogFileNum < p.BinlogFileNum
+		}
+		return data.BinlogPosition <= p.BinlogPosition
+	}
+	if p.EventID == 0 {
+		return false
+	}
+	return data.EventID <= p.EventID
+}
+
+type txnProducer struct {
+	client          sarama.Client
+	config          *sarama.Config
+	transactionalID string
+	offsetTopic     string
+	timeout         time.Duration
+
+	producerID    int64
+	producerEpoch int16
+	coordinator   *sarama.Broker
+	sequences     map[txnPartitionKey]int32
+	partitioners  map[string]sarama.Partitioner
+
+	lastCommitted *txnPosition
+}
+
+func newTxnProducer(config *Config, transactionalID, offsetTopic string, timeout time.Duration) (p *txnProducer, err error) {
+	cfg := config.ConnectConfig
+	if !cfg.Version.IsAtLeast(sarama.V0_11_0_0) {
+		return nil, fmt.Errorf("transactional producer requires kafka version >= 0.11.0.0")
+	}
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	cfg.Producer.Idempotent = true
+	cfg.Producer.RequiredAcks = sarama.WaitForAll
+	cfg.Net.MaxOpenRequests = 1
+	cfg.Consumer.IsolationLevel = sarama.ReadCommitted
+	p = &txnProducer{
+		config:          cfg,
+		transactionalID: transactionalID,
+		offsetTopic:     offsetTopic,
+		timeout:         timeout,
+		sequences:       make(map[txnPartitionKey]int32, 0),
+		partitioners:    make(map[string]sarama.Partitioner, 0),
+	}
+	if p.client, err = sarama.NewClient(config.BrokerServerList, cfg); err != nil {
+		return nil, err
+	}
+	if err = p.initProducerID(); err != nil {
+		p.Close()
+		return nil, err
+	}
+	// 先 InitProducerID 再读取位点，保证 之前未完成的事务 已经被中止
+	if p.lastCommitted, err = p.readLastCommitted(); err != nil {
+		p.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *txnProducer) Close() {
+	if p.client != nil {
+		p.client.Close()
+	}
+}
+
+func (p *txnProducer) findCoordinator() (*sarama.Broker, error) {
+	broker, err := p.client.Controller()
+	if err != nil {
+		return nil, err
+	}
+	request := &sarama.FindCoordinatorRequest{
+		Version:         1,
+		CoordinatorKey:  p.transactionalID,
+		CoordinatorType: sarama.CoordinatorTransaction,
+	}
+	for i := 0; i < 10; i++ {
+		response, err := broker.FindCoordinator(request)
+		if err != nil {
+			return nil, err
+		}
+		switch response.Err {
+		case sarama.ErrNoError:
+			coordinator := response.Coordinator
+			if err = coordinator.Open(p.config); err != nil && err != sarama.ErrAlreadyConnected {
+				return nil, err
+			}
+			return coordinator, nil
+		case sarama.ErrConsumerCoordinatorNotAvailable, sarama.ErrOffsetsLoadInProgress:
+			time.Sleep(500 * time.Millisecond)
+		default:
+			return nil, response.Err
+		}
+	}
+	return nil, fmt.Errorf("find transaction coordinator for %s timeout", p.transactionalID)
+}
+
+func (p *txnProducer) initProducerID() (err error) {
+	if p.coordinator, err = p.findCoordinator(); err != nil {
+		return err
+	}
+	request := &sarama.InitProducerIDRequest{
+		TransactionalID:    &p.transactionalID,
+		TransactionTimeout: p.timeout,
+	}
+	for i := 0; i < 10; i++ {
+		response, err := p.coordinator.InitProducerID(request)
+		if err != nil {
+			return err
+		}
+		switch response.Err {
+		case sarama.ErrNoError:
+			p.producerID = response.ProducerID
+			p.producerEpoch = response.ProducerEpoch
+			// 新的 epoch , 所有分区的 sequence 都从 0 开始
+			p.sequences = make(map[txnPartitionKey]int32, 0)
+			return nil
+		case sarama.ErrConcurrentTransactions, sarama.ErrOffsetsLoadInProgress:
+			// 上一个事务 还在中止中
+			time.Sleep(500 * time.Millisecond)
+		default:
+			return response.Err
+		}
+	}
+	return fmt.Errorf("init producer id for %s timeout", p.transactionalID)
+}
+
+// 从位点 topic 中读取最后一个 已提交 的位点
+// 从 最新的 offset 往前 按 窗口读取，直到找到 key 为 TransactionalId 的数据
+func (p *txnProducer) readLastCommitted() (*txnPosition, error) {
+	partition, err := p.getPartition(p.offsetTopic, sarama.StringEncoder(p.transactionalID))
+	if err != nil {
+		if err == sarama.ErrUnknownTopicOrPartition {
+			return nil, nil
+		}
+		return nil, err
+	}
+	oldest, err := p.client.GetOffset(p.offsetTopic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return nil, err
+	}
+	end, err := p.client.GetOffset(p.offsetTopic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return nil, err
+	}
+	consumer, err := sarama.NewConsumerFromClient(p.client)
+	if err != nil {
+		return nil, err
+	}
+	defer consumer.Close()
+	const window int64 = 1000
+	for end > oldest {
+		start := end - window
+		if start < oldest {
+			start = oldest
+		}
+		position, err := p.readWindow(consumer, partition, start, end)
+		if err != nil || position != nil {
+			return position, err
+		}
+		end = start
+	}
+	return nil, nil
+}
+
+func (p *txnProducer) readWindow(consumer sarama.Consumer, partition int32, start, end int64) (position *txnPosition, err error) {
+	pc, err := consumer.ConsumePartition(p.offsetTopic, partition, start)
+	if err != nil {
+		return nil, err
+	}
+	defer pc.Close()
+	// read_committed 模式下，事务的 control 记录 不会返回，所以读到最后 通过超时 判断是否读完了
+	timer := time.NewTimer(3 * time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case msg := <-pc.Messages():
+			if string(msg.Key) == p.transactionalID {
+				var v txnPosition
+				if err = json.Unmarshal(msg.Value, &v); err != nil {
+					return nil, err
+				}
+				position = &v
+			}
+			if msg.Offset >= end-1 {
+				return position, nil
+			}
+			timer.Reset(3 * time.Second)
+		case consumerErr := <-pc.Errors():
+			return nil, consumerErr.Err
+		case <-timer.C:
+			return position, nil
+		}
+	}
+}
+
+func (p *txnProducer) getPartition(topic string, key sarama.Encoder) (int32, error) {
+	partitions, err := p.client.Partitions(topic)
+	if err != nil {
+		return 0, err
+	}
+	if len(partitions) == 0 {
+		return 0, sarama.ErrUnknownTopicOrPartition
+	}
+	partitioner, ok := p.partitioners[topic]
+	if !ok {
+		partitioner = sarama.NewHashPartitioner(topic)
+		p.partitioners[topic] = partitioner
+	}
+	n, err := partitioner.Partition(&sarama.ProducerMessage{Topic: topic, Key: key}, int32(len(partitions)))
+	if err != nil {
+		return 0, err
+	}
+	return partitions[n], nil
+}
+
+// 在一个事务里 写入 数据 及 位点, 任何一步出错 都会中止事务
+// 出错后 这个 txnProducer 不能再使用，需要重新创建
+func (p *txnProducer) SendMessagesWithPosition(list []*sarama.ProducerMessage, position *txnPosition) (err error) {
+	if position != nil {
+		b, err := json.Marshal(position)
+		if err != nil {
+			return err
+		}
+		list = append(list, &sarama.ProducerMessage{
+			Topic: p.offsetTopic,
+			Key:   sarama.StringEncoder(p.transactionalID),
+			Value: sarama.ByteEncoder(b),
+		})
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	records := make(map[txnPartitionKey][]*sarama.Record, 0)
+	topicPartitions := make(map[string][]int32, 0)
+	for _, msg := range list {
+		partition, err := p.getPartition(msg.Topic, msg.Key)
+		if err != nil {
+			return err
+		}
+		record, err := newTxnRecord(msg)
+		if err != nil {
+			return err
+		}
+		key := txnPartitionKey{topic: msg.Topic, partition: partition}
+		if _, ok := records[key]; !ok {
+			topicPartitions[msg.Topic] = append(topicPartitions[msg.Topic], partition)
+		}
+		record.OffsetDelta = int64(len(records[key]))
+		records[key] = append(records[key], record)
+	}
+	defer func() {
+		if err != nil {
+			p.endTxn(false)
+		}
+	}()
+	if err = p.addPartitionsToTxn(topicPartitions); err != nil {
+		return err
+	}
+	if err = p.produce(records); err != nil {
+		return err
+	}
+	if err = p.endTxn(true); err != nil {
+		return err
+	}
+	if position != nil {
+		p.lastCommitted = position
+	}
+	return nil
+}
+
+func newTxnRecord(msg *sarama.ProducerMessage) (record *sarama.Record, err error) {
+	record = &sarama.Record{}
+	if msg.Key != nil {
+		if record.Key, err = msg.Key.Encode(); err != nil {
+			return nil, err
+		}
+	}
+	if msg.Value != nil {
+		if record.Value, err = msg.Value.Encode(); err != nil {
+			return nil, err
+		}
+	}
+	for i := range msg.Headers {
+		record.Headers = append(record.Headers, &msg.Headers[i])
+	}
+	return record, nil
+}
+
+func (p *txnProducer) addPartitionsToTxn(topicPartitions map[string][]int32) error {
+	request := &sarama.AddPartitionsToTxnRequest{
+		TransactionalID: p.transactionalID,
+		ProducerID:      p.producerID,
+		ProducerEpoch:   p.producerEpoch,
+		TopicPartitions: topicPartitions,
+	}
+	for i := 0; i < 10; i++ {
+		response, err := p.coordinator.AddPartitionsToTxn(request)
+		if err != nil {
+			return err
+		}
+		var retry bool
+		for topic, partitionErrors := range response.Errors {
+			for _, partitionErr := range partitionErrors {
+				switch partitionErr.Err {
+				case sarama.ErrNoError:
+				case sarama.ErrConcurrentTransactions, sarama.ErrOffsetsLoadInProgress:
+					retry = true
+				default:
+					return fmt.Errorf("add partition %s-%d to transaction err:%s", topic, partitionErr.Partition, partitionErr.Err)
+				}
+			}
+		}
+		if !retry {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("add partitions to transaction %s timeout", p.transactionalID)
+}
+
+func (p *txnProducer) produce(records map[txnPartitionKey][]*sarama.Record) error {
+	requests := make(map[*sarama.Broker]*sarama.ProduceRequest, 0)
+	for key, list := range records {
+		broker, err := p.client.Leader(key.topic, key.partition)
+		if err != nil {
+			return err
+		}
+		request, ok := requests[broker]
+		if !ok {
+			request = &sarama.ProduceRequest{
+				TransactionalID: &p.transactionalID,
+				RequiredAcks:    sarama.WaitForAll,
+				Timeout:         int32(p.config.Producer.Timeout / time.Millisecond),
+				Version:         3,
+			}
+			requests[broker] = request
+		}
+		now := time.Now()
+		request.AddBatch(key.topic, key.partition, &sarama.RecordBatch{
+			Version:         2,
+			FirstTimestamp:  now,
+			MaxTimestamp:    now,
+			LastOffsetDelta: int32(len(list) - 1),
+			ProducerID:      p.producerID,
+			ProducerEpoch:   p.producerEpoch,
+			FirstSequence:   p.sequences[key],
+			IsTransactional: true,
+			Records:         list,
+		})
+	}
+	for broker, request := range requests {
+		response, err := broker.Produce(request)
+		if err != nil {
+			return err
+		}
+		for key, list := range records {
+			block := response.GetBlock(key.topic, key.partition)
+			if block == nil {
+				continue
+			}
+			if block.Err != sarama.ErrNoError {
+				return fmt.Errorf("produce %s-%d err:%s", key.topic, key.partition, block.Err)
+			}
+			p.sequences[key] += int32(len(list))
+		}
+	}
+	return nil
+}
+
+func (p *txnProducer) endTxn(commit bool) error {
+	response, err := p.coordinator.EndTxn(&sarama.EndTxnRequest{
+		TransactionalID:   p.transactionalID,
+		ProducerID:        p.producerID,
+		ProducerEpoch:     p.producerEpoch,
+		TransactionResult: commit,
+	})
+	if err != nil {
+		return err
+	}
+	if response.Err != sarama.ErrNoError {
+		if !commit {
+			log.Println("kafka plugin abort transaction", p.transactionalID, "err:", response.Err)
+		}
+		return response.Err
+	}
+	return nil
+}
+
+func (This *Conn) getTxnProducer() (*txnProducer, error) {
+	if This.p.txnProducer != nil {
+		return This.p.txnProducer, nil
+	}
+	config, err := getKafkaConnectConfig(ParseDSN(*This.Uri))
+	if err != nil {
+		return nil, err
+	}
+	config.ConnectConfig.Producer.Timeout = time.Duration(This.p.Timeout) * time.Second
+	txn, err := newTxnProducer(config, This.p.TransactionalId, This.p.TransactionOffsetTopic, 0)
+	if err != nil {
+		return nil, err
+	}
+	This.p.txnProducer = txn
+	return txn, nil
+}
+
+func (This *Conn) closeTxnProducer() {
+	if This.p.txnProducer != nil {
+		This.p.txnProducer.Close()
+		This.p.txnProducer = nil
+	}
+}
+
+// 事务模式下，只有在 commit 事件 的边界 才提交事务，保证同一个数据库事务的数据 要么全部写入，要么全部不写入
+// 出错的情况下，不管 BifrostMustBeSuccess 怎么配置，都返回错误，由 Bifrost 重试
+func (This *Conn) sendToListByTxn(data *pluginDriver.PluginDataType, retry bool, isCommit bool) (LastSuccessCommitData *pluginDriver.PluginDataType, Errdata *pluginDriver.PluginDataType, err error) {
+	txn, err := This.getTxnProducer()
+	if err != nil {
+		return nil, data, err
+	}
+	if data != nil && !retry {
+		// 已经在上一次运行中 提交到 kafka 了, 但 Bifrost 的位点 没有来得及保存
+		if txn.lastCommitted.isCommitted(data) {
+			if isCommit && len(This.p.dataList) == 0 {
+				return data, nil, nil
+			}
+			return nil, nil, nil
+		}
+		if !isCommit || !This.p.BifrostFilterQuery {
+			var msg *sarama.ProducerMessage
+			msg, err = This.getMsg(data)
+			if err != nil {
+				return nil, data, err
+			}
+			This.p.dataList = append(This.p.dataList, msg)
+		}
+		if isCommit {
+			This.p.txnCommitIndex = len(This.p.dataList)
+			This.p.txnCommitData = data
+		}
+	}
+	if This.p.txnCommitData == nil {
+		return nil, nil, nil
+	}
+	// data == nil 为 超时提交
+	if data != nil && This.p.txnCommitIndex < This.p.BatchSize {
+		return nil, nil, nil
+	}
+	commitData := This.p.txnCommitData
+	// 上一次提交 实际上成功了，只是返回结果的时候出错了，重新初始化后 读取到的位点 已经包含这一批数据了
+	if !txn.lastCommitted.isCommitted(commitData) {
+		err = txn.SendMessagesWithPosition(This.p.dataList[:This.p.txnCommitIndex], newTxnPosition(commitData))
+		if err != nil {
+			This.closeTxnProducer()
+			return nil, data, err
+		}
+	}
+	This.p.dataList = This.p.dataList[This.p.txnCommitIndex:]
+	This.p.txnCommitIndex = 0
+	This.p.txnCommitData = nil
+	return commitData, nil, nil
+}
@@ -0,0 +1,70 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package src
+
+import (
+	"github.com/Shopify/sarama"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"testing"
+)
+
+func TestTxnPosition_IsCommitted(t *testing.T) {
+	var p *txnPosition
+	if p.isCommitted(&pluginDriver.PluginDataType{BinlogFileNum: 1, BinlogPosition: 100}) {
+		t.Fatal("nil position must be not committed")
+	}
+	p = newTxnPosition(&pluginDriver.PluginDataType{BinlogFileNum: 2, BinlogPosition: 100})
+	if !p.isCommitted(&pluginDriver.PluginDataType{BinlogFileNum: 1, BinlogPosition: 1000}) {
+		t.Fatal("1:1000 must be committed")
+	}
+	if !p.isCommitted(&pluginDriver.PluginDataType{BinlogFileNum: 2, BinlogPosition: 100}) {
+		t.Fatal("2:100 must be committed")
+	}
+	if p.isCommitted(&pluginDriver.PluginDataType{BinlogFileNum: 2, BinlogPosition: 101}) {
+		t.Fatal("2:101 must be not committed")
+	}
+
+	p = newTxnPosition(&pluginDriver.PluginDataType{EventID: 10})
+	if !p.isCommitted(&pluginDriver.PluginDataType{EventID: 10}) || p.isCommitted(&pluginDriver.PluginDataType{EventID: 11}) {
+		t.Fatal("EventID compare error")
+	}
+
+	// postgres, mongo, kafka 数据源 位点 固定为 1:0, 按 EventID 比较
+	p = newTxnPosition(&pluginDriver.PluginDataType{BinlogFileNum: 1, BinlogPosition: 0, EventID: 10})
+	if !p.isCommitted(&pluginDriver.PluginDataType{BinlogFileNum: 1, BinlogPosition: 0, EventID: 9}) {
+		t.Fatal("1:0 EventID 9 must be committed")
+	}
+	if p.isCommitted(&pluginDriver.PluginDataType{BinlogFileNum: 1, BinlogPosition: 0, EventID: 11}) {
+		t.Fatal("1:0 EventID 11 must be not committed")
+	}
+}
+
+func TestConn_GetParam_Transactional(t *testing.T) {
+	c := &Conn{}
+	_, err := c.GetParam(map[string]interface{}{"Topic": "t1", "Transactional": true})
+	if err == nil {
+		t.Fatal("TransactionalId is required")
+	}
+	p, err := c.GetParam(map[string]interface{}{"Topic": "t1", "Transactional": true, "TransactionalId": "bifrost-t1", "RequiredAcks": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	param := p.(*PluginParam)
+	if !param.Idempotent || param.RequiredAcks != sarama.WaitForAll || param.TransactionOffsetTopic != defaultTransactionOffsetTopic {
+		t.Fatal("transactional param default error", param)
+	}
+}
@@ -8,6 +8,9 @@ function doGetPluginParam(){
     var Timeout = $("#Kafka_Timeout").val();
     var RequiredAcks = $("#Kafka_RequiredAcks").val();
     var OtherObjectType = $("#Kafka_OtherObjectType").val();
+    var Transactional = $("#Kafka_Transactional").val();
+    var TransactionalId = $("#Kafka_TransactionalId").val();
+    var TransactionOffsetTopic = $("#Kafka_TransactionOffsetTopic").val();
 	
     if (Topic == ""){
 		result.msg = "Topic can't be empty"
@@ -26,6 +29,10 @@ function doGetPluginParam(){
         result.msg = "RequiredAcks must be -1 | 0 | 1 !";
         return result;
 	}
+    if (Transactional == "true" && TransactionalId == ""){
+        result.msg = "TransactionalId can't be empty when Transactional is true";
+        return result;
+    }
 
 	data["Topic"] = Topic;
 	data["Key"] = Key;
@@ -33,6 +40,10 @@ function doGetPluginParam(){
     data["Timeout"] = parseInt(Timeout);
     data["RequiredAcks"] = parseInt(RequiredAcks);
     data["OtherObjectType"] = OtherObjectType;
+    data["Idempotent"] = Transactional != "false";
+    data["Transactional"] = Transactional == "true";
+    data["TransactionalId"] = TransactionalId;
+    data["TransactionOffsetTopic"] = TransactionOffsetTopic;
 
 	result.data = data;
 	result.msg = "success";
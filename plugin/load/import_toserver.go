@@ -13,6 +13,7 @@ import (
 	_ "github.com/brokercap/Bifrost/plugin/kafka/src"
 	_ "github.com/brokercap/Bifrost/plugin/memcache/src"
 	_ "github.com/brokercap/Bifrost/plugin/mysql/src"
+	_ "github.com/brokercap/Bifrost/plugin/pulsar/src"
 	_ "github.com/brokercap/Bifrost/plugin/rabbitmq/src"
 	_ "github.com/brokercap/Bifrost/plugin/redis/src"
 )
@@ -22,3 +22,14 @@ const (
 const BifrostAutoInrcFieldName = "bifrost_auto_inrc_id"
 
 const OutputName = "mysql"
+
+type ConflictPolicy string
+
+const (
+	CONFLICT_POLICY_SOURCE_WINS ConflictPolicy = "SourceWins" // 以源端数据为准, 只统计冲突数量
+	CONFLICT_POLICY_TARGET_WINS ConflictPolicy = "TargetWins" // 以目标表数据为准, 冲突的数据不同步
+	CONFLICT_POLICY_NEWEST_WINS ConflictPolicy = "NewestWins" // ConflictTimeField 字段值 大的为准
+	CONFLICT_POLICY_ERROR_TABLE ConflictPolicy = "ErrorTable" // 冲突的数据不同步, 写到 ConflictErrorTable 表中
+)
+
+const DefaultConflictErrorTable = "bifrost_conflict"
@@ -49,6 +49,7 @@ type Conn struct {
 	isTiDB           bool
 	isStarRocks      bool
 	starRocksBeCount int
+	parallelConnList []*Conn // 并行回放的连接
 }
 
 type PluginParam struct {
@@ -58,7 +59,12 @@ type PluginParam struct {
 	Table                string
 	NullTransferDefault  bool //是否将null值强制转成相对应类型的默认值
 	SyncMode             SyncMode
-	BifrostMustBeSuccess bool // bifrost server 保留,数据是否能丢
+	BifrostMustBeSuccess bool           // bifrost server 保留,数据是否能丢
+	ParallelCount        int            // 并行回放的连接数, 大于 1 的时候 按主键划分依赖关系 并发执行, 只支持 Normal 模式
+	ConflictPolicy       ConflictPolicy // 冲突处理策略, 为空的时候 不检测冲突, 只支持 Normal 模式
+	ConflictTimeField    string         // NewestWins 策略下, 比较新旧的 目标表字段
+	ConflictErrorTable   string         // ErrorTable 策略下, 冲突数据写入的表, 默认为 目标库的 bifrost_conflict
+	LoopMarkerTable      string         // 双向同步 防回环 的标记表, 每个事务中 先更新这个表, 为空的时候 不更新
 
 	schemaAndTable string
 	replaceInto    bool // 记录当前表是否有replace into操作
@@ -72,6 +78,9 @@ type PluginParam struct {
 	AutoTable      bool                     // 是否自动匹配数据表
 	stmtArr        []dbDriver.Stmt
 	SkipBinlogData *pluginDriver.PluginDataType // 在执行 skip 的时候 ，进行传入进来的时候需要要过滤的 位点，在每次commit之后，这个数据会被清空
+
+	parallelParamList []*PluginParam    // 并行回放的连接 使用的参数
+	conflictCount     map[string]uint64 // 上一次 GetConflictCount 之后 检测到的冲突数量
 }
 
 type PluginParam0 struct {
@@ -133,6 +142,8 @@ func (This *Conn) initTableInfo() {
 		This.p.tableMap = make(map[string]*PluginParam0, 0)
 		This.initToDatabaseMap()
 	}
+	This.initConflictErrorTable()
+	This.initLoopMarkerTable()
 }
 
 func (This *Conn) GetParam(p interface{}) (*PluginParam, error) {
@@ -163,12 +174,18 @@ func (This *Conn) GetParam(p interface{}) (*PluginParam, error) {
 	}
 
 	This.p = &param
-	This.initTableInfo()
 	This.initVersion()
 	if !This.isTiDB {
 		// 假如是TiDB,则说明肯定不是starrocks
 		This.initIsStarrock()
 	}
+	if err := This.checkConflictParam(); err != nil {
+		return nil, err
+	}
+	if err := This.checkLoopMarkerParam(); err != nil {
+		return nil, err
+	}
+	This.initTableInfo()
 	return This.p, nil
 }
 
@@ -282,7 +299,7 @@ func (This *Conn) CreateTableAndGetTableFieldsType(data *pluginDriver.PluginData
 		}
 	}
 
-	err = This.conn.Exec(createTableSql)
+	err = This.conn.Exec(This.loopMarkerQuery(createTableSql))
 	if err != nil {
 		return nil, err
 	}
@@ -466,6 +483,7 @@ func (This *Conn) StmtClose() {
 }
 
 func (This *Conn) Close() bool {
+	This.closeParallelConn()
 	if This.conn != nil {
 		func() {
 			defer func() {
@@ -542,7 +560,7 @@ func (This *Conn) Query(data *pluginDriver.PluginDataType, retry bool) (LastSucc
 				if newSql == "" {
 					continue
 				}
-				_, This.conn.err = This.conn.conn.Exec(newSql, []dbDriver.Value{})
+				_, This.conn.err = This.conn.conn.Exec(This.loopMarkerQuery(newSql), []dbDriver.Value{})
 				if This.conn.err != nil {
 					log.Printf("plugin mysql, exec sql:%s err:%s", newSql, This.conn.err)
 					return nil, data, This.conn.err
@@ -640,7 +658,9 @@ func (This *Conn) AutoCommit() (LastSuccessCommitData *pluginDriver.PluginDataTy
 		n = This.p.BatchSize
 	}
 	list := This.p.Data.Data[:n]
-	if This.p.AutoTable {
+	if This.isParallelCommit() {
+		ErrData, e = This.ParallelCommit(list)
+	} else if This.p.AutoTable {
 		ErrData, e = This.AutoTableCommit(list)
 	} else {
 		ErrData, e = This.NotAutoTableCommit(list)
@@ -668,7 +688,7 @@ func (This *Conn) AutoCommit() (LastSuccessCommitData *pluginDriver.PluginDataTy
 }
 
 func (This *Conn) NotAutoTableCommit(list []*pluginDriver.PluginDataType) (ErrData *pluginDriver.PluginDataType, e error) {
-	This.conn.err = This.conn.Begin()
+	This.conn.err = This.begin()
 	if This.conn.err != nil {
 		return nil, This.conn.err
 	}
@@ -717,7 +737,7 @@ func (This *Conn) AutoTableCommit(list []*pluginDriver.PluginDataType) (ErrData
 		This.p.PriKey = p.PriKey
 		This.p.toPriKey = p.ToPriKey
 		This.p.fromPriKey = p.FromPriKey
-		This.conn.err = This.conn.Begin()
+		This.conn.err = This.begin()
 		if This.conn.err != nil {
 			This.err = This.conn.err
 			break
@@ -744,6 +764,12 @@ func (This *Conn) AutoTableCommit(list []*pluginDriver.PluginDataType) (ErrData
 func (This *Conn) commitData(list []*pluginDriver.PluginDataType) (ErrData *pluginDriver.PluginDataType) {
 	switch This.p.SyncMode {
 	case SYNCMODE_NORMAL:
+		if This.p.ConflictPolicy != "" {
+			list, ErrData = This.resolveConflict(list)
+			if This.err != nil || This.conn.err != nil {
+				return
+			}
+		}
 		if This.IsStarRocks() {
 			ErrData = This.StarRocksCommitNormal(list)
 		} else {
@@ -0,0 +1,309 @@
+/*
+冲突检测, 只有 普通模式(Normal) 支持
+配置了 ConflictPolicy 的时候, 每条数据同步之前 先按主键查询目标表, 检测以下冲突
+
+	insert 的数据 在目标表中已经存在
+	update,delete 的数据 在目标表中不存在
+	update,delete 的 before 数据 和目标表中的数据不一致 (binlog 中存在的 并且 有同步的字段, 在目标库中用 <=> 比较)
+
+冲突按 ConflictPolicy 处理, 冲突数量 通过 GetConflictCount 提交到 ToServer 上
+
+同一批数据中, 一个主键 只和目标表比较第一次出现的数据, 后面的数据 和第一条数据的处理方式一样
+第一条数据没有同步的时候, 后面的数据是基于 目标表中没有的数据 变更的, 所以也不同步
+*/
+package src
+
+import (
+	dbDriver "database/sql/driver"
+	"encoding/json"
+	"fmt"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"log"
+	"strings"
+)
+
+func (This *Conn) checkConflictParam() error {
+	switch This.p.ConflictPolicy {
+	case "":
+		return nil
+	case CONFLICT_POLICY_SOURCE_WINS, CONFLICT_POLICY_TARGET_WINS:
+	case CONFLICT_POLICY_NEWEST_WINS:
+		if This.p.ConflictTimeField == "" {
+			return fmt.Errorf("ConflictPolicy:%s ConflictTimeField is empty", This.p.ConflictPolicy)
+		}
+	case CONFLICT_POLICY_ERROR_TABLE:
+		if This.IsStarRocks() {
+			return fmt.Errorf("ConflictPolicy:%s not supported StarRocks", This.p.ConflictPolicy)
+		}
+		if This.p.ConflictErrorTable == "" {
+			This.p.ConflictErrorTable = DefaultConflictErrorTable
+		}
+		if !strings.Contains(This.p.ConflictErrorTable, ".") {
+			if This.p.Schema == "" {
+				return fmt.Errorf("ConflictPolicy:%s ConflictErrorTable must be schema.table when Table is empty", This.p.ConflictPolicy)
+			}
+			This.p.ConflictErrorTable = This.p.Schema + "." + This.p.ConflictErrorTable
+		}
+	default:
+		return fmt.Errorf("ConflictPolicy:%s not supported", This.p.ConflictPolicy)
+	}
+	if This.p.SyncMode != SYNCMODE_NORMAL {
+		return fmt.Errorf("ConflictPolicy only supported SyncMode:%s", SYNCMODE_NORMAL)
+	}
+	return nil
+}
+
+func (This *Conn) getConflictErrorTable() string {
+	i := strings.Index(This.p.ConflictErrorTable, ".")
+	return fmt.Sprintf("`%s`.`%s`", This.p.ConflictErrorTable[:i], This.p.ConflictErrorTable[i+1:])
+}
+
+// 建表是 DDL, 会隐式提交事务, 所以在 GetParam 和 重连 的时候创建
+func (This *Conn) initConflictErrorTable() {
+	if This.p.ConflictPolicy != CONFLICT_POLICY_ERROR_TABLE || This.conn == nil || This.conn.err != nil {
+		return
+	}
+	schemaName := This.p.ConflictErrorTable[:strings.Index(This.p.ConflictErrorTable, ".")]
+	_ = This.conn.CreateDatabase(schemaName)
+	sql := "CREATE TABLE IF NOT EXISTS " + This.getConflictErrorTable() + " (" +
+		"`id` bigint unsigned NOT NULL AUTO_INCREMENT," +
+		"`schema_name` varchar(200) NOT NULL DEFAULT ''," +
+		"`table_name` varchar(200) NOT NULL DEFAULT ''," +
+		"`event_type` varchar(20) NOT NULL DEFAULT ''," +
+		"`conflict_type` varchar(50) NOT NULL DEFAULT ''," +
+		"`data` longtext," +
+		"`binlog_file_num` int NOT NULL DEFAULT 0," +
+		"`binlog_position` int unsigned NOT NULL DEFAULT 0," +
+		"`gtid` varchar(500) NOT NULL DEFAULT ''," +
+		"`create_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP," +
+		"PRIMARY KEY (`id`)" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	if err := This.conn.Exec(sql); err != nil {
+		log.Printf("[ERROR] output[%s] create conflict error table:%s err:%+v \n", OutputName, This.p.ConflictErrorTable, err)
+	}
+}
+
+// 返回上一次调用之后 新增的冲突数量, 包括并行回放的连接
+func (This *Conn) GetConflictCount() map[string]uint64 {
+	if This.p == nil {
+		return nil
+	}
+	var conflictCount map[string]uint64
+	for _, p := range append([]*PluginParam{This.p}, This.p.parallelParamList...) {
+		for conflictType, n := range p.conflictCount {
+			if conflictCount == nil {
+				conflictCount = make(map[string]uint64, len(p.conflictCount))
+			}
+			conflictCount[conflictType] += n
+		}
+		p.conflictCount = nil
+	}
+	return conflictCount
+}
+
+func (This *Conn) addConflictCount(conflictType string) {
+	if This.p.conflictCount == nil {
+		This.p.conflictCount = make(map[string]uint64, 0)
+	}
+	This.p.conflictCount[conflictType]++
+}
+
+// 过滤掉 按冲突策略 不需要同步的数据, 出错的时候 This.err 或者 This.conn.err 不为 nil
+func (This *Conn) resolveConflict(list []*pluginDriver.PluginDataType) (newList []*pluginDriver.PluginDataType, errData *pluginDriver.PluginDataType) {
+	This.err = nil
+	if len(This.p.PriKey) == 0 {
+		return list, nil
+	}
+	// 主键 => 是否同步
+	keyMap := make(map[string]bool, 0)
+	newList = make([]*pluginDriver.PluginDataType, 0, len(list))
+LOOP:
+	for _, data := range list {
+		keyList, err := This.getConflictKeyList(data)
+		if err != nil {
+			This.err = err
+			if !This.p.BifrostMustBeSuccess || This.CheckDataSkip(data) {
+				This.err = nil
+				continue
+			}
+			return nil, data
+		}
+		isApply, checked := true, true
+		for _, key := range keyList {
+			apply, ok := keyMap[key]
+			if !ok {
+				checked = false
+				continue
+			}
+			isApply = isApply && apply
+		}
+		if !checked && isApply {
+			var conflictType string
+			var targetNewer bool
+			conflictType, targetNewer, This.err = This.checkConflict(data)
+			if This.err != nil {
+				if This.CheckDataSkip(data) {
+					This.err, This.conn.err = nil, nil
+					continue LOOP
+				}
+				return nil, data
+			}
+			if conflictType != "" {
+				This.addConflictCount(conflictType)
+				isApply, This.err = This.resolveConflictData(data, conflictType, targetNewer)
+				if This.err != nil {
+					return nil, data
+				}
+			}
+		}
+		for _, key := range keyList {
+			keyMap[key] = isApply
+		}
+		if isApply {
+			newList = append(newList, data)
+		}
+	}
+	return
+}
+
+// 按冲突策略处理, 返回 是否同步到目标表
+func (This *Conn) resolveConflictData(data *pluginDriver.PluginDataType, conflictType string, targetNewer bool) (bool, error) {
+	switch This.p.ConflictPolicy {
+	case CONFLICT_POLICY_TARGET_WINS:
+		return false, nil
+	case CONFLICT_POLICY_NEWEST_WINS:
+		return !targetNewer, nil
+	case CONFLICT_POLICY_ERROR_TABLE:
+		return false, This.insertConflictErrorTable(data, conflictType)
+	default:
+		return true, nil
+	}
+}
+
+// 数据涉及到的主键, update 修改了主键的时候 前后两个主键
+func (This *Conn) getConflictKeyList(data *pluginDriver.PluginDataType) (keyList []string, err error) {
+	for i := range data.Rows {
+		if data.EventType == "update" && i%2 == 1 && data.IsColumnAbsent(i, This.p.PriKey[0].FromMysqlField) {
+			continue
+		}
+		var val []dbDriver.Value
+		if val, err = This.getFieldsValue(data, i, This.p.PriKey); err != nil {
+			return nil, err
+		}
+		keyList = append(keyList, fmt.Sprint(val))
+	}
+	return
+}
+
+// 查询目标表中的数据, 返回冲突类型, 为空的时候 没有冲突
+// targetNewer 为 目标表中 ConflictTimeField 字段值 是否比源端数据大
+func (This *Conn) checkConflict(data *pluginDriver.PluginDataType) (conflictType string, targetNewer bool, err error) {
+	// insert 比较 after 数据, delete 比较 before 数据, update 按 before 查询, 按 after 比较时间
+	var index, timeIndex int
+	var compareFields []fieldStruct
+	switch data.EventType {
+	case "insert":
+	case "update":
+		timeIndex = 1
+		compareFields = This.getConflictCompareFields(data, 0)
+	case "delete":
+		compareFields = This.getConflictCompareFields(data, 0)
+	default:
+		return
+	}
+	var val []dbDriver.Value
+	matchSql := "1"
+	if len(compareFields) > 0 {
+		matchSql = "(" + joinFields(compareFields, "`%s`<=>?", " AND ") + ")"
+		if val, err = This.getFieldsValue(data, index, compareFields); err != nil {
+			return
+		}
+	}
+	newerSql := "0"
+	if This.p.ConflictPolicy == CONFLICT_POLICY_NEWEST_WINS {
+		var timeField []fieldStruct
+		for _, v := range This.p.Field {
+			if v.ToField == This.p.ConflictTimeField {
+				timeField = append(timeField, v)
+				break
+			}
+		}
+		if len(timeField) == 0 || data.IsColumnAbsent(timeIndex, timeField[0].FromMysqlField) {
+			err = fmt.Errorf("%s ConflictTimeField:%s not found", This.p.schemaAndTable, This.p.ConflictTimeField)
+			return
+		}
+		var timeVal []dbDriver.Value
+		if timeVal, err = This.getFieldsValue(data, timeIndex, timeField); err != nil {
+			return
+		}
+		newerSql = fmt.Sprintf("`%s`>?", This.p.ConflictTimeField)
+		val = append(val, timeVal...)
+	}
+	var where []dbDriver.Value
+	if where, err = This.getFieldsValue(data, index, This.p.PriKey); err != nil {
+		return
+	}
+	val = append(val, where...)
+	sql := "SELECT " + matchSql + "," + newerSql + " FROM " + This.p.schemaAndTable + " WHERE " + joinFields(This.p.PriKey, "`%s`=?", " AND ")
+	// 在同一个事务中 锁住这条数据, 直到数据写入
+	if !This.IsStarRocks() {
+		sql += " FOR UPDATE"
+	}
+	var rows dbDriver.Rows
+	rows, err = This.conn.conn.Query(sql, val)
+	if err != nil {
+		This.conn.err = err
+		log.Printf("[ERROR] output[%s] checkConflict sql:%s err:%+v \n", OutputName, sql, err)
+		return
+	}
+	defer rows.Close()
+	dest := make([]dbDriver.Value, 2)
+	exists := rows.Next(dest) == nil
+	switch {
+	case data.EventType == "insert" && exists:
+		conflictType = pluginDriver.CONFLICT_INSERT_EXISTS
+	case data.EventType == "update" && !exists:
+		conflictType = pluginDriver.CONFLICT_UPDATE_MISSING
+	case data.EventType == "delete" && !exists:
+		conflictType = pluginDriver.CONFLICT_DELETE_MISSING
+	case data.EventType != "insert" && !isConflictTrue(dest[0]):
+		conflictType = pluginDriver.CONFLICT_BEFORE_MISMATCH
+	}
+	targetNewer = exists && isConflictTrue(dest[1])
+	return
+}
+
+// before 数据中 需要和目标表比较的字段, 不包括 {$EventType} 之类的标签 和 binlog 中不存在的字段
+func (This *Conn) getConflictCompareFields(data *pluginDriver.PluginDataType, index int) []fieldStruct {
+	fields := make([]fieldStruct, 0, len(This.p.Field))
+	for _, v := range This.getPresentFields(data, index) {
+		if _, ok := data.Rows[index][v.FromMysqlField]; !ok {
+			continue
+		}
+		fields = append(fields, v)
+	}
+	return fields
+}
+
+func isConflictTrue(v dbDriver.Value) bool {
+	switch v.(type) {
+	case []byte:
+		return string(v.([]byte)) == "1"
+	default:
+		return fmt.Sprint(v) == "1"
+	}
+}
+
+func (This *Conn) insertConflictErrorTable(data *pluginDriver.PluginDataType, conflictType string) error {
+	b, err := json.Marshal(data.Rows)
+	if err != nil {
+		return err
+	}
+	sql := "INSERT INTO " + This.getConflictErrorTable() + " (`schema_name`,`table_name`,`event_type`,`conflict_type`,`data`,`binlog_file_num`,`binlog_position`,`gtid`) VALUES (?,?,?,?,?,?,?,?)"
+	val := []dbDriver.Value{data.SchemaName, data.TableName, data.EventType, conflictType, string(b), int64(data.BinlogFileNum), int64(data.BinlogPosition), data.Gtid}
+	_, This.conn.err = This.conn.conn.Exec(sql, val)
+	if This.conn.err != nil {
+		log.Printf("[ERROR] output[%s] insert conflict error table:%s err:%+v \n", OutputName, This.p.ConflictErrorTable, This.conn.err)
+	}
+	return This.conn.err
+}
@@ -0,0 +1,83 @@
+package src
+
+import (
+	"testing"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConn_checkConflictParam(t *testing.T) {
+	Convey("error table default name", t, func() {
+		conn := &Conn{p: &PluginParam{Schema: "bifrost_test", Table: "t1", SyncMode: SYNCMODE_NORMAL, ConflictPolicy: CONFLICT_POLICY_ERROR_TABLE}}
+		So(conn.checkConflictParam(), ShouldBeNil)
+		So(conn.p.ConflictErrorTable, ShouldEqual, "bifrost_test.bifrost_conflict")
+		So(conn.getConflictErrorTable(), ShouldEqual, "`bifrost_test`.`bifrost_conflict`")
+	})
+
+	Convey("error table must have schema when auto table", t, func() {
+		conn := &Conn{p: &PluginParam{SyncMode: SYNCMODE_NORMAL, ConflictPolicy: CONFLICT_POLICY_ERROR_TABLE}}
+		So(conn.checkConflictParam(), ShouldNotBeNil)
+	})
+
+	Convey("newest wins without time field", t, func() {
+		conn := &Conn{p: &PluginParam{SyncMode: SYNCMODE_NORMAL, ConflictPolicy: CONFLICT_POLICY_NEWEST_WINS}}
+		So(conn.checkConflictParam(), ShouldNotBeNil)
+		conn.p.ConflictTimeField = "update_time"
+		So(conn.checkConflictParam(), ShouldBeNil)
+	})
+
+	Convey("only normal sync mode", t, func() {
+		conn := &Conn{p: &PluginParam{SyncMode: SYNCMODE_LOG_APPEND, ConflictPolicy: CONFLICT_POLICY_SOURCE_WINS}}
+		So(conn.checkConflictParam(), ShouldNotBeNil)
+	})
+
+	Convey("not supported policy", t, func() {
+		conn := &Conn{p: &PluginParam{SyncMode: SYNCMODE_NORMAL, ConflictPolicy: "LastWins"}}
+		So(conn.checkConflictParam(), ShouldNotBeNil)
+	})
+}
+
+func TestConn_resolveConflictData(t *testing.T) {
+	data := &pluginDriver.PluginDataType{EventType: "update"}
+	caseList := []struct {
+		policy      ConflictPolicy
+		targetNewer bool
+		apply       bool
+	}{
+		{CONFLICT_POLICY_SOURCE_WINS, true, true},
+		{CONFLICT_POLICY_TARGET_WINS, false, false},
+		{CONFLICT_POLICY_NEWEST_WINS, true, false},
+		{CONFLICT_POLICY_NEWEST_WINS, false, true},
+	}
+	Convey("resolve by policy", t, func() {
+		for _, v := range caseList {
+			conn := &Conn{p: &PluginParam{ConflictPolicy: v.policy}}
+			apply, err := conn.resolveConflictData(data, pluginDriver.CONFLICT_BEFORE_MISMATCH, v.targetNewer)
+			So(err, ShouldBeNil)
+			So(apply, ShouldEqual, v.apply)
+		}
+	})
+}
+
+func TestConn_GetConflictCount(t *testing.T) {
+	Convey("include parallel param", t, func() {
+		conn := &Conn{p: &PluginParam{}}
+		conn.p.parallelParamList = []*PluginParam{conn.p.newParallelParam()}
+		conn.addConflictCount(pluginDriver.CONFLICT_INSERT_EXISTS)
+		worker := &Conn{p: conn.p.parallelParamList[0]}
+		worker.addConflictCount(pluginDriver.CONFLICT_INSERT_EXISTS)
+		worker.addConflictCount(pluginDriver.CONFLICT_UPDATE_MISSING)
+
+		conflictCount := conn.GetConflictCount()
+		So(conflictCount[pluginDriver.CONFLICT_INSERT_EXISTS], ShouldEqual, 2)
+		So(conflictCount[pluginDriver.CONFLICT_UPDATE_MISSING], ShouldEqual, 1)
+		So(len(conn.GetConflictCount()), ShouldEqual, 0)
+	})
+
+	Convey("flag value", t, func() {
+		So(isConflictTrue(int64(1)), ShouldBeTrue)
+		So(isConflictTrue([]byte("1")), ShouldBeTrue)
+		So(isConflictTrue(nil), ShouldBeFalse)
+	})
+}
@@ -276,6 +276,108 @@ func TestCommit_Integration(t *testing.T) {
 	}
 }
 
+func TestParallelCommit_Integration(t *testing.T) {
+	beforeTest()
+	initDBTable(true)
+	myConn := NewConn()
+	myConn.SetOption(&url, nil)
+	myConn.Open()
+	param := getParam("Normal")
+	param["ParallelCount"] = 4
+	if _, err := myConn.SetParam(param); err != nil {
+		t.Fatal(err)
+	}
+	defer myConn.Close()
+
+	e := pluginTestData.NewEvent()
+	var lastData *pluginDriver.PluginDataType
+	for i := 0; i < 20; i++ {
+		lastData = e.GetTestInsertData()
+		myConn.Insert(lastData, false)
+	}
+	updateData := e.GetTestUpdateData()
+	myConn.Update(updateData, false)
+	_, _, err := myConn.TimeOutCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, row := range []map[string]interface{}{lastData.Rows[0], updateData.Rows[len(updateData.Rows)-1]} {
+		checkResult, err := checkDataRight(row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range checkResult["error"] {
+			t.Error(v)
+		}
+	}
+}
+
+func TestConflict_Integration(t *testing.T) {
+	beforeTest()
+	initDBTable(true)
+	myConn := NewConn()
+	myConn.SetOption(&url, nil)
+	myConn.Open()
+	param := getParam("Normal")
+	param["ConflictPolicy"] = "TargetWins"
+	if _, err := myConn.SetParam(param); err != nil {
+		t.Fatal(err)
+	}
+	defer myConn.Close()
+
+	e := pluginTestData.NewEvent()
+	insertData := e.GetTestInsertData()
+	for i := 0; i < 2; i++ {
+		myConn.Insert(insertData, false)
+		if _, _, err := myConn.TimeOutCommit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conflictCount := myConn.(pluginDriver.ConflictDriver).GetConflictCount()
+	if conflictCount[pluginDriver.CONFLICT_INSERT_EXISTS] != 1 {
+		t.Fatal("conflict count error:", conflictCount)
+	}
+}
+
+func TestLoopMarker_Integration(t *testing.T) {
+	beforeTest()
+	initDBTable(true)
+	myConn := NewConn()
+	myConn.SetOption(&url, nil)
+	myConn.Open()
+	param := getParam("Normal")
+	param["LoopMarkerTable"] = "bifrost_loop_marker"
+	if _, err := myConn.SetParam(param); err != nil {
+		t.Fatal(err)
+	}
+	defer myConn.Close()
+
+	c := NewMysqlDBConn(url)
+	defer c.Close()
+	if err := c.Exec("DELETE FROM `" + SchemaName + "`.`bifrost_loop_marker`"); err != nil {
+		t.Fatal(err)
+	}
+	e := pluginTestData.NewEvent()
+	myConn.Insert(e.GetTestInsertData(), false)
+	if _, _, err := myConn.TimeOutCommit(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := c.conn.Query("SELECT SUM(`times`) FROM `"+SchemaName+"`.`bifrost_loop_marker`", []dbDriver.Value{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := make([]dbDriver.Value, 1)
+	if err = rows.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if fmt.Sprint(dest[0]) != "1" {
+		t.Fatal("loop marker times error:", dest[0])
+	}
+}
+
 func TestInsertAndChekcData_Integration(t *testing.T) {
 	beforeTest()
 	initDBTable(true)
@@ -302,6 +404,32 @@ func TestInsertAndChekcData_Integration(t *testing.T) {
 	}
 }
 
+func TestTransaction_Integration(t *testing.T) {
+	beforeTest()
+	initDBTable(true)
+	conn := getPluginConn("Normal")
+	e := pluginTestData.NewEvent()
+	insertdata := e.GetTestInsertData()
+	updateData := e.GetTestUpdateData()
+	commitData := e.GetTestCommitData()
+	list := []*pluginDriver.PluginDataType{insertdata, updateData, commitData}
+	lastSuccessCommitData, _, err := conn.(pluginDriver.TransactionDriver).Transaction(list, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastSuccessCommitData != commitData {
+		t.Fatal("lastSuccessCommitData must be commit data")
+	}
+
+	checkResult, err := checkDataRight(updateData.Rows[len(updateData.Rows)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range checkResult["error"] {
+		t.Error(v)
+	}
+}
+
 func TestInsertNullAndChekcData_Integration(t *testing.T) {
 	beforeTest()
 	initDBTable(true)
@@ -19,6 +19,10 @@ type opLog struct {
 }
 
 func (This *Conn) CommitLogMod_Update(list []*pluginDriver.PluginDataType) (errData *pluginDriver.PluginDataType) {
+	// binlog_row_image = MINIMAL/NOBLOB 的数据 只包含部分字段, 不能合并, 按顺序逐条执行
+	if pluginDriver.HasPartialRows(list) {
+		return This.CommitPartialRows(list)
+	}
 
 	//因为数据是有序写到list里的，里有 update,delete,insert，所以这里我们反向遍历
 
@@ -0,0 +1,76 @@
+/*
+双向同步 防回环
+配置了 LoopMarkerTable 的时候, 每个事务开始之后 先更新一次 标记表, 自动建表 和 DDL 语句 带上 mysql.LoopMarkerQueryComment 注释
+反方向的数据源 配置相同的标记表 之后, 这些事务 和 DDL 不会再被同步回来
+
+标记表 每个连接一行, id 为 CONNECTION_ID(), 每次 times + 1, 保证每个事务中 都有标记表的 row 事件
+标记表的 row 事件 需要在事务中的第一个, 所以 开启事务之后 马上更新
+StarRocks 不支持
+*/
+package src
+
+import (
+	"fmt"
+	"github.com/brokercap/Bifrost/Bristol/mysql"
+	"log"
+	"strings"
+)
+
+func (This *Conn) checkLoopMarkerParam() error {
+	if This.p.LoopMarkerTable == "" {
+		return nil
+	}
+	if This.IsStarRocks() {
+		return fmt.Errorf("LoopMarkerTable not supported StarRocks")
+	}
+	if !strings.Contains(This.p.LoopMarkerTable, ".") {
+		if This.p.Schema == "" {
+			return fmt.Errorf("LoopMarkerTable must be schema.table when Table is empty")
+		}
+		This.p.LoopMarkerTable = This.p.Schema + "." + This.p.LoopMarkerTable
+	}
+	return nil
+}
+
+func (This *Conn) getLoopMarkerTable() string {
+	i := strings.Index(This.p.LoopMarkerTable, ".")
+	return fmt.Sprintf("`%s`.`%s`", This.p.LoopMarkerTable[:i], This.p.LoopMarkerTable[i+1:])
+}
+
+// 建表是 DDL, 会隐式提交事务, 所以在 GetParam 的时候创建
+func (This *Conn) initLoopMarkerTable() {
+	if This.p.LoopMarkerTable == "" || This.conn == nil || This.conn.err != nil {
+		return
+	}
+	schemaName := This.p.LoopMarkerTable[:strings.Index(This.p.LoopMarkerTable, ".")]
+	_ = This.conn.CreateDatabase(schemaName)
+	sql := "CREATE TABLE IF NOT EXISTS " + This.getLoopMarkerTable() + " (" +
+		"`id` bigint unsigned NOT NULL," +
+		"`times` bigint unsigned NOT NULL DEFAULT 0," +
+		"`update_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP," +
+		"PRIMARY KEY (`id`)" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	if err := This.conn.Exec(This.loopMarkerQuery(sql)); err != nil {
+		log.Printf("[ERROR] output[%s] create loop marker table:%s err:%+v \n", OutputName, This.p.LoopMarkerTable, err)
+	}
+}
+
+// 开启事务, 配置了 LoopMarkerTable 的时候 同时更新标记表
+func (This *Conn) begin() error {
+	if err := This.conn.Begin(); err != nil {
+		return err
+	}
+	if This.p.LoopMarkerTable == "" {
+		return nil
+	}
+	sql := "INSERT INTO " + This.getLoopMarkerTable() + " (`id`,`times`) VALUES (CONNECTION_ID(),1) ON DUPLICATE KEY UPDATE `times`=`times`+1"
+	return This.conn.Exec(sql)
+}
+
+// Bifrost 写入的 DDL, 带上注释, 反方向的数据源 解析到之后 不再同步
+func (This *Conn) loopMarkerQuery(sql string) string {
+	if This.p.LoopMarkerTable == "" {
+		return sql
+	}
+	return sql + " " + mysql.LoopMarkerQueryComment
+}
@@ -0,0 +1,41 @@
+package src
+
+import (
+	"testing"
+
+	"github.com/brokercap/Bifrost/Bristol/mysql"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConn_checkLoopMarkerParam(t *testing.T) {
+	Convey("loop marker table use target schema", t, func() {
+		conn := &Conn{p: &PluginParam{Schema: "bifrost_test", Table: "t1", LoopMarkerTable: "bifrost_loop_marker"}}
+		So(conn.checkLoopMarkerParam(), ShouldBeNil)
+		So(conn.p.LoopMarkerTable, ShouldEqual, "bifrost_test.bifrost_loop_marker")
+		So(conn.getLoopMarkerTable(), ShouldEqual, "`bifrost_test`.`bifrost_loop_marker`")
+	})
+
+	Convey("loop marker table must have schema when auto table", t, func() {
+		conn := &Conn{p: &PluginParam{LoopMarkerTable: "bifrost_loop_marker"}}
+		So(conn.checkLoopMarkerParam(), ShouldNotBeNil)
+		conn.p.LoopMarkerTable = "bifrost.bifrost_loop_marker"
+		So(conn.checkLoopMarkerParam(), ShouldBeNil)
+	})
+
+	Convey("not supported starrocks", t, func() {
+		conn := &Conn{p: &PluginParam{LoopMarkerTable: "bifrost.bifrost_loop_marker"}, isStarRocks: true}
+		So(conn.checkLoopMarkerParam(), ShouldNotBeNil)
+	})
+}
+
+func TestConn_loopMarkerQuery(t *testing.T) {
+	Convey("without loop marker table", t, func() {
+		conn := &Conn{p: &PluginParam{}}
+		So(conn.loopMarkerQuery("TRUNCATE TABLE t1"), ShouldEqual, "TRUNCATE TABLE t1")
+	})
+
+	Convey("with loop marker table", t, func() {
+		conn := &Conn{p: &PluginParam{LoopMarkerTable: "bifrost.bifrost_loop_marker"}}
+		So(conn.loopMarkerQuery("TRUNCATE TABLE t1"), ShouldEqual, "TRUNCATE TABLE t1 "+mysql.LoopMarkerQueryComment)
+	})
+}
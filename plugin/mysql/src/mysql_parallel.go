@@ -0,0 +1,231 @@
+/*
+并行回放
+ParallelCount > 1 的时候, 每批数据按 表 + 主键(PluginDataType.Pri) 划分依赖关系
+有相同主键的数据(update 修改主键的时候 前后两个主键 都算)分到同一个连接, 在这个连接上按原来的顺序执行
+不同主键的数据 分到 ParallelCount 个连接 并发执行, 每个连接一个事务
+
+只有 普通模式(Normal) 支持, replace into / on duplicate key update / delete 重复执行结果一样
+其中一个连接失败的时候, 其他连接已经提交的数据 在重试的时候会被再执行一次
+源表没有主键的数据, 整个表的数据 分到同一个连接
+非主键的唯一索引冲突 不在依赖关系里, 有这种情况的表 不要开启
+*/
+package src
+
+import (
+	dbDriver "database/sql/driver"
+	"fmt"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+func (This *Conn) isParallelCommit() bool {
+	if This.p.ParallelCount <= 1 || This.p.SyncMode != SYNCMODE_NORMAL || This.IsStarRocks() {
+		return false
+	}
+	return true
+}
+
+func (This *Conn) ParallelCommit(list []*pluginDriver.PluginDataType) (ErrData *pluginDriver.PluginDataType, e error) {
+	// 建表 在主连接上执行, 防止多个连接同时建同一个表
+	if This.p.AutoTable {
+		tableMap := make(map[string]bool, 0)
+		newList := make([]*pluginDriver.PluginDataType, 0, len(list))
+		for _, data := range list {
+			key := data.SchemaName + "." + data.TableName
+			if _, ok := tableMap[key]; !ok {
+				p, err := This.CreateTableAndGetTableFieldsType(data)
+				if err != nil {
+					return data, err
+				}
+				tableMap[key] = p != nil
+			}
+			if tableMap[key] {
+				newList = append(newList, data)
+			}
+		}
+		list = newList
+	}
+	groupList := This.groupParallelData(list, This.p.ParallelCount)
+	var wg sync.WaitGroup
+	errDataList := make([]*pluginDriver.PluginDataType, len(groupList))
+	errList := make([]error, len(groupList))
+	for i, group := range groupList {
+		if len(group) == 0 {
+			continue
+		}
+		worker, err := This.getParallelConn(i)
+		if err != nil {
+			return group[0], err
+		}
+		wg.Add(1)
+		go func(i int, worker *Conn, group []*pluginDriver.PluginDataType) {
+			defer wg.Done()
+			errDataList[i], errList[i] = worker.parallelCommit(group)
+		}(i, worker, group)
+	}
+	wg.Wait()
+	for i, err := range errList {
+		if err != nil {
+			log.Printf("[ERROR] output[%s] ParallelCommit worker:%d err:%+v \n", OutputName, i, err)
+			return errDataList[i], err
+		}
+	}
+	return
+}
+
+func (This *Conn) parallelCommit(list []*pluginDriver.PluginDataType) (ErrData *pluginDriver.PluginDataType, e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			e = fmt.Errorf("%s", debug.Stack())
+			log.Println(string(debug.Stack()))
+			This.conn.err = e
+			This.err = e
+		}
+	}()
+	This.err = nil
+	if This.conn.err != nil {
+		This.ReConnect()
+	}
+	if This.conn.err != nil {
+		return nil, This.conn.err
+	}
+	if This.p.AutoTable {
+		return This.AutoTableCommit(list)
+	}
+	return This.NotAutoTableCommit(list)
+}
+
+// 第 i 个并行连接, 连接属于插件实例, 参数属于 PluginParam, 同一个插件实例 会被不同的表使用
+func (This *Conn) getParallelConn(i int) (*Conn, error) {
+	for len(This.parallelConnList) <= i {
+		worker := &Conn{
+			uri:              This.uri,
+			status:           "close",
+			serverVersion:    This.serverVersion,
+			isTiDB:           This.isTiDB,
+			isStarRocks:      This.isStarRocks,
+			starRocksBeCount: This.starRocksBeCount,
+		}
+		worker.Connect()
+		This.parallelConnList = append(This.parallelConnList, worker)
+	}
+	for len(This.p.parallelParamList) <= i {
+		This.p.parallelParamList = append(This.p.parallelParamList, This.p.newParallelParam())
+	}
+	worker := This.parallelConnList[i]
+	if worker.p != This.p.parallelParamList[i] {
+		if worker.p != nil {
+			worker.StmtClose()
+		}
+		worker.p = This.p.parallelParamList[i]
+	}
+	if worker.conn.err != nil {
+		worker.ReConnect()
+	}
+	return worker, worker.conn.err
+}
+
+// 并行连接使用的参数, stmt 和 表结构缓存 每个连接一份
+func (p *PluginParam) newParallelParam() *PluginParam {
+	param := *p
+	param.Field = append([]fieldStruct{}, p.Field...)
+	param.PriKey = append([]fieldStruct{}, p.PriKey...)
+	param.Data = NewTableData()
+	param.stmtArr = make([]dbDriver.Stmt, 4)
+	param.tableMap = make(map[string]*PluginParam0, 0)
+	param.toDatabaseMap = make(map[string]bool, len(p.toDatabaseMap))
+	for k, v := range p.toDatabaseMap {
+		param.toDatabaseMap[k] = v
+	}
+	param.parallelParamList = nil
+	param.conflictCount = nil
+	return &param
+}
+
+func (This *Conn) closeParallelConn() {
+	for _, worker := range This.parallelConnList {
+		worker.Close()
+	}
+	This.parallelConnList = nil
+}
+
+// 按主键划分依赖关系, 返回 n 个列表, 每个列表中的数据 保持原来的顺序
+func (This *Conn) groupParallelData(list []*pluginDriver.PluginDataType, n int) [][]*pluginDriver.PluginDataType {
+	// 并查集, 有相同主键的数据 合并到一个集合
+	parent := make([]int, len(list))
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	keyMap := make(map[string]int, len(list))
+	for i, data := range list {
+		parent[i] = i
+		for _, key := range This.getParallelKeyList(data) {
+			j, ok := keyMap[key]
+			if !ok {
+				keyMap[key] = i
+				continue
+			}
+			if root, root0 := find(i), find(j); root != root0 {
+				parent[root] = root0
+			}
+		}
+	}
+	// 按集合第一次出现的顺序, 分给当前数据量最少的连接
+	groupList := make([][]*pluginDriver.PluginDataType, n)
+	rootGroup := make(map[int]int, 0)
+	rootCount := make(map[int]int, 0)
+	for i := range list {
+		rootCount[find(i)]++
+	}
+	groupCount := make([]int, n)
+	for i, data := range list {
+		root := find(i)
+		index, ok := rootGroup[root]
+		if !ok {
+			for k := range groupCount {
+				if groupCount[k] < groupCount[index] {
+					index = k
+				}
+			}
+			groupCount[index] += rootCount[root]
+			rootGroup[root] = index
+		}
+		groupList[index] = append(groupList[index], data)
+	}
+	return groupList
+}
+
+// 一条数据涉及到的 目标表+主键 列表, 没有主键的时候 为整个表
+// 多个源表同步到同一个目标表的时候, 按目标表判断
+func (This *Conn) getParallelKeyList(data *pluginDriver.PluginDataType) []string {
+	_, _, table := This.GetSchemaAndTable(data)
+	if len(data.Pri) == 0 {
+		return []string{table}
+	}
+	keyList := make([]string, 0, len(data.Rows))
+	for _, row := range data.Rows {
+		key := table
+		for _, pri := range data.Pri {
+			val, ok := row[pri]
+			if !ok {
+				// binlog_row_image = MINIMAL 的时候, update 的 after 数据 可能没有主键字段, 主键没有改变
+				key = ""
+				break
+			}
+			key += fmt.Sprintf("|%v", val)
+		}
+		if key != "" {
+			keyList = append(keyList, key)
+		}
+	}
+	if len(keyList) == 0 {
+		return []string{table}
+	}
+	return keyList
+}
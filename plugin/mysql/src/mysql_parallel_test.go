@@ -0,0 +1,66 @@
+package src
+
+import (
+	"testing"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConn_groupParallelData(t *testing.T) {
+	conn := &Conn{p: &PluginParam{}}
+	newData := func(eventType string, pri []string, rows ...map[string]interface{}) *pluginDriver.PluginDataType {
+		return &pluginDriver.PluginDataType{
+			EventType:  eventType,
+			SchemaName: "bifrost_test",
+			TableName:  "t1",
+			Pri:        pri,
+			Rows:       rows,
+		}
+	}
+	pri := []string{"id"}
+
+	Convey("same pri key in the same group and keep order", t, func() {
+		list := []*pluginDriver.PluginDataType{
+			newData("insert", pri, map[string]interface{}{"id": 1}),
+			newData("insert", pri, map[string]interface{}{"id": 2}),
+			newData("update", pri, map[string]interface{}{"id": 1}, map[string]interface{}{"id": 1, "name": "a"}),
+			newData("delete", pri, map[string]interface{}{"id": 2}),
+		}
+		groupList := conn.groupParallelData(list, 2)
+		So(len(groupList), ShouldEqual, 2)
+		So(groupList[0], ShouldResemble, []*pluginDriver.PluginDataType{list[0], list[2]})
+		So(groupList[1], ShouldResemble, []*pluginDriver.PluginDataType{list[1], list[3]})
+	})
+
+	Convey("update pri key changed", t, func() {
+		list := []*pluginDriver.PluginDataType{
+			newData("insert", pri, map[string]interface{}{"id": 1}),
+			newData("insert", pri, map[string]interface{}{"id": 2}),
+			newData("update", pri, map[string]interface{}{"id": 2}, map[string]interface{}{"id": 3}),
+			newData("insert", pri, map[string]interface{}{"id": 3}),
+		}
+		groupList := conn.groupParallelData(list, 2)
+		So(groupList[0], ShouldResemble, []*pluginDriver.PluginDataType{list[0]})
+		So(groupList[1], ShouldResemble, []*pluginDriver.PluginDataType{list[1], list[2], list[3]})
+	})
+
+	Convey("no pri key", t, func() {
+		list := []*pluginDriver.PluginDataType{
+			newData("insert", nil, map[string]interface{}{"id": 1}),
+			newData("insert", nil, map[string]interface{}{"id": 2}),
+		}
+		groupList := conn.groupParallelData(list, 4)
+		So(groupList[0], ShouldResemble, list)
+		So(len(groupList[1]), ShouldEqual, 0)
+	})
+
+	Convey("same target table", t, func() {
+		conn := &Conn{p: &PluginParam{Schema: "bifrost_test", Table: "t_all"}}
+		data := newData("insert", pri, map[string]interface{}{"id": 1})
+		data0 := newData("insert", pri, map[string]interface{}{"id": 1})
+		data0.TableName = "t2"
+		groupList := conn.groupParallelData([]*pluginDriver.PluginDataType{data, data0}, 2)
+		So(len(groupList[0]), ShouldEqual, 2)
+	})
+}
@@ -0,0 +1,149 @@
+/*
+binlog_row_image = MINIMAL/NOBLOB 的时候, 数据只包含部分字段
+同一条数据的多次变更不能只保留最后一次, 所以按顺序逐条执行, 并且只修改 binlog 中存在的字段
+insert 转成 replace into (存在的字段)
+update 转成 update set (after 中存在的字段) where (before 中的主键)
+delete 普通模式转成 delete, 日志更新模式转成 insert on update (存在的字段)
+*/
+package src
+
+import (
+	dbDriver "database/sql/driver"
+	"fmt"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"log"
+	"strings"
+)
+
+func (This *Conn) CommitPartialRows(list []*pluginDriver.PluginDataType) (errData *pluginDriver.PluginDataType) {
+	for _, data := range list {
+		var sql string
+		var val []dbDriver.Value
+		sql, val, This.err = This.getPartialRowSql(data)
+		if This.err != nil {
+			if !This.p.BifrostMustBeSuccess || This.CheckDataSkip(data) {
+				This.err = nil
+				continue
+			}
+			return data
+		}
+		if sql == "" {
+			continue
+		}
+		var stmt dbDriver.Stmt
+		stmt, This.conn.err = This.conn.conn.Prepare(sql)
+		if This.conn.err != nil {
+			log.Println("plugin mysql partial row prepare err:", This.conn.err, " sql:", sql)
+			return data
+		}
+		_, This.conn.err = stmt.Exec(val)
+		stmt.Close()
+		if This.conn.err != nil {
+			log.Println("plugin mysql partial row exec err:", This.conn.err, " sql:", sql, " data:", val)
+			if This.CheckDataSkip(data) {
+				This.conn.err = nil
+				continue
+			}
+			return data
+		}
+	}
+	return
+}
+
+// 返回 sql 为空的时候, 表示没有需要修改的字段
+func (This *Conn) getPartialRowSql(data *pluginDriver.PluginDataType) (sql string, val []dbDriver.Value, err error) {
+	switch data.EventType {
+	case "insert":
+		fields := This.getPresentFields(data, 0)
+		if val, err = This.getFieldsValue(data, 0, fields); err != nil {
+			return
+		}
+		sql = "REPLACE INTO " + This.p.schemaAndTable + " (" + joinFields(fields, "`%s`", ",") + ") VALUES (" + joinFields(fields, "?", ",") + ")"
+	case "update":
+		if !data.IsPartialRow(1) {
+			return This.getUpsertSql(data, 1, This.p.Field)
+		}
+		fields := This.getPresentFields(data, 1)
+		if len(fields) == 0 {
+			return
+		}
+		if len(This.p.PriKey) == 0 {
+			err = fmt.Errorf("%s PriKey is empty, binlog_row_image:MINIMAL/NOBLOB update can't be sync", This.p.schemaAndTable)
+			return
+		}
+		for _, v := range This.p.PriKey {
+			if data.IsColumnAbsent(0, v.FromMysqlField) {
+				err = fmt.Errorf("%s PriKey:%s not in binlog before data", This.p.schemaAndTable, v.FromMysqlField)
+				return
+			}
+		}
+		var where []dbDriver.Value
+		if val, err = This.getFieldsValue(data, 1, fields); err != nil {
+			return
+		}
+		if where, err = This.getFieldsValue(data, 0, This.p.PriKey); err != nil {
+			return
+		}
+		val = append(val, where...)
+		sql = "UPDATE " + This.p.schemaAndTable + " SET " + joinFields(fields, "`%s`=?", ",") + " WHERE " + joinFields(This.p.PriKey, "`%s`=?", " AND ")
+	case "delete":
+		if This.p.SyncMode == SYNCMODE_LOG_UPDATE {
+			return This.getUpsertSql(data, 0, This.getPresentFields(data, 0))
+		}
+		if val, err = This.getFieldsValue(data, 0, This.p.PriKey); err != nil {
+			return
+		}
+		sql = "DELETE FROM " + This.p.schemaAndTable + " WHERE " + joinFields(This.p.PriKey, "`%s`=?", " AND ")
+	}
+	return
+}
+
+func (This *Conn) getUpsertSql(data *pluginDriver.PluginDataType, index int, fields []fieldStruct) (sql string, val []dbDriver.Value, err error) {
+	if val, err = This.getFieldsValue(data, index, fields); err != nil {
+		return
+	}
+	val = append(val, val...)
+	sql = "INSERT INTO " + This.p.schemaAndTable + " (" + joinFields(fields, "`%s`", ",") + ") VALUES (" + joinFields(fields, "?", ",") + ") ON DUPLICATE KEY UPDATE " + joinFields(fields, "`%s`=?", ",")
+	return
+}
+
+// 获取第 index 行数据中 binlog 里存在的字段, 所有字段都存在的时候 返回所有字段
+func (This *Conn) getPresentFields(data *pluginDriver.PluginDataType, index int) []fieldStruct {
+	if !data.IsPartialRow(index) {
+		return This.p.Field
+	}
+	fields := make([]fieldStruct, 0, len(This.p.Field))
+	for _, v := range This.p.Field {
+		if v.FromMysqlField == "" || data.IsColumnAbsent(index, v.FromMysqlField) {
+			continue
+		}
+		fields = append(fields, v)
+	}
+	return fields
+}
+
+func (This *Conn) getFieldsValue(data *pluginDriver.PluginDataType, index int, fields []fieldStruct) (val []dbDriver.Value, err error) {
+	val = make([]dbDriver.Value, 0, len(fields))
+	for _, v := range fields {
+		var toV dbDriver.Value
+		toV, err = This.dataTypeTransfer(This.getMySQLData(data, index, v.FromMysqlField), v.ToField, v.ToFieldType, v.ToFieldDefault)
+		if err != nil {
+			return nil, err
+		}
+		val = append(val, toV)
+	}
+	return
+}
+
+// format 中的 %s 替换成目标字段名
+func joinFields(fields []fieldStruct, format string, sep string) string {
+	list := make([]string, 0, len(fields))
+	for _, v := range fields {
+		if strings.Contains(format, "%s") {
+			list = append(list, fmt.Sprintf(format, v.ToField))
+		} else {
+			list = append(list, format)
+		}
+	}
+	return strings.Join(list, sep)
+}
@@ -0,0 +1,80 @@
+package src
+
+import (
+	"testing"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConn_getPartialRowSql(t *testing.T) {
+	p := &PluginParam{
+		Field: []fieldStruct{
+			{ToField: "id", FromMysqlField: "id", ToFieldType: "int"},
+			{ToField: "name", FromMysqlField: "name", ToFieldType: "varchar"},
+			{ToField: "content", FromMysqlField: "content", ToFieldType: "text"},
+			{ToField: "event_type", FromMysqlField: "{$EventType}", ToFieldType: "varchar"},
+		},
+		PriKey:         []fieldStruct{{ToField: "id", FromMysqlField: "id", ToFieldType: "int"}},
+		schemaAndTable: "`test`.`binlog_minimal`",
+		SyncMode:       SYNCMODE_NORMAL,
+	}
+	conn := &Conn{p: p}
+	columnMapping := map[string]string{"id": "int32", "name": "Nullable(string)", "content": "Nullable(string)"}
+
+	Convey("update only set present columns", t, func() {
+		data := &pluginDriver.PluginDataType{
+			EventType:      "update",
+			Rows:           []map[string]interface{}{{"id": int32(1)}, {"name": nil}},
+			ColumnMapping:  columnMapping,
+			PresentColumns: [][]string{{"id"}, {"name"}},
+		}
+		sql, val, err := conn.getPartialRowSql(data)
+		So(err, ShouldBeNil)
+		So(sql, ShouldEqual, "UPDATE `test`.`binlog_minimal` SET `name`=?,`event_type`=? WHERE `id`=?")
+		So(len(val), ShouldEqual, 3)
+		So(val[0], ShouldBeNil)
+		So(val[1], ShouldEqual, "update")
+	})
+
+	Convey("update pri key not in before data", t, func() {
+		data := &pluginDriver.PluginDataType{
+			EventType:      "update",
+			Rows:           []map[string]interface{}{{"name": "a"}, {"name": "b"}},
+			ColumnMapping:  columnMapping,
+			PresentColumns: [][]string{{"name"}, {"name"}},
+		}
+		_, _, err := conn.getPartialRowSql(data)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("insert only present columns", t, func() {
+		data := &pluginDriver.PluginDataType{
+			EventType:      "insert",
+			Rows:           []map[string]interface{}{{"id": int32(2), "name": "bifrost"}},
+			ColumnMapping:  columnMapping,
+			PresentColumns: [][]string{{"id", "name"}},
+		}
+		sql, val, err := conn.getPartialRowSql(data)
+		So(err, ShouldBeNil)
+		So(sql, ShouldEqual, "REPLACE INTO `test`.`binlog_minimal` (`id`,`name`,`event_type`) VALUES (?,?,?)")
+		So(len(val), ShouldEqual, 3)
+	})
+
+	Convey("log update delete only upsert present columns", t, func() {
+		p.SyncMode = SYNCMODE_LOG_UPDATE
+		defer func() {
+			p.SyncMode = SYNCMODE_NORMAL
+		}()
+		data := &pluginDriver.PluginDataType{
+			EventType:      "delete",
+			Rows:           []map[string]interface{}{{"id": int32(3)}},
+			ColumnMapping:  columnMapping,
+			PresentColumns: [][]string{{"id"}},
+		}
+		sql, val, err := conn.getPartialRowSql(data)
+		So(err, ShouldBeNil)
+		So(sql, ShouldEqual, "INSERT INTO `test`.`binlog_minimal` (`id`,`event_type`) VALUES (?,?) ON DUPLICATE KEY UPDATE `id`=?,`event_type`=?")
+		So(len(val), ShouldEqual, 4)
+	})
+}
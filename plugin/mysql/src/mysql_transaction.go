@@ -0,0 +1,119 @@
+/*
+按源端事务提交
+ToServer 开启 Transaction 的时候, 同一个源端事务中的数据 一次性提交过来, 在目标库的一个事务中执行
+这样目标库 不会读到 多表事务只执行了一半的数据
+StarRocks 不支持
+*/
+package src
+
+import (
+	"fmt"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"log"
+	"runtime/debug"
+)
+
+func (This *Conn) Transaction(list []*pluginDriver.PluginDataType, retry bool) (LastSuccessCommitData *pluginDriver.PluginDataType, ErrData *pluginDriver.PluginDataType, e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			e = fmt.Errorf("%s", debug.Stack())
+			log.Println(string(debug.Stack()))
+			This.conn.err = e
+			This.err = e
+		}
+	}()
+	// StarRocks 不支持事务, 分批提交 不能保证原子性, 不能返回成功的位点
+	if This.IsStarRocks() {
+		return nil, nil, fmt.Errorf("Transaction not supported StarRocks")
+	}
+	if len(list) == 0 {
+		return nil, nil, nil
+	}
+	commitData := list[len(list)-1]
+	list = list[:len(list)-1]
+	// 之前缓存还没提交的数据, 先提交
+	for len(This.p.Data.Data) > 0 {
+		if _, ErrData, e = This.AutoCommit(); e != nil {
+			return nil, ErrData, e
+		}
+	}
+	if len(list) == 0 || This.p.SyncMode == SYNCMODE_NO_SYNC_DATA {
+		This.p.SkipBinlogData = nil
+		return commitData, nil, nil
+	}
+	if This.conn.err != nil {
+		This.ReConnect()
+	}
+	if This.conn.err != nil {
+		return nil, nil, This.conn.err
+	}
+	if This.p.AutoTable {
+		ErrData, e = This.AutoTableTransactionCommit(list)
+	} else {
+		ErrData, e = This.NotAutoTableCommit(list)
+	}
+	if e != nil {
+		log.Printf("[ERROR] output[%s] Transaction commit err:%+v \n", OutputName, e)
+		if This.p.BifrostMustBeSuccess {
+			return nil, ErrData, e
+		}
+	}
+	This.p.SkipBinlogData = nil
+	return commitData, nil, nil
+}
+
+// 自动创建表的时候, 多个表的数据 在同一个事务中提交
+func (This *Conn) AutoTableTransactionCommit(list []*pluginDriver.PluginDataType) (ErrData *pluginDriver.PluginDataType, e error) {
+	dataMap := make(map[string][]*pluginDriver.PluginDataType, 0)
+	keyList := make([]string, 0)
+	for _, PluginData := range list {
+		key := PluginData.SchemaName + "." + PluginData.TableName
+		if _, ok := dataMap[key]; !ok {
+			dataMap[key] = make([]*pluginDriver.PluginDataType, 0)
+			keyList = append(keyList, key)
+		}
+		dataMap[key] = append(dataMap[key], PluginData)
+	}
+	// 建表 是 DDL, 会隐式提交事务, 所以要在开启事务之前 把所有表都创建好
+	paramMap := make(map[string]*PluginParam0, len(keyList))
+	for _, key := range keyList {
+		p, err := This.CreateTableAndGetTableFieldsType(dataMap[key][0])
+		if err != nil {
+			return dataMap[key][0], err
+		}
+		paramMap[key] = p
+	}
+	This.conn.err = This.begin()
+	if This.conn.err != nil {
+		This.err = This.conn.err
+		return nil, This.err
+	}
+	for _, key := range keyList {
+		p := paramMap[key]
+		if p == nil {
+			continue
+		}
+		This.p.Field = p.Field
+		This.p.fieldCount = len(p.Field)
+		This.p.schemaAndTable = p.SchemaAndTable
+		This.p.PriKey = p.PriKey
+		This.p.toPriKey = p.ToPriKey
+		This.p.fromPriKey = p.FromPriKey
+		ErrData = This.commitData(dataMap[key])
+		// stmt 是按表 prepare 的, 切换表之前要关闭
+		This.StmtClose()
+		if This.conn.err != nil {
+			This.err = This.conn.err
+		}
+		if This.err != nil {
+			This.conn.err = This.conn.Rollback()
+			log.Printf("[ERROR] output[%s] AutoTableTransactionCommit commitData err:%+v \n", OutputName, This.err)
+			return ErrData, This.err
+		}
+	}
+	This.conn.err = This.conn.Commit()
+	if This.conn.err != nil {
+		return nil, This.conn.err
+	}
+	return
+}
@@ -0,0 +1,21 @@
+package src
+
+import (
+	"testing"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConn_Transaction(t *testing.T) {
+	Convey("not supported starrocks", t, func() {
+		conn := &Conn{p: &PluginParam{}, isStarRocks: true}
+		list := []*pluginDriver.PluginDataType{
+			{EventType: "insert", SchemaName: "bifrost_test", TableName: "t1", Rows: []map[string]interface{}{{"id": 1}}},
+			{EventType: "commit", SchemaName: "bifrost_test", TableName: "t1", BinlogFileNum: 1, BinlogPosition: 100},
+		}
+		lastSuccessCommitData, _, err := conn.Transaction(list, false)
+		So(err, ShouldNotBeNil)
+		So(lastSuccessCommitData, ShouldBeNil)
+	})
+}
@@ -4,6 +4,11 @@ function doGetPluginParam(){
 	var Table = $("#to_mysql_table").val();
     var Schema = $("#to_mysql_schema").val();
     var BatchSize = $("#MySQL_BatchSize").val();
+    var ParallelCount = $("#MySQL_ParallelCount").val();
+    var ConflictPolicy = $("#MySQL_ConflictPolicy").val();
+    var ConflictTimeField = $("#MySQL_ConflictTimeField").val();
+    var ConflictErrorTable = $("#MySQL_ConflictErrorTable").val();
+    var LoopMarkerTable = $.trim($("#MySQL_LoopMarkerTable").val());
     var NullTransferDefault = $("#MySQL_NullTransferDefault").val();
     var SyncMode = $("#MySQL_SyncMode").val();
 
@@ -18,6 +23,21 @@ function doGetPluginParam(){
         return result;
     }
 
+    if (ParallelCount != "" && ParallelCount != null && isNaN(ParallelCount)){
+        result.msg = "ParallelCount must be int!"
+        return result;
+    }
+
+    if (ConflictPolicy != "" && SyncMode != "Normal"){
+        result.msg = "ConflictPolicy 只支持 Normal 模式!"
+        return result;
+    }
+
+    if (ConflictPolicy == "NewestWins" && ConflictTimeField == ""){
+        result.msg = "NewestWins 必须配置 ConflictTimeField!"
+        return result;
+    }
+
 	var PriKey = [];
 	var Field = [];
     // 选择了指定目标表的情况下，并且非日志模式同步情况下，必须指定哪一个目标表字段为主键
@@ -61,12 +81,23 @@ function doGetPluginParam(){
     result.data["Schema"]   = Schema;
     result.data["Table"]    = Table;
     result.data["BatchSize"] = parseInt(BatchSize);
+    if (ParallelCount != "" && ParallelCount != null){
+        result.data["ParallelCount"] = parseInt(ParallelCount);
+    }
     if (NullTransferDefault == "true"){
         result.data["NullTransferDefault"] = true;
     }else{
         result.data["NullTransferDefault"] = false;
     }
     result.data["SyncMode"] = SyncMode;
+    if (ConflictPolicy != ""){
+        result.data["ConflictPolicy"] = ConflictPolicy;
+        result.data["ConflictTimeField"] = ConflictTimeField;
+        result.data["ConflictErrorTable"] = ConflictErrorTable;
+    }
+    if (LoopMarkerTable != ""){
+        result.data["LoopMarkerTable"] = LoopMarkerTable;
+    }
 	return result;
 }
 
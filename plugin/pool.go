@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/brokercap/Bifrost/plugin/driver"
 	pluginStorage "github.com/brokercap/Bifrost/plugin/storage"
+	"github.com/brokercap/Bifrost/server/secret"
 	"log"
 	"runtime/debug"
 	"sync"
@@ -15,6 +16,7 @@ type ToServerConn struct {
 	toServerKey string
 	conn        driver.Driver
 	updateTime  int64
+	uri         string // 替换了 ${env:X} ${file:/path} 引用 之后的连接地址, 插件 重连 的时候 使用
 }
 
 var l sync.RWMutex
@@ -39,6 +41,7 @@ func (This *ToServerConn) checkClose(t *pluginStorage.ToServer) {
 			}
 			This.updateTime = t.UpdateTime
 		}()
+		This.uri = secret.ResolveUri(t.ConnUri)
 		This.conn.Close()
 	}
 }
@@ -107,24 +110,21 @@ func startPlugin(ToServerKey string) (toServerConn *ToServerConn) {
 	if t == nil {
 		return nil
 	}
-	var F driver.Driver
-	var ConnId int
-	F = driver.Open(t.PluginName, &t.ConnUri)
-	if F == nil {
+	toServerConn = &ToServerConn{
+		toServerKey: ToServerKey,
+		updateTime:  t.UpdateTime,
+		uri:         secret.ResolveUri(t.ConnUri),
+	}
+	toServerConn.conn = driver.Open(t.PluginName, &toServerConn.uri)
+	if toServerConn.conn == nil {
 		return nil
 	}
 	t.Lock()
 	t.LastID++
-	ConnId = t.LastID
+	toServerConn.id = t.LastID
 	t.Unlock()
-	toServerConn = &ToServerConn{
-		id:          ConnId,
-		toServerKey: ToServerKey,
-		conn:        F,
-		updateTime:  t.UpdateTime,
-	}
 	l.Lock()
-	ToServerConnList[ToServerKey][ConnId] = toServerConn
+	ToServerConnList[ToServerKey][toServerConn.id] = toServerConn
 	l.Unlock()
 	return
 }
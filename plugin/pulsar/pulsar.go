@@ -0,0 +1,9 @@
+package main
+
+import (
+	_ "github.com/brokercap/Bifrost/plugin/pulsar/src"
+)
+
+func main() {
+
+}
@@ -0,0 +1,113 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package src
+
+import (
+	"fmt"
+	"github.com/apache/pulsar-client-go/pulsar"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func ParseDSN(dsn string) (params map[string]string) {
+	params = make(map[string]string, 0)
+	if dsn == "" {
+		return
+	}
+	var index int
+	var addr string
+	var paramStr string
+	index = strings.Index(dsn, "?")
+	//  pulsar://127.0.0.1:6650,192.168.1.100:6650?token=xxx&operation.timeout=30
+	// ==> pulsar://127.0.0.1:6650,192.168.1.100:6650  token=xxx   operation.timeout=30
+	if index <= 0 {
+		addr = dsn
+	} else {
+		addr = dsn[0:index]
+		paramStr = dsn[index+1:]
+	}
+	params["addr"] = addr
+	if paramStr == "" {
+		return
+	}
+	for _, v := range strings.Split(paramStr, "&") {
+		param := strings.SplitN(v, "=", 2)
+		if len(param) != 2 {
+			continue
+		}
+		params[param[0]] = param[1]
+	}
+	return params
+}
+
+// 连接参数
+// token : jwt token 认证
+// auth.tls.cert , auth.tls.key : tls 证书认证
+// tls.trust.certs.file : 服务端证书 ca
+// tls.allow.insecure : 是否允许不校验服务端证书
+// tls.validate.hostname : 是否校验服务端证书的 hostname
+// connection.timeout , operation.timeout : 单位 秒
+func getPulsarClientOptions(config map[string]string) (options pulsar.ClientOptions, err error) {
+	addr := config["addr"]
+	if addr == "" {
+		return options, fmt.Errorf("pulsar addr can't be empty")
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "pulsar://" + addr
+	}
+	options.URL = addr
+	if token, ok := config["token"]; ok && token != "" {
+		options.Authentication = pulsar.NewAuthenticationToken(token)
+	}
+	if config["auth.tls.cert"] != "" || config["auth.tls.key"] != "" {
+		if config["auth.tls.cert"] == "" || config["auth.tls.key"] == "" {
+			return options, fmt.Errorf("auth.tls.cert and auth.tls.key must be set at the same time")
+		}
+		options.Authentication = pulsar.NewAuthenticationTLS(config["auth.tls.cert"], config["auth.tls.key"])
+	}
+	options.TLSTrustCertsFilePath = config["tls.trust.certs.file"]
+	if _, ok := config["tls.allow.insecure"]; ok {
+		if options.TLSAllowInsecureConnection, err = strconv.ParseBool(config["tls.allow.insecure"]); err != nil {
+			return options, fmt.Errorf("tls.allow.insecure:%s", err)
+		}
+	}
+	if _, ok := config["tls.validate.hostname"]; ok {
+		if options.TLSValidateHostname, err = strconv.ParseBool(config["tls.validate.hostname"]); err != nil {
+			return options, fmt.Errorf("tls.validate.hostname:%s", err)
+		}
+	}
+	if options.ConnectionTimeout, err = getSecondParam(config, "connection.timeout"); err != nil {
+		return options, err
+	}
+	if options.OperationTimeout, err = getSecondParam(config, "operation.timeout"); err != nil {
+		return options, err
+	}
+	return options, nil
+}
+
+func getSecondParam(config map[string]string, key string) (time.Duration, error) {
+	val, ok := config[key]
+	if !ok || val == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s:%s must be uint", key, val)
+	}
+	return time.Duration(n) * time.Second, nil
+}
@@ -0,0 +1,387 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package src
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/apache/pulsar-client-go/pulsar"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"sync"
+	"time"
+)
+
+const VERSION = "v2.0.5"
+const BIFROST_VERION = "v2.0.5"
+
+func init() {
+	pluginDriver.Register("pulsar", NewConn, VERSION, BIFROST_VERION)
+}
+
+const (
+	RUNNING int8 = 1
+	CLOSED  int8 = 0
+)
+
+// pulsar.Producer 中用到的方法,方便测试的时候 mock
+type Producer interface {
+	SendAsync(context.Context, *pulsar.ProducerMessage, func(pulsar.MessageID, *pulsar.ProducerMessage, error))
+	Close()
+}
+
+type Conn struct {
+	pluginDriver.PluginDriverInterface
+	Uri         *string
+	status      int8
+	err         error
+	p           *PluginParam
+	client      pulsar.Client
+	producers   map[string]Producer // topic => producer
+	newProducer func(topic string) (Producer, error)
+}
+
+type PluginParam struct {
+	OtherObjectType      pluginDriver.OtherObjectType
+	Topic                string
+	Key                  string
+	BatchSize            int
+	Timeout              int
+	BifrostFilterQuery   bool // bifrost server 保留,是否过滤sql事件
+	BifrostMustBeSuccess bool // bifrost server 保留,数据是否能丢
+
+	dataList   []*pulsarMessage
+	commitList []*pulsarCommit
+}
+
+type pulsarMessage struct {
+	topic string
+	msg   *pulsar.ProducerMessage
+}
+
+// commit 事件 及 在它之前 还没有发送的数据条数
+// 前 n 条数据全部被 broker 确认之后,这个 commit 事件的位点才能返回
+type pulsarCommit struct {
+	n    int
+	data *pluginDriver.PluginDataType
+}
+
+func NewConn() pluginDriver.Driver {
+	f := &Conn{
+		status: CLOSED,
+	}
+	return f
+}
+
+func (This *Conn) SetOption(uri *string, param map[string]interface{}) {
+	This.Uri = uri
+	return
+}
+
+func (This *Conn) Open() error {
+	This.Connect()
+	return nil
+}
+
+func (This *Conn) GetUriExample() string {
+	return "pulsar://127.0.0.1:6650,127.0.0.1:6651?token=xxx"
+}
+
+func (This *Conn) CheckUri() error {
+	options, err := getPulsarClientOptions(ParseDSN(*This.Uri))
+	if err != nil {
+		This.err = err
+		return err
+	}
+	client, err := pulsar.NewClient(options)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	// NewClient 不会建立连接,这里查询一次 topic 分区,校验是否能连上 broker
+	_, err = client.TopicPartitions("bifrost_check_uri")
+	return err
+}
+
+func (This *Conn) newClient() bool {
+	options, err := getPulsarClientOptions(ParseDSN(*This.Uri))
+	if err != nil {
+		This.err = err
+		return false
+	}
+	This.client, This.err = pulsar.NewClient(options)
+	if This.err != nil {
+		return false
+	}
+	This.producers = make(map[string]Producer, 0)
+	This.newProducer = This.createProducer
+	This.status = RUNNING
+	return true
+}
+
+func (This *Conn) createProducer(topic string) (Producer, error) {
+	options := pulsar.ProducerOptions{
+		Topic: topic,
+	}
+	// Timeout <= 0 不超时
+	if This.p.Timeout > 0 {
+		options.SendTimeout = time.Duration(This.p.Timeout) * time.Second
+	} else {
+		options.SendTimeout = -1
+	}
+	return This.client.CreateProducer(options)
+}
+
+func (This *Conn) getProducer(topic string) (Producer, error) {
+	if producer, ok := This.producers[topic]; ok {
+		return producer, nil
+	}
+	producer, err := This.newProducer(topic)
+	if err != nil {
+		return nil, err
+	}
+	This.producers[topic] = producer
+	return producer, nil
+}
+
+func (This *Conn) Connect() bool {
+	This.err = fmt.Errorf("no client")
+	This.status = CLOSED
+	return true
+}
+
+func (This *Conn) GetParam(p interface{}) (interface{}, error) {
+	s, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	param := &PluginParam{Timeout: 10}
+	err2 := json.Unmarshal(s, param)
+	if err2 != nil {
+		return nil, err2
+	}
+	if param.Topic == "" {
+		return nil, fmt.Errorf("Topic can't be empty")
+	}
+	if param.BatchSize <= 0 {
+		param.BatchSize = 1
+	}
+	if param.Timeout == 0 {
+		param.Timeout = 10
+	}
+	if param.Timeout < 0 {
+		param.Timeout = 0
+	}
+	if len(param.dataList) == 0 {
+		param.dataList = make([]*pulsarMessage, 0)
+		param.commitList = make([]*pulsarCommit, 0)
+	}
+	This.p = param
+	return param, nil
+}
+
+func (This *Conn) SetParam(p interface{}) (interface{}, error) {
+	if p == nil {
+		return nil, fmt.Errorf("param is nil")
+	}
+	switch p.(type) {
+	case *PluginParam:
+		This.p = p.(*PluginParam)
+		return p, nil
+	default:
+		return This.GetParam(p)
+	}
+}
+
+func (This *Conn) ReConnect() bool {
+	This.closeClient()
+	return This.newClient()
+}
+
+func (This *Conn) closeClient() {
+	defer func() {
+		if err := recover(); err != nil {
+			return
+		}
+	}()
+	for topic, producer := range This.producers {
+		producer.Close()
+		delete(This.producers, topic)
+	}
+	if This.client != nil {
+		This.client.Close()
+	}
+	This.client = nil
+}
+
+func (This *Conn) Close() bool {
+	This.closeClient()
+	This.status = CLOSED
+	return true
+}
+
+func (This *Conn) Insert(data *pluginDriver.PluginDataType, retry bool) (*pluginDriver.PluginDataType, *pluginDriver.PluginDataType, error) {
+	return This.sendToList(data, retry, false)
+}
+
+func (This *Conn) Update(data *pluginDriver.PluginDataType, retry bool) (*pluginDriver.PluginDataType, *pluginDriver.PluginDataType, error) {
+	return This.sendToList(data, retry, false)
+}
+
+func (This *Conn) Del(data *pluginDriver.PluginDataType, retry bool) (*pluginDriver.PluginDataType, *pluginDriver.PluginDataType, error) {
+	return This.sendToList(data, retry, false)
+}
+
+func (This *Conn) Query(data *pluginDriver.PluginDataType, retry bool) (*pluginDriver.PluginDataType, *pluginDriver.PluginDataType, error) {
+	return This.sendToList(data, retry, false)
+}
+
+func (This *Conn) Commit(data *pluginDriver.PluginDataType, retry bool) (*pluginDriver.PluginDataType, *pluginDriver.PluginDataType, error) {
+	return This.sendToList(data, retry, true)
+}
+
+func (This *Conn) getMsg(data *pluginDriver.PluginDataType) (*pulsarMessage, error) {
+	Topic := fmt.Sprint(pluginDriver.TransfeResult(This.p.Topic, data, len(data.Rows)-1))
+	msg := &pulsar.ProducerMessage{}
+	if This.p.Key != "" {
+		msg.Key = fmt.Sprint(pluginDriver.TransfeResult(This.p.Key, data, len(data.Rows)-1))
+	}
+	toOtherObjectTypeData, _ := pluginDriver.ToOtherObject(data, This.p.OtherObjectType)
+	c, err := json.Marshal(toOtherObjectTypeData)
+	if err != nil {
+		return nil, err
+	}
+	msg.Payload = c
+	return &pulsarMessage{topic: Topic, msg: msg}, nil
+}
+
+func (This *Conn) sendToList(data *pluginDriver.PluginDataType, retry bool, isCommit bool) (LastSuccessCommitData *pluginDriver.PluginDataType, Errdata *pluginDriver.PluginDataType, err error) {
+	// retry == true 的时候,数据在上一次调用的时候 已经放到 list 里了
+	if data != nil && retry == false {
+		// 假如 非 commit 事件 或者 没有过滤 sql 事件，则需要将数据放到  list 里
+		if !isCommit || !This.p.BifrostFilterQuery {
+			msg, err := This.getMsg(data)
+			if err != nil {
+				// 序列化失败,重试也不会成功,数据允许丢失的情况下 直接跳过这条数据
+				if !This.p.BifrostMustBeSuccess {
+					return nil, nil, nil
+				}
+				return nil, data, err
+			}
+			This.p.dataList = append(This.p.dataList, msg)
+		}
+		if isCommit {
+			This.p.commitList = append(This.p.commitList, &pulsarCommit{n: len(This.p.dataList), data: data})
+		}
+	}
+	// 超时提交的时候,将所有数据都发送出去
+	LastSuccessCommitData, err = This.flush(data == nil)
+	if err != nil {
+		if !This.p.BifrostMustBeSuccess {
+			// 数据允许丢失,丢弃这一批数据,位点继续往后走
+			return This.dropBatch(), nil, nil
+		}
+		return nil, nil, err
+	}
+	return LastSuccessCommitData, nil, nil
+}
+
+// 每 BatchSize 条数据发送一次,all == true 的时候 不满 BatchSize 也发送
+// 返回 已经被 broker 确认的数据中 最后一个 commit 事件
+func (This *Conn) flush(all bool) (*pluginDriver.PluginDataType, error) {
+	for len(This.p.dataList) >= This.p.BatchSize || (all && len(This.p.dataList) > 0) {
+		n := This.p.BatchSize
+		if n > len(This.p.dataList) {
+			n = len(This.p.dataList)
+		}
+		if err := This.sendBatch(This.p.dataList[:n]); err != nil {
+			return nil, err
+		}
+		This.removeData(n)
+	}
+	return This.popCommit(), nil
+}
+
+func (This *Conn) removeData(n int) {
+	This.p.dataList = This.p.dataList[n:]
+	for _, c := range This.p.commitList {
+		c.n -= n
+	}
+}
+
+// 返回并移除 前面的数据都已经被确认的 commit 事件 中最后一个
+func (This *Conn) popCommit() *pluginDriver.PluginDataType {
+	var data *pluginDriver.PluginDataType
+	var i int
+	for i = 0; i < len(This.p.commitList); i++ {
+		if This.p.commitList[i].n > 0 {
+			break
+		}
+		data = This.p.commitList[i].data
+	}
+	This.p.commitList = This.p.commitList[i:]
+	return data
+}
+
+func (This *Conn) dropBatch() *pluginDriver.PluginDataType {
+	n := This.p.BatchSize
+	if n > len(This.p.dataList) {
+		n = len(This.p.dataList)
+	}
+	This.removeData(n)
+	return This.popCommit()
+}
+
+// 异步发送一批数据,等待所有数据都被 broker 确认之后 再返回
+// 有一条失败,整批数据重新发送
+func (This *Conn) sendBatch(list []*pulsarMessage) (err error) {
+	if This.status != RUNNING {
+		This.ReConnect()
+		if This.status != RUNNING {
+			return This.err
+		}
+	}
+	var wg sync.WaitGroup
+	var l sync.Mutex
+	callback := func(id pulsar.MessageID, msg *pulsar.ProducerMessage, sendErr error) {
+		if sendErr != nil {
+			l.Lock()
+			if err == nil {
+				err = sendErr
+			}
+			l.Unlock()
+		}
+		wg.Done()
+	}
+	for _, m := range list {
+		producer, producerErr := This.getProducer(m.topic)
+		if producerErr != nil {
+			l.Lock()
+			err = producerErr
+			l.Unlock()
+			break
+		}
+		wg.Add(1)
+		producer.SendAsync(context.Background(), m.msg, callback)
+	}
+	wg.Wait()
+	return err
+}
+
+func (This *Conn) TimeOutCommit() (*pluginDriver.PluginDataType, *pluginDriver.PluginDataType, error) {
+	return This.sendToList(nil, true, false)
+}
@@ -0,0 +1,152 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/brokercap/Bifrost/sdk/pluginTestData"
+	"sync"
+	"testing"
+)
+
+var mockLock sync.Mutex
+
+type mockProducer struct {
+	topic string
+	msgs  *[]*pulsar.ProducerMessage
+	err   *error
+}
+
+func (p *mockProducer) SendAsync(ctx context.Context, msg *pulsar.ProducerMessage, callback func(pulsar.MessageID, *pulsar.ProducerMessage, error)) {
+	// 模拟 broker 异步确认
+	go func() {
+		mockLock.Lock()
+		err := *p.err
+		if err == nil {
+			*p.msgs = append(*p.msgs, msg)
+		}
+		mockLock.Unlock()
+		callback(nil, msg, err)
+	}()
+}
+
+func (p *mockProducer) Close() {}
+
+func newMockConn(t *testing.T, param map[string]interface{}) (*Conn, map[string]*[]*pulsar.ProducerMessage, *error) {
+	c := NewConn().(*Conn)
+	if _, err := c.SetParam(param); err != nil {
+		t.Fatal(err)
+	}
+	topicMsgs := make(map[string]*[]*pulsar.ProducerMessage, 0)
+	var sendErr error
+	c.status = RUNNING
+	c.producers = make(map[string]Producer, 0)
+	c.newProducer = func(topic string) (Producer, error) {
+		msgs := make([]*pulsar.ProducerMessage, 0)
+		topicMsgs[topic] = &msgs
+		return &mockProducer{topic: topic, msgs: &msgs, err: &sendErr}, nil
+	}
+	return c, topicMsgs, &sendErr
+}
+
+func TestConn_Batch(t *testing.T) {
+	c, topicMsgs, _ := newMockConn(t, map[string]interface{}{
+		"Topic":                "{$SchemaName}_{$TableName}",
+		"Key":                  "{$id}",
+		"BatchSize":            3,
+		"BifrostFilterQuery":   true,
+		"BifrostMustBeSuccess": true,
+	})
+	e := pluginTestData.NewEvent()
+	topic := e.Schema + "_" + e.Talbe
+
+	insertData := e.GetTestInsertData()
+	if lastSuccess, _, err := c.Insert(insertData, false); err != nil || lastSuccess != nil {
+		t.Fatal("not full batch, must be nil", lastSuccess, err)
+	}
+	commitData1 := e.GetTestCommitData()
+	if lastSuccess, _, err := c.Commit(commitData1, false); err != nil || lastSuccess != nil {
+		t.Fatal("commit must be return after broker ack", lastSuccess, err)
+	}
+	c.Update(e.GetTestUpdateData(), false)
+	// 第一批 3 条数据发送成功, commitData1 在第一批数据中
+	lastSuccess, _, err := c.Del(e.GetTestDeleteData(), false)
+	if err != nil || lastSuccess != commitData1 {
+		t.Fatal("lastSuccess must be commitData1", lastSuccess, err)
+	}
+	msgs := topicMsgs[topic]
+	if msgs == nil || len(*msgs) != 3 {
+		t.Fatal("batch send error", topicMsgs)
+	}
+	var keyFound bool
+	for _, msg := range *msgs {
+		if msg.Key == "" || len(msg.Payload) == 0 {
+			t.Fatal("msg error", msg.Key, string(msg.Payload))
+		}
+		if msg.Key == fmt.Sprint(insertData.Rows[0]["id"]) {
+			keyFound = true
+		}
+	}
+	if !keyFound {
+		t.Fatal("key of insert data not found")
+	}
+	c.Insert(e.GetTestInsertData(), false)
+	commitData2 := e.GetTestCommitData()
+	if lastSuccess, _, err = c.Commit(commitData2, false); err != nil || lastSuccess != nil {
+		t.Fatal("commitData2 must be return after broker ack", lastSuccess, err)
+	}
+	lastSuccess, _, err = c.TimeOutCommit()
+	if err != nil || lastSuccess != commitData2 || len(*msgs) != 4 {
+		t.Fatal("TimeOutCommit error", lastSuccess, err, len(*msgs))
+	}
+	// 没有数据的 commit 事件,直接返回
+	commitData3 := e.GetTestCommitData()
+	if lastSuccess, _, err = c.Commit(commitData3, false); err != nil || lastSuccess != commitData3 {
+		t.Fatal("commit without data error", lastSuccess, err)
+	}
+}
+
+func TestConn_MustBeSuccess(t *testing.T) {
+	c, topicMsgs, sendErr := newMockConn(t, map[string]interface{}{
+		"Topic":                "bifrost_test",
+		"BatchSize":            1,
+		"BifrostMustBeSuccess": true,
+	})
+	e := pluginTestData.NewEvent()
+	*sendErr = fmt.Errorf("broker not available")
+	if _, _, err := c.Insert(e.GetTestInsertData(), false); err == nil {
+		t.Fatal("must be error")
+	}
+	commitData := e.GetTestCommitData()
+	if lastSuccess, _, err := c.Commit(commitData, false); err == nil || lastSuccess != nil {
+		t.Fatal("must be error and not return position", lastSuccess)
+	}
+	*sendErr = nil
+	lastSuccess, _, err := c.Commit(commitData, true)
+	if err != nil || lastSuccess != commitData || len(*topicMsgs["bifrost_test"]) != 2 {
+		t.Fatal("retry error", lastSuccess, err)
+	}
+
+	// 数据允许丢失,发送失败的数据丢弃,位点继续往后走
+	c.p.BifrostMustBeSuccess = false
+	*sendErr = fmt.Errorf("broker not available")
+	c.Insert(e.GetTestInsertData(), false)
+	commitData = e.GetTestCommitData()
+	lastSuccess, _, err = c.Commit(commitData, false)
+	if err != nil || lastSuccess != commitData || len(c.p.dataList) != 0 {
+		t.Fatal("BifrostMustBeSuccess = false error", lastSuccess, err)
+	}
+}
+
+func TestGetPulsarClientOptions(t *testing.T) {
+	options, err := getPulsarClientOptions(ParseDSN("127.0.0.1:6650?token=abc&operation.timeout=30&tls.allow.insecure=true"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.URL != "pulsar://127.0.0.1:6650" || options.Authentication == nil || options.OperationTimeout.Seconds() != 30 || !options.TLSAllowInsecureConnection {
+		t.Fatal("options error", options)
+	}
+	if _, err = getPulsarClientOptions(ParseDSN("pulsar+ssl://127.0.0.1:6651?auth.tls.cert=a.pem")); err == nil {
+		t.Fatal("auth.tls.key must be set")
+	}
+}
@@ -0,0 +1,63 @@
+function doGetPluginParam(){
+	var result = {data:{},status:false,msg:"error",batchSupport:true}
+    var data = {};
+
+	var Topic = $("#Pulsar_Topic").val();
+	var Key = $("#Pulsar_Key").val();
+	var BatchSize = $("#Pulsar_BatchSize").val();
+    var Timeout = $("#Pulsar_Timeout").val();
+    var OtherObjectType = $("#Pulsar_OtherObjectType").val();
+
+    if (Topic == ""){
+		result.msg = "Topic can't be empty"
+        return result;
+    }
+
+    if (BatchSize == "" || BatchSize == null || isNaN(BatchSize) || BatchSize < 1 ){
+		result.msg = "BatchSize must be uint!";
+        return result;
+    }
+    if (Timeout == "" || Timeout == null || isNaN(Timeout)){
+        result.msg = "Timeout must be int!";
+        return result;
+    }
+
+	data["Topic"] = Topic;
+	data["Key"] = Key;
+	data["BatchSize"] = parseInt(BatchSize);
+    data["Timeout"] = parseInt(Timeout);
+    data["OtherObjectType"] = OtherObjectType;
+
+	result.data = data;
+	result.msg = "success";
+	result.status = true;
+    return result;
+}
+
+function initPulsarSupportedOtherOutputTypeList(){
+    $.get(
+        "/plugin/getSupportedOtherOutputTypeList",
+        function (d, status) {
+            if (status != "success") {
+                return false;
+            }
+            var html = "";
+            var defaultValue = null;
+            for (var i in d) {
+                var typeName = d[i].name;
+                var value = d[i].value;
+                if (defaultValue == null) {
+                    defaultValue = value
+                }
+                html += "<option value=\"" + value + "\">" + typeName + "</option>";
+            }
+            $("#Pulsar_OtherObjectType").html(html);
+            if (defaultValue != null) {
+                $("#Pulsar_OtherObjectType").val(defaultValue);
+            }
+        }, 'json');
+}
+
+initPulsarSupportedOtherOutputTypeList();
+
+setPluginParamDefault("FilterQuery",false);
\ No newline at end of file
@@ -3,6 +3,7 @@ package plugin
 import (
 	"encoding/json"
 	pluginStorage "github.com/brokercap/Bifrost/plugin/storage"
+	"github.com/brokercap/Bifrost/server/secret"
 	"log"
 )
 
@@ -14,10 +15,15 @@ func Recovery(data *json.RawMessage) {
 		return
 	}
 	for name, v := range toData {
+		// 配置了 master key 的情况下, 保存的是 加密之后的连接地址
+		ConnUri, err := secret.Decrypt(v.ConnUri)
+		if err != nil {
+			log.Println("ToServerKey:", name, "ConnUri decrypt err:", err)
+		}
 		pluginStorage.SetToServerInfo(name,
 			pluginStorage.ToServer{
 				PluginName: v.PluginName,
-				ConnUri:    v.ConnUri,
+				ConnUri:    ConnUri,
 				Notes:      v.Notes,
 				MaxConn:    v.MaxConn,
 				MinConn:    v.MinConn,
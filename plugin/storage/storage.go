@@ -3,6 +3,7 @@ package storage
 import (
 	"encoding/json"
 	"github.com/brokercap/Bifrost/plugin/driver"
+	"github.com/brokercap/Bifrost/server/secret"
 	"log"
 	"sync"
 	"time"
@@ -121,6 +122,38 @@ func DelToServerInfo(key string) bool {
 	return true
 }
 
+// 更新 配置修改时间, 连接池中的连接 下次使用的时候 重新连接
+// 用于 ToServer 同步 重新启动的时候, 重新读取 连接地址 中 ${env:X} ${file:/path} 引用 的密码
+func RefreshToServerUpdateTime(ToServerKey string) {
+	l.Lock()
+	if _, ok := ToServerMap[ToServerKey]; ok {
+		ToServerMap[ToServerKey].UpdateTime = time.Now().UnixNano()
+	}
+	l.Unlock()
+}
+
+// 复制一份 ToServer 配置, 连接地址 经过 uriFun 转换, 用于 加密保存 及 接口返回的时候 密码脱敏
+func GetToServerMapByUri(uriFun func(string) string) map[string]*ToServer {
+	l.Lock()
+	defer l.Unlock()
+	data := make(map[string]*ToServer, len(ToServerMap))
+	for key, t := range ToServerMap {
+		data[key] = &ToServer{
+			PluginName:    t.PluginName,
+			PluginVersion: t.PluginVersion,
+			ConnUri:       uriFun(t.ConnUri),
+			Notes:         t.Notes,
+			LastID:        t.LastID,
+			CurrentConn:   t.CurrentConn,
+			MaxConn:       t.MaxConn,
+			MinConn:       t.MinConn,
+			AvailableConn: t.AvailableConn,
+			UpdateTime:    t.UpdateTime,
+		}
+	}
+	return data
+}
+
 func Recovery(data *json.RawMessage) {
 	var toData map[string]ToServer
 	errors := json.Unmarshal([]byte(*data), &toData)
@@ -129,10 +162,14 @@ func Recovery(data *json.RawMessage) {
 		return
 	}
 	for name, v := range toData {
+		ConnUri, err := secret.Decrypt(v.ConnUri)
+		if err != nil {
+			log.Println("ToServerKey:", name, "ConnUri decrypt err:", err)
+		}
 		SetToServerInfo(name,
 			ToServer{
 				PluginName: v.PluginName,
-				ConnUri:    v.ConnUri,
+				ConnUri:    ConnUri,
 				Notes:      v.Notes,
 				MaxConn:    v.MaxConn,
 				MinConn:    v.MinConn,
@@ -142,5 +179,5 @@ func Recovery(data *json.RawMessage) {
 }
 
 func SaveToServerData() interface{} {
-	return ToServerMap
+	return GetToServerMapByUri(secret.Encrypt)
 }
@@ -128,6 +128,7 @@ type BifrostManager struct {
 	Host         string
 	User         string
 	Pwd          string
+	Token        string // API Token, 不为空的时候 不登入, 请求带上 Authorization: Bearer <Token>
 	CurCookies   []*http.Cookie
 	CurCookieJar *cookiejar.Jar //管理cookie
 	MysqlConn    *MySQLConn
@@ -136,7 +137,9 @@ type BifrostManager struct {
 func (This *BifrostManager) Init() {
 	This.CurCookies = nil
 	This.CurCookieJar, _ = cookiejar.New(nil)
-	This.DoLogin()
+	if This.Token == "" {
+		This.DoLogin()
+	}
 	log.Println(This.MysqlConn.Uri)
 	This.MysqlConn.DBConnect()
 }
@@ -168,6 +171,9 @@ func (This *BifrostManager) getUrlRespHtml(API string, postDict map[string]strin
 		httpReq, _ = http.NewRequest("POST", strUrl, postBytesReader)
 		httpReq.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	}
+	if This.Token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+This.Token)
+	}
 
 	httpResp, err := httpClient.Do(httpReq)
 	if err != nil {
@@ -0,0 +1,194 @@
+package audit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brokercap/Bifrost/config"
+	"github.com/brokercap/Bifrost/server/secret"
+	"github.com/brokercap/Bifrost/server/storage"
+)
+
+/*
+管理后台 写操作 的审计日志, 只追加, 不提供修改及删除接口
+超过 audit_log_retention_days 天的日志 定时清理
+*/
+
+const AUDIT_PREFIX string = "bifrost_AuditLog_"
+
+type AuditLog struct {
+	ID       string
+	Time     int64
+	UserName string
+	Ip       string
+	Uri      string
+	DbName   string
+	Param    json.RawMessage // 请求参数, 密码等敏感信息 已脱敏
+	Before   json.RawMessage // 操作之前 对象的配置
+	After    json.RawMessage // 操作之后 对象的配置
+	Status   int
+	Msg      string
+}
+
+type Query struct {
+	StartTime int64
+	EndTime   int64
+	UserName  string
+	Uri       string
+	DbName    string
+	Limit     int
+}
+
+var initOnce sync.Once
+
+// 启动 定时清理 过期的审计日志
+func InitAudit() {
+	initOnce.Do(func() {
+		go func() {
+			for {
+				cleanExpired(config.AuditLogRetentionDays)
+				time.Sleep(time.Hour)
+			}
+		}()
+	})
+}
+
+// key 为 前缀 + 纳秒时间戳, 按 key 排序 即为 时间顺序
+func getAuditKey(ID string) string {
+	return AUDIT_PREFIX + ID
+}
+
+func Add(auditLog *AuditLog) error {
+	now := time.Now()
+	b := make([]byte, 2)
+	_, _ = rand.Read(b)
+	auditLog.ID = fmt.Sprintf("%d-%s", now.UnixNano(), hex.EncodeToString(b))
+	auditLog.Time = now.Unix()
+	data, err := json.Marshal(auditLog)
+	if err != nil {
+		return err
+	}
+	err = storage.PutKeyVal([]byte(getAuditKey(auditLog.ID)), data)
+	if err != nil {
+		log.Println("audit log save err:", err, " Uri:", auditLog.Uri, " UserName:", auditLog.UserName)
+	}
+	return err
+}
+
+// 按时间倒序 返回
+func GetList(q Query) []AuditLog {
+	dataList := storage.GetListByPrefix([]byte(AUDIT_PREFIX))
+	sort.Slice(dataList, func(i, j int) bool {
+		return dataList[i].Key > dataList[j].Key
+	})
+	list := make([]AuditLog, 0)
+	for _, v := range dataList {
+		var auditLog AuditLog
+		if err := json.Unmarshal([]byte(v.Value), &auditLog); err != nil {
+			continue
+		}
+		if !q.match(&auditLog) {
+			continue
+		}
+		list = append(list, auditLog)
+		if q.Limit > 0 && len(list) >= q.Limit {
+			break
+		}
+	}
+	return list
+}
+
+func (q *Query) match(auditLog *AuditLog) bool {
+	if q.StartTime > 0 && auditLog.Time < q.StartTime {
+		return false
+	}
+	if q.EndTime > 0 && auditLog.Time > q.EndTime {
+		return false
+	}
+	if q.UserName != "" && auditLog.UserName != q.UserName {
+		return false
+	}
+	if q.Uri != "" && !strings.HasPrefix(auditLog.Uri, q.Uri) {
+		return false
+	}
+	if q.DbName != "" && auditLog.DbName != q.DbName {
+		return false
+	}
+	return true
+}
+
+func cleanExpired(retentionDays int) {
+	if retentionDays <= 0 {
+		return
+	}
+	// 纳秒时间戳 位数一样, 可以直接 按字符串比较
+	expiredKey := getAuditKey(fmt.Sprintf("%d", time.Now().AddDate(0, 0, -retentionDays).UnixNano()))
+	for _, v := range storage.GetListByPrefix([]byte(AUDIT_PREFIX)) {
+		if v.Key < expiredKey {
+			storage.DelKeyVal([]byte(v.Key))
+		}
+	}
+}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, v := range []string{"password", "passwd", "secret", "token"} {
+		if strings.Contains(key, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func mask(data interface{}) interface{} {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			if str, ok := val.(string); ok {
+				if isSecretKey(key) {
+					if str != "" {
+						v[key] = secret.MASK
+					}
+				} else {
+					v[key] = secret.MaskUri(str)
+				}
+				continue
+			}
+			v[key] = mask(val)
+		}
+	case []interface{}:
+		for i, val := range v {
+			v[i] = mask(val)
+		}
+	case string:
+		return secret.MaskUri(v)
+	}
+	return data
+}
+
+// 对象 转换成 json, 并且 密码等敏感信息 脱敏
+func Marshal(obj interface{}) json.RawMessage {
+	if obj == nil {
+		return nil
+	}
+	b, ok := obj.([]byte)
+	if !ok {
+		var err error
+		if b, err = json.Marshal(obj); err != nil {
+			return nil
+		}
+	}
+	var data interface{}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil
+	}
+	b, _ = json.Marshal(mask(data))
+	return b
+}
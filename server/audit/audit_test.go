@@ -0,0 +1,42 @@
+package audit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	obj := map[string]interface{}{
+		"DbName":   "mysqlTest",
+		"Uri":      "root:root123@tcp(127.0.0.1:3306)/test",
+		"Password": "Bifrost123",
+		"PluginParam": map[string]interface{}{
+			"Secret": "abc",
+			"List":   []interface{}{"a:b@tcp(c)"},
+		},
+	}
+	s := string(Marshal(obj))
+	for _, secret := range []string{"root123", "Bifrost123", "abc", ":b@"} {
+		if strings.Contains(s, secret) {
+			t.Fatal("secret:", secret, "not masked:", s)
+		}
+	}
+	if !strings.Contains(s, "mysqlTest") {
+		t.Fatal("Marshal error:", s)
+	}
+	if Marshal(nil) != nil {
+		t.Fatal("nil must be nil")
+	}
+}
+
+func TestQuery_match(t *testing.T) {
+	auditLog := &AuditLog{Time: 100, UserName: "Bifrost", Uri: "/table/toserver/deal", DbName: "mysqlTest"}
+	if !(&Query{StartTime: 50, EndTime: 100, Uri: "/table/", UserName: "Bifrost", DbName: "mysqlTest"}).match(auditLog) {
+		t.Fatal("match must be true")
+	}
+	for _, q := range []Query{{StartTime: 101}, {EndTime: 99}, {UserName: "other"}, {Uri: "/db/"}, {DbName: "other"}} {
+		if q.match(auditLog) {
+			t.Fatal("match must be false:", q)
+		}
+	}
+}
@@ -41,6 +41,10 @@ func (db *db) Callback(data *outputDriver.PluginDataType) {
 	default:
 		break
 	}
+	if isSnapshotWatermarkEvent(data) {
+		db.callbackSnapshotWatermark(data)
+		return
+	}
 	if db.Callback0(data) == false {
 		return
 	}
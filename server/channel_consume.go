@@ -174,6 +174,8 @@ func (This *consume_channel_obj) transferToPluginData(data *mysql.EventReslut) (
 		Pri:            data.Pri,
 		ColumnMapping:  data.ColumnMapping,
 		EventID:        data.EventID,
+		PresentColumns: data.PresentColumns,
+		RowsQuery:      data.RowsQuery,
 	}
 	return
 }
@@ -291,7 +293,13 @@ func (This *consume_channel_obj) sendToServerList(key string, pluginData *plugin
 }
 
 func (This *consume_channel_obj) sendToServerList0(toServerList []*ToServer, pluginData *pluginDriver.PluginDataType) {
+	isSnapshotWatermark := isSnapshotWatermarkEvent(pluginData)
 	for _, toServerInfo := range toServerList {
+		// 水位表的数据 只用于全量, 不提交给插件
+		if isSnapshotWatermark {
+			This.sendSnapshotWatermark(toServerInfo, pluginData)
+			continue
+		}
 		if toServerInfo.FilterQuery && pluginData.EventType == "sql" {
 			if pluginData.Query != "COMMIT" {
 				continue
@@ -312,6 +320,7 @@ func (This *consume_channel_obj) sendToServerList0(toServerList []*ToServer, plu
 				continue
 			}
 		*/
+		toServerInfo.snapshotRecordChangedKeys(pluginData)
 		This.sendToServerResult(toServerInfo, pluginData)
 	}
 }
@@ -15,3 +15,12 @@ const (
 	DELING   StatusFlag = "deling"
 	DELED    StatusFlag = "deled"
 )
+
+// 插件返回错误的时候的处理策略
+type ErrorPolicy string
+
+const (
+	ERRORPOLICYBLOCK      ErrorPolicy = ""           // 一直阻塞重试，直到成功或者人工跳过
+	ERRORPOLICYSKIP       ErrorPolicy = "skip"       // 重试 ErrorRetryCount 次后，跳过错误数据
+	ERRORPOLICYDEADLETTER ErrorPolicy = "deadletter" // 重试 ErrorRetryCount 次后，将错误数据写入死信队列，再跳过
+)
@@ -346,3 +346,33 @@ func GetFlowAll(flowType string) []CountContent {
 	}
 	return result
 }
+
+type DbCountSnapshot struct {
+	Content    CountContent
+	ChannelMap map[string]CountContent
+	TableMap   map[string]CountContent
+}
+
+// 获取所有数据源，通道，表 累计的同步数量及字节数
+func GetCountSnapshot() map[string]DbCountSnapshot {
+	l.RLock()
+	defer l.RUnlock()
+	result := make(map[string]DbCountSnapshot, len(dbCountChanMap))
+	for db, dbCountInfo := range dbCountChanMap {
+		dbCountInfo.RLock()
+		snapshot := DbCountSnapshot{
+			Content:    *dbCountInfo.Content,
+			ChannelMap: make(map[string]CountContent, len(dbCountInfo.ChannelMap)),
+			TableMap:   make(map[string]CountContent, len(dbCountInfo.TableMap)),
+		}
+		for channelId, flow := range dbCountInfo.ChannelMap {
+			snapshot.ChannelMap[channelId] = *flow.Content
+		}
+		for tableId, flow := range dbCountInfo.TableMap {
+			snapshot.TableMap[tableId] = *flow.Content
+		}
+		dbCountInfo.RUnlock()
+		result[db] = snapshot
+	}
+	return result
+}
@@ -31,6 +31,8 @@ import (
 	"github.com/brokercap/Bifrost/Bristol/mysql"
 	inputDriver "github.com/brokercap/Bifrost/input/driver"
 	"github.com/brokercap/Bifrost/server/count"
+	"github.com/brokercap/Bifrost/server/secret"
+	"github.com/brokercap/Bifrost/server/storage"
 	"github.com/brokercap/Bifrost/server/warning"
 )
 
@@ -115,6 +117,7 @@ func UpdateDB(Name string, InputType string, inputInfo inputDriver.InputInfo, Up
 	dbObj.serverId = inputInfo.ServerId
 	dbObj.maxBinlogDumpFileName = inputInfo.MaxFileName
 	dbObj.maxBinlogDumpPosition = inputInfo.MaxPosition
+	dbObj.loopMarkerTable = inputInfo.LoopMarkerTable
 	dbObj.AddTime = UpdateTime
 	if inputInfo.GTID == "" {
 		dbObj.gtid = inputInfo.GTID
@@ -167,6 +170,8 @@ func DelDB(Name string) bool {
 	}
 	// 删除binlog 信息
 	delBinlogPosition(DBPositionBinlogKey)
+	// 删除 离线表结构历史
+	storage.DelKeyVal(storage.GetInputStateKey(Name))
 	return true
 }
 
@@ -190,12 +195,15 @@ type db struct {
 	killStatus              int
 	maxBinlogDumpFileName   string `json:"MaxBinlogDumpFileName"`
 	maxBinlogDumpPosition   uint32 `json:"MaxBinlogDumpPosition"`
+	loopMarkerTable         string // 双向同步 防回环 的标记表
+	inputStateVersion       uint64 // 最后一次保存的 插件状态 的版本号
 	AddTime                 int64
 	DBBinlogKey             []byte                     `json:"-"` // 保存 binlog到levelDB 的key
 	lastTransactionTableMap map[string]map[string]bool `json:"-"` // 最近一个事务里更新了数据表
 	InputType               string                     `json:"Name"`
 	inputDriverObj          inputDriver.Driver         `json:"-"` // 数据源实例化对象
 	inputStatusChan         chan *inputDriver.PluginStatus
+	snapshotWatermarkMap    map[string]string // 正在全量的同步配置, 水位表 id => 全量表的 key
 
 	statusCtx struct {
 		ctx       context.Context
@@ -222,9 +230,11 @@ type DbListStruct struct {
 	MaxBinlogDumpPosition uint32
 	ReplicateDoDb         map[string]uint8
 	ServerId              uint32
+	LoopMarkerTable       string
 	AddTime               int64
 }
 
+// 用于 接口 及 界面 显示, 连接地址 中的密码 已经脱敏
 func GetListDb() map[string]DbListStruct {
 	var dbListMap map[string]DbListStruct
 	dbListMap = make(map[string]DbListStruct, 0)
@@ -234,7 +244,7 @@ func GetListDb() map[string]DbListStruct {
 		dbListMap[k] = DbListStruct{
 			Name:                  v.Name,
 			InputType:             v.InputType,
-			ConnectUri:            v.ConnectUri,
+			ConnectUri:            secret.MaskUri(v.ConnectUri),
 			ConnStatus:            v.ConnStatus,
 			ConnErr:               v.ConnErr,
 			ChannelCount:          len(v.channelMap),
@@ -250,12 +260,14 @@ func GetListDb() map[string]DbListStruct {
 			MaxBinlogDumpPosition: v.maxBinlogDumpPosition,
 			ReplicateDoDb:         v.replicateDoDb,
 			ServerId:              v.serverId,
+			LoopMarkerTable:       v.loopMarkerTable,
 			AddTime:               v.AddTime,
 		}
 	}
 	return dbListMap
 }
 
+// 用于 接口 及 界面 显示, 连接地址 中的密码 已经脱敏, 连接 需要使用 GetDBObj 中的 ConnectUri
 func GetDbInfo(dbname string) *DbListStruct {
 	DbLock.Lock()
 	defer DbLock.Unlock()
@@ -266,7 +278,7 @@ func GetDbInfo(dbname string) *DbListStruct {
 	return &DbListStruct{
 		Name:                  v.Name,
 		InputType:             v.InputType,
-		ConnectUri:            v.ConnectUri,
+		ConnectUri:            secret.MaskUri(v.ConnectUri),
 		ConnStatus:            v.ConnStatus,
 		ConnErr:               v.ConnErr,
 		ChannelCount:          len(v.channelMap),
@@ -281,6 +293,7 @@ func GetDbInfo(dbname string) *DbListStruct {
 		MaxBinlogDumpPosition: v.maxBinlogDumpPosition,
 		ReplicateDoDb:         v.replicateDoDb,
 		ServerId:              v.serverId,
+		LoopMarkerTable:       v.loopMarkerTable,
 		AddTime:               v.AddTime,
 	}
 }
@@ -310,6 +323,7 @@ func NewDb(Name string, InputType string, inputInfo inputDriver.InputInfo, AddTi
 		maxBinlogDumpPosition:   inputInfo.MaxPosition,
 		replicateDoDb:           make(map[string]uint8, 0),
 		serverId:                inputInfo.ServerId,
+		loopMarkerTable:         inputInfo.LoopMarkerTable,
 		killStatus:              0,
 		AddTime:                 AddTime,
 		lastTransactionTableMap: make(map[string]map[string]bool, 0),
@@ -404,7 +418,8 @@ func (db *db) getRightBinlogPosition() (newPosition uint32) {
 			newPosition = 0
 		}
 	}()
-	err := mysql.CheckBinlogIsRight(db.ConnectUri, db.binlogDumpFileName, db.binlogDumpPosition)
+	connectUri := secret.ResolveUri(db.ConnectUri)
+	err := mysql.CheckBinlogIsRight(connectUri, db.binlogDumpFileName, db.binlogDumpPosition)
 	if err == nil {
 		return db.binlogDumpPosition
 	}
@@ -412,7 +427,7 @@ func (db *db) getRightBinlogPosition() (newPosition uint32) {
 	if strings.Index(err.Error(), "connect: operation timed out") != -1 {
 		return newPosition
 	}
-	newPosition = mysql.GetNearestRightBinlog(db.ConnectUri, db.binlogDumpFileName, db.binlogDumpPosition, db.serverId, db.getReplicateDoDbMap(), nil)
+	newPosition = mysql.GetNearestRightBinlog(connectUri, db.binlogDumpFileName, db.binlogDumpPosition, db.serverId, db.getReplicateDoDbMap(), nil)
 	return newPosition
 }
 
@@ -474,12 +489,13 @@ func (db *db) Start() error {
 /*
 InitInputDriver 不进行加锁，是把加锁动作放到外层去做，因为Start方法每次启动都需要强制启动一个新的
 并且其GetCurrentPosition也有可能会需要初始化操作
+连接地址中的 ${env:X} ${file:/path} 引用 在这里替换，密码更换之后 关闭再启动数据源 即可生效
 */
 
 func (db *db) InitInputDriver() {
 	inputInfo := inputDriver.InputInfo{
 		DbName:         db.Name,
-		ConnectUri:     db.ConnectUri,
+		ConnectUri:     secret.ResolveUri(db.ConnectUri),
 		GTID:           db.gtid,
 		BinlogFileName: db.binlogDumpFileName,
 		BinlogPostion:  db.binlogDumpPosition,
@@ -488,6 +504,8 @@ func (db *db) InitInputDriver() {
 		ServerId:    db.serverId,
 		MaxFileName: db.maxBinlogDumpFileName,
 		MaxPosition: db.maxBinlogDumpPosition,
+
+		LoopMarkerTable: db.loopMarkerTable,
 	}
 	if !db.isGtid {
 		inputInfo.GTID = ""
@@ -495,10 +513,14 @@ func (db *db) InitInputDriver() {
 	db.inputStatusChan = make(chan *inputDriver.PluginStatus, 10)
 	db.inputDriverObj = inputDriver.Open(db.InputType, inputInfo)
 	db.inputDriverObj.SetCallback(db.Callback)
+	db.loadInputState()
 	for key, _ := range db.tableMap {
 		schemaName, TableName := GetSchemaAndTableBySplit(key)
 		db.AddReplicateDoDb(schemaName, TableName, false)
 	}
+	if len(db.snapshotWatermarkMap) > 0 {
+		db.AddReplicateDoDb(SnapshotWatermarkSchema, SnapshotWatermarkTable, false)
+	}
 	db.inputDriverObj.SetEventID(db.lastEventID)
 
 }
@@ -525,6 +547,52 @@ func (db *db) Close() bool {
 	return true
 }
 
+// Kill 之后 等待 数据源 上报 停止 状态 的超时时间
+var killInputWaitTimeout = 5 * time.Second
+
+// 停止 数据源, 等 数据源 上报 停止 状态 之后, 再关闭 状态通道, monitorDump 随之退出
+func (db *db) Kill() {
+	db.killStatus = 1
+	if db.inputDriverObj == nil {
+		return
+	}
+	if db.ConnStatus != STOPPED && db.ConnStatus != CLOSED {
+		db.ConnStatus = STOPPING
+	}
+	func() {
+		defer func() {
+			if err := recover(); err != nil {
+				log.Println(db.Name, "input kill err:", err)
+			}
+		}()
+		db.inputDriverObj.Kill()
+	}()
+	if db.inputStatusChan == nil {
+		return
+	}
+	if !db.waitInputStopped(killInputWaitTimeout) {
+		log.Println(db.Name, "input not report stopped after kill, status:", db.ConnStatus)
+	}
+	close(db.inputStatusChan)
+}
+
+func (db *db) waitInputStopped(timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if db.ConnStatus == STOPPED || db.ConnStatus == CLOSED {
+			return true
+		}
+		select {
+		case <-timer.C:
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
 func (db *db) monitorDump() (r bool) {
 	var lastStatus StatusFlag
 	timer := time.NewTimer(3 * time.Second)
@@ -532,7 +600,11 @@ func (db *db) monitorDump() (r bool) {
 	var i uint8 = 0
 	for {
 		select {
-		case inputStatusInfo := <-db.inputStatusChan:
+		case inputStatusInfo, ok := <-db.inputStatusChan:
+			// StopAllChannel 关闭了状态通道,退出监控,不再定时保存位点
+			if !ok {
+				return
+			}
 			if inputStatusInfo == nil {
 				break
 			}
@@ -598,6 +670,7 @@ func (db *db) saveBinlog() {
 	if p == nil {
 		return
 	}
+	db.saveInputState()
 	//保存位点,这个位点在重启 配置文件恢复的时候
 	db.Lock()
 	db.binlogDumpFileName, db.binlogDumpPosition, db.binlogDumpTimestamp, db.gtid, db.lastEventID = p.BinlogFileName, p.BinlogPostion, p.Timestamp, p.GTID, p.EventID
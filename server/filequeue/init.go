@@ -199,3 +199,19 @@ func BytesToInt32(b []byte) int32 {
 	binary.Read(bytesBuffer, binary.LittleEndian, &x)
 	return x
 }
+
+// 队列文件占用的磁盘大小
+func (This *Queue) GetFileSize() (size int64) {
+	This.Lock()
+	defer This.Unlock()
+	rd, err := ioutil.ReadDir(This.path)
+	if err != nil {
+		return 0
+	}
+	for _, fi := range rd {
+		if !fi.IsDir() && strings.HasSuffix(fi.Name(), ".list") {
+			size += fi.Size()
+		}
+	}
+	return
+}
@@ -0,0 +1,58 @@
+package filequeue
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// 按顺序遍历队列中还没有被 Pop 出去的数据，不会修改队列的读取位置
+// f 返回 false 的时候，停止遍历
+func (This *Queue) Scan(f func(content []byte) bool) error {
+	This.Lock()
+	defer This.Unlock()
+	if This.maxId == -1 {
+		return nil
+	}
+	// 已经被 Pop 出去的数据，在文件被删除之前，还是会存在文件中，需要跳过
+	skipMap := make(map[int64]int, len(This.unackFileList))
+	startId := This.minId
+	for _, fileInfo := range This.unackFileList {
+		skipMap[fileInfo.id] = fileInfo.totalCount
+		if fileInfo.id < startId {
+			startId = fileInfo.id
+		}
+	}
+	for id := startId; id <= This.maxId; id++ {
+		fileName := This.path + "/" + fmt.Sprint(id) + ".list"
+		b, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		var n int
+		var pos int
+		for pos+4 <= len(b) {
+			l := int(BytesToInt32(b[pos : pos+4]))
+			if l < 0 || pos+8+l > len(b) {
+				return fmt.Errorf("read file err,fileName:%s", fileName)
+			}
+			content := b[pos+4 : pos+4+l]
+			pos += 8 + l
+			// 数据之间用 ; 分隔
+			if pos < len(b) && b[pos] == ';' {
+				pos++
+			}
+			n++
+			if n <= skipMap[id] {
+				continue
+			}
+			if !f(content) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/brokercap/Bifrost/config"
+	"github.com/brokercap/Bifrost/server/count"
+	"github.com/brokercap/Bifrost/server/storage"
+	"github.com/brokercap/Bifrost/server/user"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// 多个节点共用同一个 redis 存储(cluster_name 一致),通过租约选出 leader
+// 只有 leader 节点才会启动数据源及同步,follower 节点定时同步 leader 保存的镜像数据,
+// 在 leader 租约过期后抢到租约,从存储中最后保存的位点接管同步
+
+const haLeaseKey = "ha-leader"
+
+type HANodeInfo struct {
+	NodeAddr string
+	NodeID   string
+}
+
+type HAStatus struct {
+	Enable       bool
+	IsLeader     bool
+	Node         HANodeInfo
+	Leader       HANodeInfo
+	SnapshotTime time.Time // follower 最后一次同步镜像数据的时间
+}
+
+type haStruct struct {
+	sync.RWMutex
+	isLeader      bool
+	node          HANodeInfo
+	nodeVal       []byte
+	leader        HANodeInfo
+	snapshot      []byte
+	snapshotTime  time.Time
+	lastRenewTime time.Time
+}
+
+var ha = &haStruct{}
+
+// 没有开启 ha 的情况下,当前节点就是 leader
+func IsHALeader() bool {
+	if !config.HA {
+		return true
+	}
+	ha.RLock()
+	defer ha.RUnlock()
+	return ha.isLeader
+}
+
+func GetHAStatus() HAStatus {
+	ha.RLock()
+	defer ha.RUnlock()
+	return HAStatus{
+		Enable:       config.HA,
+		IsLeader:     !config.HA || ha.isLeader,
+		Node:         ha.node,
+		Leader:       ha.leader,
+		SnapshotTime: ha.snapshotTime,
+	}
+}
+
+// 获取 leader 节点的访问地址,用于 follower 节点拒绝写操作的时候返回
+func GetHALeaderAddr() string {
+	ha.RLock()
+	defer ha.RUnlock()
+	return ha.leader.NodeAddr
+}
+
+func StartHA() {
+	if storage.GetMetaStorageType() != "redis" {
+		log.Println("ha must be used with meta_storage_type=redis")
+		os.Exit(1)
+	}
+	hostname, _ := os.Hostname()
+	ha.Lock()
+	ha.node = HANodeInfo{
+		NodeAddr: config.HANodeAddr,
+		NodeID:   fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), time.Now().UnixNano()),
+	}
+	ha.nodeVal, _ = json.Marshal(ha.node)
+	ha.Unlock()
+
+	//这里初始化用户,follower 节点也需要能登入查看 leader 地址
+	user.InitUser()
+	if !haTryLeader() {
+		log.Println("ha node:", config.HANodeAddr, "start as follower, leader:", GetHALeaderAddr())
+		haRefreshSnapshot()
+	}
+	go haLoop()
+}
+
+func haLeaseTimeout() time.Duration {
+	return time.Duration(config.HALeaseTimeout) * time.Second
+}
+
+// 续期间隔为租约时间的 1/3
+func haRenewInterval() time.Duration {
+	return haLeaseTimeout() / 3
+}
+
+// 续期失败的情况下,要比其他节点能抢到租约的时间早一个续期间隔停止同步,防止两个节点同时同步
+func haShouldStepDown(lastRenewTime, now time.Time) bool {
+	return now.Sub(lastRenewTime) >= haLeaseTimeout()-haRenewInterval()
+}
+
+func haLoop() {
+	for {
+		time.Sleep(haRenewInterval())
+		if IsHALeader() {
+			haRenew()
+		} else if !haTryLeader() {
+			haRefreshSnapshot()
+		}
+	}
+}
+
+func haTryLeader() bool {
+	startTime := time.Now()
+	ok, err := storage.AcquireLease([]byte(haLeaseKey), ha.nodeVal, haLeaseTimeout())
+	if err != nil {
+		log.Println("ha acquire lease err:", err)
+		return false
+	}
+	if !ok {
+		haRefreshLeader()
+		return false
+	}
+	ha.Lock()
+	ha.isLeader = true
+	ha.leader = ha.node
+	ha.lastRenewTime = startTime
+	snapshot := ha.snapshot
+	ha.snapshot = nil
+	ha.Unlock()
+	log.Println("ha node:", config.HANodeAddr, "become leader")
+	// 恢复数据可能需要比较长的时间,不能阻塞续期
+	go haTakeOver(snapshot)
+	return true
+}
+
+func haTakeOver(snapshot []byte) {
+	fd, err := storage.GetDBInfo()
+	// 存储读取失败的情况下,用 follower 期间同步的镜像数据
+	if err != nil && snapshot != nil {
+		log.Println("ha take over get db info err:", err, "use snapshot synced at follower")
+		fd = snapshot
+	}
+	recoverySnapshotData(fd)
+}
+
+func haRenew() {
+	ha.RLock()
+	lastRenewTime := ha.lastRenewTime
+	ha.RUnlock()
+	startTime := time.Now()
+	ok, err := storage.AcquireLease([]byte(haLeaseKey), ha.nodeVal, haLeaseTimeout())
+	if ok {
+		ha.Lock()
+		ha.lastRenewTime = startTime
+		ha.Unlock()
+		return
+	}
+	if err != nil {
+		log.Println("ha renew lease err:", err)
+		if !haShouldStepDown(lastRenewTime, time.Now()) {
+			return
+		}
+	}
+	haStepDown()
+}
+
+// 失去租约,其他节点会从最后保存的位点接管,当前节点停止所有同步后清空内存中的数据源,回到 follower 状态
+// 再次抢到租约的时候,由 haTakeOver 从存储中重新恢复
+// 这里不保存镜像数据,防止覆盖新 leader 的数据
+func haStepDown() {
+	ha.Lock()
+	ha.isLeader = false
+	ha.Unlock()
+	log.Println("ha node:", config.HANodeAddr, "lost leader lease, stop all channel and back to follower")
+	haResetLeaderState()
+	haRefreshLeader()
+}
+
+func haResetLeaderState() {
+	StopAllChannel()
+	DbLock.Lock()
+	oldDbList := DbList
+	DbList = make(map[string]*db, 0)
+	DbLock.Unlock()
+	for name, db := range oldDbList {
+		// 停止定时保存位点,防止覆盖新 leader 保存的位点
+		if db.statusCtx.cancelFun != nil {
+			db.statusCtx.cancelFun()
+		}
+		for _, c := range db.channelMap {
+			count.DelChannel(name, c.Name)
+		}
+		count.DelDB(name)
+	}
+}
+
+func haRefreshLeader() {
+	val, err := storage.GetKeyVal([]byte(haLeaseKey))
+	if err != nil || len(val) == 0 {
+		return
+	}
+	var leader HANodeInfo
+	if json.Unmarshal(val, &leader) != nil {
+		return
+	}
+	ha.Lock()
+	ha.leader = leader
+	ha.Unlock()
+}
+
+func haRefreshSnapshot() {
+	fd, err := storage.GetDBInfo()
+	if err != nil || !json.Valid(fd) {
+		return
+	}
+	ha.Lock()
+	ha.snapshot = fd
+	ha.snapshotTime = time.Now()
+	ha.Unlock()
+}
+
+// 正常退出的时候释放租约,其他节点不需要等租约过期就可以接管
+func releaseHALease() {
+	if !config.HA {
+		return
+	}
+	ha.Lock()
+	defer ha.Unlock()
+	if !ha.isLeader {
+		return
+	}
+	ha.isLeader = false
+	if err := storage.ReleaseLease([]byte(haLeaseKey), ha.nodeVal); err != nil {
+		log.Println("ha release lease err:", err)
+	}
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/brokercap/Bifrost/config"
+	inputDriver "github.com/brokercap/Bifrost/input/driver"
+	"github.com/brokercap/Bifrost/server/storage"
+	"github.com/brokercap/Bifrost/xdb"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIsHALeader(t *testing.T) {
+	defer func(b bool) {
+		config.HA = b
+	}(config.HA)
+
+	config.HA = false
+	if !IsHALeader() {
+		t.Fatal("ha disabled, must be leader")
+	}
+	config.HA = true
+	ha.Lock()
+	ha.isLeader = false
+	ha.leader = HANodeInfo{NodeAddr: "192.168.1.10:21036"}
+	ha.Unlock()
+	if IsHALeader() {
+		t.Fatal("follower must not be leader")
+	}
+	if GetHALeaderAddr() != "192.168.1.10:21036" {
+		t.Fatal("leader addr error:", GetHALeaderAddr())
+	}
+	// follower 节点不能覆盖 leader 保存的镜像数据,这里不会访问存储
+	DoSaveSnapshotData()
+}
+
+func TestHaShouldStepDown(t *testing.T) {
+	defer func(n int) {
+		config.HALeaseTimeout = n
+	}(config.HALeaseTimeout)
+	config.HALeaseTimeout = 9
+	now := time.Now()
+	if haShouldStepDown(now.Add(-3*time.Second), now) {
+		t.Fatal("renew 3s ago, lease timeout 9s, must not step down")
+	}
+	if !haShouldStepDown(now.Add(-6*time.Second), now) {
+		t.Fatal("renew 6s ago, lease timeout 9s, must step down before other node acquire")
+	}
+}
+
+func TestHaStepDownAndReacquire(t *testing.T) {
+	defer func(b bool) {
+		config.HA = b
+	}(config.HA)
+	config.HA = true
+
+	oldDbList := DbList
+	defer func() {
+		DbList = oldDbList
+	}()
+	DbList = map[string]*db{
+		"mysqlTest": {Name: "mysqlTest", channelMap: make(map[int]*Channel, 0)},
+	}
+
+	leaderVal := []byte(`{"NodeAddr":"192.168.1.11:21036","NodeID":"node-2"}`)
+	patches := gomonkey.ApplyFunc(storage.GetKeyVal, func(key []byte) ([]byte, error) {
+		return leaderVal, nil
+	})
+	defer patches.Reset()
+	var leaseOk bool
+	// storage.AcquireLease 会被内联,这里 mock xdb 的方法
+	patches.ApplyMethod(reflect.TypeOf(&xdb.Client{}), "AcquireLease", func(_ *xdb.Client, table, key string, val []byte, ttl time.Duration) (bool, error) {
+		return leaseOk, nil
+	})
+	takeOver := make(chan []byte, 1)
+	patches.ApplyFunc(haTakeOver, func(snapshot []byte) {
+		takeOver <- snapshot
+	})
+
+	ha.Lock()
+	ha.isLeader = true
+	ha.snapshot = nil
+	ha.Unlock()
+
+	// 续期失败,停止同步后回到 follower,进程不退出
+	haRenew()
+	if IsHALeader() {
+		t.Fatal("lost lease, must step down")
+	}
+	if len(DbList) != 0 {
+		t.Fatal("db list must be cleared after step down:", len(DbList))
+	}
+	if GetHALeaderAddr() != "192.168.1.11:21036" {
+		t.Fatal("leader addr error:", GetHALeaderAddr())
+	}
+
+	// 其他节点租约过期之后,重新抢到租约接管
+	leaseOk = true
+	if !haTryLeader() {
+		t.Fatal("acquire lease ok, must be leader")
+	}
+	if !IsHALeader() {
+		t.Fatal("must be leader after re-acquire")
+	}
+	select {
+	case <-takeOver:
+	case <-time.After(3 * time.Second):
+		t.Fatal("take over not called after re-acquire")
+	}
+	ha.Lock()
+	ha.isLeader = false
+	ha.Unlock()
+}
+
+// Stop 的时候 先上报状态 再停止 的数据源, 状态通道 先被关闭 的话 上报状态 会 panic, 数据源 不会停止
+type haStepDownTestInput struct {
+	inputDriver.PluginDriverInterface
+	ch        chan *inputDriver.PluginStatus
+	ctx       context.Context
+	cancelFun context.CancelFunc
+}
+
+func (c *haStepDownTestInput) Stop() error {
+	c.ch <- &inputDriver.PluginStatus{Status: inputDriver.STOPPING}
+	c.cancelFun()
+	c.ch <- &inputDriver.PluginStatus{Status: inputDriver.STOPPED}
+	return nil
+}
+
+func (c *haStepDownTestInput) Kill() error {
+	return c.Stop()
+}
+
+func TestHaResetLeaderState_StopInput(t *testing.T) {
+	oldDbList := DbList
+	defer func() {
+		DbList = oldDbList
+	}()
+	input := &haStepDownTestInput{ch: make(chan *inputDriver.PluginStatus, 1)}
+	input.ctx, input.cancelFun = context.WithCancel(context.Background())
+	dbObj := &db{
+		Name:            "postgresTest",
+		ConnStatus:      RUNNING,
+		channelMap:      make(map[int]*Channel, 0),
+		inputDriverObj:  input,
+		inputStatusChan: input.ch,
+	}
+	monitorDone := make(chan struct{})
+	go func() {
+		dbObj.monitorDump()
+		close(monitorDone)
+	}()
+	DbList = map[string]*db{dbObj.Name: dbObj}
+
+	haResetLeaderState()
+	if input.ctx.Err() == nil {
+		t.Fatal("input must be stopped after step down")
+	}
+	if dbObj.ConnStatus != STOPPED {
+		t.Fatal("db status:", dbObj.ConnStatus, "!=", STOPPED)
+	}
+	select {
+	case <-monitorDone:
+	case <-time.After(3 * time.Second):
+		t.Fatal("monitorDump not exit after status chan closed")
+	}
+	if len(DbList) != 0 {
+		t.Fatal("db list must be cleared after step down:", len(DbList))
+	}
+}
@@ -478,88 +478,7 @@ func (This *History) initMetaInfo(db mysql.MysqlConnection) {
 		if strings.ToUpper(*v.COLUMN_KEY) == "PRI" {
 			This.TablePriArr = append(This.TablePriArr, *v.COLUMN_NAME)
 		}
-		var columnMappingType string
-		switch *v.DATA_TYPE {
-		case "tinyint":
-			if strings.Index(*v.COLUMN_TYPE, "unsigned") >= 0 {
-				columnMappingType = "uint8"
-			} else {
-				if *v.COLUMN_TYPE == "tinyint(1)" {
-					columnMappingType = "bool"
-				} else {
-					columnMappingType = "int8"
-				}
-			}
-		case "smallint":
-			if strings.Index(*v.COLUMN_TYPE, "unsigned") >= 0 {
-				columnMappingType = "uint16"
-			} else {
-				columnMappingType = "int16"
-			}
-		case "mediumint":
-			if strings.Index(*v.COLUMN_TYPE, "unsigned") >= 0 {
-				columnMappingType = "uint24"
-			} else {
-				columnMappingType = "int24"
-			}
-		case "int":
-			if strings.Index(*v.COLUMN_TYPE, "unsigned") >= 0 {
-				columnMappingType = "uint32"
-			} else {
-				columnMappingType = "int32"
-			}
-		case "bigint":
-			if strings.Index(*v.COLUMN_TYPE, "unsigned") >= 0 {
-				columnMappingType = "uint64"
-			} else {
-				columnMappingType = "int64"
-			}
-		case "numeric":
-			columnMappingType = strings.Replace(*v.COLUMN_TYPE, "numeric", "decimal", 1)
-		case "real":
-			columnMappingType = strings.Replace(*v.COLUMN_TYPE, "real", "double", 1)
-		case "Int8":
-			columnMappingType = "int8"
-		case "UInt8":
-			columnMappingType = "uint8"
-		case "Int16":
-			columnMappingType = "int16"
-		case "UInt16":
-			columnMappingType = "uint16"
-		case "Int32":
-			columnMappingType = "int32"
-		case "UInt32":
-			columnMappingType = "uint32"
-		case "Int64":
-			columnMappingType = "int64"
-		case "UInt64":
-			columnMappingType = "uint64"
-		case "Bool":
-			columnMappingType = "bool"
-		case "Float32":
-			columnMappingType = "float"
-		case "Float64":
-			columnMappingType = "double"
-		default:
-			if strings.Contains(*v.COLUMN_TYPE, "Decimal") {
-				columnMappingType = strings.Replace(*v.COLUMN_TYPE, "Decimal", "decimal", 1)
-				break
-			}
-			if strings.Index(*v.COLUMN_TYPE, "Array") == 0 {
-				columnMappingType = "json"
-				break
-			}
-			if strings.Index(*v.COLUMN_TYPE, "Map") == 0 {
-				columnMappingType = "json"
-				break
-			}
-			columnMappingType = *v.COLUMN_TYPE
-			break
-		}
-		if v.IS_NULLABLE != nil && *v.IS_NULLABLE != "NO" {
-			columnMappingType = "Nullable(" + columnMappingType + ")"
-		}
-		This.ColumnMapping[*v.COLUMN_NAME] = columnMappingType
+		This.ColumnMapping[*v.COLUMN_NAME] = getColumnMappingType(v)
 	}
 	//假如只有一个主键并且主键自增的情况，找出这个主键最小值和最大值，只支持 无符号的数字。有符号的不支持
 	if len(This.TablePriArr) > 0 {
@@ -584,3 +503,88 @@ func (This *History) initMetaInfo(db mysql.MysqlConnection) {
 	}
 	return
 }
+
+// 和 binlog 解析出来的 ColumnMapping 保持一致
+func getColumnMappingType(v TableStruct) (columnMappingType string) {
+	switch *v.DATA_TYPE {
+	case "tinyint":
+		if strings.Index(*v.COLUMN_TYPE, "unsigned") >= 0 {
+			columnMappingType = "uint8"
+		} else {
+			if *v.COLUMN_TYPE == "tinyint(1)" {
+				columnMappingType = "bool"
+			} else {
+				columnMappingType = "int8"
+			}
+		}
+	case "smallint":
+		if strings.Index(*v.COLUMN_TYPE, "unsigned") >= 0 {
+			columnMappingType = "uint16"
+		} else {
+			columnMappingType = "int16"
+		}
+	case "mediumint":
+		if strings.Index(*v.COLUMN_TYPE, "unsigned") >= 0 {
+			columnMappingType = "uint24"
+		} else {
+			columnMappingType = "int24"
+		}
+	case "int":
+		if strings.Index(*v.COLUMN_TYPE, "unsigned") >= 0 {
+			columnMappingType = "uint32"
+		} else {
+			columnMappingType = "int32"
+		}
+	case "bigint":
+		if strings.Index(*v.COLUMN_TYPE, "unsigned") >= 0 {
+			columnMappingType = "uint64"
+		} else {
+			columnMappingType = "int64"
+		}
+	case "numeric":
+		columnMappingType = strings.Replace(*v.COLUMN_TYPE, "numeric", "decimal", 1)
+	case "real":
+		columnMappingType = strings.Replace(*v.COLUMN_TYPE, "real", "double", 1)
+	case "Int8":
+		columnMappingType = "int8"
+	case "UInt8":
+		columnMappingType = "uint8"
+	case "Int16":
+		columnMappingType = "int16"
+	case "UInt16":
+		columnMappingType = "uint16"
+	case "Int32":
+		columnMappingType = "int32"
+	case "UInt32":
+		columnMappingType = "uint32"
+	case "Int64":
+		columnMappingType = "int64"
+	case "UInt64":
+		columnMappingType = "uint64"
+	case "Bool":
+		columnMappingType = "bool"
+	case "Float32":
+		columnMappingType = "float"
+	case "Float64":
+		columnMappingType = "double"
+	default:
+		if strings.Contains(*v.COLUMN_TYPE, "Decimal") {
+			columnMappingType = strings.Replace(*v.COLUMN_TYPE, "Decimal", "decimal", 1)
+			break
+		}
+		if strings.Index(*v.COLUMN_TYPE, "Array") == 0 {
+			columnMappingType = "json"
+			break
+		}
+		if strings.Index(*v.COLUMN_TYPE, "Map") == 0 {
+			columnMappingType = "json"
+			break
+		}
+		columnMappingType = *v.COLUMN_TYPE
+		break
+	}
+	if v.IS_NULLABLE != nil && *v.IS_NULLABLE != "NO" {
+		columnMappingType = "Nullable(" + columnMappingType + ")"
+	}
+	return
+}
@@ -4,13 +4,15 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"github.com/brokercap/Bifrost/Bristol/mysql"
+	"github.com/brokercap/Bifrost/server/secret"
 	"log"
 	"strconv"
 	"strings"
 )
 
+// 连接的时候 才替换 连接地址 中的 ${env:X} ${file:/path} 引用
 func DBConnect(uri string) mysql.MysqlConnection {
-	db := mysql.NewConnect(uri)
+	db := mysql.NewConnect(secret.ResolveUri(uri))
 	return db
 }
 
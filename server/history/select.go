@@ -109,67 +109,7 @@ func (This *History) threadStart(i int, wg *sync.WaitGroup) {
 				break
 			}
 			rowCount++
-			m := make(map[string]interface{}, n)
-			sizeCount := int64(0)
-			for i, v := range This.Fields {
-				if dest[i] == nil {
-					m[*v.COLUMN_NAME] = dest[i]
-					continue
-				}
-				switch *v.DATA_TYPE {
-				case "set":
-					m[*v.COLUMN_NAME] = strings.Split(dest[i].(string), ",")
-					break
-				case "tinyint":
-					if *v.COLUMN_TYPE == "tinyint(1)" {
-						switch fmt.Sprint(dest[i]) {
-						case "1":
-							m[*v.COLUMN_NAME] = true
-							break
-						case "0":
-							m[*v.COLUMN_NAME] = false
-							break
-						default:
-							m[*v.COLUMN_NAME] = dest[i]
-							break
-						}
-					} else {
-						m[*v.COLUMN_NAME] = dest[i]
-					}
-					break
-				case "json":
-					var d interface{}
-					json.Unmarshal([]byte(dest[i].(string)), &d)
-					m[*v.COLUMN_NAME] = d
-					break
-				case "timestamp", "datetime", "time":
-					if v.Fsp == 0 {
-						m[*v.COLUMN_NAME] = dest[i]
-						break
-					}
-					val := dest[i].(string)
-					i := strings.Index(val, ".")
-					if i < 0 {
-						m[*v.COLUMN_NAME] = val + "." + fmt.Sprintf("%0*d", v.Fsp, 0)
-						break
-					}
-					n := len(val[i+1:])
-					if n == v.Fsp {
-						m[*v.COLUMN_NAME] = val
-						break
-					}
-					if n < v.Fsp {
-						m[*v.COLUMN_NAME] = val + fmt.Sprintf("%0*d", v.Fsp-n, 0)
-					} else {
-						m[*v.COLUMN_NAME] = val[0 : len(val)-n+v.Fsp]
-					}
-
-				default:
-					m[*v.COLUMN_NAME] = dest[i]
-					break
-				}
-				sizeCount += int64(unsafe.Sizeof(m[*v.COLUMN_NAME]))
-			}
+			m, sizeCount := transferRowData(This.Fields, dest)
 			if len(m) == 0 {
 				return
 			}
@@ -206,6 +146,71 @@ func (This *History) threadStart(i int, wg *sync.WaitGroup) {
 	runtime.Goexit()
 }
 
+// 查询出来的数据 转成和 binlog 解析出来的数据 一样的格式
+func transferRowData(fields []TableStruct, dest []driver.Value) (m map[string]interface{}, sizeCount int64) {
+	m = make(map[string]interface{}, len(fields))
+	for i, v := range fields {
+		if dest[i] == nil {
+			m[*v.COLUMN_NAME] = dest[i]
+			continue
+		}
+		switch *v.DATA_TYPE {
+		case "set":
+			m[*v.COLUMN_NAME] = strings.Split(dest[i].(string), ",")
+			break
+		case "tinyint":
+			if *v.COLUMN_TYPE == "tinyint(1)" {
+				switch fmt.Sprint(dest[i]) {
+				case "1":
+					m[*v.COLUMN_NAME] = true
+					break
+				case "0":
+					m[*v.COLUMN_NAME] = false
+					break
+				default:
+					m[*v.COLUMN_NAME] = dest[i]
+					break
+				}
+			} else {
+				m[*v.COLUMN_NAME] = dest[i]
+			}
+			break
+		case "json":
+			var d interface{}
+			json.Unmarshal([]byte(dest[i].(string)), &d)
+			m[*v.COLUMN_NAME] = d
+			break
+		case "timestamp", "datetime", "time":
+			if v.Fsp == 0 {
+				m[*v.COLUMN_NAME] = dest[i]
+				break
+			}
+			val := dest[i].(string)
+			i := strings.Index(val, ".")
+			if i < 0 {
+				m[*v.COLUMN_NAME] = val + "." + fmt.Sprintf("%0*d", v.Fsp, 0)
+				break
+			}
+			n := len(val[i+1:])
+			if n == v.Fsp {
+				m[*v.COLUMN_NAME] = val
+				break
+			}
+			if n < v.Fsp {
+				m[*v.COLUMN_NAME] = val + fmt.Sprintf("%0*d", v.Fsp-n, 0)
+			} else {
+				m[*v.COLUMN_NAME] = val[0 : len(val)-n+v.Fsp]
+			}
+
+		default:
+			m[*v.COLUMN_NAME] = dest[i]
+			break
+		}
+		sizeCount += int64(unsafe.Sizeof(m[*v.COLUMN_NAME]))
+	}
+	return
+}
+
 func (This *History) sendToServerResult(pluginData *pluginDriver.PluginDataType) {
 	for _, toServer := range This.ToServerList {
 		ToServerInfo := toServer.ToServerInfo
@@ -24,6 +24,10 @@ func (This *History) InitToServer() {
 					FilterQuery:        toServerInfo.FilterQuery,
 					FilterUpdate:       toServerInfo.FilterUpdate,
 					FieldList:          toServerInfo.FieldList,
+					Transforms:         toServerInfo.Transforms,
+					ErrorPolicy:        toServerInfo.ErrorPolicy,
+					ErrorRetryCount:    toServerInfo.ErrorRetryCount,
+					DeadLetter:         toServerInfo.DeadLetter,
 					ToServerKey:        toServerInfo.ToServerKey,
 					BinlogFileNum:      toServerInfo.BinlogFileNum,
 					BinlogPosition:     toServerInfo.BinlogPosition,
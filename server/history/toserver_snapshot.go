@@ -0,0 +1,234 @@
+package history
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"github.com/brokercap/Bifrost/Bristol/mysql"
+	"github.com/brokercap/Bifrost/server"
+	"log"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+/*
+同步配置 InitialSnapshot 的全量, 水位的处理 见 server/toserver_snapshot.go
+这里负责 写水位 及 按主键分块 查询数据
+*/
+
+// 每一块 查询的数据条数
+const snapshotChunkSize = 1000
+
+func init() {
+	server.RegisterToServerSnapshotRunner(runToServerSnapshot)
+}
+
+type toServerSnapshot struct {
+	dbName       string
+	schemaName   string
+	tableName    string
+	toServerInfo *server.ToServer
+	conn         mysql.MysqlConnection
+	id           string
+	fields       []TableStruct
+	pri          []string
+	priIndex     []int
+	lastPriVal   []driver.Value // 上一块 最后一条数据的主键, 原始值
+}
+
+func runToServerSnapshot(dbName, schemaName, tableName string, toServerInfo *server.ToServer) {
+	s := &toServerSnapshot{
+		dbName:       dbName,
+		schemaName:   schemaName,
+		tableName:    tableName,
+		toServerInfo: toServerInfo,
+	}
+	err := s.run()
+	if err == nil {
+		return
+	}
+	log.Printf("[ERROR] snapshot dbName:%s SchemaName:%s TableName:%s ToServerID:%d err:%s \n", dbName, schemaName, tableName, toServerInfo.ToServerID, err.Error())
+	toServerInfo.SetSnapshotStatus(server.SNAPSHOT_STATUS_ERROR, err)
+}
+
+func (This *toServerSnapshot) run() (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v %s", e, string(debug.Stack()))
+		}
+	}()
+	dbObj := server.GetDBObj(This.dbName)
+	if dbObj == nil {
+		return fmt.Errorf("%s not exist", This.dbName)
+	}
+	This.conn = DBConnect(dbObj.ConnectUri)
+	defer func() {
+		defer func() {
+			if err := recover(); err != nil {
+				return
+			}
+		}()
+		This.conn.Close()
+	}()
+	This.conn.Exec("SET NAMES utf8mb4", []driver.Value{})
+	if err = This.initMetaInfo(); err != nil {
+		return err
+	}
+	if err = This.initWatermarkTable(); err != nil {
+		return err
+	}
+	columnMapping := make(map[string]string, len(This.fields))
+	for _, v := range This.fields {
+		columnMapping[*v.COLUMN_NAME] = getColumnMappingType(v)
+	}
+	This.id = dbObj.RegisterToServerSnapshot(This.schemaName, This.tableName, This.toServerInfo, This.pri, columnMapping)
+	defer dbObj.UnRegisterToServerSnapshot(This.toServerInfo)
+	startTime := time.Now().Unix()
+	for chunkNum := 1; ; chunkNum++ {
+		lowWatermark := fmt.Sprintf("low-%d-%d", startTime, chunkNum)
+		highWatermark := fmt.Sprintf("high-%d-%d", startTime, chunkNum)
+		doneChan := This.toServerInfo.NewSnapshotChunk(lowWatermark, highWatermark)
+		if doneChan == nil {
+			return nil
+		}
+		if err = This.writeWatermark(lowWatermark); err != nil {
+			return err
+		}
+		var rows []map[string]interface{}
+		if rows, err = This.selectChunk(); err != nil {
+			return err
+		}
+		This.toServerInfo.SetSnapshotChunkRows(rows)
+		if err = This.writeWatermark(highWatermark); err != nil {
+			return err
+		}
+		if !This.waitChunkDone(doneChan) {
+			return nil
+		}
+		if len(rows) < snapshotChunkSize {
+			break
+		}
+	}
+	// 最后一块数据 只是放入了 ToServer 队列, 同步成功之后 才算完成
+	if !This.waitChunkCommitted() {
+		return nil
+	}
+	This.toServerInfo.SetSnapshotStatus(server.SNAPSHOT_STATUS_CAUGHTUP, nil)
+	log.Printf("snapshot dbName:%s SchemaName:%s TableName:%s ToServerID:%d caught up", This.dbName, This.schemaName, This.tableName, This.toServerInfo.ToServerID)
+	return nil
+}
+
+func (This *toServerSnapshot) initMetaInfo() (err error) {
+	This.fields, err = GetSchemaTableFieldList(This.conn, This.schemaName, This.tableName, false)
+	if err != nil {
+		return err
+	}
+	if len(This.fields) == 0 {
+		return fmt.Errorf("%s.%s fields empty", This.schemaName, This.tableName)
+	}
+	for i, v := range This.fields {
+		if strings.ToUpper(*v.COLUMN_KEY) == "PRI" {
+			This.pri = append(This.pri, *v.COLUMN_NAME)
+			This.priIndex = append(This.priIndex, i)
+		}
+	}
+	if len(This.pri) == 0 {
+		return fmt.Errorf("%s.%s primary key not found", This.schemaName, This.tableName)
+	}
+	return nil
+}
+
+func (This *toServerSnapshot) initWatermarkTable() error {
+	sql := "CREATE DATABASE IF NOT EXISTS `" + server.SnapshotWatermarkSchema + "`"
+	if _, err := This.conn.Exec(sql, []driver.Value{}); err != nil {
+		return err
+	}
+	sql = "CREATE TABLE IF NOT EXISTS `" + server.SnapshotWatermarkSchema + "`.`" + server.SnapshotWatermarkTable + "` (" +
+		"`id` varchar(255) NOT NULL," +
+		"`watermark` varchar(64) NOT NULL," +
+		"`update_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP," +
+		"PRIMARY KEY (`id`)" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	_, err := This.conn.Exec(sql, []driver.Value{})
+	return err
+}
+
+func (This *toServerSnapshot) writeWatermark(watermark string) error {
+	sql := "INSERT INTO `" + server.SnapshotWatermarkSchema + "`.`" + server.SnapshotWatermarkTable + "` (`id`,`watermark`) VALUES (?,?) ON DUPLICATE KEY UPDATE `watermark`=VALUES(`watermark`)"
+	_, err := This.conn.Exec(sql, []driver.Value{This.id, watermark})
+	return err
+}
+
+func (This *toServerSnapshot) getChunkSql() (sql string, args []driver.Value) {
+	fieldNames := make([]string, len(This.fields))
+	for i, v := range This.fields {
+		fieldNames[i] = "`" + *v.COLUMN_NAME + "`"
+	}
+	priNames := make([]string, len(This.pri))
+	placeholders := make([]string, len(This.pri))
+	for i, name := range This.pri {
+		priNames[i] = "`" + name + "`"
+		placeholders[i] = "?"
+	}
+	sql = "SELECT " + strings.Join(fieldNames, ",") + " FROM `" + This.schemaName + "`.`" + This.tableName + "`"
+	if This.lastPriVal != nil {
+		sql += " WHERE (" + strings.Join(priNames, ",") + ") > (" + strings.Join(placeholders, ",") + ")"
+		args = This.lastPriVal
+	}
+	sql += " ORDER BY " + strings.Join(priNames, ",") + " LIMIT " + fmt.Sprint(snapshotChunkSize)
+	return
+}
+
+func (This *toServerSnapshot) selectChunk() (data []map[string]interface{}, err error) {
+	sql, args := This.getChunkSql()
+	rows, err := This.conn.Query(sql, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	n := len(This.fields)
+	for {
+		dest := make([]driver.Value, n, n)
+		if rows.Next(dest) != nil {
+			break
+		}
+		m, _ := transferRowData(This.fields, dest)
+		data = append(data, m)
+		lastPriVal := make([]driver.Value, len(This.priIndex))
+		for i, index := range This.priIndex {
+			lastPriVal[i] = dest[index]
+		}
+		This.lastPriVal = lastPriVal
+	}
+	return data, nil
+}
+
+// 等待 high 水位 的数据 放入 ToServer 队列, 同步配置 或者 数据源 被删除 返回 false
+func (This *toServerSnapshot) waitChunkDone(doneChan chan bool) bool {
+	timer := time.NewTimer(5 * time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case <-doneChan:
+			return true
+		case <-timer.C:
+			if This.toServerInfo.IsSnapshotClosed() || server.GetDBObj(This.dbName) == nil {
+				return false
+			}
+			timer.Reset(5 * time.Second)
+		}
+	}
+}
+
+// 等待 ToServer 同步成功的位点 到达 high 水位, 同步配置 或者 数据源 被删除 返回 false
+func (This *toServerSnapshot) waitChunkCommitted() bool {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for !This.toServerInfo.IsSnapshotChunkCommitted() {
+		if This.toServerInfo.IsSnapshotClosed() || server.GetDBObj(This.dbName) == nil {
+			return false
+		}
+		<-ticker.C
+	}
+	return true
+}
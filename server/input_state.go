@@ -0,0 +1,49 @@
+package server
+
+import (
+	inputDriver "github.com/brokercap/Bifrost/input/driver"
+	"github.com/brokercap/Bifrost/server/storage"
+	"log"
+)
+
+// 插件初始化之后, Start 之前 加载 之前保存的 插件状态
+func (db *db) loadInputState() {
+	stateSupporter, ok := db.inputDriverObj.(inputDriver.StateSupporter)
+	if !ok {
+		return
+	}
+	db.inputStateVersion = 0
+	data, err := storage.GetKeyVal(storage.GetInputStateKey(db.Name))
+	if err != nil {
+		log.Println(db.Name, " load input state err:", err)
+		return
+	}
+	if len(data) == 0 {
+		return
+	}
+	if err = stateSupporter.SetState(data); err != nil {
+		log.Println(db.Name, " set input state err:", err)
+	}
+}
+
+// 在 保存位点 之前调用, 保证 位点 之前的 插件状态 已经被保存了
+func (db *db) saveInputState() {
+	stateSupporter, ok := db.inputDriverObj.(inputDriver.StateSupporter)
+	if !ok {
+		return
+	}
+	version := stateSupporter.StateVersion()
+	if version == db.inputStateVersion {
+		return
+	}
+	data, err := stateSupporter.GetState()
+	if err != nil {
+		log.Println(db.Name, " get input state err:", err)
+		return
+	}
+	if err = storage.PutKeyVal(storage.GetInputStateKey(db.Name), data); err != nil {
+		log.Println(db.Name, " save input state err:", err)
+		return
+	}
+	db.inputStateVersion = version
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	. "github.com/smartystreets/goconvey/convey"
+
+	inputDriver "github.com/brokercap/Bifrost/input/driver"
+	"github.com/brokercap/Bifrost/server/storage"
+)
+
+type stateInputDriver struct {
+	inputDriver.PluginDriverInterface
+	version uint64
+	state   []byte
+}
+
+func (c *stateInputDriver) StateVersion() uint64 {
+	return c.version
+}
+
+func (c *stateInputDriver) GetState() ([]byte, error) {
+	return c.state, nil
+}
+
+func (c *stateInputDriver) SetState(data []byte) error {
+	c.state = data
+	return nil
+}
+
+func TestDb_saveInputState(t *testing.T) {
+	savedData := make(map[string][]byte, 0)
+	patches := gomonkey.ApplyFunc(storage.PutKeyVal, func(key []byte, val []byte) error {
+		savedData[string(key)] = val
+		return nil
+	})
+	patches.ApplyFunc(storage.GetKeyVal, func(key []byte) ([]byte, error) {
+		return savedData[string(key)], nil
+	})
+	defer patches.Reset()
+
+	Convey("状态 有变更 才保存", t, func() {
+		driverObj := &stateInputDriver{version: 1, state: []byte("v1")}
+		dbObj := &db{Name: "mysqlTest", inputDriverObj: driverObj}
+		dbObj.saveInputState()
+		So(string(savedData[string(storage.GetInputStateKey("mysqlTest"))]), ShouldEqual, "v1")
+		So(dbObj.inputStateVersion, ShouldEqual, 1)
+
+		driverObj.state = []byte("v1-not-changed")
+		dbObj.saveInputState()
+		So(string(savedData[string(storage.GetInputStateKey("mysqlTest"))]), ShouldEqual, "v1")
+
+		driverObj.version, driverObj.state = 2, []byte("v2")
+		dbObj.saveInputState()
+		So(string(savedData[string(storage.GetInputStateKey("mysqlTest"))]), ShouldEqual, "v2")
+	})
+
+	Convey("重新初始化插件 加载之前保存的状态", t, func() {
+		driverObj := &stateInputDriver{}
+		dbObj := &db{Name: "mysqlTest", inputDriverObj: driverObj, inputStateVersion: 2}
+		dbObj.loadInputState()
+		So(string(driverObj.state), ShouldEqual, "v2")
+		So(dbObj.inputStateVersion, ShouldEqual, 0)
+	})
+
+	Convey("插件 不需要保存状态", t, func() {
+		dbObj := &db{Name: "mysqlTest2", inputDriverObj: &inputDriver.PluginDriverInterface{}}
+		dbObj.saveInputState()
+		dbObj.loadInputState()
+		_, ok := savedData[string(storage.GetInputStateKey("mysqlTest2"))]
+		So(ok, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,150 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"github.com/brokercap/Bifrost/config"
+	"github.com/brokercap/Bifrost/server/count"
+	"github.com/brokercap/Bifrost/server/metrics"
+	"io"
+	"time"
+)
+
+var allStatusFlag = []StatusFlag{STARTING, RUNNING, STOPPING, STOPPED, CLOSING, CLOSED, KILLING, KILLED, DELING, DELED}
+
+// 将数据源，通道，表，ToServer 的统计信息，按 Prometheus text format 格式输出
+func WriteMetrics(w io.Writer) error {
+	_, err := GetMetricsRegistry().WriteTo(w)
+	return err
+}
+
+func GetMetricsRegistry() *metrics.Registry {
+	r := metrics.NewRegistry()
+	r.Gauge("bifrost_build_info", "Bifrost version").Add(1, "version", config.VERSION)
+	nowTime := time.Now().Unix()
+	countSnapshot := count.GetCountSnapshot()
+
+	DbLock.Lock()
+	dbList := make([]*db, 0, len(DbList))
+	for _, dbObj := range DbList {
+		dbList = append(dbList, dbObj)
+	}
+	DbLock.Unlock()
+
+	for _, dbObj := range dbList {
+		dbObj.collectMetrics(r, nowTime, countSnapshot[dbObj.Name])
+	}
+	return r
+}
+
+func (db *db) collectMetrics(r *metrics.Registry, nowTime int64, countInfo count.DbCountSnapshot) {
+	db.RLock()
+	defer db.RUnlock()
+	dbLabels := []string{"db", db.Name}
+	r.Gauge("bifrost_db_info", "Db input info").Add(1, "db", db.Name, "input_type", db.InputType)
+	for _, status := range allStatusFlag {
+		r.Gauge("bifrost_db_input_status", "Db input status, 1 is current status").AddBool(db.ConnStatus == status, "db", db.Name, "status", string(status))
+	}
+	r.Gauge("bifrost_db_input_error", "Db input has error").AddBool(db.ConnErr != "", dbLabels...)
+	r.Gauge("bifrost_db_binlog_timestamp_seconds", "Timestamp of the last event parsed by input").Add(float64(db.binlogDumpTimestamp), dbLabels...)
+	r.Gauge("bifrost_db_replication_lag_seconds", "Now minus timestamp of the last event parsed by input").Add(float64(calcLagSeconds(nowTime, db.binlogDumpTimestamp)), dbLabels...)
+	r.Gauge("bifrost_db_binlog_position", "Binlog position of the last event parsed by input").Add(float64(db.binlogDumpPosition), dbLabels...)
+	r.Counter("bifrost_db_events_total", "Events count of the db").Add(float64(countInfo.Content.Count), dbLabels...)
+	r.Counter("bifrost_db_bytes_total", "Events byte size of the db").Add(float64(countInfo.Content.ByteSize), dbLabels...)
+
+	for channelId, c := range db.channelMap {
+		channelLabels := []string{"db", db.Name, "channel_id", fmt.Sprint(channelId), "channel", c.Name}
+		c.RLock()
+		for _, status := range allStatusFlag {
+			r.Gauge("bifrost_channel_status", "Channel status, 1 is current status").AddBool(c.Status == status, append(channelLabels, "status", string(status))...)
+		}
+		r.Gauge("bifrost_channel_threads", "Channel current consume threads").Add(float64(c.CurrentThreadNum), channelLabels...)
+		c.RUnlock()
+		r.Gauge("bifrost_channel_queue_depth", "Events waiting in the channel queue").Add(float64(len(c.chanName)), channelLabels...)
+		r.Gauge("bifrost_channel_queue_capacity", "Channel queue capacity").Add(float64(cap(c.chanName)), channelLabels...)
+		if countContent, ok := countInfo.ChannelMap[c.Name]; ok {
+			r.Counter("bifrost_channel_events_total", "Events count of the channel").Add(float64(countContent.Count), channelLabels...)
+			r.Counter("bifrost_channel_bytes_total", "Events byte size of the channel").Add(float64(countContent.ByteSize), channelLabels...)
+		}
+	}
+
+	for key, t := range db.tableMap {
+		schemaName, tableName := GetSchemaAndTableBySplit(key)
+		tableLabels := []string{"db", db.Name, "schema", schemaName, "table", tableName}
+		if countContent, ok := countInfo.TableMap[key]; ok {
+			r.Counter("bifrost_table_events_total", "Events count of the table").Add(float64(countContent.Count), tableLabels...)
+			r.Counter("bifrost_table_bytes_total", "Events byte size of the table").Add(float64(countContent.ByteSize), tableLabels...)
+		}
+		t.RLock()
+		toServerList := t.ToServerList
+		t.RUnlock()
+		r.Gauge("bifrost_table_toservers", "ToServer count of the table").Add(float64(len(toServerList)), tableLabels...)
+		for _, toServerInfo := range toServerList {
+			toServerInfo.collectMetrics(r, nowTime, db.binlogDumpTimestamp, tableLabels)
+		}
+	}
+}
+
+func (This *ToServer) collectMetrics(r *metrics.Registry, nowTime int64, dbBinlogTimestamp uint32, tableLabels []string) {
+	This.Lock()
+	labels := append(append(make([]string, 0, len(tableLabels)+6), tableLabels...), "to_server_id", fmt.Sprint(This.ToServerID), "to_server_key", This.ToServerKey, "plugin", This.PluginName)
+	status := This.Status
+	queueMsgCount := This.QueueMsgCount
+	threadCount := This.ThreadCount
+	hasError := This.Error != ""
+	fileQueueStatus := This.FileQueueStatus
+	fileQueueObj := This.fileQueueObj
+	conflictCount := This.ConflictCount
+	var lastSuccessTimestamp uint32
+	var caughtUp bool
+	if This.LastSuccessBinlog != nil {
+		lastSuccessTimestamp = This.LastSuccessBinlog.Timestamp
+		caughtUp = This.QueueMsgCount == 0 && This.LastQueueBinlog != nil && This.LastQueueBinlog.EventID == This.LastSuccessBinlog.EventID
+	}
+	This.Unlock()
+
+	// 没有数据堆积的情况下，延迟时间和数据源解析的延迟时间一致
+	lagTimestamp := lastSuccessTimestamp
+	if caughtUp && dbBinlogTimestamp > lagTimestamp {
+		lagTimestamp = dbBinlogTimestamp
+	}
+	r.Gauge("bifrost_toserver_running", "ToServer consume is running").AddBool(status == RUNNING, labels...)
+	r.Gauge("bifrost_toserver_stopped", "ToServer is stopped by user").AddBool(status == STOPPED || status == STOPPING, labels...)
+	r.Gauge("bifrost_toserver_threads", "ToServer consume threads").Add(float64(threadCount), labels...)
+	r.Gauge("bifrost_toserver_queue_depth", "Events waiting in the ToServer queue").Add(float64(queueMsgCount), labels...)
+	r.Gauge("bifrost_toserver_error", "Plugin returned an error and is waiting to be dealt").AddBool(hasError, labels...)
+	r.Gauge("bifrost_toserver_last_success_timestamp_seconds", "Binlog timestamp of the last event successfully committed by plugin").Add(float64(lastSuccessTimestamp), labels...)
+	r.Gauge("bifrost_toserver_replication_lag_seconds", "Now minus binlog timestamp of the last event successfully committed by plugin").Add(float64(calcLagSeconds(nowTime, lagTimestamp)), labels...)
+	for conflictType, n := range conflictCount {
+		conflictLabels := append(append(make([]string, 0, len(labels)+2), labels...), "conflict_type", conflictType)
+		r.Counter("bifrost_toserver_conflicts_total", "Conflicts detected by plugin").Add(float64(n), conflictLabels...)
+	}
+	r.Gauge("bifrost_toserver_file_queue_enabled", "ToServer file queue is enabled").AddBool(fileQueueStatus, labels...)
+	if fileQueueObj != nil {
+		info := fileQueueObj.GetInfo()
+		r.Gauge("bifrost_toserver_file_queue_files", "File count of the ToServer file queue").Add(float64(info.FileCount), labels...)
+		r.Gauge("bifrost_toserver_file_queue_bytes", "Disk size of the ToServer file queue").Add(float64(fileQueueObj.GetFileSize()), labels...)
+	}
+}
+
+func calcLagSeconds(nowTime int64, timestamp uint32) int64 {
+	if timestamp == 0 || nowTime < int64(timestamp) {
+		return 0
+	}
+	return nowTime - int64(timestamp)
+}
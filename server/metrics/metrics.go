@@ -0,0 +1,152 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// 按 Prometheus text format(0.0.4) 格式输出监控指标，OpenMetrics 兼容这个格式
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type MetricType string
+
+const (
+	COUNTER MetricType = "counter"
+	GAUGE   MetricType = "gauge"
+)
+
+type sample struct {
+	labels []string // name,value,name,value...
+	value  float64
+}
+
+type Family struct {
+	Name    string
+	Help    string
+	Type    MetricType
+	samples []sample
+}
+
+// labels 按 name,value 成对传入
+func (This *Family) Add(value float64, labels ...string) *Family {
+	if len(labels)%2 != 0 {
+		labels = append(labels, "")
+	}
+	This.samples = append(This.samples, sample{labels: labels, value: value})
+	return This
+}
+
+func (This *Family) AddBool(b bool, labels ...string) *Family {
+	if b {
+		return This.Add(1, labels...)
+	}
+	return This.Add(0, labels...)
+}
+
+type Registry struct {
+	families []*Family
+	nameMap  map[string]*Family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		families: make([]*Family, 0),
+		nameMap:  make(map[string]*Family, 0),
+	}
+}
+
+// 同名的指标只会创建一次，按第一次创建的顺序输出
+func (This *Registry) get(name, help string, metricType MetricType) *Family {
+	if f, ok := This.nameMap[name]; ok {
+		return f
+	}
+	f := &Family{Name: name, Help: help, Type: metricType}
+	This.families = append(This.families, f)
+	This.nameMap[name] = f
+	return f
+}
+
+func (This *Registry) Counter(name, help string) *Family {
+	return This.get(name, help, COUNTER)
+}
+
+func (This *Registry) Gauge(name, help string) *Family {
+	return This.get(name, help, GAUGE)
+}
+
+func (This *Registry) WriteTo(w io.Writer) (int64, error) {
+	var bw bytes.Buffer
+	for _, f := range This.families {
+		if len(f.samples) == 0 {
+			continue
+		}
+		if f.Help != "" {
+			fmt.Fprintf(&bw, "# HELP %s %s\n", f.Name, escapeHelp(f.Help))
+		}
+		fmt.Fprintf(&bw, "# TYPE %s %s\n", f.Name, f.Type)
+		for _, s := range f.samples {
+			bw.WriteString(f.Name)
+			if len(s.labels) > 0 {
+				bw.WriteByte('{')
+				for i := 0; i < len(s.labels); i += 2 {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					bw.WriteString(s.labels[i])
+					bw.WriteString(`="`)
+					bw.WriteString(escapeLabelValue(s.labels[i+1]))
+					bw.WriteByte('"')
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteByte(' ')
+			bw.WriteString(formatValue(s.value))
+			bw.WriteByte('\n')
+		}
+	}
+	n0, err := w.Write(bw.Bytes())
+	return int64(n0), err
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("bifrost_test_events_total", "events count").Add(10, "db", "mysqlTest", "table", "bifrost_test.t1")
+	r.Gauge("bifrost_test_error", "error\nstate").AddBool(true, "error", `conn "refused"\`)
+	r.Gauge("bifrost_test_empty", "no sample")
+	r.Counter("bifrost_test_events_total", "").Add(0.5)
+
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expect := `# HELP bifrost_test_events_total events count
+# TYPE bifrost_test_events_total counter
+bifrost_test_events_total{db="mysqlTest",table="bifrost_test.t1"} 10
+bifrost_test_events_total 0.5
+# HELP bifrost_test_error error\nstate
+# TYPE bifrost_test_error gauge
+bifrost_test_error{error="conn \"refused\"\\"} 1
+`
+	if buf.String() != expect {
+		t.Fatalf("expect:\n%s\nresult:\n%s", expect, buf.String())
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	dbObj := &db{
+		Name:                "metricsTest",
+		InputType:           "mysql",
+		ConnStatus:          RUNNING,
+		binlogDumpTimestamp: uint32(time.Now().Unix() - 10),
+		channelMap:          map[int]*Channel{1: NewChannel(1, "default", nil)},
+		tableMap: map[string]*Table{
+			GetSchemaAndTableJoin("bifrost_test", "t1"): {
+				Name: "t1",
+				ToServerList: []*ToServer{
+					{
+						ToServerID:        1,
+						ToServerKey:       "kafkaTest",
+						PluginName:        "kafka",
+						Status:            RUNNING,
+						QueueMsgCount:     5,
+						ConflictCount:     map[string]uint64{"InsertExists": 2},
+						Error:             "connect refused",
+						LastSuccessBinlog: &PositionStruct{Timestamp: uint32(time.Now().Unix() - 100), EventID: 1},
+						LastQueueBinlog:   &PositionStruct{EventID: 6},
+					},
+				},
+			},
+		},
+	}
+	DbLock.Lock()
+	DbList[dbObj.Name] = dbObj
+	DbLock.Unlock()
+	defer func() {
+		DbLock.Lock()
+		delete(DbList, dbObj.Name)
+		DbLock.Unlock()
+	}()
+
+	var buf bytes.Buffer
+	if err := WriteMetrics(&buf); err != nil {
+		t.Fatal(err)
+	}
+	result := buf.String()
+	toServerLabels := `db="metricsTest",schema="bifrost_test",table="t1",to_server_id="1",to_server_key="kafkaTest",plugin="kafka"`
+	for _, line := range []string{
+		`bifrost_db_input_status{db="metricsTest",status="running"} 1`,
+		`bifrost_db_input_status{db="metricsTest",status="closed"} 0`,
+		`bifrost_channel_queue_capacity{db="metricsTest",channel_id="1",channel="default"} `,
+		`bifrost_toserver_queue_depth{` + toServerLabels + `} 5`,
+		`bifrost_toserver_error{` + toServerLabels + `} 1`,
+		`bifrost_toserver_running{` + toServerLabels + `} 1`,
+		`bifrost_toserver_conflicts_total{` + toServerLabels + `,conflict_type="InsertExists"} 2`,
+	} {
+		if !strings.Contains(result, line) {
+			t.Fatalf("line: %s not found in:\n%s", line, result)
+		}
+	}
+	// 有数据堆积，延迟时间按最后成功的位点计算
+	if !strings.Contains(result, `bifrost_toserver_replication_lag_seconds{`+toServerLabels+"} 100\n") {
+		t.Fatalf("toserver lag error:\n%s", result)
+	}
+}
@@ -0,0 +1,559 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	inputDriver "github.com/brokercap/Bifrost/input/driver"
+	pluginStorage "github.com/brokercap/Bifrost/plugin/storage"
+	"github.com/brokercap/Bifrost/server/pipeline"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var pipelineApplyLock sync.Mutex
+
+// 将当前运行中的配置转换成声明式配置
+func GetPipelineSpec() *pipeline.Spec {
+	spec := &pipeline.Spec{
+		ToServers: make([]*pipeline.ToServer, 0),
+		Sources:   make([]*pipeline.Source, 0),
+	}
+	toServerMap := pluginStorage.GetToServerMap()
+	toServerKeyList := make([]string, 0, len(toServerMap))
+	for key := range toServerMap {
+		toServerKeyList = append(toServerKeyList, key)
+	}
+	sort.Strings(toServerKeyList)
+	for _, key := range toServerKeyList {
+		t := toServerMap[key]
+		spec.ToServers = append(spec.ToServers, &pipeline.ToServer{
+			ToServerKey: key,
+			PluginName:  t.PluginName,
+			ConnUri:     t.ConnUri,
+			Notes:       t.Notes,
+			MaxConn:     t.MaxConn,
+			MinConn:     t.MinConn,
+		})
+	}
+
+	data := SaveDBInfoToFileData().(map[string]dbSaveInfo)
+	dbNameList := make([]string, 0, len(data))
+	for name := range data {
+		dbNameList = append(dbNameList, name)
+	}
+	sort.Strings(dbNameList)
+	for _, name := range dbNameList {
+		spec.Sources = append(spec.Sources, getPipelineSource(data[name]))
+	}
+	return spec
+}
+
+func getPipelineSource(dbInfo dbSaveInfo) *pipeline.Source {
+	source := &pipeline.Source{
+		Name:              dbInfo.Name,
+		InputType:         dbInfo.InputType,
+		ConnectUri:        dbInfo.ConnectUri,
+		ServerId:          dbInfo.ServerId,
+		BinlogFileName:    dbInfo.BinlogDumpFileName,
+		BinlogPosition:    dbInfo.BinlogDumpPosition,
+		Gtid:              dbInfo.Gtid,
+		MaxBinlogFileName: dbInfo.MaxBinlogDumpFileName,
+		MaxBinlogPosition: dbInfo.MaxinlogDumpPosition,
+		LoopMarkerTable:   dbInfo.LoopMarkerTable,
+		Status:            getPipelineStatus(dbInfo.ConnStatus),
+		Channels:          make([]*pipeline.Channel, 0),
+		Tables:            make([]*pipeline.Table, 0),
+	}
+	if source.InputType == "" {
+		source.InputType = "mysql"
+	}
+	channelIdList := make([]int, 0, len(dbInfo.ChannelMap))
+	for channelId := range dbInfo.ChannelMap {
+		channelIdList = append(channelIdList, channelId)
+	}
+	sort.Ints(channelIdList)
+	channelNameMap := make(map[int]string, 0)
+	for _, channelId := range channelIdList {
+		c := dbInfo.ChannelMap[channelId]
+		channelNameMap[channelId] = c.Name
+		// 同名的通道只取第一个
+		if source.GetChannel(c.Name) != nil {
+			continue
+		}
+		source.Channels = append(source.Channels, &pipeline.Channel{
+			Name:         c.Name,
+			MaxThreadNum: c.MaxThreadNum,
+			Status:       getPipelineStatus(c.Status),
+		})
+	}
+	tableKeyList := make([]string, 0, len(dbInfo.TableMap))
+	for key := range dbInfo.TableMap {
+		tableKeyList = append(tableKeyList, key)
+	}
+	sort.Strings(tableKeyList)
+	for _, key := range tableKeyList {
+		t := dbInfo.TableMap[key]
+		// 模糊匹配自动生成的表,不是用户配置的
+		if t.Name == "" {
+			continue
+		}
+		schemaName, tableName := GetSchemaAndTableBySplit(key)
+		table := &pipeline.Table{
+			SchemaName:  schemaName,
+			TableName:   tableName,
+			ChannelName: channelNameMap[t.ChannelKey],
+			IgnoreTable: t.IgnoreTable,
+			DoTable:     t.DoTable,
+			ToServers:   make([]*pipeline.TableToServer, 0),
+		}
+		t.RLock()
+		for _, toServer := range t.ToServerList {
+			table.ToServers = append(table.ToServers, getPipelineTableToServer(toServer))
+		}
+		t.RUnlock()
+		source.Tables = append(source.Tables, table)
+	}
+	return source
+}
+
+func getPipelineTableToServer(toServer *ToServer) *pipeline.TableToServer {
+	toServer.RLock()
+	defer toServer.RUnlock()
+	t := &pipeline.TableToServer{
+		ToServerKey:     toServer.ToServerKey,
+		PluginName:      toServer.PluginName,
+		FieldList:       toServer.FieldList,
+		Transforms:      toServer.Transforms,
+		MustBeSuccess:   toServer.MustBeSuccess,
+		FilterQuery:     toServer.FilterQuery,
+		FilterUpdate:    toServer.FilterUpdate,
+		PluginParam:     toServer.PluginParam,
+		ErrorPolicy:     string(toServer.ErrorPolicy),
+		ErrorRetryCount: toServer.ErrorRetryCount,
+		Transaction:     toServer.Transaction,
+		InitialSnapshot: toServer.InitialSnapshot,
+		ToServerID:      toServer.ToServerID,
+	}
+	if toServer.DeadLetter != nil {
+		t.DeadLetter = &pipeline.DeadLetter{
+			ToServerKey: toServer.DeadLetter.ToServerKey,
+			PluginParam: toServer.DeadLetter.PluginParam,
+		}
+	}
+	return t
+}
+
+// 中间状态按最终状态对比
+func getPipelineStatus(status StatusFlag) string {
+	switch status {
+	case STARTING:
+		return string(RUNNING)
+	case STOPPING:
+		return string(STOPPED)
+	case CLOSING:
+		return string(CLOSED)
+	}
+	return string(status)
+}
+
+func PlanPipeline(desired *pipeline.Spec, prune bool) *pipeline.Plan {
+	return pipeline.Diff(GetPipelineSpec(), desired, prune)
+}
+
+// 按变更计划执行,出错则停止执行,返回出错的变更
+// 已经执行成功的变更不会回滚,修正配置后再次执行,只会执行剩下的变更
+func ApplyPipeline(desired *pipeline.Spec, prune bool) (*pipeline.Plan, error) {
+	pipelineApplyLock.Lock()
+	defer pipelineApplyLock.Unlock()
+	plan := PlanPipeline(desired, prune)
+	if plan.Empty() {
+		return plan, nil
+	}
+	defer SaveDBConfigInfo()
+	// 数据源最后再启动,防止表同步配置还没添加完成就开始解析
+	startList := make([]*pipeline.Source, 0)
+	for _, change := range plan.Changes {
+		if err := applyPipelineChange(change); err != nil {
+			return plan, fmt.Errorf("%s %s %s err:%s", change.Action, change.Kind, change.Path, err)
+		}
+		if change.Kind == pipeline.KINDSOURCE && change.Action != pipeline.DELETE && change.SourceSpec.Status == string(RUNNING) {
+			startList = append(startList, change.SourceSpec)
+		}
+	}
+	for _, s := range startList {
+		if err := setPipelineSourceStatus(GetDB(s.Name), s.Status); err != nil {
+			return plan, fmt.Errorf("start source %s err:%s", s.Name, err)
+		}
+	}
+	return plan, nil
+}
+
+func applyPipelineChange(change *pipeline.Change) error {
+	switch change.Kind {
+	case pipeline.KINDTOSERVER:
+		return applyPipelineToServer(change)
+	case pipeline.KINDSOURCE:
+		return applyPipelineSource(change)
+	case pipeline.KINDCHANNEL:
+		return applyPipelineChannel(change)
+	case pipeline.KINDTABLE:
+		return applyPipelineTable(change)
+	case pipeline.KINDTABLETOSERVER:
+		return applyPipelineTableToServer(change)
+	}
+	return fmt.Errorf("kind not supported")
+}
+
+func applyPipelineToServer(change *pipeline.Change) error {
+	switch change.Action {
+	case pipeline.ADD:
+		t := change.ToServer
+		pluginStorage.SetToServerInfo(t.ToServerKey, pluginStorage.ToServer{
+			PluginName: t.PluginName,
+			ConnUri:    t.ConnUri,
+			Notes:      t.Notes,
+			MaxConn:    t.MaxConn,
+			MinConn:    t.MinConn,
+		})
+		if pluginStorage.GetToServerInfo(t.ToServerKey) == nil {
+			return fmt.Errorf("plugin:%s not exsit", t.PluginName)
+		}
+	case pipeline.UPDATE:
+		t := change.ToServer
+		old := pluginStorage.GetToServerInfo(t.ToServerKey)
+		if old == nil {
+			return fmt.Errorf("not exsit")
+		}
+		if old.PluginName != t.PluginName {
+			return fmt.Errorf("PluginName can't be changed")
+		}
+		return pluginStorage.UpdateToServerInfo(t.ToServerKey, pluginStorage.ToServer{
+			PluginName: t.PluginName,
+			ConnUri:    t.ConnUri,
+			Notes:      t.Notes,
+			MaxConn:    t.MaxConn,
+			MinConn:    t.MinConn,
+		})
+	case pipeline.DELETE:
+		if dbName := getToServerKeyUsedBy(change.ToServerKey); dbName != "" {
+			return fmt.Errorf("used by db:%s", dbName)
+		}
+		pluginStorage.DelToServerInfo(change.ToServerKey)
+	}
+	return nil
+}
+
+// 目标库连接被哪个数据源的表同步配置在使用
+func getToServerKeyUsedBy(ToServerKey string) string {
+	DbLock.Lock()
+	defer DbLock.Unlock()
+	for name, dbObj := range DbList {
+		for _, t := range dbObj.tableMap {
+			for _, toServer := range t.ToServerList {
+				if toServer.ToServerKey == ToServerKey {
+					return name
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func applyPipelineSource(change *pipeline.Change) error {
+	switch change.Action {
+	case pipeline.ADD:
+		s := change.SourceSpec
+		if strings.Contains(strings.ToLower(s.InputType), "mysql") && (s.BinlogFileName == "" || s.ServerId <= 0) {
+			return fmt.Errorf("BinlogFileName,ServerId must be not empty")
+		}
+		inputInfo := inputDriver.InputInfo{
+			DbName:         s.Name,
+			ConnectUri:     s.ConnectUri,
+			GTID:           s.Gtid,
+			BinlogFileName: s.BinlogFileName,
+			BinlogPostion:  s.BinlogPosition,
+			ServerId:       s.ServerId,
+			MaxFileName:    s.MaxBinlogFileName,
+			MaxPosition:    s.MaxBinlogPosition,
+
+			LoopMarkerTable: s.LoopMarkerTable,
+		}
+		if AddNewDB(s.Name, s.InputType, inputInfo, time.Now().Unix()) == nil {
+			return fmt.Errorf("exsit")
+		}
+	case pipeline.UPDATE:
+		s := change.SourceSpec
+		dbObj := GetDB(s.Name)
+		if dbObj == nil {
+			return fmt.Errorf("not exsit")
+		}
+		// 先暂停或者关闭,再修改连接配置
+		if s.Status != "" && s.Status != string(RUNNING) {
+			if err := setPipelineSourceStatus(dbObj, s.Status); err != nil {
+				return err
+			}
+		}
+		dbObj.RLock()
+		needUpdate := dbObj.InputType != s.InputType || dbObj.ConnectUri != s.ConnectUri || dbObj.serverId != s.ServerId || dbObj.loopMarkerTable != s.LoopMarkerTable
+		// 位点以运行中的为准
+		inputInfo := inputDriver.InputInfo{
+			DbName:         s.Name,
+			ConnectUri:     s.ConnectUri,
+			GTID:           dbObj.gtid,
+			BinlogFileName: dbObj.binlogDumpFileName,
+			BinlogPostion:  dbObj.binlogDumpPosition,
+			ServerId:       s.ServerId,
+			MaxFileName:    dbObj.maxBinlogDumpFileName,
+			MaxPosition:    dbObj.maxBinlogDumpPosition,
+
+			LoopMarkerTable: s.LoopMarkerTable,
+		}
+		if !dbObj.isGtid {
+			inputInfo.GTID = ""
+		}
+		addTime := dbObj.AddTime
+		inputType := dbObj.InputType
+		dbObj.RUnlock()
+		if !needUpdate {
+			return nil
+		}
+		if inputType != s.InputType {
+			return fmt.Errorf("InputType can't be changed")
+		}
+		// AddTime 是位点存储 key 的一部分,修改连接配置不能变更
+		return UpdateDB(s.Name, s.InputType, inputInfo, addTime, 0)
+	case pipeline.DELETE:
+		if GetDB(change.Source) == nil {
+			return nil
+		}
+		if !DelDB(change.Source) {
+			return fmt.Errorf("db status must be close")
+		}
+	}
+	return nil
+}
+
+func setPipelineSourceStatus(dbObj *db, status string) error {
+	if dbObj == nil {
+		return fmt.Errorf("not exsit")
+	}
+	dbObj.RLock()
+	connStatus := dbObj.ConnStatus
+	dbObj.RUnlock()
+	switch status {
+	case string(RUNNING):
+		if connStatus == CLOSED || connStatus == STOPPED {
+			return dbObj.Start()
+		}
+	case string(STOPPED):
+		if connStatus == RUNNING {
+			dbObj.Stop()
+		}
+	case string(CLOSED):
+		if connStatus == RUNNING {
+			dbObj.Stop()
+		}
+		dbObj.Close()
+	}
+	return nil
+}
+
+func getPipelineChannelId(dbObj *db, name string) int {
+	dbObj.RLock()
+	defer dbObj.RUnlock()
+	var channelId int
+	for id, c := range dbObj.channelMap {
+		if c.Name == name && (channelId == 0 || id < channelId) {
+			channelId = id
+		}
+	}
+	return channelId
+}
+
+func applyPipelineChannel(change *pipeline.Change) error {
+	dbObj := GetDB(change.Source)
+	if dbObj == nil {
+		return fmt.Errorf("db not exsit")
+	}
+	c := change.Channel
+	switch change.Action {
+	case pipeline.ADD:
+		ch, _ := dbObj.AddChannel(c.Name, c.MaxThreadNum)
+		setPipelineChannelStatus(ch, c.Status)
+	case pipeline.UPDATE:
+		ch := dbObj.GetChannel(getPipelineChannelId(dbObj, c.Name))
+		if ch == nil {
+			return fmt.Errorf("not exsit")
+		}
+		ch.SetChannelMaxThreadNum(c.MaxThreadNum)
+		setPipelineChannelStatus(ch, c.Status)
+	case pipeline.DELETE:
+		channelId := getPipelineChannelId(dbObj, c.Name)
+		if n := len(dbObj.GetTableByChannelKey(change.Source, channelId)); n > 0 {
+			return fmt.Errorf("The channel bind table count:%d", n)
+		}
+		DelChannel(change.Source, channelId)
+	}
+	return nil
+}
+
+func setPipelineChannelStatus(ch *Channel, status string) {
+	switch status {
+	case "", string(RUNNING):
+		ch.Start()
+	case string(STOPPED):
+		ch.Stop()
+	case string(CLOSED):
+		ch.Close()
+	}
+}
+
+func applyPipelineTable(change *pipeline.Change) error {
+	dbObj := GetDB(change.Source)
+	if dbObj == nil {
+		return fmt.Errorf("db not exsit")
+	}
+	t := change.Table
+	switch change.Action {
+	case pipeline.ADD:
+		channelId := getPipelineChannelId(dbObj, t.ChannelName)
+		if channelId == 0 {
+			return fmt.Errorf("channel:%s not exsit", t.ChannelName)
+		}
+		dbObj.AddTable(t.SchemaName, t.TableName, t.IgnoreTable, t.DoTable, channelId, 0)
+	case pipeline.UPDATE:
+		old := dbObj.GetTable(t.SchemaName, t.TableName)
+		if old == nil {
+			return fmt.Errorf("not exsit")
+		}
+		if old.ChannelKey != getPipelineChannelId(dbObj, t.ChannelName) {
+			return fmt.Errorf("ChannelName can't be changed")
+		}
+		if !dbObj.UpdateTable(t.SchemaName, t.TableName, t.IgnoreTable, t.DoTable) {
+			return fmt.Errorf("not exsit")
+		}
+	case pipeline.DELETE:
+		dbObj.DelTable(change.SchemaName, change.TableName)
+	}
+	return nil
+}
+
+func applyPipelineTableToServer(change *pipeline.Change) error {
+	dbObj := GetDB(change.Source)
+	if dbObj == nil {
+		return fmt.Errorf("db not exsit")
+	}
+	switch change.Action {
+	case pipeline.ADD:
+		toServer, err := newToServerByPipeline(change.TableToServer)
+		if err != nil {
+			return err
+		}
+		if toServer.InitialSnapshot {
+			if err = CheckInitialSnapshotSupported(dbObj, change.SchemaName, change.TableName); err != nil {
+				return err
+			}
+		}
+		if ok, _ := dbObj.AddTableToServer(change.SchemaName, change.TableName, toServer); !ok {
+			return fmt.Errorf("table not exsit")
+		}
+	case pipeline.REPLACE:
+		toServer, err := newToServerByPipeline(change.TableToServer)
+		if err != nil {
+			return err
+		}
+		old := getTableToServerByID(dbObj, change.SchemaName, change.TableName, change.ToServerID)
+		if old == nil {
+			return fmt.Errorf("ToServerID:%d not exsit", change.ToServerID)
+		}
+		// 新的同步配置从旧的同步配置最后成功的位点开始,队列中还有数据的情况下,替换会丢数据
+		old.RLock()
+		queueMsgCount := old.QueueMsgCount
+		toServer.LastSuccessBinlog = old.LastSuccessBinlog
+		toServer.LastQueueBinlog = old.LastQueueBinlog
+		// 已经全量完成的, 不再重新全量
+		if toServer.InitialSnapshot && old.InitialSnapshot && old.SnapshotStatus == SNAPSHOT_STATUS_CAUGHTUP {
+			toServer.SnapshotStatus = old.SnapshotStatus
+			toServer.SnapshotRowsCount = old.SnapshotRowsCount
+		}
+		old.RUnlock()
+		if queueMsgCount > 0 {
+			return fmt.Errorf("ToServerID:%d QueueMsgCount:%d > 0,please wait or stop db first", change.ToServerID, queueMsgCount)
+		}
+		dbObj.DelTableToServer(change.SchemaName, change.TableName, change.ToServerID)
+		if ok, _ := dbObj.AddTableToServer(change.SchemaName, change.TableName, toServer); !ok {
+			return fmt.Errorf("table not exsit")
+		}
+	case pipeline.DELETE:
+		dbObj.DelTableToServer(change.SchemaName, change.TableName, change.ToServerID)
+	}
+	return nil
+}
+
+func getTableToServerByID(dbObj *db, schemaName, tableName string, ToServerID int) *ToServer {
+	t := dbObj.GetTable(schemaName, tableName)
+	if t == nil {
+		return nil
+	}
+	t.RLock()
+	defer t.RUnlock()
+	for _, toServer := range t.ToServerList {
+		if toServer.ToServerID == ToServerID {
+			return toServer
+		}
+	}
+	return nil
+}
+
+// 和管理接口 /table/toserver/add 的校验保持一致
+func newToServerByPipeline(t *pipeline.TableToServer) (*ToServer, error) {
+	if pluginStorage.GetToServerInfo(t.ToServerKey) == nil {
+		return nil, fmt.Errorf("ToServerKey:%s not exsit", t.ToServerKey)
+	}
+	toServer := &ToServer{
+		MustBeSuccess:   t.MustBeSuccess,
+		FilterQuery:     t.FilterQuery,
+		FilterUpdate:    t.FilterUpdate,
+		ToServerKey:     t.ToServerKey,
+		PluginName:      t.PluginName,
+		FieldList:       t.FieldList,
+		Transforms:      t.Transforms,
+		ErrorPolicy:     ErrorPolicy(t.ErrorPolicy),
+		ErrorRetryCount: t.ErrorRetryCount,
+		Transaction:     t.Transaction,
+		InitialSnapshot: t.InitialSnapshot,
+		PluginParam:     t.PluginParam,
+	}
+	if t.Transaction {
+		if err := CheckTransactionSupported(t.ToServerKey); err != nil {
+			return nil, err
+		}
+	}
+	if t.DeadLetter != nil {
+		if t.DeadLetter.ToServerKey != "" && pluginStorage.GetToServerInfo(t.DeadLetter.ToServerKey) == nil {
+			return nil, fmt.Errorf("DeadLetter ToServerKey:%s not exsit", t.DeadLetter.ToServerKey)
+		}
+		toServer.DeadLetter = &DeadLetterConfig{
+			ToServerKey: t.DeadLetter.ToServerKey,
+			PluginParam: t.DeadLetter.PluginParam,
+		}
+	}
+	return toServer, nil
+}
@@ -0,0 +1,370 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/brokercap/Bifrost/server/secret"
+	"strings"
+)
+
+type Action string
+
+const (
+	ADD     Action = "add"
+	UPDATE  Action = "update"
+	REPLACE Action = "replace" // 表同步配置不支持修改,需要删除后再新增
+	DELETE  Action = "delete"
+)
+
+type Kind string
+
+const (
+	KINDTOSERVER      Kind = "toserver"
+	KINDSOURCE        Kind = "source"
+	KINDCHANNEL       Kind = "channel"
+	KINDTABLE         Kind = "table"
+	KINDTABLETOSERVER Kind = "table_toserver"
+)
+
+type Change struct {
+	Action Action
+	Kind   Kind
+	Path   string   // 配置的路径,如 mysqlTest/bifrost_test.t1/kafkaTest[0]
+	Fields []string // 修改的字段,Field: old => new
+
+	Source      string
+	SchemaName  string
+	TableName   string
+	ToServerKey string
+	ToServerID  int // 删除,替换的时候,运行中的同步配置 ID
+
+	ToServer      *ToServer      `json:",omitempty"`
+	SourceSpec    *Source        `json:",omitempty"`
+	Channel       *Channel       `json:",omitempty"`
+	Table         *Table         `json:",omitempty"`
+	TableToServer *TableToServer `json:",omitempty"`
+}
+
+type Plan struct {
+	Changes []*Change
+}
+
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+func (c *Change) String() string {
+	var prefix string
+	switch c.Action {
+	case ADD:
+		prefix = "+"
+	case UPDATE:
+		prefix = "~"
+	case REPLACE:
+		prefix = "-/+"
+	case DELETE:
+		prefix = "-"
+	}
+	s := prefix + " " + string(c.Kind) + " " + c.Path
+	for _, field := range c.Fields {
+		s += "\n    " + field
+	}
+	return s
+}
+
+func (p *Plan) String() string {
+	if p.Empty() {
+		return "No changes."
+	}
+	var add, update, del int
+	lines := make([]string, 0, len(p.Changes)+1)
+	for _, c := range p.Changes {
+		lines = append(lines, c.String())
+		switch c.Action {
+		case ADD:
+			add++
+		case UPDATE:
+			update++
+		case REPLACE:
+			add++
+			del++
+		case DELETE:
+			del++
+		}
+	}
+	lines = append(lines, fmt.Sprintf("Plan: %d to add, %d to change, %d to delete.", add, update, del))
+	return strings.Join(lines, "\n")
+}
+
+// 计算从 current 变成 desired 需要执行的变更
+// prune 为 false 的情况下,只新增和修改,desired 里没有的配置不删除
+// 变更的顺序就是执行的顺序,先新增修改 目标库连接,数据源,通道,表,表同步配置,再反过来删除
+func Diff(current, desired *Spec, prune bool) *Plan {
+	plan := &Plan{Changes: make([]*Change, 0)}
+	deletes := make([]*Change, 0)
+
+	currentToServerMap := make(map[string]*ToServer, 0)
+	for _, t := range current.ToServers {
+		currentToServerMap[t.ToServerKey] = t
+	}
+	desiredToServerMap := make(map[string]bool, 0)
+	for _, t := range desired.ToServers {
+		desiredToServerMap[t.ToServerKey] = true
+		old, ok := currentToServerMap[t.ToServerKey]
+		if !ok {
+			plan.add(&Change{Action: ADD, Kind: KINDTOSERVER, Path: t.ToServerKey, ToServerKey: t.ToServerKey, ToServer: t})
+			continue
+		}
+		fields := make([]string, 0)
+		fields = diffField(fields, "PluginName", old.PluginName, t.PluginName)
+		fields = diffUriField(fields, "ConnUri", old.ConnUri, t.ConnUri)
+		fields = diffField(fields, "Notes", old.Notes, t.Notes)
+		fields = diffField(fields, "MaxConn", old.MaxConn, t.MaxConn)
+		fields = diffField(fields, "MinConn", old.MinConn, t.MinConn)
+		if len(fields) > 0 {
+			plan.add(&Change{Action: UPDATE, Kind: KINDTOSERVER, Path: t.ToServerKey, Fields: fields, ToServerKey: t.ToServerKey, ToServer: t})
+		}
+	}
+	if prune {
+		for _, t := range current.ToServers {
+			if !desiredToServerMap[t.ToServerKey] {
+				deletes = append(deletes, &Change{Action: DELETE, Kind: KINDTOSERVER, Path: t.ToServerKey, ToServerKey: t.ToServerKey})
+			}
+		}
+	}
+
+	for _, s := range desired.Sources {
+		old := current.GetSource(s.Name)
+		if old == nil {
+			old = &Source{Name: s.Name}
+			plan.add(&Change{Action: ADD, Kind: KINDSOURCE, Path: s.Name, Source: s.Name, SourceSpec: s})
+		} else {
+			fields := make([]string, 0)
+			fields = diffField(fields, "InputType", old.InputType, s.InputType)
+			fields = diffUriField(fields, "ConnectUri", old.ConnectUri, s.ConnectUri)
+			fields = diffField(fields, "ServerId", old.ServerId, s.ServerId)
+			fields = diffField(fields, "LoopMarkerTable", old.LoopMarkerTable, s.LoopMarkerTable)
+			if s.Status != "" {
+				fields = diffField(fields, "Status", old.Status, s.Status)
+			}
+			if len(fields) > 0 {
+				plan.add(&Change{Action: UPDATE, Kind: KINDSOURCE, Path: s.Name, Fields: fields, Source: s.Name, SourceSpec: s})
+			}
+		}
+		deletes = append(diffSource(plan, old, s, prune), deletes...)
+	}
+	if prune {
+		sourceDeletes := make([]*Change, 0)
+		for _, s := range current.Sources {
+			if desired.GetSource(s.Name) == nil {
+				sourceDeletes = append(sourceDeletes, &Change{Action: DELETE, Kind: KINDSOURCE, Path: s.Name, Source: s.Name})
+			}
+		}
+		deletes = append(sourceDeletes, deletes...)
+	}
+	// 删除的顺序: 表同步配置,表,通道,数据源,目标库连接
+	plan.Changes = append(plan.Changes, sortDeletes(deletes)...)
+	return plan
+}
+
+func (p *Plan) add(c *Change) {
+	p.Changes = append(p.Changes, c)
+}
+
+// 对比一个数据源下的 通道,表,表同步配置,返回需要删除的变更
+func diffSource(plan *Plan, old, s *Source, prune bool) []*Change {
+	deletes := make([]*Change, 0)
+	for _, c := range s.Channels {
+		path := s.Name + "/" + c.Name
+		oldChannel := old.GetChannel(c.Name)
+		if oldChannel == nil {
+			plan.add(&Change{Action: ADD, Kind: KINDCHANNEL, Path: path, Source: s.Name, Channel: c})
+			continue
+		}
+		fields := make([]string, 0)
+		fields = diffField(fields, "MaxThreadNum", oldChannel.MaxThreadNum, c.MaxThreadNum)
+		if c.Status != "" {
+			fields = diffField(fields, "Status", oldChannel.Status, c.Status)
+		}
+		if len(fields) > 0 {
+			plan.add(&Change{Action: UPDATE, Kind: KINDCHANNEL, Path: path, Fields: fields, Source: s.Name, Channel: c})
+		}
+	}
+	if prune {
+		for _, c := range old.Channels {
+			if s.GetChannel(c.Name) == nil {
+				deletes = append(deletes, &Change{Action: DELETE, Kind: KINDCHANNEL, Path: s.Name + "/" + c.Name, Source: s.Name, Channel: c})
+			}
+		}
+	}
+
+	oldTableMap := make(map[string]*Table, 0)
+	for _, t := range old.Tables {
+		oldTableMap[t.Key()] = t
+	}
+	desiredTableMap := make(map[string]bool, 0)
+	for _, t := range s.Tables {
+		desiredTableMap[t.Key()] = true
+		path := s.Name + "/" + t.Key()
+		oldTable, ok := oldTableMap[t.Key()]
+		if !ok {
+			oldTable = &Table{SchemaName: t.SchemaName, TableName: t.TableName}
+			plan.add(&Change{Action: ADD, Kind: KINDTABLE, Path: path, Source: s.Name, SchemaName: t.SchemaName, TableName: t.TableName, Table: t})
+		} else {
+			fields := make([]string, 0)
+			fields = diffField(fields, "ChannelName", oldTable.ChannelName, t.ChannelName)
+			fields = diffField(fields, "IgnoreTable", oldTable.IgnoreTable, t.IgnoreTable)
+			fields = diffField(fields, "DoTable", oldTable.DoTable, t.DoTable)
+			if len(fields) > 0 {
+				plan.add(&Change{Action: UPDATE, Kind: KINDTABLE, Path: path, Fields: fields, Source: s.Name, SchemaName: t.SchemaName, TableName: t.TableName, Table: t})
+			}
+		}
+		deletes = append(deletes, diffTableToServer(plan, s.Name, oldTable, t, prune)...)
+	}
+	if prune {
+		for _, t := range old.Tables {
+			if !desiredTableMap[t.Key()] {
+				deletes = append(deletes, &Change{Action: DELETE, Kind: KINDTABLE, Path: s.Name + "/" + t.Key(), Source: s.Name, SchemaName: t.SchemaName, TableName: t.TableName})
+			}
+		}
+	}
+	return deletes
+}
+
+// 同一个表同一个 ToServerKey 的同步配置,按出现的顺序一一对应
+func diffTableToServer(plan *Plan, sourceName string, old, t *Table, prune bool) []*Change {
+	deletes := make([]*Change, 0)
+	oldKeyList := make(map[string][]*TableToServer, 0)
+	for _, toServer := range old.ToServers {
+		oldKeyList[toServer.ToServerKey] = append(oldKeyList[toServer.ToServerKey], toServer)
+	}
+	keyIndex := make(map[string]int, 0)
+	for _, toServer := range t.ToServers {
+		index := keyIndex[toServer.ToServerKey]
+		keyIndex[toServer.ToServerKey]++
+		change := &Change{
+			Kind:          KINDTABLETOSERVER,
+			Path:          fmt.Sprintf("%s/%s/%s[%d]", sourceName, t.Key(), toServer.ToServerKey, index),
+			Source:        sourceName,
+			SchemaName:    t.SchemaName,
+			TableName:     t.TableName,
+			ToServerKey:   toServer.ToServerKey,
+			TableToServer: toServer,
+		}
+		if index >= len(oldKeyList[toServer.ToServerKey]) {
+			change.Action = ADD
+			plan.add(change)
+			continue
+		}
+		oldToServer := oldKeyList[toServer.ToServerKey][index]
+		fields := diffTableToServerField(oldToServer, toServer)
+		if len(fields) > 0 {
+			change.Action = REPLACE
+			change.Fields = fields
+			change.ToServerID = oldToServer.ToServerID
+			plan.add(change)
+		}
+	}
+	if prune {
+		oldKeyIndex := make(map[string]int, 0)
+		for _, toServer := range old.ToServers {
+			index := oldKeyIndex[toServer.ToServerKey]
+			oldKeyIndex[toServer.ToServerKey]++
+			if index < keyIndex[toServer.ToServerKey] {
+				continue
+			}
+			deletes = append(deletes, &Change{
+				Action:      DELETE,
+				Kind:        KINDTABLETOSERVER,
+				Path:        fmt.Sprintf("%s/%s/%s[%d]", sourceName, t.Key(), toServer.ToServerKey, index),
+				Source:      sourceName,
+				SchemaName:  t.SchemaName,
+				TableName:   t.TableName,
+				ToServerKey: toServer.ToServerKey,
+				ToServerID:  toServer.ToServerID,
+			})
+		}
+	}
+	return deletes
+}
+
+func diffTableToServerField(old, t *TableToServer) []string {
+	fields := make([]string, 0)
+	if t.PluginName != "" {
+		fields = diffField(fields, "PluginName", old.PluginName, t.PluginName)
+	}
+	fields = diffField(fields, "MustBeSuccess", old.MustBeSuccess, t.MustBeSuccess)
+	fields = diffField(fields, "FilterQuery", old.FilterQuery, t.FilterQuery)
+	fields = diffField(fields, "FilterUpdate", old.FilterUpdate, t.FilterUpdate)
+	fields = diffField(fields, "ErrorPolicy", old.ErrorPolicy, t.ErrorPolicy)
+	fields = diffField(fields, "ErrorRetryCount", old.ErrorRetryCount, t.ErrorRetryCount)
+	fields = diffField(fields, "Transaction", old.Transaction, t.Transaction)
+	fields = diffField(fields, "InitialSnapshot", old.InitialSnapshot, t.InitialSnapshot)
+	fields = diffJsonField(fields, "FieldList", old.FieldList, t.FieldList)
+	fields = diffJsonField(fields, "Transforms", old.Transforms, t.Transforms)
+	fields = diffJsonField(fields, "PluginParam", old.PluginParam, t.PluginParam)
+	fields = diffJsonField(fields, "DeadLetter", old.DeadLetter, t.DeadLetter)
+	return fields
+}
+
+func diffField(fields []string, name string, old, new interface{}) []string {
+	if old == new {
+		return fields
+	}
+	return append(fields, fmt.Sprintf("%s: %v => %v", name, old, new))
+}
+
+// 连接地址 按 原值 对比, 显示的时候 密码脱敏
+func diffUriField(fields []string, name string, old, new string) []string {
+	if old == new {
+		return fields
+	}
+	return append(fields, fmt.Sprintf("%s: %v => %v", name, secret.MaskUri(old), secret.MaskUri(new)))
+}
+
+// 切片,map 等按 JSON 对比,nil 和空值认为是一样的
+func diffJsonField(fields []string, name string, old, new interface{}) []string {
+	oldStr := toJsonString(old)
+	newStr := toJsonString(new)
+	if oldStr == newStr {
+		return fields
+	}
+	return append(fields, fmt.Sprintf("%s: %s => %s", name, oldStr, newStr))
+}
+
+func toJsonString(v interface{}) string {
+	b, _ := json.Marshal(v)
+	switch string(b) {
+	case "[]", "{}":
+		return "null"
+	}
+	return string(b)
+}
+
+func sortDeletes(deletes []*Change) []*Change {
+	result := make([]*Change, 0, len(deletes))
+	for _, kind := range []Kind{KINDTABLETOSERVER, KINDTABLE, KINDCHANNEL, KINDSOURCE, KINDTOSERVER} {
+		for _, c := range deletes {
+			if c.Kind == kind {
+				result = append(result, c)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,163 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+)
+
+var testYaml = `
+toservers:
+  - toserverkey: kafkaTest
+    pluginname: kafka
+    connuri: 127.0.0.1:9092
+sources:
+  - name: mysqlTest
+    connecturi: root:root@tcp(127.0.0.1:3306)/test
+    serverid: 100
+    binlogfilename: mysql-bin.000001
+    binlogposition: 4
+    status: running
+    tables:
+      - schemaname: bifrost_test
+        tablename: t1
+        toservers:
+          - toserverkey: kafkaTest
+            errorpolicy: Skip
+            pluginparam:
+              Topic: t1
+`
+
+func TestParse(t *testing.T) {
+	spec, err := Parse([]byte(testYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.ToServers) != 1 || spec.ToServers[0].MaxConn != 10 || spec.ToServers[0].MinConn != 1 {
+		t.Fatalf("toserver default error:%+v", spec.ToServers)
+	}
+	s := spec.GetSource("mysqlTest")
+	if s == nil || s.InputType != "mysql" || s.ServerId != 100 {
+		t.Fatalf("source error:%+v", s)
+	}
+	if s.GetChannel("default") == nil || s.Tables[0].ChannelName != "default" {
+		t.Fatalf("default channel error:%+v", s.Channels)
+	}
+	toServer := s.Tables[0].ToServers[0]
+	if toServer.ErrorPolicy != "skip" || !toServer.MustBeSuccess || toServer.PluginParam["Topic"] != "t1" {
+		t.Fatalf("table toserver error:%+v", toServer)
+	}
+
+	// JSON 格式
+	spec, err = Parse([]byte(`{"Sources":[{"Name":"mysqlTest","ConnectUri":"uri","Tables":[{"SchemaName":"db","TableName":"t1","ToServers":[{"ToServerKey":"kafkaTest","ErrorPolicy":"block"}]}]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Sources[0].Tables[0].ToServers[0].ErrorPolicy != "" {
+		t.Fatalf("block ErrorPolicy must be empty")
+	}
+}
+
+func TestParse_Check(t *testing.T) {
+	for _, content := range []string{
+		"toservers:\n  - toserverkey: a\n",
+		"sources:\n  - name: a\n    connecturi: b\n    status: paused\n",
+		"sources:\n  - name: a\n    connecturi: b\n  - name: a\n    connecturi: b\n",
+		"sources:\n  - name: a\n    connecturi: b\n    tables:\n      - schemaname: db\n        tablename: t1\n        channelname: c1\n",
+		"sources:\n  - name: a\n    connecturi: b\n    tables:\n      - schemaname: db\n        tablename: t1\n        toservers:\n          - toserverkey: k\n            errorpolicy: retry\n",
+	} {
+		if _, err := Parse([]byte(content)); err == nil {
+			t.Fatalf("content:%s must be error", content)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	desired, err := Parse([]byte(testYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := Diff(&Spec{}, desired, false)
+	var kinds []string
+	for _, c := range plan.Changes {
+		if c.Action != ADD {
+			t.Fatalf("action must be add:%s", c)
+		}
+		kinds = append(kinds, string(c.Kind))
+	}
+	if strings.Join(kinds, ",") != strings.Join([]string{string(KINDTOSERVER), string(KINDSOURCE), string(KINDCHANNEL), string(KINDTABLE), string(KINDTABLETOSERVER)}, ",") {
+		t.Fatalf("add order error:%v", kinds)
+	}
+
+	// 当前配置和期望配置一样,不需要变更
+	current, _ := Parse([]byte(testYaml))
+	current.Sources[0].Tables[0].ToServers[0].ToServerID = 1
+	if plan = Diff(current, desired, true); !plan.Empty() || plan.String() != "No changes." {
+		t.Fatalf("plan must be empty:%s", plan)
+	}
+
+	// 表同步配置修改,删除旧的再新增
+	desired.Sources[0].Tables[0].ToServers[0].PluginParam["Topic"] = "t2"
+	plan = Diff(current, desired, false)
+	if len(plan.Changes) != 1 || plan.Changes[0].Action != REPLACE || plan.Changes[0].ToServerID != 1 {
+		t.Fatalf("replace error:%s", plan)
+	}
+
+	// prune 删除不在期望配置中的配置,删除表的时候表同步配置跟着删除,最后删除目标库连接
+	desired, _ = Parse([]byte(testYaml))
+	desired.ToServers = nil
+	desired.Sources[0].Tables = nil
+	plan = Diff(current, desired, false)
+	if !plan.Empty() {
+		t.Fatalf("without prune plan must be empty:%s", plan)
+	}
+	plan = Diff(current, desired, true)
+	kinds = kinds[:0]
+	for _, c := range plan.Changes {
+		if c.Action != DELETE {
+			t.Fatalf("action must be delete:%s", c)
+		}
+		kinds = append(kinds, string(c.Kind))
+	}
+	if strings.Join(kinds, ",") != strings.Join([]string{string(KINDTABLE), string(KINDTOSERVER)}, ",") {
+		t.Fatalf("delete order error:%v", kinds)
+	}
+	if !strings.HasSuffix(plan.String(), "Plan: 0 to add, 0 to change, 2 to delete.") {
+		t.Fatalf("plan string error:%s", plan)
+	}
+
+	// 删除数据源的时候,数据源下的配置跟着删除
+	plan = Diff(current, &Spec{}, true)
+	if len(plan.Changes) != 2 || plan.Changes[0].Kind != KINDSOURCE || plan.Changes[1].Kind != KINDTOSERVER {
+		t.Fatalf("delete source error:%s", plan)
+	}
+}
+
+func TestSpec_UnmaskUri(t *testing.T) {
+	current, _ := Parse([]byte(testYaml))
+	desired, _ := Parse([]byte(testYaml))
+	desired.MaskUri()
+	if desired.Sources[0].ConnectUri != "root:******@tcp(127.0.0.1:3306)/test" {
+		t.Fatalf("MaskUri error:%s", desired.Sources[0].ConnectUri)
+	}
+	// 导出之后 没有修改的连接地址, 使用 当前的
+	if err := desired.UnmaskUri(current); err != nil {
+		t.Fatal(err)
+	}
+	if plan := Diff(current, desired, true); !plan.Empty() {
+		t.Fatalf("plan must be empty:%s", plan)
+	}
+
+	// 密码修改之后, 变更计划中 密码脱敏
+	desired.Sources[0].ConnectUri = "root:root123@tcp(127.0.0.1:3306)/test"
+	plan := Diff(current, desired, false)
+	if len(plan.Changes) != 1 || plan.Changes[0].Action != UPDATE || strings.Contains(plan.String(), "root123") {
+		t.Fatalf("update error:%s", plan)
+	}
+
+	// 新增的数据源 没有原来的密码
+	desired.MaskUri()
+	desired.Sources[0].Name = "mysqlTest2"
+	if err := desired.UnmaskUri(current); err == nil {
+		t.Fatal("masked ConnectUri must be error")
+	}
+}
@@ -0,0 +1,339 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// 声明式的同步配置文件,一个文件描述 目标库连接,数据源,通道,表,表同步配置
+// 和当前运行中的配置对比生成变更计划,再按计划执行,重复执行结果一致
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/brokercap/Bifrost/server/secret"
+	"github.com/brokercap/Bifrost/server/transform"
+	"gopkg.in/yaml.v3"
+	"strings"
+)
+
+type Spec struct {
+	ToServers []*ToServer
+	Sources   []*Source
+}
+
+// 目标库连接配置,对应 /toserver/add
+type ToServer struct {
+	ToServerKey string
+	PluginName  string
+	ConnUri     string
+	Notes       string
+	MaxConn     int
+	MinConn     int
+}
+
+// 数据源,对应 /db/add
+// 位点相关的配置只有在新增数据源的时候有效,已经存在的数据源位点以运行中的为准
+type Source struct {
+	Name              string
+	InputType         string
+	ConnectUri        string
+	ServerId          uint32
+	BinlogFileName    string
+	BinlogPosition    uint32
+	Gtid              string
+	MaxBinlogFileName string
+	MaxBinlogPosition uint32
+	LoopMarkerTable   string // 双向同步 防回环 的标记表, schema.table
+	Status            string // running | stopped | closed ,为空则不修改状态
+	Channels          []*Channel
+	Tables            []*Table
+}
+
+type Channel struct {
+	Name         string
+	MaxThreadNum int
+	Status       string // running | stopped | closed ,为空则不修改状态
+}
+
+type Table struct {
+	SchemaName  string
+	TableName   string
+	ChannelName string
+	IgnoreTable string
+	DoTable     string
+	ToServers   []*TableToServer
+}
+
+// 表同步配置,对应 /table/toserver/add
+// 同一个表同一个 ToServerKey 有多个同步配置的时候,按出现的顺序对应
+type TableToServer struct {
+	ToServerKey     string
+	PluginName      string
+	FieldList       []string
+	Transforms      []*transform.Config
+	MustBeSuccess   bool
+	FilterQuery     bool
+	FilterUpdate    bool
+	PluginParam     map[string]interface{}
+	ErrorPolicy     string
+	ErrorRetryCount int
+	DeadLetter      *DeadLetter
+	Transaction     bool
+	InitialSnapshot bool
+
+	ToServerID int `json:"-"` // 运行中的同步配置 ID,只在对比的时候使用
+}
+
+type DeadLetter struct {
+	ToServerKey string
+	PluginParam map[string]interface{}
+}
+
+// 解析 YAML 或者 JSON 格式的配置,JSON 是 YAML 的子集,所以统一按 YAML 解析
+// 解析结果再转成 JSON 反序列化,字段名和管理接口的参数一样,不区分大小写
+func Parse(content []byte) (*Spec, error) {
+	var data interface{}
+	if err := yaml.Unmarshal(content, &data); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	spec := &Spec{}
+	if string(b) == "null" {
+		return spec, nil
+	}
+	if err = json.Unmarshal(b, spec); err != nil {
+		return nil, err
+	}
+	if err = spec.Check(); err != nil {
+		return nil, err
+	}
+	spec.SetDefault()
+	return spec, nil
+}
+
+func (spec *Spec) Check() error {
+	toServerKeyMap := make(map[string]bool, 0)
+	for _, t := range spec.ToServers {
+		if t.ToServerKey == "" || t.PluginName == "" || t.ConnUri == "" {
+			return fmt.Errorf("ToServers: ToServerKey,PluginName,ConnUri must be not empty")
+		}
+		if toServerKeyMap[t.ToServerKey] {
+			return fmt.Errorf("ToServers: ToServerKey:%s repeated", t.ToServerKey)
+		}
+		toServerKeyMap[t.ToServerKey] = true
+	}
+	sourceMap := make(map[string]bool, 0)
+	for _, s := range spec.Sources {
+		if s.Name == "" || s.ConnectUri == "" {
+			return fmt.Errorf("Sources: Name,ConnectUri must be not empty")
+		}
+		if sourceMap[s.Name] {
+			return fmt.Errorf("Sources: Name:%s repeated", s.Name)
+		}
+		sourceMap[s.Name] = true
+		if err := checkStatus(s.Status); err != nil {
+			return fmt.Errorf("Source:%s %s", s.Name, err)
+		}
+		channelMap := make(map[string]bool, 0)
+		for _, c := range s.Channels {
+			if c.Name == "" {
+				return fmt.Errorf("Source:%s Channels: Name must be not empty", s.Name)
+			}
+			if channelMap[c.Name] {
+				return fmt.Errorf("Source:%s Channel:%s repeated", s.Name, c.Name)
+			}
+			channelMap[c.Name] = true
+			if err := checkStatus(c.Status); err != nil {
+				return fmt.Errorf("Source:%s Channel:%s %s", s.Name, c.Name, err)
+			}
+		}
+		tableMap := make(map[string]bool, 0)
+		for _, t := range s.Tables {
+			if t.SchemaName == "" || t.TableName == "" {
+				return fmt.Errorf("Source:%s Tables: SchemaName,TableName must be not empty", s.Name)
+			}
+			if tableMap[t.Key()] {
+				return fmt.Errorf("Source:%s Table:%s repeated", s.Name, t.Key())
+			}
+			tableMap[t.Key()] = true
+			if t.ChannelName != "" && !channelMap[t.ChannelName] && !(t.ChannelName == "default" && len(s.Channels) == 0) {
+				return fmt.Errorf("Source:%s Table:%s Channel:%s not exsit", s.Name, t.Key(), t.ChannelName)
+			}
+			for _, toServer := range t.ToServers {
+				if toServer.ToServerKey == "" {
+					return fmt.Errorf("Source:%s Table:%s ToServers: ToServerKey must be not empty", s.Name, t.Key())
+				}
+				switch strings.ToLower(toServer.ErrorPolicy) {
+				case "", "block", "skip", "deadletter":
+					break
+				default:
+					return fmt.Errorf("Source:%s Table:%s ErrorPolicy:%s not supported", s.Name, t.Key(), toServer.ErrorPolicy)
+				}
+				if _, err := transform.NewPipeline(toServer.Transforms); err != nil {
+					return fmt.Errorf("Source:%s Table:%s %s", s.Name, t.Key(), err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func checkStatus(status string) error {
+	switch status {
+	case "", "running", "stopped", "closed":
+		return nil
+	default:
+		return fmt.Errorf("Status:%s not supported, must be running,stopped,closed", status)
+	}
+}
+
+// 和管理接口新增配置时的默认值保持一致,防止没有配置的字段每次对比都不一样
+func (spec *Spec) SetDefault() {
+	for _, t := range spec.ToServers {
+		if t.MaxConn <= 0 {
+			t.MaxConn = 10
+		}
+		if t.MaxConn > 512 {
+			t.MaxConn = 512
+		}
+		if t.MinConn <= 0 {
+			t.MinConn = 1
+		}
+		if t.MinConn > t.MaxConn {
+			t.MinConn = t.MaxConn
+		}
+	}
+	for _, s := range spec.Sources {
+		if s.InputType == "" {
+			s.InputType = "mysql"
+		}
+		// 新增数据源的时候,会自动创建 default 通道
+		if len(s.Channels) == 0 {
+			s.Channels = append(s.Channels, &Channel{Name: "default", MaxThreadNum: 1})
+		}
+		for _, c := range s.Channels {
+			if c.MaxThreadNum <= 0 {
+				c.MaxThreadNum = 1
+			}
+		}
+		for _, t := range s.Tables {
+			if t.ChannelName == "" {
+				t.ChannelName = s.Channels[0].Name
+			}
+			for _, toServer := range t.ToServers {
+				toServer.ErrorPolicy = strings.ToLower(toServer.ErrorPolicy)
+				if toServer.ErrorPolicy == "block" {
+					toServer.ErrorPolicy = ""
+				}
+				// skip,deadletter 策略下，插件需要将错误返回，才能进行跳过处理
+				if toServer.ErrorPolicy != "" {
+					toServer.MustBeSuccess = true
+				}
+			}
+		}
+	}
+}
+
+func (t *Table) Key() string {
+	return t.SchemaName + "." + t.TableName
+}
+
+func (spec *Spec) GetSource(name string) *Source {
+	for _, s := range spec.Sources {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func (spec *Spec) GetToServer(ToServerKey string) *ToServer {
+	for _, t := range spec.ToServers {
+		if t.ToServerKey == ToServerKey {
+			return t
+		}
+	}
+	return nil
+}
+
+// 导出 及 接口返回 之前, 连接地址 中的密码 脱敏
+func (spec *Spec) MaskUri() {
+	for _, t := range spec.ToServers {
+		t.ConnUri = secret.MaskUri(t.ConnUri)
+	}
+	for _, s := range spec.Sources {
+		s.ConnectUri = secret.MaskUri(s.ConnectUri)
+	}
+}
+
+// 导出的配置 密码是脱敏的, 和 current 中脱敏之后一样的 连接地址 使用 current 中的
+// 还有 ****** 的连接地址 不能使用, 需要填写密码 或者 使用 ${env:X} ${file:/path} 引用
+func (spec *Spec) UnmaskUri(current *Spec) error {
+	for _, t := range spec.ToServers {
+		if old := current.GetToServer(t.ToServerKey); old != nil {
+			t.ConnUri = secret.UnmaskUri(t.ConnUri, old.ConnUri)
+		}
+		if secret.IsMasked(t.ConnUri) {
+			return fmt.Errorf("ToServer:%s ConnUri password is masked", t.ToServerKey)
+		}
+	}
+	for _, s := range spec.Sources {
+		if old := current.GetSource(s.Name); old != nil {
+			s.ConnectUri = secret.UnmaskUri(s.ConnectUri, old.ConnectUri)
+		}
+		if secret.IsMasked(s.ConnectUri) {
+			return fmt.Errorf("Source:%s ConnectUri password is masked", s.Name)
+		}
+	}
+	return nil
+}
+
+func (s *Source) GetChannel(name string) *Channel {
+	for _, c := range s.Channels {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// 导出成 YAML 格式,字段名和 JSON 一致
+func (spec *Spec) ToYaml() ([]byte, error) {
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	var data yaml.Node
+	if err = yaml.Unmarshal(b, &data); err != nil {
+		return nil, err
+	}
+	// JSON 解析出来的节点是 flow 风格,这里改成 block 风格,方便阅读
+	setBlockStyle(&data)
+	return yaml.Marshal(&data)
+}
+
+func setBlockStyle(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode {
+		node.Style = 0
+	}
+	if node.Kind == yaml.ScalarNode && node.Style == yaml.DoubleQuotedStyle {
+		node.Style = 0
+	}
+	for _, child := range node.Content {
+		setBlockStyle(child)
+	}
+}
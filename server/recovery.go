@@ -22,11 +22,13 @@ import (
 	inputDriver "github.com/brokercap/Bifrost/input/driver"
 	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
 	"github.com/brokercap/Bifrost/server/filequeue"
+	"github.com/brokercap/Bifrost/server/secret"
 	"log"
 	"os"
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 type dbSaveInfo struct {
@@ -48,6 +50,7 @@ type dbSaveInfo struct {
 	MaxinlogDumpPosition  uint32                  `json:"MaxinlogDumpPosition"`
 	ReplicateDoDb         map[string]uint8        `json:"ReplicateDoDb"`
 	ServerId              uint32                  `json:"ServerId"`
+	LoopMarkerTable       string                  `json:"LoopMarkerTable"`
 	AddTime               int64                   `json:"AddTime"`
 }
 
@@ -144,15 +147,22 @@ func Recovery(content *json.RawMessage, isStop bool) {
 func recoveryData(data map[string]dbSaveInfo, isStop bool) {
 	for name, dbInfo := range data {
 		channelIDMap := make(map[int]int, 0)
+		// 配置了 master key 的情况下, 保存的是 加密之后的连接地址
+		connectUri, decryptErr := secret.Decrypt(dbInfo.ConnectUri)
+		if decryptErr != nil {
+			log.Println(name, "ConnectUri decrypt err:", decryptErr)
+		}
 		inputInfo := inputDriver.InputInfo{
 			IsGTID:         dbInfo.IsGtid,
-			ConnectUri:     dbInfo.ConnectUri,
+			ConnectUri:     connectUri,
 			GTID:           dbInfo.Gtid,
 			BinlogFileName: dbInfo.BinlogDumpFileName,
 			BinlogPostion:  dbInfo.BinlogDumpPosition,
 			ServerId:       dbInfo.ServerId,
 			MaxFileName:    dbInfo.MaxBinlogDumpFileName,
 			MaxPosition:    dbInfo.MaxinlogDumpPosition,
+
+			LoopMarkerTable: dbInfo.LoopMarkerTable,
 		}
 		if dbInfo.InputType == "" {
 			dbInfo.InputType = "mysql"
@@ -356,6 +366,15 @@ func recoveryData(data map[string]dbSaveInfo, isStop bool) {
 						ToServerKey:       toServer.ToServerKey,
 						PluginName:        toServer.PluginName,
 						FieldList:         toServer.FieldList,
+						Transforms:        toServer.Transforms,
+						ErrorPolicy:       toServer.ErrorPolicy,
+						ErrorRetryCount:   toServer.ErrorRetryCount,
+						DeadLetter:        toServer.DeadLetter,
+						Transaction:       toServer.Transaction,
+						InitialSnapshot:   toServer.InitialSnapshot,
+						SnapshotStatus:    toServer.SnapshotStatus,
+						SnapshotError:     toServer.SnapshotError,
+						SnapshotRowsCount: toServer.SnapshotRowsCount,
 						BinlogFileNum:     toServerBinlog.BinlogFileNum,
 						BinlogPosition:    toServerBinlog.BinlogPosition,
 						LastSuccessBinlog: toServerBinlog,
@@ -516,25 +535,20 @@ func recoveryData(data map[string]dbSaveInfo, isStop bool) {
 
 }
 
+// 停止所有数据源, ha 切换 及 进程退出 的时候调用
+// 数据源 Kill 的时候 会上报状态, 需要等 数据源 上报 停止 之后 再关闭 状态通道, 否则 上报状态 会 panic, 数据源 没有真正停止
 func StopAllChannel() {
 	DbLock.Lock()
-	for _, db := range DbList {
-		db.killStatus = 1
-		if db.inputStatusChan != nil {
-			close(db.inputStatusChan)
-		}
-		func() {
-			defer func() {
-				if err := recover(); err != nil {
-					return
-				}
-			}()
-			if db.inputDriverObj != nil {
-				db.inputDriverObj.Kill()
-			}
-		}()
+	defer DbLock.Unlock()
+	var wg sync.WaitGroup
+	for _, dbObj := range DbList {
+		wg.Add(1)
+		go func(dbObj *db) {
+			defer wg.Done()
+			dbObj.Kill()
+		}(dbObj)
 	}
-	DbLock.Unlock()
+	wg.Wait()
 }
 
 func SaveDBInfoToFileData() interface{} {
@@ -566,6 +580,7 @@ func SaveDBInfoToFileData() interface{} {
 			MaxinlogDumpPosition:  db.maxBinlogDumpPosition,
 			ReplicateDoDb:         db.replicateDoDb,
 			ServerId:              db.serverId,
+			LoopMarkerTable:       db.loopMarkerTable,
 			ChannelMap:            make(map[int]channelSaveInfo, 0),
 			TableMap:              db.tableMap,
 			AddTime:               db.AddTime,
@@ -580,7 +595,9 @@ func SaveDBInfoToFileData() interface{} {
 			}
 			c.Unlock()
 		}
-		log.Println(k, data[k])
+		logData := data[k]
+		logData.ConnectUri = secret.MaskUri(logData.ConnectUri)
+		log.Println(k, logData)
 		db.Unlock()
 	}
 	DbLock.Unlock()
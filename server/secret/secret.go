@@ -0,0 +1,249 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/brokercap/Bifrost/config"
+)
+
+/*
+数据源 及 目标库 连接地址 的密码管理
+
+1. 配置了 master key 的情况下, 连接地址 加密之后 再保存到 leveldb / redis 中, 格式为 enc:v1:base64(nonce+密文)
+   master key 从 环境变量 BIFROST_MASTER_KEY 或者 Bifrost.ini 中 secret_master_key_file 指定的文件 读取
+   没有配置 master key 的情况下, 和以前一样 明文保存
+
+2. 连接地址 中可以引用 外部的密码, 在连接的时候 才替换
+   ${env:MYSQL_PWD}                 环境变量
+   ${file:/run/secrets/mysql_pwd}   文件内容, 去掉首尾空白字符, 文件 只能在 Bifrost.ini 中 secret_file_dir 配置的目录下
+   比如 root:${file:/run/secrets/mysql_pwd}@tcp(127.0.0.1:3306)/test
+   密码更换之后, 只需要 重启 对应的数据源 或者 目标库同步, 不需要修改配置
+
+3. 接口返回 及 备份导出 的时候, 连接地址 中的密码 替换成 ******, 引用 不脱敏
+*/
+
+const (
+	MASK           string = "******"
+	ENCRYPT_PREFIX string = "enc:v1:"
+	MASTER_KEY_ENV string = "BIFROST_MASTER_KEY"
+)
+
+var masterKey []byte
+
+// 启动的时候 加载 master key, 配置了 secret_master_key_file 但是 读取失败 返回 error
+func InitMasterKey() error {
+	key := os.Getenv(MASTER_KEY_ENV)
+	if key == "" && config.SecretMasterKeyFile != "" {
+		b, err := ioutil.ReadFile(config.SecretMasterKeyFile)
+		if err != nil {
+			return fmt.Errorf("secret_master_key_file:%s read err:%s", config.SecretMasterKeyFile, err.Error())
+		}
+		key = strings.TrimSpace(string(b))
+		if key == "" {
+			return fmt.Errorf("secret_master_key_file:%s is empty", config.SecretMasterKeyFile)
+		}
+	}
+	setMasterKey(key)
+	return nil
+}
+
+// 任意长度的 key 通过 sha256 转换成 32 字节, 使用 AES-256-GCM 加密
+func setMasterKey(key string) {
+	if key == "" {
+		masterKey = nil
+		return
+	}
+	sum := sha256.Sum256([]byte(key))
+	masterKey = sum[:]
+}
+
+func getGCM() (cipher.AEAD, error) {
+	if masterKey == nil {
+		return nil, errors.New("master key is not configured")
+	}
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func IsEncrypted(s string) bool {
+	return strings.HasPrefix(s, ENCRYPT_PREFIX)
+}
+
+// 没有配置 master key 或者 已经加密过的情况下, 原样返回
+func Encrypt(s string) string {
+	if masterKey == nil || s == "" || IsEncrypted(s) {
+		return s
+	}
+	gcm, err := getGCM()
+	if err != nil {
+		log.Println("secret encrypt err:", err)
+		return s
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		log.Println("secret encrypt err:", err)
+		return s
+	}
+	return ENCRYPT_PREFIX + base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(s), nil))
+}
+
+// 没有加密过的 原样返回, 兼容 以前明文保存的配置
+func Decrypt(s string) (string, error) {
+	if !IsEncrypted(s) {
+		return s, nil
+	}
+	gcm, err := getGCM()
+	if err != nil {
+		return s, err
+	}
+	b, err := base64.StdEncoding.DecodeString(s[len(ENCRYPT_PREFIX):])
+	if err != nil {
+		return s, err
+	}
+	if len(b) < gcm.NonceSize() {
+		return s, errors.New("encrypted data is too short")
+	}
+	plain, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil)
+	if err != nil {
+		return s, fmt.Errorf("decrypt err:%s, master key maybe error", err.Error())
+	}
+	return string(plain), nil
+}
+
+var refReg = regexp.MustCompile(`\$\{(env|file):([^}]+)\}`)
+
+// 替换 连接地址 中的 ${env:X} ${file:/path} 引用
+func Resolve(uri string) (string, error) {
+	var err error
+	uri = refReg.ReplaceAllStringFunc(uri, func(ref string) string {
+		m := refReg.FindStringSubmatch(ref)
+		switch m[1] {
+		case "env":
+			val, ok := os.LookupEnv(m[2])
+			if !ok {
+				err = fmt.Errorf("env:%s not exsit", m[2])
+				return ref
+			}
+			return val
+		default:
+			file, err0 := checkSecretFile(m[2])
+			if err0 != nil {
+				err = fmt.Errorf("file:%s err:%s", m[2], err0.Error())
+				return ref
+			}
+			b, err0 := ioutil.ReadFile(file)
+			if err0 != nil {
+				err = fmt.Errorf("file:%s read err:%s", m[2], err0.Error())
+				return ref
+			}
+			return strings.TrimSpace(string(b))
+		}
+	})
+	return uri, err
+}
+
+// 管理后台的用户 可以修改连接地址, 不能通过 ${file:} 读取 secret_file_dir 以外的文件
+// 软链接 替换成 实际的路径 再判断
+func checkSecretFile(file string) (string, error) {
+	if config.SecretFileDir == "" {
+		return "", errors.New("secret_file_dir not be config")
+	}
+	dir, err := filepath.EvalSymlinks(config.SecretFileDir)
+	if err != nil {
+		return "", err
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	realFile, err := filepath.EvalSymlinks(file)
+	if err != nil {
+		return "", err
+	}
+	realFile, err = filepath.Abs(realFile)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(dir, realFile)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.New("not in secret_file_dir")
+	}
+	return realFile, nil
+}
+
+// 连接之前调用, 引用 替换失败 记录日志, 按 原来的地址 去连接, 由 连接 报错
+func ResolveUri(uri string) string {
+	newUri, err := Resolve(uri)
+	if err != nil {
+		log.Println("secret resolve uri:", MaskUri(uri), " err:", err)
+	}
+	return newUri
+}
+
+var paramPasswordReg = regexp.MustCompile(`(?i)(password|passwd|pwd|secret|token)=([^&\s]*)`)
+
+// 连接地址中的密码 替换为 ******, ${...} 引用的 不是密码本身, 不替换
+func MaskUri(uri string) string {
+	uri = maskUriUserPassword(uri)
+	return paramPasswordReg.ReplaceAllStringFunc(uri, func(s string) string {
+		m := paramPasswordReg.FindStringSubmatch(s)
+		if m[2] == "" || strings.Contains(m[2], "${") {
+			return s
+		}
+		return m[1] + "=" + MASK
+	})
+}
+
+// user:password@host 格式, 密码中可能有 @ / 等字符, 所以 host 前面 最后一个 @ 之前的 都是 user:password
+// ? 之后的参数中 也可能有 @, 只在 ? 之前查找
+func maskUriUserPassword(uri string) string {
+	var prefix string
+	if i := strings.Index(uri, "://"); i >= 0 {
+		prefix, uri = uri[:i+3], uri[i+3:]
+	}
+	authority := uri
+	if i := strings.Index(authority, "?"); i >= 0 {
+		authority = authority[:i]
+	}
+	at := strings.LastIndex(authority, "@")
+	if at < 0 {
+		return prefix + uri
+	}
+	colon := strings.Index(authority[:at], ":")
+	if colon < 0 {
+		return prefix + uri
+	}
+	password := authority[colon+1 : at]
+	if password == "" || strings.Contains(password, "${") {
+		return prefix + uri
+	}
+	return prefix + uri[:colon+1] + MASK + uri[at:]
+}
+
+func IsMasked(uri string) bool {
+	return strings.Contains(uri, MASK)
+}
+
+// 界面上修改的时候 提交的是 脱敏后的地址, 没有修改过 则使用 原来的地址
+func UnmaskUri(uri, oldUri string) string {
+	if IsMasked(uri) && oldUri != "" && MaskUri(oldUri) == uri {
+		return oldUri
+	}
+	return uri
+}
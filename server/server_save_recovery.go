@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"github.com/brokercap/Bifrost/config"
 	"github.com/brokercap/Bifrost/plugin"
+	pluginStorage "github.com/brokercap/Bifrost/plugin/storage"
+	"github.com/brokercap/Bifrost/server/secret"
 	"github.com/brokercap/Bifrost/server/storage"
 	"github.com/brokercap/Bifrost/server/user"
 	"github.com/brokercap/Bifrost/server/warning"
@@ -20,6 +22,7 @@ type recovery struct {
 	ToServer  *json.RawMessage
 	DbInfo    *json.RawMessage
 	User      *json.RawMessage
+	Role      *json.RawMessage
 	Warning   *json.RawMessage
 }
 
@@ -29,6 +32,7 @@ type recoveryDataSturct struct {
 	ToServer  interface{}
 	DbInfo    interface{}
 	User      interface{}
+	Role      interface{}
 	Warning   interface{}
 }
 
@@ -41,6 +45,10 @@ func DoRecoverySnapshotData() {
 	if err != nil {
 		return
 	}
+	recoverySnapshotData(fd)
+}
+
+func recoverySnapshotData(fd []byte) {
 	if string(fd) == "" {
 		return
 	}
@@ -60,6 +68,9 @@ func DoRecoverySnapshotData() {
 	if data.User != nil && string(*data.User) != "[]" {
 		user.RecoveryUser(data.User)
 	}
+	if data.Role != nil && string(*data.Role) != "[]" {
+		user.RecoveryRole(data.Role)
+	}
 
 	if data.Warning != nil && string(*data.Warning) != "{}" {
 		warning.RecoveryWarning(data.Warning)
@@ -67,6 +78,17 @@ func DoRecoverySnapshotData() {
 
 }
 
+// 数据源 配置, 连接地址 经过 uriFun 转换
+func getDbInfoSnapshotData(uriFun func(string) string) map[string]dbSaveInfo {
+	data := SaveDBInfoToFileData().(map[string]dbSaveInfo)
+	for name, dbInfo := range data {
+		dbInfo.ConnectUri = uriFun(dbInfo.ConnectUri)
+		data[name] = dbInfo
+	}
+	return data
+}
+
+// 备份导出, 连接地址 中的密码 脱敏, 导入之后 需要重新修改密码, 或者 使用 ${env:X} ${file:/path} 引用
 func GetSnapshotData() ([]byte, error) {
 	l.Lock()
 	defer func() {
@@ -78,15 +100,16 @@ func GetSnapshotData() ([]byte, error) {
 	data := recoveryDataSturct{
 		Version:   config.VERSION,
 		StartTime: GetServerStartTime(),
-		ToServer:  plugin.SaveToServerData(),
-		DbInfo:    SaveDBInfoToFileData(),
+		ToServer:  pluginStorage.GetToServerMapByUri(secret.MaskUri),
+		DbInfo:    getDbInfoSnapshotData(secret.MaskUri),
 		User:      user.GetUserList(),
+		Role:      user.GetRoleList(),
 		Warning:   warning.GetWarningConfigList(),
 	}
 	return json.Marshal(data)
 }
 
-// 只获取 数据源 和 目标库的镜像数据
+// 只获取 数据源 和 目标库的镜像数据, 配置了 master key 的情况下 连接地址 加密之后保存
 func GetSnapshotData2() ([]byte, error) {
 	l.Lock()
 	defer func() {
@@ -98,13 +121,17 @@ func GetSnapshotData2() ([]byte, error) {
 	data := recoveryDataSturct{
 		Version:   config.VERSION,
 		StartTime: GetServerStartTime(),
-		ToServer:  plugin.SaveToServerData(),
-		DbInfo:    SaveDBInfoToFileData(),
+		ToServer:  pluginStorage.GetToServerMapByUri(secret.Encrypt),
+		DbInfo:    getDbInfoSnapshotData(secret.Encrypt),
 	}
 	return json.Marshal(data)
 }
 
 func DoSaveSnapshotData() {
+	// follower 节点上没有数据源,不能覆盖 leader 节点保存的镜像数据
+	if !IsHALeader() {
+		return
+	}
 	var data []byte
 	var err error
 	for i := 0; i < 3; i++ {
@@ -141,4 +168,7 @@ func DoRecoveryByBackupData(fileContent string) {
 	if string(*data.User) != "[]" {
 		user.RecoveryUser(data.User)
 	}
+	if data.Role != nil && string(*data.Role) != "[]" {
+		user.RecoveryRole(data.Role)
+	}
 }
@@ -4,8 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/brokercap/Bifrost/config"
+	"github.com/brokercap/Bifrost/server/audit"
+	"github.com/brokercap/Bifrost/server/secret"
 	"github.com/brokercap/Bifrost/server/storage"
 	"hash/crc32"
+	"log"
+	"os"
 	"strconv"
 	"sync"
 	"time"
@@ -51,6 +55,13 @@ func init() {
 
 func InitStorage() {
 	storage.InitStorage()
+	// 恢复数据之前 加载 master key, 加载失败 不能启动, 否则 加密的连接地址 解密不了
+	if err := secret.InitMasterKey(); err != nil {
+		log.Println("secret master key init err:", err)
+		os.Exit(1)
+	}
+	// 定时清理 过期的审计日志
+	audit.InitAudit()
 	cachePoolCount = uint32(config.KeyCachePoolSize)
 	TmpPositioin = make([]*TmpPositioinStruct, cachePoolCount)
 	if cachePoolCount > 0 {
@@ -154,5 +165,6 @@ func delBinlogPosition(key []byte) error {
 }
 
 func Close() {
+	releaseHALease()
 	storage.Close()
 }
@@ -103,6 +103,19 @@ func GetListByPrefix(key []byte) (data []ListStruct) {
 	return data
 }
 
+// 租约操作不重试,由调用方按租约时间自行判断
+func AcquireLease(key []byte, val []byte, ttl time.Duration) (bool, error) {
+	return xdbClient.AcquireLease(DEFAULT_TABLE, string(key), val, ttl)
+}
+
+func ReleaseLease(key []byte, val []byte) error {
+	return xdbClient.ReleaseLease(DEFAULT_TABLE, string(key), val)
+}
+
+func GetMetaStorageType() string {
+	return metaStorageType
+}
+
 func Close() {
 	if xdbClient != nil {
 		xdbClient.Close()
@@ -160,3 +173,8 @@ func SaveDBInfo(data []byte) (err error) {
 	}
 	return
 }
+
+// 数据源 插件状态(比如 mysql 离线表结构历史) 的存储 key
+func GetInputStateKey(dbName string) []byte {
+	return []byte("input-state-" + dbName)
+}
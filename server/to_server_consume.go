@@ -5,6 +5,8 @@ import (
 	"github.com/brokercap/Bifrost/config"
 	"github.com/brokercap/Bifrost/plugin"
 	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	pluginStorage "github.com/brokercap/Bifrost/plugin/storage"
+	"github.com/brokercap/Bifrost/server/transform"
 	"github.com/brokercap/Bifrost/server/warning"
 	"io"
 	"log"
@@ -30,10 +32,12 @@ func (This *ToServer) Stop() {
 }
 
 // 暂停后,重新启动操作
+// 连接池中的连接 会重新连接, 连接地址 中 ${env:X} ${file:/path} 引用 的密码 重新读取
 func (This *ToServer) Start() {
 	This.Lock()
 	defer This.Unlock()
 	if This.Status == STOPPED {
+		pluginStorage.RefreshToServerUpdateTime(This.ToServerKey)
 		if This.ThreadCount == 0 {
 			This.Status = DEFAULT
 		} else {
@@ -62,6 +66,9 @@ func (This *ToServer) consume_to_server(db *db, SchemaName string, TableName str
 		This.PluginParam["BifrostFilterQuery"] = This.FilterQuery
 	}
 	This.Unlock()
+	if This.ErrorPolicy == ERRORPOLICYDEADLETTER {
+		This.InitDeadLetterQueue(db.Name, SchemaName, TableName)
+	}
 	toServerPositionBinlogKey := getToServerBinlogkey(db, This)
 	// 因为有多个地方对 ThreadCount - 1 操作，记录是否已经扣减过
 	var ThreadCountDecrDone bool = false
@@ -241,11 +248,59 @@ func (This *ToServer) consume_to_server(db *db, SchemaName string, TableName str
 		}
 		return false
 	}
+	// 连续出错的次数
+	var errCount int = 0
+	// 事务提交失败的时候, dataList 为整个事务中的数据, 全部写入死信队列
+	var checkDealErrorPolicy = func(dataList ...*pluginDriver.PluginDataType) bool {
+		if This.ErrorPolicy != ERRORPOLICYSKIP && This.ErrorPolicy != ERRORPOLICYDEADLETTER {
+			return false
+		}
+		if errCount <= This.getErrorRetryCount() {
+			return false
+		}
+		if This.ErrorPolicy == ERRORPOLICYDEADLETTER {
+			for _, data := range dataList {
+				if err := This.AppendDeadLetter(data, ErrData, errs); err != nil {
+					log.Println(db.Name, SchemaName, TableName, This.PluginName, This.ToServerKey, This.ToServerID, "AppendDeadLetter err:", err)
+					return false
+				}
+			}
+		}
+		// 通过插件层，跳过出错的数据
+		if This.SkipBinlog(MyConsumerId, ErrData) != nil {
+			return false
+		}
+		log.Println(db.Name, SchemaName, TableName, This.PluginName, This.ToServerKey, This.ToServerID, "ErrorPolicy:", This.ErrorPolicy, "skip err data, err:", errs)
+		This.DelWaitError()
+		lastErrTime = 0
+		errCount = 0
+		doWarningFun(warning.WARNINGNORMAL, "Return to normal by ErrorPolicy:"+string(This.ErrorPolicy))
+		return true
+	}
+	// 开启 Transaction 的时候，缓存的当前事务中的数据，到 commit 的时候一起提交
+	// 插件没有实现 TransactionDriver 的时候，还是逐条提交
+	transaction := This.Transaction && pluginDriver.SupportTransaction(This.PluginName)
+	if This.Transaction && !transaction {
+		log.Println(db.Name, SchemaName, TableName, This.PluginName, This.ToServerKey, This.ToServerID, "plugin not supported Transaction, commit one by one")
+	}
+	var transactionList []*pluginDriver.PluginDataType
+	// 当前事务缓存的数据超过 ToServerTransactionMaxSize, 剩下的数据 逐条提交, 直到 commit
+	var transactionOverflow bool
 	var forSendData = func(data *pluginDriver.PluginDataType) {
 		retry = false
+		isTransactionCommit := len(transactionList) > 0 && isCommitData(data)
+		defer func() {
+			if isTransactionCommit {
+				transactionList = nil
+			}
+		}()
 		for {
 			errs = nil
-			LastSuccessData, ErrData, errs = This.sendToServer(data, MyConsumerId, retry)
+			if isTransactionCommit {
+				LastSuccessData, ErrData, errs = This.sendTransactionToServer(transactionList, data, MyConsumerId, retry)
+			} else {
+				LastSuccessData, ErrData, errs = This.sendToServer(data, MyConsumerId, retry)
+			}
 			if This.MustBeSuccess == true {
 				if errs == nil {
 					if lastErrTime > 0 {
@@ -263,12 +318,21 @@ func (This *ToServer) consume_to_server(db *db, SchemaName string, TableName str
 				This.AddWaitError(errs, ErrData)
 				if lastErrTime == 0 {
 					fordo = 0
+					errCount = 0
 					lastErrTime = time.Now().Unix()
 				} else {
 					if checkDealSkipErrData() {
 						break
 					}
 				}
+				errCount++
+				if isTransactionCommit {
+					if checkDealErrorPolicy(append(append(make([]*pluginDriver.PluginDataType, 0, len(transactionList)+1), transactionList...), data)...) {
+						break
+					}
+				} else if checkDealErrorPolicy(data) {
+					break
+				}
 				fordo++
 				// 每重试2次,进行阻塞休眠一次
 				if fordo == 2 {
@@ -290,6 +354,85 @@ func (This *ToServer) consume_to_server(db *db, SchemaName string, TableName str
 
 	var n1 int = 0
 	var n0 int = 0
+	// 多行的数据 拆成一行一行提交
+	var sendData = func(data *pluginDriver.PluginDataType) {
+		switch data.EventType {
+		case "sql":
+			forSendData(data)
+			break
+		case "insert", "delete":
+			n1 = len(data.Rows)
+			if n1 > 1 {
+				n0 = 0
+				for _, v := range data.Rows {
+					n0++
+					d := &pluginDriver.PluginDataType{
+						Timestamp:      data.Timestamp,
+						EventType:      data.EventType,
+						Query:          "",
+						SchemaName:     data.SchemaName,
+						TableName:      data.TableName,
+						BinlogFileNum:  0,
+						BinlogPosition: 0,
+						Rows:           make([]map[string]interface{}, 1),
+						Gtid:           data.Gtid,
+						Pri:            data.Pri,
+						ColumnMapping:  data.ColumnMapping,
+						EventID:        data.EventID,
+						RowsQuery:      data.RowsQuery,
+					}
+					if n0 == n1 {
+						d.BinlogFileNum = data.BinlogFileNum
+						d.BinlogPosition = data.BinlogPosition
+					}
+					d.Rows[0] = v
+					d.PresentColumns = data.GetPresentColumns(n0-1, 1)
+					d.JsonDiffs = data.GetJsonDiffs(n0-1, 1)
+					forSendData(d)
+				}
+			} else {
+				forSendData(data)
+			}
+			break
+		case "update":
+			n1 = len(data.Rows)
+			if n1 > 2 {
+				for n0 = 0; n0 < n1; n0 += 2 {
+					d := &pluginDriver.PluginDataType{
+						Timestamp:      data.Timestamp,
+						EventType:      data.EventType,
+						Query:          "",
+						SchemaName:     data.SchemaName,
+						TableName:      data.TableName,
+						BinlogFileNum:  0,
+						BinlogPosition: 0,
+						Rows:           make([]map[string]interface{}, 2),
+						Gtid:           data.Gtid,
+						Pri:            data.Pri,
+						ColumnMapping:  data.ColumnMapping,
+						EventID:        data.EventID,
+						RowsQuery:      data.RowsQuery,
+					}
+					if n0 == n1-2 {
+						d.BinlogFileNum = data.BinlogFileNum
+						d.BinlogPosition = data.BinlogPosition
+					}
+					d.Rows[0] = data.Rows[n0]
+					d.Rows[1] = data.Rows[n0+1]
+					d.PresentColumns = data.GetPresentColumns(n0, 2)
+					d.JsonDiffs = data.GetJsonDiffs(n0, 2)
+					forSendData(d)
+				}
+			} else {
+				forSendData(data)
+			}
+			break
+		default:
+			forSendData(data)
+			break
+		}
+	}
+
 	var timer *time.Timer
 	timer = time.NewTimer(time.Duration(config.PluginCommitTimeOut) * time.Second)
 	defer timer.Stop()
@@ -361,75 +504,26 @@ func (This *ToServer) consume_to_server(db *db, SchemaName string, TableName str
 			CheckStatusFun()
 			warningStatus = false
 			timer.Stop()
-			switch data.EventType {
-			case "sql":
-				forSendData(data)
-				break
-			case "insert", "delete":
-				n1 = len(data.Rows)
-				if n1 > 1 {
-					n0 = 0
-					for _, v := range data.Rows {
-						n0++
-						d := &pluginDriver.PluginDataType{
-							Timestamp:      data.Timestamp,
-							EventType:      data.EventType,
-							Query:          "",
-							SchemaName:     data.SchemaName,
-							TableName:      data.TableName,
-							BinlogFileNum:  0,
-							BinlogPosition: 0,
-							Rows:           make([]map[string]interface{}, 1),
-							Gtid:           data.Gtid,
-							Pri:            data.Pri,
-							ColumnMapping:  data.ColumnMapping,
-							EventID:        data.EventID,
+			if transaction && !transactionOverflow {
+				switch data.EventType {
+				case "insert", "update", "delete":
+					transactionList = append(transactionList, data)
+					if len(transactionList) >= config.ToServerTransactionMaxSize {
+						log.Println(db.Name, SchemaName, TableName, This.PluginName, This.ToServerKey, This.ToServerID, "transaction size >=", config.ToServerTransactionMaxSize, ", commit one by one until the end of the transaction")
+						transactionOverflow = true
+						list := transactionList
+						transactionList = nil
+						for _, d := range list {
+							sendData(d)
 						}
-						if n0 == n1 {
-							d.BinlogFileNum = data.BinlogFileNum
-							d.BinlogPosition = data.BinlogPosition
-						}
-						d.Rows[0] = v
-						forSendData(d)
 					}
-				} else {
-					forSendData(data)
-				}
-				break
-			case "update":
-				n1 = len(data.Rows)
-				if n1 > 2 {
-					for n0 = 0; n0 < n1; n0 += 2 {
-						d := &pluginDriver.PluginDataType{
-							Timestamp:      data.Timestamp,
-							EventType:      data.EventType,
-							Query:          "",
-							SchemaName:     data.SchemaName,
-							TableName:      data.TableName,
-							BinlogFileNum:  0,
-							BinlogPosition: 0,
-							Rows:           make([]map[string]interface{}, 2),
-							Gtid:           data.Gtid,
-							Pri:            data.Pri,
-							ColumnMapping:  data.ColumnMapping,
-							EventID:        data.EventID,
-						}
-						if n0 == n1-2 {
-							d.BinlogFileNum = data.BinlogFileNum
-							d.BinlogPosition = data.BinlogPosition
-						}
-						d.Rows[0] = data.Rows[n0]
-						d.Rows[1] = data.Rows[n0+1]
-						forSendData(d)
-					}
-				} else {
-					forSendData(data)
+					continue
 				}
-				break
-			default:
-				forSendData(data)
-				break
 			}
+			if transactionOverflow && isCommitData(data) {
+				transactionOverflow = false
+			}
+			sendData(data)
 			//这里保存位点，为是了显示的时候，可以直接从内存中读取
 			SaveBinlog()
 			break
@@ -446,11 +540,15 @@ func (This *ToServer) consume_to_server(db *db, SchemaName string, TableName str
 			} else {
 				This.AddWaitError(errs, ErrData)
 				if This.MustBeSuccess && lastErrTime == 0 {
+					errCount = 0
 					lastErrTime = time.Now().Unix()
 					checkDoWarning()
 				}
 				if lastErrTime > 0 {
-					checkDealSkipErrData()
+					errCount++
+					if !checkDealSkipErrData() {
+						checkDealErrorPolicy(nil)
+					}
 				}
 			}
 			if noData == false {
@@ -458,7 +556,8 @@ func (This *ToServer) consume_to_server(db *db, SchemaName string, TableName str
 				log.Println("consume_to_server:", This.Notes, "toServerKey:", *This.Key, "MyConsumerId:", MyConsumerId, This.PluginName, This.ToServerKey, This.ToServerID, " start no data")
 			}
 			fileAck()
-			if LastSuccessData == nil && errs == nil {
+			// 事务还没结束的时候 不能退出，否则缓存的数据会丢失
+			if LastSuccessData == nil && errs == nil && len(transactionList) == 0 {
 				This.Lock()
 				if This.QueueMsgCount == 0 {
 					// 在全量任务的时候，有可能是起多个消费者,所以这里要判断一下，是不是只剩下一个消费者，只有一个消费者的时候的时候,再将 chan 关闭
@@ -483,6 +582,21 @@ func (This *ToServer) consume_to_server(db *db, SchemaName string, TableName str
 	}
 }
 
+// transform 配置在添加的时候已经校验过，这里只在第一次使用的时候初始化
+func (This *ToServer) getTransformPipeline() (*transform.Pipeline, error) {
+	This.transformLock.Lock()
+	defer This.transformLock.Unlock()
+	if This.transformPipeline != nil || len(This.Transforms) == 0 {
+		return This.transformPipeline, nil
+	}
+	pipeline, err := transform.NewPipeline(This.Transforms)
+	if err != nil {
+		return nil, err
+	}
+	This.transformPipeline = pipeline
+	return pipeline, nil
+}
+
 func (This *ToServer) filterField(data *pluginDriver.PluginDataType) (newData *pluginDriver.PluginDataType, b bool) {
 	n := len(data.Rows)
 	if n == 0 {
@@ -511,8 +625,10 @@ func (This *ToServer) filterField(data *pluginDriver.PluginDataType) (newData *p
 			Pri:            data.Pri,
 			ColumnMapping:  data.ColumnMapping,
 			EventID:        data.EventID,
+			RowsQuery:      data.RowsQuery,
 		}
 		newData.Rows[0] = m
+		newData.PresentColumns = This.filterPresentColumns(data)
 	} else {
 		newData = &pluginDriver.PluginDataType{
 			Timestamp:      data.Timestamp,
@@ -526,14 +642,28 @@ func (This *ToServer) filterField(data *pluginDriver.PluginDataType) (newData *p
 			Pri:            data.Pri,
 			ColumnMapping:  data.ColumnMapping,
 			EventID:        data.EventID,
+			RowsQuery:      data.RowsQuery,
 		}
 		m_before := make(map[string]interface{})
 		m_after := make(map[string]interface{})
 		var isNotUpdate bool = true
 		for _, key := range This.FieldList {
-			if _, ok := data.Rows[0][key]; ok {
+			_, beforeOk := data.Rows[0][key]
+			_, afterOk := data.Rows[1][key]
+			if beforeOk {
 				m_before[key] = data.Rows[0][key]
+			}
+			if afterOk {
 				m_after[key] = data.Rows[1][key]
+			}
+			// binlog_row_image = MINIMAL/NOBLOB 时 before 和 after 都只包含部分字段, after 中有的字段 认为是有变更的
+			if beforeOk != afterOk {
+				if afterOk {
+					isNotUpdate = false
+				}
+				continue
+			}
+			if beforeOk {
 				if This.FilterUpdate {
 					switch m_after[key].(type) {
 					case []string:
@@ -569,10 +699,55 @@ func (This *ToServer) filterField(data *pluginDriver.PluginDataType) (newData *p
 		}
 		newData.Rows[0] = m_before
 		newData.Rows[1] = m_after
+		newData.PresentColumns = This.filterPresentColumns(data)
+		newData.JsonDiffs = This.filterJsonDiffs(data)
 	}
 	return newData, true
 }
 
+// 过滤字段之后, json 字段的修改操作 也只保留 FieldList 中的字段
+func (This *ToServer) filterJsonDiffs(data *pluginDriver.PluginDataType) (jsonDiffs []map[string][]*pluginDriver.JsonDiff) {
+	if data.JsonDiffs == nil {
+		return nil
+	}
+	jsonDiffs = make([]map[string][]*pluginDriver.JsonDiff, len(data.JsonDiffs))
+	for i, columnDiffs := range data.JsonDiffs {
+		if columnDiffs == nil {
+			continue
+		}
+		jsonDiffs[i] = make(map[string][]*pluginDriver.JsonDiff, len(columnDiffs))
+		for _, key := range This.FieldList {
+			if diffs, ok := columnDiffs[key]; ok {
+				jsonDiffs[i][key] = diffs
+			}
+		}
+	}
+	return
+}
+
+// 过滤字段之后, 每行实际存在的字段 也只保留 FieldList 中的字段
+func (This *ToServer) filterPresentColumns(data *pluginDriver.PluginDataType) (presentColumns [][]string) {
+	if data.PresentColumns == nil {
+		return nil
+	}
+	presentColumns = make([][]string, len(data.PresentColumns))
+	for i, columns := range data.PresentColumns {
+		if columns == nil {
+			continue
+		}
+		presentColumns[i] = make([]string, 0)
+		for _, name := range columns {
+			for _, key := range This.FieldList {
+				if key == name {
+					presentColumns[i] = append(presentColumns[i], name)
+					break
+				}
+			}
+		}
+	}
+	return
+}
+
 // 从插件实例池中获取一个插件实例
 func (This *ToServer) getPluginAndSetParam(MyConsumerId int) (PluginConn *plugin.ToServerConn, err error) {
 	PluginConn = plugin.GetPlugin(This.ToServerKey)
@@ -589,6 +764,31 @@ func (This *ToServer) getPluginAndSetParam(MyConsumerId int) (PluginConn *plugin
 	return
 }
 
+// 插件实例放回实例池之前, 取出插件检测到的冲突数量
+func (This *ToServer) backPlugin(PluginConn *plugin.ToServerConn) {
+	if conflictConn, ok := PluginConn.GetConn().(pluginDriver.ConflictDriver); ok {
+		This.addConflictCount(conflictConn.GetConflictCount())
+	}
+	plugin.BackPlugin(PluginConn)
+}
+
+func (This *ToServer) addConflictCount(conflictCount map[string]uint64) {
+	if len(conflictCount) == 0 {
+		return
+	}
+	This.Lock()
+	defer This.Unlock()
+	// 每次都生成新的 map, 其他地方序列化 ToServer 的时候 不会读到正在修改的 map
+	newConflictCount := make(map[string]uint64, len(This.ConflictCount)+len(conflictCount))
+	for conflictType, n := range This.ConflictCount {
+		newConflictCount[conflictType] = n
+	}
+	for conflictType, n := range conflictCount {
+		newConflictCount[conflictType] += n
+	}
+	This.ConflictCount = newConflictCount
+}
+
 func (This *ToServer) timeOutCommit(MyConsumerId int) (LastSuccessCommitData *pluginDriver.PluginDataType, ErrData *pluginDriver.PluginDataType, err error) {
 	defer func() {
 		if err2 := recover(); err2 != nil {
@@ -599,7 +799,7 @@ func (This *ToServer) timeOutCommit(MyConsumerId int) (LastSuccessCommitData *pl
 
 	PluginConn, err := This.getPluginAndSetParam(MyConsumerId)
 	if PluginConn != nil {
-		defer plugin.BackPlugin(PluginConn)
+		defer This.backPlugin(PluginConn)
 	}
 	if err != nil {
 		return nil, nil, err
@@ -634,8 +834,11 @@ func (This *ToServer) sendToServer(paramData *pluginDriver.PluginDataType, MyCon
 		}
 	}()
 
-	// 只有所有字段内容都没有更新，并且开启了过滤功能的情况下，才会返回false
-	data, b := This.filterField(paramData)
+	data, b, err := This.transformData(paramData)
+	if err != nil {
+		return lastSuccessCommitData, data, err
+	}
+	// 被过滤掉的数据，当作提交成功处理
 	if b == false {
 		return paramData, nil, nil
 	}
@@ -643,27 +846,104 @@ func (This *ToServer) sendToServer(paramData *pluginDriver.PluginDataType, MyCon
 	if err != nil {
 		return lastSuccessCommitData, data, err
 	}
-	defer plugin.BackPlugin(PluginConn)
+	defer This.backPlugin(PluginConn)
+	return sendDataToPlugin(PluginConn.GetConn(), data, retry)
+}
+
+func isCommitData(data *pluginDriver.PluginDataType) bool {
+	switch data.EventType {
+	case "commit":
+		return true
+	case "sql":
+		return data.Query == "COMMIT"
+	default:
+		return false
+	}
+}
+
+// 将同一个源端事务中的数据 一次性提交给插件，commitData 为事务最后的 commit
+func (This *ToServer) sendTransactionToServer(list []*pluginDriver.PluginDataType, commitData *pluginDriver.PluginDataType, MyConsumerId int, retry bool) (lastSuccessCommitData *pluginDriver.PluginDataType, ErrData *pluginDriver.PluginDataType, err error) {
+	defer func() {
+		if err2 := recover(); err2 != nil {
+			err = fmt.Errorf("sendTransactionToServer:%s Commit Debug Err:%s", This.ToServerKey, string(debug.Stack()))
+			log.Println(This.ToServerKey, err2, err)
+		}
+	}()
+	transactionList := make([]*pluginDriver.PluginDataType, 0, len(list)+1)
+	for _, paramData := range list {
+		data, b, err := This.transformData(paramData)
+		if err != nil {
+			return nil, data, err
+		}
+		if b {
+			transactionList = append(transactionList, data)
+		}
+	}
+	data, b, err := This.transformData(commitData)
+	if err != nil {
+		return nil, data, err
+	}
+	if b == false {
+		data = commitData
+	}
+	transactionList = append(transactionList, data)
+	PluginConn, err := This.getPluginAndSetParam(MyConsumerId)
+	if err != nil {
+		return nil, data, err
+	}
+	defer This.backPlugin(PluginConn)
+	transactionConn, ok := PluginConn.GetConn().(pluginDriver.TransactionDriver)
+	if !ok {
+		return nil, data, fmt.Errorf("Plugin:%s not supported Transaction", This.PluginName)
+	}
+	return transactionConn.Transaction(transactionList, retry)
+}
+
+// 字段过滤及 transform 处理，返回 false 代表数据被过滤掉了，不需要提交给插件
+func (This *ToServer) transformData(paramData *pluginDriver.PluginDataType) (data *pluginDriver.PluginDataType, b bool, err error) {
+	// 只有所有字段内容都没有更新，并且开启了过滤功能的情况下，才会返回false
+	data, b = This.filterField(paramData)
+	if b == false {
+		return paramData, false, nil
+	}
+	pipeline, err := This.getTransformPipeline()
+	if err != nil {
+		return data, false, err
+	}
+	if pipeline.Len() > 0 {
+		var newData *pluginDriver.PluginDataType
+		newData, err = pipeline.Do(data)
+		if err != nil {
+			return data, false, err
+		}
+		if newData == nil {
+			return paramData, false, nil
+		}
+		data = newData
+	}
+	return data, true, nil
+}
 
+func sendDataToPlugin(conn pluginDriver.Driver, data *pluginDriver.PluginDataType, retry bool) (lastSuccessCommitData *pluginDriver.PluginDataType, ErrData *pluginDriver.PluginDataType, err error) {
 	switch data.EventType {
 	case "insert":
-		lastSuccessCommitData, ErrData, err = PluginConn.GetConn().Insert(data, retry)
+		lastSuccessCommitData, ErrData, err = conn.Insert(data, retry)
 		break
 	case "update":
-		lastSuccessCommitData, ErrData, err = PluginConn.GetConn().Update(data, retry)
+		lastSuccessCommitData, ErrData, err = conn.Update(data, retry)
 		break
 	case "delete":
-		lastSuccessCommitData, ErrData, err = PluginConn.GetConn().Del(data, retry)
+		lastSuccessCommitData, ErrData, err = conn.Del(data, retry)
 		break
 	case "sql":
 		if data.Query == "COMMIT" {
-			lastSuccessCommitData, ErrData, err = PluginConn.GetConn().Commit(data, retry)
+			lastSuccessCommitData, ErrData, err = conn.Commit(data, retry)
 		} else {
-			lastSuccessCommitData, ErrData, err = PluginConn.GetConn().Query(data, retry)
+			lastSuccessCommitData, ErrData, err = conn.Query(data, retry)
 		}
 		break
 	case "commit":
-		lastSuccessCommitData, ErrData, err = PluginConn.GetConn().Commit(data, retry)
+		lastSuccessCommitData, ErrData, err = conn.Commit(data, retry)
 		break
 	default:
 		break
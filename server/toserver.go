@@ -5,6 +5,7 @@ import (
 	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
 	pluginStorage "github.com/brokercap/Bifrost/plugin/storage"
 	"github.com/brokercap/Bifrost/server/filequeue"
+	"github.com/brokercap/Bifrost/server/transform"
 	"log"
 	"sync"
 )
@@ -21,6 +22,18 @@ type ToServer struct {
 	FilterUpdate  bool
 	FieldList     []string
 	ToServerKey   string
+	Transforms    []*transform.Config // 数据提交给插件之前的 transform 配置，按顺序执行
+
+	ErrorPolicy     ErrorPolicy       // 插件返回错误的处理策略，只有 MustBeSuccess 为 true 的时候才有效
+	ErrorRetryCount int               // skip,deadletter 策略下，出错后重试多少次再跳过，<= 0 使用默认值
+	DeadLetter      *DeadLetterConfig // deadletter 策略下，为 nil 则写入本地文件队列
+	Transaction     bool              // 按源端事务提交，两个 commit 之间的数据 缓存起来一次性提交给插件
+
+	InitialSnapshot   bool           // 先全量 再增量, 全量数据 按主键分块 和 增量 binlog 交替提交
+	SnapshotStatus    SnapshotStatus // 全量状态, running, caughtUp, error
+	SnapshotError     string
+	SnapshotRowsCount uint64 // 全量提交的数据条数
+	snapshot          *toServerSnapshot
 
 	LastSuccessBinlog *PositionStruct // 最后处理成功的位点信息
 	LastQueueBinlog   *PositionStruct // 最后进入队列的位点信息
@@ -35,6 +48,8 @@ type ToServer struct {
 	ErrorWaitDeal int
 	ErrorWaitData *pluginDriver.PluginDataType
 
+	ConflictCount map[string]uint64 // 插件检测到的冲突数量, key 为冲突类型
+
 	LastBinlogFileNum  int    // 由 channel 提交到 ToServerChan 的最后一个位点 // 将会在 1.8.x 版本开始去掉这个字段
 	LastBinlogPosition uint32 // 假如 BinlogFileNum == LastBinlogFileNum && BinlogPosition == LastBinlogPosition 则说明这个位点是没有问题的  // 支持到 1.8.x
 
@@ -48,6 +63,12 @@ type ToServer struct {
 	FileQueueUsableCountStartTime int64  // 开始统计 FileQueueUsableCount 计算的时间
 	statusChan                    chan bool
 	cosumerPluginParamArr         []interface{} `json:"-"` // 用以区分多个消费者的身份
+	transformPipeline             *transform.Pipeline
+	transformLock                 sync.Mutex
+	deadLetterQueue               *filequeue.Queue
+	deadLetterLock                sync.Mutex
+	deadLetterLastID              int64 // 最后一条死信数据的 ID
+	deadLetterAckID               int64 // 已经被重放或者清除的最大的死信数据 ID
 }
 
 /*
@@ -102,6 +123,9 @@ func (db *db) AddTableToServer(schemaName string, tableName string, toserver *To
 	if len(db.tableMap[key].ToServerList) == 1 && db.inputDriverObj != nil {
 		db.AddReplicateDoDb(schemaName, tableName, false)
 	}
+	if toserver.needSnapshot() {
+		db.startToServerSnapshot(schemaName, tableName, toserver)
+	}
 	log.Println("AddTableToServer", db.Name, schemaName, tableName, toserver)
 	return true, toserver.ToServerID
 }
@@ -136,6 +160,7 @@ func (db *db) DelTableToServer(schemaName string, tableName string, ToServerID i
 		db.tableMap[key].ToServerList = append(db.tableMap[key].ToServerList[:index], db.tableMap[key].ToServerList[index+1:]...)
 	}
 
+	db.unRegisterToServerSnapshot(toServerInfo)
 	if toServerInfo.Status == RUNNING || toServerInfo.Status == STOPPING {
 		toServerInfo.Status = DELING
 	} else {
@@ -151,9 +176,22 @@ func (db *db) DelTableToServer(schemaName string, tableName string, ToServerID i
 
 	//将文件队列的路径也相应的删除掉
 	filequeue.Delete(GetFileQueue(db.Name, schemaName, tableName, fmt.Sprint(ToServerID)))
+	filequeue.Delete(GetDeadLetterQueue(db.Name, schemaName, tableName, fmt.Sprint(ToServerID)))
 	return true
 }
 
+// 开启 Transaction 的时候，插件需要实现 TransactionDriver
+func CheckTransactionSupported(toServerKey string) error {
+	ToServerInfo := pluginStorage.GetToServerInfo(toServerKey)
+	if ToServerInfo == nil {
+		return fmt.Errorf("ToServerKey:%s not exsit", toServerKey)
+	}
+	if !pluginDriver.SupportTransaction(ToServerInfo.PluginName) {
+		return fmt.Errorf("Plugin:%s not supported Transaction", ToServerInfo.PluginName)
+	}
+	return nil
+}
+
 func (This *ToServer) UpdateBinlogPosition(BinlogFileNum int, BinlogPosition uint32, GTID string, Timestamp uint32) bool {
 	This.Lock()
 	This.LastSuccessBinlog = &PositionStruct{
@@ -0,0 +1,367 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/brokercap/Bifrost/config"
+	"github.com/brokercap/Bifrost/plugin"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"github.com/brokercap/Bifrost/server/filequeue"
+	"io"
+	"io/ioutil"
+	"log"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// skip,deadletter 策略下，默认出错重试次数
+const defaultErrorRetryCount = 3
+
+type DeadLetterConfig struct {
+	ToServerKey string                 // 死信数据提交到哪个 ToServer 里，为空则写入本地文件队列
+	PluginParam map[string]interface{} // 提交给 ToServerKey 对应插件的参数
+}
+
+type DeadLetterData struct {
+	ID          int64
+	Time        int64
+	ToServerKey string
+	PluginName  string
+	Error       string
+	Data        *pluginDriver.PluginDataType // 原始数据，重放的时候会重新经过字段过滤及 transform 处理
+	ErrData     *pluginDriver.PluginDataType // 插件返回的出错的数据
+}
+
+func GetDeadLetterQueue(dbName, SchemaName, tableName, ToServerID string) string {
+	return config.DataDir + "/deadletter/" + dbName + "/" + SchemaName + "/" + tableName + "/" + ToServerID
+}
+
+func (This *ToServer) getErrorRetryCount() int {
+	if This.ErrorRetryCount <= 0 {
+		return defaultErrorRetryCount
+	}
+	return This.ErrorRetryCount
+}
+
+// 初始化死信队列
+func (This *ToServer) InitDeadLetterQueue(dbName, SchemaName, tableName string) *ToServer {
+	This.deadLetterLock.Lock()
+	defer This.deadLetterLock.Unlock()
+	if This.deadLetterQueue == nil {
+		path := GetDeadLetterQueue(dbName, SchemaName, tableName, fmt.Sprint(This.ToServerID))
+		This.deadLetterQueue = filequeue.NewQueue(path)
+		This.deadLetterAckID = readDeadLetterAckID(path)
+	}
+	return This
+}
+
+// 文件队列在一个文件的数据没有全部被 ack 之前，文件是不会被删除的，重启后已经被重放的数据还会被重新读出来
+// 所以需要将已经被处理过的最大 ID 记录下来
+func readDeadLetterAckID(path string) int64 {
+	b, err := ioutil.ReadFile(path + "/ack")
+	if err != nil {
+		return 0
+	}
+	ID, _ := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	return ID
+}
+
+func (This *ToServer) newDeadLetterID() int64 {
+	ID := time.Now().UnixNano()
+	if ID <= This.deadLetterLastID {
+		ID = This.deadLetterLastID + 1
+	}
+	This.deadLetterLastID = ID
+	return ID
+}
+
+// 将出错的数据写入死信队列
+func (This *ToServer) AppendDeadLetter(data *pluginDriver.PluginDataType, errData *pluginDriver.PluginDataType, err error) error {
+	deadLetter := &DeadLetterData{
+		Time:        time.Now().Unix(),
+		ToServerKey: This.ToServerKey,
+		PluginName:  This.PluginName,
+		Data:        data,
+		ErrData:     errData,
+	}
+	if err != nil {
+		deadLetter.Error = err.Error()
+	}
+	This.deadLetterLock.Lock()
+	defer This.deadLetterLock.Unlock()
+	deadLetter.ID = This.newDeadLetterID()
+	if This.DeadLetter != nil && This.DeadLetter.ToServerKey != "" {
+		err0 := This.sendDeadLetterToServer(deadLetter)
+		if err0 == nil {
+			return nil
+		}
+		log.Println("ToServer:", This.ToServerKey, This.ToServerID, "send dead letter to", This.DeadLetter.ToServerKey, "err:", err0, " append to local queue")
+	}
+	if This.deadLetterQueue == nil {
+		return fmt.Errorf("deadletter queue not init")
+	}
+	b, err := json.Marshal(deadLetter)
+	if err != nil {
+		return err
+	}
+	return This.deadLetterQueue.AppendBytes(b)
+}
+
+// 将死信数据包装成一条 insert 数据，提交到另外一个 ToServer
+func (This *ToServer) sendDeadLetterToServer(deadLetter *DeadLetterData) (err error) {
+	defer func() {
+		if err2 := recover(); err2 != nil {
+			err = fmt.Errorf("ToServer:%s send dead letter Debug Err:%s", This.DeadLetter.ToServerKey, string(debug.Stack()))
+		}
+	}()
+	PluginConn := plugin.GetPlugin(This.DeadLetter.ToServerKey)
+	if PluginConn == nil {
+		return fmt.Errorf("Get Plugin ToServerKey:%s err,return nil", This.DeadLetter.ToServerKey)
+	}
+	defer plugin.BackPlugin(PluginConn)
+	param := make(map[string]interface{}, len(This.DeadLetter.PluginParam)+2)
+	for k, v := range This.DeadLetter.PluginParam {
+		param[k] = v
+	}
+	param["BifrostMustBeSuccess"] = true
+	param["BifrostFilterQuery"] = false
+	if _, err = PluginConn.GetConn().SetParam(param); err != nil {
+		return err
+	}
+	var schemaName, tableName, eventType string
+	srcData := deadLetter.Data
+	if srcData == nil {
+		srcData = deadLetter.ErrData
+	}
+	if srcData != nil {
+		schemaName, tableName, eventType = srcData.SchemaName, srcData.TableName, srcData.EventType
+	}
+	b, err := json.Marshal(srcData)
+	if err != nil {
+		return err
+	}
+	data := &pluginDriver.PluginDataType{
+		Timestamp:  uint32(deadLetter.Time),
+		EventType:  "insert",
+		SchemaName: schemaName,
+		TableName:  tableName,
+		Rows: []map[string]interface{}{
+			{
+				"ID":          deadLetter.ID,
+				"Time":        deadLetter.Time,
+				"ToServerKey": deadLetter.ToServerKey,
+				"PluginName":  deadLetter.PluginName,
+				"Error":       deadLetter.Error,
+				"EventType":   eventType,
+				"Data":        string(b),
+			},
+		},
+		Pri: []string{"ID"},
+		ColumnMapping: map[string]string{
+			"ID":          "int64",
+			"Time":        "int64",
+			"ToServerKey": "string",
+			"PluginName":  "string",
+			"Error":       "string",
+			"EventType":   "string",
+			"Data":        "json",
+		},
+	}
+	if _, _, err = PluginConn.GetConn().Insert(data, false); err != nil {
+		return err
+	}
+	_, _, err = PluginConn.GetConn().TimeOutCommit()
+	return err
+}
+
+// 按顺序遍历死信队列中还没被处理的数据，调用方需要加 deadLetterLock 锁
+func (This *ToServer) scanDeadLetter(f func(deadLetter *DeadLetterData) bool) (err error) {
+	if This.deadLetterQueue == nil {
+		return fmt.Errorf("deadletter queue not init")
+	}
+	err0 := This.deadLetterQueue.Scan(func(content []byte) bool {
+		var deadLetter DeadLetterData
+		if err = json.Unmarshal(content, &deadLetter); err != nil {
+			return false
+		}
+		if deadLetter.ID <= This.deadLetterAckID {
+			return true
+		}
+		return f(&deadLetter)
+	})
+	if err0 != nil {
+		return err0
+	}
+	return
+}
+
+// 分页查看死信队列中的数据
+func (This *ToServer) ListDeadLetter(offset, limit int) (list []*DeadLetterData, total int, err error) {
+	This.deadLetterLock.Lock()
+	defer This.deadLetterLock.Unlock()
+	list = make([]*DeadLetterData, 0)
+	err = This.scanDeadLetter(func(deadLetter *DeadLetterData) bool {
+		if total >= offset && (limit <= 0 || len(list) < limit) {
+			list = append(list, deadLetter)
+		}
+		total++
+		return true
+	})
+	return
+}
+
+func (This *ToServer) GetDeadLetter(ID int64) (data *DeadLetterData, err error) {
+	This.deadLetterLock.Lock()
+	defer This.deadLetterLock.Unlock()
+	err = This.scanDeadLetter(func(deadLetter *DeadLetterData) bool {
+		if deadLetter.ID == ID {
+			data = deadLetter
+			return false
+		}
+		return true
+	})
+	if err == nil && data == nil {
+		err = fmt.Errorf("dead letter ID:%d not exist", ID)
+	}
+	return
+}
+
+// 将死信队列最前面的 n 条数据重新提交给插件，n <= 0 则重放所有数据
+// 遇到错误则停止，返回成功重放的数量
+func (This *ToServer) ReplayDeadLetter(n int) (count int, err error) {
+	This.deadLetterLock.Lock()
+	defer This.deadLetterLock.Unlock()
+	list := make([]*DeadLetterData, 0)
+	err = This.scanDeadLetter(func(deadLetter *DeadLetterData) bool {
+		list = append(list, deadLetter)
+		return n <= 0 || len(list) < n
+	})
+	if err != nil || len(list) == 0 {
+		return
+	}
+	count, err = This.replayDeadLetter(list)
+	if count > 0 {
+		if err0 := This.ackDeadLetter(list[count-1].ID); err0 != nil && err == nil {
+			err = err0
+		}
+	}
+	return
+}
+
+func (This *ToServer) replayDeadLetter(list []*DeadLetterData) (count int, err error) {
+	defer func() {
+		if err2 := recover(); err2 != nil {
+			count = 0
+			err = fmt.Errorf("ToServer:%s replay dead letter Debug Err:%s", This.ToServerKey, string(debug.Stack()))
+		}
+	}()
+	PluginConn := plugin.GetPlugin(This.ToServerKey)
+	if PluginConn == nil {
+		return 0, fmt.Errorf("Get Plugin:%s ToServerKey:%s err,return nil", This.PluginName, This.ToServerKey)
+	}
+	defer plugin.BackPlugin(PluginConn)
+	This.Lock()
+	param := make(map[string]interface{}, len(This.PluginParam)+2)
+	for k, v := range This.PluginParam {
+		param[k] = v
+	}
+	This.Unlock()
+	// 重放的时候，需要知道每一条数据是否提交成功
+	param["BifrostMustBeSuccess"] = true
+	param["BifrostFilterQuery"] = This.FilterQuery
+	conn := PluginConn.GetConn()
+	if _, err = conn.SetParam(param); err != nil {
+		return 0, err
+	}
+	for _, deadLetter := range list {
+		data := deadLetter.Data
+		b := true
+		if data != nil {
+			data, b, err = This.transformData(data)
+			if err != nil {
+				break
+			}
+		} else {
+			data = deadLetter.ErrData
+			b = data != nil
+		}
+		if b {
+			if _, _, err = sendDataToPlugin(conn, data, false); err != nil {
+				break
+			}
+		}
+		count++
+	}
+	if count == 0 {
+		return
+	}
+	// 插件有可能是批量提交的，这里强制提交一次，提交失败，则当作全部失败处理
+	if _, _, err0 := conn.TimeOutCommit(); err0 != nil {
+		return 0, err0
+	}
+	return
+}
+
+// 清空死信队列，返回被清除的数量
+func (This *ToServer) PurgeDeadLetter() (count int, err error) {
+	This.deadLetterLock.Lock()
+	defer This.deadLetterLock.Unlock()
+	var lastID int64
+	err = This.scanDeadLetter(func(deadLetter *DeadLetterData) bool {
+		count++
+		lastID = deadLetter.ID
+		return true
+	})
+	if err != nil || count == 0 {
+		return
+	}
+	err = This.ackDeadLetter(lastID)
+	return
+}
+
+// 将 ID 及之前的数据从队列中移除，调用方需要加 deadLetterLock 锁
+func (This *ToServer) ackDeadLetter(ID int64) error {
+	This.deadLetterAckID = ID
+	if err := ioutil.WriteFile(This.deadLetterQueue.GetInfo().Path+"/ack", []byte(fmt.Sprint(ID)), 0600); err != nil {
+		return err
+	}
+	var n int
+	defer func() {
+		This.deadLetterQueue.Ack(n)
+	}()
+	for {
+		content, err := This.deadLetterQueue.Pop()
+		if err == io.EOF || (err == nil && content == nil) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		n++
+		var deadLetter DeadLetterData
+		if err = json.Unmarshal(content, &deadLetter); err != nil {
+			return err
+		}
+		if deadLetter.ID >= ID {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"fmt"
+	"github.com/brokercap/Bifrost/config"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"testing"
+)
+
+func TestToServer_DeadLetter(t *testing.T) {
+	oldDataDir := config.DataDir
+	config.DataDir = t.TempDir()
+	defer func() {
+		config.DataDir = oldDataDir
+	}()
+	toServer := &ToServer{ToServerID: 1, ToServerKey: "toServerKeyTest", PluginName: "pluginTest", ErrorPolicy: ERRORPOLICYDEADLETTER}
+	toServer.InitDeadLetterQueue("dbTest", "bifrost_test", "t1")
+	for i := 1; i <= 5; i++ {
+		data := &pluginDriver.PluginDataType{EventType: "insert", SchemaName: "bifrost_test", TableName: "t1", Rows: []map[string]interface{}{{"id": i}}}
+		if err := toServer.AppendDeadLetter(data, nil, fmt.Errorf("err %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, total, err := toServer.ListDeadLetter(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 5 || len(list) != 2 || list[0].Error != "err 2" {
+		t.Fatal("ListDeadLetter error, total:", total, " list:", list)
+	}
+	deadLetter, err := toServer.GetDeadLetter(list[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deadLetter.Error != "err 3" || deadLetter.Data.Rows[0]["id"] != float64(3) {
+		t.Fatal("GetDeadLetter error:", deadLetter)
+	}
+
+	// 模拟已经处理过前面 2 条数据
+	if err = toServer.ackDeadLetter(list[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	_, total, _ = toServer.ListDeadLetter(0, 0)
+	if total != 3 {
+		t.Fatal("ackDeadLetter total:", total, "!= 3")
+	}
+
+	// 重启之后，已经被处理过的数据，不能再被读出来
+	toServer2 := &ToServer{ToServerID: 1}
+	toServer2.deadLetterQueue = toServer.deadLetterQueue
+	toServer2.deadLetterAckID = readDeadLetterAckID(GetDeadLetterQueue("dbTest", "bifrost_test", "t1", "1"))
+	list, _, _ = toServer2.ListDeadLetter(0, 1)
+	if len(list) != 1 || list[0].Error != "err 3" {
+		t.Fatal("readDeadLetterAckID error:", list)
+	}
+
+	count, err := toServer.PurgeDeadLetter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Fatal("PurgeDeadLetter count:", count, "!= 3")
+	}
+	_, total, _ = toServer.ListDeadLetter(0, 0)
+	if total != 0 {
+		t.Fatal("PurgeDeadLetter total:", total, "!= 0")
+	}
+	if _, err = toServer.GetDeadLetter(list[0].ID); err == nil {
+		t.Fatal("GetDeadLetter after purge need error")
+	}
+}
@@ -0,0 +1,375 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"log"
+	"strings"
+	"sync"
+)
+
+/*
+新增同步配置的时候 先全量 再增量 (InitialSnapshot)
+参考 DBLog 的水位方式, 全量数据 按主键分块查询, 和增量 binlog 交替提交给同一个 ToServer
+
+	1. 在数据源的 水位表 中写入 low 水位
+	2. 查询下一块数据
+	3. 在数据源的 水位表 中写入 high 水位
+	4. 增量解析到 low 水位 之后, 记录 当前表 数据变更的主键
+	5. 增量解析到 high 水位 的时候, 将这一块数据中 主键没有变更过的数据 以 insert 的方式提交, 已经变更过的数据 以增量为准
+	6. 最后一块数据 进入 ToServer 队列 之后, 等 ToServer 的 LastSuccessBinlog 到达 high 水位 才算完成
+
+水位表的 row 事件 在 Callback 的时候 转到 全量表 所在的 channel 中, 所以 全量数据 和 增量数据 在 ToServer 中是有序的
+所有数据块 都被 ToServer 同步成功之后, 全量才算完成, SnapshotStatus 修改为 caughtUp
+
+只支持 MySQL 数据源, 表需要有主键, 不支持 模糊匹配的表, 需要对 水位表 有 建表 和 写入 的权限
+*/
+
+type SnapshotStatus string
+
+const (
+	SNAPSHOT_STATUS_RUNNING  SnapshotStatus = "running"
+	SNAPSHOT_STATUS_CAUGHTUP SnapshotStatus = "caughtUp"
+	SNAPSHOT_STATUS_ERROR    SnapshotStatus = "error"
+)
+
+// 全量的时候 在数据源中写入水位的表
+const (
+	SnapshotWatermarkSchema = "bifrost"
+	SnapshotWatermarkTable  = "bifrost_snapshot_watermark"
+)
+
+// 由 server/history 注册, history 引用了 server 包, 这里不能直接调用
+var toServerSnapshotRunner func(dbName, schemaName, tableName string, toServer *ToServer)
+
+func RegisterToServerSnapshotRunner(runner func(dbName, schemaName, tableName string, toServer *ToServer)) {
+	toServerSnapshotRunner = runner
+}
+
+type toServerSnapshot struct {
+	sync.Mutex
+	id            string
+	closed        bool
+	lowWatermark  string
+	highWatermark string
+	inWindow      bool            // 已经解析到 low 水位, 还没解析到 high 水位
+	highEventID   uint64          // 已经解析到的 high 水位 的 EventID
+	changedKeyMap map[string]bool // 窗口内 变更过的主键
+	pri           []string
+	columnMapping map[string]string
+	rows          []map[string]interface{}
+	doneChan      chan bool
+}
+
+// 和 InitialSnapshot 一起配置的时候 校验
+func CheckInitialSnapshotSupported(db *db, schemaName, tableName string) error {
+	if db == nil {
+		return fmt.Errorf("db not exsit")
+	}
+	if !strings.Contains(strings.ToLower(db.InputType), "mysql") {
+		return fmt.Errorf("InitialSnapshot not supported InputType:%s", db.InputType)
+	}
+	if strings.Contains(schemaName, "*") || strings.Contains(tableName, "*") {
+		return fmt.Errorf("InitialSnapshot not supported %s.%s", schemaName, tableName)
+	}
+	return nil
+}
+
+func GetToServerSnapshotID(dbName, schemaName, tableName string, toServerID int) string {
+	return dbName + "." + schemaName + "." + tableName + "." + fmt.Sprint(toServerID)
+}
+
+func getSnapshotRowKey(row map[string]interface{}, pri []string) string {
+	keys := make([]string, len(pri))
+	for i, name := range pri {
+		switch v := row[name].(type) {
+		case []byte:
+			keys[i] = string(v)
+		default:
+			keys[i] = fmt.Sprint(v)
+		}
+	}
+	return strings.Join(keys, "\x00")
+}
+
+func isSnapshotWatermarkEvent(data *pluginDriver.PluginDataType) bool {
+	return data.SchemaName == SnapshotWatermarkSchema && data.TableName == SnapshotWatermarkTable
+}
+
+// 水位表 只有 id, watermark 两个字段, update 事件 取更新后的数据
+func getSnapshotWatermark(data *pluginDriver.PluginDataType) (id string, watermark string) {
+	if len(data.Rows) == 0 {
+		return
+	}
+	row := data.Rows[len(data.Rows)-1]
+	return fmt.Sprint(row["id"]), fmt.Sprint(row["watermark"])
+}
+
+func (This *ToServer) needSnapshot() bool {
+	if !This.InitialSnapshot {
+		return false
+	}
+	return This.SnapshotStatus == "" || This.SnapshotStatus == SNAPSHOT_STATUS_RUNNING
+}
+
+func (This *ToServer) getSnapshot() *toServerSnapshot {
+	This.RLock()
+	defer This.RUnlock()
+	return This.snapshot
+}
+
+func (This *ToServer) SetSnapshotStatus(status SnapshotStatus, err error) {
+	This.Lock()
+	defer This.Unlock()
+	This.SnapshotStatus = status
+	if err != nil {
+		This.SnapshotError = err.Error()
+	} else {
+		This.SnapshotError = ""
+	}
+}
+
+// 同步配置被删除之后, 全量需要退出
+func (This *ToServer) IsSnapshotClosed() bool {
+	s := This.getSnapshot()
+	if s == nil {
+		return true
+	}
+	s.Lock()
+	defer s.Unlock()
+	return s.closed
+}
+
+// 写入 low 水位 之前调用, 返回的 chan 在 high 水位 的数据 放入 ToServer 队列 之后 写入, 这个时候 还没有同步成功
+func (This *ToServer) NewSnapshotChunk(lowWatermark, highWatermark string) chan bool {
+	s := This.getSnapshot()
+	if s == nil {
+		return nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.lowWatermark = lowWatermark
+	s.highWatermark = highWatermark
+	s.inWindow = false
+	s.highEventID = 0
+	s.changedKeyMap = make(map[string]bool, 0)
+	s.rows = nil
+	s.doneChan = make(chan bool, 1)
+	return s.doneChan
+}
+
+// 写入 high 水位 之前调用
+func (This *ToServer) SetSnapshotChunkRows(rows []map[string]interface{}) {
+	s := This.getSnapshot()
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.rows = rows
+}
+
+// 当前块 high 水位 之前的数据 是否都已经同步成功, LastSuccessBinlog 在 high 水位 的位点 或者 之后
+func (This *ToServer) IsSnapshotChunkCommitted() bool {
+	s := This.getSnapshot()
+	if s == nil {
+		return false
+	}
+	s.Lock()
+	highEventID := s.highEventID
+	s.Unlock()
+	if highEventID == 0 {
+		return false
+	}
+	LastSuccessBinlog := This.LastSuccessBinlog
+	return LastSuccessBinlog != nil && LastSuccessBinlog.EventID >= highEventID
+}
+
+// 窗口内 变更过的数据, 全量块中 以增量为准
+func (This *ToServer) snapshotRecordChangedKeys(data *pluginDriver.PluginDataType) {
+	s := This.getSnapshot()
+	if s == nil {
+		return
+	}
+	switch data.EventType {
+	case "insert", "update", "delete":
+		break
+	default:
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	if !s.inWindow || len(s.pri) == 0 {
+		return
+	}
+	for _, row := range data.Rows {
+		s.changedKeyMap[getSnapshotRowKey(row, s.pri)] = true
+	}
+}
+
+// 解析到 当前 ToServer 的水位, 返回 high 水位 需要提交的全量数据
+func (This *ToServer) snapshotWatermark(data *pluginDriver.PluginDataType) (list []*pluginDriver.PluginDataType, done chan bool) {
+	s := This.getSnapshot()
+	if s == nil {
+		return
+	}
+	id, watermark := getSnapshotWatermark(data)
+	s.Lock()
+	defer s.Unlock()
+	if id != s.id {
+		return
+	}
+	switch watermark {
+	case s.lowWatermark:
+		s.inWindow = true
+		return
+	case s.highWatermark:
+		break
+	default:
+		return
+	}
+	s.inWindow = false
+	s.highEventID = data.EventID
+	for _, row := range s.rows {
+		if s.changedKeyMap[getSnapshotRowKey(row, s.pri)] {
+			continue
+		}
+		list = append(list, &pluginDriver.PluginDataType{
+			Timestamp:       data.Timestamp,
+			EventType:       "insert",
+			Rows:            []map[string]interface{}{row},
+			SchemaName:      data.AliasSchemaName,
+			TableName:       data.AliasTableName,
+			AliasSchemaName: data.AliasSchemaName,
+			AliasTableName:  data.AliasTableName,
+			BinlogFileNum:   data.BinlogFileNum,
+			BinlogPosition:  data.BinlogPosition,
+			Gtid:            data.Gtid,
+			Pri:             s.pri,
+			ColumnMapping:   s.columnMapping,
+			EventID:         data.EventID,
+		})
+	}
+	s.rows = nil
+	s.changedKeyMap = make(map[string]bool, 0)
+	done = s.doneChan
+	return
+}
+
+func (This *consume_channel_obj) sendSnapshotWatermark(toServerInfo *ToServer, data *pluginDriver.PluginDataType) {
+	list, done := toServerInfo.snapshotWatermark(data)
+	for _, pluginData := range list {
+		This.sendToServerResult(toServerInfo, pluginData)
+	}
+	if done == nil {
+		return
+	}
+	toServerInfo.Lock()
+	toServerInfo.SnapshotRowsCount += uint64(len(list))
+	toServerInfo.Unlock()
+	select {
+	case done <- true:
+	default:
+	}
+}
+
+// 水位表 的数据 转到 全量表 所在的 channel
+func (db *db) callbackSnapshotWatermark(data *pluginDriver.PluginDataType) {
+	id, _ := getSnapshotWatermark(data)
+	db.RLock()
+	key, ok := db.snapshotWatermarkMap[id]
+	db.RUnlock()
+	if !ok {
+		return
+	}
+	schemaName, tableName := GetSchemaAndTableBySplit(key)
+	data0 := *data
+	data0.AliasSchemaName, data0.AliasTableName = schemaName, tableName
+	if db.Callback0(&data0) == false {
+		return
+	}
+	// Transaction 模式下 需要 commit 事件 才会提交给插件
+	if _, ok := db.lastTransactionTableMap[schemaName]; !ok {
+		db.lastTransactionTableMap[schemaName] = make(map[string]bool, 0)
+	}
+	db.lastTransactionTableMap[schemaName][tableName] = true
+}
+
+// 全量开始的时候 注册, 返回 写入水位表 的 id
+func (db *db) RegisterToServerSnapshot(schemaName, tableName string, toServer *ToServer, pri []string, columnMapping map[string]string) string {
+	id := GetToServerSnapshotID(db.Name, schemaName, tableName, toServer.ToServerID)
+	db.Lock()
+	defer db.Unlock()
+	if db.snapshotWatermarkMap == nil {
+		db.snapshotWatermarkMap = make(map[string]string, 0)
+	}
+	db.snapshotWatermarkMap[id] = GetSchemaAndTableJoin(schemaName, tableName)
+	if len(db.snapshotWatermarkMap) == 1 && db.inputDriverObj != nil {
+		db.AddReplicateDoDb(SnapshotWatermarkSchema, SnapshotWatermarkTable, false)
+	}
+	toServer.Lock()
+	toServer.snapshot = &toServerSnapshot{
+		id:            id,
+		changedKeyMap: make(map[string]bool, 0),
+		pri:           pri,
+		columnMapping: columnMapping,
+	}
+	toServer.Unlock()
+	return id
+}
+
+func (db *db) UnRegisterToServerSnapshot(toServer *ToServer) {
+	db.Lock()
+	defer db.Unlock()
+	db.unRegisterToServerSnapshot(toServer)
+}
+
+func (db *db) unRegisterToServerSnapshot(toServer *ToServer) {
+	s := toServer.getSnapshot()
+	if s == nil {
+		return
+	}
+	s.Lock()
+	s.closed = true
+	s.Unlock()
+	toServer.Lock()
+	toServer.snapshot = nil
+	toServer.Unlock()
+	if _, ok := db.snapshotWatermarkMap[s.id]; !ok {
+		return
+	}
+	delete(db.snapshotWatermarkMap, s.id)
+	if len(db.snapshotWatermarkMap) == 0 && db.inputDriverObj != nil {
+		db.DelReplicateDoDb(SnapshotWatermarkSchema, SnapshotWatermarkTable, false)
+	}
+}
+
+// 调用方 已经加了 db 锁
+func (db *db) startToServerSnapshot(schemaName, tableName string, toServer *ToServer) {
+	if toServerSnapshotRunner == nil {
+		toServer.SnapshotStatus = SNAPSHOT_STATUS_ERROR
+		toServer.SnapshotError = "snapshot runner not registered"
+		return
+	}
+	toServer.SnapshotStatus = SNAPSHOT_STATUS_RUNNING
+	toServer.SnapshotError = ""
+	toServer.SnapshotRowsCount = 0
+	log.Printf("dbName:%s SchemaName:%s TableName:%s ToServerID:%d initial snapshot start", db.Name, schemaName, tableName, toServer.ToServerID)
+	go toServerSnapshotRunner(db.Name, schemaName, tableName, toServer)
+}
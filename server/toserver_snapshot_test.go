@@ -0,0 +1,88 @@
+package server
+
+import (
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"testing"
+)
+
+func newTestWatermarkData(id, watermark string) *pluginDriver.PluginDataType {
+	return &pluginDriver.PluginDataType{
+		EventType:       "update",
+		SchemaName:      SnapshotWatermarkSchema,
+		TableName:       SnapshotWatermarkTable,
+		AliasSchemaName: "bifrost_test",
+		AliasTableName:  "t1",
+		BinlogFileNum:   1,
+		BinlogPosition:  100,
+		Rows: []map[string]interface{}{
+			{"id": id, "watermark": "before"},
+			{"id": id, "watermark": watermark},
+		},
+	}
+}
+
+func TestCheckInitialSnapshotSupported(t *testing.T) {
+	dbObj := &db{Name: "dbTest", InputType: "mysql"}
+	if err := CheckInitialSnapshotSupported(dbObj, "bifrost_test", "t1"); err != nil {
+		t.Fatal(err)
+	}
+	if CheckInitialSnapshotSupported(dbObj, "bifrost_test", "t*") == nil {
+		t.Fatal("like table must be error")
+	}
+	dbObj.InputType = "kafka"
+	if CheckInitialSnapshotSupported(dbObj, "bifrost_test", "t1") == nil {
+		t.Fatal("kafka must be error")
+	}
+}
+
+func TestToServer_SnapshotWatermark(t *testing.T) {
+	dbObj := &db{Name: "dbTest"}
+	toServer := &ToServer{ToServerID: 1, InitialSnapshot: true}
+	id := dbObj.RegisterToServerSnapshot("bifrost_test", "t1", toServer, []string{"id"}, map[string]string{"id": "int32"})
+	if dbObj.snapshotWatermarkMap[id] != GetSchemaAndTableJoin("bifrost_test", "t1") {
+		t.Fatal("snapshotWatermarkMap error:", dbObj.snapshotWatermarkMap)
+	}
+	doneChan := toServer.NewSnapshotChunk("low-1", "high-1")
+
+	// 窗口之前的变更 不影响 全量数据
+	toServer.snapshotRecordChangedKeys(&pluginDriver.PluginDataType{EventType: "delete", Rows: []map[string]interface{}{{"id": int32(1)}}})
+	if list, done := toServer.snapshotWatermark(newTestWatermarkData(id, "low-1")); list != nil || done != nil {
+		t.Fatal("low watermark must not emit data")
+	}
+	toServer.snapshotRecordChangedKeys(&pluginDriver.PluginDataType{EventType: "update", Rows: []map[string]interface{}{{"id": int32(2)}, {"id": int32(2)}}})
+	toServer.SetSnapshotChunkRows([]map[string]interface{}{{"id": int64(1)}, {"id": int64(2)}, {"id": int64(3)}})
+
+	// 其他同步配置的水位
+	if list, done := toServer.snapshotWatermark(newTestWatermarkData(id+"0", "high-1")); list != nil || done != nil {
+		t.Fatal("other watermark must not emit data")
+	}
+	if toServer.IsSnapshotChunkCommitted() {
+		t.Fatal("high watermark not parsed, must not be committed")
+	}
+	highData := newTestWatermarkData(id, "high-1")
+	highData.EventID = 10
+	list, done := toServer.snapshotWatermark(highData)
+	if done != doneChan {
+		t.Fatal("done chan error")
+	}
+	// 全量数据 放入队列 之后, 同步成功的位点 到达 high 水位 才算提交
+	toServer.LastSuccessBinlog = &PositionStruct{BinlogFileNum: 1, BinlogPosition: 90, EventID: 9}
+	if toServer.IsSnapshotChunkCommitted() {
+		t.Fatal("LastSuccessBinlog before high watermark, must not be committed")
+	}
+	toServer.LastSuccessBinlog = &PositionStruct{BinlogFileNum: 1, BinlogPosition: 100, EventID: 10}
+	if !toServer.IsSnapshotChunkCommitted() {
+		t.Fatal("LastSuccessBinlog at high watermark, must be committed")
+	}
+	if len(list) != 2 || list[0].Rows[0]["id"] != int64(1) || list[1].Rows[0]["id"] != int64(3) {
+		t.Fatal("high watermark emit data error:", list)
+	}
+	if list[0].EventType != "insert" || list[0].SchemaName != "bifrost_test" || list[0].TableName != "t1" || list[0].BinlogPosition != 100 {
+		t.Fatal("high watermark emit data error:", *list[0])
+	}
+
+	dbObj.UnRegisterToServerSnapshot(toServer)
+	if !toServer.IsSnapshotClosed() || len(dbObj.snapshotWatermarkMap) != 0 {
+		t.Fatal("UnRegisterToServerSnapshot error")
+	}
+}
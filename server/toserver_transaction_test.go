@@ -0,0 +1,166 @@
+package server
+
+import (
+	"fmt"
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/brokercap/Bifrost/config"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"github.com/brokercap/Bifrost/server/storage"
+	. "github.com/smartystreets/goconvey/convey"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIsCommitData(t *testing.T) {
+	caseList := []struct {
+		data   *pluginDriver.PluginDataType
+		commit bool
+	}{
+		{&pluginDriver.PluginDataType{EventType: "commit"}, true},
+		{&pluginDriver.PluginDataType{EventType: "sql", Query: "COMMIT"}, true},
+		{&pluginDriver.PluginDataType{EventType: "sql", Query: "ALTER TABLE t1 ADD COLUMN c1 int"}, false},
+		{&pluginDriver.PluginDataType{EventType: "insert"}, false},
+	}
+	for _, v := range caseList {
+		if isCommitData(v.data) != v.commit {
+			t.Fatal("isCommitData error:", v.data.EventType, v.data.Query)
+		}
+	}
+}
+
+type toServerTransactionTest struct {
+	sync.Mutex
+	sendList        []*pluginDriver.PluginDataType
+	transactionList [][]*pluginDriver.PluginDataType
+	transactionErr  error
+	done            chan bool
+}
+
+// mock 插件的提交方法, 返回 consume_to_server 的 db, 数据写入 toServer.ToServerChan.To
+func (m *toServerTransactionTest) start(toServer *ToServer) (*db, *gomonkey.Patches) {
+	m.done = make(chan bool, 10)
+	patches := gomonkey.ApplyFunc(pluginDriver.SupportTransaction, func(name string) bool {
+		return true
+	})
+	patches.ApplyFunc(storage.PutKeyVal, func(key []byte, val []byte) error {
+		return nil
+	})
+	patches.ApplyPrivateMethod(reflect.TypeOf(toServer), "sendToServer", func(_ *ToServer, data *pluginDriver.PluginDataType, MyConsumerId int, retry bool) (*pluginDriver.PluginDataType, *pluginDriver.PluginDataType, error) {
+		m.Lock()
+		m.sendList = append(m.sendList, data)
+		m.Unlock()
+		if isCommitData(data) {
+			m.done <- true
+		}
+		return data, nil, nil
+	})
+	patches.ApplyPrivateMethod(reflect.TypeOf(toServer), "sendTransactionToServer", func(_ *ToServer, list []*pluginDriver.PluginDataType, commitData *pluginDriver.PluginDataType, MyConsumerId int, retry bool) (*pluginDriver.PluginDataType, *pluginDriver.PluginDataType, error) {
+		m.Lock()
+		m.transactionList = append(m.transactionList, append(append([]*pluginDriver.PluginDataType{}, list...), commitData))
+		err := m.transactionErr
+		m.Unlock()
+		if err != nil {
+			return nil, commitData, err
+		}
+		m.done <- true
+		return commitData, nil, nil
+	})
+	patches.ApplyMethod(reflect.TypeOf(toServer), "SkipBinlog", func(_ *ToServer, MyConsumerId int, SkipErrData *pluginDriver.PluginDataType) error {
+		m.done <- true
+		return nil
+	})
+	key := "bifrost_test-t1"
+	toServer.Key = &key
+	toServer.ToServerChan = &ToServerChan{To: make(chan *pluginDriver.PluginDataType, 100)}
+	db := &db{Name: "dbTest"}
+	go toServer.consume_to_server(db, "bifrost_test", "t1")
+	return db, patches
+}
+
+func (m *toServerTransactionTest) wait(t *testing.T) {
+	select {
+	case <-m.done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("wait commit timeout")
+	}
+}
+
+func newTransactionTestData(eventType string, id int) *pluginDriver.PluginDataType {
+	data := &pluginDriver.PluginDataType{EventType: eventType, SchemaName: "bifrost_test", TableName: "t1", BinlogFileNum: 1, BinlogPosition: uint32(id)}
+	if eventType != "commit" {
+		data.Rows = []map[string]interface{}{{"id": id}}
+	}
+	return data
+}
+
+func TestToServer_Transaction(t *testing.T) {
+	defer func(n, n2, n3 int) {
+		config.ToServerTransactionMaxSize, config.PluginCommitTimeOut, config.PluginSyncRetrycTime = n, n2, n3
+	}(config.ToServerTransactionMaxSize, config.PluginCommitTimeOut, config.PluginSyncRetrycTime)
+	config.PluginCommitTimeOut = 60
+	config.PluginSyncRetrycTime = 0
+
+	Convey("buffer rows until commit", t, func() {
+		m := &toServerTransactionTest{}
+		toServer := &ToServer{ToServerID: 1, ToServerKey: "toServerKeyTest", PluginName: "pluginTest", Transaction: true, MustBeSuccess: true}
+		db, patches := m.start(toServer)
+		defer patches.Reset()
+		defer func() { db.killStatus = 1 }()
+		config.ToServerTransactionMaxSize = 100
+		toServer.ToServerChan.To <- newTransactionTestData("insert", 1)
+		toServer.ToServerChan.To <- newTransactionTestData("update", 2)
+		toServer.ToServerChan.To <- newTransactionTestData("commit", 3)
+		m.wait(t)
+		m.Lock()
+		defer m.Unlock()
+		So(len(m.sendList), ShouldEqual, 0)
+		So(len(m.transactionList), ShouldEqual, 1)
+		So(len(m.transactionList[0]), ShouldEqual, 3)
+		So(m.transactionList[0][2].EventType, ShouldEqual, "commit")
+	})
+
+	Convey("commit one by one after buffer size exceeded", t, func() {
+		m := &toServerTransactionTest{}
+		toServer := &ToServer{ToServerID: 2, ToServerKey: "toServerKeyTest", PluginName: "pluginTest", Transaction: true, MustBeSuccess: true}
+		db, patches := m.start(toServer)
+		defer patches.Reset()
+		defer func() { db.killStatus = 1 }()
+		config.ToServerTransactionMaxSize = 2
+		for i := 1; i <= 3; i++ {
+			toServer.ToServerChan.To <- newTransactionTestData("insert", i)
+		}
+		toServer.ToServerChan.To <- newTransactionTestData("commit", 4)
+		m.wait(t)
+		m.Lock()
+		defer m.Unlock()
+		So(len(m.transactionList), ShouldEqual, 0)
+		So(len(m.sendList), ShouldEqual, 4)
+		So(m.sendList[3].EventType, ShouldEqual, "commit")
+	})
+
+	Convey("deadletter the whole transaction on failure", t, func() {
+		oldDataDir := config.DataDir
+		config.DataDir = t.TempDir()
+		defer func() {
+			config.DataDir = oldDataDir
+		}()
+		m := &toServerTransactionTest{transactionErr: fmt.Errorf("commit err")}
+		toServer := &ToServer{ToServerID: 3, ToServerKey: "toServerKeyTest", PluginName: "pluginTest", Transaction: true, MustBeSuccess: true, ErrorPolicy: ERRORPOLICYDEADLETTER, ErrorRetryCount: 1}
+		db, patches := m.start(toServer)
+		defer patches.Reset()
+		defer func() { db.killStatus = 1 }()
+		config.ToServerTransactionMaxSize = 100
+		toServer.ToServerChan.To <- newTransactionTestData("insert", 1)
+		toServer.ToServerChan.To <- newTransactionTestData("delete", 2)
+		toServer.ToServerChan.To <- newTransactionTestData("commit", 3)
+		m.wait(t)
+		list, total, err := toServer.ListDeadLetter(0, 0)
+		So(err, ShouldBeNil)
+		So(total, ShouldEqual, 3)
+		So(list[0].Data.EventType, ShouldEqual, "insert")
+		So(list[1].Data.EventType, ShouldEqual, "delete")
+		So(list[2].Data.EventType, ShouldEqual, "commit")
+	})
+}
@@ -0,0 +1,193 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"fmt"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+)
+
+func init() {
+	Register("rename", NewRename)
+	Register("drop", NewDrop)
+	Register("add", NewAddConstant)
+}
+
+// 修改字段名, 主键 及 ColumnMapping 也会一起修改
+//
+//	{"Type":"rename","Param":{"Columns":{"old_name":"new_name"}}}
+type Rename struct {
+	columns map[string]string
+}
+
+func NewRename(param map[string]interface{}) (Transform, error) {
+	columns, err := getParamStringMap(param, "Columns")
+	if err != nil {
+		return nil, err
+	}
+	return &Rename{columns: columns}, nil
+}
+
+func (t *Rename) Transform(data *pluginDriver.PluginDataType) (bool, error) {
+	if !isRowEvent(data) {
+		return true, nil
+	}
+	for _, row := range data.Rows {
+		for oldName, newName := range t.columns {
+			if v, ok := row[oldName]; ok {
+				delete(row, oldName)
+				row[newName] = v
+			}
+		}
+	}
+	for i, name := range data.Pri {
+		if newName, ok := t.columns[name]; ok {
+			data.Pri[i] = newName
+		}
+	}
+	for _, columns := range data.PresentColumns {
+		for i, name := range columns {
+			if newName, ok := t.columns[name]; ok {
+				columns[i] = newName
+			}
+		}
+	}
+	for _, columnDiffs := range data.JsonDiffs {
+		for oldName, newName := range t.columns {
+			if diffs, ok := columnDiffs[oldName]; ok {
+				delete(columnDiffs, oldName)
+				columnDiffs[newName] = diffs
+			}
+		}
+	}
+	for oldName, newName := range t.columns {
+		if v, ok := data.ColumnMapping[oldName]; ok {
+			delete(data.ColumnMapping, oldName)
+			data.ColumnMapping[newName] = v
+		}
+	}
+	return true, nil
+}
+
+// 删除字段
+//
+//	{"Type":"drop","Param":{"Columns":["password"]}}
+type Drop struct {
+	columns []string
+}
+
+func NewDrop(param map[string]interface{}) (Transform, error) {
+	columns, err := getParamStringList(param, "Columns")
+	if err != nil {
+		return nil, err
+	}
+	return &Drop{columns: columns}, nil
+}
+
+func (t *Drop) Transform(data *pluginDriver.PluginDataType) (bool, error) {
+	if !isRowEvent(data) {
+		return true, nil
+	}
+	for _, row := range data.Rows {
+		for _, name := range t.columns {
+			delete(row, name)
+		}
+	}
+	for i, columns := range data.PresentColumns {
+		if columns == nil {
+			continue
+		}
+		newColumns := make([]string, 0, len(columns))
+		for _, name := range columns {
+			if !inStringList(t.columns, name) {
+				newColumns = append(newColumns, name)
+			}
+		}
+		data.PresentColumns[i] = newColumns
+	}
+	for _, columnDiffs := range data.JsonDiffs {
+		for _, name := range t.columns {
+			delete(columnDiffs, name)
+		}
+	}
+	for _, name := range t.columns {
+		delete(data.ColumnMapping, name)
+		for i, pri := range data.Pri {
+			if pri == name {
+				data.Pri = append(data.Pri[:i], data.Pri[i+1:]...)
+				break
+			}
+		}
+	}
+	return true, nil
+}
+
+// 增加一个常量字段, 字段已经存在的情况下会被覆盖
+// ColumnType 不填的情况下，默认为 string
+//
+//	{"Type":"add","Param":{"Column":"source","Value":"bifrost","ColumnType":"string"}}
+type AddConstant struct {
+	column     string
+	value      interface{}
+	columnType string
+}
+
+func NewAddConstant(param map[string]interface{}) (Transform, error) {
+	column, err := getParamString(param, "Column", true)
+	if err != nil {
+		return nil, err
+	}
+	columnType, _ := getParamString(param, "ColumnType", false)
+	value := param["Value"]
+	if columnType == "" {
+		columnType = "string"
+	} else if value != nil {
+		// 按 ColumnType 对常量值进行转换，保证和 ColumnMapping 一致
+		if value, err = castValue(value, columnType); err != nil {
+			return nil, fmt.Errorf("Value:%v cast to %s err:%s", param["Value"], columnType, err)
+		}
+	}
+	return &AddConstant{column: column, value: value, columnType: columnType}, nil
+}
+
+func (t *AddConstant) Transform(data *pluginDriver.PluginDataType) (bool, error) {
+	if !isRowEvent(data) {
+		return true, nil
+	}
+	for _, row := range data.Rows {
+		row[t.column] = t.value
+	}
+	for i, columns := range data.PresentColumns {
+		if columns != nil && !inStringList(columns, t.column) {
+			data.PresentColumns[i] = append(columns, t.column)
+		}
+	}
+	if data.ColumnMapping == nil {
+		data.ColumnMapping = make(map[string]string, 1)
+	}
+	data.ColumnMapping[t.column] = t.columnType
+	return true, nil
+}
+
+func inStringList(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
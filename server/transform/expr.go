@@ -0,0 +1,77 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"fmt"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+)
+
+func init() {
+	Register("expr", NewExprFilter)
+}
+
+// 按表达式过滤数据，表达式结果为 true 的行才会被同步
+// 非 insert,update,delete 事件，rowIndex 为 -1 ，只能使用 EventType,Query 等元信息进行判断
+//
+//	{"Type":"expr","Param":{"Expr":"EventType == \"update\" && after.amount > before.amount * 2"}}
+type ExprFilter struct {
+	expr *pluginDriver.Expr
+}
+
+func NewExprFilter(param map[string]interface{}) (Transform, error) {
+	source, err := getParamString(param, "Expr", true)
+	if err != nil {
+		return nil, err
+	}
+	expr, err := pluginDriver.GetExpr(source)
+	if err != nil {
+		return nil, fmt.Errorf("Expr:%s compile err:%s", source, err)
+	}
+	return &ExprFilter{expr: expr}, nil
+}
+
+func (t *ExprFilter) Transform(data *pluginDriver.PluginDataType) (bool, error) {
+	if !isRowEvent(data) {
+		return t.expr.EvalBool(data, -1)
+	}
+	rows := make([]map[string]interface{}, 0, len(data.Rows))
+	var presentColumns [][]string
+	var jsonDiffs []map[string][]*pluginDriver.JsonDiff
+	step := 1
+	if data.EventType == "update" {
+		step = 2
+	}
+	for i := 0; i+step-1 < len(data.Rows); i += step {
+		ok, err := t.expr.EvalBool(data, i)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			rows = append(rows, data.Rows[i:i+step]...)
+			presentColumns = append(presentColumns, data.GetPresentColumns(i, step)...)
+			jsonDiffs = append(jsonDiffs, data.GetJsonDiffs(i, step)...)
+		}
+	}
+	if len(rows) == 0 {
+		return false, nil
+	}
+	data.Rows = rows
+	data.PresentColumns = presentColumns
+	data.JsonDiffs = jsonDiffs
+	return true, nil
+}
@@ -0,0 +1,237 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"fmt"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register("filter", NewFilter)
+}
+
+type filterCondition struct {
+	column   string
+	operator string
+	value    interface{}
+	values   []interface{}
+}
+
+// 行过滤，只有满足条件的行才会被同步
+// update 事件 根据 更新后的数据 进行判断
+//
+//	{"Type":"filter","Param":{"Relation":"and","Conditions":[{"Column":"status","Operator":"!=","Value":"deleted"}]}}
+type Filter struct {
+	isOr       bool
+	conditions []*filterCondition
+}
+
+func NewFilter(param map[string]interface{}) (Transform, error) {
+	relation, _ := getParamString(param, "Relation", false)
+	t := &Filter{}
+	switch strings.ToLower(relation) {
+	case "", "and":
+	case "or":
+		t.isOr = true
+	default:
+		return nil, fmt.Errorf("Relation:%s not supported", relation)
+	}
+	list, ok := param["Conditions"].([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("Conditions is required")
+	}
+	for i, v := range list {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Conditions[%d] must be a object", i)
+		}
+		c, err := newFilterCondition(m)
+		if err != nil {
+			return nil, fmt.Errorf("Conditions[%d] %s", i, err)
+		}
+		t.conditions = append(t.conditions, c)
+	}
+	return t, nil
+}
+
+func newFilterCondition(m map[string]interface{}) (c *filterCondition, err error) {
+	c = &filterCondition{}
+	if c.column, err = getParamString(m, "Column", true); err != nil {
+		return nil, err
+	}
+	if c.operator, err = getParamString(m, "Operator", true); err != nil {
+		return nil, err
+	}
+	c.operator = strings.ToLower(strings.TrimSpace(c.operator))
+	switch c.operator {
+	case "=", "==", "!=", "<>", ">", ">=", "<", "<=":
+		c.value = m["Value"]
+	case "in", "not in":
+		values, ok := m["Value"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Value must be a array when Operator is %s", c.operator)
+		}
+		c.values = values
+	case "is null", "is not null":
+	default:
+		return nil, fmt.Errorf("Operator:%s not supported", c.operator)
+	}
+	return c, nil
+}
+
+func (t *Filter) Transform(data *pluginDriver.PluginDataType) (bool, error) {
+	if !isRowEvent(data) {
+		return true, nil
+	}
+	rows := make([]map[string]interface{}, 0, len(data.Rows))
+	var presentColumns [][]string
+	var jsonDiffs []map[string][]*pluginDriver.JsonDiff
+	if data.EventType == "update" {
+		for i := 0; i+1 < len(data.Rows); i += 2 {
+			if t.match(data.Rows[i+1]) {
+				rows = append(rows, data.Rows[i], data.Rows[i+1])
+				presentColumns = append(presentColumns, data.GetPresentColumns(i, 2)...)
+				jsonDiffs = append(jsonDiffs, data.GetJsonDiffs(i, 2)...)
+			}
+		}
+	} else {
+		for i, row := range data.Rows {
+			if t.match(row) {
+				rows = append(rows, row)
+				presentColumns = append(presentColumns, data.GetPresentColumns(i, 1)...)
+				jsonDiffs = append(jsonDiffs, data.GetJsonDiffs(i, 1)...)
+			}
+		}
+	}
+	if len(rows) == 0 {
+		return false, nil
+	}
+	data.Rows = rows
+	data.PresentColumns = presentColumns
+	data.JsonDiffs = jsonDiffs
+	return true, nil
+}
+
+func (t *Filter) match(row map[string]interface{}) bool {
+	for _, c := range t.conditions {
+		b := c.match(row)
+		if t.isOr && b {
+			return true
+		}
+		if !t.isOr && !b {
+			return false
+		}
+	}
+	return !t.isOr
+}
+
+func (c *filterCondition) match(row map[string]interface{}) bool {
+	val, ok := row[c.column]
+	switch c.operator {
+	case "is null":
+		return !ok || val == nil
+	case "is not null":
+		return ok && val != nil
+	case "in", "not in":
+		var in bool
+		for _, v := range c.values {
+			if compareValue(val, v) == 0 {
+				in = true
+				break
+			}
+		}
+		return in == (c.operator == "in")
+	}
+	if !ok || val == nil || c.value == nil {
+		// 和 SQL 一样，NULL 值 和任何值比较 都不成立
+		return false
+	}
+	n := compareValue(val, c.value)
+	switch c.operator {
+	case "=", "==":
+		return n == 0
+	case "!=", "<>":
+		return n != 0
+	case ">":
+		return n > 0
+	case ">=":
+		return n >= 0
+	case "<":
+		return n < 0
+	case "<=":
+		return n <= 0
+	}
+	return false
+}
+
+// 两个值都能转成数字的情况下，按数字比较，否则按字符串比较
+func compareValue(a, b interface{}) int {
+	if a == nil || b == nil {
+		if a == nil && b == nil {
+			return 0
+		}
+		return -1
+	}
+	f1, err1 := toFloat64(a)
+	f2, err2 := toFloat64(b)
+	if err1 == nil && err2 == nil {
+		if f1 < f2 {
+			return -1
+		}
+		if f1 > f2 {
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func toFloat64(v interface{}) (float64, error) {
+	switch v.(type) {
+	case int:
+		return float64(v.(int)), nil
+	case int8:
+		return float64(v.(int8)), nil
+	case int16:
+		return float64(v.(int16)), nil
+	case int32:
+		return float64(v.(int32)), nil
+	case int64:
+		return float64(v.(int64)), nil
+	case uint:
+		return float64(v.(uint)), nil
+	case uint8:
+		return float64(v.(uint8)), nil
+	case uint16:
+		return float64(v.(uint16)), nil
+	case uint32:
+		return float64(v.(uint32)), nil
+	case uint64:
+		return float64(v.(uint64)), nil
+	case float32:
+		return float64(v.(float32)), nil
+	case float64:
+		return v.(float64), nil
+	case string:
+		return strconv.ParseFloat(v.(string), 64)
+	default:
+		return 0, fmt.Errorf("%v can't transfer to float64", v)
+	}
+}
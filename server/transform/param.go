@@ -0,0 +1,103 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// 配置是通过 json 反序列化出来的，数组为 []interface{} ,数字为 float64
+
+func getParamString(param map[string]interface{}, key string, required bool) (string, error) {
+	v, ok := param[key]
+	if !ok || v == nil {
+		if required {
+			return "", fmt.Errorf("%s is required", key)
+		}
+		return "", nil
+	}
+	switch v.(type) {
+	case string:
+		return v.(string), nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+func getParamInt(param map[string]interface{}, key string, defaultVal int) (int, error) {
+	v, ok := param[key]
+	if !ok || v == nil {
+		return defaultVal, nil
+	}
+	switch v.(type) {
+	case float64:
+		return int(v.(float64)), nil
+	case int:
+		return v.(int), nil
+	case string:
+		return strconv.Atoi(v.(string))
+	default:
+		return 0, fmt.Errorf("%s:%v is not a number", key, v)
+	}
+}
+
+func getParamStringList(param map[string]interface{}, key string) ([]string, error) {
+	v, ok := param[key]
+	if !ok || v == nil {
+		return nil, fmt.Errorf("%s is required", key)
+	}
+	var list []string
+	switch v.(type) {
+	case []string:
+		list = v.([]string)
+	case []interface{}:
+		for _, val := range v.([]interface{}) {
+			list = append(list, fmt.Sprint(val))
+		}
+	default:
+		return nil, fmt.Errorf("%s must be a string array", key)
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("%s is empty", key)
+	}
+	return list, nil
+}
+
+func getParamStringMap(param map[string]interface{}, key string) (map[string]string, error) {
+	v, ok := param[key]
+	if !ok || v == nil {
+		return nil, fmt.Errorf("%s is required", key)
+	}
+	m := make(map[string]string, 0)
+	switch v.(type) {
+	case map[string]string:
+		for k, val := range v.(map[string]string) {
+			m[k] = val
+		}
+	case map[string]interface{}:
+		for k, val := range v.(map[string]interface{}) {
+			m[k] = fmt.Sprint(val)
+		}
+	default:
+		return nil, fmt.Errorf("%s must be a object", key)
+	}
+	if len(m) == 0 {
+		return nil, fmt.Errorf("%s is empty", key)
+	}
+	return m, nil
+}
@@ -0,0 +1,186 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// ToServer 在数据提交给插件之前的 数据处理链
+// 每个 ToServer 可以配置多个 transform ,按顺序执行，可以过滤数据，修改字段名，删除字段，增加常量字段，脱敏，类型转换等
+package transform
+
+import (
+	"fmt"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"sort"
+	"sync"
+)
+
+type Transform interface {
+	// data 是 Pipeline 复制出来的一份数据，可以直接修改
+	// 返回 false 表示 这条数据被过滤掉，不需要提交给插件
+	Transform(data *pluginDriver.PluginDataType) (bool, error)
+}
+
+type NewTransform func(param map[string]interface{}) (Transform, error)
+
+// 保存在 ToServer 配置中的 transform 配置
+type Config struct {
+	Type  string
+	Param map[string]interface{}
+}
+
+var (
+	transformsMu sync.RWMutex
+	transforms   = make(map[string]NewTransform)
+)
+
+func Register(name string, newTransform NewTransform) {
+	transformsMu.Lock()
+	defer transformsMu.Unlock()
+	if newTransform == nil {
+		panic("transform: Register newTransform is nil")
+	}
+	if _, dup := transforms[name]; dup {
+		panic("transform: Register called twice for transform " + name)
+	}
+	transforms[name] = newTransform
+}
+
+func Transforms() []string {
+	transformsMu.RLock()
+	defer transformsMu.RUnlock()
+	list := make([]string, 0, len(transforms))
+	for name := range transforms {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func Open(config *Config) (Transform, error) {
+	if config == nil {
+		return nil, fmt.Errorf("transform config is nil")
+	}
+	transformsMu.RLock()
+	newTransform, ok := transforms[config.Type]
+	transformsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("transform type:%s not exist", config.Type)
+	}
+	t, err := newTransform(config.Param)
+	if err != nil {
+		return nil, fmt.Errorf("transform type:%s param err:%s", config.Type, err)
+	}
+	return t, nil
+}
+
+type Pipeline struct {
+	transforms []Transform
+}
+
+func NewPipeline(configs []*Config) (*Pipeline, error) {
+	p := &Pipeline{
+		transforms: make([]Transform, 0, len(configs)),
+	}
+	for i, config := range configs {
+		t, err := Open(config)
+		if err != nil {
+			return nil, fmt.Errorf("transforms[%d] %s", i, err)
+		}
+		p.transforms = append(p.transforms, t)
+	}
+	return p, nil
+}
+
+func (p *Pipeline) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.transforms)
+}
+
+// 同一条数据会被提交到多个 ToServer ,所以先复制一份再交给 transform 修改
+// 返回 nil 表示 数据被过滤掉了
+func (p *Pipeline) Do(data *pluginDriver.PluginDataType) (*pluginDriver.PluginDataType, error) {
+	if p.Len() == 0 || data == nil {
+		return data, nil
+	}
+	newData := copyData(data)
+	for _, t := range p.transforms {
+		ok, err := t.Transform(newData)
+		if err != nil {
+			return data, err
+		}
+		if !ok {
+			return nil, nil
+		}
+	}
+	return newData, nil
+}
+
+func copyData(data *pluginDriver.PluginDataType) *pluginDriver.PluginDataType {
+	newData := *data
+	if data.Rows != nil {
+		newData.Rows = make([]map[string]interface{}, len(data.Rows))
+		for i, row := range data.Rows {
+			if row == nil {
+				continue
+			}
+			newRow := make(map[string]interface{}, len(row))
+			for k, v := range row {
+				newRow[k] = v
+			}
+			newData.Rows[i] = newRow
+		}
+	}
+	if data.Pri != nil {
+		newData.Pri = append(make([]string, 0, len(data.Pri)), data.Pri...)
+	}
+	if data.PresentColumns != nil {
+		newData.PresentColumns = make([][]string, len(data.PresentColumns))
+		for i, columns := range data.PresentColumns {
+			if columns != nil {
+				newData.PresentColumns[i] = append(make([]string, 0, len(columns)), columns...)
+			}
+		}
+	}
+	if data.JsonDiffs != nil {
+		newData.JsonDiffs = make([]map[string][]*pluginDriver.JsonDiff, len(data.JsonDiffs))
+		for i, columnDiffs := range data.JsonDiffs {
+			if columnDiffs == nil {
+				continue
+			}
+			newData.JsonDiffs[i] = make(map[string][]*pluginDriver.JsonDiff, len(columnDiffs))
+			for k, v := range columnDiffs {
+				newData.JsonDiffs[i][k] = v
+			}
+		}
+	}
+	if data.ColumnMapping != nil {
+		newData.ColumnMapping = make(map[string]string, len(data.ColumnMapping))
+		for k, v := range data.ColumnMapping {
+			newData.ColumnMapping[k] = v
+		}
+	}
+	return &newData
+}
+
+// 只有 insert,update,delete 事件才有行数据需要处理
+func isRowEvent(data *pluginDriver.PluginDataType) bool {
+	switch data.EventType {
+	case "insert", "update", "delete":
+		return true
+	default:
+		return false
+	}
+}
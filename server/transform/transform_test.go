@@ -0,0 +1,191 @@
+package transform
+
+import (
+	"encoding/json"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func getTestPipeline(configJson string) (*Pipeline, error) {
+	var configs []*Config
+	if err := json.Unmarshal([]byte(configJson), &configs); err != nil {
+		return nil, err
+	}
+	return NewPipeline(configs)
+}
+
+func getTestData(eventType string) *pluginDriver.PluginDataType {
+	data := &pluginDriver.PluginDataType{
+		EventType:  eventType,
+		SchemaName: "bifrost_test",
+		TableName:  "t1",
+		Pri:        []string{"id"},
+		ColumnMapping: map[string]string{
+			"id":     "uint32",
+			"name":   "Nullable(string)",
+			"phone":  "string",
+			"status": "string",
+			"price":  "Nullable(decimal(10,2))",
+		},
+	}
+	switch eventType {
+	case "update":
+		data.Rows = []map[string]interface{}{
+			{"id": uint32(1), "name": "a", "phone": "13800138000", "status": "ok", "price": "1.00"},
+			{"id": uint32(1), "name": "a", "phone": "13800138000", "status": "deleted", "price": "2.00"},
+			{"id": uint32(2), "name": "b", "phone": "13800138001", "status": "deleted", "price": "1.00"},
+			{"id": uint32(2), "name": "b", "phone": "13800138001", "status": "ok", "price": "3.50"},
+		}
+	default:
+		data.Rows = []map[string]interface{}{
+			{"id": uint32(1), "name": "a", "phone": "13800138000", "status": "ok", "price": "1.00"},
+			{"id": uint32(2), "name": nil, "phone": "13800138001", "status": "deleted", "price": "2.00"},
+		}
+	}
+	return data
+}
+
+func TestNewPipeline(t *testing.T) {
+	Convey("type not exist", t, func() {
+		_, err := getTestPipeline(`[{"Type":"not_exist"}]`)
+		So(err, ShouldNotBeNil)
+	})
+	Convey("param error", t, func() {
+		_, err := getTestPipeline(`[{"Type":"filter","Param":{"Conditions":[{"Column":"id","Operator":"like"}]}}]`)
+		So(err, ShouldNotBeNil)
+		_, err = getTestPipeline(`[{"Type":"hash","Param":{"Columns":["id"],"Algorithm":"crc32"}}]`)
+		So(err, ShouldNotBeNil)
+	})
+	Convey("empty", t, func() {
+		p, err := getTestPipeline(`[]`)
+		So(err, ShouldBeNil)
+		data := getTestData("insert")
+		newData, err := p.Do(data)
+		So(err, ShouldBeNil)
+		So(newData, ShouldEqual, data)
+	})
+}
+
+func TestFilter_Transform(t *testing.T) {
+	Convey("insert", t, func() {
+		p, err := getTestPipeline(`[{"Type":"filter","Param":{"Conditions":[{"Column":"status","Operator":"!=","Value":"deleted"}]}}]`)
+		So(err, ShouldBeNil)
+		data := getTestData("insert")
+		newData, err := p.Do(data)
+		So(err, ShouldBeNil)
+		So(len(newData.Rows), ShouldEqual, 1)
+		So(newData.Rows[0]["id"], ShouldEqual, uint32(1))
+		// 原始数据不能被修改
+		So(len(data.Rows), ShouldEqual, 2)
+	})
+	Convey("update by after row", t, func() {
+		p, err := getTestPipeline(`[{"Type":"filter","Param":{"Conditions":[{"Column":"price","Operator":">","Value":3}]}}]`)
+		So(err, ShouldBeNil)
+		newData, err := p.Do(getTestData("update"))
+		So(err, ShouldBeNil)
+		So(len(newData.Rows), ShouldEqual, 2)
+		So(newData.Rows[0]["id"], ShouldEqual, uint32(2))
+		So(newData.Rows[1]["price"], ShouldEqual, "3.50")
+	})
+	Convey("all rows filtered", t, func() {
+		p, err := getTestPipeline(`[{"Type":"filter","Param":{"Relation":"or","Conditions":[{"Column":"id","Operator":"in","Value":[5,6]},{"Column":"name","Operator":"is null"}]}}]`)
+		So(err, ShouldBeNil)
+		newData, err := p.Do(getTestData("insert"))
+		So(err, ShouldBeNil)
+		So(len(newData.Rows), ShouldEqual, 1)
+		So(newData.Rows[0]["id"], ShouldEqual, uint32(2))
+
+		newData, err = p.Do(getTestData("update"))
+		So(err, ShouldBeNil)
+		So(newData, ShouldBeNil)
+	})
+	Convey("not row event", t, func() {
+		p, err := getTestPipeline(`[{"Type":"filter","Param":{"Conditions":[{"Column":"id","Operator":"==","Value":100}]}}]`)
+		So(err, ShouldBeNil)
+		data := &pluginDriver.PluginDataType{EventType: "sql", Query: "ALTER TABLE t1 ADD COLUMN c1 int"}
+		newData, err := p.Do(data)
+		So(err, ShouldBeNil)
+		So(newData.Query, ShouldEqual, data.Query)
+	})
+}
+
+func TestColumn_Transform(t *testing.T) {
+	Convey("rename drop add", t, func() {
+		p, err := getTestPipeline(`[
+{"Type":"rename","Param":{"Columns":{"id":"user_id"}}},
+{"Type":"drop","Param":{"Columns":["phone","price"]}},
+{"Type":"add","Param":{"Column":"source","Value":"bifrost"}},
+{"Type":"add","Param":{"Column":"version","Value":2,"ColumnType":"int64"}}
+]`)
+		So(err, ShouldBeNil)
+		data := getTestData("insert")
+		newData, err := p.Do(data)
+		So(err, ShouldBeNil)
+		So(newData.Pri, ShouldResemble, []string{"user_id"})
+		So(newData.Rows[0], ShouldResemble, map[string]interface{}{"user_id": uint32(1), "name": "a", "status": "ok", "source": "bifrost", "version": int64(2)})
+		So(newData.ColumnMapping, ShouldResemble, map[string]string{"user_id": "uint32", "name": "Nullable(string)", "status": "string", "source": "string", "version": "int64"})
+		So(data.Pri, ShouldResemble, []string{"id"})
+		So(data.Rows[0]["id"], ShouldEqual, uint32(1))
+	})
+}
+
+func TestValue_Transform(t *testing.T) {
+	Convey("mask", t, func() {
+		p, err := getTestPipeline(`[{"Type":"mask","Param":{"Columns":["phone","name"],"KeepPrefix":3,"KeepSuffix":4}}]`)
+		So(err, ShouldBeNil)
+		newData, err := p.Do(getTestData("insert"))
+		So(err, ShouldBeNil)
+		So(newData.Rows[0]["phone"], ShouldEqual, "138****8000")
+		So(newData.Rows[0]["name"], ShouldEqual, "*")
+		So(newData.Rows[1]["name"], ShouldBeNil)
+	})
+	Convey("hash", t, func() {
+		p, err := getTestPipeline(`[{"Type":"hash","Param":{"Columns":["id"],"Algorithm":"md5"}}]`)
+		So(err, ShouldBeNil)
+		newData, err := p.Do(getTestData("insert"))
+		So(err, ShouldBeNil)
+		So(newData.Rows[0]["id"], ShouldEqual, "c4ca4238a0b923820dcc509a6f75849b")
+		So(newData.ColumnMapping["id"], ShouldEqual, "string")
+	})
+	Convey("cast", t, func() {
+		p, err := getTestPipeline(`[{"Type":"cast","Param":{"Columns":{"price":"float64","id":"string"}}}]`)
+		So(err, ShouldBeNil)
+		newData, err := p.Do(getTestData("insert"))
+		So(err, ShouldBeNil)
+		So(newData.Rows[1]["price"], ShouldEqual, float64(2))
+		So(newData.Rows[1]["id"], ShouldEqual, "2")
+		So(newData.ColumnMapping["price"], ShouldEqual, "Nullable(float64)")
+		So(newData.ColumnMapping["id"], ShouldEqual, "string")
+	})
+	Convey("cast error", t, func() {
+		p, err := getTestPipeline(`[{"Type":"cast","Param":{"Columns":{"name":"int64"}}}]`)
+		So(err, ShouldBeNil)
+		data := getTestData("insert")
+		newData, err := p.Do(data)
+		So(err, ShouldNotBeNil)
+		So(newData, ShouldEqual, data)
+	})
+}
+
+func TestExprFilter_Transform(t *testing.T) {
+	Convey("update", t, func() {
+		p, err := getTestPipeline(`[{"Type":"expr","Param":{"Expr":"EventType == \"update\" && after.price > before.price * 2"}}]`)
+		So(err, ShouldBeNil)
+		newData, err := p.Do(getTestData("update"))
+		So(err, ShouldBeNil)
+		So(len(newData.Rows), ShouldEqual, 2)
+		So(newData.Rows[1]["id"], ShouldEqual, uint32(2))
+	})
+	Convey("not row event", t, func() {
+		p, err := getTestPipeline(`[{"Type":"expr","Param":{"Expr":"EventType != \"sql\" || !startsWith(Query, \"TRUNCATE\")"}}]`)
+		So(err, ShouldBeNil)
+		newData, err := p.Do(&pluginDriver.PluginDataType{EventType: "sql", Query: "TRUNCATE TABLE t1"})
+		So(err, ShouldBeNil)
+		So(newData, ShouldBeNil)
+	})
+	Convey("compile error", t, func() {
+		_, err := getTestPipeline(`[{"Type":"expr","Param":{"Expr":"EventType =="}}]`)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,270 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register("mask", NewMask)
+	Register("hash", NewHash)
+	Register("cast", NewCast)
+}
+
+// 字段脱敏，保留前 KeepPrefix 个字符 及 后 KeepSuffix 个字符，其他字符用 MaskChar 替换
+//
+//	{"Type":"mask","Param":{"Columns":["phone"],"KeepPrefix":3,"KeepSuffix":4,"MaskChar":"*"}}
+type Mask struct {
+	columns    []string
+	keepPrefix int
+	keepSuffix int
+	maskChar   string
+}
+
+func NewMask(param map[string]interface{}) (Transform, error) {
+	t := &Mask{}
+	var err error
+	if t.columns, err = getParamStringList(param, "Columns"); err != nil {
+		return nil, err
+	}
+	if t.keepPrefix, err = getParamInt(param, "KeepPrefix", 0); err != nil {
+		return nil, err
+	}
+	if t.keepSuffix, err = getParamInt(param, "KeepSuffix", 0); err != nil {
+		return nil, err
+	}
+	if t.keepPrefix < 0 || t.keepSuffix < 0 {
+		return nil, fmt.Errorf("KeepPrefix and KeepSuffix can't be less than 0")
+	}
+	t.maskChar, _ = getParamString(param, "MaskChar", false)
+	if t.maskChar == "" {
+		t.maskChar = "*"
+	}
+	return t, nil
+}
+
+func (t *Mask) Transform(data *pluginDriver.PluginDataType) (bool, error) {
+	if !isRowEvent(data) {
+		return true, nil
+	}
+	for _, row := range data.Rows {
+		for _, name := range t.columns {
+			v, ok := row[name]
+			if !ok || v == nil {
+				continue
+			}
+			row[name] = t.mask(valueToString(v))
+		}
+	}
+	setStringColumnMapping(data, t.columns)
+	return true, nil
+}
+
+func (t *Mask) mask(s string) string {
+	r := []rune(s)
+	if t.keepPrefix+t.keepSuffix >= len(r) {
+		return strings.Repeat(t.maskChar, len(r))
+	}
+	return string(r[:t.keepPrefix]) + strings.Repeat(t.maskChar, len(r)-t.keepPrefix-t.keepSuffix) + string(r[len(r)-t.keepSuffix:])
+}
+
+// 字段值 替换成 hash 值(16进制), 支持 md5, sha1, sha256 ,默认 sha256
+//
+//	{"Type":"hash","Param":{"Columns":["email"],"Algorithm":"sha256","Salt":"xxx"}}
+type Hash struct {
+	columns []string
+	newHash func() hash.Hash
+	salt    string
+}
+
+func NewHash(param map[string]interface{}) (Transform, error) {
+	t := &Hash{}
+	var err error
+	if t.columns, err = getParamStringList(param, "Columns"); err != nil {
+		return nil, err
+	}
+	algorithm, _ := getParamString(param, "Algorithm", false)
+	switch strings.ToLower(algorithm) {
+	case "md5":
+		t.newHash = md5.New
+	case "sha1":
+		t.newHash = sha1.New
+	case "", "sha256":
+		t.newHash = sha256.New
+	default:
+		return nil, fmt.Errorf("Algorithm:%s not supported", algorithm)
+	}
+	t.salt, _ = getParamString(param, "Salt", false)
+	return t, nil
+}
+
+func (t *Hash) Transform(data *pluginDriver.PluginDataType) (bool, error) {
+	if !isRowEvent(data) {
+		return true, nil
+	}
+	for _, row := range data.Rows {
+		for _, name := range t.columns {
+			v, ok := row[name]
+			if !ok || v == nil {
+				continue
+			}
+			h := t.newHash()
+			h.Write([]byte(t.salt))
+			h.Write([]byte(valueToString(v)))
+			row[name] = hex.EncodeToString(h.Sum(nil))
+		}
+	}
+	setStringColumnMapping(data, t.columns)
+	return true, nil
+}
+
+// 字段类型转换，支持 string, int64, uint64, float64, bool
+//
+//	{"Type":"cast","Param":{"Columns":{"id":"string","price":"float64"}}}
+type Cast struct {
+	columns map[string]string
+}
+
+func NewCast(param map[string]interface{}) (Transform, error) {
+	columns, err := getParamStringMap(param, "Columns")
+	if err != nil {
+		return nil, err
+	}
+	for name, columnType := range columns {
+		switch columnType {
+		case "string", "int64", "uint64", "float64", "bool":
+		default:
+			return nil, fmt.Errorf("column:%s type:%s not supported", name, columnType)
+		}
+	}
+	return &Cast{columns: columns}, nil
+}
+
+func (t *Cast) Transform(data *pluginDriver.PluginDataType) (bool, error) {
+	if !isRowEvent(data) {
+		return true, nil
+	}
+	for _, row := range data.Rows {
+		for name, columnType := range t.columns {
+			v, ok := row[name]
+			if !ok || v == nil {
+				continue
+			}
+			newVal, err := castValue(v, columnType)
+			if err != nil {
+				return false, fmt.Errorf("column:%s value:%v cast to %s err:%s", name, v, columnType, err)
+			}
+			row[name] = newVal
+		}
+	}
+	for name, columnType := range t.columns {
+		if oldType, ok := data.ColumnMapping[name]; ok {
+			if strings.Index(oldType, "Nullable(") == 0 {
+				data.ColumnMapping[name] = "Nullable(" + columnType + ")"
+			} else {
+				data.ColumnMapping[name] = columnType
+			}
+		}
+	}
+	return true, nil
+}
+
+func castValue(v interface{}, columnType string) (interface{}, error) {
+	switch columnType {
+	case "string":
+		return valueToString(v), nil
+	case "int64":
+		switch v.(type) {
+		case float32, float64:
+			f, _ := toFloat64(v)
+			return int64(f), nil
+		case bool:
+			if v.(bool) {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+		return strconv.ParseInt(strings.TrimSpace(valueToString(v)), 10, 64)
+	case "uint64":
+		switch v.(type) {
+		case float32, float64:
+			f, _ := toFloat64(v)
+			return uint64(f), nil
+		case bool:
+			if v.(bool) {
+				return uint64(1), nil
+			}
+			return uint64(0), nil
+		}
+		return strconv.ParseUint(strings.TrimSpace(valueToString(v)), 10, 64)
+	case "float64":
+		if b, ok := v.(bool); ok {
+			if b {
+				return float64(1), nil
+			}
+			return float64(0), nil
+		}
+		return strconv.ParseFloat(strings.TrimSpace(valueToString(v)), 64)
+	case "bool":
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+		if f, err := toFloat64(v); err == nil {
+			return f != 0, nil
+		}
+		return strconv.ParseBool(strings.TrimSpace(valueToString(v)))
+	default:
+		return nil, fmt.Errorf("type:%s not supported", columnType)
+	}
+}
+
+func valueToString(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return v.(string)
+	case []byte:
+		return string(v.([]byte))
+	case float32:
+		return strconv.FormatFloat(float64(v.(float32)), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v.(float64), 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// 脱敏 及 hash 之后 字段值都是 字符串了
+func setStringColumnMapping(data *pluginDriver.PluginDataType, columns []string) {
+	for _, name := range columns {
+		if oldType, ok := data.ColumnMapping[name]; ok {
+			if strings.Index(oldType, "Nullable(") == 0 {
+				data.ColumnMapping[name] = "Nullable(string)"
+			} else {
+				data.ColumnMapping[name] = "string"
+			}
+		}
+	}
+}
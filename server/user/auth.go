@@ -0,0 +1,267 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brokercap/Bifrost/config"
+	"github.com/brokercap/Bifrost/server/storage"
+)
+
+/*
+外部认证, 配置示例
+
+[auth]
+#外部认证方式, 多个用英文逗号隔开, 用户名密码登入的时候 按顺序认证
+providers=ldap,oidc
+#是否允许本地用户 (包括 [user] 配置的用户) 用户名密码登入, 外部认证都失败的时候 作为后备, 默认 true
+local_login=true
+#外部用户的组 没有在 [auth_group_mapping] 中配置的时候 是否允许登入 (monitor 无写权限), 默认 false
+allow_unmapped=false
+
+[auth_ldap]
+...
+
+[auth_oidc]
+...
+
+[auth_group_mapping]
+#外部组 = administrator 或者 角色, 多个用英文逗号隔开
+#LDAP memberOf 这种 DN 格式的组, 这里配置第一个 RDN 的值, 比如 cn=bifrost-admin,ou=groups,dc=example,dc=com 配置为 bifrost-admin
+bifrost-admin=administrator
+bifrost-ops=role_ops
+*/
+
+const (
+	AUTH_SOURCE_LOCAL = ""
+)
+
+// 外部认证成功之后的用户信息
+type AuthUser struct {
+	Name   string
+	Groups []string
+}
+
+type AuthProvider interface {
+	Name() string
+}
+
+// 用户名密码认证, 比如 LDAP
+type PasswordAuthProvider interface {
+	AuthProvider
+	Authenticate(UserName, Password string) (*AuthUser, error)
+}
+
+// 跳转到第三方 登入之后 回调认证, 比如 OIDC
+type RedirectAuthProvider interface {
+	AuthProvider
+	AuthCodeURL(state string) (string, error)
+	Exchange(code string) (*AuthUser, error)
+}
+
+type NewAuthProviderFunc func(conf map[string]string) (AuthProvider, error)
+
+var authProviderDriverMap = make(map[string]NewAuthProviderFunc, 0)
+
+var authProviderLock sync.RWMutex
+var authProviderList []AuthProvider
+
+func RegisterAuthProvider(name string, fn NewAuthProviderFunc) {
+	authProviderDriverMap[name] = fn
+}
+
+// 根据 [auth] 配置 初始化外部认证
+func InitAuthProvider() {
+	list := make([]AuthProvider, 0)
+	for _, name := range strings.Split(config.GetConfigVal("auth", "providers"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		fn, ok := authProviderDriverMap[name]
+		if !ok {
+			log.Println("auth provider:", name, "not supported")
+			continue
+		}
+		provider, err := fn(config.GetConf("auth_" + name))
+		if err != nil {
+			log.Println("auth provider:", name, "init err:", err)
+			continue
+		}
+		list = append(list, provider)
+	}
+	authProviderLock.Lock()
+	authProviderList = list
+	authProviderLock.Unlock()
+}
+
+func getAuthProviderList() []AuthProvider {
+	authProviderLock.RLock()
+	defer authProviderLock.RUnlock()
+	return authProviderList
+}
+
+// 是否允许 本地用户 用户名密码登入
+func IsLocalLoginEnable() bool {
+	return config.GetConfigVal("auth", "local_login") != "false"
+}
+
+func GetRedirectAuthProvider(name string) RedirectAuthProvider {
+	for _, provider := range getAuthProviderList() {
+		if p, ok := provider.(RedirectAuthProvider); ok && p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// 登入页面 显示的 第三方登入
+func GetRedirectAuthProviderNameList() []string {
+	nameList := make([]string, 0)
+	for _, provider := range getAuthProviderList() {
+		if _, ok := provider.(RedirectAuthProvider); ok {
+			nameList = append(nameList, provider.Name())
+		}
+	}
+	return nameList
+}
+
+// 外部组 转换成 Bifrost 的组 及 角色
+func mappingAuthGroups(Groups []string) (Group string, Roles []string, ok bool) {
+	Group = "monitor"
+	Roles = make([]string, 0)
+	mapping := config.GetConf("auth_group_mapping")
+	for _, v := range Groups {
+		val, exist := mapping[getAuthGroupName(v)]
+		if !exist {
+			continue
+		}
+		ok = true
+		for _, name := range strings.Split(val, ",") {
+			name = strings.TrimSpace(name)
+			switch name {
+			case "":
+				continue
+			case "administrator":
+				Group = "administrator"
+			default:
+				Roles = append(Roles, name)
+			}
+		}
+	}
+	return
+}
+
+// cn=bifrost-admin,ou=groups,dc=example,dc=com 返回 bifrost-admin
+func getAuthGroupName(group string) string {
+	rdn := strings.SplitN(group, ",", 2)[0]
+	if i := strings.Index(rdn, "="); i > 0 && strings.Contains(group, ",") {
+		return strings.TrimSpace(rdn[i+1:])
+	}
+	return strings.TrimSpace(group)
+}
+
+// 外部认证成功之后, 更新存储中的用户信息, 组及角色 每次登入的时候 根据 [auth_group_mapping] 重新计算
+func saveAuthUser(source string, authUser *AuthUser) (*UserInfo, error) {
+	if authUser == nil || authUser.Name == "" {
+		return nil, errors.New("user name is empty")
+	}
+	Group, Roles, ok := mappingAuthGroups(authUser.Groups)
+	if !ok && config.GetConfigVal("auth", "allow_unmapped") != "true" {
+		return nil, fmt.Errorf("user:%s groups not mapping", authUser.Name)
+	}
+	validRoles := make([]string, 0, len(Roles))
+	for _, RoleName := range Roles {
+		if GetRoleInfo(RoleName) == nil {
+			log.Println("auth group mapping role:", RoleName, "not exist")
+			continue
+		}
+		validRoles = append(validRoles, RoleName)
+	}
+	OldUserInfo := GetUserInfo(authUser.Name)
+	// 不能覆盖 同名的本地用户
+	if OldUserInfo.Name != "" && OldUserInfo.Source != source {
+		return nil, fmt.Errorf("user:%s is exist in %s", authUser.Name, getAuthSourceName(OldUserInfo.Source))
+	}
+	User := &UserInfo{
+		Name:       authUser.Name,
+		Group:      Group,
+		Host:       "%",
+		Roles:      validRoles,
+		Source:     source,
+		AddTime:    time.Now().Unix(),
+		UpdateTime: time.Now().Unix(),
+	}
+	if OldUserInfo.Name != "" {
+		User.Host = OldUserInfo.Host
+		User.AddTime = OldUserInfo.AddTime
+	}
+	b, _ := json.Marshal(User)
+	if err := storage.PutKeyVal([]byte(USER_PREFIX+User.Name), b); err != nil {
+		return nil, err
+	}
+	return User, nil
+}
+
+func getAuthSourceName(source string) string {
+	if source == AUTH_SOURCE_LOCAL {
+		return "local"
+	}
+	return source
+}
+
+// 用户名密码 按顺序 外部认证, 都失败的情况下 本地用户 作为后备
+func authenticate(Name, Password string) (userInfo *UserInfo, err error) {
+	for _, provider := range getAuthProviderList() {
+		p, ok := provider.(PasswordAuthProvider)
+		if !ok {
+			continue
+		}
+		authUser, err0 := p.Authenticate(Name, Password)
+		if err0 != nil {
+			log.Println("auth provider:", p.Name(), "UserName:", Name, "err:", err0)
+			err = err0
+			continue
+		}
+		return saveAuthUser(p.Name(), authUser)
+	}
+	if !IsLocalLoginEnable() {
+		if err == nil {
+			err = errors.New("local login is disabled")
+		}
+		return nil, err
+	}
+	return CheckUser(Name, Password)
+}
+
+// 第三方 回调之后 用 code 换取用户信息
+func CheckAuthCodeWithIP(providerName, code string, IP string, RemoteAddrIp string) (userInfo *UserInfo, err error) {
+	if RemoteAddrIp != "127.0.0.1" && CheckRefuseIp(IP) {
+		return nil, errors.New("ip is refused")
+	}
+	provider := GetRedirectAuthProvider(providerName)
+	if provider == nil {
+		return nil, fmt.Errorf("auth provider:%s not exist", providerName)
+	}
+	authUser, err := provider.Exchange(code)
+	if err == nil {
+		userInfo, err = saveAuthUser(providerName, authUser)
+	}
+	if err != nil {
+		AddFailedIp(IP)
+		appendLoginLog("IP:%s %s login failed:%s", IP, providerName, err.Error())
+		return nil, err
+	}
+	if err = CheckUserHost(IP, userInfo.Host); err != nil {
+		AddFailedIp(IP)
+		appendLoginLog("IP:%s UserName:%s CheckUserHost failed", IP, userInfo.Name)
+		return nil, err
+	}
+	appendLoginLog("IP:%s UserName:%s %s login success", IP, userInfo.Name, providerName)
+	return userInfo, nil
+}
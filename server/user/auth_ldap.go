@@ -0,0 +1,194 @@
+package user
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+/*
+LDAP 认证, 先用 bind_dn 查找用户的 DN 及 组, 再用 用户的 DN 及 密码 bind 验证密码
+登入的用户名 使用 目录中 user_attr 属性的值, 不使用 用户输入的用户名
+
+[auth_ldap]
+addr=ldap.example.com:389
+#是否使用 ldaps
+tls=false
+#是否在 389 端口上 使用 StartTLS, 不能和 tls 同时开启
+start_tls=false
+#校验 LDAP 服务端证书的 CA 文件, 为空则使用系统 CA
+ca_file=
+insecure_skip_verify=false
+#查找用户的账号, 为空则 匿名查找
+bind_dn=cn=readonly,dc=example,dc=com
+bind_password=xxx
+base_dn=ou=people,dc=example,dc=com
+#%s 替换为登入的用户名
+user_filter=(uid=%s)
+#用户名的属性, AD 一般为 sAMAccountName
+user_attr=uid
+#用户所属组的属性
+group_attr=memberOf
+timeout=5
+*/
+
+func init() {
+	RegisterAuthProvider("ldap", NewLdapAuthProvider)
+}
+
+type LdapAuthProvider struct {
+	Addr               string
+	TLS                bool
+	StartTLS           bool
+	CAFile             string
+	InsecureSkipVerify bool
+	BindDN             string
+	BindPassword       string
+	BaseDN             string
+	UserFilter         string
+	UserAttr           string
+	GroupAttr          string
+	Timeout            time.Duration
+
+	tlsConfig *tls.Config
+}
+
+func NewLdapAuthProvider(conf map[string]string) (AuthProvider, error) {
+	p := &LdapAuthProvider{
+		Addr:               conf["addr"],
+		TLS:                conf["tls"] == "true",
+		StartTLS:           conf["start_tls"] == "true",
+		CAFile:             conf["ca_file"],
+		InsecureSkipVerify: conf["insecure_skip_verify"] == "true",
+		BindDN:             conf["bind_dn"],
+		BindPassword:       conf["bind_password"],
+		BaseDN:             conf["base_dn"],
+		UserFilter:         conf["user_filter"],
+		UserAttr:           conf["user_attr"],
+		GroupAttr:          conf["group_attr"],
+		Timeout:            5 * time.Second,
+	}
+	if p.Addr == "" || p.BaseDN == "" {
+		return nil, errors.New("addr and base_dn not be empty")
+	}
+	if p.TLS && p.StartTLS {
+		return nil, errors.New("tls and start_tls can not be both true")
+	}
+	if p.UserFilter == "" {
+		p.UserFilter = "(uid=%s)"
+	}
+	if p.UserAttr == "" {
+		p.UserAttr = "uid"
+	}
+	if p.GroupAttr == "" {
+		p.GroupAttr = "memberOf"
+	}
+	if timeout, _ := strconv.Atoi(conf["timeout"]); timeout > 0 {
+		p.Timeout = time.Duration(timeout) * time.Second
+	}
+	if _, err := ldap.CompileFilter(fmt.Sprintf(p.UserFilter, "test")); err != nil {
+		return nil, fmt.Errorf("user_filter:%s err:%s", p.UserFilter, err.Error())
+	}
+	if p.TLS || p.StartTLS {
+		tlsConfig, err := p.newTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		p.tlsConfig = tlsConfig
+	}
+	return p, nil
+}
+
+func (p *LdapAuthProvider) newTLSConfig() (*tls.Config, error) {
+	host, _, err := net.SplitHostPort(p.Addr)
+	if err != nil {
+		host = p.Addr
+	}
+	tlsConfig := &tls.Config{ServerName: host, InsecureSkipVerify: p.InsecureSkipVerify}
+	if p.CAFile == "" {
+		return tlsConfig, nil
+	}
+	b, err := os.ReadFile(p.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("ca_file:%s err:%s", p.CAFile, err.Error())
+	}
+	tlsConfig.RootCAs = x509.NewCertPool()
+	if !tlsConfig.RootCAs.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("ca_file:%s no certificate", p.CAFile)
+	}
+	return tlsConfig, nil
+}
+
+func (p *LdapAuthProvider) Name() string {
+	return "ldap"
+}
+
+func (p *LdapAuthProvider) Authenticate(UserName, Password string) (*AuthUser, error) {
+	// 密码为空的 simple bind 是匿名 bind, 会成功
+	if UserName == "" || Password == "" {
+		return nil, errors.New("user name and password not be empty")
+	}
+	conn, err := p.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if p.BindDN == "" {
+		err = conn.UnauthenticatedBind("")
+	} else {
+		err = conn.Bind(p.BindDN, p.BindPassword)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bind_dn bind err:%s", err.Error())
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		p.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(p.Timeout/time.Second), false,
+		fmt.Sprintf(p.UserFilter, ldap.EscapeFilter(UserName)),
+		[]string{p.UserAttr, p.GroupAttr},
+		nil,
+	))
+	if err != nil && (result == nil || len(result.Entries) == 0) {
+		return nil, err
+	}
+	if len(result.Entries) != 1 {
+		return nil, fmt.Errorf("user:%s not exist or too many entries", UserName)
+	}
+	entry := result.Entries[0]
+	if err = conn.Bind(entry.DN, Password); err != nil {
+		return nil, err
+	}
+	// 目录中 用户名 一般不区分大小写, 这里用目录中的值, 防止 同一个用户 不同大小写 登入成为不同的用户
+	Name := entry.GetEqualFoldAttributeValue(p.UserAttr)
+	if Name == "" {
+		return nil, fmt.Errorf("user:%s %s attribute is empty", UserName, p.UserAttr)
+	}
+	return &AuthUser{Name: Name, Groups: entry.GetEqualFoldAttributeValues(p.GroupAttr)}, nil
+}
+
+func (p *LdapAuthProvider) dial() (*ldap.Conn, error) {
+	opts := []ldap.DialOpt{ldap.DialWithDialer(&net.Dialer{Timeout: p.Timeout})}
+	scheme := "ldap://"
+	if p.TLS {
+		scheme = "ldaps://"
+		opts = append(opts, ldap.DialWithTLSConfig(p.tlsConfig))
+	}
+	conn, err := ldap.DialURL(scheme+p.Addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(p.Timeout)
+	if p.StartTLS {
+		if err = conn.StartTLS(p.tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("start_tls err:%s", err.Error())
+		}
+	}
+	return conn, nil
+}
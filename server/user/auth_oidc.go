@@ -0,0 +1,199 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+OpenID Connect 认证, authorization code 模式
+code 换取 access_token 之后, 通过 userinfo 接口 获取用户名及组, 不需要验证 id_token 的签名
+
+[auth_oidc]
+issuer=https://accounts.example.com
+client_id=bifrost
+client_secret=xxx
+#需要在 OIDC 服务中 配置为允许的回调地址
+redirect_url=https://bifrost.example.com:21036/login/sso/callback
+scopes=openid,profile,groups
+#用户名 及 组 对应的 claim
+user_claim=preferred_username
+group_claim=groups
+*/
+
+func init() {
+	RegisterAuthProvider("oidc", NewOidcAuthProvider)
+}
+
+type OidcAuthProvider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	UserClaim    string
+	GroupClaim   string
+
+	sync.Mutex
+	client    *http.Client
+	discovery *oidcDiscovery
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+func NewOidcAuthProvider(conf map[string]string) (AuthProvider, error) {
+	p := &OidcAuthProvider{
+		Issuer:       strings.TrimRight(conf["issuer"], "/"),
+		ClientID:     conf["client_id"],
+		ClientSecret: conf["client_secret"],
+		RedirectURL:  conf["redirect_url"],
+		UserClaim:    conf["user_claim"],
+		GroupClaim:   conf["group_claim"],
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+	if p.Issuer == "" || p.ClientID == "" || p.RedirectURL == "" {
+		return nil, errors.New("issuer, client_id and redirect_url not be empty")
+	}
+	for _, v := range strings.Split(conf["scopes"], ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			p.Scopes = append(p.Scopes, v)
+		}
+	}
+	if len(p.Scopes) == 0 {
+		p.Scopes = []string{"openid", "profile", "groups"}
+	}
+	if p.UserClaim == "" {
+		p.UserClaim = "preferred_username"
+	}
+	if p.GroupClaim == "" {
+		p.GroupClaim = "groups"
+	}
+	return p, nil
+}
+
+func (p *OidcAuthProvider) Name() string {
+	return "oidc"
+}
+
+// 第一次使用的时候 获取 .well-known/openid-configuration, 失败的时候 下次重新获取
+func (p *OidcAuthProvider) getDiscovery() (*oidcDiscovery, error) {
+	p.Lock()
+	defer p.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	resp, err := p.client.Get(p.Issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("openid-configuration http status:%d", resp.StatusCode)
+	}
+	var discovery oidcDiscovery
+	if err = json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return nil, err
+	}
+	if strings.TrimRight(discovery.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("issuer:%s not match", discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.UserinfoEndpoint == "" {
+		return nil, errors.New("openid-configuration endpoint is empty")
+	}
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+func (p *OidcAuthProvider) AuthCodeURL(state string) (string, error) {
+	discovery, err := p.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.ClientID)
+	v.Set("redirect_uri", p.RedirectURL)
+	v.Set("scope", strings.Join(p.Scopes, " "))
+	v.Set("state", state)
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		return discovery.AuthorizationEndpoint + "&" + v.Encode(), nil
+	}
+	return discovery.AuthorizationEndpoint + "?" + v.Encode(), nil
+}
+
+func (p *OidcAuthProvider) Exchange(code string) (*AuthUser, error) {
+	if code == "" {
+		return nil, errors.New("code is empty")
+	}
+	discovery, err := p.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", p.RedirectURL)
+	req, _ := http.NewRequest("POST", discovery.TokenEndpoint, strings.NewReader(v.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	var token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+	}
+	if err = p.doJson(req, &token); err != nil {
+		return nil, fmt.Errorf("token endpoint err:%s", err.Error())
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("access_token is empty")
+	}
+	req, _ = http.NewRequest("GET", discovery.UserinfoEndpoint, nil)
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	var claims map[string]interface{}
+	if err = p.doJson(req, &claims); err != nil {
+		return nil, fmt.Errorf("userinfo endpoint err:%s", err.Error())
+	}
+	authUser := &AuthUser{}
+	authUser.Name, _ = claims[p.UserClaim].(string)
+	if authUser.Name == "" {
+		return nil, fmt.Errorf("claim:%s is empty", p.UserClaim)
+	}
+	switch groups := claims[p.GroupClaim].(type) {
+	case string:
+		authUser.Groups = append(authUser.Groups, groups)
+	case []interface{}:
+		for _, v := range groups {
+			if group, ok := v.(string); ok {
+				authUser.Groups = append(authUser.Groups, group)
+			}
+		}
+	}
+	return authUser, nil
+}
+
+func (p *OidcAuthProvider) doJson(req *http.Request, data interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http status:%d %s", resp.StatusCode, string(body))
+	}
+	return json.Unmarshal(body, data)
+}
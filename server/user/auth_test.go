@@ -0,0 +1,238 @@
+package user
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/brokercap/Bifrost/config"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const testLdapUserDN = "uid=alice,ou=people,dc=example,dc=com"
+
+func testLdapMessage(messageID int64, op *ber.Packet) []byte {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, ""))
+	packet.AppendChild(op)
+	return packet.Bytes()
+}
+
+func testLdapResult(messageID int64, tag ber.Tag, code int64) []byte {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return testLdapMessage(messageID, op)
+}
+
+func testLdapAttribute(name string, vals ...string) *ber.Packet {
+	attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+	set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+	for _, val := range vals {
+		set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, val, ""))
+	}
+	attr.AppendChild(set)
+	return attr
+}
+
+// 只支持 bind 及 (uid=alice) 查找的 LDAP 服务, 和大部分 LDAP 服务一样 uid 不区分大小写
+func startTestLdapServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					packet, err := ber.ReadPacket(reader)
+					if err != nil || len(packet.Children) < 2 {
+						return
+					}
+					messageID, _ := packet.Children[0].Value.(int64)
+					op := packet.Children[1]
+					switch op.Tag {
+					case ldap.ApplicationBindRequest:
+						DN, Password := op.Children[1].Data.String(), op.Children[2].Data.String()
+						var code int64 = ldap.LDAPResultInvalidCredentials
+						if (DN == "cn=readonly,dc=example,dc=com" && Password == "readonly") || (DN == testLdapUserDN && Password == "alice123") {
+							code = ldap.LDAPResultSuccess
+						}
+						conn.Write(testLdapResult(messageID, ldap.ApplicationBindResponse, code))
+					case ldap.ApplicationSearchRequest:
+						filter, _ := ldap.DecompileFilter(op.Children[6])
+						if strings.EqualFold(filter, "(uid=alice)") {
+							entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+							entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, testLdapUserDN, ""))
+							attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+							attrs.AppendChild(testLdapAttribute("uid", "alice"))
+							attrs.AppendChild(testLdapAttribute("memberOf", "cn=bifrost-admin,ou=groups,dc=example,dc=com", "cn=other,ou=groups,dc=example,dc=com"))
+							entry.AppendChild(attrs)
+							conn.Write(testLdapMessage(messageID, entry))
+						}
+						conn.Write(testLdapResult(messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+					default:
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestLdapAuthProvider_Authenticate(t *testing.T) {
+	provider, err := NewLdapAuthProvider(map[string]string{
+		"addr":          startTestLdapServer(t),
+		"bind_dn":       "cn=readonly,dc=example,dc=com",
+		"bind_password": "readonly",
+		"base_dn":       "ou=people,dc=example,dc=com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := provider.(PasswordAuthProvider)
+	authUser, err := p.Authenticate("alice", "alice123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authUser.Name != "alice" || len(authUser.Groups) != 2 || getAuthGroupName(authUser.Groups[0]) != "bifrost-admin" {
+		t.Fatal("authUser error:", *authUser)
+	}
+	// 用户名 使用目录中的 uid, 不使用输入的用户名
+	authUser, err = p.Authenticate("ALICE", "alice123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authUser.Name != "alice" {
+		t.Fatal("user name must be the uid in directory:", authUser.Name)
+	}
+	if _, err = p.Authenticate("alice", "error"); err == nil {
+		t.Fatal("password error must be failed")
+	}
+	if _, err = p.Authenticate("alice", ""); err == nil {
+		t.Fatal("empty password must be failed")
+	}
+	// 用户名中的特殊字符 需要转义, 不能匹配到 alice
+	if _, err = p.Authenticate("alice)(uid=*", "alice123"); err == nil {
+		t.Fatal("filter injection must be failed")
+	}
+}
+
+func TestNewLdapAuthProvider(t *testing.T) {
+	conf := map[string]string{"addr": "127.0.0.1:389", "base_dn": "ou=people,dc=example,dc=com", "start_tls": "true"}
+	provider, err := NewLdapAuthProvider(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := provider.(*LdapAuthProvider); p.tlsConfig == nil || p.tlsConfig.ServerName != "127.0.0.1" {
+		t.Fatal("start_tls config error")
+	}
+	conf["tls"] = "true"
+	if _, err = NewLdapAuthProvider(conf); err == nil {
+		t.Fatal("tls and start_tls both true must be error")
+	}
+	conf["tls"] = "false"
+	conf["user_filter"] = "(uid=%s"
+	if _, err = NewLdapAuthProvider(conf); err == nil {
+		t.Fatal("user_filter error must be error")
+	}
+}
+
+func startTestOidcServer(t *testing.T) *httptest.Server {
+	var issuer string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer,
+			"authorization_endpoint": issuer + "/authorize",
+			"token_endpoint":         issuer + "/token",
+			"userinfo_endpoint":      issuer + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, _ := r.BasicAuth()
+		if clientID != "bifrost" || clientSecret != "secret" || r.PostFormValue("code") != "code123" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "token123", "token_type": "Bearer"})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token123" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"preferred_username": "bob", "groups": []string{"bifrost-ops"}})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	issuer = server.URL
+	return server
+}
+
+func TestOidcAuthProvider_Exchange(t *testing.T) {
+	server := startTestOidcServer(t)
+	provider, err := NewOidcAuthProvider(map[string]string{
+		"issuer":        server.URL,
+		"client_id":     "bifrost",
+		"client_secret": "secret",
+		"redirect_url":  "https://127.0.0.1:21036/login/sso/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := provider.(RedirectAuthProvider)
+	authUrl, err := p.AuthCodeURL("state123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authUrl)
+	if !strings.HasPrefix(authUrl, server.URL+"/authorize?") || u.Query().Get("state") != "state123" || u.Query().Get("client_id") != "bifrost" {
+		t.Fatal("AuthCodeURL error:", authUrl)
+	}
+	authUser, err := p.Exchange("code123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authUser.Name != "bob" || len(authUser.Groups) != 1 || authUser.Groups[0] != "bifrost-ops" {
+		t.Fatal("authUser error:", *authUser)
+	}
+	if _, err = p.Exchange("error"); err == nil {
+		t.Fatal("code error must be failed")
+	}
+}
+
+func TestMappingAuthGroups(t *testing.T) {
+	config.SetConfigVal("auth_group_mapping", "bifrost-admin", "administrator")
+	config.SetConfigVal("auth_group_mapping", "bifrost-ops", "role_ops, role_history")
+	defer config.DelConfig("auth_group_mapping", "bifrost-admin")
+	defer config.DelConfig("auth_group_mapping", "bifrost-ops")
+
+	Group, Roles, ok := mappingAuthGroups([]string{"cn=bifrost-ops,ou=groups,dc=example,dc=com"})
+	if !ok || Group != "monitor" || len(Roles) != 2 || Roles[1] != "role_history" {
+		t.Fatal("mappingAuthGroups error:", Group, Roles, ok)
+	}
+	Group, _, ok = mappingAuthGroups([]string{"bifrost-admin", "other"})
+	if !ok || Group != "administrator" {
+		t.Fatal("mappingAuthGroups error:", Group, ok)
+	}
+	if _, _, ok = mappingAuthGroups([]string{"other"}); ok {
+		t.Fatal("unmapped group must be false")
+	}
+}
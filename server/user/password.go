@@ -0,0 +1,51 @@
+package user
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// 保存的密码格式为 pbkdf2_sha256$迭代次数$salt$hash
+// 老版本 明文保存的密码, 启动的时候 及 登入成功的时候 自动转换
+const passwordHashPrefix = "pbkdf2_sha256$"
+
+const passwordHashIter = 10000
+
+func HashPassword(password string) string {
+	salt := make([]byte, 16)
+	_, _ = rand.Read(salt)
+	return hashPassword(password, salt, passwordHashIter)
+}
+
+func hashPassword(password string, salt []byte, iter int) string {
+	key, _ := pbkdf2.Key(sha256.New, password, salt, iter, 32)
+	return passwordHashPrefix + strconv.Itoa(iter) + "$" + hex.EncodeToString(salt) + "$" + hex.EncodeToString(key)
+}
+
+func IsHashedPassword(password string) bool {
+	return strings.HasPrefix(password, passwordHashPrefix)
+}
+
+func checkPassword(hashedPassword, password string) bool {
+	if !IsHashedPassword(hashedPassword) {
+		return subtle.ConstantTimeCompare([]byte(hashedPassword), []byte(password)) == 1
+	}
+	arr := strings.Split(hashedPassword[len(passwordHashPrefix):], "$")
+	if len(arr) != 3 {
+		return false
+	}
+	iter, err := strconv.Atoi(arr[0])
+	if err != nil || iter <= 0 {
+		return false
+	}
+	salt, err := hex.DecodeString(arr[1])
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashPassword(password, salt, iter)), []byte(hashedPassword)) == 1
+}
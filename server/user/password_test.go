@@ -0,0 +1,42 @@
+package user
+
+import (
+	"testing"
+)
+
+func TestCheckPassword(t *testing.T) {
+	hashed := HashPassword("Bifrost123")
+	if !IsHashedPassword(hashed) {
+		t.Fatal("HashPassword result error:", hashed)
+	}
+	if hashed == HashPassword("Bifrost123") {
+		t.Fatal("salt must be random")
+	}
+	if !checkPassword(hashed, "Bifrost123") {
+		t.Fatal("checkPassword must be true")
+	}
+	if checkPassword(hashed, "Bifrost1234") {
+		t.Fatal("checkPassword must be false")
+	}
+	// 老版本 明文保存的密码
+	if !checkPassword("Bifrost123", "Bifrost123") || checkPassword("Bifrost123", "Bifrost") {
+		t.Fatal("plaintext checkPassword error")
+	}
+}
+
+func TestRoleInfo_checkPermission(t *testing.T) {
+	Role := &RoleInfo{Name: "test", DbNames: []string{"mysqlTest"}, Actions: []RoleAction{ROLE_ACTION_START_STOP}}
+	if !Role.checkPermission("mysqlTest", ROLE_ACTION_START_STOP) {
+		t.Fatal("checkPermission must be true")
+	}
+	if Role.checkPermission("mysqlTest", ROLE_ACTION_HISTORY) || Role.checkPermission("mysqlTest2", ROLE_ACTION_START_STOP) {
+		t.Fatal("checkPermission must be false")
+	}
+	Role.DbNames = []string{"*"}
+	if !Role.checkPermission("mysqlTest2", ROLE_ACTION_START_STOP) {
+		t.Fatal("* checkPermission must be true")
+	}
+	if !CheckUserPermission(&UserInfo{Group: "administrator"}, "", ROLE_ACTION_HISTORY) {
+		t.Fatal("administrator must have all permission")
+	}
+}
@@ -0,0 +1,158 @@
+package user
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/brokercap/Bifrost/server/storage"
+)
+
+/*
+角色, 非 administrator 用户 通过角色 获得 指定数据源 的写操作权限
+一个用户 可以配置多个角色, 没有配置角色的 非 administrator 用户 只有查看权限
+*/
+
+const ROLE_PREFIX string = "bifrost_RoleList_"
+
+type RoleAction string
+
+const (
+	ROLE_ACTION_START_STOP RoleAction = "start_stop" // 数据源, channel, 同步配置 的启动,停止,关闭
+	ROLE_ACTION_TOSERVER   RoleAction = "toserver"   // 表, channel, 同步配置 的添加,修改,删除, 死信 及 文件队列 的操作
+	ROLE_ACTION_HISTORY    RoleAction = "history"    // 全量任务
+)
+
+var roleActionList = []RoleAction{ROLE_ACTION_START_STOP, ROLE_ACTION_TOSERVER, ROLE_ACTION_HISTORY}
+
+type RoleInfo struct {
+	Name       string
+	DbNames    []string // 可以操作的数据源, * 为所有数据源
+	Actions    []RoleAction
+	AddTime    int64
+	UpdateTime int64
+}
+
+func GetRoleActionList() []RoleAction {
+	return roleActionList
+}
+
+func checkRoleAction(action RoleAction) bool {
+	for _, v := range roleActionList {
+		if v == action {
+			return true
+		}
+	}
+	return false
+}
+
+func RecoveryRole(content *json.RawMessage) {
+	if content == nil {
+		return
+	}
+	var data []*RoleInfo
+	errors := json.Unmarshal(*content, &data)
+	if errors != nil {
+		log.Println("recovery role content errors;", errors, " content:", content)
+		return
+	}
+	for _, Role := range data {
+		b, _ := json.Marshal(Role)
+		storage.PutKeyVal([]byte(ROLE_PREFIX+Role.Name), b)
+	}
+}
+
+func GetRoleList() []RoleInfo {
+	roleListString := storage.GetListByPrefix([]byte(ROLE_PREFIX))
+	RoleList := make([]RoleInfo, 0)
+	for _, v := range roleListString {
+		var Role RoleInfo
+		err := json.Unmarshal([]byte(v.Value), &Role)
+		if err == nil && Role.Name != "" {
+			RoleList = append(RoleList, Role)
+		}
+	}
+	return RoleList
+}
+
+func GetRoleInfo(Name string) *RoleInfo {
+	b, err := storage.GetKeyVal([]byte(ROLE_PREFIX + Name))
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	var Role RoleInfo
+	if err = json.Unmarshal(b, &Role); err != nil {
+		return nil
+	}
+	return &Role
+}
+
+func UpdateRole(Name string, DbNames []string, Actions []RoleAction) error {
+	if Name == "" {
+		return fmt.Errorf("role name not be empty")
+	}
+	if len(DbNames) == 0 {
+		return fmt.Errorf("DbNames not be empty")
+	}
+	for _, action := range Actions {
+		if !checkRoleAction(action) {
+			return fmt.Errorf("action:%s not supported", action)
+		}
+	}
+	Role := &RoleInfo{
+		Name:       Name,
+		DbNames:    DbNames,
+		Actions:    Actions,
+		AddTime:    time.Now().Unix(),
+		UpdateTime: time.Now().Unix(),
+	}
+	if OldRoleInfo := GetRoleInfo(Name); OldRoleInfo != nil {
+		Role.AddTime = OldRoleInfo.AddTime
+	}
+	b, _ := json.Marshal(Role)
+	return storage.PutKeyVal([]byte(ROLE_PREFIX+Name), b)
+}
+
+func DelRole(Name string) error {
+	return storage.DelKeyVal([]byte(ROLE_PREFIX + Name))
+}
+
+func (Role *RoleInfo) checkPermission(dbName string, action RoleAction) bool {
+	var dbOk bool
+	for _, v := range Role.DbNames {
+		if v == "*" || v == dbName {
+			dbOk = true
+			break
+		}
+	}
+	if !dbOk {
+		return false
+	}
+	for _, v := range Role.Actions {
+		if v == action {
+			return true
+		}
+	}
+	return false
+}
+
+// administrator 拥有所有权限, 其他用户 需要有一个角色 包含 dbName 及 action
+func CheckUserPermission(userInfo *UserInfo, dbName string, action RoleAction) bool {
+	if userInfo == nil {
+		return false
+	}
+	if userInfo.Group == "administrator" {
+		return true
+	}
+	if dbName == "" {
+		return false
+	}
+	for _, RoleName := range userInfo.Roles {
+		Role := GetRoleInfo(RoleName)
+		if Role != nil && Role.checkPermission(dbName, action) {
+			return true
+		}
+	}
+	return false
+}
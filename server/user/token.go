@@ -0,0 +1,143 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/brokercap/Bifrost/server/storage"
+)
+
+/*
+API Token, 给自动化脚本使用, 请求的时候 带上 Authorization: Bearer <token>
+token 格式为 bft_<ID>_<secret>, 只在添加的时候返回一次, 存储中 只保存 secret 的 sha256
+token 的权限 和 所属用户 的权限一样
+*/
+
+const TOKEN_PREFIX string = "bifrost_UserToken_"
+
+const tokenFlag = "bft_"
+
+type TokenInfo struct {
+	ID         string
+	UserName   string
+	Notes      string
+	SecretHash string `json:",omitempty"`
+	ExpireTime int64  // 过期时间, 0 为永不过期
+	AddTime    int64
+}
+
+func randHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func hashTokenSecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+func AddToken(UserName, Notes string, ExpireTime int64) (token string, err error) {
+	if GetUserInfo(UserName).Name == "" {
+		return "", fmt.Errorf("user:%s not exist", UserName)
+	}
+	ID := randHex(8)
+	secret := randHex(32)
+	Token := &TokenInfo{
+		ID:         ID,
+		UserName:   UserName,
+		Notes:      Notes,
+		SecretHash: hashTokenSecret(secret),
+		ExpireTime: ExpireTime,
+		AddTime:    time.Now().Unix(),
+	}
+	b, _ := json.Marshal(Token)
+	if err = storage.PutKeyVal([]byte(TOKEN_PREFIX+ID), b); err != nil {
+		return "", err
+	}
+	return tokenFlag + ID + "_" + secret, nil
+}
+
+func DelToken(ID string) error {
+	return storage.DelKeyVal([]byte(TOKEN_PREFIX + ID))
+}
+
+// UserName 为空的时候 返回所有的 token, 不返回 SecretHash
+func GetTokenList(UserName string) []TokenInfo {
+	tokenListString := storage.GetListByPrefix([]byte(TOKEN_PREFIX))
+	TokenList := make([]TokenInfo, 0)
+	for _, v := range tokenListString {
+		var Token TokenInfo
+		if err := json.Unmarshal([]byte(v.Value), &Token); err != nil {
+			continue
+		}
+		if UserName != "" && Token.UserName != UserName {
+			continue
+		}
+		Token.SecretHash = ""
+		TokenList = append(TokenList, Token)
+	}
+	return TokenList
+}
+
+func getTokenInfo(ID string) *TokenInfo {
+	b, err := storage.GetKeyVal([]byte(TOKEN_PREFIX + ID))
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	var Token TokenInfo
+	if err = json.Unmarshal(b, &Token); err != nil {
+		return nil
+	}
+	return &Token
+}
+
+func CheckToken(token string) (userInfo *UserInfo, err error) {
+	if !strings.HasPrefix(token, tokenFlag) {
+		return nil, errors.New("token error")
+	}
+	arr := strings.SplitN(token[len(tokenFlag):], "_", 2)
+	if len(arr) != 2 {
+		return nil, errors.New("token error")
+	}
+	Token := getTokenInfo(arr[0])
+	if Token == nil || subtle.ConstantTimeCompare([]byte(Token.SecretHash), []byte(hashTokenSecret(arr[1]))) != 1 {
+		return nil, errors.New("token error")
+	}
+	if Token.ExpireTime > 0 && Token.ExpireTime < time.Now().Unix() {
+		return nil, errors.New("token expired")
+	}
+	userInfo = GetUserInfo(Token.UserName)
+	if userInfo.Name == "" {
+		return nil, errors.New("user not exist")
+	}
+	return userInfo, nil
+}
+
+// 和 CheckUserWithIP 一样, 失败次数过多的 IP 会被拒绝
+func CheckTokenWithIP(token string, IP string, RemoteAddrIp string) (userInfo *UserInfo, err error) {
+	if RemoteAddrIp != "127.0.0.1" && CheckRefuseIp(IP) {
+		return nil, errors.New("ip is refused")
+	}
+	userInfo, err = CheckToken(token)
+	if err != nil {
+		AddFailedIp(IP)
+		appendLoginLog("IP:%s token login failed:%s", IP, err.Error())
+		return nil, err
+	}
+	if userInfo.Group == "" {
+		userInfo.Group = "monitor"
+	}
+	if err = CheckUserHost(IP, userInfo.Host); err != nil {
+		AddFailedIp(IP)
+		appendLoginLog("IP:%s UserName:%s token CheckUserHost failed", IP, userInfo.Name)
+	}
+	return
+}
@@ -18,9 +18,11 @@ type UserGroupType string
 
 type UserInfo struct {
 	Name       string
-	Password   string
+	Password   string // HashPassword 之后的密码, 老版本是明文
 	Group      string
 	Host       string
+	Roles      []string // 非 administrator 用户 的角色
+	Source     string   // 外部认证的用户 为认证方式, 比如 ldap, 本地用户 为空
 	AddTime    int64
 	UpdateTime int64
 }
@@ -37,9 +39,15 @@ func getUserGroup(groupName string) string {
 }
 
 func InitUser() {
+	InitAuthProvider()
+	//不允许本地用户登入的情况下, 不导入配置文件中的用户
+	if !IsLocalLoginEnable() {
+		return
+	}
 	userList := storage.GetListByPrefix([]byte(USER_PREFIX))
 	//假如 userList 为空的情况下,则需要将 etc 配置文件中的用户名和密码导入到存储中
 	if len(userList) != 0 {
+		migrateUserPassword()
 		return
 	}
 	func() {
@@ -52,7 +60,7 @@ func InitUser() {
 			UserGroup := getUserGroup(config.GetConfigVal("groups", Name))
 			User := UserInfo{
 				Name:       Name,
-				Password:   Password,
+				Password:   HashPassword(Password),
 				Group:      UserGroup,
 				Host:       "%",
 				AddTime:    time.Now().Unix(),
@@ -67,6 +75,20 @@ func InitUser() {
 	}()
 }
 
+// 老版本 明文保存的密码 转换成 HashPassword 之后的密码
+func migrateUserPassword() {
+	for _, User := range GetUserList() {
+		if User.Name == "" || IsHashedPassword(User.Password) {
+			continue
+		}
+		User.Password = HashPassword(User.Password)
+		b, _ := json.Marshal(User)
+		if err := storage.PutKeyVal([]byte(USER_PREFIX+User.Name), b); err != nil {
+			log.Println("migrate user password error:", err, " user:", User.Name)
+		}
+	}
+}
+
 func RecoveryUser(content *json.RawMessage) {
 	if content == nil {
 		return
@@ -82,6 +104,7 @@ func RecoveryUser(content *json.RawMessage) {
 		b, _ := json.Marshal(User)
 		storage.PutKeyVal([]byte(USER_PREFIX+User.Name), b)
 	}
+	migrateUserPassword()
 }
 
 func GetUserList() []UserInfo {
@@ -108,20 +131,31 @@ func DelUser(Name string) error {
 	return storage.DelKeyVal([]byte(key))
 }
 
-func AddUser(Name, Password, GroupName string, Host string) error {
-	return UpdateUser(Name, Password, GroupName, Host)
+func AddUser(Name, Password, GroupName string, Host string, Roles []string) error {
+	return UpdateUser(Name, Password, GroupName, Host, Roles)
 }
 
-func UpdateUser(Name, Password, GroupName string, Host string) error {
-	if Name == "" || Password == "" {
+// 修改用户的时候 Password 为空 则不修改密码
+func UpdateUser(Name, Password, GroupName string, Host string, Roles []string) error {
+	OldUserInfo := GetUserInfo(Name)
+	if Name == "" || (Password == "" && OldUserInfo.Name == "") {
 		return fmt.Errorf("name and password not be empty")
 	}
-	OldUserInfo := GetUserInfo(Name)
+	for _, RoleName := range Roles {
+		if GetRoleInfo(RoleName) == nil {
+			return fmt.Errorf("role:%s not exist", RoleName)
+		}
+	}
 	User := &UserInfo{
 		Name:     Name,
-		Password: Password,
+		Password: OldUserInfo.Password,
 		Host:     Host,
 		Group:    getUserGroup(GroupName),
+		Roles:    Roles,
+		Source:   OldUserInfo.Source,
+	}
+	if Password != "" {
+		User.Password = HashPassword(Password)
 	}
 	if OldUserInfo.Name == "" {
 		User.AddTime = time.Now().Unix()
@@ -154,10 +188,17 @@ func CheckUser(Name, Password string) (userInfo *UserInfo, err error) {
 		err = errors.New("user not exist")
 		return
 	}
-	if userInfo.Password != Password {
+	// 外部认证的用户 没有本地密码
+	if userInfo.Source != AUTH_SOURCE_LOCAL || userInfo.Password == "" || !checkPassword(userInfo.Password, Password) {
 		err = errors.New("password error")
 		return
 	}
+	// 明文保存的老密码, 登入成功之后 转换
+	if !IsHashedPassword(userInfo.Password) {
+		userInfo.Password = HashPassword(Password)
+		b, _ := json.Marshal(userInfo)
+		storage.PutKeyVal([]byte(USER_PREFIX+Name), b)
+	}
 	return
 }
 
@@ -168,10 +209,10 @@ func CheckUserWithIP(Name, Password string, IP string, RemoteAddrIp string) (use
 	if RemoteAddrIp != "127.0.0.1" && CheckRefuseIp(IP) {
 		return nil, errors.New("ip is refused")
 	}
-	userInfo, err = CheckUser(Name, Password)
+	userInfo, err = authenticate(Name, Password)
 	if err != nil {
 		AddFailedIp(IP)
-		appendLoginLog("IP:%s UserName:%s Password:%s login failed", IP, Name, Password)
+		appendLoginLog("IP:%s UserName:%s login failed", IP, Name)
 		return nil, errors.New("user or password error")
 	}
 	err = CheckUserHost(IP, userInfo.Host)
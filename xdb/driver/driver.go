@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"time"
 )
 
 var (
@@ -30,6 +31,14 @@ type XdbDriver interface {
 	Close() error
 }
 
+// 租约,用于多节点选主,只有支持多节点共享的存储驱动才需要实现
+type XdbLeaseDriver interface {
+	// key 不存在 或者 key 的值等于 val 的情况下, 设置 key = val 并且 ttl 后过期, 返回 true
+	AcquireLease(key []byte, val []byte, ttl time.Duration) (bool, error)
+	// key 的值等于 val 的情况下, 删除 key
+	ReleaseLease(key []byte, val []byte) error
+}
+
 type ListValue struct {
 	Key   string
 	Value string
@@ -26,7 +26,7 @@ func getKeyVal(table, key1 string) ([]byte, error) {
 }
 
 func TestPool(t *testing.T) {
-	xdb.InitClientPool("leveldb", "./myleveldir4", 1)
+	xdb.InitClientPool("leveldb", t.TempDir(), 1)
 
 	type DataSource struct {
 		Name string
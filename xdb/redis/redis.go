@@ -178,3 +178,50 @@ func (This *Conn) GetListByKeyPrefix(key []byte) ([]driver.ListValue, error) {
 	}
 	return data, nil
 }
+
+// key 不存在则设置,key 的值是自己则续期,否则返回 0
+var acquireLeaseScript = redis.NewScript(`
+local v = redis.call("GET", KEYS[1])
+if v == false then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+if v == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+var releaseLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func (This *Conn) AcquireLease(key []byte, val []byte, ttl time.Duration) (bool, error) {
+	This.InitConn()
+	if This.conn == nil {
+		return false, This.err
+	}
+	n, err := acquireLeaseScript.Run(ctx, This.conn, []string{string(key)}, string(val), ttl.Milliseconds()).Int()
+	if err != nil {
+		This.Close()
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (This *Conn) ReleaseLease(key []byte, val []byte) error {
+	This.InitConn()
+	if This.conn == nil {
+		return This.err
+	}
+	err := releaseLeaseScript.Run(ctx, This.conn, []string{string(key)}, string(val)).Err()
+	if err != nil && err.Error() != "redis: nil" {
+		This.Close()
+		return err
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/brokercap/Bifrost/xdb/driver"
 	"github.com/brokercap/Bifrost/xdb/redis"
 	"testing"
+	"time"
 )
 
 func getConn() (driver.XdbDriver, error) {
@@ -84,3 +85,37 @@ func TestConn_GetListByKeyPrefix(t *testing.T) {
 	}
 	t.Log("GetListByKeyPrefix test success")
 }
+
+func TestConn_AcquireLease(t *testing.T) {
+	conn, err := getConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaseConn := conn.(driver.XdbLeaseDriver)
+	key := []byte("lease-test")
+	ok, err := leaseConn.AcquireLease(key, []byte("node1"), 2*time.Second)
+	if err != nil || !ok {
+		t.Fatal("node1 acquire failed", ok, err)
+	}
+	ok, err = leaseConn.AcquireLease(key, []byte("node2"), 2*time.Second)
+	if err != nil || ok {
+		t.Fatal("node2 acquire must be failed", ok, err)
+	}
+	// 续期
+	ok, err = leaseConn.AcquireLease(key, []byte("node1"), 2*time.Second)
+	if err != nil || !ok {
+		t.Fatal("node1 renew failed", ok, err)
+	}
+	if err = leaseConn.ReleaseLease(key, []byte("node2")); err != nil {
+		t.Fatal(err)
+	}
+	if err = leaseConn.ReleaseLease(key, []byte("node1")); err != nil {
+		t.Fatal(err)
+	}
+	ok, err = leaseConn.AcquireLease(key, []byte("node2"), 2*time.Second)
+	if err != nil || !ok {
+		t.Fatal("node2 acquire failed after node1 release", ok, err)
+	}
+	leaseConn.ReleaseLease(key, []byte("node2"))
+	t.Log("AcquireLease test success")
+}
@@ -2,7 +2,9 @@ package xdb
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/brokercap/Bifrost/xdb/driver"
+	"time"
 )
 
 import (
@@ -100,6 +102,24 @@ func (This *Client) GetListByKeyPrefix(table, key string, data interface{}) ([]d
 	return s, err
 }
 
+func (This *Client) AcquireLease(table, key string, val []byte, ttl time.Duration) (bool, error) {
+	leaseClient, ok := This.client.(driver.XdbLeaseDriver)
+	if !ok {
+		return false, fmt.Errorf("xdb driver not supported lease")
+	}
+	myKey := []byte(This.prefix + "-" + table + "-" + key)
+	return leaseClient.AcquireLease(myKey, val, ttl)
+}
+
+func (This *Client) ReleaseLease(table, key string, val []byte) error {
+	leaseClient, ok := This.client.(driver.XdbLeaseDriver)
+	if !ok {
+		return fmt.Errorf("xdb driver not supported lease")
+	}
+	myKey := []byte(This.prefix + "-" + table + "-" + key)
+	return leaseClient.ReleaseLease(myKey, val)
+}
+
 func (This *Client) Close() error {
 	return This.client.Close()
 }
@@ -11,7 +11,7 @@ import (
 )
 
 func TestClient(t *testing.T) {
-	client, err := xdb.NewClient("leveldb", "./myleveldir4")
+	client, err := xdb.NewClient("leveldb", t.TempDir())
 	if err != nil {
 		t.Fatal(err)
 		os.Exit(1)